@@ -0,0 +1,263 @@
+//go:build linux
+// +build linux
+
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accelerators
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/cadvisor/container"
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/stats"
+
+	"k8s.io/klog/v2"
+)
+
+// amdGPU is an AMD GPU exposed by the amdgpu driver in sysfs.
+type amdGPU struct {
+	// devicePath is the PCI device directory of the GPU holding its
+	// gpu_busy_percent and mem_info_vram_* files.
+	devicePath string
+	id         string
+	model      string
+}
+
+type amdManager struct {
+	sync.Mutex
+
+	// true if there are AMD devices present on the node
+	devicesPresent bool
+
+	// amdDevices is a map from DRM minor number, of both the card and render
+	// nodes, to the GPU behind it.
+	amdDevices map[int]*amdGPU
+}
+
+var sysFsDRMPath = "/sys/class/drm/"
+
+const (
+	amdVendorID = "0x1002"
+	// DRM devices are character devices with major number 226.
+	// https://github.com/torvalds/linux/blob/v5.10/Documentation/admin-guide/devices.txt#L2751
+	drmMajor = "226"
+)
+
+var drmNodeRegexp = regexp.MustCompile(`^(card|renderD)[0-9]+$`)
+
+func NewAMDManager(includedMetrics container.MetricSet) stats.Manager {
+	if !includedMetrics.Has(container.AcceleratorUsageMetrics) {
+		klog.V(2).Info("AMD GPU metrics disabled")
+		return &stats.NoopManager{}
+	}
+
+	manager := &amdManager{}
+	if !detectDevices(amdVendorID) {
+		klog.V(2).Info("AMD setup failed: no AMD devices found")
+		return manager
+	}
+	manager.devicesPresent = true
+	if err := manager.discoverDevices(); err != nil {
+		klog.V(2).Infof("AMD setup failed: %s", err)
+	}
+	return manager
+}
+
+// discoverDevices sets up the amdDevices map from the DRM nodes of the amdgpu
+// driver.
+func (am *amdManager) discoverDevices() error {
+	nodes, err := ioutil.ReadDir(sysFsDRMPath)
+	if err != nil {
+		return fmt.Errorf("error reading %q: %v", sysFsDRMPath, err)
+	}
+	gpus := map[string]*amdGPU{}
+	devices := map[int]*amdGPU{}
+	for _, node := range nodes {
+		if !drmNodeRegexp.MatchString(node.Name()) {
+			continue
+		}
+		nodePath := filepath.Join(sysFsDRMPath, node.Name())
+		vendor, err := ioutil.ReadFile(filepath.Join(nodePath, "device", "vendor"))
+		if err != nil || !strings.EqualFold(strings.TrimSpace(string(vendor)), amdVendorID) {
+			continue
+		}
+		minor, err := drmNodeMinor(nodePath)
+		if err != nil {
+			klog.V(4).Infof("Skipping DRM node %q: %v", nodePath, err)
+			continue
+		}
+		devicePath, err := filepath.EvalSymlinks(filepath.Join(nodePath, "device"))
+		if err != nil {
+			klog.V(4).Infof("Skipping DRM node %q: %v", nodePath, err)
+			continue
+		}
+		// The card and render nodes of a GPU share its PCI device.
+		gpu, ok := gpus[devicePath]
+		if !ok {
+			gpu = newAMDGPU(devicePath)
+			gpus[devicePath] = gpu
+		}
+		devices[minor] = gpu
+	}
+	if len(gpus) > 0 {
+		klog.V(1).Infof("Number of AMD devices: %v", len(gpus))
+	}
+	am.amdDevices = devices
+	return nil
+}
+
+// drmNodeMinor returns the minor number of the DRM node whose sysfs directory
+// is given, read from its dev file holding major:minor.
+func drmNodeMinor(nodePath string) (int, error) {
+	content, err := ioutil.ReadFile(filepath.Join(nodePath, "dev"))
+	if err != nil {
+		return 0, err
+	}
+	majorMinor := strings.Split(strings.TrimSpace(string(content)), ":")
+	if len(majorMinor) != 2 || majorMinor[0] != drmMajor {
+		return 0, fmt.Errorf("unexpected device number %q", strings.TrimSpace(string(content)))
+	}
+	return strconv.Atoi(majorMinor[1])
+}
+
+func newAMDGPU(devicePath string) *amdGPU {
+	gpu := &amdGPU{devicePath: devicePath}
+	// unique_id is only exposed by the GPUs supporting it, fall back to the PCI
+	// address of the device.
+	if id, err := readTrimmed(filepath.Join(devicePath, "unique_id")); err == nil && id != "" {
+		gpu.id = id
+	} else {
+		gpu.id = filepath.Base(devicePath)
+	}
+	if model, err := readTrimmed(filepath.Join(devicePath, "product_name")); err == nil && model != "" {
+		gpu.model = model
+	} else if model, err := readTrimmed(filepath.Join(devicePath, "device")); err == nil {
+		gpu.model = model
+	}
+	return gpu
+}
+
+// Destroy does nothing, the AMD GPUs are read from sysfs.
+func (am *amdManager) Destroy() {}
+
+// GetCollector returns a collector that can fetch AMD gpu metrics for AMD devices
+// present in the devices.list file in the given devicesCgroupPath.
+func (am *amdManager) GetCollector(devicesCgroupPath string) (stats.Collector, error) {
+	if !am.devicesPresent {
+		return &stats.NoopCollector{}, nil
+	}
+	// The amdgpu driver may have been loaded after cAdvisor started.
+	am.Lock()
+	if len(am.amdDevices) == 0 {
+		if err := am.discoverDevices(); err != nil {
+			am.Unlock()
+			return &stats.NoopCollector{}, err
+		}
+	}
+	devices := am.amdDevices
+	am.Unlock()
+	if len(devices) == 0 {
+		return &stats.NoopCollector{}, nil
+	}
+	drmMinorNumbers, err := parseDRMDevicesCgroup(devicesCgroupPath)
+	if err != nil {
+		return &stats.NoopCollector{}, err
+	}
+
+	ac := &amdCollector{}
+	added := map[*amdGPU]bool{}
+	for _, minor := range drmMinorNumbers {
+		gpu, ok := devices[minor]
+		if !ok {
+			// DRM nodes of other vendors.
+			continue
+		}
+		if !added[gpu] {
+			added[gpu] = true
+			ac.devices = append(ac.devices, gpu)
+		}
+	}
+	if len(ac.devices) == 0 {
+		return &stats.NoopCollector{}, nil
+	}
+	return ac, nil
+}
+
+// parseDRMDevicesCgroup returns the minor numbers of the DRM devices that the
+// container is allowed to access according to its devices cgroup.
+// This is defined as a variable to help in testing.
+var parseDRMDevicesCgroup = func(devicesCgroupPath string) ([]int, error) {
+	// A container allowed to use all the DRM devices does not get stats, as
+	// with "a *:*".
+	return parseDevicesCgroupMinors(devicesCgroupPath, drmMajor, true)
+}
+
+type amdCollector struct {
+	// Exposed for testing
+	devices []*amdGPU
+
+	stats.NoopDestroy
+}
+
+// UpdateStats updates the stats for AMD GPUs (if any) attached to the container.
+func (ac *amdCollector) UpdateStats(stats *info.ContainerStats) error {
+	for _, gpu := range ac.devices {
+		memoryTotal, err := readUint64(filepath.Join(gpu.devicePath, "mem_info_vram_total"))
+		if err != nil {
+			return fmt.Errorf("error while getting gpu memory total: %v", err)
+		}
+		memoryUsed, err := readUint64(filepath.Join(gpu.devicePath, "mem_info_vram_used"))
+		if err != nil {
+			return fmt.Errorf("error while getting gpu memory used: %v", err)
+		}
+		utilizationGPU, err := readUint64(filepath.Join(gpu.devicePath, "gpu_busy_percent"))
+		if err != nil {
+			return fmt.Errorf("error while getting gpu utilization: %v", err)
+		}
+
+		stats.Accelerators = append(stats.Accelerators, info.AcceleratorStats{
+			Make:        "amd",
+			Model:       gpu.model,
+			ID:          gpu.id,
+			MemoryTotal: memoryTotal,
+			MemoryUsed:  memoryUsed,
+			DutyCycle:   utilizationGPU,
+		})
+	}
+	return nil
+}
+
+func readTrimmed(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func readUint64(path string) (uint64, error) {
+	content, err := readTrimmed(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(content, 10, 64)
+}
@@ -0,0 +1,32 @@
+//go:build !linux
+// +build !linux
+
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accelerators
+
+import (
+	"github.com/google/cadvisor/container"
+	"github.com/google/cadvisor/stats"
+
+	"k8s.io/klog/v2"
+)
+
+// NewAMDManager returns a no-op manager, AMD GPUs are only read from the sysfs
+// of Linux.
+func NewAMDManager(includedMetrics container.MetricSet) stats.Manager {
+	klog.V(1).Info("cAdvisor is built for a non Linux platform. AMD GPU metrics are not available.")
+	return &stats.NoopManager{}
+}
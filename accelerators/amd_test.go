@@ -0,0 +1,142 @@
+//go:build linux
+// +build linux
+
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accelerators
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/cadvisor/container"
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/stats"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDRMNode creates the sysfs directory of a DRM node backed by the given
+// PCI device.
+func fakeDRMNode(t *testing.T, drmPath, name, dev, devicePath string) {
+	nodePath := filepath.Join(drmPath, name)
+	require.NoError(t, os.Mkdir(nodePath, 0777))
+	updateFile(t, filepath.Join(nodePath, "dev"), []byte(dev+"\n"))
+	require.NoError(t, os.Symlink(devicePath, filepath.Join(nodePath, "device")))
+}
+
+func TestAMDCollector(t *testing.T) {
+	originalPCIDevicesPath := sysFsPCIDevicesPath
+	originalDRMPath := sysFsDRMPath
+	defer func() {
+		sysFsPCIDevicesPath = originalPCIDevicesPath
+		sysFsDRMPath = originalDRMPath
+	}()
+
+	root, err := ioutil.TempDir("", "sys")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	sysFsPCIDevicesPath = filepath.Join(root, "bus", "pci", "devices")
+	sysFsDRMPath = filepath.Join(root, "class", "drm")
+	require.NoError(t, os.MkdirAll(sysFsPCIDevicesPath, 0777))
+	require.NoError(t, os.MkdirAll(sysFsDRMPath, 0777))
+
+	// An AMD GPU with its card and render nodes.
+	amdDevice := filepath.Join(sysFsPCIDevicesPath, "0000:03:00.0")
+	require.NoError(t, os.Mkdir(amdDevice, 0777))
+	updateFile(t, filepath.Join(amdDevice, "vendor"), []byte("0x1002\n"))
+	updateFile(t, filepath.Join(amdDevice, "device"), []byte("0x738c\n"))
+	updateFile(t, filepath.Join(amdDevice, "unique_id"), []byte("2d4bd2d67c4ed0e3\n"))
+	updateFile(t, filepath.Join(amdDevice, "gpu_busy_percent"), []byte("42\n"))
+	updateFile(t, filepath.Join(amdDevice, "mem_info_vram_total"), []byte("34342961152\n"))
+	updateFile(t, filepath.Join(amdDevice, "mem_info_vram_used"), []byte("1073741824\n"))
+	fakeDRMNode(t, sysFsDRMPath, "card0", "226:0", amdDevice)
+	fakeDRMNode(t, sysFsDRMPath, "renderD128", "226:128", amdDevice)
+
+	// An integrated GPU of another vendor.
+	otherDevice := filepath.Join(sysFsPCIDevicesPath, "0000:00:02.0")
+	require.NoError(t, os.Mkdir(otherDevice, 0777))
+	updateFile(t, filepath.Join(otherDevice, "vendor"), []byte("0x8086\n"))
+	fakeDRMNode(t, sysFsDRMPath, "card1", "226:1", otherDevice)
+	fakeDRMNode(t, sysFsDRMPath, "renderD129", "226:129", otherDevice)
+
+	// Without accelerator metrics, no manager is set up.
+	manager := NewAMDManager(container.MetricSet{})
+	assert.IsType(t, &stats.NoopManager{}, manager)
+
+	manager = NewAMDManager(container.MetricSet{container.AcceleratorUsageMetrics: struct{}{}})
+	am, ok := manager.(*amdManager)
+	require.True(t, ok)
+	assert.True(t, am.devicesPresent)
+	assert.Len(t, am.amdDevices, 2)
+
+	devicesCgroup := filepath.Join(root, "devices")
+	require.NoError(t, os.Mkdir(devicesCgroup, 0777))
+	devicesList := filepath.Join(devicesCgroup, "devices.list")
+
+	// A container allowed to use all the devices does not get stats.
+	updateFile(t, devicesList, []byte("a *:* rwm\n"))
+	collector, err := manager.GetCollector(devicesCgroup)
+	assert.NoError(t, err)
+	assert.IsType(t, &stats.NoopCollector{}, collector)
+
+	// Nor does a container allowed to use all the DRM devices.
+	updateFile(t, devicesList, []byte("c 226:* rwm\n"))
+	collector, err = manager.GetCollector(devicesCgroup)
+	assert.NoError(t, err)
+	assert.IsType(t, &stats.NoopCollector{}, collector)
+
+	// A container allowed to use the other GPU only does not get stats.
+	updateFile(t, devicesList, []byte("c 226:1 rwm\nc 226:129 rwm\n"))
+	collector, err = manager.GetCollector(devicesCgroup)
+	assert.NoError(t, err)
+	assert.IsType(t, &stats.NoopCollector{}, collector)
+
+	// Both nodes of the AMD GPU are attributed to a single accelerator.
+	updateFile(t, devicesList, []byte("c 226:0 rwm\nc 226:128 rwm\nc 226:1 rwm\nc 1:3 rwm\n"))
+	collector, err = manager.GetCollector(devicesCgroup)
+	require.NoError(t, err)
+
+	var containerStats info.ContainerStats
+	require.NoError(t, collector.UpdateStats(&containerStats))
+	assert.Equal(t, []info.AcceleratorStats{{
+		Make:        "amd",
+		Model:       "0x738c",
+		ID:          "2d4bd2d67c4ed0e3",
+		MemoryTotal: 34342961152,
+		MemoryUsed:  1073741824,
+		DutyCycle:   42,
+	}}, containerStats.Accelerators)
+
+	// The product name is preferred as model, and the PCI address is the ID of
+	// GPUs without unique_id.
+	updateFile(t, filepath.Join(amdDevice, "product_name"), []byte("Instinct MI100\n"))
+	require.NoError(t, os.Remove(filepath.Join(amdDevice, "unique_id")))
+	am.amdDevices = nil
+	collector, err = manager.GetCollector(devicesCgroup)
+	require.NoError(t, err)
+	containerStats = info.ContainerStats{}
+	require.NoError(t, collector.UpdateStats(&containerStats))
+	require.Len(t, containerStats.Accelerators, 1)
+	assert.Equal(t, "Instinct MI100", containerStats.Accelerators[0].Model)
+	assert.Equal(t, "0000:03:00.0", containerStats.Accelerators[0].ID)
+
+	// A GPU whose stats can't be read fails the collection.
+	require.NoError(t, os.Remove(filepath.Join(amdDevice, "gpu_busy_percent")))
+	assert.Error(t, collector.UpdateStats(&info.ContainerStats{}))
+}
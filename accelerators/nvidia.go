@@ -29,6 +29,7 @@ import (
 	"github.com/google/cadvisor/stats"
 
 	"github.com/mindprince/gonvml"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"k8s.io/klog/v2"
 )
 
@@ -142,7 +143,7 @@ func (nm *nvidiaManager) Destroy() {
 // GetCollector returns a collector that can fetch NVIDIA gpu metrics for NVIDIA devices
 // present in the devices.list file in the given devicesCgroupPath.
 func (nm *nvidiaManager) GetCollector(devicesCgroupPath string) (stats.Collector, error) {
-	nc := &nvidiaCollector{}
+	nc := &nvidiaCollector{cgroupPath: devicesCgroupPath}
 
 	if !nm.devicesPresent {
 		return &stats.NoopCollector{}, nil
@@ -183,13 +184,37 @@ func (nm *nvidiaManager) GetCollector(devicesCgroupPath string) (stats.Collector
 // the devices.list file, we return an empty list.
 // This is defined as a variable to help in testing.
 var parseDevicesCgroup = func(devicesCgroupPath string) ([]int, error) {
+	// NVIDIA graphics devices are character devices with major number 195.
+	// https://github.com/torvalds/linux/blob/v4.13/Documentation/admin-guide/devices.txt#L2583
+	// A "195:*" entry is reported as an error.
+	minorNumbers, err := parseDevicesCgroupMinors(devicesCgroupPath, "195", false)
 	// Always return a non-nil slice
 	nvidiaMinorNumbers := []int{}
+	if err != nil {
+		return nvidiaMinorNumbers, err
+	}
+	for _, minorNumber := range minorNumbers {
+		// We don't want devices like nvidiactl (195:255) and nvidia-modeset (195:254)
+		if minorNumber < 128 {
+			nvidiaMinorNumbers = append(nvidiaMinorNumbers, minorNumber)
+		}
+	}
+	return nvidiaMinorNumbers, nil
+}
+
+// parseDevicesCgroupMinors parses the devices cgroup devices.list file for the
+// container and returns the minor numbers of the character devices with the
+// given major number that the container is allowed to access. A "<major>:*"
+// entry, giving access to all the devices of the major number, is ignored if
+// ignoreAllMinors is set, and is an error otherwise.
+func parseDevicesCgroupMinors(devicesCgroupPath string, major string, ignoreAllMinors bool) ([]int, error) {
+	// Always return a non-nil slice
+	minorNumbers := []int{}
 
 	devicesList := filepath.Join(devicesCgroupPath, "devices.list")
 	f, err := os.Open(devicesList)
 	if err != nil {
-		return nvidiaMinorNumbers, fmt.Errorf("error while opening devices cgroup file %q: %v", devicesList, err)
+		return minorNumbers, fmt.Errorf("error while opening devices cgroup file %q: %v", devicesList, err)
 	}
 	defer f.Close()
 
@@ -201,39 +226,38 @@ var parseDevicesCgroup = func(devicesCgroupPath string) ([]int, error) {
 
 		fields := strings.Fields(text)
 		if len(fields) != 3 {
-			return nvidiaMinorNumbers, fmt.Errorf("invalid devices cgroup entry %q: must contain three whitespace-separated fields", text)
+			return []int{}, fmt.Errorf("invalid devices cgroup entry %q: must contain three whitespace-separated fields", text)
 		}
 
 		// Split the second field to find out major:minor numbers
 		majorMinor := strings.Split(fields[1], ":")
 		if len(majorMinor) != 2 {
-			return nvidiaMinorNumbers, fmt.Errorf("invalid devices cgroup entry %q: second field should have one colon", text)
+			return []int{}, fmt.Errorf("invalid devices cgroup entry %q: second field should have one colon", text)
 		}
 
-		// NVIDIA graphics devices are character devices with major number 195.
-		// https://github.com/torvalds/linux/blob/v4.13/Documentation/admin-guide/devices.txt#L2583
-		if fields[0] == "c" && majorMinor[0] == "195" {
+		if fields[0] == "c" && majorMinor[0] == major {
+			if majorMinor[1] == "*" && ignoreAllMinors {
+				continue
+			}
 			minorNumber, err := strconv.Atoi(majorMinor[1])
 			if err != nil {
-				return nvidiaMinorNumbers, fmt.Errorf("invalid devices cgroup entry %q: minor number is not integer", text)
+				return []int{}, fmt.Errorf("invalid devices cgroup entry %q: minor number is not integer", text)
 			}
-			// We don't want devices like nvidiactl (195:255) and nvidia-modeset (195:254)
-			if minorNumber < 128 {
-				nvidiaMinorNumbers = append(nvidiaMinorNumbers, minorNumber)
-			}
-			// We are ignoring the "195:*" case
-			// where the container has access to all NVIDIA devices on the machine.
+			minorNumbers = append(minorNumbers, minorNumber)
 		}
 		// We are ignoring the "*:*" case
 		// where the container has access to all devices on the machine.
 	}
-	return nvidiaMinorNumbers, nil
+	return minorNumbers, nil
 }
 
 type nvidiaCollector struct {
 	// Exposed for testing
 	devices []gonvml.Device
 
+	// Cgroup whose processes the GPU memory is attributed to.
+	cgroupPath string
+
 	stats.NoopDestroy
 }
 
@@ -262,14 +286,96 @@ func (nc *nvidiaCollector) UpdateStats(stats *info.ContainerStats) error {
 			return fmt.Errorf("error while getting gpu utilization: %v", err)
 		}
 
-		stats.Accelerators = append(stats.Accelerators, info.AcceleratorStats{
-			Make:        "nvidia",
-			Model:       model,
-			ID:          uuid,
-			MemoryTotal: memoryTotal,
-			MemoryUsed:  memoryUsed,
-			DutyCycle:   uint64(utilizationGPU),
-		})
+		processMemoryUsed, err := nc.processMemoryUsed(uuid)
+		if err != nil {
+			// Not all drivers and devices support listing processes.
+			klog.V(4).Infof("Unable to attribute memory of gpu %q to processes: %v", uuid, err)
+		}
+
+		acceleratorStats := info.AcceleratorStats{
+			Make:              "nvidia",
+			Model:             model,
+			ID:                uuid,
+			MemoryTotal:       memoryTotal,
+			MemoryUsed:        memoryUsed,
+			ProcessMemoryUsed: processMemoryUsed,
+			DutyCycle:         uint64(utilizationGPU),
+		}
+		setCodecUtilization(&acceleratorStats, device)
+		stats.Accelerators = append(stats.Accelerators, acceleratorStats)
 	}
 	return nil
 }
+
+// encoderUtilization and decoderUtilization return the utilization of the
+// video encoder and decoder of a GPU and their sampling period.
+// These are defined as variables to help in testing.
+var (
+	encoderUtilization = gonvml.Device.EncoderUtilization
+	decoderUtilization = gonvml.Device.DecoderUtilization
+)
+
+// setCodecUtilization sets the utilization of the video encoder and decoder
+// of the GPU, when the GPU supports querying them.
+func setCodecUtilization(stats *info.AcceleratorStats, device gonvml.Device) {
+	encoder, _, err := encoderUtilization(device)
+	if err != nil {
+		// Not all devices have a video encoder.
+		klog.V(4).Infof("Unable to get encoder utilization of gpu %q: %v", stats.ID, err)
+	} else {
+		stats.EncoderUtilization = uint64(encoder)
+	}
+	decoder, _, err := decoderUtilization(device)
+	if err != nil {
+		klog.V(4).Infof("Unable to get decoder utilization of gpu %q: %v", stats.ID, err)
+	} else {
+		stats.DecoderUtilization = uint64(decoder)
+	}
+}
+
+// gpuProcess is a compute process running on a GPU or on one of its MIG devices.
+type gpuProcess struct {
+	pid        int
+	memoryUsed uint64
+}
+
+// computeRunningProcesses returns the compute processes running on the GPU with
+// the given UUID, including the ones running on its MIG devices.
+// This is defined as a variable to help in testing.
+var computeRunningProcesses = nvmlComputeRunningProcesses
+
+// cgroupPids returns the pids of the processes in the given cgroup and its
+// descendants.
+// This is defined as a variable to help in testing.
+var cgroupPids = cgroups.GetAllPids
+
+// processMemoryUsed returns the memory of the GPU with the given UUID used by
+// the processes of the container.
+func (nc *nvidiaCollector) processMemoryUsed(uuid string) (uint64, error) {
+	if nc.cgroupPath == "" {
+		return 0, nil
+	}
+	processes, err := computeRunningProcesses(uuid)
+	if err != nil {
+		return 0, err
+	}
+	if len(processes) == 0 {
+		return 0, nil
+	}
+	pids, err := cgroupPids(nc.cgroupPath)
+	if err != nil {
+		return 0, fmt.Errorf("error while getting pids of cgroup %q: %v", nc.cgroupPath, err)
+	}
+	containerPids := make(map[int]struct{}, len(pids))
+	for _, pid := range pids {
+		containerPids[pid] = struct{}{}
+	}
+
+	var memoryUsed uint64
+	for _, process := range processes {
+		if _, ok := containerPids[process.pid]; ok {
+			memoryUsed += process.memoryUsed
+		}
+	}
+	return memoryUsed, nil
+}
@@ -14,6 +14,8 @@
 package accelerators
 
 import (
+	"fmt"
+	info "github.com/google/cadvisor/info/v1"
 	"github.com/google/cadvisor/stats"
 	"io/ioutil"
 	"os"
@@ -166,6 +168,12 @@ func TestParseDevicesCgroup(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, []int{0, 1}, nvidiaMinorNumbers) // Note that 255 is not supposed to be returned.
 
+	// Test case when the container has access to all nvidia devices.
+	updateFile(t, tmpfn, []byte("c 195:0 rwm\nc 195:* rwm\n"))
+	nvidiaMinorNumbers, err = parseDevicesCgroup(tmpDir)
+	assert.NotNil(t, err)
+	assert.Equal(t, []int{}, nvidiaMinorNumbers)
+
 	// Test case with a common devices.list file
 	updateFile(t, tmpfn, []byte("a *:* rwm\n"))
 	nvidiaMinorNumbers, err = parseDevicesCgroup(tmpDir)
@@ -178,3 +186,70 @@ func TestParseDevicesCgroup(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, []int{}, nvidiaMinorNumbers)
 }
+
+func TestProcessMemoryUsed(t *testing.T) {
+	originalComputeRunningProcesses := computeRunningProcesses
+	originalCgroupPids := cgroupPids
+	defer func() {
+		computeRunningProcesses = originalComputeRunningProcesses
+		cgroupPids = originalCgroupPids
+	}()
+
+	// Processes of the container and of another container, the container
+	// running on two MIG devices of the same GPU.
+	computeRunningProcesses = func(uuid string) ([]gpuProcess, error) {
+		assert.Equal(t, "GPU-deadbeef", uuid)
+		return []gpuProcess{
+			{pid: 10, memoryUsed: 100 << 20},
+			{pid: 20, memoryUsed: 400 << 20},
+			{pid: 11, memoryUsed: 50 << 20},
+			{pid: 10, memoryUsed: 25 << 20},
+		}, nil
+	}
+	cgroupPids = func(path string) ([]int, error) {
+		assert.Equal(t, "/sys/fs/cgroup/devices/docker/container", path)
+		return []int{1, 10, 11}, nil
+	}
+
+	nc := &nvidiaCollector{cgroupPath: "/sys/fs/cgroup/devices/docker/container"}
+	memoryUsed, err := nc.processMemoryUsed("GPU-deadbeef")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(175<<20), memoryUsed)
+
+	// No memory is attributed when listing processes is not supported.
+	computeRunningProcesses = func(_ string) ([]gpuProcess, error) {
+		return nil, fmt.Errorf("not supported")
+	}
+	memoryUsed, err = nc.processMemoryUsed("GPU-deadbeef")
+	assert.NotNil(t, err)
+	assert.Equal(t, uint64(0), memoryUsed)
+}
+
+func TestSetCodecUtilization(t *testing.T) {
+	originalEncoderUtilization := encoderUtilization
+	originalDecoderUtilization := decoderUtilization
+	defer func() {
+		encoderUtilization = originalEncoderUtilization
+		decoderUtilization = originalDecoderUtilization
+	}()
+
+	encoderUtilization = func(_ gonvml.Device) (uint, uint, error) {
+		return 35, 167000, nil
+	}
+	decoderUtilization = func(_ gonvml.Device) (uint, uint, error) {
+		return 80, 167000, nil
+	}
+	stats := info.AcceleratorStats{ID: "GPU-deadbeef"}
+	setCodecUtilization(&stats, gonvml.Device{})
+	assert.Equal(t, uint64(35), stats.EncoderUtilization)
+	assert.Equal(t, uint64(80), stats.DecoderUtilization)
+
+	// The utilization of a missing encoder is left unset.
+	encoderUtilization = func(_ gonvml.Device) (uint, uint, error) {
+		return 0, 0, fmt.Errorf("not supported")
+	}
+	stats = info.AcceleratorStats{ID: "GPU-deadbeef"}
+	setCodecUtilization(&stats, gonvml.Device{})
+	assert.Equal(t, uint64(0), stats.EncoderUtilization)
+	assert.Equal(t, uint64(80), stats.DecoderUtilization)
+}
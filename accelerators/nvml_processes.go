@@ -0,0 +1,228 @@
+//go:build cgo
+// +build cgo
+
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accelerators
+
+// gonvml does not bind the NVML process and MIG functions, so they are looked
+// up here in the libnvidia-ml.so.1 already loaded and initialized by gonvml.
+
+// #cgo LDFLAGS: -ldl
+/*
+#include <dlfcn.h>
+#include <stdlib.h>
+
+typedef int nvmlReturn_t;
+typedef struct nvmlDevice_st* nvmlDevice_t;
+
+#define NVML_SUCCESS 0
+#define NVML_ERROR_FUNCTION_NOT_FOUND 13
+
+typedef struct {
+  unsigned int pid;
+  unsigned long long usedGpuMemory;
+} nvmlProcessInfo_v1_t;
+
+typedef struct {
+  unsigned int pid;
+  unsigned long long usedGpuMemory;
+  unsigned int gpuInstanceId;
+  unsigned int computeInstanceId;
+} nvmlProcessInfo_v2_t;
+
+static nvmlReturn_t (*deviceGetHandleByUUIDFunc)(const char *uuid, nvmlDevice_t *device);
+static nvmlReturn_t (*deviceGetComputeRunningProcessesV1Func)(nvmlDevice_t device, unsigned int *count, nvmlProcessInfo_v1_t *infos);
+static nvmlReturn_t (*deviceGetComputeRunningProcessesV2Func)(nvmlDevice_t device, unsigned int *count, nvmlProcessInfo_v2_t *infos);
+static nvmlReturn_t (*deviceGetMigModeFunc)(nvmlDevice_t device, unsigned int *currentMode, unsigned int *pendingMode);
+static nvmlReturn_t (*deviceGetMaxMigDeviceCountFunc)(nvmlDevice_t device, unsigned int *count);
+static nvmlReturn_t (*deviceGetMigDeviceHandleByIndexFunc)(nvmlDevice_t device, unsigned int index, nvmlDevice_t *migDevice);
+
+static int loadProcessFunctions() {
+  void *handle = dlopen("libnvidia-ml.so.1", RTLD_LAZY | RTLD_GLOBAL);
+  if (handle == NULL) {
+    return 0;
+  }
+  deviceGetHandleByUUIDFunc = dlsym(handle, "nvmlDeviceGetHandleByUUID");
+  deviceGetComputeRunningProcessesV1Func = dlsym(handle, "nvmlDeviceGetComputeRunningProcesses");
+  deviceGetComputeRunningProcessesV2Func = dlsym(handle, "nvmlDeviceGetComputeRunningProcesses_v2");
+  deviceGetMigModeFunc = dlsym(handle, "nvmlDeviceGetMigMode");
+  deviceGetMaxMigDeviceCountFunc = dlsym(handle, "nvmlDeviceGetMaxMigDeviceCount");
+  deviceGetMigDeviceHandleByIndexFunc = dlsym(handle, "nvmlDeviceGetMigDeviceHandleByIndex");
+  return 1;
+}
+
+static nvmlReturn_t deviceGetHandleByUUID(const char *uuid, nvmlDevice_t *device) {
+  if (deviceGetHandleByUUIDFunc == NULL) {
+    return NVML_ERROR_FUNCTION_NOT_FOUND;
+  }
+  return deviceGetHandleByUUIDFunc(uuid, device);
+}
+
+// deviceGetComputeRunningProcesses returns the pids and used memory of the
+// processes in separate arrays so that callers don't depend on the version of
+// nvmlProcessInfo_t supported by the driver.
+static nvmlReturn_t deviceGetComputeRunningProcesses(nvmlDevice_t device, unsigned int *count, unsigned int *pids, unsigned long long *memoryUsed) {
+  nvmlReturn_t ret;
+  unsigned int i;
+  if (deviceGetComputeRunningProcessesV2Func != NULL) {
+    nvmlProcessInfo_v2_t *infos = NULL;
+    if (*count > 0) {
+      infos = calloc(*count, sizeof(nvmlProcessInfo_v2_t));
+    }
+    ret = deviceGetComputeRunningProcessesV2Func(device, count, infos);
+    for (i = 0; ret == NVML_SUCCESS && infos != NULL && i < *count; i++) {
+      pids[i] = infos[i].pid;
+      memoryUsed[i] = infos[i].usedGpuMemory;
+    }
+    free(infos);
+    return ret;
+  }
+  if (deviceGetComputeRunningProcessesV1Func != NULL) {
+    nvmlProcessInfo_v1_t *infos = NULL;
+    if (*count > 0) {
+      infos = calloc(*count, sizeof(nvmlProcessInfo_v1_t));
+    }
+    ret = deviceGetComputeRunningProcessesV1Func(device, count, infos);
+    for (i = 0; ret == NVML_SUCCESS && infos != NULL && i < *count; i++) {
+      pids[i] = infos[i].pid;
+      memoryUsed[i] = infos[i].usedGpuMemory;
+    }
+    free(infos);
+    return ret;
+  }
+  return NVML_ERROR_FUNCTION_NOT_FOUND;
+}
+
+static nvmlReturn_t deviceGetMigMode(nvmlDevice_t device, unsigned int *currentMode, unsigned int *pendingMode) {
+  if (deviceGetMigModeFunc == NULL) {
+    return NVML_ERROR_FUNCTION_NOT_FOUND;
+  }
+  return deviceGetMigModeFunc(device, currentMode, pendingMode);
+}
+
+static nvmlReturn_t deviceGetMaxMigDeviceCount(nvmlDevice_t device, unsigned int *count) {
+  if (deviceGetMaxMigDeviceCountFunc == NULL) {
+    return NVML_ERROR_FUNCTION_NOT_FOUND;
+  }
+  return deviceGetMaxMigDeviceCountFunc(device, count);
+}
+
+static nvmlReturn_t deviceGetMigDeviceHandleByIndex(nvmlDevice_t device, unsigned int index, nvmlDevice_t *migDevice) {
+  if (deviceGetMigDeviceHandleByIndexFunc == NULL) {
+    return NVML_ERROR_FUNCTION_NOT_FOUND;
+  }
+  return deviceGetMigDeviceHandleByIndexFunc(device, index, migDevice);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+const (
+	nvmlSuccess               = 0
+	nvmlErrorNotFound         = 6
+	nvmlErrorInsufficientSize = 7
+	nvmlDeviceMigEnable       = 1
+	nvmlValueNotAvailable     = ^uint64(0)
+	maxProcessListAttempts    = 3
+	extraProcessListCapacity  = 8
+)
+
+var (
+	loadProcessFunctionsOnce sync.Once
+	processFunctionsLoaded   bool
+)
+
+// nvmlComputeRunningProcesses returns the compute processes running on the
+// device with the given UUID. When MIG is enabled on the device, the processes
+// running on each of its MIG devices are returned instead.
+func nvmlComputeRunningProcesses(uuid string) ([]gpuProcess, error) {
+	loadProcessFunctionsOnce.Do(func() {
+		processFunctionsLoaded = C.loadProcessFunctions() == 1
+	})
+	if !processFunctionsLoaded {
+		return nil, fmt.Errorf("could not load libnvidia-ml.so.1")
+	}
+
+	cUUID := C.CString(uuid)
+	defer C.free(unsafe.Pointer(cUUID))
+	var device C.nvmlDevice_t
+	if ret := C.deviceGetHandleByUUID(cUUID, &device); ret != nvmlSuccess {
+		return nil, fmt.Errorf("failed to get handle of device %q: nvml error %d", uuid, ret)
+	}
+
+	var currentMode, pendingMode C.uint
+	if ret := C.deviceGetMigMode(device, &currentMode, &pendingMode); ret != nvmlSuccess || currentMode != nvmlDeviceMigEnable {
+		return deviceComputeRunningProcesses(device, uuid)
+	}
+
+	var count C.uint
+	if ret := C.deviceGetMaxMigDeviceCount(device, &count); ret != nvmlSuccess {
+		return nil, fmt.Errorf("failed to get MIG device count of device %q: nvml error %d", uuid, ret)
+	}
+	var processes []gpuProcess
+	for i := C.uint(0); i < count; i++ {
+		var migDevice C.nvmlDevice_t
+		ret := C.deviceGetMigDeviceHandleByIndex(device, i, &migDevice)
+		if ret == nvmlErrorNotFound {
+			// No MIG device was created in this slot.
+			continue
+		}
+		if ret != nvmlSuccess {
+			return nil, fmt.Errorf("failed to get MIG device %d of device %q: nvml error %d", i, uuid, ret)
+		}
+		migProcesses, err := deviceComputeRunningProcesses(migDevice, uuid)
+		if err != nil {
+			return nil, err
+		}
+		processes = append(processes, migProcesses...)
+	}
+	return processes, nil
+}
+
+func deviceComputeRunningProcesses(device C.nvmlDevice_t, uuid string) ([]gpuProcess, error) {
+	var count C.uint
+	ret := C.deviceGetComputeRunningProcesses(device, &count, nil, nil)
+	// Processes may be started between the calls, in which case the list
+	// needs to be fetched again.
+	for attempt := 0; ret == nvmlErrorInsufficientSize && attempt < maxProcessListAttempts; attempt++ {
+		count += extraProcessListCapacity
+		pids := make([]C.uint, count)
+		memoryUsed := make([]C.ulonglong, count)
+		ret = C.deviceGetComputeRunningProcesses(device, &count, &pids[0], &memoryUsed[0])
+		if ret != nvmlSuccess {
+			continue
+		}
+		processes := make([]gpuProcess, 0, count)
+		for i := C.uint(0); i < count; i++ {
+			process := gpuProcess{pid: int(pids[i])}
+			if uint64(memoryUsed[i]) != nvmlValueNotAvailable {
+				process.memoryUsed = uint64(memoryUsed[i])
+			}
+			processes = append(processes, process)
+		}
+		return processes, nil
+	}
+	if ret != nvmlSuccess {
+		return nil, fmt.Errorf("failed to get processes running on device %q: nvml error %d", uuid, ret)
+	}
+	// No process is running on the device.
+	return nil, nil
+}
@@ -26,8 +26,12 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/google/cadvisor/cmd/internal/admin"
+	"github.com/google/cadvisor/cmd/internal/debug"
 	cadvisorhttp "github.com/google/cadvisor/cmd/internal/http"
 	"github.com/google/cadvisor/container"
+	"github.com/google/cadvisor/container/libcontainer"
+	"github.com/google/cadvisor/container/subtree"
 	"github.com/google/cadvisor/manager"
 	"github.com/google/cadvisor/metrics"
 	"github.com/google/cadvisor/utils/sysfs"
@@ -59,6 +63,10 @@ var prometheusEndpoint = flag.String("prometheus_endpoint", "/metrics", "Endpoin
 
 var enableProfiling = flag.Bool("profiling", false, "Enable profiling via web interface host:port/debug/pprof/")
 
+var enableCgroupsDebug = flag.Bool("debug_cgroups", false, "Enable dumping the raw content of the cgroup files of containers via web interface host:port/debug/cgroups/<container>. The content of cgroup files may be sensitive.")
+
+var enableAdminMetrics = flag.Bool("admin_metrics", false, "Enable reading and updating the metrics collected at runtime via web interface host:port/admin/metrics. Requires --http_auth_file or --http_digest_file, whose users can then change what cAdvisor collects.")
+
 var collectorCert = flag.String("collector_cert", "", "Collector's certificate, exposed to endpoints for certificate based authentication.")
 var collectorKey = flag.String("collector_key", "", "Key for the collector's certificate")
 
@@ -73,6 +81,8 @@ var rawCgroupPrefixWhiteList = flag.String("raw_cgroup_prefix_whitelist", "", "A
 
 var perfEvents = flag.String("perf_events_config", "", "Path to a JSON file containing configuration of perf events to measure. Empty value disabled perf events measuring.")
 
+var lightweightCgroup = flag.String("lightweight_cgroup", "", "Cgroup whose subtree is exported on the Prometheus endpoint alone, without container discovery, runtime clients, storage or the web UI, e.g. /kubepods/pod1. Empty disables the lightweight mode.")
+
 var resctrlInterval = flag.Duration("resctrl_interval", 0, "Resctrl mon groups updating interval. Zero value disables updating mon groups.")
 
 var (
@@ -90,6 +100,8 @@ var (
 		container.CPUTopologyMetrics:             struct{}{},
 		container.ResctrlMetrics:                 struct{}{},
 		container.CPUSetMetrics:                  struct{}{},
+		container.DelayAccountingMetrics:         struct{}{},
+		container.KernelMemoryMetrics:            struct{}{},
 	}
 
 	// Metrics to be enabled.  Used only if non-empty.
@@ -124,6 +136,15 @@ func main() {
 	klog.V(1).Infof("enabled metrics: %s", includedMetrics.String())
 	setMaxProcs()
 
+	if err := libcontainer.ValidateFlags(); err != nil {
+		klog.Fatalf("Invalid flags: %v", err)
+	}
+
+	if *lightweightCgroup != "" {
+		runLightweight(includedMetrics)
+		return
+	}
+
 	memoryStorage, err := NewMemoryStorage()
 	if err != nil {
 		klog.Fatalf("Failed to initialize storage driver: %s", err)
@@ -147,6 +168,18 @@ func main() {
 		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 	}
 
+	if *enableCgroupsDebug {
+		if err := debug.RegisterCgroupsHandler(mux, resourceManager); err != nil {
+			klog.Fatalf("Failed to register cgroups debug handler: %v", err)
+		}
+	}
+
+	if *enableAdminMetrics {
+		if err := admin.RegisterMetricsHandler(mux, resourceManager, *httpAuthFile, *httpAuthRealm, *httpDigestFile, *httpDigestRealm); err != nil {
+			klog.Fatalf("Failed to register admin metrics handler: %v", err)
+		}
+	}
+
 	// Register all HTTP handlers.
 	err = cadvisorhttp.RegisterHandlers(mux, resourceManager, *httpAuthFile, *httpAuthRealm, *httpDigestFile, *httpDigestRealm, *urlBasePrefix)
 	if err != nil {
@@ -160,7 +193,9 @@ func main() {
 	}
 
 	// Register Prometheus collector to gather information about containers, Go runtime, processes, and machine
-	cadvisorhttp.RegisterPrometheusHandler(mux, resourceManager, *prometheusEndpoint, containerLabelFunc, includedMetrics)
+	if err := cadvisorhttp.RegisterPrometheusHandler(mux, resourceManager, *prometheusEndpoint, containerLabelFunc, includedMetrics); err != nil {
+		klog.Fatalf("Failed to register Prometheus handler: %v", err)
+	}
 
 	// Start the manager.
 	if err := resourceManager.Start(); err != nil {
@@ -179,6 +214,42 @@ func main() {
 	klog.Fatal(http.ListenAndServe(addr, rootMux))
 }
 
+// runLightweight serves the Prometheus metrics of the subtree of
+// --lightweight_cgroup, reading its cgroups directly instead of starting the
+// manager.
+func runLightweight(includedMetrics container.MetricSet) {
+	// The auth files only protect the web UI, which isn't served in this mode.
+	// Refuse to start rather than serving the metrics without the auth the
+	// deployment asked for.
+	if *httpAuthFile != "" || *httpDigestFile != "" {
+		klog.Fatalf("--http_auth_file and --http_digest_file are not supported with --lightweight_cgroup")
+	}
+
+	provider, err := subtree.NewInfoProvider(*lightweightCgroup, includedMetrics)
+	if err != nil {
+		klog.Fatalf("Failed to create the lightweight cgroup provider: %v", err)
+	}
+
+	containerLabelFunc := metrics.DefaultContainerLabels
+	if !*storeContainerLabels {
+		whitelistedLabels := strings.Split(*whitelistedContainerLabels, ",")
+		containerLabelFunc = metrics.BaseContainerLabels(whitelistedLabels)
+	}
+
+	mux := http.NewServeMux()
+	if err := cadvisorhttp.RegisterSubtreePrometheusHandler(mux, provider, *prometheusEndpoint, containerLabelFunc, includedMetrics); err != nil {
+		klog.Fatalf("Failed to register Prometheus handler: %v", err)
+	}
+
+	klog.V(1).Infof("Starting cAdvisor version: %s-%s on port %d exporting cgroup %q", version.Info["version"], version.Info["revision"], *argPort, *lightweightCgroup)
+
+	rootMux := http.NewServeMux()
+	rootMux.Handle(*urlBasePrefix+"/", http.StripPrefix(*urlBasePrefix, mux))
+
+	addr := fmt.Sprintf("%s:%d", *argIp, *argPort)
+	klog.Fatal(http.ListenAndServe(addr, rootMux))
+}
+
 func setMaxProcs() {
 	// TODO(vmarmol): Consider limiting if we have a CPU mask in effect.
 	// Allow as many threads as we have cores unless the user specified a value.
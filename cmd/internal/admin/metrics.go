@@ -0,0 +1,123 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Handler for /admin/metrics.
+// Reads and updates the metrics collected by the manager at runtime.
+
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	httpmux "github.com/google/cadvisor/cmd/internal/http/mux"
+	"github.com/google/cadvisor/container"
+
+	auth "github.com/abbot/go-http-auth"
+	"k8s.io/klog/v2"
+)
+
+const MetricsPage = "/admin/metrics"
+
+// metricsUpdater will usually be manager.Manager, but can be swapped out for
+// testing.
+type metricsUpdater interface {
+	// IncludedMetrics returns the metrics currently collected.
+	IncludedMetrics() container.MetricSet
+	// UpdateIncludedMetrics replaces the metrics collected.
+	UpdateIncludedMetrics(includedMetrics container.MetricSet) error
+}
+
+// Metrics is the set of metrics collected, as read and written by the handler.
+type Metrics struct {
+	// Kinds of the metrics, e.g. cpu, memory or hugetlb, as given to
+	// --enable_metrics.
+	Metrics []string `json:"metrics"`
+}
+
+// RegisterMetricsHandler registers the handler returning the metrics collected
+// on GET, and replacing them on PUT without restarting cAdvisor. As it changes
+// what cAdvisor collects, this handler must only be registered when explicitly
+// enabled, and it requires the same authentication as the web UI: the basic
+// auth of the htpasswd file httpAuthFile, or else the digest auth of the
+// htdigest file httpDigestFile. An error is returned if neither is set.
+func RegisterMetricsHandler(mux httpmux.Mux, m metricsUpdater, httpAuthFile, httpAuthRealm, httpDigestFile, httpDigestRealm string) error {
+	var authenticator auth.AuthenticatorInterface
+	switch {
+	case httpAuthFile != "":
+		authenticator = auth.NewBasicAuthenticator(httpAuthRealm, auth.HtpasswdFileProvider(httpAuthFile))
+	case httpDigestFile != "":
+		authenticator = auth.NewDigestAuthenticator(httpDigestRealm, auth.HtdigestFileProvider(httpDigestFile))
+	default:
+		return fmt.Errorf("%s requires authentication, set --http_auth_file or --http_digest_file", MetricsPage)
+	}
+	mux.Handle(MetricsPage, auth.JustCheck(authenticator, metricsHandler(m).ServeHTTP))
+	return nil
+}
+
+func metricsHandler(m metricsUpdater) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var request Metrics
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, fmt.Sprintf("invalid metrics: %v", err), http.StatusBadRequest)
+				return
+			}
+			includedMetrics, err := parseMetrics(request.Metrics)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := m.UpdateIncludedMetrics(includedMetrics); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, fmt.Sprintf("unsupported method %q", r.Method), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(toMetrics(m.IncludedMetrics())); err != nil {
+			klog.Errorf("Failed to write the included metrics: %v", err)
+		}
+	})
+}
+
+// parseMetrics returns the set of the given kinds of metrics.
+func parseMetrics(kinds []string) (container.MetricSet, error) {
+	includedMetrics := container.MetricSet{}
+	for _, kind := range kinds {
+		if !container.AllMetrics.Has(container.MetricKind(kind)) {
+			return nil, fmt.Errorf("unsupported metric %q", kind)
+		}
+		includedMetrics[container.MetricKind(kind)] = struct{}{}
+	}
+	return includedMetrics, nil
+}
+
+// toMetrics returns the sorted kinds of the set of metrics.
+func toMetrics(includedMetrics container.MetricSet) Metrics {
+	kinds := make([]string, 0, len(includedMetrics))
+	for kind := range includedMetrics {
+		kinds = append(kinds, string(kind))
+	}
+	sort.Strings(kinds)
+	return Metrics{Metrics: kinds}
+}
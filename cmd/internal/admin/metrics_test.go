@@ -0,0 +1,136 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/cadvisor/container"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMetricsUpdater struct {
+	includedMetrics container.MetricSet
+}
+
+func (u *fakeMetricsUpdater) IncludedMetrics() container.MetricSet {
+	return u.includedMetrics.Clone()
+}
+
+func (u *fakeMetricsUpdater) UpdateIncludedMetrics(includedMetrics container.MetricSet) error {
+	if includedMetrics.Has(container.PerfMetrics) {
+		return fmt.Errorf("metrics perf_event cannot be enabled or disabled without a restart")
+	}
+	// Like the manager, update the set shared with the container handlers.
+	u.includedMetrics.Update(includedMetrics)
+	return nil
+}
+
+func serve(t *testing.T, handler http.Handler, method, body string) (int, string) {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(method, MetricsPage, strings.NewReader(body)))
+	return w.Code, w.Body.String()
+}
+
+func TestMetricsHandler(t *testing.T) {
+	updater := &fakeMetricsUpdater{includedMetrics: container.MetricSet{
+		container.MemoryUsageMetrics: struct{}{},
+		container.CpuUsageMetrics:    struct{}{},
+	}}
+	handler := metricsHandler(updater)
+
+	code, body := serve(t, handler, http.MethodGet, "")
+	require.Equal(t, http.StatusOK, code)
+	var metrics Metrics
+	require.NoError(t, json.Unmarshal([]byte(body), &metrics))
+	assert.Equal(t, []string{"cpu", "memory"}, metrics.Metrics)
+
+	code, body = serve(t, handler, http.MethodPut, `{"metrics": ["cpu", "memory", "hugetlb"]}`)
+	require.Equal(t, http.StatusOK, code, body)
+	require.NoError(t, json.Unmarshal([]byte(body), &metrics))
+	assert.Equal(t, []string{"cpu", "hugetlb", "memory"}, metrics.Metrics)
+	assert.True(t, updater.includedMetrics.Has(container.HugetlbUsageMetrics))
+}
+
+func TestMetricsHandlerErrors(t *testing.T) {
+	updater := &fakeMetricsUpdater{includedMetrics: container.MetricSet{container.CpuUsageMetrics: struct{}{}}}
+	handler := metricsHandler(updater)
+
+	for _, tc := range []struct {
+		method   string
+		body     string
+		expected int
+	}{
+		{http.MethodPut, `{"metrics": ["cpu", "gpu"]}`, http.StatusBadRequest},
+		{http.MethodPut, `["cpu"]`, http.StatusBadRequest},
+		{http.MethodPut, `{"metrics": ["cpu", "perf_event"]}`, http.StatusBadRequest},
+		{http.MethodDelete, "", http.StatusMethodNotAllowed},
+	} {
+		code, body := serve(t, handler, tc.method, tc.body)
+		assert.Equal(t, tc.expected, code, "%s %s: %s", tc.method, tc.body, body)
+	}
+	assert.Equal(t, container.MetricSet{container.CpuUsageMetrics: struct{}{}}, updater.includedMetrics)
+}
+
+func TestRegisterMetricsHandler(t *testing.T) {
+	shared := container.MetricSet{container.CpuUsageMetrics: struct{}{}}
+	updater := &fakeMetricsUpdater{includedMetrics: shared}
+
+	// The handler is not served without authentication.
+	assert.Error(t, RegisterMetricsHandler(http.NewServeMux(), updater, "", "", "", ""))
+
+	dir, err := ioutil.TempDir("", "admin")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	authFile := filepath.Join(dir, "htpasswd")
+	digest := sha1.Sum([]byte("secret"))
+	require.NoError(t, ioutil.WriteFile(authFile, []byte("admin:{SHA}"+base64.StdEncoding.EncodeToString(digest[:])+"\n"), 0600))
+
+	mux := http.NewServeMux()
+	require.NoError(t, RegisterMetricsHandler(mux, updater, authFile, "cadvisor", "", ""))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	put := func(user, password string) int {
+		request, err := http.NewRequest(http.MethodPut, server.URL+MetricsPage, strings.NewReader(`{"metrics": ["cpu", "hugetlb"]}`))
+		require.NoError(t, err)
+		if user != "" {
+			request.SetBasicAuth(user, password)
+		}
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, put("", ""))
+	assert.Equal(t, http.StatusUnauthorized, put("admin", "wrong"))
+	assert.False(t, shared.Has(container.HugetlbUsageMetrics))
+
+	assert.Equal(t, http.StatusOK, put("admin", "secret"))
+	assert.True(t, shared.Has(container.HugetlbUsageMetrics))
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	v2 "github.com/google/cadvisor/info/v2"
+	"github.com/google/cadvisor/manager"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Maximum size of the body of a bulk stats request.
+	maxBulkStatsRequestBytes = 64 << 10
+	// Maximum number of containers of a bulk stats request.
+	maxBulkStatsIds = 256
+)
+
+// Status of the stats of a container in a bulk stats response.
+const (
+	bulkStatsOk       = "ok"
+	bulkStatsNotFound = "not_found"
+	bulkStatsError    = "error"
+)
+
+// bulkStatsResult holds the stats of one of the containers of a bulk stats
+// request.
+type bulkStatsResult struct {
+	// Identifier of the container, as requested.
+	ID string `json:"id"`
+	// One of ok, not_found or error.
+	Status string `json:"status"`
+	// Reason of the error, if any.
+	Error string `json:"error,omitempty"`
+	// Spec and stats of the container by name, as returned by the stats API.
+	Containers map[string]v2.ContainerInfo `json:"containers,omitempty"`
+}
+
+// handleBulkStatsRequest returns the stats of the containers whose identifiers
+// are posted as a JSON list, in the order of the list.
+func handleBulkStatsRequest(opt v2.RequestOptions, m manager.Manager, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "bulk stats must be requested with POST", http.StatusMethodNotAllowed)
+		return nil
+	}
+	var ids []string
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBulkStatsRequestBytes)).Decode(&ids); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode the list of containers: %v", err), http.StatusBadRequest)
+		return nil
+	}
+	if len(ids) > maxBulkStatsIds {
+		http.Error(w, fmt.Sprintf("too many containers requested: %d, the maximum is %d", len(ids), maxBulkStatsIds), http.StatusRequestEntityTooLarge)
+		return nil
+	}
+	klog.V(4).Infof("Api - BulkStats: Looking for stats for %d containers, options %+v", len(ids), opt)
+
+	results := make([]bulkStatsResult, 0, len(ids))
+	for _, id := range ids {
+		result := bulkStatsResult{ID: id, Status: bulkStatsOk}
+		conts, err := m.GetRequestedContainersInfo(id, opt)
+		switch {
+		case err != nil && len(conts) == 0 && opt.IdType == v2.TypeName && !m.Exists(id):
+			result.Status = bulkStatsNotFound
+		case err != nil && len(conts) == 0:
+			result.Status = bulkStatsError
+			result.Error = err.Error()
+		default:
+			if err != nil {
+				klog.Errorf("Error calling GetRequestedContainersInfo: %v", err)
+			}
+			result.Containers = containerStatsFromV1(conts)
+		}
+		results = append(results, result)
+	}
+	return writeResult(results, w, r)
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	v2 "github.com/google/cadvisor/info/v2"
+	"github.com/google/cadvisor/manager"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStatsManager serves the info of a fixed set of containers.
+type fakeStatsManager struct {
+	manager.Manager
+	containers map[string]*info.ContainerInfo
+}
+
+func (m fakeStatsManager) GetRequestedContainersInfo(containerName string, options v2.RequestOptions) (map[string]*info.ContainerInfo, error) {
+	cont, ok := m.containers[containerName]
+	if !ok {
+		return map[string]*info.ContainerInfo{}, fmt.Errorf("unknown container %q", containerName)
+	}
+	return map[string]*info.ContainerInfo{containerName: cont}, nil
+}
+
+func (m fakeStatsManager) Exists(containerName string) bool {
+	_, ok := m.containers[containerName]
+	return ok
+}
+
+func testContainerInfo(name string, cpuUsage uint64) *info.ContainerInfo {
+	return &info.ContainerInfo{
+		ContainerReference: info.ContainerReference{Name: name},
+		Spec:               info.ContainerSpec{HasCpu: true},
+		Stats: []*info.ContainerStats{{
+			Timestamp: time.Unix(1600000000, 0),
+			Cpu:       info.CpuStats{Usage: info.CpuUsage{Total: cpuUsage}},
+		}},
+	}
+}
+
+func postBulkStats(t *testing.T, m manager.Manager, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/v2.1/bulkstats", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	require.NoError(t, newVersion2_1(newVersion2_0()).HandleRequest(bulkStatsApi, nil, m, w, r))
+	return w
+}
+
+func TestBulkStats(t *testing.T) {
+	m := fakeStatsManager{containers: map[string]*info.ContainerInfo{
+		"/docker/a": testContainerInfo("/docker/a", 100),
+		"/docker/b": testContainerInfo("/docker/b", 200),
+	}}
+
+	w := postBulkStats(t, m, `["/docker/b", "/docker/unknown", "/docker/a"]`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var results []bulkStatsResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+
+	require.Len(t, results, 3)
+	assert.Equal(t, "/docker/b", results[0].ID)
+	assert.Equal(t, bulkStatsOk, results[0].Status)
+	require.Len(t, results[0].Containers["/docker/b"].Stats, 1)
+	assert.EqualValues(t, 200, results[0].Containers["/docker/b"].Stats[0].Cpu.Usage.Total)
+
+	assert.Equal(t, "/docker/unknown", results[1].ID)
+	assert.Equal(t, bulkStatsNotFound, results[1].Status)
+	assert.Empty(t, results[1].Containers)
+
+	assert.Equal(t, "/docker/a", results[2].ID)
+	assert.Equal(t, bulkStatsOk, results[2].Status)
+	require.Len(t, results[2].Containers["/docker/a"].Stats, 1)
+	assert.EqualValues(t, 100, results[2].Containers["/docker/a"].Stats[0].Cpu.Usage.Total)
+}
+
+func TestBulkStatsBadRequests(t *testing.T) {
+	m := fakeStatsManager{}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v2.1/bulkstats", nil)
+	w := httptest.NewRecorder()
+	require.NoError(t, newVersion2_1(newVersion2_0()).HandleRequest(bulkStatsApi, nil, m, w, r))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	assert.Equal(t, http.StatusBadRequest, postBulkStats(t, m, `{"id": "/docker/a"}`).Code)
+
+	ids := make([]string, maxBulkStatsIds+1)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("/docker/%d", i)
+	}
+	body, err := json.Marshal(ids)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, postBulkStats(t, m, string(body)).Code)
+
+	// The body is bounded whatever the number of containers.
+	body, err = json.Marshal([]string{strings.Repeat("a", maxBulkStatsRequestBytes)})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, postBulkStats(t, m, string(body)).Code)
+}
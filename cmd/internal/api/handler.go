@@ -16,12 +16,14 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"path"
+	"reflect"
 	"regexp"
 	"sort"
 	"strconv"
@@ -32,6 +34,7 @@ import (
 	"github.com/google/cadvisor/events"
 	info "github.com/google/cadvisor/info/v1"
 	"github.com/google/cadvisor/manager"
+	"github.com/google/cadvisor/utils/msgpack"
 
 	"k8s.io/klog/v2"
 )
@@ -41,6 +44,16 @@ const (
 )
 
 func RegisterHandlers(mux httpmux.Mux, m manager.Manager) error {
+	var err error
+	responseRedactor, err = newRedactor(*redactedEnvKeys, *redactedLabels)
+	if err != nil {
+		return err
+	}
+	responseRounder, err = newRounder(*fieldRounding)
+	if err != nil {
+		return err
+	}
+
 	apiVersions := getApiVersions()
 	supportedApiVersions := make(map[string]ApiVersion, len(apiVersions))
 	for _, v := range apiVersions {
@@ -122,7 +135,15 @@ func handleRequest(supportedApiVersions map[string]ApiVersion, m manager.Manager
 
 }
 
-func writeResult(res interface{}, w http.ResponseWriter) error {
+func writeResult(res interface{}, w http.ResponseWriter, r *http.Request) error {
+	if acceptsMsgpack(r) {
+		return writeMsgpackResult(res, w)
+	}
+
+	res, err := transformResult(res)
+	if err != nil {
+		return err
+	}
 	out, err := json.Marshal(res)
 	if err != nil {
 		return fmt.Errorf("failed to marshall response %+v with error: %s", res, err)
@@ -134,7 +155,100 @@ func writeResult(res interface{}, w http.ResponseWriter) error {
 
 }
 
-func streamResults(eventChannel *events.EventChannel, w http.ResponseWriter, r *http.Request, m manager.Manager) error {
+// transformResult returns res with the redaction and rounding configured for
+// API responses applied, or res itself if there are none.
+func transformResult(res interface{}) (interface{}, error) {
+	if responseRedactor == nil && responseRounder == nil {
+		return res, nil
+	}
+	generic, err := toGenericJSON(res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform response %+v with error: %s", res, err)
+	}
+	if responseRedactor != nil {
+		responseRedactor.redact(generic)
+	}
+	if responseRounder != nil {
+		responseRounder.round(generic)
+	}
+	return generic, nil
+}
+
+// toGenericJSON returns the generic JSON form of res. Responses are redacted
+// and rounded generically on their JSON form so that all API versions and
+// response types are covered.
+func toGenericJSON(res interface{}) (interface{}, error) {
+	out, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	decoder := json.NewDecoder(bytes.NewReader(out))
+	// Keep numbers as they are, uint64 values do not fit into a float64.
+	decoder.UseNumber()
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// acceptsMsgpack returns whether the client asked for the MessagePack
+// encoding in the Accept header of its request.
+func acceptsMsgpack(r *http.Request) bool {
+	for _, accept := range r.Header["Accept"] {
+		for _, mediaType := range strings.Split(accept, ",") {
+			if i := strings.Index(mediaType, ";"); i >= 0 {
+				mediaType = mediaType[:i]
+			}
+			switch strings.TrimSpace(mediaType) {
+			case msgpack.ContentType, "application/x-msgpack":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeMsgpackResult writes the MessagePack encoding of res, which has the
+// same structure as its JSON encoding.
+func writeMsgpackResult(res interface{}, w http.ResponseWriter) error {
+	res, err := typedTransformResult(res)
+	if err != nil {
+		return err
+	}
+	out, err := msgpack.Marshal(res)
+	if err != nil {
+		return fmt.Errorf("failed to marshall response %+v with error: %s", res, err)
+	}
+
+	w.Header().Set("Content-Type", msgpack.ContentType)
+	w.Write(out)
+	return nil
+}
+
+// typedTransformResult is transformResult, but decodes the transformed
+// generic JSON form back into the type of res so that its times are still
+// encoded as times rather than as strings.
+func typedTransformResult(res interface{}) (interface{}, error) {
+	if res == nil || (responseRedactor == nil && responseRounder == nil) {
+		return res, nil
+	}
+	generic, err := transformResult(res)
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.Marshal(generic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform response %+v with error: %s", res, err)
+	}
+	typed := reflect.New(reflect.TypeOf(res))
+	if err := json.Unmarshal(out, typed.Interface()); err != nil {
+		return nil, fmt.Errorf("failed to transform response %+v with error: %s", res, err)
+	}
+	return typed.Elem().Interface(), nil
+}
+
+func streamResults(eventChannel *events.EventChannel, pastEvents []*info.Event, w http.ResponseWriter, r *http.Request, m manager.Manager) error {
 	cn, ok := w.(http.CloseNotifier)
 	if !ok {
 		return errors.New("could not access http.CloseNotifier")
@@ -149,12 +263,25 @@ func streamResults(eventChannel *events.EventChannel, w http.ResponseWriter, r *
 	flusher.Flush()
 
 	enc := json.NewEncoder(w)
+	// Replay the events the consumer missed before streaming new ones. Events
+	// added while replaying may be received from both, skip the duplicates.
+	replayed := replayedEvents(pastEvents)
+	for _, ev := range pastEvents {
+		err := enc.Encode(ev)
+		if err != nil {
+			klog.Errorf("error encoding message %+v for result stream: %v", ev, err)
+		}
+	}
+	flusher.Flush()
 	for {
 		select {
 		case <-cn.CloseNotify():
 			m.CloseEventChannel(eventChannel.GetWatchId())
 			return nil
 		case ev := <-eventChannel.GetChannel():
+			if replayed[ev.Sequence] {
+				continue
+			}
 			err := enc.Encode(ev)
 			if err != nil {
 				klog.Errorf("error encoding message %+v for result stream: %v", ev, err)
@@ -164,6 +291,16 @@ func streamResults(eventChannel *events.EventChannel, w http.ResponseWriter, r *
 	}
 }
 
+// replayedEvents returns the sequence numbers of the replayed events, which
+// identify them unlike their timestamps.
+func replayedEvents(pastEvents []*info.Event) map[uint64]bool {
+	replayed := make(map[uint64]bool, len(pastEvents))
+	for _, ev := range pastEvents {
+		replayed[ev.Sequence] = true
+	}
+	return replayed
+}
+
 func getContainerInfoRequest(body io.ReadCloser) (*info.ContainerInfoRequest, error) {
 	query := info.DefaultContainerInfoRequest()
 	decoder := json.NewDecoder(body)
@@ -179,8 +316,10 @@ func getContainerInfoRequest(body io.ReadCloser) (*info.ContainerInfoRequest, er
 // with any twice defined arguments being assigned the first value.
 // If the value type for the argument is wrong the field will be assumed to be
 // unassigned
-// bools: stream, subcontainers, oom_events, creation_events, deletion_events
+// bools: stream, subcontainers, oom_events, creation_events, deletion_events,
+// counter_reset_events
 // ints: max_events, start_time (unix timestamp), end_time (unix timestamp)
+// timestamps: since (RFC 3339, only events strictly after it are returned)
 // example r.URL: http://localhost:8080/api/v1.3/events?oom_events=true&stream=true
 func getEventRequest(r *http.Request) (*events.Request, bool, error) {
 	query := events.NewRequest()
@@ -201,10 +340,12 @@ func getEventRequest(r *http.Request) (*events.Request, bool, error) {
 		}
 	}
 	eventTypes := map[string]info.EventType{
-		"oom_events":      info.EventOom,
-		"oom_kill_events": info.EventOomKill,
-		"creation_events": info.EventContainerCreation,
-		"deletion_events": info.EventContainerDeletion,
+		"oom_events":           info.EventOom,
+		"oom_kill_events":      info.EventOomKill,
+		"creation_events":      info.EventContainerCreation,
+		"deletion_events":      info.EventContainerDeletion,
+		"counter_reset_events": info.EventCounterReset,
+		"cpuset_change_events": info.EventCpusetChange,
 	}
 	allEventTypes := false
 	if val, ok := urlMap["all_events"]; ok {
@@ -241,6 +382,12 @@ func getEventRequest(r *http.Request) (*events.Request, bool, error) {
 			query.EndTime = newTime
 		}
 	}
+	if val, ok := urlMap["since"]; ok {
+		newTime, err := time.Parse(time.RFC3339Nano, val[0])
+		if err == nil {
+			query.Since = newTime
+		}
+	}
 
 	return query, stream, nil
 }
@@ -0,0 +1,98 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/utils/msgpack"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteResultMsgpack(t *testing.T) {
+	stats := []*info.ContainerStats{{
+		Timestamp: time.Unix(1618309500, 0).UTC(),
+		Cpu:       info.CpuStats{Usage: info.CpuUsage{Total: 3000, PerCpu: []uint64{1000, 2000}}},
+		Memory:    info.MemoryStats{Usage: 4096},
+	}}
+
+	// JSON remains the default.
+	w := httptest.NewRecorder()
+	require.NoError(t, writeResult(stats, w, httptest.NewRequest("GET", "/api/v1.3/containers/", nil)))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var jsonResult []*info.ContainerStats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &jsonResult))
+	assert.Equal(t, stats, jsonResult)
+
+	for _, accept := range []string{"application/msgpack", "application/json;q=0.5, application/x-msgpack"} {
+		r := httptest.NewRequest("GET", "/api/v1.3/containers/", nil)
+		r.Header.Set("Accept", accept)
+		w = httptest.NewRecorder()
+		require.NoError(t, writeResult(stats, w, r))
+		assert.Equal(t, msgpack.ContentType, w.Header().Get("Content-Type"), accept)
+		var result []*info.ContainerStats
+		require.NoError(t, msgpack.Unmarshal(w.Body.Bytes(), &result), accept)
+		require.Len(t, result, 1, accept)
+		// Times are decoded in the local time zone.
+		result[0].Timestamp = result[0].Timestamp.UTC()
+		assert.Equal(t, stats, result, accept)
+	}
+}
+
+func TestWriteResultMsgpackRedacted(t *testing.T) {
+	r, err := newRedactor("(?i)password", "")
+	require.NoError(t, err)
+	responseRedactor = r
+	defer func() { responseRedactor = nil }()
+
+	spec := info.ContainerSpec{
+		CreationTime: time.Unix(1618309500, 0).UTC(),
+		Envs:         map[string]string{"DB_PASSWORD": "hunter2", "LANG": "C"},
+	}
+	req := httptest.NewRequest("GET", "/api/v1.3/containers/", nil)
+	req.Header.Set("Accept", "application/msgpack")
+	w := httptest.NewRecorder()
+	require.NoError(t, writeResult(spec, w, req))
+
+	var result info.ContainerSpec
+	require.NoError(t, msgpack.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, map[string]string{"LANG": "C"}, result.Envs)
+	assert.True(t, spec.CreationTime.Equal(result.CreationTime))
+	assert.NotContains(t, w.Body.String(), "hunter2")
+
+	// Times keep the timestamp extension type rather than becoming strings.
+	var generic map[string]interface{}
+	require.NoError(t, msgpack.Unmarshal(w.Body.Bytes(), &generic))
+	assert.IsType(t, time.Time{}, generic["creation_time"])
+}
+
+func TestReplayedEvents(t *testing.T) {
+	timestamp := time.Unix(1618309500, 0)
+	past := []*info.Event{
+		{ContainerName: "/a", Timestamp: timestamp, EventType: info.EventOom, Sequence: 1},
+		{ContainerName: "/b", Timestamp: timestamp, EventType: info.EventOom, Sequence: 2},
+	}
+	replayed := replayedEvents(past)
+	assert.True(t, replayed[1])
+	assert.True(t, replayed[2])
+	// A new event at the same time isn't mistaken for a replayed one.
+	assert.False(t, replayed[3])
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	redactedEnvKeys = flag.String("api_redacted_env_keys", "", "comma-separated list of regular expressions. Container environment variables with a matching key are removed from API responses, even if collected because of env_metadata_whitelist.")
+	redactedLabels  = flag.String("api_redacted_labels", "", "comma-separated list of container label keys which are removed from API responses.")
+)
+
+// redactor removes container environment variables and labels from API
+// responses. It is applied to the response after all data was collected, so
+// it takes precedence over the allow lists used during collection.
+type redactor struct {
+	envKeys []*regexp.Regexp
+	labels  map[string]struct{}
+}
+
+// responseRedactor is applied to all API responses, nil if nothing is redacted.
+var responseRedactor *redactor
+
+func newRedactor(envKeys, labels string) (*redactor, error) {
+	r := &redactor{labels: map[string]struct{}{}}
+	for _, key := range strings.Split(envKeys, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		re, err := regexp.Compile(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redacted env key %q: %v", key, err)
+		}
+		r.envKeys = append(r.envKeys, re)
+	}
+	for _, label := range strings.Split(labels, ",") {
+		label = strings.TrimSpace(label)
+		if label != "" {
+			r.labels[label] = struct{}{}
+		}
+	}
+	if len(r.envKeys) == 0 && len(r.labels) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+func (r *redactor) redact(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			switch key {
+			case "envs":
+				if envs, ok := field.(map[string]interface{}); ok {
+					r.redactEnvs(envs)
+					continue
+				}
+			case "labels":
+				if labels, ok := field.(map[string]interface{}); ok {
+					r.redactLabels(labels)
+					continue
+				}
+			}
+			r.redact(field)
+		}
+	case []interface{}:
+		for _, item := range v {
+			r.redact(item)
+		}
+	}
+}
+
+func (r *redactor) redactEnvs(envs map[string]interface{}) {
+	for key := range envs {
+		for _, re := range r.envKeys {
+			if re.MatchString(key) {
+				delete(envs, key)
+				break
+			}
+		}
+	}
+}
+
+func (r *redactor) redactLabels(labels map[string]interface{}) {
+	for key := range labels {
+		if _, ok := r.labels[key]; ok {
+			delete(labels, key)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"testing"
+
+	v2 "github.com/google/cadvisor/info/v2"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteResultRedactsEnvsAndLabels(t *testing.T) {
+	r, err := newRedactor("(?i)(secret|password|token)", "owner")
+	require.Nil(t, err)
+	responseRedactor = r
+	defer func() { responseRedactor = nil }()
+
+	spec := v2.ContainerSpec{
+		Envs: map[string]string{
+			"DB_PASSWORD": "hunter2",
+			"LANG":        "C",
+		},
+		Labels: map[string]string{
+			"owner": "alice@example.com",
+			"app":   "web",
+		},
+		Memory: v2.MemorySpec{Limit: math.MaxUint64},
+	}
+	w := httptest.NewRecorder()
+	require.Nil(t, writeResult(map[string]v2.ContainerSpec{"/docker/abc": spec}, w, httptest.NewRequest("GET", "/api/v2.0/spec", nil)))
+
+	var result map[string]v2.ContainerSpec
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, map[string]string{"LANG": "C"}, result["/docker/abc"].Envs)
+	assert.Equal(t, map[string]string{"app": "web"}, result["/docker/abc"].Labels)
+	assert.Equal(t, uint64(math.MaxUint64), result["/docker/abc"].Memory.Limit)
+	assert.NotContains(t, w.Body.String(), "hunter2")
+
+	// The collected data is left untouched.
+	assert.Len(t, spec.Envs, 2)
+}
+
+func TestNewRedactor(t *testing.T) {
+	r, err := newRedactor("", "")
+	assert.Nil(t, err)
+	assert.Nil(t, r)
+
+	_, err = newRedactor("(", "")
+	assert.NotNil(t, err)
+
+	r, err = newRedactor("", "owner, team")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{"owner": {}, "team": {}}, r.labels)
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	info "github.com/google/cadvisor/info/v1"
+	v2 "github.com/google/cadvisor/info/v2"
+)
+
+var fieldRounding = flag.String("api_field_rounding", "", "comma-separated list of <field>[*<factor>]=<decimals> rules. The floating point fields of API responses with a matching JSON name are multiplied by the factor and rounded to the number of decimals, e.g. limit_utilization*100=1 reports the cpu limit utilization as a percentage with one decimal. Empty emits raw values.")
+
+// rounding scales and rounds the values of a field of API responses.
+type rounding struct {
+	factor   float64
+	decimals int
+}
+
+// rounder rounds numeric fields of API responses. Like the redactor, it is
+// applied to the JSON form of responses, so fields are matched by their JSON
+// name at any depth.
+type rounder struct {
+	fields map[string]rounding
+}
+
+// responseRounder is applied to all API responses, nil if nothing is rounded.
+var responseRounder *rounder
+
+// Types of the API responses whose fields can be rounded.
+var roundedResponses = []interface{}{
+	info.ContainerInfo{},
+	info.MachineInfo{},
+	info.Event{},
+	v2.ContainerInfo{},
+	v2.DerivedStats{},
+	v2.FsInfo{},
+	v2.PodStats{},
+	v2.ProcessInfo{},
+	v2.MachineStats{},
+	v2.NodeDiskStats{},
+	v2.NodeDiskLatency{},
+}
+
+// numericFields returns whether the fields of the API responses with each JSON
+// name are floating point numbers. A name used by an integer field anywhere is
+// not a float field: rounding would turn its values into floats, losing the
+// precision of large counters and breaking typed encodings.
+func numericFields() map[string]bool {
+	fields := map[string]bool{}
+	visited := map[reflect.Type]bool{}
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || visited[t] {
+			return
+		}
+		visited[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			switch field.Type.Kind() {
+			case reflect.Float32, reflect.Float64:
+				if _, ok := fields[name]; !ok {
+					fields[name] = true
+				}
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				fields[name] = false
+			default:
+				walk(field.Type)
+			}
+		}
+	}
+	for _, response := range roundedResponses {
+		walk(reflect.TypeOf(response))
+	}
+	return fields
+}
+
+func newRounder(rules string) (*rounder, error) {
+	r := &rounder{fields: map[string]rounding{}}
+	for _, rule := range strings.Split(rules, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid field rounding %q: expected <field>[*<factor>]=<decimals>", rule)
+		}
+		decimals, err := strconv.Atoi(parts[1])
+		if err != nil || decimals < 0 {
+			return nil, fmt.Errorf("invalid decimals in field rounding %q", rule)
+		}
+		field, factor := parts[0], 1.0
+		if i := strings.Index(field, "*"); i >= 0 {
+			factor, err = strconv.ParseFloat(field[i+1:], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid factor in field rounding %q: %v", rule, err)
+			}
+			field = field[:i]
+		}
+		if field == "" {
+			return nil, fmt.Errorf("missing field in field rounding %q", rule)
+		}
+		if float, ok := numericFields()[field]; !ok {
+			return nil, fmt.Errorf("unknown field in field rounding %q", rule)
+		} else if !float {
+			return nil, fmt.Errorf("field rounding %q targets integer fields, only floating point fields can be rounded", rule)
+		}
+		r.fields[field] = rounding{factor: factor, decimals: decimals}
+	}
+	if len(r.fields) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+func (r *rounder) round(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if number, ok := field.(json.Number); ok {
+				if rounding, ok := r.fields[key]; ok {
+					v[key] = rounding.apply(number)
+				}
+				continue
+			}
+			r.round(field)
+		}
+	case []interface{}:
+		for _, item := range v {
+			r.round(item)
+		}
+	}
+}
+
+// apply returns the scaled and rounded number, or the number itself if it
+// can't be parsed.
+func (f rounding) apply(number json.Number) json.Number {
+	value, err := number.Float64()
+	if err != nil {
+		return number
+	}
+	scale := math.Pow10(f.decimals)
+	value = math.Round(value*f.factor*scale) / scale
+	return json.Number(strconv.FormatFloat(value, 'f', -1, 64))
+}
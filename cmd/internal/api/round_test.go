@@ -0,0 +1,76 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteResultRoundsFields(t *testing.T) {
+	r, err := newRounder("limit_utilization*100=1, throttled_fraction=2")
+	require.Nil(t, err)
+	responseRounder = r
+	defer func() { responseRounder = nil }()
+
+	stats := &info.ContainerStats{Timestamp: time.Unix(1500000000, 0).UTC()}
+	stats.Cpu.LimitUtilization = 0.123456
+	stats.Cpu.CFS.ThrottledFraction = 0.0049
+	stats.Cpu.Usage.Total = 123456789
+	w := httptest.NewRecorder()
+	require.Nil(t, writeResult([]*info.ContainerStats{stats}, w, httptest.NewRequest("GET", "/api/v1.3/containers", nil)))
+
+	var result []info.ContainerStats
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &result))
+	require.Len(t, result, 1)
+	assert.Equal(t, 12.3, result[0].Cpu.LimitUtilization)
+	assert.Contains(t, w.Body.String(), `"limit_utilization":12.3`)
+	assert.Contains(t, w.Body.String(), `"throttled_fraction":0`)
+	// The other fields keep their raw values.
+	assert.Contains(t, w.Body.String(), `"total":123456789`)
+
+	// The collected data is left untouched.
+	assert.Equal(t, 0.123456, stats.Cpu.LimitUtilization)
+}
+
+func TestNewRounder(t *testing.T) {
+	r, err := newRounder("")
+	assert.Nil(t, err)
+	assert.Nil(t, r)
+
+	r, err = newRounder("avg_queue_size=0,limit_utilization*100=2")
+	require.Nil(t, err)
+	assert.Equal(t, map[string]rounding{
+		"avg_queue_size":    {factor: 1, decimals: 0},
+		"limit_utilization": {factor: 100, decimals: 2},
+	}, r.fields)
+
+	for _, rules := range []string{
+		"avg_queue_size", "avg_queue_size=-1", "avg_queue_size=x", "avg_queue_size*x=1", "*100=1",
+		// Integer fields, e.g. the cumulative cpu usage, can't be rounded.
+		"total=0", "load_average=0",
+		"no_such_field=1",
+	} {
+		_, err := newRounder(rules)
+		assert.Error(t, err, rules)
+	}
+}
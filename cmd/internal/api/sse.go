@@ -0,0 +1,170 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/cadvisor/events"
+	info "github.com/google/cadvisor/info/v1"
+
+	"k8s.io/klog/v2"
+)
+
+const eventStreamContentType = "text/event-stream"
+
+var (
+	// Interval at which a comment is sent to idle event streams so that
+	// proxies don't time the connection out.
+	sseHeartbeatInterval = 15 * time.Second
+	// Number of events buffered for a client of an event stream. A client
+	// falling further behind is dropped so that it doesn't block the
+	// delivery of events to the other watchers.
+	sseMaxPendingEvents = 100
+)
+
+// eventChannelCloser stops a watch for events, implemented by manager.Manager.
+type eventChannelCloser interface {
+	CloseEventChannel(watchID int)
+}
+
+// acceptsEventStream returns whether the client asked for server-sent events
+// in the Accept header of its request, as browsers' EventSource does.
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range r.Header["Accept"] {
+		for _, mediaType := range strings.Split(accept, ",") {
+			if i := strings.Index(mediaType, ";"); i >= 0 {
+				mediaType = mediaType[:i]
+			}
+			if strings.TrimSpace(mediaType) == eventStreamContentType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lastEventID returns the sequence number of the last event received by a
+// reconnecting client of an event stream, which is the ID of the events it was
+// sent, or 0 if unknown.
+func lastEventID(r *http.Request) uint64 {
+	id := r.Header.Get("Last-Event-ID")
+	if id == "" {
+		return 0
+	}
+	sequence, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		klog.V(4).Infof("ignoring invalid Last-Event-ID %q: %v", id, err)
+		return 0
+	}
+	return sequence
+}
+
+// streamServerSentEvents streams the past events then the events of the watch
+// as server-sent events, each one framed as:
+//
+//	id: <sequence number>
+//	event: <event type>
+//	data: <JSON event>
+//
+// Comments are sent as heartbeats while no event occurs.
+func streamServerSentEvents(eventChannel *events.EventChannel, pastEvents []*info.Event, w http.ResponseWriter, r *http.Request, m eventChannelCloser) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		m.CloseEventChannel(eventChannel.GetWatchId())
+		return errors.New("could not access http.Flusher")
+	}
+
+	// Events are buffered apart from the watch so that a slow client doesn't
+	// block the event manager, which closes the channel once the watch stops.
+	pending := make(chan *info.Event, sseMaxPendingEvents)
+	dropped := make(chan struct{})
+	go forwardEvents(eventChannel.GetChannel(), pending, dropped)
+	defer m.CloseEventChannel(eventChannel.GetWatchId())
+
+	w.Header().Set("Content-Type", eventStreamContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	// Replay the events the consumer missed before streaming new ones. Events
+	// added while replaying may be received from both, skip the duplicates.
+	replayed := replayedEvents(pastEvents)
+	for _, ev := range pastEvents {
+		if err := writeServerSentEvent(w, ev); err != nil {
+			return nil
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-dropped:
+			klog.Warningf("dropping client %s of event stream: more than %d events pending", r.RemoteAddr, sseMaxPendingEvents)
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		case ev := <-pending:
+			if replayed[ev.Sequence] {
+				continue
+			}
+			if err := writeServerSentEvent(w, ev); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// forwardEvents drains the events of a watch into pending until the watch is
+// closed. It closes dropped, and discards the events, once pending is full.
+func forwardEvents(watch <-chan *info.Event, pending chan<- *info.Event, dropped chan<- struct{}) {
+	overflowed := false
+	for ev := range watch {
+		if overflowed {
+			continue
+		}
+		select {
+		case pending <- ev:
+		default:
+			overflowed = true
+			close(dropped)
+		}
+	}
+}
+
+// writeServerSentEvent writes the framing of a single event. The JSON encoding
+// of the event has no newline, so it fits in a single data line.
+func writeServerSentEvent(w http.ResponseWriter, ev *info.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		klog.Errorf("error encoding message %+v for event stream: %v", ev, err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Sequence, ev.EventType, data)
+	return err
+}
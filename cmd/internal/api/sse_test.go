@@ -0,0 +1,156 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/events"
+	info "github.com/google/cadvisor/info/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeEventManager struct {
+	events.EventManager
+}
+
+func (m fakeEventManager) CloseEventChannel(watchID int) {
+	m.StopWatch(watchID)
+}
+
+// readServerSentEvent returns the lines of the next event or comment read
+// from the stream, without the blank line ending it.
+func readServerSentEvent(t *testing.T, r *bufio.Reader) []string {
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestStreamServerSentEvents(t *testing.T) {
+	defer func(interval time.Duration) { sseHeartbeatInterval = interval }(sseHeartbeatInterval)
+	sseHeartbeatInterval = 50 * time.Millisecond
+
+	m := fakeEventManager{events.NewEventManager(events.DefaultStoragePolicy())}
+	pastEvent := &info.Event{
+		ContainerName: "/docker/abc",
+		Timestamp:     time.Unix(1618309500, 0).UTC(),
+		EventType:     info.EventOom,
+	}
+	require.NoError(t, m.AddEvent(pastEvent))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := events.NewRequest()
+		request.ContainerName = "/docker"
+		request.IncludeSubcontainers = true
+		request.EventType[info.EventOom] = true
+		watch, err := m.WatchEvents(request)
+		require.NoError(t, err)
+		assert.NoError(t, streamServerSentEvents(watch, []*info.Event{pastEvent}, w, r, m))
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", eventStreamContentType)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, eventStreamContentType, resp.Header.Get("Content-Type"))
+	body := bufio.NewReader(resp.Body)
+
+	// The past event is replayed first.
+	lines := readServerSentEvent(t, body)
+	require.Len(t, lines, 3)
+	assert.Equal(t, "id: 1", lines[0])
+	assert.Equal(t, "event: oom", lines[1])
+
+	// Heartbeats are sent while no event occurs.
+	assert.Equal(t, []string{": heartbeat"}, readServerSentEvent(t, body))
+
+	// Events not matching the request of the watch are filtered out, and new
+	// events are not mistaken for replayed ones when they share their time.
+	ev := &info.Event{
+		ContainerName: "/docker/abc",
+		Timestamp:     pastEvent.Timestamp,
+		EventType:     info.EventOom,
+	}
+	require.NoError(t, m.AddEvent(&info.Event{ContainerName: "/system.slice", Timestamp: ev.Timestamp, EventType: info.EventOom}))
+	require.NoError(t, m.AddEvent(ev))
+	for {
+		lines = readServerSentEvent(t, body)
+		if lines[0] != ": heartbeat" {
+			break
+		}
+	}
+	require.Len(t, lines, 3)
+	assert.Equal(t, "id: 3", lines[0])
+	assert.Equal(t, "event: oom", lines[1])
+	require.True(t, strings.HasPrefix(lines[2], "data: "))
+	var received info.Event
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &received))
+	assert.Equal(t, *ev, received)
+}
+
+func TestForwardEventsDropsSlowClients(t *testing.T) {
+	watch := make(chan *info.Event)
+	pending := make(chan *info.Event, 1)
+	dropped := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		forwardEvents(watch, pending, dropped)
+		close(done)
+	}()
+
+	// The events sent once pending is full don't block the watch.
+	for i := 0; i < 3; i++ {
+		watch <- &info.Event{Timestamp: time.Unix(int64(i), 0)}
+	}
+	select {
+	case <-dropped:
+	case <-time.After(time.Second):
+		t.Fatal("client was not dropped")
+	}
+	assert.Equal(t, time.Unix(0, 0), (<-pending).Timestamp)
+
+	close(watch)
+	<-done
+}
+
+func TestAcceptsEventStream(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/v1.3/events/", nil)
+	assert.False(t, acceptsEventStream(r))
+	r.Header.Set("Accept", "text/event-stream")
+	assert.True(t, acceptsEventStream(r))
+
+	assert.EqualValues(t, 0, lastEventID(r))
+	r.Header.Set("Last-Event-ID", "42")
+	assert.EqualValues(t, 42, lastEventID(r))
+	r.Header.Set("Last-Event-ID", "2021-04-13T10:25:00.5Z")
+	assert.EqualValues(t, 0, lastEventID(r))
+}
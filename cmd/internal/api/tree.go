@@ -0,0 +1,75 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"path"
+	"sort"
+
+	v2 "github.com/google/cadvisor/info/v2"
+)
+
+// containerTreeNode is a node of the tree of the tracked containers, built
+// from the hierarchy of their cgroup paths.
+type containerTreeNode struct {
+	// Name of the container, its cgroup path, e.g. /kubepods/burstable.
+	ID string `json:"id"`
+	// First alias of the container, if any, else the last element of its
+	// cgroup path.
+	Name string `json:"name"`
+	// Tracked containers whose closest tracked ancestor is this one, sorted
+	// by id.
+	Children []*containerTreeNode `json:"children,omitempty"`
+}
+
+// buildContainerTree returns the tree rooted at root of the given containers,
+// by name. A container whose parent cgroup isn't tracked is attached to its
+// closest tracked ancestor, and the containers outside of root are ignored.
+func buildContainerTree(root string, specs map[string]v2.ContainerSpec) *containerTreeNode {
+	nodes := make(map[string]*containerTreeNode, len(specs)+1)
+	names := make([]string, 0, len(specs))
+	for name, spec := range specs {
+		node := &containerTreeNode{ID: name, Name: path.Base(name)}
+		if len(spec.Aliases) > 0 {
+			node.Name = spec.Aliases[0]
+		}
+		nodes[name] = node
+		names = append(names, name)
+	}
+	if _, ok := nodes[root]; !ok {
+		nodes[root] = &containerTreeNode{ID: root, Name: path.Base(root)}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == root || !isSubcontainer(root, name) {
+			continue
+		}
+		parent := path.Dir(name)
+		for nodes[parent] == nil {
+			parent = path.Dir(parent)
+		}
+		nodes[parent].Children = append(nodes[parent].Children, nodes[name])
+	}
+	return nodes[root]
+}
+
+// isSubcontainer returns whether name is a descendant of the container root.
+func isSubcontainer(root, name string) bool {
+	if root == "/" {
+		return name != "/"
+	}
+	return len(name) > len(root) && name[:len(root)] == root && name[len(root)] == '/'
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"testing"
+
+	v2 "github.com/google/cadvisor/info/v2"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildContainerTree(t *testing.T) {
+	specs := map[string]v2.ContainerSpec{
+		"/":                                 {},
+		"/kubepods":                         {},
+		"/kubepods/burstable":               {},
+		"/kubepods/burstable/pod1":          {},
+		"/kubepods/burstable/pod1/c1":       {Aliases: []string{"app", "c1"}},
+		"/kubepods/besteffort/pod2/c2":      {},
+		"/system.slice":                     {},
+		"/system.slice/containerd.service":  {},
+		"/system.slice/containerd.service2": {},
+	}
+
+	expected := &containerTreeNode{
+		ID:   "/",
+		Name: "/",
+		Children: []*containerTreeNode{
+			{
+				ID:   "/kubepods",
+				Name: "kubepods",
+				Children: []*containerTreeNode{
+					// The untracked besteffort and pod2 cgroups are skipped.
+					{ID: "/kubepods/besteffort/pod2/c2", Name: "c2"},
+					{
+						ID:   "/kubepods/burstable",
+						Name: "burstable",
+						Children: []*containerTreeNode{
+							{
+								ID:       "/kubepods/burstable/pod1",
+								Name:     "pod1",
+								Children: []*containerTreeNode{{ID: "/kubepods/burstable/pod1/c1", Name: "app"}},
+							},
+						},
+					},
+				},
+			},
+			{
+				ID:   "/system.slice",
+				Name: "system.slice",
+				Children: []*containerTreeNode{
+					{ID: "/system.slice/containerd.service", Name: "containerd.service"},
+					{ID: "/system.slice/containerd.service2", Name: "containerd.service2"},
+				},
+			},
+		},
+	}
+	assert.Equal(t, expected, buildContainerTree("/", specs))
+
+	// Subtree of an untracked cgroup.
+	expected = &containerTreeNode{
+		ID:   "/kubepods/besteffort",
+		Name: "besteffort",
+		Children: []*containerTreeNode{
+			{ID: "/kubepods/besteffort/pod2/c2", Name: "c2"},
+		},
+	}
+	assert.Equal(t, expected, buildContainerTree("/kubepods/besteffort", specs))
+
+	// The siblings sharing the prefix of the root aren't its children.
+	expected = &containerTreeNode{ID: "/system.slice/containerd.service", Name: "containerd.service"}
+	assert.Equal(t, expected, buildContainerTree("/system.slice/containerd.service", specs))
+}
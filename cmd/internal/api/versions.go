@@ -43,6 +43,10 @@ const (
 	versionApi       = "version"
 	psApi            = "ps"
 	customMetricsApi = "appmetrics"
+	podsApi          = "pods"
+	diskStatsApi     = "diskstats"
+	bulkStatsApi     = "bulkstats"
+	treeApi          = "tree"
 )
 
 // Interface for a cAdvisor API version
@@ -94,7 +98,7 @@ func (api *version1_0) HandleRequest(requestType string, request []string, m man
 			return err
 		}
 
-		err = writeResult(machineInfo, w)
+		err = writeResult(machineInfo, w, r)
 		if err != nil {
 			return err
 		}
@@ -115,7 +119,7 @@ func (api *version1_0) HandleRequest(requestType string, request []string, m man
 		}
 
 		// Only output the container as JSON.
-		err = writeResult(cont, w)
+		err = writeResult(cont, w, r)
 		if err != nil {
 			return err
 		}
@@ -165,7 +169,7 @@ func (api *version1_1) HandleRequest(requestType string, request []string, m man
 		}
 
 		// Only output the containers as JSON.
-		err = writeResult(containers, w)
+		err = writeResult(containers, w, r)
 		if err != nil {
 			return err
 		}
@@ -234,7 +238,7 @@ func (api *version1_2) HandleRequest(requestType string, request []string, m man
 		}
 
 		// Only output the containers as JSON.
-		err = writeResult(containers, w)
+		err = writeResult(containers, w, r)
 		if err != nil {
 			return err
 		}
@@ -280,19 +284,41 @@ func handleEventRequest(request []string, m manager.Manager, w http.ResponseWrit
 		return err
 	}
 	query.ContainerName = path.Join("/", getContainerName(request))
+	// Server-sent events are always streamed, and reconnecting clients
+	// resume after the last event they received.
+	sse := acceptsEventStream(r)
+	if sse {
+		stream = true
+		query.SinceSequence = lastEventID(r)
+	}
 	klog.V(4).Infof("Api - Events(%v)", query)
 	if !stream {
 		pastEvents, err := m.GetPastEvents(query)
 		if err != nil {
 			return err
 		}
-		return writeResult(pastEvents, w)
+		return writeResult(pastEvents, w, r)
 	}
 	eventChannel, err := m.WatchForEvents(query)
 	if err != nil {
 		return err
 	}
-	return streamResults(eventChannel, w, r, m)
+	var pastEvents []*info.Event
+	if !query.Since.IsZero() || query.SinceSequence > 0 {
+		// Catch up on the events since the given time or event. The watch is
+		// set up first so that no event is missed in between.
+		pastQuery := *query
+		pastQuery.MaxEventsReturned = -1
+		pastEvents, err = m.GetPastEvents(&pastQuery)
+		if err != nil {
+			m.CloseEventChannel(eventChannel.GetWatchId())
+			return err
+		}
+	}
+	if sse {
+		return streamServerSentEvents(eventChannel, pastEvents, w, r, m)
+	}
+	return streamResults(eventChannel, pastEvents, w, r, m)
 
 }
 
@@ -325,7 +351,7 @@ func (api *version2_0) HandleRequest(requestType string, request []string, m man
 		if err != nil {
 			return err
 		}
-		return writeResult(versionInfo.CadvisorVersion, w)
+		return writeResult(versionInfo.CadvisorVersion, w, r)
 	case attributesApi:
 		klog.V(4).Info("Api - Attributes")
 
@@ -338,7 +364,7 @@ func (api *version2_0) HandleRequest(requestType string, request []string, m man
 			return err
 		}
 		info := v2.GetAttributes(machineInfo, versionInfo)
-		return writeResult(info, w)
+		return writeResult(info, w, r)
 	case machineApi:
 		klog.V(4).Info("Api - Machine")
 
@@ -347,7 +373,7 @@ func (api *version2_0) HandleRequest(requestType string, request []string, m man
 		if err != nil {
 			return err
 		}
-		return writeResult(machineInfo, w)
+		return writeResult(machineInfo, w, r)
 	case summaryApi:
 		containerName := getContainerName(request)
 		klog.V(4).Infof("Api - Summary for container %q, options %+v", containerName, opt)
@@ -356,7 +382,7 @@ func (api *version2_0) HandleRequest(requestType string, request []string, m man
 		if err != nil {
 			return err
 		}
-		return writeResult(stats, w)
+		return writeResult(stats, w, r)
 	case statsApi:
 		name := getContainerName(request)
 		klog.V(4).Infof("Api - Stats: Looking for stats for container %q, options %+v", name, opt)
@@ -371,7 +397,7 @@ func (api *version2_0) HandleRequest(requestType string, request []string, m man
 		for name, cinfo := range infos {
 			contStats[name] = v2.DeprecatedStatsFromV1(cinfo)
 		}
-		return writeResult(contStats, w)
+		return writeResult(contStats, w, r)
 	case customMetricsApi:
 		containerName := getContainerName(request)
 		klog.V(4).Infof("Api - Custom Metrics: Looking for metrics for container %q, options %+v", containerName, opt)
@@ -411,7 +437,7 @@ func (api *version2_0) HandleRequest(requestType string, request []string, m man
 			}
 			contMetrics[containerName] = metrics
 		}
-		return writeResult(contMetrics, w)
+		return writeResult(contMetrics, w, r)
 	case specApi:
 		containerName := getContainerName(request)
 		klog.V(4).Infof("Api - Spec for container %q, options %+v", containerName, opt)
@@ -419,7 +445,7 @@ func (api *version2_0) HandleRequest(requestType string, request []string, m man
 		if err != nil {
 			return err
 		}
-		return writeResult(specs, w)
+		return writeResult(specs, w, r)
 	case storageApi:
 		label := r.URL.Query().Get("label")
 		uuid := r.URL.Query().Get("uuid")
@@ -429,21 +455,21 @@ func (api *version2_0) HandleRequest(requestType string, request []string, m man
 			if err != nil {
 				return err
 			}
-			return writeResult(fi, w)
+			return writeResult(fi, w, r)
 		case label != "":
 			// Get a specific label.
 			fi, err := m.GetFsInfo(label)
 			if err != nil {
 				return err
 			}
-			return writeResult(fi, w)
+			return writeResult(fi, w, r)
 		default:
 			// Get all global filesystems info.
 			fi, err := m.GetFsInfo("")
 			if err != nil {
 				return err
 			}
-			return writeResult(fi, w)
+			return writeResult(fi, w, r)
 		}
 	case eventsApi:
 		return handleEventRequest(request, m, w, r)
@@ -457,7 +483,7 @@ func (api *version2_0) HandleRequest(requestType string, request []string, m man
 		if err != nil {
 			return fmt.Errorf("process listing failed: %v", err)
 		}
-		return writeResult(ps, w)
+		return writeResult(ps, w, r)
 	default:
 		return fmt.Errorf("unknown request type %q", requestType)
 	}
@@ -478,7 +504,7 @@ func (api *version2_1) Version() string {
 }
 
 func (api *version2_1) SupportedRequestTypes() []string {
-	return append([]string{machineStatsApi}, api.baseVersion.SupportedRequestTypes()...)
+	return append([]string{machineStatsApi, podsApi, diskStatsApi, bulkStatsApi, treeApi}, api.baseVersion.SupportedRequestTypes()...)
 }
 
 func (api *version2_1) HandleRequest(requestType string, request []string, m manager.Manager, w http.ResponseWriter, r *http.Request) error {
@@ -498,7 +524,7 @@ func (api *version2_1) HandleRequest(requestType string, request []string, m man
 			}
 			klog.Errorf("Error calling GetRequestedContainersInfo: %v", err)
 		}
-		return writeResult(v2.MachineStatsFromV1(cont["/"]), w)
+		return writeResult(v2.MachineStatsFromV1(cont["/"]), w, r)
 	case statsApi:
 		name := getContainerName(request)
 		klog.V(4).Infof("Api - Stats: Looking for stats for container %q, options %+v", name, opt)
@@ -509,23 +535,58 @@ func (api *version2_1) HandleRequest(requestType string, request []string, m man
 			}
 			klog.Errorf("Error calling GetRequestedContainersInfo: %v", err)
 		}
-		contStats := make(map[string]v2.ContainerInfo, len(conts))
-		for name, cont := range conts {
-			if name == "/" {
-				// Root cgroup stats should be exposed as machine stats
-				continue
-			}
-			contStats[name] = v2.ContainerInfo{
-				Spec:  v2.ContainerSpecFromV1(&cont.Spec, cont.Aliases, cont.Namespace),
-				Stats: v2.ContainerStatsFromV1(name, &cont.Spec, cont.Stats),
+		return writeResult(containerStatsFromV1(conts), w, r)
+	case bulkStatsApi:
+		return handleBulkStatsRequest(opt, m, w, r)
+	case podsApi:
+		klog.V(4).Infof("Api - Pods")
+		pods, err := m.GetPodStats()
+		if err != nil {
+			return err
+		}
+		return writeResult(pods, w, r)
+	case diskStatsApi:
+		klog.V(4).Infof("Api - DiskStats")
+		disks, err := m.GetNodeDiskStats()
+		if err != nil {
+			return err
+		}
+		return writeResult(disks, w, r)
+	case treeApi:
+		name := getContainerName(request)
+		klog.V(4).Infof("Api - Tree(%v)", name)
+		opt.IdType = v2.TypeName
+		opt.Recursive = true
+		specs, err := m.GetContainerSpec(name, opt)
+		if err != nil {
+			if len(specs) == 0 {
+				return err
 			}
+			klog.Errorf("Error calling GetContainerSpec: %v", err)
 		}
-		return writeResult(contStats, w)
+		return writeResult(buildContainerTree(name, specs), w, r)
 	default:
 		return api.baseVersion.HandleRequest(requestType, request, m, w, r)
 	}
 }
 
+// containerStatsFromV1 returns the v2 spec and stats of the containers by name,
+// skipping the root container.
+func containerStatsFromV1(conts map[string]*info.ContainerInfo) map[string]v2.ContainerInfo {
+	contStats := make(map[string]v2.ContainerInfo, len(conts))
+	for name, cont := range conts {
+		if name == "/" {
+			// Root cgroup stats should be exposed as machine stats
+			continue
+		}
+		contStats[name] = v2.ContainerInfo{
+			Spec:  v2.ContainerSpecFromV1(&cont.Spec, cont.Aliases, cont.Namespace),
+			Stats: v2.ContainerStatsFromV1(name, &cont.Spec, cont.Stats),
+		}
+	}
+	return contStats
+}
+
 // GetRequestOptions returns the metrics request options from a HTTP request.
 func GetRequestOptions(r *http.Request) (v2.RequestOptions, error) {
 	supportedTypes := map[string]bool{
@@ -564,5 +625,6 @@ func GetRequestOptions(r *http.Request) (v2.RequestOptions, error) {
 		}
 		opt.MaxAge = &maxAge
 	}
+	opt.LabelSelector = r.URL.Query().Get("label_selector")
 	return opt, nil
 }
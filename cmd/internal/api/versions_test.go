@@ -19,6 +19,7 @@ import (
 	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/google/cadvisor/events"
 	info "github.com/google/cadvisor/info/v1"
@@ -79,3 +80,15 @@ func TestGetEventRequestDoubleArgument(t *testing.T) {
 	assert.True(t, stream)
 	assert.Nil(t, err)
 }
+
+func TestGetEventRequestSince(t *testing.T) {
+	r := makeHTTPRequest("http://localhost:8080/api/v1.3/events?stream=true&since=2021-06-01T10:00:00.5Z", t)
+	expectedQuery := events.NewRequest()
+	expectedQuery.Since = time.Date(2021, 6, 1, 10, 0, 0, 500000000, time.UTC)
+
+	receivedQuery, stream, err := getEventRequest(r)
+
+	assert.Nil(t, err)
+	assert.True(t, stream)
+	assert.True(t, expectedQuery.Since.Equal(receivedQuery.Since), "expected since %v but received %v", expectedQuery.Since, receivedQuery.Since)
+}
@@ -128,7 +128,7 @@ func (h *mesosContainerHandler) GetSpec() (info.ContainerSpec, error) {
 	hasNetwork := false
 	hasFilesystem := false
 
-	spec, err := common.GetSpec(h.cgroupPaths, h.machineInfoFactory, hasNetwork, hasFilesystem)
+	spec, err := common.GetSpec(containerlibcontainer.CurrentCgroupPaths(h.name, h.cgroupPaths), h.machineInfoFactory, hasNetwork, hasFilesystem)
 	if err != nil {
 		return spec, err
 	}
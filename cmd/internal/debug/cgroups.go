@@ -0,0 +1,183 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Handler for /debug/cgroups/ content.
+// Dumps the raw content of the cgroup files of a container.
+
+package debug
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	httpmux "github.com/google/cadvisor/cmd/internal/http/mux"
+	"github.com/google/cadvisor/container/libcontainer"
+
+	"k8s.io/klog/v2"
+)
+
+const CgroupsPage = "/debug/cgroups/"
+
+const (
+	// Maximum number of bytes returned per cgroup file.
+	maxFileSize = 64 * 1024
+	// Maximum number of bytes returned for all the cgroup files of a container.
+	maxTotalSize = 1024 * 1024
+)
+
+// Cgroup files from which cAdvisor reads the spec and stats of containers,
+// on cgroup v1 and v2. Files missing from a hierarchy are skipped.
+var cgroupFiles = []string{
+	"blkio.throttle.io_service_bytes",
+	"blkio.throttle.io_serviced",
+	"cpu.cfs_period_us",
+	"cpu.cfs_quota_us",
+	"cpu.max",
+	"cpu.shares",
+	"cpu.stat",
+	"cpu.weight",
+	"cpuacct.stat",
+	"cpuacct.usage",
+	"cpuacct.usage_percpu",
+	"cpuset.cpus",
+	"cpuset.cpus.effective",
+	"cpuset.mems",
+	"cpuset.mems.effective",
+	"hugetlb.2MB.limit_in_bytes",
+	"hugetlb.2MB.usage_in_bytes",
+	"io.stat",
+	"memory.current",
+	"memory.events",
+	"memory.failcnt",
+	"memory.high",
+	"memory.limit_in_bytes",
+	"memory.low",
+	"memory.max",
+	"memory.max_usage_in_bytes",
+	"memory.memsw.limit_in_bytes",
+	"memory.soft_limit_in_bytes",
+	"memory.stat",
+	"memory.swap.current",
+	"memory.swap.max",
+	"memory.usage_in_bytes",
+	"pids.current",
+	"pids.max",
+}
+
+// containerChecker will usually be manager.Manager, but can be swapped out for
+// testing.
+type containerChecker interface {
+	// Exists returns true if the named container exists.
+	Exists(containerName string) bool
+}
+
+// CgroupFile is the raw content of a cgroup file.
+type CgroupFile struct {
+	Content string `json:"content"`
+	// Whether the content was truncated to bound the size of the response.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// RegisterCgroupsHandler registers the handler dumping the raw content of the
+// cgroup files of the container named after the page, e.g.
+// /debug/cgroups/docker/<id>. The content of cgroup files may be sensitive,
+// so this handler must only be registered when explicitly enabled.
+func RegisterCgroupsHandler(mux httpmux.Mux, m containerChecker) error {
+	subsystems, err := libcontainer.GetAllCgroupSubsystems()
+	if err != nil {
+		return fmt.Errorf("failed to get cgroup subsystems: %v", err)
+	}
+	mux.Handle(CgroupsPage, cgroupsHandler(m, subsystems.MountPoints))
+	return nil
+}
+
+func cgroupsHandler(m containerChecker, mountPoints map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		containerName := path.Clean("/" + strings.TrimPrefix(r.URL.Path, CgroupsPage))
+		if !m.Exists(containerName) {
+			http.Error(w, fmt.Sprintf("unknown container %q", containerName), http.StatusNotFound)
+			return
+		}
+
+		files := readCgroupFiles(mountPoints, containerName)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(files); err != nil {
+			klog.Errorf("Failed to write cgroup files of container %q: %v", containerName, err)
+		}
+	})
+}
+
+// readCgroupFiles returns the content of the cgroup files of a container by
+// path, bounded in size.
+func readCgroupFiles(mountPoints map[string]string, containerName string) map[string]CgroupFile {
+	// On cgroup v2, all the subsystems share the same mount point.
+	dirs := map[string]struct{}{}
+	for _, mountPoint := range mountPoints {
+		dirs[filepath.Join(mountPoint, containerName)] = struct{}{}
+	}
+	sortedDirs := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sortedDirs = append(sortedDirs, dir)
+	}
+	sort.Strings(sortedDirs)
+
+	files := map[string]CgroupFile{}
+	remaining := maxTotalSize
+	for _, dir := range sortedDirs {
+		for _, name := range cgroupFiles {
+			file := filepath.Join(dir, name)
+			content, truncated, err := readBounded(file, remaining)
+			if err != nil {
+				if !os.IsNotExist(err) {
+					klog.V(4).Infof("Failed to read cgroup file %q: %v", file, err)
+				}
+				continue
+			}
+			files[file] = CgroupFile{Content: content, Truncated: truncated}
+			remaining -= len(content)
+		}
+	}
+	return files
+}
+
+// readBounded reads at most the smaller of maxFileSize and remaining bytes of
+// a file, and returns whether its content was truncated.
+func readBounded(file string, remaining int) (string, bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+
+	limit := maxFileSize
+	if remaining < limit {
+		limit = remaining
+	}
+	buf := make([]byte, limit+1)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", false, err
+	}
+	if n > limit {
+		return string(buf[:limit]), true, nil
+	}
+	return string(buf[:n]), false, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debug
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeContainerChecker map[string]bool
+
+func (c fakeContainerChecker) Exists(containerName string) bool {
+	return c[containerName]
+}
+
+func writeCgroupFile(t *testing.T, path, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func TestCgroupsHandler(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroups")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	// cpu and cpuacct share the same hierarchy.
+	mountPoints := map[string]string{
+		"cpu":     filepath.Join(root, "cpu,cpuacct"),
+		"cpuacct": filepath.Join(root, "cpu,cpuacct"),
+		"memory":  filepath.Join(root, "memory"),
+	}
+	cpuDir := filepath.Join(root, "cpu,cpuacct", "docker", "abc")
+	memoryDir := filepath.Join(root, "memory", "docker", "abc")
+	writeCgroupFile(t, filepath.Join(cpuDir, "cpu.shares"), "1024\n")
+	writeCgroupFile(t, filepath.Join(cpuDir, "cpuacct.usage"), "123456\n")
+	writeCgroupFile(t, filepath.Join(memoryDir, "memory.limit_in_bytes"), "9223372036854771712\n")
+	writeCgroupFile(t, filepath.Join(memoryDir, "memory.stat"), strings.Repeat("x", maxFileSize+10))
+	// Files cAdvisor does not read are not returned.
+	writeCgroupFile(t, filepath.Join(memoryDir, "cgroup.procs"), "1\n")
+
+	handler := cgroupsHandler(fakeContainerChecker{"/docker/abc": true}, mountPoints)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", CgroupsPage+"docker/abc", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	files := map[string]CgroupFile{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &files))
+	assert.Equal(t, map[string]CgroupFile{
+		filepath.Join(cpuDir, "cpu.shares"):               {Content: "1024\n"},
+		filepath.Join(cpuDir, "cpuacct.usage"):            {Content: "123456\n"},
+		filepath.Join(memoryDir, "memory.limit_in_bytes"): {Content: "9223372036854771712\n"},
+		filepath.Join(memoryDir, "memory.stat"):           {Content: strings.Repeat("x", maxFileSize), Truncated: true},
+	}, files)
+}
+
+func TestCgroupsHandlerUnknownContainer(t *testing.T) {
+	handler := cgroupsHandler(fakeContainerChecker{"/docker/abc": true}, map[string]string{"memory": "/sys/fs/cgroup/memory"})
+
+	for _, path := range []string{"docker/def", "docker/abc/../../../etc"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", CgroupsPage+path, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+}
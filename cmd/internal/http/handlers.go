@@ -15,6 +15,7 @@
 package http
 
 import (
+	"flag"
 	"fmt"
 	"net/http"
 
@@ -24,8 +25,12 @@ import (
 	"github.com/google/cadvisor/cmd/internal/pages"
 	"github.com/google/cadvisor/cmd/internal/pages/static"
 	"github.com/google/cadvisor/container"
+	"github.com/google/cadvisor/container/libcontainer"
+	"github.com/google/cadvisor/container/subtree"
+	v2 "github.com/google/cadvisor/info/v2"
 	"github.com/google/cadvisor/manager"
 	"github.com/google/cadvisor/metrics"
+	"github.com/google/cadvisor/storage"
 	"github.com/google/cadvisor/validate"
 
 	auth "github.com/abbot/go-http-auth"
@@ -35,6 +40,14 @@ import (
 	"k8s.io/utils/clock"
 )
 
+var (
+	enableOpenMetrics = flag.Bool("prometheus_enable_openmetrics", false, "Whether to serve metrics in the OpenMetrics format, including exemplars, to clients requesting it in their Accept header.")
+	groupByLabel      = flag.String("prometheus_group_by_label", "", "Container label by whose value container metrics are also exported summed, as container_group_* metrics. Containers missing the label are grouped as \"unknown\". Empty disables grouping.")
+	groupOnly         = flag.Bool("prometheus_group_only", false, "Whether to only export the container metrics grouped by --prometheus_group_by_label, instead of also exporting them per container.")
+	podMetrics        = flag.Bool("prometheus_pod_metrics", false, "Whether to also export the stats of the containers of each Kubernetes pod summed into pod_* metrics.")
+	metricNamePrefix  = flag.String("prometheus_metric_prefix", metrics.DefaultMetricNamePrefix, "Prefix of the names of the exported container metrics, replacing container_, e.g. node_container_.")
+)
+
 func RegisterHandlers(mux httpmux.Mux, containerManager manager.Manager, httpAuthFile, httpAuthRealm, httpDigestFile, httpDigestRealm string, urlBasePrefix string) error {
 	// Basic health handler.
 	if err := healthz.RegisterHandler(mux); err != nil {
@@ -95,10 +108,14 @@ func RegisterHandlers(mux httpmux.Mux, containerManager manager.Manager, httpAut
 // RegisterPrometheusHandler creates a new PrometheusCollector and configures
 // the provided HTTP mux to handle the given Prometheus endpoint.
 func RegisterPrometheusHandler(mux httpmux.Mux, resourceManager manager.Manager, prometheusEndpoint string,
-	f metrics.ContainerLabelsFunc, includedMetrics container.MetricSet) {
+	f metrics.ContainerLabelsFunc, includedMetrics container.MetricSet) error {
+	if err := metrics.ValidateMetricNamePrefix(*metricNamePrefix); err != nil {
+		return fmt.Errorf("invalid --prometheus_metric_prefix: %v", err)
+	}
 	goCollector := prometheus.NewGoCollector()
 	processCollector := prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{})
 	machineCollector := metrics.NewPrometheusMachineCollector(resourceManager, includedMetrics)
+	diskLatencyCollector := metrics.NewPrometheusDiskLatencyCollector(resourceManager)
 
 	mux.Handle(prometheusEndpoint, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		opts, err := api.GetRequestOptions(req)
@@ -110,14 +127,71 @@ func RegisterPrometheusHandler(mux httpmux.Mux, resourceManager manager.Manager,
 		opts.Recursive = true // get all child containers
 
 		r := prometheus.NewRegistry()
+		if *groupByLabel == "" || !*groupOnly {
+			r.MustRegister(metrics.NewPrometheusCollector(resourceManager, f, includedMetrics, clock.RealClock{}, opts).WithMetricNamePrefix(*metricNamePrefix).WithEphemeralThreshold(*manager.EphemeralContainerThreshold))
+		}
+		if *manager.EphemeralContainerThreshold > 0 {
+			r.MustRegister(metrics.NewPrometheusEphemeralCollector(resourceManager).WithMetricNamePrefix(*metricNamePrefix))
+		}
+		if *groupByLabel != "" {
+			r.MustRegister(metrics.NewPrometheusGroupedCollector(resourceManager, *groupByLabel, includedMetrics, clock.RealClock{}, opts).WithMetricNamePrefix(*metricNamePrefix))
+		}
+		if *podMetrics {
+			r.MustRegister(metrics.NewPrometheusPodCollector(resourceManager))
+		}
 		r.MustRegister(
-			metrics.NewPrometheusCollector(resourceManager, f, includedMetrics, clock.RealClock{}, opts),
 			machineCollector,
+			diskLatencyCollector,
+			goCollector,
+			processCollector,
+			libcontainer.CgroupReadErrors,
+			manager.CollectionTimeouts,
+			manager.CollectionDuration,
+			storage.QueueLength,
+			storage.QueueDrops,
+		)
+		promhttp.HandlerFor(r, prometheusHandlerOpts(*enableOpenMetrics)).ServeHTTP(w, req)
+	}))
+	return nil
+}
+
+// RegisterSubtreePrometheusHandler registers a Prometheus handler exporting
+// the metrics of the containers of a single cgroup subtree, read directly by
+// provider without the manager.
+func RegisterSubtreePrometheusHandler(mux httpmux.Mux, provider *subtree.InfoProvider, prometheusEndpoint string,
+	f metrics.ContainerLabelsFunc, includedMetrics container.MetricSet) error {
+	if err := metrics.ValidateMetricNamePrefix(*metricNamePrefix); err != nil {
+		return fmt.Errorf("invalid --prometheus_metric_prefix: %v", err)
+	}
+	goCollector := prometheus.NewGoCollector()
+	processCollector := prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{})
+
+	mux.Handle(prometheusEndpoint, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		opts := v2.RequestOptions{
+			IdType:    v2.TypeName,
+			Count:     1,
+			Recursive: true,
+		}
+		r := prometheus.NewRegistry()
+		r.MustRegister(
+			metrics.NewPrometheusCollector(provider, f, includedMetrics, clock.RealClock{}, opts).WithMetricNamePrefix(*metricNamePrefix),
 			goCollector,
 			processCollector,
+			libcontainer.CgroupReadErrors,
 		)
-		promhttp.HandlerFor(r, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError}).ServeHTTP(w, req)
+		promhttp.HandlerFor(r, prometheusHandlerOpts(*enableOpenMetrics)).ServeHTTP(w, req)
 	}))
+	return nil
+}
+
+// prometheusHandlerOpts returns the options of the Prometheus handler. With
+// OpenMetrics enabled, the format is negotiated from the Accept header of the
+// request.
+func prometheusHandlerOpts(openMetrics bool) promhttp.HandlerOpts {
+	return promhttp.HandlerOpts{
+		ErrorHandling:     promhttp.ContinueOnError,
+		EnableOpenMetrics: openMetrics,
+	}
 }
 
 func staticHandlerNoAuth(w http.ResponseWriter, r *http.Request) {
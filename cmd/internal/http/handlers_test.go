@@ -0,0 +1,78 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/cadvisor/manager"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getMetrics(t *testing.T, openMetrics bool, accept string) (string, string) {
+	r := prometheus.NewRegistry()
+	r.MustRegister(manager.CollectionTimeouts, manager.CollectionDuration)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	promhttp.HandlerFor(r, prometheusHandlerOpts(openMetrics)).ServeHTTP(w, req)
+	body, err := ioutil.ReadAll(w.Body)
+	require.Nil(t, err)
+	return w.Header().Get("Content-Type"), string(body)
+}
+
+func TestPrometheusHandlerOpenMetrics(t *testing.T) {
+	manager.CollectionTimeouts.WithLabelValues("perf").Inc()
+	manager.CollectionDuration.(prometheus.ExemplarObserver).ObserveWithExemplar(0.02, prometheus.Labels{"container": "abc"})
+	const openMetricsAccept = "application/openmetrics-text; version=0.0.1,text/plain;version=0.0.4;q=0.5,*/*;q=0.1"
+
+	contentType, body := getMetrics(t, true, openMetricsAccept)
+	assert.True(t, strings.HasPrefix(contentType, "application/openmetrics-text"), "unexpected content type %q", contentType)
+	assert.True(t, strings.HasSuffix(body, "# EOF\n"), "missing # EOF in:\n%s", body)
+	// Counter families are named without the _total suffix of their samples.
+	assert.Contains(t, body, "# TYPE cadvisor_container_collection_timeouts counter\n")
+	assert.Contains(t, body, "\ncadvisor_container_collection_timeouts_total{stage=\"perf\"} ")
+	// The exemplar is attached to the bucket of the observation.
+	assert.Contains(t, body, "# TYPE cadvisor_container_collection_duration_seconds histogram\n")
+	var exemplars []string
+	for _, line := range strings.Split(body, "\n") {
+		if strings.Contains(line, " # {") {
+			exemplars = append(exemplars, line)
+		}
+	}
+	require.Len(t, exemplars, 1, "unexpected exemplars in:\n%s", body)
+	assert.True(t, strings.HasPrefix(exemplars[0], "cadvisor_container_collection_duration_seconds_bucket{le=\"0.032\"} "), exemplars[0])
+	assert.Contains(t, exemplars[0], " # {container=\"abc\"} 0.02 ")
+
+	// Clients not requesting OpenMetrics get the Prometheus text format.
+	contentType, body = getMetrics(t, true, "")
+	assert.True(t, strings.HasPrefix(contentType, "text/plain"), "unexpected content type %q", contentType)
+	assert.NotContains(t, body, "# EOF")
+	assert.NotContains(t, body, " # {")
+
+	// OpenMetrics is only negotiated when enabled.
+	contentType, _ = getMetrics(t, false, openMetricsAccept)
+	assert.True(t, strings.HasPrefix(contentType, "text/plain"), "unexpected content type %q", contentType)
+}
@@ -26,6 +26,7 @@ import (
 
 func init() {
 	storage.RegisterStorageDriver("bigquery", new)
+	storage.RegisterFixedUnitsDriver("bigquery")
 }
 
 type bigqueryStorage struct {
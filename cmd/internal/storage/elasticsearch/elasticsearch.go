@@ -17,7 +17,9 @@ package elasticsearch
 import (
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -29,28 +31,50 @@ import (
 
 func init() {
 	storage.RegisterStorageDriver("elasticsearch", new)
+	storage.RegisterFixedUnitsDriver("elasticsearch")
 }
 
 type elasticStorage struct {
-	client      *elastic.Client
-	machineName string
-	indexName   string
-	typeName    string
-	lock        sync.Mutex
+	client         *elastic.Client
+	machineName    string
+	indexPattern   string
+	typeName       string
+	bulkSize       int
+	maxRetries     int
+	bufferDuration time.Duration
+
+	lock      sync.Mutex
+	lastWrite time.Time
+	documents []bulkDocument
 }
 
 type detailSpec struct {
-	Timestamp      int64                `json:"timestamp"`
-	MachineName    string               `json:"machine_name,omitempty"`
-	ContainerName  string               `json:"container_Name,omitempty"`
-	ContainerStats *info.ContainerStats `json:"container_stats,omitempty"`
+	Timestamp     int64  `json:"timestamp"`
+	MachineName   string `json:"machine_name,omitempty"`
+	ContainerName string `json:"container_Name,omitempty"`
+	// Fields of the reference of the container.
+	ContainerID        string               `json:"container_id,omitempty"`
+	ContainerCgroup    string               `json:"container_cgroup,omitempty"`
+	ContainerAliases   []string             `json:"container_aliases,omitempty"`
+	ContainerNamespace string               `json:"container_namespace,omitempty"`
+	ContainerStats     *info.ContainerStats `json:"container_stats,omitempty"`
+}
+
+// bulkDocument is a document waiting to be indexed into the given index.
+type bulkDocument struct {
+	index  string
+	detail *detailSpec
+	// Number of times indexing the document failed.
+	retries int
 }
 
 var (
 	argElasticHost   = flag.String("storage_driver_es_host", "http://localhost:9200", "ElasticSearch host:port")
-	argIndexName     = flag.String("storage_driver_es_index", "cadvisor", "ElasticSearch index name")
+	argIndexName     = flag.String("storage_driver_es_index", "cadvisor", "ElasticSearch index name. The date of the stats can be templated into it with %Y (year), %m (month), %d (day) and %H (hour), in UTC, e.g. cadvisor-%Y.%m.%d for daily indices.")
 	argTypeName      = flag.String("storage_driver_es_type", "stats", "ElasticSearch type name")
 	argEnableSniffer = flag.Bool("storage_driver_es_enable_sniffer", false, "ElasticSearch uses a sniffing process to find all nodes of your cluster by default, automatically")
+	argBulkSize      = flag.Int("storage_driver_es_bulk_size", 500, "Maximum number of documents per ElasticSearch bulk request")
+	argMaxRetries    = flag.Int("storage_driver_es_max_retries", 3, "Number of times the documents an ElasticSearch bulk request failed to index with a transient error are retried, with the next bulk request")
 )
 
 func new() (storage.StorageDriver, error) {
@@ -64,9 +88,46 @@ func new() (storage.StorageDriver, error) {
 		*argTypeName,
 		*argElasticHost,
 		*argEnableSniffer,
+		*argBulkSize,
+		*argMaxRetries,
+		*storage.ArgDbBufferDuration,
 	)
 }
 
+// indexName expands the date directives of the index pattern with the given
+// time in UTC: %Y (year), %m (month), %d (day), %H (hour) and %% (a percent
+// sign). Other directives are left as they are.
+func indexName(pattern string, t time.Time) string {
+	if !strings.Contains(pattern, "%") {
+		return pattern
+	}
+	t = t.UTC()
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i == len(pattern)-1 {
+			b.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(pattern[i])
+		}
+	}
+	return b.String()
+}
+
 func (s *elasticStorage) containerStatsAndDefaultValues(
 	cInfo *info.ContainerInfo, stats *info.ContainerStats) *detailSpec {
 	timestamp := stats.Timestamp.UnixNano() / 1e3
@@ -77,10 +138,14 @@ func (s *elasticStorage) containerStatsAndDefaultValues(
 		containerName = cInfo.ContainerReference.Name
 	}
 	detail := &detailSpec{
-		Timestamp:      timestamp,
-		MachineName:    s.machineName,
-		ContainerName:  containerName,
-		ContainerStats: stats,
+		Timestamp:          timestamp,
+		MachineName:        s.machineName,
+		ContainerName:      containerName,
+		ContainerID:        cInfo.ContainerReference.Id,
+		ContainerCgroup:    cInfo.ContainerReference.Name,
+		ContainerAliases:   cInfo.ContainerReference.Aliases,
+		ContainerNamespace: cInfo.ContainerReference.Namespace,
+		ContainerStats:     stats,
 	}
 	return detail
 }
@@ -89,30 +154,126 @@ func (s *elasticStorage) AddStats(cInfo *info.ContainerInfo, stats *info.Contain
 	if stats == nil {
 		return nil
 	}
+	var documentsToFlush []bulkDocument
 	func() {
 		// AddStats will be invoked simultaneously from multiple threads and only one of them will perform a write.
 		s.lock.Lock()
 		defer s.lock.Unlock()
 		// Add some default params based on ContainerStats
-		detail := s.containerStatsAndDefaultValues(cInfo, stats)
-		// Index a cadvisor (using JSON serialization)
-		_, err := s.client.Index().
-			Index(s.indexName).
+		s.documents = append(s.documents, bulkDocument{
+			index:  indexName(s.indexPattern, stats.Timestamp),
+			detail: s.containerStatsAndDefaultValues(cInfo, stats),
+		})
+		if time.Since(s.lastWrite) >= s.bufferDuration {
+			documentsToFlush = s.documents
+			s.documents = nil
+			s.lastWrite = time.Now()
+		}
+	}()
+	retry, err := s.write(documentsToFlush)
+	if len(retry) > 0 {
+		// The documents are retried with the next write rather than after
+		// waiting, AddStats is called on the housekeeping of the containers.
+		s.lock.Lock()
+		s.documents = append(retry, s.documents...)
+		s.lock.Unlock()
+	}
+	return err
+}
+
+// write indexes the documents in bulk requests of at most bulkSize documents.
+// It returns the documents which failed with a transient error and are to be
+// retried, and the error of those which failed for good.
+func (s *elasticStorage) write(documents []bulkDocument) ([]bulkDocument, error) {
+	var retry []bulkDocument
+	var lastErr error
+	failed := 0
+	for len(documents) > 0 {
+		n := len(documents)
+		if n > s.bulkSize {
+			n = s.bulkSize
+		}
+		batchRetry, batchFailed, err := s.bulk(documents[:n])
+		retry = append(retry, batchRetry...)
+		if batchFailed > 0 {
+			failed += batchFailed
+			lastErr = err
+		}
+		documents = documents[n:]
+	}
+	if failed > 0 {
+		return retry, fmt.Errorf("failed to write %d documents to ElasticSearch: %v", failed, lastErr)
+	}
+	return retry, nil
+}
+
+// retryable returns whether indexing a document failing with the status may
+// succeed later: the cluster is overloaded or failing, rather than rejecting
+// the document, e.g. with a mapping error.
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// bulk indexes the documents in a single bulk request. The documents it failed
+// to index with a transient error, or all of them if the request itself
+// failed, are returned to be retried unless they were already retried
+// maxRetries times. The others are counted as failed, with the last error.
+func (s *elasticStorage) bulk(documents []bulkDocument) (retry []bulkDocument, failed int, err error) {
+	request := s.client.Bulk()
+	for _, document := range documents {
+		request.Add(elastic.NewBulkIndexRequest().
+			Index(document.index).
 			Type(s.typeName).
-			BodyJson(detail).
-			Do()
-		if err != nil {
-			// Handle error
-			fmt.Printf("failed to write stats to ElasticSearch - %s", err)
+			Doc(document.detail))
+	}
+	fail := func(document bulkDocument, transient bool, documentErr error) {
+		if transient && document.retries < s.maxRetries {
+			document.retries++
+			retry = append(retry, document)
 			return
 		}
-	}()
-	return nil
+		failed++
+		err = documentErr
+	}
+	response, requestErr := request.Do()
+	if requestErr != nil {
+		for _, document := range documents {
+			fail(document, true, requestErr)
+		}
+		return retry, failed, err
+	}
+	// The items of the response are in the order of the requests.
+	for i, item := range response.Items {
+		if i >= len(documents) {
+			break
+		}
+		for _, result := range item {
+			if result.Status >= 200 && result.Status <= 299 {
+				continue
+			}
+			fail(documents[i], retryable(result.Status), fmt.Errorf("index %q returned status %d: %s", result.Index, result.Status, result.Error))
+		}
+	}
+	return retry, failed, err
 }
 
+// Close indexes the buffered documents, retrying those failing with a
+// transient error right away.
 func (s *elasticStorage) Close() error {
-	s.client = nil
-	return nil
+	s.lock.Lock()
+	documents := s.documents
+	s.documents = nil
+	s.lock.Unlock()
+	var err error
+	for len(documents) > 0 {
+		var writeErr error
+		documents, writeErr = s.write(documents)
+		if writeErr != nil {
+			err = writeErr
+		}
+	}
+	s.client.Stop()
+	return err
 }
 
 // machineName: A unique identifier to identify the host that current cAdvisor
@@ -120,11 +281,17 @@ func (s *elasticStorage) Close() error {
 // ElasticHost: The host which runs ElasticSearch.
 func newStorage(
 	machineName,
-	indexName,
+	indexPattern,
 	typeName,
 	elasticHost string,
 	enableSniffer bool,
-) (storage.StorageDriver, error) {
+	bulkSize,
+	maxRetries int,
+	bufferDuration time.Duration,
+) (*elasticStorage, error) {
+	if bulkSize <= 0 {
+		return nil, fmt.Errorf("invalid ElasticSearch bulk size %d", bulkSize)
+	}
 	// Obtain a client and connect to the default Elasticsearch installation
 	// on 127.0.0.1:9200. Of course you can configure your client to connect
 	// to other hosts and configure it in various other ways.
@@ -149,10 +316,14 @@ func newStorage(
 	fmt.Printf("Elasticsearch returned with code %d and version %s", code, info.Version.Number)
 
 	ret := &elasticStorage{
-		client:      client,
-		machineName: machineName,
-		indexName:   indexName,
-		typeName:    typeName,
+		client:         client,
+		machineName:    machineName,
+		indexPattern:   indexPattern,
+		typeName:       typeName,
+		bulkSize:       bulkSize,
+		maxRetries:     maxRetries,
+		bufferDuration: bufferDuration,
+		lastWrite:      time.Now(),
 	}
 	return ret, nil
 }
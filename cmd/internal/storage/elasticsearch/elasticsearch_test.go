@@ -0,0 +1,233 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// bulkAction is the action line of a document of a bulk request.
+type bulkAction struct {
+	Index struct {
+		Index string `json:"_index"`
+		Type  string `json:"_type"`
+	} `json:"index"`
+}
+
+// mockBulkServer is an ElasticSearch node recording the documents of the bulk
+// requests it receives. It rejects the documents at the given positions of the
+// first bulk request with rejectStatus, 429 by default.
+type mockBulkServer struct {
+	*httptest.Server
+
+	lock         sync.Mutex
+	requests     int
+	actions      []bulkAction
+	documents    []map[string]interface{}
+	reject       map[int]bool
+	rejectStatus int
+}
+
+func newMockBulkServer(t *testing.T, reject ...int) *mockBulkServer {
+	s := &mockBulkServer{reject: map[int]bool{}, rejectStatus: http.StatusTooManyRequests}
+	for _, i := range reject {
+		s.reject[i] = true
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/_bulk") {
+			// Health checks and pings.
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"status":200,"version":{"number":"1.7.6"}}`)
+			return
+		}
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.requests++
+		var items []string
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		for i := 0; scanner.Scan(); i++ {
+			var action bulkAction
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &action))
+			require.True(t, scanner.Scan(), "missing document")
+			var document map[string]interface{}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &document))
+			status := 201
+			if s.requests == 1 && s.reject[i] {
+				status = s.rejectStatus
+			} else {
+				s.actions = append(s.actions, action)
+				s.documents = append(s.documents, document)
+			}
+			items = append(items, fmt.Sprintf(`{"index":{"_index":%q,"_type":%q,"status":%d}}`, action.Index.Index, action.Index.Type, status))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"took":1,"errors":%v,"items":[%s]}`, s.requests == 1 && len(s.reject) > 0, strings.Join(items, ","))
+	}))
+	return s
+}
+
+func containerInfo(name string) *info.ContainerInfo {
+	return &info.ContainerInfo{
+		ContainerReference: info.ContainerReference{
+			Id:        "abc" + name,
+			Name:      "/docker/abc" + name,
+			Aliases:   []string{name, "abc" + name},
+			Namespace: "docker",
+		},
+	}
+}
+
+func TestIndexName(t *testing.T) {
+	ts := time.Date(2021, time.March, 7, 5, 4, 3, 0, time.UTC)
+	assert.Equal(t, "cadvisor", indexName("cadvisor", ts))
+	assert.Equal(t, "cadvisor-2021.03.07", indexName("cadvisor-%Y.%m.%d", ts))
+	assert.Equal(t, "cadvisor-2021.03.07-05", indexName("cadvisor-%Y.%m.%d-%H", ts))
+	assert.Equal(t, "cadvisor-%-%x-%", indexName("cadvisor-%%-%x-%", ts))
+	// The date is the one in UTC, even for times in other locations.
+	assert.Equal(t, "cadvisor-2021.03.07", indexName("cadvisor-%Y.%m.%d", ts.In(time.FixedZone("PST", -8*3600))))
+}
+
+func TestAddStatsBulkIndexes(t *testing.T) {
+	server := newMockBulkServer(t)
+	defer server.Close()
+	s, err := newStorage("machine", "cadvisor-%Y.%m.%d", "stats", server.URL, false, 2, 0, 0)
+	require.NoError(t, err)
+	defer s.Close()
+
+	ts := time.Date(2021, time.March, 7, 5, 4, 3, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		stats := &info.ContainerStats{Timestamp: ts.Add(time.Duration(i) * time.Second)}
+		stats.Cpu.Usage.Total = uint64(i)
+		require.NoError(t, s.AddStats(containerInfo(fmt.Sprint(i)), stats))
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	// Without buffering, each document is indexed right away.
+	assert.Equal(t, 3, server.requests)
+	require.Len(t, server.actions, 3)
+	for _, action := range server.actions {
+		assert.Equal(t, "cadvisor-2021.03.07", action.Index.Index)
+		assert.Equal(t, "stats", action.Index.Type)
+	}
+	document := server.documents[1]
+	assert.Equal(t, "machine", document["machine_name"])
+	assert.Equal(t, "1", document["container_Name"])
+	assert.Equal(t, "abc1", document["container_id"])
+	assert.Equal(t, "/docker/abc1", document["container_cgroup"])
+	assert.Equal(t, []interface{}{"1", "abc1"}, document["container_aliases"])
+	assert.Equal(t, "docker", document["container_namespace"])
+	assert.EqualValues(t, ts.Add(time.Second).UnixNano()/1e3, document["timestamp"])
+	containerStats, ok := document["container_stats"].(map[string]interface{})
+	require.True(t, ok)
+	assert.EqualValues(t, 1, containerStats["cpu"].(map[string]interface{})["usage"].(map[string]interface{})["total"])
+}
+
+func TestAddStatsBatchesAndRetries(t *testing.T) {
+	// The second document of the first request is rejected.
+	server := newMockBulkServer(t, 1)
+	defer server.Close()
+	s, err := newStorage("machine", "cadvisor-%Y.%m.%d", "stats", server.URL, false, 2, 1, time.Hour)
+	require.NoError(t, err)
+
+	ts := time.Date(2021, time.March, 7, 23, 59, 59, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.AddStats(containerInfo(fmt.Sprint(i)), &info.ContainerStats{Timestamp: ts.Add(time.Duration(i) * time.Second)}))
+	}
+	server.lock.Lock()
+	assert.Equal(t, 0, server.requests, "documents are buffered")
+	server.lock.Unlock()
+
+	// Closing the storage indexes the buffered documents in batches of 2.
+	require.NoError(t, s.Close())
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	// The rejected document is retried alone, after the other batches.
+	assert.Equal(t, 3, server.requests)
+	require.Len(t, server.documents, 3)
+	var names, indices []string
+	for i, document := range server.documents {
+		names = append(names, document["container_Name"].(string))
+		indices = append(indices, server.actions[i].Index.Index)
+	}
+	assert.Equal(t, []string{"0", "2", "1"}, names)
+	// The documents go to the index of the day of their stats.
+	assert.Equal(t, []string{"cadvisor-2021.03.07", "cadvisor-2021.03.08", "cadvisor-2021.03.08"}, indices)
+}
+
+func TestAddStatsGivesUpAfterRetries(t *testing.T) {
+	server := newMockBulkServer(t, 0)
+	defer server.Close()
+	s, err := newStorage("machine", "cadvisor", "stats", server.URL, false, 10, 0, 0)
+	require.NoError(t, err)
+	defer s.Close()
+
+	err = s.AddStats(containerInfo("0"), &info.ContainerStats{Timestamp: time.Now()})
+	assert.Error(t, err)
+}
+
+func TestAddStatsRetriesWithNextWrite(t *testing.T) {
+	server := newMockBulkServer(t, 0)
+	defer server.Close()
+	s, err := newStorage("machine", "cadvisor", "stats", server.URL, false, 10, 1, 0)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// The rejected document is buffered rather than retried right away.
+	require.NoError(t, s.AddStats(containerInfo("0"), &info.ContainerStats{Timestamp: time.Now()}))
+	server.lock.Lock()
+	assert.Equal(t, 1, server.requests)
+	assert.Empty(t, server.documents)
+	server.lock.Unlock()
+
+	require.NoError(t, s.AddStats(containerInfo("1"), &info.ContainerStats{Timestamp: time.Now()}))
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	assert.Equal(t, 2, server.requests)
+	require.Len(t, server.documents, 2)
+	assert.Equal(t, "0", server.documents[0]["container_Name"])
+	assert.Equal(t, "1", server.documents[1]["container_Name"])
+}
+
+func TestAddStatsDoesNotRetryRejectedDocuments(t *testing.T) {
+	server := newMockBulkServer(t, 0)
+	server.rejectStatus = http.StatusBadRequest
+	defer server.Close()
+	s, err := newStorage("machine", "cadvisor", "stats", server.URL, false, 10, 3, 0)
+	require.NoError(t, err)
+	defer s.Close()
+
+	assert.Error(t, s.AddStats(containerInfo("0"), &info.ContainerStats{Timestamp: time.Now()}))
+	require.NoError(t, s.AddStats(containerInfo("1"), &info.ContainerStats{Timestamp: time.Now()}))
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	assert.Equal(t, 2, server.requests)
+	require.Len(t, server.documents, 1)
+	assert.Equal(t, "1", server.documents[0]["container_Name"])
+}
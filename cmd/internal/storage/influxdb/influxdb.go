@@ -31,6 +31,7 @@ import (
 
 func init() {
 	storage.RegisterStorageDriver("influxdb", new)
+	storage.RegisterFixedUnitsDriver("influxdb")
 }
 
 var argDbRetentionPolicy = flag.String("storage_driver_influxdb_retention_policy", "", "retention policy")
@@ -0,0 +1,138 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promremotewrite
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// The messages of the remote-write protocol sent by cAdvisor, as defined by
+// prompb/remote.proto and prompb/types.proto of Prometheus. The fields which
+// aren't sent are left out, so that the whole Prometheus module isn't needed.
+
+type writeRequest struct {
+	Timeseries []timeSeries     // 1
+	Metadata   []metricMetadata // 3
+}
+
+type timeSeries struct {
+	Labels  []label  // 1
+	Samples []sample // 2
+}
+
+type label struct {
+	Name  string // 1
+	Value string // 2
+}
+
+type sample struct {
+	Value     float64 // 1
+	Timestamp int64   // 2
+}
+
+type metricType int32
+
+const (
+	metricTypeCounter metricType = 1
+	metricTypeGauge   metricType = 2
+)
+
+type metricMetadata struct {
+	Type             metricType // 1
+	MetricFamilyName string     // 2
+	Help             string     // 4
+}
+
+// Wire types of the protobuf encoding.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendUvarint(b []byte, value uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], value)]...)
+}
+
+func appendTag(b []byte, field int, wireType int) []byte {
+	return appendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+// appendMessage appends a length-delimited field, which is kept even if empty
+// so that the elements of repeated fields aren't lost.
+func appendMessage(b []byte, field int, value []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = appendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+// appendString appends a string field. Like proto3, the scalar fields with
+// their default values are left out.
+func appendString(b []byte, field int, value string) []byte {
+	if value == "" {
+		return b
+	}
+	return appendMessage(b, field, []byte(value))
+}
+
+func appendVarint(b []byte, field int, value uint64) []byte {
+	if value == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireVarint)
+	return appendUvarint(b, value)
+}
+
+func appendDouble(b []byte, field int, value float64) []byte {
+	bits := math.Float64bits(value)
+	if bits == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireFixed64)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], bits)
+	return append(b, buf[:]...)
+}
+
+// Marshal returns the protobuf encoding of the request.
+func (r *writeRequest) Marshal() ([]byte, error) {
+	var b []byte
+	for i := range r.Timeseries {
+		b = appendMessage(b, 1, r.Timeseries[i].marshal())
+	}
+	for i := range r.Metadata {
+		b = appendMessage(b, 3, r.Metadata[i].marshal())
+	}
+	return b, nil
+}
+
+func (ts *timeSeries) marshal() []byte {
+	var b []byte
+	for _, l := range ts.Labels {
+		b = appendMessage(b, 1, appendString(appendString(nil, 1, l.Name), 2, l.Value))
+	}
+	for _, s := range ts.Samples {
+		b = appendMessage(b, 2, appendVarint(appendDouble(nil, 1, s.Value), 2, uint64(s.Timestamp)))
+	}
+	return b
+}
+
+func (m *metricMetadata) marshal() []byte {
+	b := appendVarint(nil, 1, uint64(m.Type))
+	b = appendString(b, 2, m.MetricFamilyName)
+	return appendString(b, 4, m.Help)
+}
@@ -0,0 +1,333 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package promremotewrite pushes the container stats to an endpoint
+// implementing the remote-write protocol of Prometheus.
+package promremotewrite
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+	"github.com/google/cadvisor/version"
+)
+
+func init() {
+	storage.RegisterStorageDriver("promremotewrite", new)
+	storage.RegisterFixedUnitsDriver("promremotewrite")
+}
+
+var (
+	argURL               = flag.String("storage_driver_promremotewrite_url", "", "URL of the Prometheus remote-write endpoint to push the stats to, e.g. http://prometheus:9090/api/v1/write")
+	argUsername          = flag.String("storage_driver_promremotewrite_username", "", "Username of the basic authentication to the remote-write endpoint. Empty disables basic authentication.")
+	argPassword          = flag.String("storage_driver_promremotewrite_password", "", "Password of the basic authentication to the remote-write endpoint")
+	argBearerTokenFile   = flag.String("storage_driver_promremotewrite_bearer_token_file", "", "File holding the bearer token sent to the remote-write endpoint, read before each request")
+	argMaxSamplesPerSend = flag.Int("storage_driver_promremotewrite_max_samples_per_send", 2000, "Maximum number of samples per remote-write request")
+	argTimeout           = flag.Duration("storage_driver_promremotewrite_timeout", 30*time.Second, "Timeout of the remote-write requests")
+)
+
+// Version of the remote-write protocol.
+const remoteWriteVersion = "0.1.0"
+
+// Labels of the series.
+const (
+	labelMetricName = "__name__"
+	labelID         = "id"
+	labelName       = "name"
+	labelImage      = "image"
+	labelNamespace  = "namespace"
+	labelMachine    = "machine"
+	labelInterface  = "interface"
+	labelDevice     = "device"
+)
+
+// Metric families, named as exported by the Prometheus endpoint of cAdvisor.
+var (
+	cpuUsageTotal        = counter("container_cpu_usage_seconds_total", "Cumulative cpu time consumed in seconds.")
+	cpuUsageUser         = counter("container_cpu_user_seconds_total", "Cumulative user cpu time consumed in seconds.")
+	cpuUsageSystem       = counter("container_cpu_system_seconds_total", "Cumulative system cpu time consumed in seconds.")
+	cpuLoadAverage       = gauge("container_cpu_load_average_10s", "Value of container cpu load average over the last 10 seconds.")
+	memoryUsage          = gauge("container_memory_usage_bytes", "Current memory usage in bytes, including all memory regardless of when it was accessed")
+	memoryMaxUsage       = gauge("container_memory_max_usage_bytes", "Maximum memory usage recorded in bytes")
+	memoryWorkingSet     = gauge("container_memory_working_set_bytes", "Current working set in bytes.")
+	memoryRSS            = gauge("container_memory_rss", "Size of RSS in bytes.")
+	memoryCache          = gauge("container_memory_cache", "Number of bytes of page cache memory.")
+	memorySwap           = gauge("container_memory_swap", "Container swap usage in bytes.")
+	memoryFailcnt        = counter("container_memory_failcnt", "Number of memory usage hits limits")
+	networkRxBytes       = counter("container_network_receive_bytes_total", "Cumulative count of bytes received")
+	networkRxErrors      = counter("container_network_receive_errors_total", "Cumulative count of errors encountered while receiving")
+	networkTxBytes       = counter("container_network_transmit_bytes_total", "Cumulative count of bytes transmitted")
+	networkTxErrors      = counter("container_network_transmit_errors_total", "Cumulative count of errors encountered while transmitting")
+	fsUsage              = gauge("container_fs_usage_bytes", "Number of bytes that are consumed by the container on this filesystem.")
+	fsLimit              = gauge("container_fs_limit_bytes", "Number of bytes that can be consumed by the container on this filesystem.")
+	metadataByFamilyName = map[string]metricMetadata{}
+)
+
+func counter(familyName, help string) metricMetadata {
+	return metricMetadata{Type: metricTypeCounter, MetricFamilyName: familyName, Help: help}
+}
+
+func gauge(familyName, help string) metricMetadata {
+	return metricMetadata{Type: metricTypeGauge, MetricFamilyName: familyName, Help: help}
+}
+
+func init() {
+	for _, m := range []metricMetadata{
+		cpuUsageTotal, cpuUsageUser, cpuUsageSystem, cpuLoadAverage,
+		memoryUsage, memoryMaxUsage, memoryWorkingSet, memoryRSS, memoryCache, memorySwap, memoryFailcnt,
+		networkRxBytes, networkRxErrors, networkTxBytes, networkTxErrors,
+		fsUsage, fsLimit,
+	} {
+		metadataByFamilyName[m.MetricFamilyName] = m
+	}
+}
+
+type promRemoteWriteStorage struct {
+	client            *http.Client
+	url               string
+	username          string
+	password          string
+	bearerTokenFile   string
+	machineName       string
+	maxSamplesPerSend int
+	bufferDuration    time.Duration
+	userAgent         string
+
+	lock      sync.Mutex
+	lastWrite time.Time
+	series    []timeSeries
+}
+
+func new() (storage.StorageDriver, error) {
+	if *argURL == "" {
+		return nil, fmt.Errorf("--storage_driver_promremotewrite_url is required by the promremotewrite storage driver")
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	return newStorage(hostname, *argURL, *argMaxSamplesPerSend, *storage.ArgDbBufferDuration, *argTimeout)
+}
+
+func newStorage(machineName, url string, maxSamplesPerSend int, bufferDuration, timeout time.Duration) (*promRemoteWriteStorage, error) {
+	if maxSamplesPerSend <= 0 {
+		return nil, fmt.Errorf("invalid maximum number of samples per remote-write request %d", maxSamplesPerSend)
+	}
+	return &promRemoteWriteStorage{
+		client:            &http.Client{Timeout: timeout},
+		url:               url,
+		username:          *argUsername,
+		password:          *argPassword,
+		bearerTokenFile:   *argBearerTokenFile,
+		machineName:       machineName,
+		maxSamplesPerSend: maxSamplesPerSend,
+		bufferDuration:    bufferDuration,
+		userAgent:         fmt.Sprintf("%v/%v", "cAdvisor", version.Info["version"]),
+		lastWrite:         time.Now(),
+	}, nil
+}
+
+// containerLabels returns the labels identifying the container.
+func (s *promRemoteWriteStorage) containerLabels(cInfo *info.ContainerInfo) []label {
+	name := cInfo.Name
+	if len(cInfo.Aliases) > 0 {
+		name = cInfo.Aliases[0]
+	}
+	labels := []label{
+		{Name: labelID, Value: cInfo.Name},
+		{Name: labelName, Value: name},
+		{Name: labelMachine, Value: s.machineName},
+	}
+	if cInfo.Namespace != "" {
+		labels = append(labels, label{Name: labelNamespace, Value: cInfo.Namespace})
+	}
+	if cInfo.Spec.Image != "" {
+		labels = append(labels, label{Name: labelImage, Value: cInfo.Spec.Image})
+	}
+	return labels
+}
+
+// statsToSeries returns a series with a single sample for each metric of the
+// stats.
+func (s *promRemoteWriteStorage) statsToSeries(cInfo *info.ContainerInfo, stats *info.ContainerStats) []timeSeries {
+	containerLabels := s.containerLabels(cInfo)
+	timestamp := stats.Timestamp.UnixNano() / int64(time.Millisecond)
+	var series []timeSeries
+	add := func(m metricMetadata, value float64, extraLabels ...label) {
+		labels := make([]label, 0, len(containerLabels)+len(extraLabels)+1)
+		labels = append(labels, label{Name: labelMetricName, Value: m.MetricFamilyName})
+		labels = append(labels, containerLabels...)
+		labels = append(labels, extraLabels...)
+		sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+		series = append(series, timeSeries{
+			Labels:  labels,
+			Samples: []sample{{Value: value, Timestamp: timestamp}},
+		})
+	}
+
+	if cInfo.Spec.HasCpu {
+		add(cpuUsageTotal, float64(stats.Cpu.Usage.Total)/float64(time.Second))
+		add(cpuUsageUser, float64(stats.Cpu.Usage.User)/float64(time.Second))
+		add(cpuUsageSystem, float64(stats.Cpu.Usage.System)/float64(time.Second))
+		add(cpuLoadAverage, float64(stats.Cpu.LoadAverage))
+	}
+	if cInfo.Spec.HasMemory {
+		add(memoryUsage, float64(stats.Memory.Usage))
+		add(memoryMaxUsage, float64(stats.Memory.MaxUsage))
+		add(memoryWorkingSet, float64(stats.Memory.WorkingSet))
+		add(memoryRSS, float64(stats.Memory.RSS))
+		add(memoryCache, float64(stats.Memory.Cache))
+		add(memorySwap, float64(stats.Memory.Swap))
+		add(memoryFailcnt, float64(stats.Memory.Failcnt))
+	}
+	if cInfo.Spec.HasNetwork {
+		for _, iface := range stats.Network.Interfaces {
+			ifaceLabel := label{Name: labelInterface, Value: iface.Name}
+			add(networkRxBytes, float64(iface.RxBytes), ifaceLabel)
+			add(networkRxErrors, float64(iface.RxErrors), ifaceLabel)
+			add(networkTxBytes, float64(iface.TxBytes), ifaceLabel)
+			add(networkTxErrors, float64(iface.TxErrors), ifaceLabel)
+		}
+	}
+	if cInfo.Spec.HasFilesystem {
+		for _, fsStat := range stats.Filesystem {
+			deviceLabel := label{Name: labelDevice, Value: fsStat.Device}
+			add(fsUsage, float64(fsStat.Usage), deviceLabel)
+			add(fsLimit, float64(fsStat.Limit), deviceLabel)
+		}
+	}
+	return series
+}
+
+func (s *promRemoteWriteStorage) AddStats(cInfo *info.ContainerInfo, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+	var seriesToFlush []timeSeries
+	func() {
+		// AddStats will be invoked simultaneously from multiple threads and only one of them will perform a write.
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		s.series = append(s.series, s.statsToSeries(cInfo, stats)...)
+		if time.Since(s.lastWrite) >= s.bufferDuration {
+			seriesToFlush = s.series
+			s.series = nil
+			s.lastWrite = time.Now()
+		}
+	}()
+	return s.write(seriesToFlush)
+}
+
+// write sends the series in requests of at most maxSamplesPerSend samples,
+// each series having a single sample. A failed request doesn't prevent the
+// next ones from being sent, the number of failed requests and the last error
+// are reported.
+func (s *promRemoteWriteStorage) write(series []timeSeries) error {
+	var lastErr error
+	failed, requests := 0, 0
+	for len(series) > 0 {
+		n := len(series)
+		if n > s.maxSamplesPerSend {
+			n = s.maxSamplesPerSend
+		}
+		if err := s.send(newWriteRequest(series[:n])); err != nil {
+			lastErr = err
+			failed++
+		}
+		requests++
+		series = series[n:]
+	}
+	if lastErr != nil {
+		return fmt.Errorf("failed to write stats to %s in %d of %d requests: %v", s.url, failed, requests, lastErr)
+	}
+	return nil
+}
+
+// newWriteRequest returns a request of the series along with the metadata of
+// their metric families, so that counters and gauges are typed.
+func newWriteRequest(series []timeSeries) *writeRequest {
+	req := &writeRequest{Timeseries: series}
+	seen := map[string]bool{}
+	for _, ts := range series {
+		for _, l := range ts.Labels {
+			if l.Name != labelMetricName || seen[l.Value] {
+				continue
+			}
+			seen[l.Value] = true
+			req.Metadata = append(req.Metadata, metadataByFamilyName[l.Value])
+		}
+	}
+	return req
+}
+
+func (s *promRemoteWriteStorage) send(req *writeRequest) error {
+	data, err := req.Marshal()
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(snappy.Encode(nil, data)))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Encoding", "snappy")
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("User-Agent", s.userAgent)
+	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+	if s.username != "" {
+		httpReq.SetBasicAuth(s.username, s.password)
+	}
+	if s.bearerTokenFile != "" {
+		token, err := ioutil.ReadFile(s.bearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("unable to read bearer token: %v", err)
+		}
+		httpReq.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	// Drain the body so that the connection is reused.
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	return err
+}
+
+// Close sends the buffered series.
+func (s *promRemoteWriteStorage) Close() error {
+	s.lock.Lock()
+	series := s.series
+	s.series = nil
+	s.lock.Unlock()
+	return s.write(series)
+}
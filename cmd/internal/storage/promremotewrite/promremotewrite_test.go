@@ -0,0 +1,291 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promremotewrite
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// decodedSeries is a series with its labels as a map and its single sample.
+type decodedSeries struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+// protoFields returns the values of the fields of a protobuf message by field
+// number: the varints as uint64, the fixed64 as their bits and the
+// length-delimited fields as []byte.
+func protoFields(t *testing.T, b []byte) map[int][]interface{} {
+	fields := map[int][]interface{}{}
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		require.True(t, n > 0, "invalid tag")
+		b = b[n:]
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case wireVarint:
+			value, n := binary.Uvarint(b)
+			require.True(t, n > 0, "invalid varint")
+			fields[field] = append(fields[field], value)
+			b = b[n:]
+		case wireFixed64:
+			require.True(t, len(b) >= 8, "truncated fixed64")
+			fields[field] = append(fields[field], binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case wireBytes:
+			length, n := binary.Uvarint(b)
+			require.True(t, n > 0 && uint64(len(b)-n) >= length, "truncated field")
+			fields[field] = append(fields[field], b[n:n+int(length)])
+			b = b[n+int(length):]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+	}
+	return fields
+}
+
+// protoString returns the string field of a message, empty if it is missing.
+func protoString(fields map[int][]interface{}, field int) string {
+	if len(fields[field]) == 0 {
+		return ""
+	}
+	return string(fields[field][0].([]byte))
+}
+
+// protoUint64 returns the varint or fixed64 field of a message, 0 if it is
+// missing.
+func protoUint64(fields map[int][]interface{}, field int) uint64 {
+	if len(fields[field]) == 0 {
+		return 0
+	}
+	return fields[field][0].(uint64)
+}
+
+// decodeWriteRequest returns the series of a remote-write request and the types
+// of their metric families.
+func decodeWriteRequest(t *testing.T, b []byte) ([]decodedSeries, map[string]metricType) {
+	req := protoFields(t, b)
+	var series []decodedSeries
+	for _, ts := range req[1] {
+		tsFields := protoFields(t, ts.([]byte))
+		require.Len(t, tsFields[2], 1)
+		labels := map[string]string{}
+		for _, l := range tsFields[1] {
+			labelFields := protoFields(t, l.([]byte))
+			labels[protoString(labelFields, 1)] = protoString(labelFields, 2)
+		}
+		sampleFields := protoFields(t, tsFields[2][0].([]byte))
+		series = append(series, decodedSeries{
+			labels:    labels,
+			value:     math.Float64frombits(protoUint64(sampleFields, 1)),
+			timestamp: int64(protoUint64(sampleFields, 2)),
+		})
+	}
+	types := map[string]metricType{}
+	for _, m := range req[3] {
+		metadataFields := protoFields(t, m.([]byte))
+		types[protoString(metadataFields, 2)] = metricType(protoUint64(metadataFields, 1))
+	}
+	return series, types
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func newTestServer(t *testing.T, status int) (*httptest.Server, func() []receivedRequest) {
+	return newTestServerWithStatuses(t, func(int) int { return status })
+}
+
+// newTestServerWithStatuses returns a server answering each request with the
+// status returned for the number of requests it received before.
+func newTestServerWithStatuses(t *testing.T, status func(int) int) (*httptest.Server, func() []receivedRequest) {
+	var (
+		lock     sync.Mutex
+		requests []receivedRequest
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		compressed, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		body, err := snappy.Decode(nil, compressed)
+		assert.NoError(t, err)
+		lock.Lock()
+		n := len(requests)
+		requests = append(requests, receivedRequest{header: r.Header, body: body})
+		lock.Unlock()
+		w.WriteHeader(status(n))
+	}))
+	return server, func() []receivedRequest {
+		lock.Lock()
+		defer lock.Unlock()
+		return requests
+	}
+}
+
+func testContainerInfo() *info.ContainerInfo {
+	return &info.ContainerInfo{
+		ContainerReference: info.ContainerReference{
+			Name:      "/docker/abc",
+			Aliases:   []string{"web", "abc"},
+			Namespace: "docker",
+		},
+		Spec: info.ContainerSpec{
+			HasCpu:     true,
+			HasMemory:  true,
+			HasNetwork: true,
+			Image:      "nginx:1.21",
+		},
+	}
+}
+
+func testStats() *info.ContainerStats {
+	stats := &info.ContainerStats{Timestamp: time.Unix(1618309500, 250000000)}
+	stats.Cpu.Usage.Total = 2500000000
+	stats.Memory.Usage = 4096
+	stats.Network.Interfaces = []info.InterfaceStats{{Name: "eth0", RxBytes: 100, TxBytes: 200}}
+	return stats
+}
+
+func TestAddStats(t *testing.T) {
+	server, requests := newTestServer(t, http.StatusNoContent)
+	defer server.Close()
+
+	oldUsername, oldPassword := *argUsername, *argPassword
+	*argUsername, *argPassword = "cadvisor", "secret"
+	defer func() { *argUsername, *argPassword = oldUsername, oldPassword }()
+
+	s, err := newStorage("node1", server.URL, 2000, 0, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, s.AddStats(testContainerInfo(), testStats()))
+
+	received := requests()
+	require.Len(t, received, 1)
+	header := received[0].header
+	assert.Equal(t, "snappy", header.Get("Content-Encoding"))
+	assert.Equal(t, "application/x-protobuf", header.Get("Content-Type"))
+	assert.Equal(t, remoteWriteVersion, header.Get("X-Prometheus-Remote-Write-Version"))
+	username, password, ok := (&http.Request{Header: header}).BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "cadvisor", username)
+	assert.Equal(t, "secret", password)
+
+	series, types := decodeWriteRequest(t, received[0].body)
+	// 4 cpu, 7 memory and 4 network series.
+	assert.Len(t, series, 15)
+	byName := map[string]decodedSeries{}
+	for _, ts := range series {
+		byName[ts.labels[labelMetricName]] = ts
+	}
+	assert.Equal(t, decodedSeries{
+		labels: map[string]string{
+			"__name__":  "container_cpu_usage_seconds_total",
+			"id":        "/docker/abc",
+			"name":      "web",
+			"namespace": "docker",
+			"image":     "nginx:1.21",
+			"machine":   "node1",
+		},
+		value:     2.5,
+		timestamp: 1618309500250,
+	}, byName["container_cpu_usage_seconds_total"])
+	assert.Equal(t, 4096.0, byName["container_memory_usage_bytes"].value)
+	assert.Equal(t, "eth0", byName["container_network_transmit_bytes_total"].labels["interface"])
+	assert.Equal(t, 200.0, byName["container_network_transmit_bytes_total"].value)
+
+	assert.Len(t, types, 15)
+	assert.Equal(t, metricTypeCounter, types["container_cpu_usage_seconds_total"])
+	assert.Equal(t, metricTypeCounter, types["container_network_receive_bytes_total"])
+	assert.Equal(t, metricTypeCounter, types["container_memory_failcnt"])
+	assert.Equal(t, metricTypeGauge, types["container_memory_usage_bytes"])
+	assert.Equal(t, metricTypeGauge, types["container_cpu_load_average_10s"])
+}
+
+func TestAddStatsBatching(t *testing.T) {
+	server, requests := newTestServer(t, http.StatusOK)
+	defer server.Close()
+
+	s, err := newStorage("node1", server.URL, 4, time.Hour, time.Second)
+	require.NoError(t, err)
+	cInfo := testContainerInfo()
+	cInfo.Spec.HasMemory = false
+	cInfo.Spec.HasNetwork = false
+
+	// Buffered until closed.
+	require.NoError(t, s.AddStats(cInfo, testStats()))
+	require.NoError(t, s.AddStats(cInfo, testStats()))
+	assert.Empty(t, requests())
+
+	require.NoError(t, s.Close())
+	received := requests()
+	require.Len(t, received, 2)
+	for _, r := range received {
+		series, types := decodeWriteRequest(t, r.body)
+		assert.Len(t, series, 4)
+		assert.Len(t, types, 4)
+	}
+}
+
+func TestAddStatsError(t *testing.T) {
+	server, _ := newTestServer(t, http.StatusBadRequest)
+	defer server.Close()
+
+	s, err := newStorage("node1", server.URL, 2000, 0, time.Second)
+	require.NoError(t, err)
+	err = s.AddStats(testContainerInfo(), testStats())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprint(http.StatusBadRequest))
+}
+
+func TestWriteKeepsSendingAfterFailedBatch(t *testing.T) {
+	server, requests := newTestServerWithStatuses(t, func(n int) int {
+		if n == 0 {
+			return http.StatusInternalServerError
+		}
+		return http.StatusOK
+	})
+	defer server.Close()
+
+	s, err := newStorage("node1", server.URL, 4, time.Hour, time.Second)
+	require.NoError(t, err)
+	cInfo := testContainerInfo()
+	cInfo.Spec.HasMemory = false
+	cInfo.Spec.HasNetwork = false
+	require.NoError(t, s.AddStats(cInfo, testStats()))
+	require.NoError(t, s.AddStats(cInfo, testStats()))
+	require.NoError(t, s.AddStats(cInfo, testStats()))
+
+	err = s.Close()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 of 3 requests")
+	assert.Contains(t, err.Error(), fmt.Sprint(http.StatusInternalServerError))
+	// The batches after the failed one are still sent.
+	assert.Len(t, requests(), 3)
+}
@@ -0,0 +1,426 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stackdriver writes the container stats to Google Cloud Monitoring,
+// formerly Stackdriver, as custom metrics.
+package stackdriver
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"google.golang.org/api/googleapi"
+	monitoring "google.golang.org/api/monitoring/v3"
+	"google.golang.org/api/option"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+)
+
+func init() {
+	storage.RegisterStorageDriver("stackdriver", new)
+	storage.RegisterFixedUnitsDriver("stackdriver")
+}
+
+var (
+	argProjectID            = flag.String("storage_driver_stackdriver_project_id", "", "Google Cloud project to write the stats to. Defaults to the project of the instance when running on Google Cloud.")
+	argLocation             = flag.String("storage_driver_stackdriver_location", "", "Location of the monitored resources of the containers, e.g. the zone of the machine. Defaults to the zone of the instance when running on Google Cloud.")
+	argMaxRequestsPerSecond = flag.Float64("storage_driver_stackdriver_max_requests_per_second", 10, "Maximum number of requests per second to Cloud Monitoring, to stay within the quota of the project. Zero disables the limit.")
+	argTimeout              = flag.Duration("storage_driver_stackdriver_timeout", 30*time.Second, "Timeout of the requests to Cloud Monitoring")
+)
+
+const (
+	// Prefix of the types of the metrics.
+	metricTypePrefix = "custom.googleapis.com/cadvisor/"
+
+	// Type of the monitored resource of the containers.
+	resourceType = "generic_task"
+
+	// Maximum number of time series of a request to Cloud Monitoring.
+	maxTimeSeriesPerRequest = 200
+
+	// Cloud Monitoring rejects points written more often than this for a
+	// time series.
+	minWriteInterval = 5 * time.Second
+
+	// Number of retries of a rate limited request, the first one after
+	// initialRetryBackoff and then doubling.
+	maxRetries          = 3
+	initialRetryBackoff = time.Second
+)
+
+// Labels of the metrics.
+const (
+	labelMachine   = "machine"
+	labelInterface = "interface"
+	labelDevice    = "device"
+)
+
+type metricKind string
+
+const (
+	metricKindGauge      metricKind = "GAUGE"
+	metricKindCumulative metricKind = "CUMULATIVE"
+)
+
+type metricDescriptor struct {
+	name string
+	kind metricKind
+	unit string
+}
+
+var (
+	cpuUsageTotal    = metricDescriptor{"container/cpu/usage_time", metricKindCumulative, "s"}
+	cpuUsageUser     = metricDescriptor{"container/cpu/user_time", metricKindCumulative, "s"}
+	cpuUsageSystem   = metricDescriptor{"container/cpu/system_time", metricKindCumulative, "s"}
+	cpuLoadAverage   = metricDescriptor{"container/cpu/load_average", metricKindGauge, "1"}
+	memoryUsage      = metricDescriptor{"container/memory/usage", metricKindGauge, "By"}
+	memoryWorkingSet = metricDescriptor{"container/memory/working_set", metricKindGauge, "By"}
+	memoryRSS        = metricDescriptor{"container/memory/rss", metricKindGauge, "By"}
+	memoryCache      = metricDescriptor{"container/memory/cache", metricKindGauge, "By"}
+	memoryFailcnt    = metricDescriptor{"container/memory/failcnt", metricKindCumulative, "1"}
+	networkRxBytes   = metricDescriptor{"container/network/received_bytes_count", metricKindCumulative, "By"}
+	networkRxErrors  = metricDescriptor{"container/network/receive_errors_count", metricKindCumulative, "1"}
+	networkTxBytes   = metricDescriptor{"container/network/sent_bytes_count", metricKindCumulative, "By"}
+	networkTxErrors  = metricDescriptor{"container/network/transmit_errors_count", metricKindCumulative, "1"}
+	fsUsage          = metricDescriptor{"container/filesystem/usage", metricKindGauge, "By"}
+	fsLimit          = metricDescriptor{"container/filesystem/limit", metricKindGauge, "By"}
+)
+
+// metricClient writes time series to Cloud Monitoring.
+type metricClient interface {
+	CreateTimeSeries(ctx context.Context, project string, series []*monitoring.TimeSeries) error
+}
+
+type serviceClient struct {
+	service *monitoring.Service
+}
+
+func (c *serviceClient) CreateTimeSeries(ctx context.Context, project string, series []*monitoring.TimeSeries) error {
+	req := &monitoring.CreateTimeSeriesRequest{TimeSeries: series}
+	_, err := c.service.Projects.TimeSeries.Create("projects/"+project, req).Context(ctx).Do()
+	return err
+}
+
+type stackdriverStorage struct {
+	client             metricClient
+	projectID          string
+	location           string
+	machineName        string
+	bufferDuration     time.Duration
+	timeout            time.Duration
+	minRequestInterval time.Duration
+	// Replaced in tests.
+	sleep func(time.Duration)
+
+	lock      sync.Mutex
+	lastWrite time.Time
+	// Buffered series, holding a single point each, and their index by key.
+	// A series added again replaces its buffered point, as a request can't
+	// hold several points of a series.
+	series      []*monitoring.TimeSeries
+	seriesIndex map[string]int
+
+	// Serializes the writes, which are paced by minRequestInterval.
+	writeLock   sync.Mutex
+	nextRequest time.Time
+}
+
+func new() (storage.StorageDriver, error) {
+	projectID, location := *argProjectID, *argLocation
+	if metadata.OnGCE() {
+		var err error
+		if projectID == "" {
+			if projectID, err = metadata.ProjectID(); err != nil {
+				return nil, fmt.Errorf("unable to get the project of the instance: %v", err)
+			}
+		}
+		if location == "" {
+			if location, err = metadata.Zone(); err != nil {
+				return nil, fmt.Errorf("unable to get the zone of the instance: %v", err)
+			}
+		}
+	}
+	if projectID == "" {
+		return nil, fmt.Errorf("--storage_driver_stackdriver_project_id is required by the stackdriver storage driver outside of Google Cloud")
+	}
+	if location == "" {
+		return nil, fmt.Errorf("--storage_driver_stackdriver_location is required by the stackdriver storage driver outside of Google Cloud")
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	// The credentials are the application default ones, e.g. those of the
+	// service account of the instance.
+	service, err := monitoring.NewService(context.Background(), option.WithScopes(monitoring.MonitoringWriteScope))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the Cloud Monitoring client: %v", err)
+	}
+	return newStorage(&serviceClient{service}, projectID, location, hostname, *storage.ArgDbBufferDuration, *argTimeout, *argMaxRequestsPerSecond)
+}
+
+func newStorage(client metricClient, projectID, location, machineName string, bufferDuration, timeout time.Duration, maxRequestsPerSecond float64) (*stackdriverStorage, error) {
+	if bufferDuration < minWriteInterval {
+		return nil, fmt.Errorf("the buffer duration %v is shorter than %v, the minimum interval between the points of a time series in Cloud Monitoring", bufferDuration, minWriteInterval)
+	}
+	if maxRequestsPerSecond < 0 {
+		return nil, fmt.Errorf("invalid maximum number of requests per second %v", maxRequestsPerSecond)
+	}
+	var minRequestInterval time.Duration
+	if maxRequestsPerSecond > 0 {
+		minRequestInterval = time.Duration(float64(time.Second) / maxRequestsPerSecond)
+	}
+	return &stackdriverStorage{
+		client:             client,
+		projectID:          projectID,
+		location:           location,
+		machineName:        machineName,
+		bufferDuration:     bufferDuration,
+		timeout:            timeout,
+		minRequestInterval: minRequestInterval,
+		sleep:              time.Sleep,
+		lastWrite:          time.Now(),
+		seriesIndex:        map[string]int{},
+	}, nil
+}
+
+// monitoredResource returns the resource of the container: a task, named
+// after the container, of a job, named after its first alias, running on the
+// machine.
+func (s *stackdriverStorage) monitoredResource(ref *info.ContainerReference) *monitoring.MonitoredResource {
+	job := ref.Name
+	if len(ref.Aliases) > 0 {
+		job = ref.Aliases[0]
+	}
+	return &monitoring.MonitoredResource{
+		Type: resourceType,
+		Labels: map[string]string{
+			"project_id": s.projectID,
+			"location":   s.location,
+			"namespace":  s.machineName,
+			"job":        job,
+			"task_id":    ref.Name,
+		},
+	}
+}
+
+// statsToSeries returns a time series with a single point for each metric of
+// the stats.
+func (s *stackdriverStorage) statsToSeries(cInfo *info.ContainerInfo, stats *info.ContainerStats) []*monitoring.TimeSeries {
+	resource := s.monitoredResource(&cInfo.ContainerReference)
+	endTime := stats.Timestamp.UTC().Format(time.RFC3339Nano)
+	// The cumulative metrics count from the creation of the container, and
+	// Cloud Monitoring requires their start time to precede their end time.
+	start := cInfo.Spec.CreationTime
+	if !start.Before(stats.Timestamp) {
+		start = stats.Timestamp.Add(-time.Millisecond)
+	}
+	startTime := start.UTC().Format(time.RFC3339Nano)
+
+	var series []*monitoring.TimeSeries
+	add := func(m metricDescriptor, value *monitoring.TypedValue, extraLabels ...string) {
+		labels := map[string]string{labelMachine: s.machineName}
+		for i := 0; i+1 < len(extraLabels); i += 2 {
+			labels[extraLabels[i]] = extraLabels[i+1]
+		}
+		interval := &monitoring.TimeInterval{EndTime: endTime}
+		if m.kind == metricKindCumulative {
+			interval.StartTime = startTime
+		}
+		valueType := "DOUBLE"
+		if value.Int64Value != nil {
+			valueType = "INT64"
+		}
+		series = append(series, &monitoring.TimeSeries{
+			Metric:     &monitoring.Metric{Type: metricTypePrefix + m.name, Labels: labels},
+			Resource:   resource,
+			MetricKind: string(m.kind),
+			ValueType:  valueType,
+			Unit:       m.unit,
+			Points:     []*monitoring.Point{{Interval: interval, Value: value}},
+		})
+	}
+	seconds := func(ns uint64) *monitoring.TypedValue {
+		v := float64(ns) / float64(time.Second)
+		return &monitoring.TypedValue{DoubleValue: &v}
+	}
+	double := func(v float64) *monitoring.TypedValue {
+		return &monitoring.TypedValue{DoubleValue: &v}
+	}
+	int64Value := func(v uint64) *monitoring.TypedValue {
+		i := int64(v)
+		return &monitoring.TypedValue{Int64Value: &i}
+	}
+
+	if cInfo.Spec.HasCpu {
+		add(cpuUsageTotal, seconds(stats.Cpu.Usage.Total))
+		add(cpuUsageUser, seconds(stats.Cpu.Usage.User))
+		add(cpuUsageSystem, seconds(stats.Cpu.Usage.System))
+		add(cpuLoadAverage, double(float64(stats.Cpu.LoadAverage)))
+	}
+	if cInfo.Spec.HasMemory {
+		add(memoryUsage, int64Value(stats.Memory.Usage))
+		add(memoryWorkingSet, int64Value(stats.Memory.WorkingSet))
+		add(memoryRSS, int64Value(stats.Memory.RSS))
+		add(memoryCache, int64Value(stats.Memory.Cache))
+		add(memoryFailcnt, int64Value(stats.Memory.Failcnt))
+	}
+	if cInfo.Spec.HasNetwork {
+		for _, iface := range stats.Network.Interfaces {
+			add(networkRxBytes, int64Value(iface.RxBytes), labelInterface, iface.Name)
+			add(networkRxErrors, int64Value(iface.RxErrors), labelInterface, iface.Name)
+			add(networkTxBytes, int64Value(iface.TxBytes), labelInterface, iface.Name)
+			add(networkTxErrors, int64Value(iface.TxErrors), labelInterface, iface.Name)
+		}
+	}
+	if cInfo.Spec.HasFilesystem {
+		for _, fsStat := range stats.Filesystem {
+			add(fsUsage, int64Value(fsStat.Usage), labelDevice, fsStat.Device)
+			add(fsLimit, int64Value(fsStat.Limit), labelDevice, fsStat.Device)
+		}
+	}
+	return series
+}
+
+// seriesKey returns a key identifying the time series, i.e. its metric and
+// resource along with their labels.
+func seriesKey(ts *monitoring.TimeSeries) string {
+	var b strings.Builder
+	b.WriteString(ts.Metric.Type)
+	writeLabels := func(labels map[string]string) {
+		names := make([]string, 0, len(labels))
+		for name := range labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&b, "\x00%s=%s", name, labels[name])
+		}
+	}
+	writeLabels(ts.Metric.Labels)
+	b.WriteString("\x00\x00")
+	writeLabels(ts.Resource.Labels)
+	return b.String()
+}
+
+func (s *stackdriverStorage) AddStats(cInfo *info.ContainerInfo, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+	var seriesToFlush []*monitoring.TimeSeries
+	func() {
+		// AddStats will be invoked simultaneously from multiple threads and only one of them will perform a write.
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		for _, ts := range s.statsToSeries(cInfo, stats) {
+			key := seriesKey(ts)
+			if i, ok := s.seriesIndex[key]; ok {
+				s.series[i] = ts
+				continue
+			}
+			s.seriesIndex[key] = len(s.series)
+			s.series = append(s.series, ts)
+		}
+		if time.Since(s.lastWrite) >= s.bufferDuration {
+			seriesToFlush = s.takeSeries()
+			s.lastWrite = time.Now()
+		}
+	}()
+	return s.write(seriesToFlush)
+}
+
+// takeSeries returns the buffered series and empties the buffer. It must be
+// called with the lock held.
+func (s *stackdriverStorage) takeSeries() []*monitoring.TimeSeries {
+	series := s.series
+	s.series = nil
+	s.seriesIndex = map[string]int{}
+	return series
+}
+
+// write sends the series in requests of at most maxTimeSeriesPerRequest
+// series.
+func (s *stackdriverStorage) write(series []*monitoring.TimeSeries) error {
+	if len(series) == 0 {
+		return nil
+	}
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	for len(series) > 0 {
+		n := len(series)
+		if n > maxTimeSeriesPerRequest {
+			n = maxTimeSeriesPerRequest
+		}
+		if err := s.send(series[:n]); err != nil {
+			return fmt.Errorf("failed to write stats to Cloud Monitoring: %v", err)
+		}
+		series = series[n:]
+	}
+	return nil
+}
+
+// send writes the series in a single request, retrying it with an exponential
+// backoff while it is rate limited. It must be called with the writeLock held.
+func (s *stackdriverStorage) send(series []*monitoring.TimeSeries) error {
+	backoff := initialRetryBackoff
+	for retry := 0; ; retry++ {
+		s.waitForRequest()
+		err := func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+			defer cancel()
+			return s.client.CreateTimeSeries(ctx, s.projectID, series)
+		}()
+		if err == nil || !isRateLimited(err) || retry == maxRetries {
+			return err
+		}
+		s.sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// waitForRequest waits until minRequestInterval elapsed since the previous
+// request.
+func (s *stackdriverStorage) waitForRequest() {
+	if s.minRequestInterval == 0 {
+		return
+	}
+	if wait := time.Until(s.nextRequest); wait > 0 {
+		s.sleep(wait)
+	}
+	s.nextRequest = time.Now().Add(s.minRequestInterval)
+}
+
+func isRateLimited(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusTooManyRequests
+}
+
+// Close sends the buffered series.
+func (s *stackdriverStorage) Close() error {
+	s.lock.Lock()
+	series := s.takeSeries()
+	s.lock.Unlock()
+	return s.write(series)
+}
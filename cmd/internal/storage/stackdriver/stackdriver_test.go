@@ -0,0 +1,232 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+	monitoring "google.golang.org/api/monitoring/v3"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// mockClient records the requests and fails the first ones with errs.
+type mockClient struct {
+	lock     sync.Mutex
+	projects []string
+	requests [][]*monitoring.TimeSeries
+	errs     []error
+}
+
+func (c *mockClient) CreateTimeSeries(ctx context.Context, project string, series []*monitoring.TimeSeries) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.projects = append(c.projects, project)
+	c.requests = append(c.requests, series)
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func newTestStorage(t *testing.T, client metricClient) (*stackdriverStorage, *[]time.Duration) {
+	s, err := newStorage(client, "my-project", "us-central1-a", "machine-1", time.Minute, time.Second, 0)
+	require.NoError(t, err)
+	var sleeps []time.Duration
+	s.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	return s, &sleeps
+}
+
+func testContainerInfo() *info.ContainerInfo {
+	return &info.ContainerInfo{
+		ContainerReference: info.ContainerReference{
+			Name:      "/docker/abcd",
+			Aliases:   []string{"web", "abcd"},
+			Namespace: "docker",
+		},
+		Spec: info.ContainerSpec{
+			CreationTime: time.Unix(1000, 0),
+			HasCpu:       true,
+			HasMemory:    true,
+			HasNetwork:   true,
+		},
+	}
+}
+
+func testStats(timestamp time.Time) *info.ContainerStats {
+	stats := &info.ContainerStats{Timestamp: timestamp}
+	stats.Cpu.Usage.Total = 2500000000
+	stats.Cpu.Usage.User = 2000000000
+	stats.Cpu.Usage.System = 500000000
+	stats.Memory.Usage = 4096
+	stats.Memory.WorkingSet = 2048
+	stats.Network.Interfaces = []info.InterfaceStats{{Name: "eth0", RxBytes: 100, TxBytes: 200}}
+	return stats
+}
+
+func findSeries(series []*monitoring.TimeSeries, metricType string) *monitoring.TimeSeries {
+	for _, ts := range series {
+		if ts.Metric.Type == metricType {
+			return ts
+		}
+	}
+	return nil
+}
+
+func TestStatsToSeries(t *testing.T) {
+	s, _ := newTestStorage(t, &mockClient{})
+	timestamp := time.Unix(2000, 500)
+	series := s.statsToSeries(testContainerInfo(), testStats(timestamp))
+	// 4 cpu, 5 memory and 4 network metrics.
+	assert.Len(t, series, 13)
+
+	expectedResource := &monitoring.MonitoredResource{
+		Type: "generic_task",
+		Labels: map[string]string{
+			"project_id": "my-project",
+			"location":   "us-central1-a",
+			"namespace":  "machine-1",
+			"job":        "web",
+			"task_id":    "/docker/abcd",
+		},
+	}
+	for _, ts := range series {
+		assert.Equal(t, expectedResource, ts.Resource)
+		assert.Equal(t, "machine-1", ts.Metric.Labels["machine"])
+		require.Len(t, ts.Points, 1)
+	}
+
+	cpu := findSeries(series, "custom.googleapis.com/cadvisor/container/cpu/usage_time")
+	require.NotNil(t, cpu)
+	assert.Equal(t, "CUMULATIVE", cpu.MetricKind)
+	assert.Equal(t, "DOUBLE", cpu.ValueType)
+	assert.Equal(t, "s", cpu.Unit)
+	assert.Equal(t, 2.5, *cpu.Points[0].Value.DoubleValue)
+	assert.Equal(t, &monitoring.TimeInterval{
+		StartTime: "1970-01-01T00:16:40Z",
+		EndTime:   "1970-01-01T00:33:20.0000005Z",
+	}, cpu.Points[0].Interval)
+
+	memory := findSeries(series, "custom.googleapis.com/cadvisor/container/memory/working_set")
+	require.NotNil(t, memory)
+	assert.Equal(t, "GAUGE", memory.MetricKind)
+	assert.Equal(t, "INT64", memory.ValueType)
+	assert.EqualValues(t, 2048, *memory.Points[0].Value.Int64Value)
+	assert.Equal(t, &monitoring.TimeInterval{EndTime: "1970-01-01T00:33:20.0000005Z"}, memory.Points[0].Interval)
+
+	rx := findSeries(series, "custom.googleapis.com/cadvisor/container/network/received_bytes_count")
+	require.NotNil(t, rx)
+	assert.Equal(t, map[string]string{"machine": "machine-1", "interface": "eth0"}, rx.Metric.Labels)
+	assert.EqualValues(t, 100, *rx.Points[0].Value.Int64Value)
+}
+
+func TestStatsToSeriesStartTime(t *testing.T) {
+	s, _ := newTestStorage(t, &mockClient{})
+	cInfo := testContainerInfo()
+	// The start time of cumulative points must precede their end time, even
+	// for stats collected as the container was created.
+	cInfo.Spec.CreationTime = time.Unix(2000, 0)
+	series := s.statsToSeries(cInfo, testStats(time.Unix(2000, 0)))
+	cpu := findSeries(series, "custom.googleapis.com/cadvisor/container/cpu/usage_time")
+	require.NotNil(t, cpu)
+	assert.Equal(t, "1970-01-01T00:33:19.999Z", cpu.Points[0].Interval.StartTime)
+}
+
+func TestAddStatsBatchesRequests(t *testing.T) {
+	client := &mockClient{}
+	s, _ := newTestStorage(t, client)
+
+	// 13 series per container, written in requests of at most 200 series.
+	for i := 0; i < 20; i++ {
+		cInfo := testContainerInfo()
+		cInfo.Name = fmt.Sprintf("/docker/%d", i)
+		require.NoError(t, s.AddStats(cInfo, testStats(time.Unix(2000, 0))))
+	}
+	// A series added again replaces its buffered point.
+	require.NoError(t, s.AddStats(testContainerInfo(), testStats(time.Unix(2010, 0))))
+	require.NoError(t, s.AddStats(testContainerInfo(), testStats(time.Unix(2020, 0))))
+	assert.Empty(t, client.requests)
+
+	require.NoError(t, s.Close())
+	require.Len(t, client.requests, 2)
+	assert.Len(t, client.requests[0], 200)
+	assert.Len(t, client.requests[1], 21*13-200)
+	assert.Equal(t, []string{"my-project", "my-project"}, client.projects)
+	last := client.requests[1][len(client.requests[1])-1]
+	assert.Equal(t, "/docker/abcd", last.Resource.Labels["task_id"])
+	assert.Equal(t, "1970-01-01T00:33:40Z", last.Points[0].Interval.EndTime)
+
+	// Nothing is left to write.
+	require.NoError(t, s.Close())
+	assert.Len(t, client.requests, 2)
+}
+
+func TestWriteRetriesRateLimitedRequests(t *testing.T) {
+	rateLimited := &googleapi.Error{Code: http.StatusTooManyRequests, Message: "Quota exceeded"}
+	client := &mockClient{errs: []error{rateLimited, rateLimited}}
+	s, sleeps := newTestStorage(t, client)
+	series := s.statsToSeries(testContainerInfo(), testStats(time.Unix(2000, 0)))
+
+	require.NoError(t, s.write(series))
+	assert.Len(t, client.requests, 3)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, *sleeps)
+
+	// The request is dropped once the retries are exhausted.
+	client.errs = []error{rateLimited, rateLimited, rateLimited, rateLimited}
+	assert.Error(t, s.write(series))
+	assert.Len(t, client.requests, 3+maxRetries+1)
+
+	// Other errors are not retried.
+	client.errs = []error{&googleapi.Error{Code: http.StatusBadRequest}}
+	assert.Error(t, s.write(series))
+	assert.Len(t, client.requests, 3+maxRetries+2)
+}
+
+func TestWritePacesRequests(t *testing.T) {
+	client := &mockClient{}
+	s, err := newStorage(client, "my-project", "us-central1-a", "machine-1", time.Minute, time.Second, 1)
+	require.NoError(t, err)
+	var sleeps []time.Duration
+	s.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+	series := make([]*monitoring.TimeSeries, 0, 3*maxTimeSeriesPerRequest)
+	for len(series) < 3*maxTimeSeriesPerRequest {
+		series = append(series, s.statsToSeries(testContainerInfo(), testStats(time.Unix(2000, 0)))...)
+	}
+	require.NoError(t, s.write(series[:3*maxTimeSeriesPerRequest]))
+	assert.Len(t, client.requests, 3)
+	// The second and third requests waited for about a second.
+	require.Len(t, sleeps, 2)
+	for _, d := range sleeps {
+		assert.InDelta(t, float64(time.Second), float64(d), float64(100*time.Millisecond))
+	}
+}
+
+func TestNewStorageValidation(t *testing.T) {
+	_, err := newStorage(&mockClient{}, "my-project", "us-central1-a", "machine-1", time.Second, time.Second, 0)
+	assert.Error(t, err)
+	_, err = newStorage(&mockClient{}, "my-project", "us-central1-a", "machine-1", time.Minute, time.Second, -1)
+	assert.Error(t, err)
+}
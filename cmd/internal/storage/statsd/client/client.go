@@ -15,16 +15,29 @@
 package client
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strings"
 
 	"k8s.io/klog/v2"
 )
 
+// DefaultMaxPacketSize is the size of the largest UDP payload which is not
+// fragmented on a network with an MTU of 1500 bytes, leaving room for the IP
+// options.
+const DefaultMaxPacketSize = 1432
+
+// ErrLineTooLong is returned when a metric line doesn't fit in a packet.
+var ErrLineTooLong = errors.New("metric line longer than the maximum packet size")
+
 type Client struct {
 	HostPort  string
 	Namespace string
-	conn      net.Conn
+	// Maximum size of the packets the metrics are batched into.
+	MaxPacketSize int
+	conn          net.Conn
 }
 
 func (c *Client) Open() error {
@@ -46,16 +59,60 @@ func (c *Client) Close() error {
 // Simple send to statsd daemon without sampling.
 func (c *Client) Send(namespace, containerName, key string, value uint64) error {
 	// only send counter value
-	formatted := fmt.Sprintf("%s.%s.%s:%d|g", namespace, containerName, key, value)
-	_, err := fmt.Fprintf(c.conn, formatted)
-	if err != nil {
-		return fmt.Errorf("failed to send data %q: %v", formatted, err)
+	return c.write(fmt.Sprintf("%s.%s.%s:%d|g", namespace, containerName, key, value))
+}
+
+func (c *Client) write(packet string) error {
+	if _, err := io.WriteString(c.conn, packet); err != nil {
+		return fmt.Errorf("failed to send data %q: %v", packet, err)
+	}
+	return nil
+}
+
+// NewBatch returns an empty batch of metric lines to send. Batches are not
+// safe for concurrent use, but several batches of the same client may be
+// used concurrently.
+func (c *Client) NewBatch() *Batch {
+	return &Batch{client: c}
+}
+
+// Batch batches metric lines into packets of at most MaxPacketSize bytes.
+// Lines are separated by newlines in a packet.
+type Batch struct {
+	client *Client
+	buf    strings.Builder
+}
+
+// Add adds a metric line to the current packet, sending the packet first if
+// the line doesn't fit in it. A line longer than MaxPacketSize can't be split
+// into valid metric lines, it is not sent and ErrLineTooLong is returned.
+func (b *Batch) Add(line string) error {
+	if len(line) > b.client.MaxPacketSize {
+		return ErrLineTooLong
+	}
+	if b.buf.Len() > 0 && b.buf.Len()+1+len(line) > b.client.MaxPacketSize {
+		if err := b.Flush(); err != nil {
+			return err
+		}
 	}
+	if b.buf.Len() > 0 {
+		b.buf.WriteByte('\n')
+	}
+	b.buf.WriteString(line)
 	return nil
 }
 
+// Flush sends the current packet, if any.
+func (b *Batch) Flush() error {
+	if b.buf.Len() == 0 {
+		return nil
+	}
+	defer b.buf.Reset()
+	return b.client.write(b.buf.String())
+}
+
 func New(hostPort string) (*Client, error) {
-	Client := Client{HostPort: hostPort}
+	Client := Client{HostPort: hostPort, MaxPacketSize: DefaultMaxPacketSize}
 	if err := Client.Open(); err != nil {
 		return nil, err
 	}
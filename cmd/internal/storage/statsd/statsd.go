@@ -15,20 +15,40 @@
 package statsd
 
 import (
+	"flag"
+	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
 	client "github.com/google/cadvisor/cmd/internal/storage/statsd/client"
 	info "github.com/google/cadvisor/info/v1"
 	"github.com/google/cadvisor/storage"
 )
 
+var (
+	argTagFormat     = flag.String("storage_driver_statsd_tag_format", "", "Format of the tags identifying the container in the metrics sent to statsd. Empty means the container name is part of the metric name. Options are: <empty>, dogstatsd, influxdb")
+	argMaxPacketSize = flag.Int("storage_driver_statsd_max_packet_size", client.DefaultMaxPacketSize, "Maximum size in bytes of the UDP packets the metrics are batched into")
+)
+
+const (
+	// Tags appended to the metric as |#name:value,...
+	tagFormatDogStatsD = "dogstatsd"
+	// Tags appended to the metric name as ,name=value,... as done by telegraf.
+	tagFormatInfluxDB = "influxdb"
+)
+
 func init() {
 	storage.RegisterStorageDriver("statsd", new)
+	storage.RegisterFixedUnitsDriver("statsd")
 }
 
 type statsdStorage struct {
 	client    *client.Client
 	Namespace string
+	// Format of the container tags, empty if the container name is part of
+	// the metric name.
+	tagFormat string
 }
 
 const (
@@ -94,7 +114,72 @@ const (
 )
 
 func new() (storage.StorageDriver, error) {
-	return newStorage(*storage.ArgDbName, *storage.ArgDbHost)
+	switch *argTagFormat {
+	case "", tagFormatDogStatsD, tagFormatInfluxDB:
+	default:
+		return nil, fmt.Errorf("unknown statsd tag format %q", *argTagFormat)
+	}
+	s, err := newStorage(*storage.ArgDbName, *storage.ArgDbHost)
+	if err != nil {
+		return nil, err
+	}
+	s.tagFormat = *argTagFormat
+	s.client.MaxPacketSize = *argMaxPacketSize
+	return s, nil
+}
+
+type tag struct {
+	name, value string
+}
+
+// containerTags returns the tags identifying the container of the reference.
+func containerTags(ref info.ContainerReference) []tag {
+	name := ref.Name
+	if len(ref.Aliases) > 0 {
+		name = ref.Aliases[0]
+	}
+	tags := []tag{{"name", name}, {"id", ref.Name}}
+	if ref.Namespace != "" {
+		tags = append(tags, tag{"namespace", ref.Namespace})
+	}
+	return tags
+}
+
+// formatLine returns the statsd gauge line of the value, with the tags in the
+// given format.
+func formatLine(tagFormat, metric string, value uint64, tags []tag) string {
+	var b strings.Builder
+	b.WriteString(metric)
+	if tagFormat == tagFormatInfluxDB {
+		for _, t := range tags {
+			fmt.Fprintf(&b, ",%s=%s", t.name, escapeInfluxDBTag(t.value))
+		}
+	}
+	fmt.Fprintf(&b, ":%d|g", value)
+	if tagFormat == tagFormatDogStatsD {
+		for i, t := range tags {
+			if i == 0 {
+				b.WriteString("|#")
+			} else {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, "%s:%s", t.name, escapeDogStatsDTag(t.value))
+		}
+	}
+	return b.String()
+}
+
+// The separators of the DogStatsD lines can't be escaped, they are replaced.
+var dogStatsDTagReplacer = strings.NewReplacer(",", "_", "|", "_", "\n", "_")
+
+func escapeDogStatsDTag(value string) string {
+	return dogStatsDTagReplacer.Replace(value)
+}
+
+var influxDBTagReplacer = strings.NewReplacer(",", "\\,", "=", "\\=", " ", "\\ ", ":", "_", "|", "_", "\n", "_")
+
+func escapeInfluxDBTag(value string) string {
+	return influxDBTagReplacer.Replace(value)
 }
 
 func (s *statsdStorage) containerStatsToValues(stats *info.ContainerStats) (series map[string]uint64) {
@@ -208,19 +293,42 @@ func (s *statsdStorage) AddStats(cInfo *info.ContainerInfo, stats *info.Containe
 	s.resctrlStatsToValues(&series, stats)
 
 	var containerName string
-	if len(cInfo.ContainerReference.Aliases) > 0 {
+	var tags []tag
+	if s.tagFormat != "" {
+		tags = containerTags(cInfo.ContainerReference)
+	} else if len(cInfo.ContainerReference.Aliases) > 0 {
 		containerName = cInfo.ContainerReference.Aliases[0]
 	} else {
 		containerName = cInfo.ContainerReference.Name
 	}
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
-	for key, value := range series {
-		err := s.client.Send(s.Namespace, containerName, key, value)
-		if err != nil {
+	// Each call has its own batch, AddStats is called concurrently for
+	// different containers.
+	batch := s.client.NewBatch()
+	var lineErr error
+	for _, key := range keys {
+		var line string
+		if s.tagFormat != "" {
+			line = formatLine(s.tagFormat, s.Namespace+"."+key, series[key], tags)
+		} else {
+			line = fmt.Sprintf("%s.%s.%s:%d|g", s.Namespace, containerName, key, series[key])
+		}
+		if err := batch.Add(line); err == client.ErrLineTooLong {
+			// Keep sending the other lines.
+			lineErr = fmt.Errorf("failed to send metric %q: %v", line, err)
+		} else if err != nil {
 			return err
 		}
 	}
-	return nil
+	if err := batch.Flush(); err != nil {
+		return err
+	}
+	return lineErr
 }
 
 func (s *statsdStorage) Close() error {
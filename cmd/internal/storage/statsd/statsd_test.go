@@ -0,0 +1,218 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listen returns a fake statsd server and a function returning the lines of
+// the packets it received, failing if no packet is received.
+func listen(t *testing.T) (net.PacketConn, func() [][]string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	receive := func() [][]string {
+		var packets [][]string
+		buf := make([]byte, 65536)
+		deadline := time.Now().Add(time.Second)
+		for {
+			require.NoError(t, conn.SetReadDeadline(deadline))
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+			packets = append(packets, strings.Split(string(buf[:n]), "\n"))
+			// Don't wait for more packets once some have been received.
+			deadline = time.Now().Add(100 * time.Millisecond)
+		}
+		require.NotEmpty(t, packets)
+		return packets
+	}
+	return conn, receive
+}
+
+func testContainerInfo() (*info.ContainerInfo, *info.ContainerStats) {
+	cInfo := &info.ContainerInfo{
+		ContainerReference: info.ContainerReference{
+			Name:      "/docker/abc",
+			Aliases:   []string{"web", "abc"},
+			Namespace: "docker",
+		},
+	}
+	stats := &info.ContainerStats{}
+	stats.Cpu.Usage.Total = 100
+	stats.Memory.Usage = 2048
+	stats.Network.RxBytes = 10
+	return cInfo, stats
+}
+
+func lineFor(lines []string, prefix string) string {
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+	return ""
+}
+
+func TestAddStatsTagFormats(t *testing.T) {
+	for _, tc := range []struct {
+		tagFormat string
+		expected  []string
+	}{
+		{
+			tagFormat: "",
+			expected: []string{
+				"cadvisor.web.cpu_usage_total:100|g",
+				"cadvisor.web.memory_usage:2048|g",
+				"cadvisor.web.rx_bytes:10|g",
+			},
+		},
+		{
+			tagFormat: tagFormatDogStatsD,
+			expected: []string{
+				"cadvisor.cpu_usage_total:100|g|#name:web,id:/docker/abc,namespace:docker",
+				"cadvisor.memory_usage:2048|g|#name:web,id:/docker/abc,namespace:docker",
+				"cadvisor.rx_bytes:10|g|#name:web,id:/docker/abc,namespace:docker",
+			},
+		},
+		{
+			tagFormat: tagFormatInfluxDB,
+			expected: []string{
+				"cadvisor.cpu_usage_total,name=web,id=/docker/abc,namespace=docker:100|g",
+				"cadvisor.memory_usage,name=web,id=/docker/abc,namespace=docker:2048|g",
+				"cadvisor.rx_bytes,name=web,id=/docker/abc,namespace=docker:10|g",
+			},
+		},
+	} {
+		t.Run(tc.tagFormat, func(t *testing.T) {
+			conn, receive := listen(t)
+			defer conn.Close()
+
+			s, err := newStorage("cadvisor", conn.LocalAddr().String())
+			require.NoError(t, err)
+			defer s.Close()
+			s.tagFormat = tc.tagFormat
+
+			cInfo, stats := testContainerInfo()
+			require.NoError(t, s.AddStats(cInfo, stats))
+
+			var lines []string
+			for _, packet := range receive() {
+				lines = append(lines, packet...)
+			}
+			for _, expected := range tc.expected {
+				// The metric name up to its tags or value.
+				prefix := expected[:strings.IndexAny(expected, ",:")+1]
+				assert.Equal(t, expected, lineFor(lines, prefix))
+			}
+		})
+	}
+}
+
+func TestAddStatsBatchesPackets(t *testing.T) {
+	conn, receive := listen(t)
+	defer conn.Close()
+
+	s, err := newStorage("cadvisor", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer s.Close()
+	s.tagFormat = tagFormatDogStatsD
+	s.client.MaxPacketSize = 256
+
+	cInfo, stats := testContainerInfo()
+	require.NoError(t, s.AddStats(cInfo, stats))
+
+	packets := receive()
+	assert.True(t, len(packets) > 1, "expected the metrics to be split in several packets")
+	var lines []string
+	for _, packet := range packets {
+		assert.True(t, len(strings.Join(packet, "\n")) <= 256)
+		lines = append(lines, packet...)
+	}
+	sorted := append([]string(nil), lines...)
+	sort.Strings(sorted)
+	assert.Equal(t, sorted, lines, "expected the metrics to be sent in order")
+	series := s.containerStatsToValues(stats)
+	s.memoryStatsToValues(&series, stats)
+	assert.Len(t, lines, len(series))
+}
+
+func TestAddStatsConcurrently(t *testing.T) {
+	conn, receive := listen(t)
+	defer conn.Close()
+
+	s, err := newStorage("cadvisor", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer s.Close()
+	s.tagFormat = tagFormatDogStatsD
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b", "c", "d"} {
+		cInfo, stats := testContainerInfo()
+		cInfo.Name = "/docker/" + name
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, s.AddStats(cInfo, stats))
+		}()
+	}
+	wg.Wait()
+
+	// The lines of different containers are never mixed in a packet.
+	for _, packet := range receive() {
+		id := packet[0][strings.Index(packet[0], "id:"):]
+		for _, line := range packet {
+			assert.True(t, strings.HasSuffix(line, id), "line %q in the packet of %q", line, id)
+		}
+	}
+}
+
+func TestAddStatsLineLongerThanPacket(t *testing.T) {
+	conn, receive := listen(t)
+	defer conn.Close()
+
+	s, err := newStorage("cadvisor", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer s.Close()
+	s.client.MaxPacketSize = 32
+
+	cInfo, stats := testContainerInfo()
+	assert.Error(t, s.AddStats(cInfo, stats))
+
+	// The lines which fit are still sent.
+	var lines []string
+	for _, packet := range receive() {
+		lines = append(lines, packet...)
+	}
+	assert.Equal(t, "cadvisor.web.rx_bytes:10|g", lineFor(lines, "cadvisor.web.rx_bytes:"))
+	assert.Equal(t, "", lineFor(lines, "cadvisor.web.cpu_cumulative_usage:"))
+}
+
+func TestFormatLineEscapesTags(t *testing.T) {
+	tags := []tag{{"name", "a,b|c d=e"}}
+	assert.Equal(t, "m:1|g|#name:a_b_c d=e", formatLine(tagFormatDogStatsD, "m", 1, tags))
+	assert.Equal(t, `m,name=a\,b_c\ d\=e:1|g`, formatLine(tagFormatInfluxDB, "m", 1, tags))
+}
@@ -25,7 +25,9 @@ import (
 	_ "github.com/google/cadvisor/cmd/internal/storage/elasticsearch"
 	_ "github.com/google/cadvisor/cmd/internal/storage/influxdb"
 	_ "github.com/google/cadvisor/cmd/internal/storage/kafka"
+	_ "github.com/google/cadvisor/cmd/internal/storage/promremotewrite"
 	_ "github.com/google/cadvisor/cmd/internal/storage/redis"
+	_ "github.com/google/cadvisor/cmd/internal/storage/stackdriver"
 	_ "github.com/google/cadvisor/cmd/internal/storage/statsd"
 	_ "github.com/google/cadvisor/cmd/internal/storage/stdout"
 	"github.com/google/cadvisor/storage"
@@ -34,22 +36,37 @@ import (
 )
 
 var (
-	storageDriver   = flag.String("storage_driver", "", fmt.Sprintf("Storage `driver` to use. Data is always cached shortly in memory, this controls where data is pushed besides the local cache. Empty means none, multiple separated by commas. Options are: <empty>, %s", strings.Join(storage.ListDrivers(), ", ")))
-	storageDuration = flag.Duration("storage_duration", 2*time.Minute, "How long to keep data stored (Default: 2min).")
+	storageDriver      = flag.String("storage_driver", "", fmt.Sprintf("Storage `driver` to use. Data is always cached shortly in memory, this controls where data is pushed besides the local cache. Empty means none, multiple separated by commas. Options are: <empty>, %s", strings.Join(storage.ListDrivers(), ", ")))
+	storageDuration    = flag.Duration("storage_duration", 2*time.Minute, "How long to keep data stored (Default: 2min).")
+	storageQueueSize   = flag.Int("storage_driver_queue_size", 0, "Maximum number of stats waiting to be pushed to each storage driver. With a queue, the stats are pushed from a goroutine and a storage driver not keeping up does not delay the housekeeping of the containers, unless --storage_driver_queue_policy is block. Zero pushes the stats during housekeeping.")
+	storageQueuePolicy = flag.String("storage_driver_queue_policy", string(storage.QueueBlock), fmt.Sprintf("What to do with the stats when the queue of a storage driver is full. Options are: %s, %s, %s", storage.QueueBlock, storage.QueueDropOldest, storage.QueueDropNewest))
+	storageTransforms  = flag.String("storage_driver_transforms", "", fmt.Sprintf("Transforms applied in order to the stats before pushing them to the storage drivers, separated by semicolons, each one given as name or name:arg, e.g. \"select:cpu,memory;memory_unit:KiB\". The cpu_unit and memory_unit transforms are rejected for the storage drivers whose backends expect the original units, e.g. influxdb. Options are: %s", strings.Join(storage.ListTransforms(), ", ")))
 )
 
 // NewMemoryStorage creates a memory storage with an optional backend storage option.
 func NewMemoryStorage() (*memory.InMemoryCache, error) {
+	transforms, err := storage.NewTransforms(*storageTransforms)
+	if err != nil {
+		return nil, err
+	}
+	queuePolicy, err := storage.ParseQueuePolicy(*storageQueuePolicy)
+	if err != nil {
+		return nil, err
+	}
 	backendStorages := []storage.StorageDriver{}
 	for _, driver := range strings.Split(*storageDriver, ",") {
 		if driver == "" {
 			continue
 		}
-		storage, err := storage.New(driver)
+		if err := storage.CheckTransforms(driver, transforms); err != nil {
+			return nil, err
+		}
+		backendStorage, err := storage.New(driver)
 		if err != nil {
 			return nil, err
 		}
-		backendStorages = append(backendStorages, storage)
+		backendStorage = storage.NewTransformingDriver(backendStorage, transforms)
+		backendStorages = append(backendStorages, storage.NewQueueingDriver(driver, backendStorage, *storageQueueSize, queuePolicy))
 		klog.V(1).Infof("Using backend storage type %q", driver)
 	}
 	klog.V(1).Infof("Caching stats in memory for %v", *storageDuration)
@@ -0,0 +1,121 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"math"
+	"path"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+)
+
+// GetBindingLimits returns the ancestors of the cgroup of a container whose
+// limit is tighter than that of the container and of the other ancestors, by
+// resource: "cpu", "memory" or "pids". A resource is missing if the limit of
+// the container itself is the binding one. The cgroup paths are those of the
+// container, as returned by MakeCgroupPaths for its name.
+func GetBindingLimits(cgroupPaths map[string]string, name string) map[string]string {
+	return getBindingLimits(cgroupPaths, name, cgroups.IsCgroup2UnifiedMode())
+}
+
+func getBindingLimits(cgroupPaths map[string]string, name string, cgroup2UnifiedMode bool) map[string]string {
+	readers := map[string]func(dirpath string) float64{
+		"cpu":    readCPULimit,
+		"memory": readMemoryLimit,
+		"pids":   readPidsLimit,
+	}
+	if cgroup2UnifiedMode {
+		readers["cpu"] = readCPUMaxLimit
+		readers["memory"] = readMemoryMaxLimit
+	}
+
+	var bindingLimits map[string]string
+	for resource, readLimit := range readers {
+		cgroupPath, ok := cgroupPaths[resource]
+		if !ok || !strings.HasSuffix(cgroupPath, name) {
+			continue
+		}
+		mountPoint := strings.TrimSuffix(cgroupPath, name)
+		limit := readLimit(cgroupPath)
+		binding := ""
+		// The root cgroup has no limits.
+		for ancestor := path.Dir(name); ancestor != "/" && ancestor != "."; ancestor = path.Dir(ancestor) {
+			if ancestorLimit := readLimit(path.Join(mountPoint, ancestor)); ancestorLimit < limit {
+				limit = ancestorLimit
+				binding = ancestor
+			}
+		}
+		if binding != "" {
+			if bindingLimits == nil {
+				bindingLimits = make(map[string]string)
+			}
+			bindingLimits[resource] = binding
+		}
+	}
+	return bindingLimits
+}
+
+// readMemoryLimit returns the memory limit of a cgroup v1 in bytes, +Inf if
+// it is unlimited.
+func readMemoryLimit(dirpath string) float64 {
+	return uintLimit(normalizeCgroupV1Limit(readUInt64(dirpath, "memory.limit_in_bytes")))
+}
+
+// readMemoryMaxLimit returns the memory limit of a cgroup v2 in bytes, +Inf
+// if it is unlimited.
+func readMemoryMaxLimit(dirpath string) float64 {
+	return uintLimit(readUInt64(dirpath, "memory.max"))
+}
+
+// readPidsLimit returns the maximum number of tasks of a cgroup, +Inf if it
+// is unlimited.
+func readPidsLimit(dirpath string) float64 {
+	return uintLimit(readUInt64(dirpath, "pids.max"))
+}
+
+// readCPULimit returns the number of CPUs a cgroup v1 can use per period,
+// +Inf if it is unlimited.
+func readCPULimit(dirpath string) float64 {
+	quota := readString(dirpath, "cpu.cfs_quota_us")
+	period := readUInt64(dirpath, "cpu.cfs_period_us")
+	if quota == "" || quota == "-1" || period == 0 {
+		return math.Inf(1)
+	}
+	return float64(parseUint64String(quota)) / float64(period)
+}
+
+// readCPUMaxLimit returns the number of CPUs a cgroup v2 can use per period,
+// +Inf if it is unlimited.
+func readCPUMaxLimit(dirpath string) float64 {
+	splits := strings.SplitN(readString(dirpath, "cpu.max"), " ", 2)
+	if len(splits) != 2 || splits[0] == "max" {
+		return math.Inf(1)
+	}
+	period := parseUint64String(splits[1])
+	if period == 0 {
+		return math.Inf(1)
+	}
+	return float64(parseUint64String(splits[0])) / float64(period)
+}
+
+// uintLimit converts a limit read from a cgroup file, where 0 means it could
+// not be read and math.MaxUint64 that it is unlimited.
+func uintLimit(limit uint64) float64 {
+	if limit == 0 || limit == math.MaxUint64 {
+		return math.Inf(1)
+	}
+	return float64(limit)
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCgroupFiles creates the files of the cgroups below root, by cgroup name.
+func writeCgroupFiles(t *testing.T, root string, cgroups map[string]map[string]string) {
+	for name, files := range cgroups {
+		dir := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		for file, content := range files {
+			require.NoError(t, ioutil.WriteFile(filepath.Join(dir, file), []byte(content+"\n"), 0644))
+		}
+	}
+}
+
+func TestGetBindingLimitsCgroupV2(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup_v2")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	// The pod slice has the tighter memory limit and the burstable slice the
+	// tighter cpu limit, while the container has the tighter pids limit.
+	name := "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1.slice/cri-containerd-abc.scope"
+	writeCgroupFiles(t, root, map[string]map[string]string{
+		"/kubepods.slice":                          {"memory.max": "8589934592", "cpu.max": "max 100000", "pids.max": "max"},
+		"/kubepods.slice/kubepods-burstable.slice": {"memory.max": "max", "cpu.max": "200000 100000", "pids.max": "max"},
+		"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1.slice":                          {"memory.max": "536870912", "cpu.max": "max 100000", "pids.max": "4096"},
+		"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1.slice/cri-containerd-abc.scope": {"memory.max": "1073741824", "cpu.max": "400000 100000", "pids.max": "1024"},
+	})
+	cgroupPaths := MakeCgroupPaths(map[string]string{"cpu": root, "memory": root, "pids": root}, name)
+
+	assert.Equal(t, map[string]string{
+		"cpu":    "/kubepods.slice/kubepods-burstable.slice",
+		"memory": "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1.slice",
+	}, getBindingLimits(cgroupPaths, name, true))
+
+	// Without tighter limits in the ancestors, nothing is reported.
+	name = "/kubepods.slice"
+	cgroupPaths = MakeCgroupPaths(map[string]string{"cpu": root, "memory": root, "pids": root}, name)
+	assert.Nil(t, getBindingLimits(cgroupPaths, name, true))
+}
+
+func TestGetBindingLimitsCgroupV1(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup_v1")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	// The parent has the tighter memory limit, the container is not limited.
+	writeCgroupFiles(t, filepath.Join(root, "memory"), map[string]map[string]string{
+		"/system.slice":             {"memory.limit_in_bytes": "536870912"},
+		"/system.slice/foo.service": {"memory.limit_in_bytes": "9223372036854771712"},
+	})
+	writeCgroupFiles(t, filepath.Join(root, "cpu"), map[string]map[string]string{
+		"/system.slice":             {"cpu.cfs_quota_us": "-1", "cpu.cfs_period_us": "100000"},
+		"/system.slice/foo.service": {"cpu.cfs_quota_us": "50000", "cpu.cfs_period_us": "100000"},
+	})
+	name := "/system.slice/foo.service"
+	cgroupPaths := MakeCgroupPaths(map[string]string{
+		"cpu":    filepath.Join(root, "cpu"),
+		"memory": filepath.Join(root, "memory"),
+	}, name)
+
+	assert.Equal(t, map[string]string{"memory": "/system.slice"}, getBindingLimits(cgroupPaths, name, false))
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"flag"
+	"strings"
+)
+
+var envPresenceKeys = flag.String("env_presence_keys", "", "Comma-separated list of environment variable keys whose presence in the containers is reported, without their values. Only supported by the containerd and docker runtimes.")
+
+// EnvPresence returns the number of environment variables, given as KEY=value,
+// and whether each of the keys of --env_presence_keys is set, or nil if none
+// is configured.
+func EnvPresence(env []string) (int, map[string]bool) {
+	var presence map[string]bool
+	for _, key := range strings.Split(*envPresenceKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			if presence == nil {
+				presence = make(map[string]bool)
+			}
+			presence[key] = false
+		}
+	}
+	count := 0
+	for _, envVar := range env {
+		if envVar == "" {
+			continue
+		}
+		count++
+		key := strings.SplitN(envVar, "=", 2)[0]
+		if _, ok := presence[key]; ok {
+			presence[key] = true
+		}
+	}
+	return count, presence
+}
@@ -131,6 +131,9 @@ func getSpecInternal(cgroupPaths map[string]string, machineInfoFactory info.Mach
 						spec.Cpu.Period = parseUint64String(splits[1])
 					}
 				}
+				spec.Cpu.Burst = readUInt64(cpuRoot, "cpu.max.burst")
+				spec.Cpu.UclampMin = readUclamp(cpuRoot, "cpu.uclamp.min")
+				spec.Cpu.UclampMax = readUclamp(cpuRoot, "cpu.uclamp.max")
 			} else {
 				spec.HasCpu = true
 				spec.Cpu.Limit = readUInt64(cpuRoot, "cpu.shares")
@@ -145,6 +148,7 @@ func getSpecInternal(cgroupPaths map[string]string, machineInfoFactory info.Mach
 						spec.Cpu.Quota = val
 					}
 				}
+				spec.Cpu.Burst = readUInt64(cpuRoot, "cpu.cfs_burst_us")
 			}
 		}
 	}
@@ -162,6 +166,7 @@ func getSpecInternal(cgroupPaths map[string]string, machineInfoFactory info.Mach
 				mask = readString(cpusetRoot, "cpuset.cpus")
 			}
 			spec.Cpu.Mask = utils.FixCpuMask(mask, mi.NumCores)
+			spec.Cpu.MemoryNodes = readCpusetMems(cpusetRoot, cgroup2UnifiedMode)
 		}
 	}
 
@@ -174,6 +179,9 @@ func getSpecInternal(cgroupPaths map[string]string, machineInfoFactory info.Mach
 				spec.Memory.Reservation = readUInt64(memoryRoot, "memory.high")
 				spec.Memory.Limit = readUInt64(memoryRoot, "memory.max")
 				spec.Memory.SwapLimit = readUInt64(memoryRoot, "memory.swap.max")
+				spec.Memory.SoftLimit = readUInt64(memoryRoot, "memory.low")
+				spec.Memory.Min = readUInt64(memoryRoot, "memory.min")
+				spec.Memory.EffectiveLimit = effectiveMemoryLimit(memoryRoot, "memory.max", spec.Memory.Limit)
 			}
 		} else {
 			if utils.FileExists(memoryRoot) {
@@ -181,6 +189,8 @@ func getSpecInternal(cgroupPaths map[string]string, machineInfoFactory info.Mach
 				spec.Memory.Limit = readUInt64(memoryRoot, "memory.limit_in_bytes")
 				spec.Memory.SwapLimit = readUInt64(memoryRoot, "memory.memsw.limit_in_bytes")
 				spec.Memory.Reservation = readUInt64(memoryRoot, "memory.soft_limit_in_bytes")
+				spec.Memory.SoftLimit = normalizeCgroupV1Limit(spec.Memory.Reservation)
+				spec.Memory.EffectiveLimit = effectiveMemoryLimit(memoryRoot, "memory.limit_in_bytes", spec.Memory.Limit)
 			}
 		}
 	}
@@ -205,17 +215,221 @@ func getSpecInternal(cgroupPaths map[string]string, machineInfoFactory info.Mach
 	spec.HasNetwork = hasNetwork
 	spec.HasFilesystem = hasFilesystem
 
+	if cgroup2UnifiedMode {
+		// All the controllers share the same cgroup.
+		if cgroupPath := unifiedCgroupPath(cgroupPaths); cgroupPath != "" {
+			spec.CgroupControllers = parseCgroupControllers(readString(cgroupPath, "cgroup.controllers"))
+			spec.CgroupSubtreeControl = parseCgroupControllers(readString(cgroupPath, "cgroup.subtree_control"))
+		}
+	}
+
 	ioControllerName := "blkio"
 	if cgroup2UnifiedMode {
 		ioControllerName = "io"
 	}
 	if blkioRoot, ok := cgroupPaths[ioControllerName]; ok && utils.FileExists(blkioRoot) {
 		spec.HasDiskIo = true
+		if cgroup2UnifiedMode {
+			spec.DiskIo.Weight, spec.DiskIo.DeviceWeights = parseIoWeight(readString(blkioRoot, "io.weight"))
+			spec.DiskIo.LatencyTargets = parseIoLatency(readString(blkioRoot, "io.latency"))
+			spec.DiskIo.ReadBpsLimits, spec.DiskIo.WriteBpsLimits, spec.DiskIo.ReadIopsLimits, spec.DiskIo.WriteIopsLimits = parseIoMax(readString(blkioRoot, "io.max"))
+		} else {
+			spec.DiskIo.ReadBpsLimits = parseThrottleDevice(readString(blkioRoot, "blkio.throttle.read_bps_device"))
+			spec.DiskIo.WriteBpsLimits = parseThrottleDevice(readString(blkioRoot, "blkio.throttle.write_bps_device"))
+			spec.DiskIo.ReadIopsLimits = parseThrottleDevice(readString(blkioRoot, "blkio.throttle.read_iops_device"))
+			spec.DiskIo.WriteIopsLimits = parseThrottleDevice(readString(blkioRoot, "blkio.throttle.write_iops_device"))
+		}
 	}
 
 	return spec, nil
 }
 
+// unifiedCgroupPath returns the path of the cgroup of a container on cgroup
+// v2, or an empty string if it has none.
+func unifiedCgroupPath(cgroupPaths map[string]string) string {
+	if cgroupPath, ok := cgroupPaths[""]; ok {
+		return cgroupPath
+	}
+	for _, cgroupPath := range cgroupPaths {
+		return cgroupPath
+	}
+	return ""
+}
+
+// parseCgroupControllers parses the content of cgroup.controllers or
+// cgroup.subtree_control, e.g. "cpuset cpu io memory pids", into the list of
+// controllers, in the order of the kernel.
+func parseCgroupControllers(content string) []string {
+	controllers := strings.Fields(content)
+	if len(controllers) == 0 {
+		return nil
+	}
+	return controllers
+}
+
+// parseIoWeight parses the content of io.weight, e.g. "default 100\n8:0 200".
+func parseIoWeight(content string) (uint64, []info.PerDeviceIoSpec) {
+	var weight uint64
+	var devices []info.PerDeviceIoSpec
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value := parseUint64String(fields[1])
+		if fields[0] == "default" {
+			weight = value
+			continue
+		}
+		major, minor, err := parseDeviceNumbers(fields[0])
+		if err != nil {
+			klog.Errorf("parseIoWeight: Failed to parse device %q: %s", fields[0], err)
+			continue
+		}
+		devices = append(devices, info.PerDeviceIoSpec{Major: major, Minor: minor, Value: value})
+	}
+	return weight, devices
+}
+
+// parseIoLatency parses the content of io.latency, e.g. "8:0 target=10000".
+func parseIoLatency(content string) []info.PerDeviceIoSpec {
+	var devices []info.PerDeviceIoSpec
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "target=") {
+			continue
+		}
+		major, minor, err := parseDeviceNumbers(fields[0])
+		if err != nil {
+			klog.Errorf("parseIoLatency: Failed to parse device %q: %s", fields[0], err)
+			continue
+		}
+		target := parseUint64String(strings.TrimPrefix(fields[1], "target="))
+		devices = append(devices, info.PerDeviceIoSpec{Major: major, Minor: minor, Value: target})
+	}
+	return devices
+}
+
+// parseIoMax parses the content of io.max, e.g.
+// "8:0 rbps=1048576 wbps=max riops=max wiops=100", into the read and write
+// bytes per second and the read and write operations per second limits of the
+// devices. Unlimited values are omitted.
+func parseIoMax(content string) (rbps, wbps, riops, wiops []info.PerDeviceIoSpec) {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		major, minor, err := parseDeviceNumbers(fields[0])
+		if err != nil {
+			klog.Errorf("parseIoMax: Failed to parse device %q: %s", fields[0], err)
+			continue
+		}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 || kv[1] == "max" {
+				continue
+			}
+			limit := info.PerDeviceIoSpec{Major: major, Minor: minor, Value: parseUint64String(kv[1])}
+			switch kv[0] {
+			case "rbps":
+				rbps = append(rbps, limit)
+			case "wbps":
+				wbps = append(wbps, limit)
+			case "riops":
+				riops = append(riops, limit)
+			case "wiops":
+				wiops = append(wiops, limit)
+			}
+		}
+	}
+	return rbps, wbps, riops, wiops
+}
+
+// parseThrottleDevice parses the content of a blkio.throttle.*_device file of
+// cgroup v1, e.g. "8:0 1048576".
+func parseThrottleDevice(content string) []info.PerDeviceIoSpec {
+	var devices []info.PerDeviceIoSpec
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		major, minor, err := parseDeviceNumbers(fields[0])
+		if err != nil {
+			klog.Errorf("parseThrottleDevice: Failed to parse device %q: %s", fields[0], err)
+			continue
+		}
+		devices = append(devices, info.PerDeviceIoSpec{Major: major, Minor: minor, Value: parseUint64String(fields[1])})
+	}
+	return devices
+}
+
+// parseDeviceNumbers parses a "major:minor" device identifier.
+func parseDeviceNumbers(device string) (uint64, uint64, error) {
+	splits := strings.SplitN(device, ":", 2)
+	if len(splits) != 2 {
+		return 0, 0, fmt.Errorf("expected major:minor")
+	}
+	major, err := strconv.ParseUint(splits[0], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	minor, err := strconv.ParseUint(splits[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return major, minor, nil
+}
+
+// readCpusetMems returns the memory nodes the container is allowed to allocate
+// from, as a list of ranges, e.g. 0-1. As for cpus, the effective nodes are
+// read first on cgroup v2 where the configured ones are empty unless set, and
+// the configured nodes are read first on cgroup v1.
+func readCpusetMems(dirpath string, cgroup2UnifiedMode bool) string {
+	files := []string{"cpuset.mems", "cpuset.effective_mems"}
+	if cgroup2UnifiedMode {
+		files = []string{"cpuset.mems.effective", "cpuset.mems"}
+	}
+	for _, file := range files {
+		if mems := readString(dirpath, file); mems != "" {
+			return mems
+		}
+	}
+	return ""
+}
+
+// readUclamp returns the utilization clamp in a cpu.uclamp.min or
+// cpu.uclamp.max file, or nil if the file doesn't exist.
+func readUclamp(dirpath string, file string) *float64 {
+	content := readString(dirpath, file)
+	if content == "" {
+		return nil
+	}
+	uclamp, err := parseUclamp(content)
+	if err != nil {
+		klog.Errorf("readUclamp: Failed to parse %q: %s", path.Join(dirpath, file), err)
+		return nil
+	}
+	return &uclamp
+}
+
+// parseUclamp parses a utilization clamp, a percentage with two decimals, e.g.
+// 20.50, or max for 100.
+func parseUclamp(content string) (float64, error) {
+	if content == "max" {
+		return 100, nil
+	}
+	uclamp, err := strconv.ParseFloat(content, 64)
+	if err != nil {
+		return 0, err
+	}
+	if uclamp < 0 || uclamp > 100 {
+		return 0, fmt.Errorf("utilization clamp %v out of range [0-100]", uclamp)
+	}
+	return uclamp, nil
+}
+
 func readString(dirpath string, file string) string {
 	cgroupFile := path.Join(dirpath, file)
 
@@ -262,6 +476,37 @@ func parseUint64String(strValue string) uint64 {
 	return val
 }
 
+// cgroupV1UnlimitedThreshold is the smallest value reported by cgroup v1 for
+// an unlimited memory limit. The kernel reports the largest signed 64 bit
+// integer rounded down to the page size, which depends on the architecture.
+const cgroupV1UnlimitedThreshold = uint64(math.MaxInt64) &^ (1<<16 - 1)
+
+// normalizeCgroupV1Limit converts the unlimited value of a cgroup v1 memory
+// limit to math.MaxUint64, the value reported for "max" on cgroup v2.
+func normalizeCgroupV1Limit(limit uint64) uint64 {
+	if limit >= cgroupV1UnlimitedThreshold {
+		return math.MaxUint64
+	}
+	return limit
+}
+
+// effectiveMemoryLimit returns the lowest of the given memory limit of a cgroup
+// and of the limits, read from file, of its ancestors. The walk stops at the
+// root of the hierarchy, whose limit file is missing on cgroup v2, and whose
+// parent, outside of the hierarchy, has none on cgroup v1. Unlimited
+// ancestors have the largest limit and are thus ignored.
+func effectiveMemoryLimit(cgroupPath, file string, limit uint64) uint64 {
+	for dir := path.Dir(cgroupPath); dir != cgroupPath; cgroupPath, dir = dir, path.Dir(dir) {
+		if !utils.FileExists(path.Join(dir, file)) {
+			break
+		}
+		if parentLimit := readUInt64(dir, file); parentLimit != 0 && parentLimit < limit {
+			limit = parentLimit
+		}
+	}
+	return limit
+}
+
 func readUInt64(dirpath string, file string) uint64 {
 	out := readString(dirpath, file)
 	if out == "max" {
@@ -377,6 +622,10 @@ func assignDeviceNamesToPerDiskStats(namer DeviceNamer, diskStats ...[]info.PerD
 	devices := make(deviceIdentifierMap)
 	for _, stats := range diskStats {
 		for i, stat := range stats {
+			if stat.Device != "" {
+				// Keep the names already assigned, e.g. to aggregated devices.
+				continue
+			}
 			stats[i].Device = devices.Find(stat.Major, stat.Minor, namer)
 		}
 	}
@@ -16,6 +16,7 @@ package common
 
 import (
 	"errors"
+	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
@@ -81,6 +82,84 @@ func TestParseUint64String(t *testing.T) {
 	}
 }
 
+func TestParseIoWeight(t *testing.T) {
+	weight, devices := parseIoWeight("default 100\n8:0 200\n253:1 50\n")
+	assert.EqualValues(t, 100, weight)
+	assert.Equal(t, []info.PerDeviceIoSpec{
+		{Major: 8, Minor: 0, Value: 200},
+		{Major: 253, Minor: 1, Value: 50},
+	}, devices)
+
+	weight, devices = parseIoWeight("")
+	assert.EqualValues(t, 0, weight)
+	assert.Empty(t, devices)
+}
+
+func TestParseIoLatency(t *testing.T) {
+	devices := parseIoLatency("8:0 target=10000\n8:16 target=500\nbogus target=1\n")
+	assert.Equal(t, []info.PerDeviceIoSpec{
+		{Major: 8, Minor: 0, Value: 10000},
+		{Major: 8, Minor: 16, Value: 500},
+	}, devices)
+
+	assert.Empty(t, parseIoLatency(""))
+}
+
+func TestParseIoMax(t *testing.T) {
+	rbps, wbps, riops, wiops := parseIoMax("8:0 rbps=1048576 wbps=max riops=max wiops=100\n8:16 rbps=max wbps=2097152 riops=max wiops=max\nbogus rbps=1\n")
+	assert.Equal(t, []info.PerDeviceIoSpec{{Major: 8, Minor: 0, Value: 1048576}}, rbps)
+	assert.Equal(t, []info.PerDeviceIoSpec{{Major: 8, Minor: 16, Value: 2097152}}, wbps)
+	assert.Empty(t, riops)
+	assert.Equal(t, []info.PerDeviceIoSpec{{Major: 8, Minor: 0, Value: 100}}, wiops)
+
+	rbps, wbps, riops, wiops = parseIoMax("")
+	assert.Empty(t, rbps)
+	assert.Empty(t, wbps)
+	assert.Empty(t, riops)
+	assert.Empty(t, wiops)
+}
+
+func TestParseThrottleDevice(t *testing.T) {
+	devices := parseThrottleDevice("8:0 1048576\n253:1 200\n")
+	assert.Equal(t, []info.PerDeviceIoSpec{
+		{Major: 8, Minor: 0, Value: 1048576},
+		{Major: 253, Minor: 1, Value: 200},
+	}, devices)
+
+	assert.Empty(t, parseThrottleDevice(""))
+}
+
+func TestParseUclamp(t *testing.T) {
+	for _, tc := range []struct {
+		content  string
+		expected float64
+		hasErr   bool
+	}{
+		{content: "0.00", expected: 0},
+		{content: "20.50", expected: 20.5},
+		{content: "100.00", expected: 100},
+		{content: "max", expected: 100},
+		{content: "120.00", hasErr: true},
+		{content: "bogus", hasErr: true},
+	} {
+		uclamp, err := parseUclamp(tc.content)
+		if tc.hasErr {
+			assert.NotNil(t, err, tc.content)
+			continue
+		}
+		assert.Nil(t, err, tc.content)
+		assert.Equal(t, tc.expected, uclamp, tc.content)
+	}
+}
+
+func TestParseCgroupControllers(t *testing.T) {
+	assert.Equal(t, []string{"cpuset", "cpu", "io", "memory", "hugetlb", "pids", "rdma", "misc"}, parseCgroupControllers("cpuset cpu io memory hugetlb pids rdma misc\n"))
+	assert.Equal(t, []string{"cpu", "pids"}, parseCgroupControllers("cpu pids"))
+	// No controller is enabled for the children.
+	assert.Nil(t, parseCgroupControllers("\n"))
+	assert.Nil(t, parseCgroupControllers(""))
+}
+
 type mockInfoProvider struct {
 	options v2.RequestOptions
 }
@@ -120,6 +199,7 @@ func TestGetSpecCgroupV1(t *testing.T) {
 	assert.EqualValues(t, spec.Memory.Limit, 123456789)
 	assert.EqualValues(t, spec.Memory.SwapLimit, 13579)
 	assert.EqualValues(t, spec.Memory.Reservation, 24680)
+	assert.EqualValues(t, spec.Memory.SoftLimit, 24680)
 
 	assert.True(t, spec.HasCpu)
 	assert.EqualValues(t, spec.Cpu.Limit, 1025)
@@ -127,6 +207,7 @@ func TestGetSpecCgroupV1(t *testing.T) {
 	assert.EqualValues(t, spec.Cpu.Quota, 20000)
 
 	assert.EqualValues(t, spec.Cpu.Mask, "0-5")
+	assert.EqualValues(t, spec.Cpu.MemoryNodes, "0-1")
 
 	assert.True(t, spec.HasProcesses)
 	assert.EqualValues(t, spec.Processes.Limit, 1027)
@@ -135,6 +216,89 @@ func TestGetSpecCgroupV1(t *testing.T) {
 	assert.False(t, spec.HasDiskIo)
 }
 
+func TestGetSpecCgroupV1Unlimited(t *testing.T) {
+	root, err := os.Getwd()
+	assert.Nil(t, err)
+
+	cgroupPaths := map[string]string{
+		"memory": filepath.Join(root, "test_resources/cgroup_v1/test2/memory"),
+		"cpuset": filepath.Join(root, "test_resources/cgroup_v1/test2/cpuset"),
+	}
+
+	spec, err := getSpecInternal(cgroupPaths, &mockInfoProvider{}, false, false, false)
+	assert.Nil(t, err)
+
+	assert.True(t, spec.HasMemory)
+	assert.EqualValues(t, spec.Memory.Reservation, uint64(9223372036854771712))
+	assert.EqualValues(t, spec.Memory.SoftLimit, uint64(math.MaxUint64))
+
+	// The memory nodes are not set, fall back to the effective ones.
+	assert.EqualValues(t, spec.Cpu.MemoryNodes, "0")
+}
+
+func TestNormalizeCgroupV1Limit(t *testing.T) {
+	for _, tc := range []struct {
+		limit    uint64
+		expected uint64
+	}{
+		{0, 0},
+		{24680, 24680},
+		// Unlimited with 4K and 64K pages.
+		{9223372036854771712, math.MaxUint64},
+		{9223372036854710272, math.MaxUint64},
+		{math.MaxUint64, math.MaxUint64},
+	} {
+		assert.Equal(t, tc.expected, normalizeCgroupV1Limit(tc.limit), "limit %d", tc.limit)
+	}
+}
+
+func TestGetSpecEffectiveMemoryLimit(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		cgroupV2   bool
+		file       string
+		unlimited  string
+		parent     string
+		child      string
+		childLimit uint64
+		expected   uint64
+	}{
+		{"v1 lower parent", false, "memory.limit_in_bytes", "9223372036854771712", "1073741824", "2147483648", 2147483648, 1073741824},
+		{"v1 higher parent", false, "memory.limit_in_bytes", "9223372036854771712", "4294967296", "2147483648", 2147483648, 2147483648},
+		{"v1 unlimited", false, "memory.limit_in_bytes", "9223372036854771712", "9223372036854771712", "9223372036854771712", 9223372036854771712, 9223372036854771712},
+		{"v2 lower parent", true, "memory.max", "max", "1073741824", "2147483648", 2147483648, 1073741824},
+		{"v2 higher parent", true, "memory.max", "max", "4294967296", "2147483648", 2147483648, 2147483648},
+		{"v2 unlimited child", true, "memory.max", "max", "1073741824", "max", math.MaxUint64, 1073741824},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "effective_limit")
+			assert.Nil(t, err)
+			defer os.RemoveAll(dir)
+
+			// The root of the hierarchy, unlimited on cgroup v1 and without
+			// limit on cgroup v2, an unlimited grandparent, the parent and
+			// the child.
+			root := filepath.Join(dir, "cgroup")
+			grandparent := filepath.Join(root, "kubepods")
+			parent := filepath.Join(grandparent, "pod1")
+			child := filepath.Join(parent, "container1")
+			assert.Nil(t, os.MkdirAll(child, 0755))
+			for cgroup, limit := range map[string]string{grandparent: tc.unlimited, parent: tc.parent, child: tc.child} {
+				assert.Nil(t, ioutil.WriteFile(filepath.Join(cgroup, tc.file), []byte(limit+"\n"), 0644))
+			}
+			if !tc.cgroupV2 {
+				assert.Nil(t, ioutil.WriteFile(filepath.Join(root, tc.file), []byte(tc.unlimited+"\n"), 0644))
+			}
+
+			spec, err := getSpecInternal(map[string]string{"memory": child}, &mockInfoProvider{}, false, false, tc.cgroupV2)
+			assert.Nil(t, err)
+			assert.True(t, spec.HasMemory)
+			assert.Equal(t, tc.childLimit, spec.Memory.Limit)
+			assert.Equal(t, tc.expected, spec.Memory.EffectiveLimit)
+		})
+	}
+}
+
 func TestGetSpecCgroupV2(t *testing.T) {
 	root, err := os.Getwd()
 	if err != nil {
@@ -155,6 +319,8 @@ func TestGetSpecCgroupV2(t *testing.T) {
 	assert.EqualValues(t, spec.Memory.Limit, 123456789)
 	assert.EqualValues(t, spec.Memory.SwapLimit, 13579)
 	assert.EqualValues(t, spec.Memory.Reservation, 24680)
+	assert.EqualValues(t, spec.Memory.SoftLimit, 12345)
+	assert.EqualValues(t, spec.Memory.Min, 8192)
 
 	assert.True(t, spec.HasCpu)
 	assert.EqualValues(t, spec.Cpu.Limit, 1286)
@@ -162,12 +328,20 @@ func TestGetSpecCgroupV2(t *testing.T) {
 	assert.EqualValues(t, spec.Cpu.Quota, 20000)
 
 	assert.EqualValues(t, spec.Cpu.Mask, "0-5")
+	assert.EqualValues(t, spec.Cpu.MemoryNodes, "0-1")
+	if assert.NotNil(t, spec.Cpu.UclampMin) && assert.NotNil(t, spec.Cpu.UclampMax) {
+		assert.Equal(t, 12.5, *spec.Cpu.UclampMin)
+		assert.Equal(t, 100.0, *spec.Cpu.UclampMax)
+	}
 
 	assert.True(t, spec.HasProcesses)
 	assert.EqualValues(t, spec.Processes.Limit, 1027)
 
 	assert.False(t, spec.HasHugetlb)
 	assert.False(t, spec.HasDiskIo)
+
+	assert.Equal(t, []string{"cpuset", "cpu", "io", "memory", "pids"}, spec.CgroupControllers)
+	assert.Nil(t, spec.CgroupSubtreeControl)
 }
 
 func TestGetSpecCgroupV2Max(t *testing.T) {
@@ -177,6 +351,7 @@ func TestGetSpecCgroupV2Max(t *testing.T) {
 	cgroupPaths := map[string]string{
 		"memory": filepath.Join(root, "test_resources/cgroup_v2/test2"),
 		"cpu":    filepath.Join(root, "test_resources/cgroup_v2/test2"),
+		"cpuset": filepath.Join(root, "test_resources/cgroup_v2/test2"),
 		"pids":   filepath.Join(root, "test_resources/cgroup_v2/test2"),
 	}
 
@@ -189,11 +364,19 @@ func TestGetSpecCgroupV2Max(t *testing.T) {
 	assert.EqualValues(t, spec.Memory.Limit, max)
 	assert.EqualValues(t, spec.Memory.SwapLimit, max)
 	assert.EqualValues(t, spec.Memory.Reservation, max)
+	assert.EqualValues(t, spec.Memory.SoftLimit, max)
+	// Without memory.min, nothing is guaranteed.
+	assert.EqualValues(t, spec.Memory.Min, 0)
 
 	assert.True(t, spec.HasCpu)
 	assert.EqualValues(t, spec.Cpu.Limit, 1286)
 	assert.EqualValues(t, spec.Cpu.Period, 100010)
+	assert.Nil(t, spec.Cpu.UclampMin)
+	assert.Nil(t, spec.Cpu.UclampMax)
 	assert.EqualValues(t, spec.Cpu.Quota, 0)
 
+	// The effective memory nodes are missing, fall back to the configured ones.
+	assert.EqualValues(t, spec.Cpu.MemoryNodes, "1")
+
 	assert.EqualValues(t, spec.Processes.Limit, max)
 }
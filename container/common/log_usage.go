@@ -0,0 +1,50 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var sumRotatedContainerLogs = flag.Bool("sum_rotated_container_logs", false, "Whether to include the rotated log files of the containers, e.g. 0.log.20210101-000000.gz next to 0.log, in their reported log usage")
+
+// LogUsage returns the size in bytes of the log file of a container and, if
+// enabled, of its rotated log files, named after it in the same directory.
+func LogUsage(logPath string) (uint64, error) {
+	fileInfo, err := os.Stat(logPath)
+	if err != nil {
+		return 0, err
+	}
+	usage := uint64(fileInfo.Size())
+	if !*sumRotatedContainerLogs {
+		return usage, nil
+	}
+	dir, name := filepath.Split(logPath)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return usage, err
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), name+".") {
+			continue
+		}
+		usage += uint64(file.Size())
+	}
+	return usage, nil
+}
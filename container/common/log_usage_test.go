@@ -0,0 +1,55 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogUsage(t *testing.T) {
+	defer func(sum bool) { *sumRotatedContainerLogs = sum }(*sumRotatedContainerLogs)
+	logDir, err := ioutil.TempDir("", "pod_logs")
+	require.NoError(t, err)
+	defer os.RemoveAll(logDir)
+
+	logPath := filepath.Join(logDir, "0.log")
+	_, err = LogUsage(logPath)
+	assert.Error(t, err)
+
+	for name, size := range map[string]int{
+		"0.log":                    100,
+		"0.log.20210101-000000.gz": 20,
+		"0.log.20210102-000000":    30,
+		"1.log":                    1000,
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(logDir, name), make([]byte, size), 0644))
+	}
+
+	*sumRotatedContainerLogs = false
+	usage, err := LogUsage(logPath)
+	require.NoError(t, err)
+	assert.EqualValues(t, 100, usage)
+
+	*sumRotatedContainerLogs = true
+	usage, err = LogUsage(logPath)
+	require.NoError(t, err)
+	assert.EqualValues(t, 150, usage)
+}
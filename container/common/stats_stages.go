@@ -0,0 +1,125 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/cadvisor/container"
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// StatsStages reads the stats of a container in stages, first its cgroup and
+// network stats, then its filesystem stats, within the deadline of a context.
+// A stage exceeding the deadline is given up on but keeps running in the
+// background, e.g. on a hung NFS mount, and is skipped until it returns. The
+// zero value is ready to use.
+type StatsStages struct {
+	lock sync.Mutex
+	// Stages given up on, closed when they return.
+	abandoned map[string]chan struct{}
+}
+
+// Read returns the stats read by readCgroupStats completed by readFsStats.
+// When ctx is done before a stage returns, the stats of the previous stages
+// are returned along with an error wrapping container.ErrPartialStats.
+func (s *StatsStages) Read(ctx context.Context, readCgroupStats func() (*info.ContainerStats, error), readFsStats func(*info.ContainerStats) error) (*info.ContainerStats, error) {
+	var stats *info.ContainerStats
+	var statsErr error
+	err := s.run(ctx, "cgroup", func() {
+		stats, statsErr = readCgroupStats()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if statsErr != nil || stats == nil {
+		return stats, statsErr
+	}
+
+	// The filesystem stats are read into a copy, which is dropped if the read
+	// is given up on.
+	fsStats := &info.ContainerStats{DiskIo: copyDiskIoStats(stats.DiskIo)}
+	err = s.run(ctx, "filesystem", func() {
+		statsErr = readFsStats(fsStats)
+	})
+	if err != nil {
+		return stats, err
+	}
+	stats.Filesystem = append(stats.Filesystem, fsStats.Filesystem...)
+	stats.DiskIo = fsStats.DiskIo
+	return stats, statsErr
+}
+
+// run runs the named stage, unless ctx is done or the previous run of the
+// stage, given up on, is still running.
+func (s *StatsStages) run(ctx context.Context, stage string, read func()) error {
+	s.lock.Lock()
+	if running, ok := s.abandoned[stage]; ok {
+		select {
+		case <-running:
+			delete(s.abandoned, stage)
+		default:
+			s.lock.Unlock()
+			return fmt.Errorf("skipping the %s stats, an abandoned read is still running: %w", stage, container.ErrPartialStats)
+		}
+	}
+	s.lock.Unlock()
+	if ctx.Done() == nil {
+		read()
+		return nil
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("skipping the %s stats: %w", stage, container.ErrPartialStats)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		read()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if s.abandoned == nil {
+			s.abandoned = map[string]chan struct{}{}
+		}
+		s.abandoned[stage] = done
+		return fmt.Errorf("reading the %s stats: %v: %w", stage, ctx.Err(), container.ErrPartialStats)
+	}
+}
+
+func copyDiskIoStats(stats info.DiskIoStats) info.DiskIoStats {
+	copyPerDiskStats := func(perDisk []info.PerDiskStats) []info.PerDiskStats {
+		if perDisk == nil {
+			return nil
+		}
+		return append([]info.PerDiskStats{}, perDisk...)
+	}
+	return info.DiskIoStats{
+		IoServiceBytes:      copyPerDiskStats(stats.IoServiceBytes),
+		IoServiced:          copyPerDiskStats(stats.IoServiced),
+		IoQueued:            copyPerDiskStats(stats.IoQueued),
+		Sectors:             copyPerDiskStats(stats.Sectors),
+		IoServiceTime:       copyPerDiskStats(stats.IoServiceTime),
+		IoWaitTime:          copyPerDiskStats(stats.IoWaitTime),
+		IoMerged:            copyPerDiskStats(stats.IoMerged),
+		IoTime:              copyPerDiskStats(stats.IoTime),
+		ThrottleUtilization: stats.ThrottleUtilization,
+	}
+}
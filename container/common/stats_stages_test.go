@@ -0,0 +1,78 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/container"
+	info "github.com/google/cadvisor/info/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsStagesRead(t *testing.T) {
+	readCgroupStats := func() (*info.ContainerStats, error) {
+		return &info.ContainerStats{
+			Filesystem: []info.FsStats{{Device: "tmpfs"}},
+			DiskIo: info.DiskIoStats{
+				IoServiceBytes: []info.PerDiskStats{{Major: 8, Minor: 0}},
+			},
+		}, nil
+	}
+	unblock := make(chan struct{})
+	var reads int32
+	readFsStats := func(stats *info.ContainerStats) error {
+		// The first read hangs.
+		if atomic.AddInt32(&reads, 1) == 1 {
+			<-unblock
+		}
+		stats.Filesystem = append(stats.Filesystem, info.FsStats{Device: "/dev/sda1"})
+		stats.DiskIo.IoServiceBytes[0].Device = "/dev/sda"
+		return nil
+	}
+	var stages StatsStages
+
+	// The hung filesystem stats are given up on, the cgroup stats are
+	// returned untouched.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stats, err := stages.Read(ctx, readCgroupStats, readFsStats)
+	assert.True(t, errors.Is(err, container.ErrPartialStats), "unexpected error: %v", err)
+	require.NotNil(t, stats)
+	assert.Equal(t, []info.FsStats{{Device: "tmpfs"}}, stats.Filesystem)
+	assert.Equal(t, "", stats.DiskIo.IoServiceBytes[0].Device)
+
+	// They are skipped while the read is still hung.
+	stats, err = stages.Read(context.Background(), readCgroupStats, readFsStats)
+	assert.True(t, errors.Is(err, container.ErrPartialStats), "unexpected error: %v", err)
+	require.NotNil(t, stats)
+	assert.Len(t, stats.Filesystem, 1)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reads))
+
+	// And read again once it returns.
+	close(unblock)
+	assert.Eventually(t, func() bool {
+		stats, err = stages.Read(context.Background(), readCgroupStats, readFsStats)
+		return err == nil
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []info.FsStats{{Device: "tmpfs"}, {Device: "/dev/sda1"}}, stats.Filesystem)
+	assert.Equal(t, "/dev/sda", stats.DiskIo.IoServiceBytes[0].Device)
+}
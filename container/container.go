@@ -16,7 +16,12 @@
 // defines an interface for container operation handlers.
 package container
 
-import info "github.com/google/cadvisor/info/v1"
+import (
+	"context"
+	"errors"
+
+	info "github.com/google/cadvisor/info/v1"
+)
 
 // ListType describes whether listing should be just for a
 // specific container or performed recursively.
@@ -76,3 +81,17 @@ type ContainerHandler interface {
 	// Type of handler
 	Type() ContainerType
 }
+
+// ErrPartialStats is wrapped by the errors of GetStatsContext when only part
+// of the stats of the container could be read.
+var ErrPartialStats = errors.New("partial stats")
+
+// StatsContextHandler is implemented by the container handlers which read the
+// stats of a container subsystem by subsystem.
+type StatsContextHandler interface {
+	// GetStatsContext returns the current stats values of the container like
+	// GetStats, but gives up on the subsystems not read yet once ctx is done.
+	// The stats read until then are returned along with an error wrapping
+	// ErrPartialStats.
+	GetStatsContext(ctx context.Context) (*info.ContainerStats, error)
+}
@@ -22,11 +22,15 @@ import (
 	"time"
 
 	containersapi "github.com/containerd/containerd/api/services/containers/v1"
+	imagesapi "github.com/containerd/containerd/api/services/images/v1"
+	snapshotsapi "github.com/containerd/containerd/api/services/snapshots/v1"
 	tasksapi "github.com/containerd/containerd/api/services/tasks/v1"
 	versionapi "github.com/containerd/containerd/api/services/version/v1"
+	"github.com/containerd/containerd/api/types"
 	"github.com/containerd/containerd/containers"
 	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/pkg/dialer"
+	"github.com/containerd/containerd/snapshots"
 	ptypes "github.com/gogo/protobuf/types"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/backoff"
@@ -36,12 +40,17 @@ type client struct {
 	containerService containersapi.ContainersClient
 	taskService      tasksapi.TasksClient
 	versionService   versionapi.VersionClient
+	snapshotService  snapshotsapi.SnapshotsClient
+	imageService     imagesapi.ImagesClient
 }
 
 type ContainerdClient interface {
 	LoadContainer(ctx context.Context, id string) (*containers.Container, error)
 	TaskPid(ctx context.Context, id string) (uint32, error)
 	Version(ctx context.Context) (string, error)
+	SnapshotUsage(ctx context.Context, snapshotter, key string) (snapshots.Usage, error)
+	SnapshotMounts(ctx context.Context, snapshotter, key string) ([]*types.Mount, error)
+	ImageCreationTime(ctx context.Context, name string) (time.Time, error)
 }
 
 var once sync.Once
@@ -92,6 +101,8 @@ func Client(address, namespace string) (ContainerdClient, error) {
 			containerService: containersapi.NewContainersClient(conn),
 			taskService:      tasksapi.NewTasksClient(conn),
 			versionService:   versionapi.NewVersionClient(conn),
+			snapshotService:  snapshotsapi.NewSnapshotsClient(conn),
+			imageService:     imagesapi.NewImagesClient(conn),
 		}
 	})
 	return ctrdClient, retErr
@@ -125,6 +136,43 @@ func (c *client) Version(ctx context.Context) (string, error) {
 	return response.Version, nil
 }
 
+func (c *client) SnapshotUsage(ctx context.Context, snapshotter, key string) (snapshots.Usage, error) {
+	response, err := c.snapshotService.Usage(ctx, &snapshotsapi.UsageRequest{
+		Snapshotter: snapshotter,
+		Key:         key,
+	})
+	if err != nil {
+		return snapshots.Usage{}, errdefs.FromGRPC(err)
+	}
+	return snapshots.Usage{Size: response.Size_, Inodes: response.Inodes}, nil
+}
+
+func (c *client) SnapshotMounts(ctx context.Context, snapshotter, key string) ([]*types.Mount, error) {
+	response, err := c.snapshotService.Mounts(ctx, &snapshotsapi.MountsRequest{
+		Snapshotter: snapshotter,
+		Key:         key,
+	})
+	if err != nil {
+		return nil, errdefs.FromGRPC(err)
+	}
+	return response.Mounts, nil
+}
+
+// ImageCreationTime returns the time at which the image was created in the
+// image store of containerd, i.e. when it was pulled or imported.
+func (c *client) ImageCreationTime(ctx context.Context, name string) (time.Time, error) {
+	response, err := c.imageService.Get(ctx, &imagesapi.GetImageRequest{
+		Name: name,
+	})
+	if err != nil {
+		return time.Time{}, errdefs.FromGRPC(err)
+	}
+	if response.Image == nil {
+		return time.Time{}, fmt.Errorf("image %q not found", name)
+	}
+	return response.Image.CreatedAt, nil
+}
+
 func containerFromProto(containerpb containersapi.Container) *containers.Container {
 	var runtime containers.RuntimeInfo
 	if containerpb.Runtime != nil {
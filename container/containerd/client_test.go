@@ -17,13 +17,21 @@ package containerd
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/containerd/containerd/api/types"
 	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/snapshots"
 )
 
 type containerdClientMock struct {
-	cntrs     map[string]*containers.Container
-	returnErr error
+	cntrs         map[string]*containers.Container
+	returnErr     error
+	usage         snapshots.Usage
+	usageCalls    int
+	usageErr      error
+	snapshotMount *types.Mount
+	images        map[string]time.Time
 }
 
 func (c *containerdClientMock) LoadContainer(ctx context.Context, id string) (*containers.Container, error) {
@@ -45,6 +53,26 @@ func (c *containerdClientMock) TaskPid(ctx context.Context, id string) (uint32,
 	return 2389, nil
 }
 
+func (c *containerdClientMock) SnapshotUsage(ctx context.Context, snapshotter, key string) (snapshots.Usage, error) {
+	c.usageCalls++
+	return c.usage, c.usageErr
+}
+
+func (c *containerdClientMock) SnapshotMounts(ctx context.Context, snapshotter, key string) ([]*types.Mount, error) {
+	if c.snapshotMount == nil {
+		return nil, fmt.Errorf("unable to find snapshot %q", key)
+	}
+	return []*types.Mount{c.snapshotMount}, nil
+}
+
+func (c *containerdClientMock) ImageCreationTime(ctx context.Context, name string) (time.Time, error) {
+	created, ok := c.images[name]
+	if !ok {
+		return time.Time{}, fmt.Errorf("unable to find image %q", name)
+	}
+	return created, nil
+}
+
 func mockcontainerdClient(cntrs map[string]*containers.Container, returnErr error) ContainerdClient {
 	return &containerdClientMock{
 		cntrs:     cntrs,
@@ -18,11 +18,16 @@ package containerd
 import (
 	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/snapshots"
+	ptypes "github.com/gogo/protobuf/types"
 	"golang.org/x/net/context"
+	"k8s.io/klog/v2"
 
 	"github.com/google/cadvisor/container"
 	"github.com/google/cadvisor/container/common"
@@ -42,12 +47,82 @@ type containerdContainerHandler struct {
 	reference info.ContainerReference
 	envs      map[string]string
 	labels    map[string]string
+	// Number of environment variables and presence of the configured keys.
+	envCount    int
+	envPresence map[string]bool
+	// Resource limits of the container's process from its runtime spec.
+	rlimits map[string]info.RlimitSpec
+	// Capability sets of the container's process from its runtime spec.
+	capabilities *info.CapabilitiesSpec
+	// Summary of the seccomp profile of the container from its runtime spec.
+	seccompProfile *info.SeccompProfileSpec
+	// Whether the root filesystem is read-only and its mount propagation,
+	// from the runtime spec.
+	rootfsReadonly    bool
+	rootfsPropagation string
+	// Nice value of the container's process from its runtime spec, if any.
+	configuredNice *int
+	// Runtime of the container, e.g. io.containerd.kata.v2.
+	runtime string
+	// Path of the log file of the container, as recorded by the CRI plugin.
+	logPath string
 	// Image name used for this container.
 	image string
+	// Time at which the image was created in the image store of containerd.
+	imageCreationTime time.Time
 	// Filesystem handler.
 	includedMetrics container.MetricSet
 
 	libcontainerHandler *containerlibcontainer.Handler
+
+	client ContainerdClient
+	rootfs string
+	// Snapshotter and key of the writable layer of the container.
+	snapshotter string
+	snapshotKey string
+	// Device of the writable layer, resolved on first use.
+	snapshotDevice string
+	// Latest usage of the writable layer, whether it is valid, and when it was
+	// last queried.
+	snapshotUsage      snapshots.Usage
+	snapshotUsageValid bool
+	snapshotUsageTime  time.Time
+
+	// Stages of the stats reads, given up on past the deadline of
+	// GetStatsContext.
+	statsStages common.StatsStages
+}
+
+// Snapshotters whose usage is that of the writable layer of the container.
+// The usage reported by other snapshotters, e.g. the size of the thin device
+// for devmapper, is not comparable.
+var snapshotUsageSnapshotters = map[string]bool{
+	"overlayfs": true,
+	"native":    true,
+}
+
+// Minimum interval between two queries of the usage of a snapshot, which
+// walks the writable layer of the container.
+// This is defined as a variable to help in testing.
+var snapshotUsageInterval = time.Minute
+
+// Timeout of the queries of the usage and mounts of a snapshot.
+const snapshotQueryTimeout = 10 * time.Second
+
+// Substrings of the names of the runtimes running containers in a sandbox,
+// a VM for Kata Containers and Firecracker or the sentry for gVisor (runsc).
+// The cgroup of such a container accounts for the whole sandbox.
+var sandboxedRuntimes = []string{"kata", "firecracker", "runsc", "gvisor"}
+
+// isSandboxedRuntime returns whether the runtime runs containers in a sandbox.
+func isSandboxedRuntime(runtime string) bool {
+	runtime = strings.ToLower(runtime)
+	for _, sandboxed := range sandboxedRuntimes {
+		if strings.Contains(runtime, sandboxed) {
+			return true
+		}
+	}
+	return false
 }
 
 var _ container.ContainerHandler = &containerdContainerHandler{}
@@ -130,10 +205,35 @@ func newContainerdContainerHandler(
 		includedMetrics:     includedMetrics,
 		reference:           containerReference,
 		libcontainerHandler: libcontainerHandler,
+		client:              client,
+		rootfs:              rootfs,
+		snapshotter:         cntr.Snapshotter,
+		snapshotKey:         cntr.SnapshotKey,
+		rlimits:             rlimitsFromSpec(&spec),
+		capabilities:        capabilitiesFromSpec(&spec),
+		seccompProfile:      seccompProfileFromSpec(&spec),
+		runtime:             cntr.Runtime.Name,
+		logPath:             logPathFromExtensions(cntr.Extensions),
 	}
 	// Add the name and bare ID as aliases of the container.
 	handler.image = cntr.Image
+	if cntr.Image != "" {
+		handler.imageCreationTime, err = client.ImageCreationTime(ctx, cntr.Image)
+		if err != nil {
+			klog.V(4).Infof("Unable to get the creation time of image %q of container %q: %v", cntr.Image, id, err)
+		}
+	}
 
+	if spec.Root != nil {
+		handler.rootfsReadonly = spec.Root.Readonly
+	}
+	handler.configuredNice = niceFromSpec(cntr.Spec.Value)
+	if spec.Linux != nil {
+		handler.rootfsPropagation = spec.Linux.RootfsPropagation
+	}
+	if spec.Process != nil {
+		handler.envCount, handler.envPresence = common.EnvPresence(spec.Process.Env)
+	}
 	for _, exposedEnv := range metadataEnvAllowList {
 		if exposedEnv == "" {
 			// if no containerdEnvWhitelist provided, len(metadataEnvAllowList) == 1, metadataEnvAllowList[0] == ""
@@ -153,6 +253,109 @@ func newContainerdContainerHandler(
 	return handler, nil
 }
 
+// criContainerMetadataExtension is the extension in which the CRI plugin of
+// containerd records the metadata of the containers it creates, as JSON.
+const criContainerMetadataExtension = "io.cri-containerd.container.metadata"
+
+// logPathFromExtensions returns the path of the log file of a container created
+// through the CRI plugin, or an empty string if it is unknown.
+func logPathFromExtensions(extensions map[string]ptypes.Any) string {
+	extension, ok := extensions[criContainerMetadataExtension]
+	if !ok {
+		return ""
+	}
+	var metadata struct {
+		Metadata struct {
+			LogPath string
+		}
+	}
+	if err := json.Unmarshal(extension.Value, &metadata); err != nil {
+		klog.V(4).Infof("Unable to decode the CRI metadata of container: %v", err)
+		return ""
+	}
+	return metadata.Metadata.LogPath
+}
+
+// rlimitsFromSpec returns the resource limits of the process of a container
+// by type, or nil if none is configured in its runtime spec.
+func rlimitsFromSpec(spec *specs.Spec) map[string]info.RlimitSpec {
+	if spec.Process == nil || len(spec.Process.Rlimits) == 0 {
+		return nil
+	}
+	rlimits := make(map[string]info.RlimitSpec, len(spec.Process.Rlimits))
+	for _, rlimit := range spec.Process.Rlimits {
+		rlimits[rlimit.Type] = info.RlimitSpec{Soft: rlimit.Soft, Hard: rlimit.Hard}
+	}
+	return rlimits
+}
+
+// niceFromSpec returns the nice value of the scheduler of the container's
+// process, or nil if none is configured in its raw runtime spec. The scheduler
+// was added to the runtime spec in v1.1.0, after the vendored version.
+func niceFromSpec(rawSpec []byte) *int {
+	var spec struct {
+		Process *struct {
+			Scheduler *struct {
+				Nice int `json:"nice"`
+			} `json:"scheduler"`
+		} `json:"process"`
+	}
+	if err := json.Unmarshal(rawSpec, &spec); err != nil {
+		return nil
+	}
+	if spec.Process == nil || spec.Process.Scheduler == nil {
+		return nil
+	}
+	return &spec.Process.Scheduler.Nice
+}
+
+// capabilitiesFromSpec returns the sorted capability sets of the process of a
+// container, or nil if none is configured in its runtime spec.
+func capabilitiesFromSpec(spec *specs.Spec) *info.CapabilitiesSpec {
+	if spec.Process == nil || spec.Process.Capabilities == nil {
+		return nil
+	}
+	caps := spec.Process.Capabilities
+	return &info.CapabilitiesSpec{
+		Bounding:  sortedCapabilities(caps.Bounding),
+		Effective: sortedCapabilities(caps.Effective),
+		Permitted: sortedCapabilities(caps.Permitted),
+	}
+}
+
+// seccompProfileFromSpec summarizes the seccomp profile of a container from
+// its runtime spec: its default action and the number of syscalls its rules
+// allow. Containers without profile are reported unconfined.
+func seccompProfileFromSpec(spec *specs.Spec) *info.SeccompProfileSpec {
+	if spec.Linux == nil || spec.Linux.Seccomp == nil {
+		return &info.SeccompProfileSpec{DefaultAction: "unconfined"}
+	}
+	// A syscall can be allowed by several rules, e.g. for different arguments.
+	allowed := map[string]struct{}{}
+	for _, syscall := range spec.Linux.Seccomp.Syscalls {
+		if syscall.Action != specs.ActAllow {
+			continue
+		}
+		for _, name := range syscall.Names {
+			allowed[name] = struct{}{}
+		}
+	}
+	return &info.SeccompProfileSpec{
+		DefaultAction:   string(spec.Linux.Seccomp.DefaultAction),
+		AllowedSyscalls: len(allowed),
+	}
+}
+
+func sortedCapabilities(caps []string) []string {
+	if len(caps) == 0 {
+		return nil
+	}
+	sorted := make([]string, len(caps))
+	copy(sorted, caps)
+	sort.Strings(sorted)
+	return sorted
+}
+
 func (h *containerdContainerHandler) ContainerReference() (info.ContainerReference, error) {
 	return h.reference, nil
 }
@@ -168,14 +371,33 @@ func (h *containerdContainerHandler) needNet() bool {
 	return false
 }
 
+// hasSnapshotUsage returns whether the usage of the writable layer of the
+// container is reported.
+func (h *containerdContainerHandler) hasSnapshotUsage() bool {
+	return h.includedMetrics.Has(container.DiskUsageMetrics) && h.snapshotKey != "" && snapshotUsageSnapshotters[h.snapshotter]
+}
+
 func (h *containerdContainerHandler) GetSpec() (info.ContainerSpec, error) {
-	// TODO: Since we dont collect disk usage stats for containerd, we set hasFilesystem
-	// to false. Revisit when we support disk usage stats for containerd
-	hasFilesystem := false
-	spec, err := common.GetSpec(h.cgroupPaths, h.machineInfoFactory, h.needNet(), hasFilesystem)
+	hasFilesystem := h.hasSnapshotUsage()
+	spec, err := common.GetSpec(containerlibcontainer.CurrentCgroupPaths(h.reference.Name, h.cgroupPaths), h.machineInfoFactory, h.needNet(), hasFilesystem)
+	spec.BindingLimits = common.GetBindingLimits(h.cgroupPaths, h.reference.Name)
 	spec.Labels = h.labels
 	spec.Envs = h.envs
+	spec.EnvCount = h.envCount
+	spec.EnvPresence = h.envPresence
+	spec.Runtime = h.runtime
+	spec.Sandboxed = isSandboxedRuntime(h.runtime)
 	spec.Image = h.image
+	spec.ImageCreationTime = h.imageCreationTime
+	spec.Rlimits = h.rlimits
+	spec.Capabilities = h.capabilities
+	spec.SeccompProfile = h.seccompProfile
+	spec.RootfsReadonly = h.rootfsReadonly
+	spec.RootfsPropagation = h.rootfsPropagation
+	h.libcontainerHandler.UpdateSpecFromProc(&spec)
+	if spec.Scheduling != nil {
+		spec.Scheduling.ConfiguredNice = h.configuredNice
+	}
 
 	return spec, err
 }
@@ -189,10 +411,107 @@ func (h *containerdContainerHandler) getFsStats(stats *info.ContainerStats) erro
 	if h.includedMetrics.Has(container.DiskIOMetrics) {
 		common.AssignDeviceNamesToDiskStats((*common.MachineInfoNamer)(mi), &stats.DiskIo)
 	}
+
+	if !h.hasSnapshotUsage() {
+		return nil
+	}
+	// A failed query is not retried before the interval has elapsed either.
+	if time.Since(h.snapshotUsageTime) >= snapshotUsageInterval {
+		h.snapshotUsageTime = time.Now()
+		h.updateSnapshotUsage()
+	}
+	if !h.snapshotUsageValid {
+		return nil
+	}
+
+	// The usage of the writable layer excludes the image layers, so BaseUsage
+	// is left unset.
+	fsStat := info.FsStats{
+		Device: h.snapshotDevice,
+		Usage:  uint64(h.snapshotUsage.Size),
+		Inodes: uint64(h.snapshotUsage.Inodes),
+	}
+	if h.logPath != "" {
+		logUsage, err := common.LogUsage(h.logPath)
+		if err != nil {
+			klog.V(4).Infof("Unable to get the usage of log file %q of container %q: %v", h.logPath, h.reference.Name, err)
+		} else {
+			fsStat.LogUsage = logUsage
+		}
+	}
+	// Containerd does not impose any filesystem limits for containers. So use capacity as limit.
+	for _, fs := range mi.Filesystems {
+		if fs.Device == fsStat.Device {
+			fsStat.Limit = fs.Capacity
+			fsStat.Type = fs.Type
+			fsStat.MountType = fs.MountType
+			break
+		}
+	}
+	stats.Filesystem = append(stats.Filesystem, fsStat)
 	return nil
 }
 
+// updateSnapshotUsage queries the usage of the writable layer of the
+// container, and the device of its filesystem if it is not known yet.
+func (h *containerdContainerHandler) updateSnapshotUsage() {
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotQueryTimeout)
+	defer cancel()
+	usage, err := h.client.SnapshotUsage(ctx, h.snapshotter, h.snapshotKey)
+	if err != nil {
+		klog.V(4).Infof("Unable to get usage of snapshot %q of snapshotter %q: %v", h.snapshotKey, h.snapshotter, err)
+		h.snapshotUsageValid = false
+		return
+	}
+	h.snapshotUsage = usage
+	h.snapshotUsageValid = true
+	if h.snapshotDevice == "" {
+		h.snapshotDevice = h.getSnapshotDevice(ctx)
+	}
+}
+
+// getSnapshotDevice returns the device of the filesystem of the writable layer
+// of the container, or an empty string if it cannot be determined.
+func (h *containerdContainerHandler) getSnapshotDevice(ctx context.Context) string {
+	if h.fsInfo == nil {
+		return ""
+	}
+	mounts, err := h.client.SnapshotMounts(ctx, h.snapshotter, h.snapshotKey)
+	if err != nil {
+		klog.V(4).Infof("Unable to get mounts of snapshot %q of snapshotter %q: %v", h.snapshotKey, h.snapshotter, err)
+		return ""
+	}
+	for _, mount := range mounts {
+		// The writable layer is the upper dir of overlay mounts, and the source
+		// of bind mounts.
+		dir := mount.Source
+		for _, option := range mount.Options {
+			if strings.HasPrefix(option, "upperdir=") {
+				dir = strings.TrimPrefix(option, "upperdir=")
+			}
+		}
+		if dir == "" {
+			continue
+		}
+		deviceInfo, err := h.fsInfo.GetDirFsDevice(filepath.Join(h.rootfs, dir))
+		if err != nil {
+			klog.V(4).Infof("Unable to determine device of dir %q: %v", dir, err)
+			return ""
+		}
+		return deviceInfo.Device
+	}
+	return ""
+}
+
 func (h *containerdContainerHandler) GetStats() (*info.ContainerStats, error) {
+	return h.GetStatsContext(context.Background())
+}
+
+func (h *containerdContainerHandler) GetStatsContext(ctx context.Context) (*info.ContainerStats, error) {
+	return h.statsStages.Read(ctx, h.getCgroupStats, h.getFsStats)
+}
+
+func (h *containerdContainerHandler) getCgroupStats() (*info.ContainerStats, error) {
 	stats, err := h.libcontainerHandler.GetStats()
 	if err != nil {
 		return stats, err
@@ -204,10 +523,7 @@ func (h *containerdContainerHandler) GetStats() (*info.ContainerStats, error) {
 	if !h.needNet() {
 		stats.Network = info.NetworkStats{}
 	}
-
-	// Get filesystem stats.
-	err = h.getFsStats(stats)
-	return stats, err
+	return stats, nil
 }
 
 func (h *containerdContainerHandler) ListContainers(listType container.ListType) ([]info.ContainerReference, error) {
@@ -16,10 +16,19 @@
 package containerd
 
 import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/containerd/containerd/api/types"
 	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/snapshots"
 	"github.com/containerd/typeurl"
+	ptypes "github.com/gogo/protobuf/types"
 	"github.com/google/cadvisor/container"
 	containerlibcontainer "github.com/google/cadvisor/container/libcontainer"
 	"github.com/google/cadvisor/fs"
@@ -140,3 +149,401 @@ func TestHandler(t *testing.T) {
 		}
 	}
 }
+
+func TestHandlerEnvPresence(t *testing.T) {
+	as := assert.New(t)
+	keys := flag.Lookup("env_presence_keys")
+	defer keys.Value.Set(keys.Value.String())
+	as.Nil(keys.Value.Set("TEST_ZONE,API_TOKEN"))
+
+	testContainer := &containers.Container{
+		ID: "40af7cdcbe507acad47a5a62025743ad3ddc6ab93b77b21363aa1c1d641047c9",
+	}
+	spec := &specs.Spec{Root: &specs.Root{Path: "/test/"}, Process: &specs.Process{Env: []string{"TEST_REGION=FRA", "TEST_ZONE=A", "HELLO=WORLD"}}}
+	testContainer.Spec, _ = typeurl.MarshalAny(spec)
+	client := mockcontainerdClient(map[string]*containers.Container{testContainer.ID: testContainer}, nil)
+
+	handler, err := newContainerdContainerHandler(client, "/kubepods/pod068e8fa0-9213-11e7-a01f-507b9d4141fa/"+testContainer.ID, &mockedMachineInfo{}, nil, &containerlibcontainer.CgroupSubsystems{}, false, []string{"TEST"}, nil)
+	as.Nil(err)
+
+	sp, err := handler.GetSpec()
+	as.Nil(err)
+	as.Equal(3, sp.EnvCount)
+	as.Equal(map[string]bool{"TEST_ZONE": true, "API_TOKEN": false}, sp.EnvPresence)
+	// Only the allowlisted values are collected.
+	as.Equal(map[string]string{"TEST_REGION": "FRA", "TEST_ZONE": "A"}, sp.Envs)
+}
+
+type mockedMachineInfoWithFs struct {
+	mockedMachineInfo
+}
+
+func (m *mockedMachineInfoWithFs) GetMachineInfo() (*info.MachineInfo, error) {
+	return &info.MachineInfo{
+		Filesystems: []info.FsInfo{{Device: "/dev/sda1", Type: "vfs", Capacity: 1 << 30}},
+	}, nil
+}
+
+type mockedFsInfo struct {
+	fs.FsInfo
+	dirs map[string]string
+}
+
+func (m *mockedFsInfo) GetDirFsDevice(dir string) (*fs.DeviceInfo, error) {
+	device, ok := m.dirs[dir]
+	if !ok {
+		return nil, fmt.Errorf("unknown dir %q", dir)
+	}
+	return &fs.DeviceInfo{Device: device}, nil
+}
+
+func TestHandlerSnapshotUsage(t *testing.T) {
+	as := assert.New(t)
+	testContainer := &containers.Container{
+		ID:          "40af7cdcbe507acad47a5a62025743ad3ddc6ab93b77b21363aa1c1d641047c9",
+		Snapshotter: "overlayfs",
+		SnapshotKey: "40af7cdcbe507acad47a5a62025743ad3ddc6ab93b77b21363aa1c1d641047c9",
+	}
+	spec := &specs.Spec{Root: &specs.Root{Path: "/test/"}, Process: &specs.Process{}}
+	testContainer.Spec, _ = typeurl.MarshalAny(spec)
+	client := &containerdClientMock{
+		cntrs: map[string]*containers.Container{testContainer.ID: testContainer},
+		usage: snapshots.Usage{Size: 4096, Inodes: 12},
+		snapshotMount: &types.Mount{
+			Type:    "overlay",
+			Source:  "overlay",
+			Options: []string{"lowerdir=/var/lib/containerd/snapshots/1/fs", "upperdir=/var/lib/containerd/snapshots/2/fs", "workdir=/var/lib/containerd/snapshots/2/work"},
+		},
+	}
+	fsInfo := &mockedFsInfo{dirs: map[string]string{"/var/lib/containerd/snapshots/2/fs": "/dev/sda1"}}
+	includedMetrics := container.MetricSet{container.DiskUsageMetrics: struct{}{}}
+
+	handler, err := newContainerdContainerHandler(client, "/kubepods/pod068e8fa0-9213-11e7-a01f-507b9d4141fa/"+testContainer.ID, &mockedMachineInfoWithFs{}, fsInfo, &containerlibcontainer.CgroupSubsystems{}, true, nil, includedMetrics)
+	as.Nil(err)
+
+	sp, err := handler.GetSpec()
+	as.Nil(err)
+	as.True(sp.HasFilesystem)
+
+	stats := &info.ContainerStats{}
+	as.Nil(handler.(*containerdContainerHandler).getFsStats(stats))
+	as.Equal([]info.FsStats{{
+		Device: "/dev/sda1",
+		Type:   "vfs",
+		Limit:  1 << 30,
+		Usage:  4096,
+		Inodes: 12,
+	}}, stats.Filesystem)
+
+	// The usage is only queried again once the interval has elapsed.
+	client.usage = snapshots.Usage{Size: 8192, Inodes: 13}
+	stats = &info.ContainerStats{}
+	as.Nil(handler.(*containerdContainerHandler).getFsStats(stats))
+	as.Equal(uint64(4096), stats.Filesystem[0].Usage)
+	as.Equal(1, client.usageCalls)
+}
+
+func TestHandlerSnapshotUsageError(t *testing.T) {
+	as := assert.New(t)
+	testContainer := &containers.Container{
+		ID:          "40af7cdcbe507acad47a5a62025743ad3ddc6ab93b77b21363aa1c1d641047c9",
+		Snapshotter: "overlayfs",
+		SnapshotKey: "40af7cdcbe507acad47a5a62025743ad3ddc6ab93b77b21363aa1c1d641047c9",
+	}
+	spec := &specs.Spec{Root: &specs.Root{Path: "/test/"}, Process: &specs.Process{}}
+	testContainer.Spec, _ = typeurl.MarshalAny(spec)
+	client := &containerdClientMock{
+		cntrs:    map[string]*containers.Container{testContainer.ID: testContainer},
+		usageErr: fmt.Errorf("snapshot %q not found", testContainer.SnapshotKey),
+	}
+	includedMetrics := container.MetricSet{container.DiskUsageMetrics: struct{}{}}
+
+	handler, err := newContainerdContainerHandler(client, "/kubepods/pod068e8fa0-9213-11e7-a01f-507b9d4141fa/"+testContainer.ID, &mockedMachineInfoWithFs{}, nil, &containerlibcontainer.CgroupSubsystems{}, true, nil, includedMetrics)
+	as.Nil(err)
+
+	// A failed query doesn't fail the stats, and is not retried before the
+	// interval has elapsed.
+	for i := 0; i < 2; i++ {
+		stats := &info.ContainerStats{}
+		as.Nil(handler.(*containerdContainerHandler).getFsStats(stats))
+		as.Empty(stats.Filesystem)
+	}
+	as.Equal(1, client.usageCalls)
+}
+
+func TestHandlerLogUsage(t *testing.T) {
+	as := assert.New(t)
+	logDir, err := ioutil.TempDir("", "pod_logs")
+	as.Nil(err)
+	defer os.RemoveAll(logDir)
+	logPath := filepath.Join(logDir, "0.log")
+	as.Nil(ioutil.WriteFile(logPath, make([]byte, 1234), 0644))
+
+	testContainer := &containers.Container{
+		ID:          "40af7cdcbe507acad47a5a62025743ad3ddc6ab93b77b21363aa1c1d641047c9",
+		Snapshotter: "overlayfs",
+		SnapshotKey: "40af7cdcbe507acad47a5a62025743ad3ddc6ab93b77b21363aa1c1d641047c9",
+		Extensions: map[string]ptypes.Any{
+			criContainerMetadataExtension: {
+				TypeUrl: "github.com/containerd/cri/pkg/store/container/Metadata",
+				Value:   []byte(fmt.Sprintf(`{"Version":"v1","Metadata":{"ID":"40af7cdcbe50","Name":"app","LogPath":%q}}`, logPath)),
+			},
+		},
+	}
+	spec := &specs.Spec{Root: &specs.Root{Path: "/test/"}, Process: &specs.Process{}}
+	testContainer.Spec, _ = typeurl.MarshalAny(spec)
+	client := &containerdClientMock{
+		cntrs: map[string]*containers.Container{testContainer.ID: testContainer},
+		usage: snapshots.Usage{Size: 4096, Inodes: 12},
+		snapshotMount: &types.Mount{
+			Type:    "overlay",
+			Source:  "overlay",
+			Options: []string{"lowerdir=/var/lib/containerd/snapshots/1/fs", "upperdir=/var/lib/containerd/snapshots/2/fs", "workdir=/var/lib/containerd/snapshots/2/work"},
+		},
+	}
+	fsInfo := &mockedFsInfo{dirs: map[string]string{"/var/lib/containerd/snapshots/2/fs": "/dev/sda1"}}
+	includedMetrics := container.MetricSet{container.DiskUsageMetrics: struct{}{}}
+
+	handler, err := newContainerdContainerHandler(client, "/kubepods/pod068e8fa0-9213-11e7-a01f-507b9d4141fa/"+testContainer.ID, &mockedMachineInfoWithFs{}, fsInfo, &containerlibcontainer.CgroupSubsystems{}, true, nil, includedMetrics)
+	as.Nil(err)
+
+	stats := &info.ContainerStats{}
+	as.Nil(handler.(*containerdContainerHandler).getFsStats(stats))
+	as.Len(stats.Filesystem, 1)
+	as.Equal(uint64(1234), stats.Filesystem[0].LogUsage)
+
+	// A missing log file is not an error.
+	as.Nil(os.Remove(logPath))
+	stats = &info.ContainerStats{}
+	as.Nil(handler.(*containerdContainerHandler).getFsStats(stats))
+	as.Len(stats.Filesystem, 1)
+	as.Equal(uint64(0), stats.Filesystem[0].LogUsage)
+}
+
+func TestHandlerSnapshotUsageUnsupportedSnapshotter(t *testing.T) {
+	as := assert.New(t)
+	testContainer := &containers.Container{
+		ID:          "40af7cdcbe507acad47a5a62025743ad3ddc6ab93b77b21363aa1c1d641047c9",
+		Snapshotter: "devmapper",
+		SnapshotKey: "40af7cdcbe507acad47a5a62025743ad3ddc6ab93b77b21363aa1c1d641047c9",
+	}
+	spec := &specs.Spec{Root: &specs.Root{Path: "/test/"}, Process: &specs.Process{}}
+	testContainer.Spec, _ = typeurl.MarshalAny(spec)
+	client := &containerdClientMock{cntrs: map[string]*containers.Container{testContainer.ID: testContainer}}
+	includedMetrics := container.MetricSet{container.DiskUsageMetrics: struct{}{}}
+
+	handler, err := newContainerdContainerHandler(client, "/kubepods/pod068e8fa0-9213-11e7-a01f-507b9d4141fa/"+testContainer.ID, &mockedMachineInfoWithFs{}, nil, &containerlibcontainer.CgroupSubsystems{}, true, nil, includedMetrics)
+	as.Nil(err)
+
+	sp, err := handler.GetSpec()
+	as.Nil(err)
+	as.False(sp.HasFilesystem)
+
+	stats := &info.ContainerStats{}
+	as.Nil(handler.(*containerdContainerHandler).getFsStats(stats))
+	as.Empty(stats.Filesystem)
+	as.Equal(0, client.usageCalls)
+}
+
+func TestHandlerRlimits(t *testing.T) {
+	as := assert.New(t)
+	testContainer := &containers.Container{
+		ID: "40af7cdcbe507acad47a5a62025743ad3ddc6ab93b77b21363aa1c1d641047c9",
+	}
+	spec := &specs.Spec{Root: &specs.Root{Path: "/test/"}, Process: &specs.Process{
+		Rlimits: []specs.POSIXRlimit{
+			{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: 4096},
+			{Type: "RLIMIT_NPROC", Soft: 512, Hard: 512},
+		},
+	}}
+	testContainer.Spec, _ = typeurl.MarshalAny(spec)
+	client := mockcontainerdClient(map[string]*containers.Container{testContainer.ID: testContainer}, nil)
+
+	handler, err := newContainerdContainerHandler(client, "/kubepods/pod068e8fa0-9213-11e7-a01f-507b9d4141fa/"+testContainer.ID, &mockedMachineInfo{}, nil, &containerlibcontainer.CgroupSubsystems{}, false, nil, nil)
+	as.Nil(err)
+
+	sp, err := handler.GetSpec()
+	as.Nil(err)
+	as.Equal(map[string]info.RlimitSpec{
+		"RLIMIT_NOFILE": {Soft: 1024, Hard: 4096},
+		"RLIMIT_NPROC":  {Soft: 512, Hard: 512},
+	}, sp.Rlimits)
+}
+
+func TestHandlerCapabilities(t *testing.T) {
+	as := assert.New(t)
+	testContainer := &containers.Container{
+		ID: "40af7cdcbe507acad47a5a62025743ad3ddc6ab93b77b21363aa1c1d641047c9",
+	}
+	spec := &specs.Spec{Root: &specs.Root{Path: "/test/"}, Process: &specs.Process{
+		Capabilities: &specs.LinuxCapabilities{
+			Bounding:    []string{"CAP_NET_RAW", "CAP_CHOWN", "CAP_NET_ADMIN"},
+			Effective:   []string{"CAP_NET_RAW", "CAP_CHOWN"},
+			Permitted:   []string{"CAP_CHOWN", "CAP_NET_RAW"},
+			Inheritable: []string{"CAP_CHOWN"},
+		},
+	}}
+	testContainer.Spec, _ = typeurl.MarshalAny(spec)
+	client := mockcontainerdClient(map[string]*containers.Container{testContainer.ID: testContainer}, nil)
+
+	handler, err := newContainerdContainerHandler(client, "/kubepods/pod068e8fa0-9213-11e7-a01f-507b9d4141fa/"+testContainer.ID, &mockedMachineInfo{}, nil, &containerlibcontainer.CgroupSubsystems{}, false, nil, nil)
+	as.Nil(err)
+
+	sp, err := handler.GetSpec()
+	as.Nil(err)
+	as.Equal(&info.CapabilitiesSpec{
+		Bounding:  []string{"CAP_CHOWN", "CAP_NET_ADMIN", "CAP_NET_RAW"},
+		Effective: []string{"CAP_CHOWN", "CAP_NET_RAW"},
+		Permitted: []string{"CAP_CHOWN", "CAP_NET_RAW"},
+	}, sp.Capabilities)
+}
+
+func TestHandlerSeccompProfile(t *testing.T) {
+	as := assert.New(t)
+	for _, tc := range []struct {
+		linux    *specs.Linux
+		expected *info.SeccompProfileSpec
+	}{
+		{
+			linux: &specs.Linux{Seccomp: &specs.LinuxSeccomp{
+				DefaultAction: specs.ActErrno,
+				Syscalls: []specs.LinuxSyscall{
+					{Names: []string{"read", "write", "openat"}, Action: specs.ActAllow},
+					{Names: []string{"clone"}, Action: specs.ActAllow, Args: []specs.LinuxSeccompArg{{Index: 0, Value: 0x7e020000, Op: specs.OpMaskedEqual}}},
+					{Names: []string{"read"}, Action: specs.ActAllow, Args: []specs.LinuxSeccompArg{{Index: 0, Value: 0, Op: specs.OpEqualTo}}},
+					{Names: []string{"ptrace"}, Action: specs.ActErrno},
+				},
+			}},
+			expected: &info.SeccompProfileSpec{DefaultAction: "SCMP_ACT_ERRNO", AllowedSyscalls: 4},
+		},
+		{
+			linux:    &specs.Linux{},
+			expected: &info.SeccompProfileSpec{DefaultAction: "unconfined"},
+		},
+	} {
+		testContainer := &containers.Container{
+			ID: "40af7cdcbe507acad47a5a62025743ad3ddc6ab93b77b21363aa1c1d641047c9",
+		}
+		spec := &specs.Spec{Root: &specs.Root{Path: "/test/"}, Process: &specs.Process{}, Linux: tc.linux}
+		testContainer.Spec, _ = typeurl.MarshalAny(spec)
+		client := mockcontainerdClient(map[string]*containers.Container{testContainer.ID: testContainer}, nil)
+
+		handler, err := newContainerdContainerHandler(client, "/kubepods/pod068e8fa0-9213-11e7-a01f-507b9d4141fa/"+testContainer.ID, &mockedMachineInfo{}, nil, &containerlibcontainer.CgroupSubsystems{}, false, nil, nil)
+		as.Nil(err)
+
+		sp, err := handler.GetSpec()
+		as.Nil(err)
+		as.Equal(tc.expected, sp.SeccompProfile)
+	}
+}
+
+func TestHandlerRootfs(t *testing.T) {
+	as := assert.New(t)
+	for _, tc := range []struct {
+		spec        *specs.Spec
+		readonly    bool
+		propagation string
+	}{
+		{
+			spec:        &specs.Spec{Root: &specs.Root{Path: "/test/", Readonly: true}, Process: &specs.Process{}, Linux: &specs.Linux{RootfsPropagation: "rslave"}},
+			readonly:    true,
+			propagation: "rslave",
+		},
+		{
+			spec: &specs.Spec{Root: &specs.Root{Path: "/test/"}, Process: &specs.Process{}},
+		},
+	} {
+		testContainer := &containers.Container{
+			ID: "40af7cdcbe507acad47a5a62025743ad3ddc6ab93b77b21363aa1c1d641047c9",
+		}
+		testContainer.Spec, _ = typeurl.MarshalAny(tc.spec)
+		client := mockcontainerdClient(map[string]*containers.Container{testContainer.ID: testContainer}, nil)
+
+		handler, err := newContainerdContainerHandler(client, "/kubepods/pod068e8fa0-9213-11e7-a01f-507b9d4141fa/"+testContainer.ID, &mockedMachineInfo{}, nil, &containerlibcontainer.CgroupSubsystems{}, false, nil, nil)
+		as.Nil(err)
+
+		sp, err := handler.GetSpec()
+		as.Nil(err)
+		as.Equal(tc.readonly, sp.RootfsReadonly)
+		as.Equal(tc.propagation, sp.RootfsPropagation)
+	}
+}
+
+func TestNiceFromSpec(t *testing.T) {
+	nice := niceFromSpec([]byte(`{"process":{"scheduler":{"policy":"SCHED_OTHER","nice":-5}}}`))
+	if assert.NotNil(t, nice) {
+		assert.Equal(t, -5, *nice)
+	}
+	assert.Nil(t, niceFromSpec([]byte(`{"process":{"args":["sh"]}}`)))
+	assert.Nil(t, niceFromSpec([]byte(`{}`)))
+}
+
+func TestHandlerImageCreationTime(t *testing.T) {
+	as := assert.New(t)
+	testContainer := &containers.Container{
+		ID:    "40af7cdcbe507acad47a5a62025743ad3ddc6ab93b77b21363aa1c1d641047c9",
+		Image: "docker.io/library/nginx:1.21",
+	}
+	spec := &specs.Spec{Root: &specs.Root{Path: "/test/"}, Process: &specs.Process{}}
+	testContainer.Spec, _ = typeurl.MarshalAny(spec)
+	client := &containerdClientMock{
+		cntrs:  map[string]*containers.Container{testContainer.ID: testContainer},
+		images: map[string]time.Time{"docker.io/library/nginx:1.21": time.Unix(1618309500, 0)},
+	}
+
+	handler, err := newContainerdContainerHandler(client, "/kubepods/pod068e8fa0-9213-11e7-a01f-507b9d4141fa/"+testContainer.ID, &mockedMachineInfo{}, nil, &containerlibcontainer.CgroupSubsystems{}, false, nil, nil)
+	as.Nil(err)
+	sp, err := handler.GetSpec()
+	as.Nil(err)
+	as.Equal("docker.io/library/nginx:1.21", sp.Image)
+	as.Equal(time.Unix(1618309500, 0), sp.ImageCreationTime)
+
+	// Without image info, the creation time is zero.
+	client.images = nil
+	handler, err = newContainerdContainerHandler(client, "/kubepods/pod068e8fa0-9213-11e7-a01f-507b9d4141fa/"+testContainer.ID, &mockedMachineInfo{}, nil, &containerlibcontainer.CgroupSubsystems{}, false, nil, nil)
+	as.Nil(err)
+	sp, err = handler.GetSpec()
+	as.Nil(err)
+	as.True(sp.ImageCreationTime.IsZero())
+}
+
+func TestHandlerSandboxedRuntime(t *testing.T) {
+	as := assert.New(t)
+	testContainer := &containers.Container{
+		ID:      "40af7cdcbe507acad47a5a62025743ad3ddc6ab93b77b21363aa1c1d641047c9",
+		Runtime: containers.RuntimeInfo{Name: "io.containerd.kata.v2"},
+	}
+	spec := &specs.Spec{Root: &specs.Root{Path: "/test/"}, Process: &specs.Process{}}
+	testContainer.Spec, _ = typeurl.MarshalAny(spec)
+	client := mockcontainerdClient(map[string]*containers.Container{testContainer.ID: testContainer}, nil)
+
+	handler, err := newContainerdContainerHandler(client, "/kubepods/pod068e8fa0-9213-11e7-a01f-507b9d4141fa/"+testContainer.ID, &mockedMachineInfo{}, nil, &containerlibcontainer.CgroupSubsystems{}, false, nil, nil)
+	as.Nil(err)
+	sp, err := handler.GetSpec()
+	as.Nil(err)
+	as.Equal("io.containerd.kata.v2", sp.Runtime)
+	as.True(sp.Sandboxed)
+
+	// Containers run by runc are not sandboxed.
+	testContainer.Runtime.Name = "io.containerd.runc.v2"
+	handler, err = newContainerdContainerHandler(client, "/kubepods/pod068e8fa0-9213-11e7-a01f-507b9d4141fa/"+testContainer.ID, &mockedMachineInfo{}, nil, &containerlibcontainer.CgroupSubsystems{}, false, nil, nil)
+	as.Nil(err)
+	sp, err = handler.GetSpec()
+	as.Nil(err)
+	as.Equal("io.containerd.runc.v2", sp.Runtime)
+	as.False(sp.Sandboxed)
+}
+
+func TestIsSandboxedRuntime(t *testing.T) {
+	for runtime, sandboxed := range map[string]bool{
+		"io.containerd.kata.v2":          true,
+		"io.containerd.kata-qemu.v2":     true,
+		"io.containerd.runsc.v1":         true,
+		"aws.firecracker":                true,
+		"io.containerd.runc.v2":          false,
+		"io.containerd.runtime.v1.linux": false,
+		"":                               false,
+	} {
+		assert.Equal(t, sandboxed, isSandboxedRuntime(runtime), runtime)
+	}
+}
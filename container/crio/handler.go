@@ -16,6 +16,7 @@
 package crio
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"strconv"
@@ -27,6 +28,7 @@ import (
 	"github.com/google/cadvisor/fs"
 	info "github.com/google/cadvisor/info/v1"
 	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"k8s.io/klog/v2"
 )
 
 type crioContainerHandler struct {
@@ -43,6 +45,8 @@ type crioContainerHandler struct {
 	storageDriver    storageDriver
 	fsInfo           fs.FsInfo
 	rootfsStorageDir string
+	// Path of the log file of the container.
+	logPath string
 
 	// Metadata associated with the container.
 	envs   map[string]string
@@ -71,6 +75,10 @@ type crioContainerHandler struct {
 	cgroupManager       cgroups.Manager
 	rootFs              string
 	pidKnown            bool
+
+	// Stages of the stats reads, given up on past the deadline of
+	// GetStatsContext.
+	statsStages common.StatsStages
 }
 
 var _ container.ContainerHandler = &crioContainerHandler{}
@@ -158,6 +166,7 @@ func newCrioContainerHandler(
 		storageDriver:       storageDriver,
 		fsInfo:              fsInfo,
 		rootfsStorageDir:    rootfsStorageDir,
+		logPath:             cInfo.LogPath,
 		envs:                make(map[string]string),
 		labels:              cInfo.Labels,
 		includedMetrics:     includedMetrics,
@@ -218,11 +227,13 @@ func (h *crioContainerHandler) needNet() bool {
 
 func (h *crioContainerHandler) GetSpec() (info.ContainerSpec, error) {
 	hasFilesystem := h.includedMetrics.Has(container.DiskUsageMetrics)
-	spec, err := common.GetSpec(h.cgroupPaths, h.machineInfoFactory, h.needNet(), hasFilesystem)
+	spec, err := common.GetSpec(containerlibcontainer.CurrentCgroupPaths(h.name, h.cgroupPaths), h.machineInfoFactory, h.needNet(), hasFilesystem)
+	spec.BindingLimits = common.GetBindingLimits(h.cgroupPaths, h.reference.Name)
 
 	spec.Labels = h.labels
 	spec.Envs = h.envs
 	spec.Image = h.image
+	h.getLibcontainerHandler().UpdateSpecFromProc(&spec)
 
 	return spec, err
 }
@@ -253,8 +264,9 @@ func (h *crioContainerHandler) getFsStats(stats *info.ContainerStats) error {
 	}
 
 	var (
-		limit  uint64
-		fsType string
+		limit     uint64
+		fsType    string
+		mountType string
 	)
 
 	// crio does not impose any filesystem limits for containers. So use capacity as limit.
@@ -262,6 +274,7 @@ func (h *crioContainerHandler) getFsStats(stats *info.ContainerStats) error {
 		if fs.Device == device {
 			limit = fs.Capacity
 			fsType = fs.Type
+			mountType = fs.MountType
 			break
 		}
 	}
@@ -269,11 +282,19 @@ func (h *crioContainerHandler) getFsStats(stats *info.ContainerStats) error {
 	if fsType == "" {
 		return fmt.Errorf("unable to determine fs type for device: %v", device)
 	}
-	fsStat := info.FsStats{Device: device, Type: fsType, Limit: limit}
+	fsStat := info.FsStats{Device: device, Type: fsType, MountType: mountType, Limit: limit}
 	usage := h.fsHandler.Usage()
 	fsStat.BaseUsage = usage.BaseUsageBytes
 	fsStat.Usage = usage.TotalUsageBytes
 	fsStat.Inodes = usage.InodeUsage
+	if h.logPath != "" {
+		logUsage, err := common.LogUsage(h.logPath)
+		if err != nil {
+			klog.V(4).Infof("Unable to get the usage of log file %q of container %q: %v", h.logPath, h.name, err)
+		} else {
+			fsStat.LogUsage = logUsage
+		}
+	}
 
 	stats.Filesystem = append(stats.Filesystem, fsStat)
 
@@ -299,8 +320,15 @@ func (h *crioContainerHandler) getLibcontainerHandler() *containerlibcontainer.H
 }
 
 func (h *crioContainerHandler) GetStats() (*info.ContainerStats, error) {
-	libcontainerHandler := h.getLibcontainerHandler()
-	stats, err := libcontainerHandler.GetStats()
+	return h.GetStatsContext(context.Background())
+}
+
+func (h *crioContainerHandler) GetStatsContext(ctx context.Context) (*info.ContainerStats, error) {
+	return h.statsStages.Read(ctx, h.getCgroupStats, h.getFsStats)
+}
+
+func (h *crioContainerHandler) getCgroupStats() (*info.ContainerStats, error) {
+	stats, err := h.getLibcontainerHandler().GetStats()
 	if err != nil {
 		return stats, err
 	}
@@ -311,13 +339,6 @@ func (h *crioContainerHandler) GetStats() (*info.ContainerStats, error) {
 	if !h.needNet() {
 		stats.Network = info.NetworkStats{}
 	}
-
-	// Get filesystem stats.
-	err = h.getFsStats(stats)
-	if err != nil {
-		return stats, err
-	}
-
 	return stats, nil
 }
 
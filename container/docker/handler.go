@@ -67,6 +67,9 @@ type dockerContainerHandler struct {
 	// Metadata associated with the container.
 	envs   map[string]string
 	labels map[string]string
+	// Number of environment variables and presence of the configured keys.
+	envCount    int
+	envPresence map[string]bool
 
 	// Image name used for this container.
 	image string
@@ -92,6 +95,10 @@ type dockerContainerHandler struct {
 	reference info.ContainerReference
 
 	libcontainerHandler *containerlibcontainer.Handler
+
+	// Stages of the stats reads, given up on past the deadline of
+	// GetStatsContext.
+	statsStages common.StatsStages
 }
 
 var _ container.ContainerHandler = &dockerContainerHandler{}
@@ -249,6 +256,7 @@ func newDockerContainerHandler(
 	}
 
 	// split env vars to get metadata map.
+	handler.envCount, handler.envPresence = common.EnvPresence(ctnr.Config.Env)
 	for _, exposedEnv := range metadataEnvAllowList {
 		if exposedEnv == "" {
 			// if no dockerEnvWhitelist provided, len(metadataEnvAllowList) == 1, metadataEnvAllowList[0] == ""
@@ -352,12 +360,16 @@ func (h *dockerContainerHandler) needNet() bool {
 
 func (h *dockerContainerHandler) GetSpec() (info.ContainerSpec, error) {
 	hasFilesystem := h.includedMetrics.Has(container.DiskUsageMetrics)
-	spec, err := common.GetSpec(h.cgroupPaths, h.machineInfoFactory, h.needNet(), hasFilesystem)
+	spec, err := common.GetSpec(containerlibcontainer.CurrentCgroupPaths(h.reference.Name, h.cgroupPaths), h.machineInfoFactory, h.needNet(), hasFilesystem)
+	spec.BindingLimits = common.GetBindingLimits(h.cgroupPaths, h.reference.Name)
 
 	spec.Labels = h.labels
 	spec.Envs = h.envs
+	spec.EnvCount = h.envCount
+	spec.EnvPresence = h.envPresence
 	spec.Image = h.image
 	spec.CreationTime = h.creationTime
+	h.libcontainerHandler.UpdateSpecFromProc(&spec)
 
 	return spec, err
 }
@@ -394,8 +406,9 @@ func (h *dockerContainerHandler) getFsStats(stats *info.ContainerStats) error {
 	}
 
 	var (
-		limit  uint64
-		fsType string
+		limit     uint64
+		fsType    string
+		mountType string
 	)
 
 	var fsInfo *info.FsInfo
@@ -405,12 +418,13 @@ func (h *dockerContainerHandler) getFsStats(stats *info.ContainerStats) error {
 		if fs.Device == device {
 			limit = fs.Capacity
 			fsType = fs.Type
+			mountType = fs.MountType
 			fsInfo = &fs
 			break
 		}
 	}
 
-	fsStat := info.FsStats{Device: device, Type: fsType, Limit: limit}
+	fsStat := info.FsStats{Device: device, Type: fsType, MountType: mountType, Limit: limit}
 	usage := h.fsHandler.Usage()
 	fsStat.BaseUsage = usage.BaseUsageBytes
 	fsStat.Usage = usage.TotalUsageBytes
@@ -455,8 +469,16 @@ func addDiskStats(fileSystems []fs.Fs, fsInfo *info.FsInfo, fsStats *info.FsStat
 	}
 }
 
-// TODO(vmarmol): Get from libcontainer API instead of cgroup manager when we don't have to support older Dockers.
 func (h *dockerContainerHandler) GetStats() (*info.ContainerStats, error) {
+	return h.GetStatsContext(context.Background())
+}
+
+func (h *dockerContainerHandler) GetStatsContext(ctx context.Context) (*info.ContainerStats, error) {
+	return h.statsStages.Read(ctx, h.getCgroupStats, h.getFsStats)
+}
+
+// TODO(vmarmol): Get from libcontainer API instead of cgroup manager when we don't have to support older Dockers.
+func (h *dockerContainerHandler) getCgroupStats() (*info.ContainerStats, error) {
 	stats, err := h.libcontainerHandler.GetStats()
 	if err != nil {
 		return stats, err
@@ -468,13 +490,6 @@ func (h *dockerContainerHandler) GetStats() (*info.ContainerStats, error) {
 	if !h.needNet() {
 		stats.Network = info.NetworkStats{}
 	}
-
-	// Get filesystem stats.
-	err = h.getFsStats(stats)
-	if err != nil {
-		return stats, err
-	}
-
 	return stats, nil
 }
 
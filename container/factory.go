@@ -16,9 +16,12 @@ package container
 
 import (
 	"fmt"
+	"path"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/google/cadvisor/fs"
 	info "github.com/google/cadvisor/info/v1"
@@ -67,6 +70,8 @@ const (
 	ResctrlMetrics                 MetricKind = "resctrl"
 	CPUSetMetrics                  MetricKind = "cpuset"
 	OOMMetrics                     MetricKind = "oom_event"
+	DelayAccountingMetrics         MetricKind = "delayacct"
+	KernelMemoryMetrics            MetricKind = "kernel_memory"
 )
 
 // AllMetrics represents all kinds of metrics that cAdvisor supported.
@@ -93,6 +98,8 @@ var AllMetrics = MetricSet{
 	ResctrlMetrics:                 struct{}{},
 	CPUSetMetrics:                  struct{}{},
 	OOMMetrics:                     struct{}{},
+	DelayAccountingMetrics:         struct{}{},
+	KernelMemoryMetrics:            struct{}{},
 }
 
 func (mk MetricKind) String() string {
@@ -101,18 +108,74 @@ func (mk MetricKind) String() string {
 
 type MetricSet map[MetricKind]struct{}
 
+// updatedMetricSet is the current content of a set updated at runtime.
+type updatedMetricSet struct {
+	// The set as created, kept so that its address isn't reused.
+	origin  MetricSet
+	current MetricSet
+}
+
+var (
+	// Current content of the sets updated at runtime, by the address of their
+	// map, as a map[uintptr]updatedMetricSet. The included metrics are shared
+	// by reference by the manager, the container handlers and the collectors,
+	// so a set is never modified once shared: its updates are swapped
+	// atomically and checking for a metric doesn't take a lock.
+	updatedMetricSets atomic.Value
+	// Serializes the updates of updatedMetricSets.
+	updatedMetricSetsLock sync.Mutex
+)
+
+// current returns the metrics of the set, taking its updates into account.
+func (ms MetricSet) current() MetricSet {
+	updated, _ := updatedMetricSets.Load().(map[uintptr]updatedMetricSet)
+	if len(updated) == 0 || ms == nil {
+		return ms
+	}
+	if set, ok := updated[reflect.ValueOf(ms).Pointer()]; ok {
+		return set.current
+	}
+	return ms
+}
+
 func (ms MetricSet) Has(mk MetricKind) bool {
-	_, exists := ms[mk]
+	_, exists := ms.current()[mk]
 	return exists
 }
 
+// Update replaces the metrics of the set by those of other. Whoever shares the
+// set sees the change the next time it checks for a metric.
+func (ms MetricSet) Update(other MetricSet) {
+	other = other.Clone()
+	updatedMetricSetsLock.Lock()
+	defer updatedMetricSetsLock.Unlock()
+	previous, _ := updatedMetricSets.Load().(map[uintptr]updatedMetricSet)
+	updated := make(map[uintptr]updatedMetricSet, len(previous)+1)
+	for key, set := range previous {
+		updated[key] = set
+	}
+	updated[reflect.ValueOf(ms).Pointer()] = updatedMetricSet{origin: ms, current: other}
+	updatedMetricSets.Store(updated)
+}
+
+// Clone returns a copy of the set, not affected by its updates.
+func (ms MetricSet) Clone() MetricSet {
+	current := ms.current()
+	result := make(MetricSet, len(current))
+	for kind := range current {
+		result[kind] = struct{}{}
+	}
+	return result
+}
+
 func (ms MetricSet) add(mk MetricKind) {
 	ms[mk] = struct{}{}
 }
 
 func (ms MetricSet) String() string {
-	values := make([]string, 0, len(ms))
-	for metric := range ms {
+	current := ms.current()
+	values := make([]string, 0, len(current))
+	for metric := range current {
 		values = append(values, string(metric))
 	}
 	sort.Strings(values)
@@ -136,9 +199,10 @@ func (ms *MetricSet) Set(value string) error {
 }
 
 func (ms MetricSet) Difference(ms1 MetricSet) MetricSet {
+	current, other := ms.current(), ms1.current()
 	result := MetricSet{}
-	for kind := range ms {
-		if !ms1.Has(kind) {
+	for kind := range current {
+		if _, exists := other[kind]; !exists {
 			result.add(kind)
 		}
 	}
@@ -226,13 +290,49 @@ func HasFactories() bool {
 	return len(factories) != 0
 }
 
+// Names of the container runtimes that can be recognized from a cgroup path.
+// They match the names of the corresponding container handler factories.
+const (
+	DockerRuntime     = "docker"
+	ContainerdRuntime = "containerd"
+	CrioRuntime       = "crio"
+)
+
+// RuntimeFromCgroupPath returns the runtime which likely created the container
+// with the given cgroup path, based only on the naming conventions of the
+// cgroupfs and systemd cgroup drivers. It returns an empty string when the path
+// does not identify a runtime, e.g. a bare container id under a pod cgroup.
+func RuntimeFromCgroupPath(name string) string {
+	base := strings.TrimSuffix(path.Base(name), ".scope")
+	switch {
+	case strings.HasPrefix(base, "docker-"):
+		// systemd driver: /system.slice/docker-<id>.scope
+		return DockerRuntime
+	case strings.HasPrefix(base, "cri-containerd-"):
+		// systemd driver: /kubepods.slice/.../cri-containerd-<id>.scope
+		return ContainerdRuntime
+	case strings.HasPrefix(base, "crio-conmon-"):
+		// The conmon process of a CRI-O container, not a container itself.
+		return ""
+	case strings.HasPrefix(base, "crio-"):
+		// cgroupfs driver: /kubepods/.../crio-<id>
+		// systemd driver: /kubepods.slice/.../crio-<id>.scope
+		return CrioRuntime
+	case path.Base(path.Dir(name)) == "docker":
+		// cgroupfs driver: /docker/<id>
+		return DockerRuntime
+	}
+	return ""
+}
+
 // Create a new ContainerHandler for the specified container.
 func NewContainerHandler(name string, watchType watcher.ContainerWatchSource, metadataEnvAllowList []string, inHostNamespace bool) (ContainerHandler, bool, error) {
 	factoriesLock.RLock()
 	defer factoriesLock.RUnlock()
 
-	// Create the ContainerHandler with the first factory that supports it.
-	for _, factory := range factories[watchType] {
+	// Create the ContainerHandler with the first factory that supports it,
+	// asking the factory of the runtime recognized from the name first.
+	for _, factory := range orderFactories(factories[watchType], RuntimeFromCgroupPath(name)) {
 		canHandle, canAccept, err := factory.CanHandleAndAccept(name)
 		if err != nil {
 			klog.V(4).Infof("Error trying to work out if we can handle %s: %v", name, err)
@@ -252,6 +352,27 @@ func NewContainerHandler(name string, watchType watcher.ContainerWatchSource, me
 	return nil, false, fmt.Errorf("no known factory can handle creation of container")
 }
 
+// orderFactories returns the factories with the one of the given runtime moved
+// to the front, keeping the registration order of the others.
+func orderFactories(factories []ContainerHandlerFactory, runtime string) []ContainerHandlerFactory {
+	if runtime == "" {
+		return factories
+	}
+	for i, factory := range factories {
+		if factory.String() != runtime {
+			continue
+		}
+		if i == 0 {
+			return factories
+		}
+		ordered := make([]ContainerHandlerFactory, 0, len(factories))
+		ordered = append(ordered, factory)
+		ordered = append(ordered, factories[:i]...)
+		return append(ordered, factories[i+1:]...)
+	}
+	return factories
+}
+
 // Clear the known factories.
 func ClearContainerHandlerFactories() {
 	factoriesLock.Lock()
@@ -162,3 +162,93 @@ func TestNewContainerHandler_Accept(t *testing.T) {
 		t.Error("Expected NewContainerHandler to ignore the container.")
 	}
 }
+
+func TestNewContainerHandler_RuntimeFactoryFirst(t *testing.T) {
+	container.ClearContainerHandlerFactories()
+
+	// Register a generic factory before the CRI-O one, both accepting everything.
+	generic := &mockContainerHandlerFactory{
+		Name:           "generic",
+		CanHandleValue: true,
+		CanAcceptValue: true,
+	}
+	container.RegisterContainerHandlerFactory(generic, []watcher.ContainerWatchSource{watcher.Raw})
+	crio := &mockContainerHandlerFactory{
+		Name:           container.CrioRuntime,
+		CanHandleValue: true,
+		CanAcceptValue: true,
+	}
+	container.RegisterContainerHandlerFactory(crio, []watcher.ContainerWatchSource{watcher.Raw})
+
+	// The CRI-O factory should be asked first for a CRI-O container.
+	name := "/kubepods.slice/kubepods-besteffort.slice/crio-0123456789abcdef.scope"
+	mockContainer, err := mockFactory.NewContainerHandler(name, testMetadataEnvAllowList, true)
+	if err != nil {
+		t.Error(err)
+	}
+	crio.On("NewContainerHandler", name).Return(mockContainer, nil)
+
+	cont, _, err := container.NewContainerHandler(name, watcher.Raw, testMetadataEnvAllowList, true)
+	if err != nil {
+		t.Error(err)
+	}
+	if cont == nil {
+		t.Error("Expected container to not be nil")
+	}
+	crio.AssertExpectations(t)
+}
+
+func TestRuntimeFromCgroupPath(t *testing.T) {
+	id := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	for _, tc := range []struct {
+		name     string
+		expected string
+	}{
+		// cgroupfs driver.
+		{"/docker/" + id, container.DockerRuntime},
+		{"/kubepods/burstable/pod1234/crio-" + id, container.CrioRuntime},
+		{"/kubepods/burstable/pod1234/" + id, ""},
+		// systemd driver.
+		{"/system.slice/docker-" + id + ".scope", container.DockerRuntime},
+		{"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234.slice/docker-" + id + ".scope", container.DockerRuntime},
+		{"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234.slice/cri-containerd-" + id + ".scope", container.ContainerdRuntime},
+		{"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234.slice/crio-" + id + ".scope", container.CrioRuntime},
+		{"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234.slice/crio-conmon-" + id + ".scope", ""},
+		// Not containers.
+		{"/", ""},
+		{"/docker", ""},
+		{"/system.slice/docker.service", ""},
+		{"/user.slice/user-1000.slice/session-1.scope", ""},
+	} {
+		if got := container.RuntimeFromCgroupPath(tc.name); got != tc.expected {
+			t.Errorf("RuntimeFromCgroupPath(%q) = %q, expected %q", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestMetricSetUpdate(t *testing.T) {
+	included := container.MetricSet{container.CpuUsageMetrics: struct{}{}}
+	// Handlers hold the same set as the manager.
+	shared := included
+	clone := included.Clone()
+
+	included.Update(container.MetricSet{
+		container.CpuUsageMetrics:     struct{}{},
+		container.HugetlbUsageMetrics: struct{}{},
+	})
+	if !shared.Has(container.HugetlbUsageMetrics) {
+		t.Errorf("shared set %q misses the enabled metric", shared)
+	}
+	if clone.Has(container.HugetlbUsageMetrics) {
+		t.Errorf("cloned set %q has the enabled metric", clone)
+	}
+	// The shared map itself is never modified, its updates are swapped.
+	if _, ok := included[container.HugetlbUsageMetrics]; ok {
+		t.Errorf("shared set was modified in place")
+	}
+
+	included.Update(container.MetricSet{container.HugetlbUsageMetrics: struct{}{}})
+	if got := shared.String(); got != "hugetlb" {
+		t.Errorf("shared set is %q, expected %q", got, "hugetlb")
+	}
+}
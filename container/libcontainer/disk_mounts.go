@@ -0,0 +1,136 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcontainer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	info "github.com/google/cadvisor/info/v1"
+	"k8s.io/klog/v2"
+)
+
+// Disks of the partitions by key, or the partition itself if it is a disk.
+var parentDisks sync.Map
+
+// parentDisk returns the key of the disk a partition is on. IO is accounted to
+// disks rather than to their partitions.
+// This is defined as a variable to help in testing.
+var parentDisk = func(partition DiskKey) (DiskKey, error) {
+	devPath := fmt.Sprintf("/sys/dev/block/%d:%d", partition.Major, partition.Minor)
+	if _, err := os.Stat(path.Join(devPath, "partition")); err != nil {
+		if os.IsNotExist(err) {
+			return partition, nil
+		}
+		return DiskKey{}, err
+	}
+	dev, err := ioutil.ReadFile(path.Join(devPath, "..", "dev"))
+	if err != nil {
+		return DiskKey{}, err
+	}
+	return parseDiskKey(strings.TrimSpace(string(dev)))
+}
+
+// parseDiskKey parses the major:minor numbers of a device, e.g. "8:0".
+func parseDiskKey(dev string) (DiskKey, error) {
+	fields := strings.Split(dev, ":")
+	if len(fields) != 2 {
+		return DiskKey{}, fmt.Errorf("invalid device number %q", dev)
+	}
+	major, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return DiskKey{}, fmt.Errorf("invalid device number %q: %v", dev, err)
+	}
+	minor, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return DiskKey{}, fmt.Errorf("invalid device number %q: %v", dev, err)
+	}
+	return DiskKey{Major: major, Minor: minor}, nil
+}
+
+// diskMountsFromProc returns the mount points of the filesystems on block
+// devices in the mount namespace of the process, by device. The mount points
+// on a partition are reported for the partition and for its disk.
+func diskMountsFromProc(rootFs string, pid int) (map[DiskKey][]string, error) {
+	mounts, err := procMounts(rootFs, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	diskMounts := make(map[DiskKey][]string)
+	for _, mount := range mounts {
+		// Virtual filesystems, e.g. proc or overlay, have major number 0.
+		if mount.Major == 0 {
+			continue
+		}
+		key := DiskKey{Major: uint64(mount.Major), Minor: uint64(mount.Minor)}
+		diskMounts[key] = append(diskMounts[key], mount.Mountpoint)
+
+		disk, ok := parentDisks.Load(key)
+		if !ok {
+			disk, err = parentDisk(key)
+			if err != nil {
+				// The device may be gone already, do not cache its disk.
+				klog.V(5).Infof("Unable to get disk of block device %d:%d: %v", key.Major, key.Minor, err)
+				continue
+			}
+			parentDisks.Store(key, disk)
+		}
+		if disk != key {
+			diskMounts[disk.(DiskKey)] = append(diskMounts[disk.(DiskKey)], mount.Mountpoint)
+		}
+	}
+	for key, mountpoints := range diskMounts {
+		diskMounts[key] = uniqueSorted(mountpoints)
+	}
+	return diskMounts, nil
+}
+
+// uniqueSorted sorts the strings and removes the duplicates, e.g. the same
+// filesystem bind-mounted twice at the same mount point.
+func uniqueSorted(s []string) []string {
+	sort.Strings(s)
+	unique := s[:0]
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+// setDiskMounts sets the mount points of the devices of the disk IO stats.
+func setDiskMounts(diskIo *info.DiskIoStats, diskMounts map[DiskKey][]string) {
+	for _, stats := range [][]info.PerDiskStats{
+		diskIo.IoServiceBytes,
+		diskIo.IoServiced,
+		diskIo.IoQueued,
+		diskIo.Sectors,
+		diskIo.IoServiceTime,
+		diskIo.IoWaitTime,
+		diskIo.IoMerged,
+		diskIo.IoTime,
+	} {
+		for i := range stats {
+			stats[i].Mounts = diskMounts[DiskKey{Major: stats[i].Major, Minor: stats[i].Minor}]
+		}
+	}
+}
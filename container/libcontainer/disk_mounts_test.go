@@ -0,0 +1,80 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcontainer
+
+import (
+	"testing"
+
+	info "github.com/google/cadvisor/info/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskMountsFromProc(t *testing.T) {
+	defer func(f func(DiskKey) (DiskKey, error)) { parentDisk = f }(parentDisk)
+	// sda1 is a partition of sda, sdb has no partitions.
+	parentDisk = func(partition DiskKey) (DiskKey, error) {
+		if partition == (DiskKey{Major: 8, Minor: 1}) {
+			return DiskKey{Major: 8, Minor: 0}, nil
+		}
+		return partition, nil
+	}
+	defer func() {
+		parentDisks.Range(func(key, _ interface{}) bool {
+			parentDisks.Delete(key)
+			return true
+		})
+	}()
+
+	diskMounts, err := diskMountsFromProc("testdata/procfs", 1234)
+	require.NoError(t, err)
+	// The overlay root and proc are not on a block device.
+	assert.Equal(t, map[DiskKey][]string{
+		{Major: 8, Minor: 0}:  {"/etc/hostname", "/etc/resolv.conf"},
+		{Major: 8, Minor: 1}:  {"/etc/hostname", "/etc/resolv.conf"},
+		{Major: 8, Minor: 16}: {"/mnt/data", "/var/lib/postgresql/data"},
+	}, diskMounts)
+
+	diskIo := info.DiskIoStats{
+		IoServiceBytes: []info.PerDiskStats{
+			{Major: 8, Minor: 0, Stats: map[string]uint64{"Read": 4096}},
+			{Major: 8, Minor: 16, Stats: map[string]uint64{"Write": 8192}},
+			{Major: 253, Minor: 0, Stats: map[string]uint64{"Write": 512}},
+		},
+		IoServiced: []info.PerDiskStats{
+			{Major: 8, Minor: 16, Stats: map[string]uint64{"Write": 2}},
+		},
+	}
+	setDiskMounts(&diskIo, diskMounts)
+	assert.Equal(t, []string{"/etc/hostname", "/etc/resolv.conf"}, diskIo.IoServiceBytes[0].Mounts)
+	assert.Equal(t, []string{"/mnt/data", "/var/lib/postgresql/data"}, diskIo.IoServiceBytes[1].Mounts)
+	assert.Nil(t, diskIo.IoServiceBytes[2].Mounts)
+	assert.Equal(t, []string{"/mnt/data", "/var/lib/postgresql/data"}, diskIo.IoServiced[0].Mounts)
+
+	_, err = diskMountsFromProc("testdata/procfs", 4321)
+	assert.Error(t, err)
+}
+
+func TestParseDiskKey(t *testing.T) {
+	key, err := parseDiskKey("259:3")
+	assert.NoError(t, err)
+	assert.Equal(t, DiskKey{Major: 259, Minor: 3}, key)
+
+	for _, dev := range []string{"", "8", "8:a", "a:0", "8:0:1"} {
+		_, err := parseDiskKey(dev)
+		assert.Error(t, err, dev)
+	}
+}
@@ -18,24 +18,31 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"path"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/opencontainers/runc/libcontainer"
 	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fs"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fs2"
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/klog/v2"
 
 	"github.com/google/cadvisor/container"
 	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/utils/ratelimitedlog"
 )
 
 var (
@@ -55,7 +62,9 @@ type Handler struct {
 	pid             int
 	includedMetrics container.MetricSet
 	pidMetricsCache map[int]*info.CpuSchedstat
+	taskSwitches    taskSwitchesCache
 	cycles          uint64
+	log             *ratelimitedlog.Logger
 }
 
 func NewHandler(cgroupManager cgroups.Manager, rootFs string, pid int, includedMetrics container.MetricSet) *Handler {
@@ -65,6 +74,7 @@ func NewHandler(cgroupManager cgroups.Manager, rootFs string, pid int, includedM
 		pid:             pid,
 		includedMetrics: includedMetrics,
 		pidMetricsCache: make(map[int]*info.CpuSchedstat),
+		log:             ratelimitedlog.New(),
 	}
 }
 
@@ -80,26 +90,93 @@ func (h *Handler) GetStats() (*info.ContainerStats, error) {
 		}
 	}
 
-	cgroupStats, err := h.cgroupManager.GetStats()
+	var cgroupStats *cgroups.Stats
+	var err error
+	if cgroups.IsCgroup2UnifiedMode() {
+		cgroupStats, err = h.cgroupManager.GetStats()
+		if err != nil && cgroupStats != nil && !ignoreStatsError {
+			// Stats of the controllers that could be read are still returned.
+			countCgroupV2ReadErrors(h.cgroupManager.Path(""), err)
+			h.log.Infof(4, "Unable to read some cgroup stats of %q: %v", h.cgroupManager.Path(""), err)
+			err = nil
+		}
+	} else {
+		paths := h.cgroupV1Paths()
+		cgroupStats, err = readCgroupV1Stats(paths, h.cgroupV1Subsystems(paths))
+	}
 	if err != nil {
 		if !ignoreStatsError {
 			return nil, err
 		}
-		klog.V(4).Infof("Ignoring errors when gathering stats for root cgroup since some controllers don't have stats on the root cgroup: %v", err)
+		h.log.Infof(4, "Ignoring errors when gathering stats for root cgroup since some controllers don't have stats on the root cgroup: %v", err)
 	}
 	libcontainerStats := &libcontainer.Stats{
 		CgroupStats: cgroupStats,
 	}
 	stats := newContainerStats(libcontainerStats, h.includedMetrics)
+	if stats.Memory.CgroupV2 != nil {
+		// The root cgroup has no memory.events file.
+		events, err := readMemoryEvents(h.cgroupManager.Path(""))
+		if err != nil {
+			h.log.Infof(5, "Unable to read memory events of %q: %v", h.cgroupManager.Path(""), err)
+		} else {
+			stats.Memory.CgroupV2.HighEvents = events["high"]
+		}
+		stats.Memory.CgroupV2.Zswap = readZswapStats(h.cgroupManager.Path(""), cgroupStats.MemoryStats.Stats)
+		stats.Memory.CgroupV2.Reclaim = reclaimStats(cgroupStats.MemoryStats.Stats)
+		// Without swap accounting, the memory.swap.* files are missing.
+		if _, err := os.Stat(path.Join(h.cgroupManager.Path(""), "memory.swap.current")); err == nil {
+			stats.Memory.SwapActivity = swapActivityStats(cgroupStats.MemoryStats.Stats)
+		}
+	} else if memoryPath, ok := h.cgroupManager.GetPaths()["memory"]; ok && !cgroups.IsCgroup2UnifiedMode() {
+		// On cgroup v2 the socket memory is part of memory.stat instead.
+		stats.Memory.TCP = readTCPMemoryStats(memoryPath)
+	}
+
+	if h.includedMetrics.Has(container.CpuUsageMetrics) {
+		// runc doesn't parse the burst statistics of cpu.stat.
+		if cpuPath := h.cgroupManager.Path("cpu"); cpuPath != "" {
+			bursts, burstTime, err := readCPUBurstStats(cpuPath)
+			if err != nil {
+				h.log.Infof(5, "Unable to read the cpu burst stats of %q: %v", cpuPath, err)
+			} else {
+				stats.Cpu.CFS.Bursts = bursts
+				stats.Cpu.CFS.BurstTime = burstTime
+			}
+		}
+	}
+
+	if h.includedMetrics.Has(container.CPUSetMetrics) {
+		// Without the cpuset controller the CPUs are left unset.
+		if cpusetPath := h.cgroupManager.Path("cpuset"); cpusetPath != "" {
+			cpus, err := readCpusetCpus(cpusetPath, cgroups.IsCgroup2UnifiedMode())
+			if err != nil {
+				h.log.Infof(5, "Unable to read the cpuset of %q: %v", cpusetPath, err)
+			} else {
+				stats.CpuSet.Cpus = cpus
+			}
+		}
+	}
+
+	if h.includedMetrics.Has(container.DiskIOMetrics) && cgroups.IsCgroup2UnifiedMode() && len(stats.DiskIo.IoServiceTime) == 0 {
+		// runc doesn't parse the io cost usage of io.stat, which is the closest
+		// cgroup v2 has to the service time of blkio.io_service_time.
+		usage, err := readIoCostUsage(h.cgroupManager.Path(""))
+		if err != nil {
+			h.log.Infof(5, "Unable to read io cost usage of %q: %v", h.cgroupManager.Path(""), err)
+		} else {
+			stats.DiskIo.IoServiceTime = DiskStatsCopy(usage)
+		}
+	}
 
 	if h.includedMetrics.Has(container.ProcessSchedulerMetrics) {
 		pids, err := h.cgroupManager.GetAllPids()
 		if err != nil {
-			klog.V(4).Infof("Could not get PIDs for container %d: %v", h.pid, err)
+			h.log.Infof(4, "Could not get PIDs for container %d: %v", h.pid, err)
 		} else {
 			stats.Cpu.Schedstat, err = schedulerStatsFromProcs(h.rootFs, pids, h.pidMetricsCache)
 			if err != nil {
-				klog.V(4).Infof("Unable to get Process Scheduler Stats: %v", err)
+				h.log.Infof(4, "Unable to get Process Scheduler Stats: %v", err)
 			}
 		}
 	}
@@ -108,11 +185,11 @@ func (h *Handler) GetStats() (*info.ContainerStats, error) {
 		h.cycles++
 		pids, err := h.cgroupManager.GetPids()
 		if err != nil {
-			klog.V(4).Infof("Could not get PIDs for container %d: %v", h.pid, err)
+			h.log.Infof(4, "Could not get PIDs for container %d: %v", h.pid, err)
 		} else {
 			stats.ReferencedMemory, err = referencedBytesStat(pids, h.cycles, *referencedResetInterval)
 			if err != nil {
-				klog.V(4).Infof("Unable to get referenced bytes: %v", err)
+				h.log.Infof(4, "Unable to get referenced bytes: %v", err)
 			}
 		}
 	}
@@ -122,7 +199,7 @@ func (h *Handler) GetStats() (*info.ContainerStats, error) {
 		if h.includedMetrics.Has(container.NetworkUsageMetrics) {
 			netStats, err := networkStatsFromProc(h.rootFs, h.pid)
 			if err != nil {
-				klog.V(4).Infof("Unable to get network stats from pid %d: %v", h.pid, err)
+				h.log.Infof(4, "Unable to get network stats from pid %d: %v", h.pid, err)
 			} else {
 				stats.Network.Interfaces = append(stats.Network.Interfaces, netStats...)
 			}
@@ -130,14 +207,14 @@ func (h *Handler) GetStats() (*info.ContainerStats, error) {
 		if h.includedMetrics.Has(container.NetworkTcpUsageMetrics) {
 			t, err := tcpStatsFromProc(h.rootFs, h.pid, "net/tcp")
 			if err != nil {
-				klog.V(4).Infof("Unable to get tcp stats from pid %d: %v", h.pid, err)
+				h.log.Infof(4, "Unable to get tcp stats from pid %d: %v", h.pid, err)
 			} else {
 				stats.Network.Tcp = t
 			}
 
 			t6, err := tcpStatsFromProc(h.rootFs, h.pid, "net/tcp6")
 			if err != nil {
-				klog.V(4).Infof("Unable to get tcp6 stats from pid %d: %v", h.pid, err)
+				h.log.Infof(4, "Unable to get tcp6 stats from pid %d: %v", h.pid, err)
 			} else {
 				stats.Network.Tcp6 = t6
 			}
@@ -146,7 +223,7 @@ func (h *Handler) GetStats() (*info.ContainerStats, error) {
 		if h.includedMetrics.Has(container.NetworkAdvancedTcpUsageMetrics) {
 			ta, err := advancedTCPStatsFromProc(h.rootFs, h.pid, "net/netstat", "net/snmp")
 			if err != nil {
-				klog.V(4).Infof("Unable to get advanced tcp stats from pid %d: %v", h.pid, err)
+				h.log.Infof(4, "Unable to get advanced tcp stats from pid %d: %v", h.pid, err)
 			} else {
 				stats.Network.TcpAdvanced = ta
 			}
@@ -154,18 +231,38 @@ func (h *Handler) GetStats() (*info.ContainerStats, error) {
 		if h.includedMetrics.Has(container.NetworkUdpUsageMetrics) {
 			u, err := udpStatsFromProc(h.rootFs, h.pid, "net/udp")
 			if err != nil {
-				klog.V(4).Infof("Unable to get udp stats from pid %d: %v", h.pid, err)
+				h.log.Infof(4, "Unable to get udp stats from pid %d: %v", h.pid, err)
 			} else {
 				stats.Network.Udp = u
 			}
 
 			u6, err := udpStatsFromProc(h.rootFs, h.pid, "net/udp6")
 			if err != nil {
-				klog.V(4).Infof("Unable to get udp6 stats from pid %d: %v", h.pid, err)
+				h.log.Infof(4, "Unable to get udp6 stats from pid %d: %v", h.pid, err)
 			} else {
 				stats.Network.Udp6 = u6
 			}
 		}
+		if h.includedMetrics.Has(container.ProcessMetrics) {
+			stats.ProcMetrics = procMetricsFromProc(h.rootFs, h.pid, getProcMetrics())
+		}
+		if h.includedMetrics.Has(container.DiskIOMetrics) {
+			diskMounts, err := diskMountsFromProc(h.rootFs, h.pid)
+			if err != nil {
+				h.log.Infof(4, "Unable to get mounts of pid %d: %v", h.pid, err)
+			} else {
+				setDiskMounts(&stats.DiskIo, diskMounts)
+			}
+		}
+		// The root cgroup reports the filesystems of the host instead.
+		if h.includedMetrics.Has(container.DiskUsageMetrics) && h.pid != 1 {
+			tmpfsStats, err := tmpfsStatsFromProc(h.rootFs, h.pid)
+			if err != nil {
+				h.log.Infof(4, "Unable to get tmpfs stats from pid %d: %v", h.pid, err)
+			} else {
+				stats.TmpfsFilesystems = tmpfsStats
+			}
+		}
 	}
 	// some process metrics are per container ( number of processes, number of
 	// file descriptors etc.) and not required a proper container's
@@ -174,16 +271,30 @@ func (h *Handler) GetStats() (*info.ContainerStats, error) {
 		paths := h.cgroupManager.GetPaths()
 		path, ok := paths["cpu"]
 		if !ok {
-			klog.V(4).Infof("Could not find cgroups CPU for container %d", h.pid)
+			h.log.Infof(4, "Could not find cgroups CPU for container %d", h.pid)
 		} else {
-			stats.Processes, err = processStatsFromProcs(h.rootFs, path, h.pid)
+			stats.Processes, err = processStatsFromProcs(h.rootFs, path, h.pid, &h.taskSwitches)
 			if err != nil {
-				klog.V(4).Infof("Unable to get Process Stats: %v", err)
+				h.log.Infof(4, "Unable to get Process Stats: %v", err)
 			}
 		}
+		if h.includedMetrics.Has(container.ProcessSchedulerMetrics) {
+			stats.Processes.SchedRunTime = stats.Cpu.Schedstat.RunTime
+			stats.Processes.SchedWaitTime = stats.Cpu.Schedstat.RunqueueTime
+		}
 
 		// if include processes metrics, just set threads metrics if exist, and has no relationship with cpu path
 		setThreadsStats(cgroupStats, stats)
+
+		// runc doesn't read pids.events.
+		if pidsPath := h.cgroupManager.Path("pids"); pidsPath != "" {
+			hits, err := readPidsLimitHits(pidsPath)
+			if err != nil {
+				h.log.Infof(5, "Unable to read the pids events of %q: %v", pidsPath, err)
+			} else {
+				stats.Processes.PidsLimitHits = hits
+			}
+		}
 	}
 
 	// For backwards compatibility.
@@ -194,6 +305,144 @@ func (h *Handler) GetStats() (*info.ContainerStats, error) {
 	return stats, nil
 }
 
+// cgroupSubsystem reads the stats of a single cgroup v1 controller.
+type cgroupSubsystem interface {
+	Name() string
+	GetStats(path string, stats *cgroups.Stats) error
+}
+
+// cgroupV1Subsystems are the cgroup v1 controllers stats can be read from.
+var cgroupV1Subsystems = map[string]cgroupSubsystem{
+	"cpuset":  &fs.CpusetGroup{},
+	"memory":  &fs.MemoryGroup{},
+	"cpu":     &fs.CpuGroup{},
+	"cpuacct": &fs.CpuacctGroup{},
+	"pids":    &fs.PidsGroup{},
+	"blkio":   &fs.BlkioGroup{},
+	"hugetlb": &fs.HugetlbGroup{},
+}
+
+// cgroupV1SubsystemMetrics are the metrics needing the stats of a cgroup v1
+// controller. The stats of the controllers missing here are always read.
+var cgroupV1SubsystemMetrics = map[string]container.MetricKind{
+	"cpuset":  container.CPUSetMetrics,
+	"memory":  container.MemoryUsageMetrics,
+	"cpu":     container.CpuUsageMetrics,
+	"pids":    container.ProcessMetrics,
+	"blkio":   container.DiskIOMetrics,
+	"hugetlb": container.HugetlbUsageMetrics,
+}
+
+// cgroupV1Subsystems returns the controllers of paths whose stats are needed by
+// the included metrics, in a stable order.
+func (h *Handler) cgroupV1Subsystems(paths map[string]string) []cgroupSubsystem {
+	names := make([]string, 0, len(paths))
+	for name := range paths {
+		if _, ok := cgroupV1Subsystems[name]; !ok {
+			continue
+		}
+		if metric, ok := cgroupV1SubsystemMetrics[name]; ok && !h.includedMetrics.Has(metric) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	subsystems := make([]cgroupSubsystem, 0, len(names))
+	for _, name := range names {
+		subsystems = append(subsystems, cgroupV1Subsystems[name])
+	}
+	return subsystems
+}
+
+// CgroupReadErrors counts failures to read the stats of a cgroup controller.
+var CgroupReadErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cadvisor_cgroup_read_errors_total",
+	Help: "Number of failures to read the stats of a cgroup controller, by controller and error type.",
+}, []string{"controller", "error"})
+
+func countCgroupReadError(controller string, err error) {
+	errorType := "other"
+	switch {
+	case errors.Is(err, syscall.EACCES), errors.Is(err, syscall.EPERM):
+		errorType = "permission_denied"
+	case errors.Is(err, syscall.ENODEV):
+		errorType = "no_device"
+	case errors.Is(err, syscall.ENOENT):
+		errorType = "not_found"
+	}
+	CgroupReadErrors.WithLabelValues(controller, errorType).Inc()
+}
+
+// cgroupV2StatFiles are the files runc reads the stats of a cgroup v2
+// controller from, and whether the controller may lack them.
+var cgroupV2StatFiles = []struct {
+	controller string
+	file       string
+	optional   bool
+}{
+	{"pids", "pids.current", false},
+	{"memory", "memory.stat", true},
+	{"io", "io.stat", true},
+	{"cpu", "cpu.stat", true},
+}
+
+// countCgroupV2ReadErrors counts the failure to read the stats of the cgroup v2
+// at cgroupPath by controller. runc only returns the errors of all the controllers
+// as one message, so the stat file of each controller is read again to find
+// the failing ones.
+func countCgroupV2ReadErrors(cgroupPath string, err error) {
+	counted := false
+	for _, stat := range cgroupV2StatFiles {
+		_, readErr := ioutil.ReadFile(path.Join(cgroupPath, stat.file))
+		if readErr == nil || (stat.optional && os.IsNotExist(readErr)) {
+			continue
+		}
+		countCgroupReadError(stat.controller, readErr)
+		counted = true
+	}
+	if !counted {
+		countCgroupReadError("unified", err)
+	}
+}
+
+// cgroupV1Paths returns the paths of the cgroup of the container in the
+// hierarchies of the subsystems needed by the included metrics, which may have
+// been updated since the cgroup manager was created.
+func (h *Handler) cgroupV1Paths() map[string]string {
+	paths := h.cgroupManager.GetPaths()
+	config, err := h.cgroupManager.GetCgroups()
+	if err != nil || config == nil {
+		return paths
+	}
+	return CurrentCgroupPaths(config.Name, paths)
+}
+
+// readCgroupV1Stats reads the stats of every controller in paths. A failure to read a
+// controller is counted and the stats of the remaining controllers are still returned.
+// An error is only returned if no controller could be read.
+func readCgroupV1Stats(paths map[string]string, subsystems []cgroupSubsystem) (*cgroups.Stats, error) {
+	stats := cgroups.NewStats()
+	var lastErr error
+	read := 0
+	for _, sys := range subsystems {
+		path := paths[sys.Name()]
+		if path == "" {
+			continue
+		}
+		if err := sys.GetStats(path, stats); err != nil {
+			countCgroupReadError(sys.Name(), err)
+			klog.V(4).Infof("Unable to read %s cgroup stats from %q: %v", sys.Name(), path, err)
+			lastErr = err
+			continue
+		}
+		read++
+	}
+	if read == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return stats, nil
+}
+
 func parseUlimit(value string) (int64, error) {
 	num, err := strconv.ParseInt(value, 10, 64)
 	if err != nil {
@@ -263,7 +512,254 @@ func processRootProcUlimits(rootFs string, rootPid int) []info.UlimitSpec {
 	return processLimitsFile(string(out))
 }
 
-func processStatsFromProcs(rootFs string, cgroupPath string, rootPid int) (info.ProcessStats, error) {
+// UpdateSpecFromProc fills in the parts of spec that are read from the procfs
+// entries of the container's init process. It is a no-op if the pid is unknown.
+func (h *Handler) UpdateSpecFromProc(spec *info.ContainerSpec) {
+	if h.pid <= 0 {
+		return
+	}
+	spec.Security = securitySpecFromProc(h.rootFs, h.pid)
+	spec.Namespaces = namespacesFromProc(h.rootFs, h.pid)
+	spec.Oom = oomSpecFromProc(h.rootFs, h.pid)
+	spec.Scheduling = schedulingSpecFromProc(h.rootFs, h.pid)
+	startTime, err := processStartTime(h.rootFs, h.pid)
+	if err != nil {
+		klog.V(4).Infof("error while getting start time of pid %d: %v", h.pid, err)
+	} else {
+		spec.StartTime = startTime
+	}
+}
+
+// oomSpecFromProc returns the OOM score adjustment and score of the process, or
+// nil if its oom_score_adj can't be read, e.g. because the process exited.
+func oomSpecFromProc(rootFs string, pid int) *info.OomSpec {
+	procPath := path.Join(rootFs, "/proc", strconv.Itoa(pid))
+	scoreAdj, err := readProcInt(path.Join(procPath, "oom_score_adj"))
+	if err != nil {
+		klog.V(4).Infof("error while reading oom_score_adj of pid %d: %v", pid, err)
+		return nil
+	}
+	spec := &info.OomSpec{ScoreAdj: scoreAdj}
+	score, err := readProcInt(path.Join(procPath, "oom_score"))
+	if err != nil {
+		klog.V(4).Infof("error while reading oom_score of pid %d: %v", pid, err)
+	} else {
+		spec.Score = score
+	}
+	return spec
+}
+
+// schedulingSpecFromProc returns the nice value and priority of the process,
+// or nil if its stat can't be read, e.g. because the process exited.
+func schedulingSpecFromProc(rootFs string, pid int) *info.SchedulingSpec {
+	stat, err := ioutil.ReadFile(path.Join(rootFs, "/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		klog.V(4).Infof("error while reading stat of pid %d: %v", pid, err)
+		return nil
+	}
+	priority, nice, err := parsePriority(string(stat))
+	if err != nil {
+		klog.V(4).Infof("error while parsing stat of pid %d: %v", pid, err)
+		return nil
+	}
+	return &info.SchedulingSpec{Nice: nice, Priority: priority}
+}
+
+// parsePriority returns the priority and nice fields of /proc/<pid>/stat.
+func parsePriority(stat string) (priority int, nice int, err error) {
+	// The command name, 2nd field, is in parentheses and may contain spaces.
+	end := strings.LastIndex(stat, ")")
+	if end < 0 {
+		return 0, 0, fmt.Errorf("invalid stat %q: missing command name", stat)
+	}
+	// Fields after the command name, starting with the 3rd one, state.
+	fields := strings.Fields(stat[end+1:])
+	const priorityField, niceField = 18, 19
+	if len(fields) < niceField-2 {
+		return 0, 0, fmt.Errorf("invalid stat %q: missing nice field", stat)
+	}
+	priority, err = strconv.Atoi(fields[priorityField-3])
+	if err != nil {
+		return 0, 0, err
+	}
+	nice, err = strconv.Atoi(fields[niceField-3])
+	if err != nil {
+		return 0, 0, err
+	}
+	return priority, nice, nil
+}
+
+// readProcInt returns the integer held by a single-value procfs file.
+func readProcInt(file string) (int, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(content)))
+}
+
+// namespaceTypes are the types of the namespaces reported in the container spec.
+var namespaceTypes = []string{"cgroup", "ipc", "mnt", "net", "pid", "user", "uts"}
+
+// namespacesFromProc returns the inode numbers of the namespaces of the process
+// by type, read from the /proc/<pid>/ns/<type> links, e.g. "net:[4026531992]".
+func namespacesFromProc(rootFs string, pid int) map[string]uint64 {
+	nsPath := path.Join(rootFs, "/proc", strconv.Itoa(pid), "ns")
+	namespaces := make(map[string]uint64, len(namespaceTypes))
+	for _, nsType := range namespaceTypes {
+		target, err := os.Readlink(path.Join(nsPath, nsType))
+		if err != nil {
+			// Kernels without support for the namespace type lack its link.
+			klog.V(5).Infof("error while reading %s namespace of pid %d: %v", nsType, pid, err)
+			continue
+		}
+		inode, err := parseNamespaceLink(nsType, target)
+		if err != nil {
+			klog.V(4).Infof("error while parsing %s namespace of pid %d: %v", nsType, pid, err)
+			continue
+		}
+		namespaces[nsType] = inode
+	}
+	if len(namespaces) == 0 {
+		return nil
+	}
+	return namespaces
+}
+
+// parseNamespaceLink returns the inode number of the namespace given the
+// target of its link, e.g. "net:[4026531992]".
+func parseNamespaceLink(nsType, target string) (uint64, error) {
+	prefix := nsType + ":["
+	if !strings.HasPrefix(target, prefix) || !strings.HasSuffix(target, "]") {
+		return 0, fmt.Errorf("unexpected namespace link %q", target)
+	}
+	return strconv.ParseUint(target[len(prefix):len(target)-1], 10, 64)
+}
+
+// clockTicks is the USER_HZ unit of the times in procfs, fixed at 100 on Linux.
+const clockTicks = 100
+
+// processStartTime returns the wall clock time at which the process started.
+func processStartTime(rootFs string, pid int) (time.Time, error) {
+	stat, err := ioutil.ReadFile(path.Join(rootFs, "/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	startTicks, err := parseStartTime(string(stat))
+	if err != nil {
+		return time.Time{}, err
+	}
+	bootTime, err := readBootTime(path.Join(rootFs, "/proc/stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ticksSinceBoot(bootTime, startTicks), nil
+}
+
+// parseStartTime returns the starttime field of /proc/<pid>/stat, the time the
+// process started after boot in clock ticks.
+func parseStartTime(stat string) (uint64, error) {
+	// The command name, 2nd field, is in parentheses and may contain spaces.
+	end := strings.LastIndex(stat, ")")
+	if end < 0 {
+		return 0, fmt.Errorf("invalid stat %q: missing command name", stat)
+	}
+	// Fields after the command name, starting with the 3rd one, state.
+	fields := strings.Fields(stat[end+1:])
+	const startTimeField = 22
+	if len(fields) < startTimeField-2 {
+		return 0, fmt.Errorf("invalid stat %q: missing starttime field", stat)
+	}
+	return strconv.ParseUint(fields[startTimeField-3], 10, 64)
+}
+
+// readBootTime returns the boot time of the machine from the btime line of
+// /proc/stat, in seconds since the epoch.
+func readBootTime(statPath string) (int64, error) {
+	f, err := os.Open(statPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "btime" {
+			return strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("btime not found in %q", statPath)
+}
+
+// ticksSinceBoot converts a number of clock ticks since boot to wall clock time.
+func ticksSinceBoot(bootTime int64, ticks uint64) time.Time {
+	sinceBoot := time.Duration(ticks/clockTicks)*time.Second + time.Duration(ticks%clockTicks)*time.Second/clockTicks
+	return time.Unix(bootTime, 0).Add(sinceBoot)
+}
+
+func securitySpecFromProc(rootFs string, pid int) info.SecuritySpec {
+	procPath := path.Join(rootFs, "/proc", strconv.Itoa(pid))
+	spec := info.SecuritySpec{
+		AppArmorProfile: "unconfined",
+	}
+
+	// The seccomp mode is left empty when it is unknown rather than claiming
+	// it is disabled.
+	status, err := ioutil.ReadFile(path.Join(procPath, "status"))
+	if err != nil {
+		klog.V(4).Infof("error while reading status of pid %d: %v", pid, err)
+	} else {
+		spec.SeccompMode = parseSeccompMode(string(status))
+	}
+
+	// Kernels without AppArmor enabled return an error or an empty value here.
+	current, err := ioutil.ReadFile(path.Join(procPath, "attr", "current"))
+	if err == nil {
+		spec.AppArmorProfile, spec.AppArmorMode = parseAppArmorProfile(string(current))
+	}
+
+	return spec
+}
+
+// parseSeccompMode returns the seccomp mode from the contents of /proc/<pid>/status,
+// or an empty string if the mode is unknown. Kernels built without seccomp
+// have no Seccomp line, their processes can't use it.
+func parseSeccompMode(status string) string {
+	for _, line := range strings.Split(status, "\n") {
+		if !strings.HasPrefix(line, "Seccomp:") {
+			continue
+		}
+		switch strings.TrimSpace(strings.TrimPrefix(line, "Seccomp:")) {
+		case "0":
+			return "disabled"
+		case "1":
+			return "strict"
+		case "2":
+			return "filter"
+		default:
+			return ""
+		}
+	}
+	return "disabled"
+}
+
+// parseAppArmorProfile returns the profile and mode from the contents of
+// /proc/<pid>/attr/current, e.g. "docker-default (enforce)".
+func parseAppArmorProfile(current string) (string, string) {
+	current = strings.TrimSpace(strings.TrimRight(current, "\x00"))
+	if current == "" || current == "unconfined" {
+		return "unconfined", ""
+	}
+	if i := strings.LastIndex(current, " ("); i > 0 && strings.HasSuffix(current, ")") {
+		return current[:i], current[i+2 : len(current)-1]
+	}
+	return current, ""
+}
+
+func processStatsFromProcs(rootFs string, cgroupPath string, rootPid int, taskSwitchesCache *taskSwitchesCache) (info.ProcessStats, error) {
 	var fdCount, socketCount uint64
 	filePath := path.Join(cgroupPath, "cgroup.procs")
 	out, err := ioutil.ReadFile(filePath)
@@ -306,6 +802,11 @@ func processStatsFromProcs(rootFs string, cgroupPath string, rootPid int) (info.
 		FdCount:      fdCount,
 		SocketCount:  socketCount,
 	}
+	processStats.States = processStatesFromProcs(rootFs, pids)
+	switches := taskSwitchesCache.update(taskSwitchesFromProcs(rootFs, pids))
+	processStats.VoluntaryContextSwitches = switches.voluntary
+	processStats.InvoluntaryContextSwitches = switches.involuntary
+	processStats.CpuMigrations = switches.migrations
 
 	if rootPid > 0 {
 		processStats.Ulimits = processRootProcUlimits(rootFs, rootPid)
@@ -314,6 +815,155 @@ func processStatsFromProcs(rootFs string, cgroupPath string, rootPid int) (info.
 	return processStats, nil
 }
 
+// taskSwitches counts the context switches and cpu migrations of threads.
+type taskSwitches struct {
+	voluntary   uint64
+	involuntary uint64
+	migrations  uint64
+}
+
+func (s *taskSwitches) add(other taskSwitches) {
+	s.voluntary += other.voluntary
+	s.involuntary += other.involuntary
+	s.migrations += other.migrations
+}
+
+// taskSwitchesCache keeps the counts of the threads which exited, so that the
+// counts of a container don't decrease when its threads exit.
+type taskSwitchesCache struct {
+	// Counts of the threads seen last time, by tid.
+	tasks map[string]taskSwitches
+	// Sum of the counts of the threads which exited.
+	exited taskSwitches
+}
+
+// update replaces the counts of the threads by the current ones, and returns
+// the counts of the container, including the threads which exited.
+func (c *taskSwitchesCache) update(tasks map[string]taskSwitches) taskSwitches {
+	for tid, last := range c.tasks {
+		current, ok := tasks[tid]
+		// A thread whose counts went down is a new thread reusing the tid.
+		if !ok || current.voluntary < last.voluntary || current.involuntary < last.involuntary || current.migrations < last.migrations {
+			c.exited.add(last)
+		}
+	}
+	c.tasks = tasks
+	total := c.exited
+	for _, task := range tasks {
+		total.add(task)
+	}
+	return total
+}
+
+// taskSwitchesFromProcs returns the context switches of all the threads of
+// the given processes by tid, read from /proc/<pid>/task/<tid>/status, and
+// their migrations between cpus, read from /proc/<pid>/task/<tid>/sched.
+// Threads without sched, on kernels built without CONFIG_SCHED_DEBUG, have no
+// migrations. Threads which exited meanwhile are skipped.
+func taskSwitchesFromProcs(rootFs string, pids []string) map[string]taskSwitches {
+	tasks := map[string]taskSwitches{}
+	for _, pid := range pids {
+		tasksPath := path.Join(rootFs, "/proc", pid, "task")
+		taskDirs, err := ioutil.ReadDir(tasksPath)
+		if err != nil {
+			klog.V(4).Infof("error while listing directory %q to read context switches: %v", tasksPath, err)
+			continue
+		}
+		for _, taskDir := range taskDirs {
+			statusPath := path.Join(tasksPath, taskDir.Name(), "status")
+			status, err := ioutil.ReadFile(statusPath)
+			if err != nil {
+				if !os.IsNotExist(err) {
+					klog.V(4).Infof("error while reading %q: %v", statusPath, err)
+				}
+				continue
+			}
+			fields := procFields(string(status))
+			task := taskSwitches{
+				voluntary:   parseProcField(statusPath, fields, "voluntary_ctxt_switches"),
+				involuntary: parseProcField(statusPath, fields, "nonvoluntary_ctxt_switches"),
+			}
+
+			schedPath := path.Join(tasksPath, taskDir.Name(), "sched")
+			if sched, err := ioutil.ReadFile(schedPath); err != nil {
+				if !os.IsNotExist(err) {
+					klog.V(4).Infof("error while reading %q: %v", schedPath, err)
+				}
+			} else {
+				task.migrations = parseProcField(schedPath, procFields(string(sched)), "se.nr_migrations")
+			}
+			tasks[taskDir.Name()] = task
+		}
+	}
+	return tasks
+}
+
+// procFields returns the values of the "name: value" lines of a proc file,
+// e.g. /proc/<pid>/status, by name.
+func procFields(content string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		fields[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	return fields
+}
+
+// parseProcField parses a counter of a proc file, zero if it is missing or
+// invalid.
+func parseProcField(filePath string, fields map[string]string, name string) uint64 {
+	value, ok := fields[name]
+	if !ok {
+		return 0
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		klog.V(4).Infof("error while parsing %s of %q: %v", name, filePath, err)
+		return 0
+	}
+	return n
+}
+
+// processStatesFromProcs counts the given processes by the state of their
+// /proc/<pid>/stat. Processes which exited meanwhile are skipped.
+func processStatesFromProcs(rootFs string, pids []string) map[string]uint64 {
+	states := make(map[string]uint64)
+	for _, pid := range pids {
+		statPath := path.Join(rootFs, "/proc", pid, "stat")
+		stat, err := ioutil.ReadFile(statPath)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				klog.V(4).Infof("error while reading %q: %v", statPath, err)
+			}
+			continue
+		}
+		state, err := parseProcessState(string(stat))
+		if err != nil {
+			klog.V(4).Infof("error while parsing %q: %v", statPath, err)
+			continue
+		}
+		states[state]++
+	}
+	return states
+}
+
+// parseProcessState returns the state field of /proc/<pid>/stat.
+func parseProcessState(stat string) (string, error) {
+	// The command name, 2nd field, is in parentheses and may contain spaces.
+	end := strings.LastIndex(stat, ")")
+	if end < 0 {
+		return "", fmt.Errorf("invalid stat %q: missing command name", stat)
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) == 0 {
+		return "", fmt.Errorf("invalid stat %q: missing state field", stat)
+	}
+	return fields[0], nil
+}
+
 func schedulerStatsFromProcs(rootFs string, pids []int, pidMetricsCache map[int]*info.CpuSchedstat) (info.CpuSchedstat, error) {
 	for _, pid := range pids {
 		f, err := os.Open(path.Join(rootFs, "proc", strconv.Itoa(pid), "schedstat"))
@@ -505,10 +1155,12 @@ func scanInterfaceStats(netStatsFile string) ([]info.InterfaceStats, error) {
 			Name: devName,
 		}
 
-		statFields := append(fields[1:5], fields[9:13]...)
+		statFields := fields[1:]
 		statPointers := []*uint64{
 			&i.RxBytes, &i.RxPackets, &i.RxErrors, &i.RxDropped,
+			&i.RxFifo, &i.RxFrame, &i.RxCompressed, &i.RxMulticast,
 			&i.TxBytes, &i.TxPackets, &i.TxErrors, &i.TxDropped,
+			&i.TxFifo, &i.TxCollisions, &i.TxCarrier, &i.TxCompressed,
 		}
 
 		err := setInterfaceStatValues(statFields, statPointers)
@@ -799,6 +1451,7 @@ func setMemoryStats(s *cgroups.Stats, ret *info.ContainerStats) {
 		ret.Memory.RSS = s.MemoryStats.Stats["anon"]
 		ret.Memory.Swap = s.MemoryStats.SwapUsage.Usage
 		ret.Memory.MappedFile = s.MemoryStats.Stats["file_mapped"]
+		ret.Memory.CgroupV2 = memoryStatsCgroupV2(s.MemoryStats.Stats)
 	} else if s.MemoryStats.UseHierarchy {
 		ret.Memory.Cache = s.MemoryStats.Stats["total_cache"]
 		ret.Memory.RSS = s.MemoryStats.Stats["total_rss"]
@@ -835,6 +1488,324 @@ func setMemoryStats(s *cgroups.Stats, ret *info.ContainerStats) {
 	ret.Memory.WorkingSet = workingSet
 }
 
+// readMemoryEvents returns the counters of the memory.events file of a cgroup
+// v2 by event, e.g. high or oom_kill.
+func readMemoryEvents(cgroupPath string) (map[string]uint64, error) {
+	content, err := ioutil.ReadFile(path.Join(cgroupPath, "memory.events"))
+	if err != nil {
+		return nil, err
+	}
+	events := make(map[string]uint64)
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory event %q: %v", line, err)
+		}
+		events[fields[0]] = value
+	}
+	return events, nil
+}
+
+// readPidsLimitHits returns the number of times a cgroup reached its pids.max
+// limit, from its pids.events file. It is 0 when the file is absent, e.g. in
+// the root cgroup or on kernels before 4.6.
+func readPidsLimitHits(pidsPath string) (uint64, error) {
+	content, err := ioutil.ReadFile(path.Join(pidsPath, "pids.events"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return parsePidsEvents(string(content))
+}
+
+// parsePidsEvents returns the max counter of the contents of a pids.events
+// file, which has the same format on cgroup v1 and v2.
+func parsePidsEvents(content string) (uint64, error) {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "max" {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid pids event %q: %v", line, err)
+		}
+		return value, nil
+	}
+	return 0, nil
+}
+
+// readCPUBurstStats returns the number of periods in which a cgroup used its
+// burst and the cpu time in nanoseconds it used beyond its quota, from its
+// cpu.stat file. Kernels without burst support, before 5.14, report neither.
+func readCPUBurstStats(cpuPath string) (uint64, uint64, error) {
+	content, err := ioutil.ReadFile(path.Join(cpuPath, "cpu.stat"))
+	if err != nil {
+		return 0, 0, err
+	}
+	return parseCPUBurstStats(string(content))
+}
+
+func parseCPUBurstStats(content string) (uint64, uint64, error) {
+	var bursts, burstTime uint64
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		var dest *uint64
+		multiplier := uint64(1)
+		switch fields[0] {
+		case "nr_bursts":
+			dest = &bursts
+		case "burst_usec":
+			// cgroup v2 reports the time in microseconds, v1 in nanoseconds.
+			dest = &burstTime
+			multiplier = 1000
+		case "burst_time":
+			dest = &burstTime
+		default:
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid cpu.stat line %q: %v", line, err)
+		}
+		*dest = value * multiplier
+	}
+	return bursts, burstTime, nil
+}
+
+// readCpusetCpus returns the CPUs a cgroup may run on. On cgroup v2 the
+// cpuset.cpus file is empty unless the cgroup restricts its CPUs, the ones it
+// inherits are read from cpuset.cpus.effective instead.
+func readCpusetCpus(cpusetPath string, cgroup2UnifiedMode bool) (string, error) {
+	file := "cpuset.cpus"
+	if cgroup2UnifiedMode {
+		file = "cpuset.cpus.effective"
+	}
+	content, err := ioutil.ReadFile(path.Join(cpusetPath, file))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// readIoCostUsage returns the per-device time charged to a cgroup v2 by the
+// iocost controller, from the cost.usage keys of its io.stat file, as Total
+// entries in nanoseconds. Devices without iocost enabled are left out.
+func readIoCostUsage(cgroupPath string) ([]cgroups.BlkioStatEntry, error) {
+	content, err := ioutil.ReadFile(path.Join(cgroupPath, "io.stat"))
+	if err != nil {
+		return nil, err
+	}
+	return parseIoCostUsage(string(content))
+}
+
+func parseIoCostUsage(content string) ([]cgroups.BlkioStatEntry, error) {
+	var entries []cgroups.BlkioStatEntry
+	for _, line := range strings.Split(content, "\n") {
+		// e.g. 8:0 rbytes=90430464 wbytes=299008000 ... cost.usage=12345
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		var major, minor uint64
+		if _, err := fmt.Sscanf(fields[0], "%d:%d", &major, &minor); err != nil {
+			return nil, fmt.Errorf("invalid io.stat line %q: %v", line, err)
+		}
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "cost.usage=") {
+				continue
+			}
+			usage, err := strconv.ParseUint(strings.TrimPrefix(field, "cost.usage="), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid io.stat line %q: %v", line, err)
+			}
+			entries = append(entries, cgroups.BlkioStatEntry{
+				Major: major,
+				Minor: minor,
+				Op:    "Total",
+				Value: usage * uint64(time.Microsecond),
+			})
+		}
+	}
+	return entries, nil
+}
+
+// readZswapStats returns the zswap usage of a cgroup v2 given the content of
+// its memory.stat file, or nil if the kernel doesn't support zswap.
+func readZswapStats(cgroupPath string, stats map[string]uint64) *info.ZswapStats {
+	usage, err := readCgroupUint(path.Join(cgroupPath, "memory.zswap.current"))
+	if err != nil {
+		return nil
+	}
+	limit, err := readCgroupUint(path.Join(cgroupPath, "memory.zswap.max"))
+	if err != nil {
+		klog.V(5).Infof("Unable to read zswap limit of %q: %v", cgroupPath, err)
+		limit = math.MaxUint64
+	}
+	return &info.ZswapStats{
+		Usage:   usage,
+		Limit:   limit,
+		Zswpin:  stats["zswpin"],
+		Zswpout: stats["zswpout"],
+		Zswpwb:  stats["zswpwb"],
+	}
+}
+
+// swapActivityStats returns the pages swapped in and out by a cgroup v2 given
+// the content of its memory.stat file, or nil if the kernel doesn't report
+// them.
+func swapActivityStats(stats map[string]uint64) *info.SwapActivityStats {
+	pswpin, ok := stats["pswpin"]
+	if !ok {
+		return nil
+	}
+	pswpout, ok := stats["pswpout"]
+	if !ok {
+		return nil
+	}
+	return &info.SwapActivityStats{Pswpin: pswpin, Pswpout: pswpout}
+}
+
+// reclaimStats returns the reclaim and compaction counters of a cgroup v2 given
+// the content of its memory.stat file, or nil if the kernel reports none of
+// them.
+func reclaimStats(stats map[string]uint64) *info.ReclaimStats {
+	var reclaim info.ReclaimStats
+	found := false
+	for key, counter := range map[string]**uint64{
+		"pgscan_kswapd":  &reclaim.PgscanKswapd,
+		"pgscan_direct":  &reclaim.PgscanDirect,
+		"pgsteal_kswapd": &reclaim.PgstealKswapd,
+		"pgsteal_direct": &reclaim.PgstealDirect,
+		"compact_stall":  &reclaim.CompactStall,
+	} {
+		if value, ok := stats[key]; ok {
+			*counter = &value
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return &reclaim
+}
+
+// readTCPMemoryStats returns the TCP socket buffer memory of a cgroup v1 from
+// its memory.kmem.tcp.* files, or nil if the kernel doesn't account it.
+func readTCPMemoryStats(cgroupPath string) *info.TCPMemoryStats {
+	usage, err := readCgroupUint(path.Join(cgroupPath, "memory.kmem.tcp.usage_in_bytes"))
+	if err != nil {
+		return nil
+	}
+	stats := &info.TCPMemoryStats{Usage: usage}
+	for file, value := range map[string]*uint64{
+		"memory.kmem.tcp.max_usage_in_bytes": &stats.MaxUsage,
+		"memory.kmem.tcp.limit_in_bytes":     &stats.Limit,
+		"memory.kmem.tcp.failcnt":            &stats.Failcnt,
+	} {
+		if *value, err = readCgroupUint(path.Join(cgroupPath, file)); err != nil {
+			klog.V(5).Infof("Unable to read %s of %q: %v", file, cgroupPath, err)
+		}
+	}
+	return stats
+}
+
+// readCgroupUint returns the value of a single value cgroup file, "max" being
+// read as math.MaxUint64.
+func readCgroupUint(file string) (uint64, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(content))
+	if value == "max" {
+		return math.MaxUint64, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// memoryStatsCgroupV2 returns the breakdown of the memory usage of a cgroup v2
+// given the content of its memory.stat file.
+func memoryStatsCgroupV2(stats map[string]uint64) *info.MemoryStatsCgroupV2 {
+	ret := &info.MemoryStatsCgroupV2{
+		Anon:              stats["anon"],
+		File:              stats["file"],
+		KernelStack:       stats["kernel_stack"],
+		PageTables:        stats["pagetables"],
+		Slab:              stats["slab"],
+		SlabReclaimable:   stats["slab_reclaimable"],
+		SlabUnreclaimable: stats["slab_unreclaimable"],
+		Sock:              stats["sock"],
+		Shmem:             stats["shmem"],
+		FileDirty:         stats["file_dirty"],
+		FileWriteback:     stats["file_writeback"],
+
+		WorkingsetRefault:      stats["workingset_refault"],
+		WorkingsetRefaultAnon:  stats["workingset_refault_anon"],
+		WorkingsetRefaultFile:  stats["workingset_refault_file"],
+		WorkingsetActivate:     stats["workingset_activate"],
+		WorkingsetActivateAnon: stats["workingset_activate_anon"],
+		WorkingsetActivateFile: stats["workingset_activate_file"],
+	}
+	// Linux 5.9 split the workingset counters into anon and file ones.
+	if _, ok := stats["workingset_refault"]; !ok {
+		ret.WorkingsetRefault = ret.WorkingsetRefaultAnon + ret.WorkingsetRefaultFile
+	}
+	if _, ok := stats["workingset_activate"]; !ok {
+		ret.WorkingsetActivate = ret.WorkingsetActivateAnon + ret.WorkingsetActivateFile
+	}
+	if _, ok := stats["slab"]; !ok {
+		// Older kernels only report the reclaimable and unreclaimable parts.
+		ret.Slab = ret.SlabReclaimable + ret.SlabUnreclaimable
+	}
+	if kernel, ok := stats["kernel"]; ok {
+		ret.Kernel = kernel
+	} else {
+		// The kernel entry was only added in Linux 5.18, sum its components on
+		// older kernels.
+		ret.Kernel = ret.KernelStack + ret.PageTables + stats["percpu"] + ret.Slab
+	}
+	return ret
+}
+
+func setKernelMemoryStats(s *cgroups.Stats, ret *info.ContainerStats) {
+	if cgroups.IsCgroup2UnifiedMode() {
+		ret.Memory.Kernel = kernelMemoryStatsCgroupV2(s.MemoryStats.Stats)
+	} else {
+		ret.Memory.Kernel = kernelMemoryStatsCgroupV1(&s.MemoryStats)
+	}
+}
+
+// kernelMemoryStatsCgroupV1 returns the kernel memory usage of a cgroup v1, as
+// read from its memory.kmem.* files, which are missing when the kernel doesn't
+// account kernel memory.
+func kernelMemoryStatsCgroupV1(s *cgroups.MemoryStats) *info.KernelMemoryStats {
+	return &info.KernelMemoryStats{
+		Usage:    s.KernelUsage.Usage,
+		MaxUsage: s.KernelUsage.MaxUsage,
+	}
+}
+
+// kernelMemoryStatsCgroupV2 returns the kernel memory usage of a cgroup v2
+// given the content of its memory.stat file.
+func kernelMemoryStatsCgroupV2(stats map[string]uint64) *info.KernelMemoryStats {
+	v2 := memoryStatsCgroupV2(stats)
+	return &info.KernelMemoryStats{
+		Usage:       v2.Kernel,
+		Slab:        v2.Slab,
+		KernelStack: v2.KernelStack,
+	}
+}
+
 func setCPUSetStats(s *cgroups.Stats, ret *info.ContainerStats) {
 	ret.CpuSet.MemoryMigrate = s.CPUSetStats.MemoryMigrate
 }
@@ -910,6 +1881,9 @@ func newContainerStats(libcontainerStats *libcontainer.Stats, includedMetrics co
 			setDiskIoStats(s, ret)
 		}
 		setMemoryStats(s, ret)
+		if includedMetrics.Has(container.KernelMemoryMetrics) {
+			setKernelMemoryStats(s, ret)
+		}
 		if includedMetrics.Has(container.MemoryNumaMetrics) {
 			setMemoryNumaStats(s, ret)
 		}
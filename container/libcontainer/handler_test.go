@@ -15,13 +15,30 @@
 package libcontainer
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/google/cadvisor/container"
 	info "github.com/google/cadvisor/info/v1"
+	"github.com/opencontainers/runc/libcontainer"
 	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fs"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fs2"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestScanInterfaceStats(t *testing.T) {
@@ -32,15 +49,23 @@ func TestScanInterfaceStats(t *testing.T) {
 
 	var netdevstats = []info.InterfaceStats{
 		{
-			Name:      "wlp4s0",
-			RxBytes:   1,
-			RxPackets: 2,
-			RxErrors:  3,
-			RxDropped: 4,
-			TxBytes:   9,
-			TxPackets: 10,
-			TxErrors:  11,
-			TxDropped: 12,
+			Name:         "wlp4s0",
+			RxBytes:      1,
+			RxPackets:    2,
+			RxErrors:     3,
+			RxDropped:    4,
+			RxFifo:       5,
+			RxFrame:      6,
+			RxCompressed: 7,
+			RxMulticast:  8,
+			TxBytes:      9,
+			TxPackets:    10,
+			TxErrors:     11,
+			TxDropped:    12,
+			TxFifo:       13,
+			TxCollisions: 14,
+			TxCarrier:    15,
+			TxCompressed: 16,
 		},
 		{
 			Name:      "em1",
@@ -93,9 +118,6 @@ func TestScanUDPStats(t *testing.T) {
 // https://github.com/docker/libcontainer/blob/v2.2.1/cgroups/fs/cpuacct.go#L19
 const nanosecondsInSeconds = 1000000000
 
-// https://github.com/containerd/cgroups/pull/12
-const clockTicks = 100
-
 func TestSetCPUStats(t *testing.T) {
 	perCPUUsage := make([]uint64, 31)
 	for i := uint32(0); i < 31; i++ {
@@ -130,6 +152,401 @@ func TestSetCPUStats(t *testing.T) {
 	}
 }
 
+func TestSetCPUStatsUsageBreakdown(t *testing.T) {
+	// cpuacct.stat is in USER_HZ with cgroup v1 and cpu.stat in microseconds
+	// with cgroup v2, both are reported in nanoseconds.
+	expected := info.CpuUsage{
+		Total:  2100000000,
+		User:   1500000000,
+		System: 500000000,
+	}
+	// Read the fake cgroup files from the testdata directory.
+	cgroups.TestMode = true
+	defer func() { cgroups.TestMode = false }()
+
+	s := cgroups.NewStats()
+	require.NoError(t, (&fs.CpuacctGroup{}).GetStats("testdata/cpuacct.v1", s))
+	var ret info.ContainerStats
+	setCPUStats(s, &ret, false)
+	assert.Equal(t, expected, ret.Cpu.Usage)
+
+	m, err := fs2.NewManager(nil, "testdata/cpu.v2", true)
+	require.NoError(t, err)
+	s, err = m.GetStats()
+	require.NoError(t, err)
+	ret = info.ContainerStats{}
+	setCPUStats(s, &ret, false)
+	assert.Equal(t, expected, ret.Cpu.Usage)
+}
+
+func TestSetDiskIoStatsServiceTime(t *testing.T) {
+	cgroups.TestMode = true
+	defer func() { cgroups.TestMode = false }()
+	dir, err := ioutil.TempDir("", "blkio")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ops := func(device string, read, write uint64) string {
+		return fmt.Sprintf("%[1]s Read %[2]d\n%[1]s Write %[3]d\n%[1]s Sync %[3]d\n%[1]s Async %[2]d\n%[1]s Total %[4]d\n", device, read, write, read+write)
+	}
+	for file, content := range map[string]string{
+		"blkio.sectors_recursive":          "8:0 1024\n",
+		"blkio.io_service_time_recursive":  ops("8:0", 1500000, 2500000) + ops("8:16", 100, 200) + "Total 4000300\n",
+		"blkio.io_wait_time_recursive":     ops("8:0", 10, 20) + "Total 30\n",
+		"blkio.io_merged_recursive":        ops("8:0", 1, 2) + "Total 3\n",
+		"blkio.io_queued_recursive":        ops("8:0", 0, 0) + "Total 0\n",
+		"blkio.time_recursive":             "8:0 1500\n8:16 12\n",
+		"blkio.io_serviced_recursive":      ops("8:0", 30, 40) + "Total 70\n",
+		"blkio.io_service_bytes_recursive": ops("8:0", 4096, 8192) + "Total 12288\n",
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0644))
+	}
+
+	s := cgroups.NewStats()
+	require.NoError(t, (&fs.BlkioGroup{}).GetStats(dir, s))
+	var ret info.ContainerStats
+	setDiskIoStats(s, &ret)
+
+	serviceTime := make(map[uint64]map[string]uint64)
+	for _, disk := range ret.DiskIo.IoServiceTime {
+		assert.EqualValues(t, 8, disk.Major)
+		serviceTime[disk.Minor] = disk.Stats
+	}
+	assert.Equal(t, map[uint64]map[string]uint64{
+		0:  {"Read": 1500000, "Write": 2500000, "Sync": 2500000, "Async": 1500000, "Total": 4000000},
+		16: {"Read": 100, "Write": 200, "Sync": 200, "Async": 100, "Total": 300},
+	}, serviceTime)
+
+	ioTime := make(map[uint64]uint64)
+	for _, disk := range ret.DiskIo.IoTime {
+		ioTime[disk.Minor] = disk.Stats["Count"]
+	}
+	assert.Equal(t, map[uint64]uint64{0: 1500, 16: 12}, ioTime)
+}
+
+func TestParseIoCostUsage(t *testing.T) {
+	entries, err := parseIoCostUsage("8:16 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0 cost.vrate=135.00 cost.usage=8251 cost.wait=0 cost.indebt=0 cost.indelay=0\n" +
+		"253:0 rbytes=4096 wbytes=0 rios=1 wios=0 dbytes=0 dios=0\n")
+	require.NoError(t, err)
+	// Devices without iocost have no usage.
+	assert.Equal(t, []cgroups.BlkioStatEntry{{Major: 8, Minor: 16, Op: "Total", Value: 8251000}}, entries)
+
+	entries, err = parseIoCostUsage("")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = parseIoCostUsage("8:16 cost.usage=abc\n")
+	assert.Error(t, err)
+}
+
+func TestParsePidsEvents(t *testing.T) {
+	hits, err := parsePidsEvents("max 42\n")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), hits)
+
+	// Newer kernels also count the limits imposed by the ancestors.
+	hits, err = parsePidsEvents("max 7\nmax.imposed 9\n")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(7), hits)
+
+	hits, err = parsePidsEvents("")
+	require.NoError(t, err)
+	assert.Zero(t, hits)
+
+	_, err = parsePidsEvents("max abc\n")
+	assert.Error(t, err)
+}
+
+func TestReadPidsLimitHits(t *testing.T) {
+	cgroupPath, err := ioutil.TempDir("", "pids")
+	require.NoError(t, err)
+	defer os.RemoveAll(cgroupPath)
+
+	// Without pids.events, e.g. in the root cgroup.
+	hits, err := readPidsLimitHits(cgroupPath)
+	require.NoError(t, err)
+	assert.Zero(t, hits)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(cgroupPath, "pids.events"), []byte("max 3\n"), 0644))
+	hits, err = readPidsLimitHits(cgroupPath)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), hits)
+}
+
+func TestParseCPUBurstStats(t *testing.T) {
+	// cgroup v2 cpu.stat.
+	bursts, burstTime, err := parseCPUBurstStats("usage_usec 1000\nnr_periods 10\nnr_throttled 1\nthrottled_usec 500\nnr_bursts 3\nburst_usec 1500\n")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), bursts)
+	assert.Equal(t, uint64(1500000), burstTime)
+
+	// cgroup v1 cpu.stat.
+	bursts, burstTime, err = parseCPUBurstStats("nr_periods 10\nnr_throttled 1\nthrottled_time 500000\nnr_bursts 2\nburst_time 700000\n")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), bursts)
+	assert.Equal(t, uint64(700000), burstTime)
+
+	// Kernels without burst support.
+	bursts, burstTime, err = parseCPUBurstStats("nr_periods 10\nnr_throttled 1\nthrottled_time 500000\n")
+	require.NoError(t, err)
+	assert.Zero(t, bursts)
+	assert.Zero(t, burstTime)
+
+	_, _, err = parseCPUBurstStats("nr_bursts abc\n")
+	assert.Error(t, err)
+}
+
+func TestReadCpusetCpus(t *testing.T) {
+	cgroupPath, err := ioutil.TempDir("", "cpuset")
+	require.NoError(t, err)
+	defer os.RemoveAll(cgroupPath)
+
+	_, err = readCpusetCpus(cgroupPath, false)
+	assert.Error(t, err)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(cgroupPath, "cpuset.cpus"), []byte("\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(cgroupPath, "cpuset.cpus.effective"), []byte("0-3,8\n"), 0644))
+	cpus, err := readCpusetCpus(cgroupPath, true)
+	require.NoError(t, err)
+	assert.Equal(t, "0-3,8", cpus)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(cgroupPath, "cpuset.cpus"), []byte("4-7\n"), 0644))
+	cpus, err = readCpusetCpus(cgroupPath, false)
+	require.NoError(t, err)
+	assert.Equal(t, "4-7", cpus)
+}
+
+func TestReadMemoryEvents(t *testing.T) {
+	cgroupPath, err := ioutil.TempDir("", "memory_events")
+	require.NoError(t, err)
+	defer os.RemoveAll(cgroupPath)
+	eventsFile := filepath.Join(cgroupPath, "memory.events")
+
+	_, err = readMemoryEvents(cgroupPath)
+	assert.Error(t, err)
+
+	// The high counter increments each time the usage goes over memory.high.
+	for _, high := range []uint64{3, 5} {
+		content := fmt.Sprintf("low 0\nhigh %d\nmax 0\noom 0\noom_kill 0\n", high)
+		require.NoError(t, ioutil.WriteFile(eventsFile, []byte(content), 0644))
+		events, err := readMemoryEvents(cgroupPath)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]uint64{"low": 0, "high": high, "max": 0, "oom": 0, "oom_kill": 0}, events)
+	}
+
+	require.NoError(t, ioutil.WriteFile(eventsFile, []byte("high -1\n"), 0644))
+	_, err = readMemoryEvents(cgroupPath)
+	assert.Error(t, err)
+}
+
+func TestReadZswapStats(t *testing.T) {
+	cgroupPath, err := ioutil.TempDir("", "zswap")
+	require.NoError(t, err)
+	defer os.RemoveAll(cgroupPath)
+	stats := readMemoryStat(t, "testdata/memory.stat.v2.linux-6.8")
+
+	// Nothing is reported by kernels without zswap.
+	assert.Nil(t, readZswapStats(cgroupPath, stats))
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(cgroupPath, "memory.zswap.current"), []byte("48365568\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(cgroupPath, "memory.zswap.max"), []byte("max\n"), 0644))
+	assert.Equal(t, &info.ZswapStats{
+		Usage:   48365568,
+		Limit:   math.MaxUint64,
+		Zswpin:  21347,
+		Zswpout: 63218,
+		Zswpwb:  1042,
+	}, readZswapStats(cgroupPath, stats))
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(cgroupPath, "memory.zswap.max"), []byte("268435456\n"), 0644))
+	assert.EqualValues(t, 268435456, readZswapStats(cgroupPath, stats).Limit)
+}
+
+func TestSwapActivityStats(t *testing.T) {
+	stats := readMemoryStat(t, "testdata/memory.stat.v2.linux-6.8")
+	assert.Equal(t, &info.SwapActivityStats{Pswpin: 1824, Pswpout: 5312}, swapActivityStats(stats))
+
+	// Older kernels don't report the swap counters.
+	stats = readMemoryStat(t, "testdata/memory.stat.v2.linux-5.15")
+	assert.Nil(t, swapActivityStats(stats))
+}
+
+func TestReclaimStats(t *testing.T) {
+	value := func(v uint64) *uint64 { return &v }
+
+	stats := readMemoryStat(t, "testdata/memory.stat.v2.linux-6.8")
+	assert.Equal(t, &info.ReclaimStats{
+		PgscanKswapd:  value(2514203),
+		PgscanDirect:  value(429107),
+		PgstealKswapd: value(2246491),
+		PgstealDirect: value(365381),
+	}, reclaimStats(stats))
+
+	// Only the counters reported by the kernel are available.
+	assert.Equal(t, &info.ReclaimStats{CompactStall: value(12)}, reclaimStats(map[string]uint64{"pgscan": 10, "compact_stall": 12}))
+
+	// Older kernels don't break the reclaim down by reclaimer.
+	stats = readMemoryStat(t, "testdata/memory.stat.v2.linux-5.15")
+	assert.Nil(t, reclaimStats(stats))
+}
+
+func TestReadTCPMemoryStats(t *testing.T) {
+	cgroupPath, err := ioutil.TempDir("", "kmem_tcp")
+	require.NoError(t, err)
+	defer os.RemoveAll(cgroupPath)
+
+	// Nothing is reported by kernels without TCP memory accounting.
+	assert.Nil(t, readTCPMemoryStats(cgroupPath))
+
+	for file, content := range map[string]string{
+		"memory.kmem.tcp.usage_in_bytes":     "1626112\n",
+		"memory.kmem.tcp.max_usage_in_bytes": "4423680\n",
+		"memory.kmem.tcp.limit_in_bytes":     "9223372036854771712\n",
+		"memory.kmem.tcp.failcnt":            "3\n",
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(cgroupPath, file), []byte(content), 0644))
+	}
+	assert.Equal(t, &info.TCPMemoryStats{
+		Usage:    1626112,
+		MaxUsage: 4423680,
+		Limit:    9223372036854771712,
+		Failcnt:  3,
+	}, readTCPMemoryStats(cgroupPath))
+}
+
+func readMemoryStat(t *testing.T, path string) map[string]uint64 {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	stats := map[string]uint64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, err := fscommon.ParseKeyValue(scanner.Text())
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return stats
+}
+
+func TestMemoryStatsCgroupV2(t *testing.T) {
+	stats := readMemoryStat(t, "testdata/memory.stat.v2")
+
+	expected := &info.MemoryStatsCgroupV2{
+		Anon:              1462272,
+		File:              3346432,
+		Kernel:            49152 + 135168 + 2016 + 356352,
+		KernelStack:       49152,
+		PageTables:        135168,
+		Slab:              356352,
+		SlabReclaimable:   196608,
+		SlabUnreclaimable: 159744,
+		Sock:              4096,
+		Shmem:             8192,
+		FileDirty:         12288,
+		FileWriteback:     4096,
+	}
+	assert.Equal(t, expected, memoryStatsCgroupV2(stats))
+
+	// Newer kernels report the total kernel memory.
+	stats["kernel"] = 600000
+	expected.Kernel = 600000
+	assert.Equal(t, expected, memoryStatsCgroupV2(stats))
+
+	// Older kernels do not report the total slab memory.
+	delete(stats, "kernel")
+	delete(stats, "slab")
+	expected.Kernel = 49152 + 135168 + 2016 + 356352
+	assert.Equal(t, expected, memoryStatsCgroupV2(stats))
+}
+
+func TestKernelMemoryStatsCgroupV1(t *testing.T) {
+	cgroups.TestMode = true
+	defer func() { cgroups.TestMode = false }()
+	dir, err := ioutil.TempDir("", "kmem")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for file, content := range map[string]string{
+		"memory.stat":                    "cache 0\nrss 0\n",
+		"memory.usage_in_bytes":          "8192",
+		"memory.max_usage_in_bytes":      "16384",
+		"memory.failcnt":                 "0",
+		"memory.limit_in_bytes":          "9223372036854771712",
+		"memory.use_hierarchy":           "1",
+		"memory.kmem.usage_in_bytes":     "4096",
+		"memory.kmem.max_usage_in_bytes": "12288",
+		"memory.kmem.failcnt":            "0",
+		"memory.kmem.limit_in_bytes":     "9223372036854771712",
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0644))
+	}
+
+	stats := cgroups.NewStats()
+	require.NoError(t, (&fs.MemoryGroup{}).GetStats(dir, stats))
+	assert.Equal(t, &info.KernelMemoryStats{Usage: 4096, MaxUsage: 12288}, kernelMemoryStatsCgroupV1(&stats.MemoryStats))
+
+	// Without kernel memory accounting, the memory.kmem.* files are missing.
+	for _, file := range []string{"memory.kmem.usage_in_bytes", "memory.kmem.max_usage_in_bytes", "memory.kmem.failcnt", "memory.kmem.limit_in_bytes"} {
+		require.NoError(t, os.Remove(filepath.Join(dir, file)))
+	}
+	stats = cgroups.NewStats()
+	require.NoError(t, (&fs.MemoryGroup{}).GetStats(dir, stats))
+	assert.Equal(t, &info.KernelMemoryStats{}, kernelMemoryStatsCgroupV1(&stats.MemoryStats))
+}
+
+func TestKernelMemoryStatsCgroupV2(t *testing.T) {
+	stats := readMemoryStat(t, "testdata/memory.stat.v2")
+	expected := &info.KernelMemoryStats{
+		Usage:       49152 + 135168 + 2016 + 356352,
+		Slab:        356352,
+		KernelStack: 49152,
+	}
+	assert.Equal(t, expected, kernelMemoryStatsCgroupV2(stats))
+
+	// Without kernel memory accounting, the kernel entries are zero.
+	stats = map[string]uint64{"anon": 1462272, "file": 3346432}
+	assert.Equal(t, &info.KernelMemoryStats{}, kernelMemoryStatsCgroupV2(stats))
+}
+
+func TestMemoryStatsCgroupV2Workingset(t *testing.T) {
+	// Linux 5.9 and later report anon and file workingset counters.
+	stats := readMemoryStat(t, "testdata/memory.stat.v2.linux-5.15")
+	ret := memoryStatsCgroupV2(stats)
+	assert.Equal(t, uint64(1523+874211), ret.WorkingsetRefault)
+	assert.Equal(t, uint64(1523), ret.WorkingsetRefaultAnon)
+	assert.Equal(t, uint64(874211), ret.WorkingsetRefaultFile)
+	assert.Equal(t, uint64(317+204863), ret.WorkingsetActivate)
+	assert.Equal(t, uint64(317), ret.WorkingsetActivateAnon)
+	assert.Equal(t, uint64(204863), ret.WorkingsetActivateFile)
+
+	// Older kernels only report the total counters.
+	for _, key := range []string{"workingset_refault_anon", "workingset_refault_file", "workingset_activate_anon", "workingset_activate_file"} {
+		delete(stats, key)
+	}
+	stats["workingset_refault"] = 875734
+	stats["workingset_activate"] = 205180
+	ret = memoryStatsCgroupV2(stats)
+	assert.Equal(t, uint64(875734), ret.WorkingsetRefault)
+	assert.Equal(t, uint64(205180), ret.WorkingsetActivate)
+	assert.Zero(t, ret.WorkingsetRefaultAnon)
+	assert.Zero(t, ret.WorkingsetRefaultFile)
+	assert.Zero(t, ret.WorkingsetActivateAnon)
+	assert.Zero(t, ret.WorkingsetActivateFile)
+
+	// Kernels without workingset counters report zero.
+	delete(stats, "workingset_refault")
+	delete(stats, "workingset_activate")
+	ret = memoryStatsCgroupV2(stats)
+	assert.Zero(t, ret.WorkingsetRefault)
+	assert.Zero(t, ret.WorkingsetActivate)
+}
+
 func TestSetProcessesStats(t *testing.T) {
 	ret := info.ContainerStats{
 		Processes: info.ProcessStats{
@@ -171,6 +588,130 @@ func TestSetProcessesStats(t *testing.T) {
 
 }
 
+func TestSchedulerStatsFromProcsKeepsExitedProcesses(t *testing.T) {
+	rootFs, err := ioutil.TempDir("", "schedstat")
+	require.NoError(t, err)
+	defer os.RemoveAll(rootFs)
+	writeSchedstat := func(pid int, schedstat string) {
+		procPath := filepath.Join(rootFs, "proc", strconv.Itoa(pid))
+		require.NoError(t, os.MkdirAll(procPath, 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(procPath, "schedstat"), []byte(schedstat), 0644))
+	}
+	writeSchedstat(10, "100 20 3\n")
+	writeSchedstat(20, "1000 500 6\n")
+
+	cache := map[int]*info.CpuSchedstat{}
+	schedstat, err := schedulerStatsFromProcs(rootFs, []int{10, 20}, cache)
+	require.NoError(t, err)
+	assert.Equal(t, info.CpuSchedstat{RunTime: 1100, RunqueueTime: 520, RunPeriods: 9}, schedstat)
+
+	// Process 20 exited, its times are still accounted for.
+	writeSchedstat(10, "200 30 4\n")
+	schedstat, err = schedulerStatsFromProcs(rootFs, []int{10}, cache)
+	require.NoError(t, err)
+	assert.Equal(t, info.CpuSchedstat{RunTime: 1200, RunqueueTime: 530, RunPeriods: 10}, schedstat)
+}
+
+func TestTaskSwitchesFromProcs(t *testing.T) {
+	rootFs, err := ioutil.TempDir("", "switches")
+	require.NoError(t, err)
+	defer os.RemoveAll(rootFs)
+
+	statuses := map[string]string{
+		"10/task/10": "Name:\tnginx\nState:\tS (sleeping)\nvoluntary_ctxt_switches:\t150\nnonvoluntary_ctxt_switches:\t10\n",
+		"10/task/11": "Name:\tnginx\nvoluntary_ctxt_switches:\t50\nnonvoluntary_ctxt_switches:\t40\n",
+		"20/task/20": "Name:\tworker\nvoluntary_ctxt_switches:\t7\nnonvoluntary_ctxt_switches:\t1200\n",
+		"30/task/30": "Name:\tbroken\nvoluntary_ctxt_switches:\tgarbage\nnonvoluntary_ctxt_switches:\t3\n",
+	}
+	scheds := map[string]string{
+		"10/task/10": "nginx (10, #threads: 2)\n-------------------\nse.exec_start                                :      12345678.123456\nse.nr_migrations                             :                    4\nnr_switches                                  :                  160\n",
+		"10/task/11": "nginx (11, #threads: 2)\n-------------------\nse.nr_migrations                             :                    6\n",
+		"20/task/20": "worker (20, #threads: 1)\n-------------------\nse.nr_migrations                             :                   90\n",
+		// Without CONFIG_SCHED_DEBUG the tasks have no sched.
+	}
+	for task, status := range statuses {
+		taskPath := filepath.Join(rootFs, "proc", task)
+		require.NoError(t, os.MkdirAll(taskPath, 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(taskPath, "status"), []byte(status), 0644))
+	}
+	for task, sched := range scheds {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(rootFs, "proc", task, "sched"), []byte(sched), 0644))
+	}
+
+	// Process 40 exited before its tasks were listed.
+	assert.Equal(t, map[string]taskSwitches{
+		"10": {voluntary: 150, involuntary: 10, migrations: 4},
+		"11": {voluntary: 50, involuntary: 40, migrations: 6},
+		"20": {voluntary: 7, involuntary: 1200, migrations: 90},
+		"30": {voluntary: 0, involuntary: 3},
+	}, taskSwitchesFromProcs(rootFs, []string{"10", "20", "30", "40"}))
+
+	cgroupPath := filepath.Join(rootFs, "cgroup")
+	require.NoError(t, os.MkdirAll(cgroupPath, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(cgroupPath, "cgroup.procs"), []byte("10\n20\n"), 0644))
+	cache := &taskSwitchesCache{}
+	stats, err := processStatsFromProcs(rootFs, cgroupPath, 0, cache)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(207), stats.VoluntaryContextSwitches)
+	assert.Equal(t, uint64(1250), stats.InvoluntaryContextSwitches)
+	assert.Equal(t, uint64(100), stats.CpuMigrations)
+
+	// The counts of thread 11, which exited, are still accounted for.
+	require.NoError(t, os.RemoveAll(filepath.Join(rootFs, "proc", "10", "task", "11")))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(rootFs, "proc", "10", "task", "10", "status"), []byte("voluntary_ctxt_switches:\t160\nnonvoluntary_ctxt_switches:\t10\n"), 0644))
+	stats, err = processStatsFromProcs(rootFs, cgroupPath, 0, cache)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(217), stats.VoluntaryContextSwitches)
+	assert.Equal(t, uint64(1250), stats.InvoluntaryContextSwitches)
+	assert.Equal(t, uint64(100), stats.CpuMigrations)
+}
+
+func TestTaskSwitchesCache(t *testing.T) {
+	cache := &taskSwitchesCache{}
+	assert.Equal(t, taskSwitches{voluntary: 30, involuntary: 3, migrations: 2}, cache.update(map[string]taskSwitches{
+		"10": {voluntary: 10, involuntary: 1, migrations: 1},
+		"11": {voluntary: 20, involuntary: 2, migrations: 1},
+	}))
+	// Thread 11 exited and its tid was reused by a new thread.
+	assert.Equal(t, taskSwitches{voluntary: 36, involuntary: 5, migrations: 4}, cache.update(map[string]taskSwitches{
+		"10": {voluntary: 15, involuntary: 2, migrations: 2},
+		"11": {voluntary: 1, involuntary: 1, migrations: 1},
+	}))
+	// All the threads exited.
+	assert.Equal(t, taskSwitches{voluntary: 36, involuntary: 5, migrations: 4}, cache.update(map[string]taskSwitches{}))
+}
+
+func TestProcessStatesFromProcs(t *testing.T) {
+	rootFs, err := ioutil.TempDir("", "states")
+	require.NoError(t, err)
+	defer os.RemoveAll(rootFs)
+
+	stats := map[string]string{
+		"10": "10 (bash) S 1 10 10 0 -1 4194560 1 0 0 0 0 0 0 0 20 0 1 0 100 0 0",
+		"11": "11 (tar) D 10 10 10 0 -1 4194560 1 0 0 0 0 0 0 0 20 0 1 0 100 0 0",
+		"12": "12 (worker (1)) D 10 10 10 0 -1 4194560 1 0 0 0 0 0 0 0 20 0 1 0 100 0 0",
+		"13": "13 (sleep) Z 10 10 10 0 -1 4194560 1 0 0 0 0 0 0 0 20 0 1 0 100 0 0",
+		"14": "14 (yes) R 10 10 10 0 -1 4194560 1 0 0 0 0 0 0 0 20 0 1 0 100 0 0",
+		"15": "garbage",
+	}
+	for pid, stat := range stats {
+		pidPath := filepath.Join(rootFs, "proc", pid)
+		require.NoError(t, os.MkdirAll(pidPath, 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(pidPath, "stat"), []byte(stat+"\n"), 0644))
+	}
+
+	// Process 16 exited before its stat was read.
+	states := processStatesFromProcs(rootFs, []string{"10", "11", "12", "13", "14", "15", "16"})
+	assert.Equal(t, map[string]uint64{"S": 1, "D": 2, "Z": 1, "R": 1}, states)
+
+	cgroupPath := filepath.Join(rootFs, "cgroup")
+	require.NoError(t, os.MkdirAll(cgroupPath, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(cgroupPath, "cgroup.procs"), []byte("10\n13\n"), 0644))
+	processStats, err := processStatsFromProcs(rootFs, cgroupPath, 0, &taskSwitchesCache{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"S": 1, "Z": 1}, processStats.States)
+}
+
 func TestParseLimitsFile(t *testing.T) {
 	var testData = []struct {
 		limitLine string
@@ -210,6 +751,268 @@ func TestParseLimitsFile(t *testing.T) {
 	}
 }
 
+func TestProcessStartTime(t *testing.T) {
+	// The command name of the process contains spaces and parentheses, and it
+	// started 123456.78s after boot.
+	startTime, err := processStartTime("testdata/procfs", 1234)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(1618309500, 0).Add(123456*time.Second+780*time.Millisecond), startTime)
+
+	// The spec of the container carries the start time.
+	var spec info.ContainerSpec
+	NewHandler(nil, "testdata/procfs", 1234, nil).UpdateSpecFromProc(&spec)
+	assert.Equal(t, startTime, spec.StartTime)
+
+	_, err = processStartTime("testdata/procfs", 4321)
+	assert.Error(t, err)
+	_, err = parseStartTime("1234 (truncated) S 1 1234")
+	assert.Error(t, err)
+}
+
+func TestNamespacesFromProc(t *testing.T) {
+	// The user namespace link is missing.
+	expected := map[string]uint64{
+		"cgroup": 4026531835,
+		"ipc":    4026532461,
+		"mnt":    4026532459,
+		"net":    4026531992,
+		"pid":    4026532462,
+		"uts":    4026532460,
+	}
+	assert.Equal(t, expected, namespacesFromProc("testdata/procfs", 1234))
+
+	var spec info.ContainerSpec
+	NewHandler(nil, "testdata/procfs", 1234, nil).UpdateSpecFromProc(&spec)
+	assert.Equal(t, expected, spec.Namespaces)
+
+	assert.Nil(t, namespacesFromProc("testdata/procfs", 4321))
+}
+
+func TestOomSpecFromProc(t *testing.T) {
+	expected := &info.OomSpec{ScoreAdj: -500, Score: 166}
+	assert.Equal(t, expected, oomSpecFromProc("testdata/procfs", 1234))
+
+	var spec info.ContainerSpec
+	NewHandler(nil, "testdata/procfs", 1234, nil).UpdateSpecFromProc(&spec)
+	assert.Equal(t, expected, spec.Oom)
+
+	// The init process exited.
+	assert.Nil(t, oomSpecFromProc("testdata/procfs", 4321))
+}
+
+func TestSchedulingSpecFromProc(t *testing.T) {
+	expected := &info.SchedulingSpec{Nice: 5, Priority: 25}
+	assert.Equal(t, expected, schedulingSpecFromProc("testdata/procfs", 1234))
+
+	var spec info.ContainerSpec
+	NewHandler(nil, "testdata/procfs", 1234, nil).UpdateSpecFromProc(&spec)
+	assert.Equal(t, expected, spec.Scheduling)
+
+	// The init process exited.
+	assert.Nil(t, schedulingSpecFromProc("testdata/procfs", 4321))
+
+	// Processes of the real-time policies have a negative priority.
+	priority, nice, err := parsePriority("42 (rt) S 1 42 42 0 -1 0 0 0 0 0 0 0 0 0 -51 0 1 0 100")
+	assert.NoError(t, err)
+	assert.Equal(t, -51, priority)
+	assert.Equal(t, 0, nice)
+
+	_, _, err = parsePriority("42 (truncated) S 1 42")
+	assert.Error(t, err)
+}
+
+func TestParseNamespaceLink(t *testing.T) {
+	inode, err := parseNamespaceLink("net", "net:[4026531992]")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4026531992), inode)
+
+	for _, target := range []string{"", "pid:[4026531992]", "net:4026531992", "net:[abc]"} {
+		_, err := parseNamespaceLink("net", target)
+		assert.Error(t, err, target)
+	}
+}
+
+func TestTicksSinceBoot(t *testing.T) {
+	bootTime := time.Unix(1618309500, 0)
+	assert.Equal(t, bootTime, ticksSinceBoot(1618309500, 0))
+	assert.Equal(t, bootTime.Add(10*time.Millisecond), ticksSinceBoot(1618309500, 1))
+	assert.Equal(t, bootTime.Add(90*24*time.Hour+990*time.Millisecond), ticksSinceBoot(1618309500, 90*24*3600*clockTicks+99))
+}
+
+func TestSecuritySpecFromProc(t *testing.T) {
+	spec := securitySpecFromProc("testdata/procfs", 1234)
+	assert.Equal(t, "filter", spec.SeccompMode)
+	assert.Equal(t, "docker-default", spec.AppArmorProfile)
+	assert.Equal(t, "enforce", spec.AppArmorMode)
+
+	// Missing procfs entries are reported as unconfined, with an unknown
+	// seccomp mode.
+	spec = securitySpecFromProc("testdata/procfs", 4321)
+	assert.Equal(t, info.SecuritySpec{AppArmorProfile: "unconfined"}, spec)
+}
+
+func TestParseSeccompMode(t *testing.T) {
+	assert.Equal(t, "disabled", parseSeccompMode("Name:\tfoo\nSeccomp:\t0\n"))
+	assert.Equal(t, "strict", parseSeccompMode("Seccomp:\t1\n"))
+	assert.Equal(t, "filter", parseSeccompMode("Seccomp:\t2\n"))
+	assert.Equal(t, "", parseSeccompMode("Seccomp:\t3\n"))
+	// Kernels without seccomp.
+	assert.Equal(t, "disabled", parseSeccompMode("Name:\tfoo\n"))
+}
+
+func TestParseAppArmorProfile(t *testing.T) {
+	for _, testItem := range []struct {
+		current string
+		profile string
+		mode    string
+	}{
+		{"", "unconfined", ""},
+		{"unconfined\n", "unconfined", ""},
+		{"docker-default (enforce)\n", "docker-default", "enforce"},
+		{"/usr/bin/foo (complain)\x00", "/usr/bin/foo", "complain"},
+		{"custom", "custom", ""},
+	} {
+		profile, mode := parseAppArmorProfile(testItem.current)
+		assert.Equal(t, testItem.profile, profile, testItem.current)
+		assert.Equal(t, testItem.mode, mode, testItem.current)
+	}
+}
+
+type fakeSubsystem struct {
+	name string
+	err  error
+}
+
+func (s *fakeSubsystem) Name() string {
+	return s.name
+}
+
+func (s *fakeSubsystem) GetStats(path string, stats *cgroups.Stats) error {
+	if s.err != nil {
+		return s.err
+	}
+	stats.CpuStats.CpuUsage.TotalUsage = 100
+	return nil
+}
+
+func TestReadCgroupV1StatsPartialFailure(t *testing.T) {
+	paths := map[string]string{
+		"cpuacct": "/sys/fs/cgroup/cpuacct/test",
+		"memory":  "/sys/fs/cgroup/memory/test",
+	}
+	subsystems := []cgroupSubsystem{
+		&fakeSubsystem{name: "memory", err: &os.PathError{Op: "open", Path: "memory.stat", Err: syscall.ENODEV}},
+		&fakeSubsystem{name: "cpuacct"},
+		&fakeSubsystem{name: "pids", err: syscall.EACCES},
+	}
+	before := testutil.ToFloat64(CgroupReadErrors.WithLabelValues("memory", "no_device"))
+
+	stats, err := readCgroupV1Stats(paths, subsystems)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 100, stats.CpuStats.CpuUsage.TotalUsage)
+	assert.Equal(t, before+1, testutil.ToFloat64(CgroupReadErrors.WithLabelValues("memory", "no_device")))
+	// Controllers without a path are not read.
+	assert.Equal(t, 0.0, testutil.ToFloat64(CgroupReadErrors.WithLabelValues("pids", "permission_denied")))
+
+	// An error is returned if nothing could be read.
+	_, err = readCgroupV1Stats(paths, subsystems[:1])
+	assert.NotNil(t, err)
+}
+
+func TestCgroupV1SubsystemsFollowPaths(t *testing.T) {
+	includedMetrics := container.MetricSet{
+		container.CpuUsageMetrics: struct{}{},
+		container.ProcessMetrics:  struct{}{},
+	}
+	handler := NewHandler(nil, "/", 0, includedMetrics)
+	paths := map[string]string{
+		"cpu":        "/sys/fs/cgroup/cpu,cpuacct/test",
+		"cpuacct":    "/sys/fs/cgroup/cpu,cpuacct/test",
+		"memory":     "/sys/fs/cgroup/memory/test",
+		"pids":       "/sys/fs/cgroup/pids/test",
+		"perf_event": "/sys/fs/cgroup/perf_event/test",
+	}
+	var names []string
+	for _, sys := range handler.cgroupV1Subsystems(paths) {
+		names = append(names, sys.Name())
+	}
+	// The memory stats are not needed and perf_event has no stats.
+	assert.Equal(t, []string{"cpu", "cpuacct", "pids"}, names)
+}
+
+func TestCountCgroupV2ReadErrors(t *testing.T) {
+	cgroupPath, err := ioutil.TempDir("", "cgroup")
+	require.NoError(t, err)
+	defer os.RemoveAll(cgroupPath)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(cgroupPath, "pids.current"), []byte("1\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(cgroupPath, "cpu.stat"), []byte("usage_usec 1\n"), 0644))
+	// Reading a directory fails like an unreadable stat file.
+	require.NoError(t, os.Mkdir(filepath.Join(cgroupPath, "io.stat"), 0755))
+	statsErr := errors.New("error while statting cgroup v2")
+	ioErrors := CgroupReadErrors.WithLabelValues("io", "other")
+	unifiedErrors := CgroupReadErrors.WithLabelValues("unified", "other")
+	before, unifiedBefore := testutil.ToFloat64(ioErrors), testutil.ToFloat64(unifiedErrors)
+
+	countCgroupV2ReadErrors(cgroupPath, statsErr)
+	assert.Equal(t, before+1, testutil.ToFloat64(ioErrors))
+	// The missing memory.stat is not an error.
+	assert.Equal(t, unifiedBefore, testutil.ToFloat64(unifiedErrors))
+
+	// Errors of no known controller are still counted.
+	require.NoError(t, os.Remove(filepath.Join(cgroupPath, "io.stat")))
+	countCgroupV2ReadErrors(cgroupPath, statsErr)
+	assert.Equal(t, unifiedBefore+1, testutil.ToFloat64(unifiedErrors))
+}
+
+func TestCgroupV1PathsFollowIncludedMetrics(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroups")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	memoryPath := filepath.Join(root, "memory", "test")
+	require.NoError(t, os.MkdirAll(memoryPath, 0755))
+	for file, content := range map[string]string{
+		"memory.stat":               "cache 4096\n",
+		"memory.use_hierarchy":      "1\n",
+		"memory.usage_in_bytes":     "1048576\n",
+		"memory.max_usage_in_bytes": "2097152\n",
+		"memory.failcnt":            "0\n",
+		"memory.limit_in_bytes":     "9223372036854771712\n",
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(memoryPath, file), []byte(content), 0644))
+	}
+	// The files are not on a cgroup filesystem.
+	defer func(testMode bool) { cgroups.TestMode = testMode }(cgroups.TestMode)
+	cgroups.TestMode = true
+	mounts := cgroupMountsAt(root, []string{"cpu,cpuacct", "memory"})
+	_, restore := mockCgroupMounts(mounts, mounts)
+	defer restore()
+	defer func() { currentMountPoints = nil }()
+
+	// The memory metrics are disabled when the container is created.
+	includedMetrics := container.MetricSet{container.CpuUsageMetrics: struct{}{}}
+	cpuPath := filepath.Join(root, "cpu,cpuacct", "test")
+	cgroupManager := fs.NewManager(&configs.Cgroup{Name: "/test"}, map[string]string{"cpu": cpuPath, "cpuacct": cpuPath}, false)
+	handler := NewHandler(cgroupManager, "/", 0, includedMetrics)
+	memoryUsage := func() uint64 {
+		cgroupStats, err := readCgroupV1Stats(handler.cgroupV1Paths(), []cgroupSubsystem{&fs.MemoryGroup{}})
+		require.NoError(t, err)
+		return newContainerStats(&libcontainer.Stats{CgroupStats: cgroupStats}, includedMetrics).Memory.Usage
+	}
+	assert.Equal(t, uint64(0), memoryUsage())
+
+	includedMetrics.Update(container.MetricSet{
+		container.CpuUsageMetrics:    struct{}{},
+		container.MemoryUsageMetrics: struct{}{},
+	})
+	require.NoError(t, UpdateCgroupSubsystems(includedMetrics))
+	assert.Equal(t, map[string]string{"cpu": cpuPath, "cpuacct": cpuPath, "memory": memoryPath}, handler.cgroupV1Paths())
+	assert.Equal(t, uint64(1048576), memoryUsage())
+
+	includedMetrics.Update(container.MetricSet{container.CpuUsageMetrics: struct{}{}})
+	require.NoError(t, UpdateCgroupSubsystems(includedMetrics))
+	assert.Equal(t, uint64(0), memoryUsage())
+}
+
 func TestReferencedBytesStat(t *testing.T) {
 	//overwrite package variables
 	smapsFilePathPattern = "testdata/smaps%d"
@@ -15,7 +15,16 @@
 package libcontainer
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	info "github.com/google/cadvisor/info/v1"
 
@@ -28,6 +37,27 @@ import (
 	"k8s.io/klog/v2"
 )
 
+var cgroupRootPrefix = flag.String("cgroup_root_prefix", "", "Prefix of the paths of the cgroup mounts, e.g. /host when the cgroup hierarchies of the host are bind mounted at /host/sys/fs/cgroup. Empty uses the mount points as discovered.")
+
+var diskStatsAggregateRegex = flag.String("disk_stats_aggregate_regex", "", "Regular expression matching the names of block devices, e.g. ^loop[0-9]+$, whose per-device IO stats are summed into a single \"aggregated\" device, to bound the cardinality of disk metrics when devices churn. Empty keeps per-device stats.")
+
+var (
+	diskStatsDeviceAllowlist = flag.String("disk_stats_device_allowlist", "", "Comma-separated list of glob patterns, e.g. nvme*,sd*, matching the names of the block devices whose IO stats are reported. Empty reports all devices.")
+	diskStatsDeviceDenylist  = flag.String("disk_stats_device_denylist", "", "Comma-separated list of glob patterns, e.g. loop*,ram*,dm-*, matching the names of the block devices whose IO stats are not reported, even if allowed by --disk_stats_device_allowlist.")
+)
+
+var (
+	// getCgroupMounts returns the cgroup mounts of the machine.
+	// This is defined as a variable to help in testing.
+	getCgroupMounts = cgroups.GetCgroupMounts
+
+	// Number of attempts at finding the cgroup mounts, which may not be
+	// mounted yet when cAdvisor is started early during boot.
+	cgroupMountsAttempts = 5
+	// Delay before the second attempt, doubled after each attempt.
+	cgroupMountsBackoff = 500 * time.Millisecond
+)
+
 type CgroupSubsystems struct {
 	// Cgroup subsystem mounts.
 	// e.g.: "/sys/fs/cgroup/cpu" -> ["cpu", "cpuacct"]
@@ -41,7 +71,7 @@ type CgroupSubsystems struct {
 // Get information about the cgroup subsystems those we want
 func GetCgroupSubsystems(includedMetrics container.MetricSet) (CgroupSubsystems, error) {
 	// Get all cgroup mounts.
-	allCgroups, err := cgroups.GetCgroupMounts(true)
+	allCgroups, err := getCgroupMountsWithRetry()
 	if err != nil {
 		return CgroupSubsystems{}, err
 	}
@@ -83,7 +113,7 @@ func GetCgroupSubsystems(includedMetrics container.MetricSet) (CgroupSubsystems,
 // Get information about all the cgroup subsystems.
 func GetAllCgroupSubsystems() (CgroupSubsystems, error) {
 	// Get all cgroup mounts.
-	allCgroups, err := cgroups.GetCgroupMounts(true)
+	allCgroups, err := getCgroupMountsWithRetry()
 	if err != nil {
 		return CgroupSubsystems{}, err
 	}
@@ -92,6 +122,94 @@ func GetAllCgroupSubsystems() (CgroupSubsystems, error) {
 	return getCgroupSubsystemsHelper(allCgroups, emptyDisableCgroups)
 }
 
+var (
+	// Mount points of the cgroup subsystems needed by the included metrics,
+	// re-derived when these are updated at runtime. Nil until then, the
+	// containers keeping the cgroup paths derived when they were created.
+	currentMountPoints     map[string]string
+	currentMountPointsLock sync.RWMutex
+)
+
+// UpdateCgroupSubsystems re-derives the cgroup subsystems needed by the
+// included metrics after their update at runtime. The subsystems of the
+// enabled metrics are read, and those of the disabled ones are not anymore,
+// from the next stats collection of the containers.
+func UpdateCgroupSubsystems(includedMetrics container.MetricSet) error {
+	subsystems, err := GetCgroupSubsystems(includedMetrics)
+	if err != nil {
+		return err
+	}
+	currentMountPointsLock.Lock()
+	defer currentMountPointsLock.Unlock()
+	currentMountPoints = subsystems.MountPoints
+	return nil
+}
+
+// CurrentCgroupPaths returns the paths of the cgroup name in the hierarchies
+// of the cgroup subsystems needed by the included metrics. paths, derived from
+// the subsystems needed when the container was created, are returned as is
+// unless the included metrics were updated since.
+func CurrentCgroupPaths(name string, paths map[string]string) map[string]string {
+	currentMountPointsLock.RLock()
+	mountPoints := currentMountPoints
+	currentMountPointsLock.RUnlock()
+	if mountPoints == nil {
+		return paths
+	}
+
+	current := make(map[string]string, len(mountPoints))
+	for subsystem, mountPoint := range mountPoints {
+		if cgroupPath, ok := paths[subsystem]; ok {
+			current[subsystem] = cgroupPath
+		} else {
+			current[subsystem] = filepath.Join(mountPoint, name)
+		}
+	}
+	return current
+}
+
+// getCgroupMountsWithRetry returns the cgroup mounts of the machine, retrying
+// with an exponential backoff while none are found or they cannot be read yet.
+// The result of the last attempt is returned once all attempts are exhausted,
+// or as soon as an error which isn't transient is returned.
+func getCgroupMountsWithRetry() ([]cgroups.Mount, error) {
+	backoff := cgroupMountsBackoff
+	for attempt := 1; ; attempt++ {
+		mounts, err := getCgroupMounts(true)
+		if (err == nil && len(mounts) > 0) || (err != nil && !isTransientMountsError(err)) || attempt >= cgroupMountsAttempts {
+			return prefixCgroupMounts(mounts, *cgroupRootPrefix), err
+		}
+		klog.V(1).Infof("Cgroup mounts not found (attempt %d/%d), retrying in %v: %v", attempt, cgroupMountsAttempts, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// isTransientMountsError returns whether the cgroup mounts may be read by a
+// later attempt, i.e. /proc isn't mounted yet early in boot or the read was
+// interrupted. Other errors, e.g. a permission denied or a malformed mount
+// table, won't go away by retrying.
+func isTransientMountsError(err error) bool {
+	return errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN)
+}
+
+// prefixCgroupMounts returns the mounts with the given prefix prepended to
+// their mount point, unless it already starts with it.
+func prefixCgroupMounts(mounts []cgroups.Mount, prefix string) []cgroups.Mount {
+	if prefix == "" || prefix == "/" {
+		return mounts
+	}
+	prefix = filepath.Clean(prefix)
+	prefixed := make([]cgroups.Mount, 0, len(mounts))
+	for _, mount := range mounts {
+		if mount.Mountpoint != prefix && !strings.HasPrefix(mount.Mountpoint, prefix+"/") {
+			mount.Mountpoint = filepath.Join(prefix, mount.Mountpoint)
+		}
+		prefixed = append(prefixed, mount)
+	}
+	return prefixed
+}
+
 func getCgroupSubsystemsHelper(allCgroups []cgroups.Mount, disableCgroups map[string]struct{}) (CgroupSubsystems, error) {
 	if len(allCgroups) == 0 {
 		return CgroupSubsystems{}, fmt.Errorf("failed to find cgroup mounts")
@@ -168,28 +286,214 @@ func DiskStatsCopy1(diskStat map[DiskKey]*info.PerDiskStats) []info.PerDiskStats
 	return stat
 }
 
+// AggregatedDiskKey and AggregatedDiskDevice identify the device into which
+// the stats of the devices matching --disk_stats_aggregate_regex are summed.
+var AggregatedDiskKey = DiskKey{Major: 0, Minor: 0}
+
+const AggregatedDiskDevice = "aggregated"
+
+var (
+	diskAggregateRegexOnce sync.Once
+	diskAggregateRegex     *regexp.Regexp
+
+	diskDeviceFilterOnce sync.Once
+	diskDeviceFilterVal  *diskDeviceFilter
+
+	// Names of the block devices by key.
+	blockDeviceNames sync.Map
+)
+
+// blockDeviceName returns the name of a block device, e.g. loop0.
+// This is defined as a variable to help in testing.
+var blockDeviceName = func(major, minor uint64) (string, error) {
+	target, err := os.Readlink(fmt.Sprintf("/sys/dev/block/%d:%d", major, minor))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(target), nil
+}
+
+// ValidateFlags returns an error if the flags configuring the stats read by
+// this package are invalid, so that they are rejected at startup rather than
+// when they are first used.
+func ValidateFlags() error {
+	if _, err := compileDiskAggregateRegex(*diskStatsAggregateRegex); err != nil {
+		return fmt.Errorf("invalid --disk_stats_aggregate_regex %q: %v", *diskStatsAggregateRegex, err)
+	}
+	if _, err := parseProcMetrics(*procMetricsFlag); err != nil {
+		return fmt.Errorf("invalid --proc_metrics %q: %v", *procMetricsFlag, err)
+	}
+	if _, err := newDiskDeviceFilter(*diskStatsDeviceAllowlist, *diskStatsDeviceDenylist); err != nil {
+		return err
+	}
+	return nil
+}
+
+// compileDiskAggregateRegex returns the regexp matching the names of the
+// devices to aggregate, or nil if expr is empty.
+func compileDiskAggregateRegex(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
+
+// getDiskAggregateRegex returns the regexp matching the names of the devices
+// to aggregate, or nil if they are not aggregated.
+func getDiskAggregateRegex() *regexp.Regexp {
+	diskAggregateRegexOnce.Do(func() {
+		var err error
+		diskAggregateRegex, err = compileDiskAggregateRegex(*diskStatsAggregateRegex)
+		if err != nil {
+			// Only reached when ValidateFlags wasn't called.
+			klog.Errorf("Invalid --disk_stats_aggregate_regex %q, not aggregating disk stats: %v", *diskStatsAggregateRegex, err)
+		}
+	})
+	return diskAggregateRegex
+}
+
+// diskDeviceFilter selects the block devices whose stats are reported by
+// their name.
+type diskDeviceFilter struct {
+	allow []string
+	deny  []string
+}
+
+// parseDiskDevicePatterns parses a comma-separated list of glob patterns.
+func parseDiskDevicePatterns(list string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(list, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// newDiskDeviceFilter returns a filter from comma-separated lists of glob
+// patterns, or nil if both are empty.
+func newDiskDeviceFilter(allowlist, denylist string) (*diskDeviceFilter, error) {
+	allow, err := parseDiskDevicePatterns(allowlist)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --disk_stats_device_allowlist %q: %v", allowlist, err)
+	}
+	deny, err := parseDiskDevicePatterns(denylist)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --disk_stats_device_denylist %q: %v", denylist, err)
+	}
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	return &diskDeviceFilter{allow: allow, deny: deny}, nil
+}
+
+// getDiskDeviceFilter returns the filter of --disk_stats_device_allowlist and
+// --disk_stats_device_denylist, or nil if all devices are reported.
+func getDiskDeviceFilter() *diskDeviceFilter {
+	diskDeviceFilterOnce.Do(func() {
+		var err error
+		diskDeviceFilterVal, err = newDiskDeviceFilter(*diskStatsDeviceAllowlist, *diskStatsDeviceDenylist)
+		if err != nil {
+			// Only reached when ValidateFlags wasn't called.
+			klog.Errorf("Not filtering disk stats: %v", err)
+		}
+	})
+	return diskDeviceFilterVal
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// keep returns whether the stats of the device with the given name are
+// reported. The devices whose name is unknown are only reported if there is
+// no allowlist.
+func (f *diskDeviceFilter) keep(name string, known bool) bool {
+	if f == nil {
+		return true
+	}
+	if !known {
+		return len(f.allow) == 0
+	}
+	if len(f.allow) > 0 && !matchAny(f.allow, name) {
+		return false
+	}
+	return !matchAny(f.deny, name)
+}
+
+// cachedBlockDeviceName returns the name of a block device, resolving it
+// from sysfs the first time.
+func cachedBlockDeviceName(key DiskKey) (string, bool) {
+	if name, ok := blockDeviceNames.Load(key); ok {
+		return name.(string), true
+	}
+	name, err := blockDeviceName(key.Major, key.Minor)
+	if err != nil {
+		// The device may be gone already, do not cache its name.
+		klog.V(5).Infof("Unable to get name of block device %d:%d: %v", key.Major, key.Minor, err)
+		return "", false
+	}
+	blockDeviceNames.Store(key, name)
+	return name, true
+}
+
+// diskKey returns the key under which the stats of a device are reported,
+// which is the aggregated one for the devices whose name matches re, and
+// whether they are reported at all according to filter.
+func diskKey(major, minor uint64, re *regexp.Regexp, filter *diskDeviceFilter) (DiskKey, bool) {
+	key := DiskKey{Major: major, Minor: minor}
+	if re == nil && filter == nil {
+		return key, true
+	}
+	name, known := cachedBlockDeviceName(key)
+	if !filter.keep(name, known) {
+		return key, false
+	}
+	if known && re != nil && re.MatchString(name) {
+		return AggregatedDiskKey, true
+	}
+	return key, true
+}
+
 func DiskStatsCopy(blkioStats []cgroups.BlkioStatEntry) (stat []info.PerDiskStats) {
+	return diskStatsCopy(blkioStats, getDiskAggregateRegex(), getDiskDeviceFilter())
+}
+
+// diskStatsCopy returns the stats of each device allowed by filter, summing
+// the stats of the devices whose name matches re into the aggregated device.
+func diskStatsCopy(blkioStats []cgroups.BlkioStatEntry, re *regexp.Regexp, filter *diskDeviceFilter) (stat []info.PerDiskStats) {
 	if len(blkioStats) == 0 {
 		return
 	}
 	diskStat := make(map[DiskKey]*info.PerDiskStats)
 	for i := range blkioStats {
-		major := blkioStats[i].Major
-		minor := blkioStats[i].Minor
-		key := DiskKey{
-			Major: major,
-			Minor: minor,
+		key, ok := diskKey(blkioStats[i].Major, blkioStats[i].Minor, re, filter)
+		if !ok {
+			continue
 		}
 		diskp, ok := diskStat[key]
 		if !ok {
-			diskp = DiskStatsCopy0(major, minor)
+			diskp = DiskStatsCopy0(key.Major, key.Minor)
+			if key == AggregatedDiskKey {
+				diskp.Device = AggregatedDiskDevice
+			}
 			diskStat[key] = diskp
 		}
 		op := blkioStats[i].Op
 		if op == "" {
 			op = "Count"
 		}
-		diskp.Stats[op] = blkioStats[i].Value
+		diskp.Stats[op] += blkioStats[i].Value
 	}
 	return DiskStatsCopy1(diskStat)
 }
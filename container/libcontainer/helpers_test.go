@@ -15,14 +15,20 @@
 package libcontainer
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"sort"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	info "github.com/google/cadvisor/info/v1"
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/stretchr/testify/assert"
 )
@@ -117,6 +123,99 @@ func TestGetCgroupSubsystems(t *testing.T) {
 	}
 }
 
+func mockCgroupMounts(results ...[]cgroups.Mount) (calls *int, restore func()) {
+	oldGetCgroupMounts, oldBackoff := getCgroupMounts, cgroupMountsBackoff
+	calls = new(int)
+	getCgroupMounts = func(bool) ([]cgroups.Mount, error) {
+		result := results[*calls]
+		*calls++
+		return result, nil
+	}
+	cgroupMountsBackoff = 0
+	return calls, func() {
+		getCgroupMounts, cgroupMountsBackoff = oldGetCgroupMounts, oldBackoff
+	}
+}
+
+func TestGetAllCgroupSubsystemsRetriesUntilMounted(t *testing.T) {
+	calls, restore := mockCgroupMounts(nil, []cgroups.Mount{}, cgroupMountsAt("/sys/fs/cgroup", []string{"memory"}))
+	defer restore()
+
+	subsystems, err := GetAllCgroupSubsystems()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, *calls)
+	assertCgroupSubsystemsEqual(t, CgroupSubsystems{
+		MountPoints: map[string]string{"memory": "/sys/fs/cgroup/memory"},
+		Mounts:      cgroupMountsAt("/sys/fs/cgroup", []string{"memory"}),
+	}, subsystems, "")
+}
+
+func TestGetAllCgroupSubsystemsGivesUpAfterRetries(t *testing.T) {
+	results := make([][]cgroups.Mount, cgroupMountsAttempts)
+	calls, restore := mockCgroupMounts(results...)
+	defer restore()
+
+	_, err := GetAllCgroupSubsystems()
+	assert.EqualError(t, err, "failed to find cgroup mounts")
+	assert.Equal(t, cgroupMountsAttempts, *calls)
+}
+
+func TestGetAllCgroupSubsystemsRetriesOnlyTransientErrors(t *testing.T) {
+	defer func(getMounts func(bool) ([]cgroups.Mount, error), backoff time.Duration) {
+		getCgroupMounts, cgroupMountsBackoff = getMounts, backoff
+	}(getCgroupMounts, cgroupMountsBackoff)
+	cgroupMountsBackoff = 0
+	mountsWithErrors := func(errs ...error) *int {
+		calls := new(int)
+		getCgroupMounts = func(bool) ([]cgroups.Mount, error) {
+			err := errs[*calls]
+			*calls++
+			if err != nil {
+				return nil, err
+			}
+			return cgroupMountsAt("/sys/fs/cgroup", []string{"memory"}), nil
+		}
+		return calls
+	}
+
+	// /proc isn't mounted yet.
+	calls := mountsWithErrors(&os.PathError{Op: "open", Path: "/proc/self/mountinfo", Err: syscall.ENOENT}, nil)
+	_, err := GetAllCgroupSubsystems()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, *calls)
+
+	calls = mountsWithErrors(&os.PathError{Op: "open", Path: "/proc/self/mountinfo", Err: syscall.EACCES}, nil)
+	_, err = GetAllCgroupSubsystems()
+	assert.True(t, errors.Is(err, syscall.EACCES), "unexpected error %v", err)
+	assert.Equal(t, 1, *calls)
+
+	calls = mountsWithErrors(fmt.Errorf("parsing '/proc/self/mountinfo' failed: not enough fields"), nil)
+	_, err = GetAllCgroupSubsystems()
+	assert.Error(t, err)
+	assert.Equal(t, 1, *calls)
+}
+
+func TestGetAllCgroupSubsystemsWithRootPrefix(t *testing.T) {
+	mounts := append(cgroupMountsAt("/sys/fs/cgroup", []string{"memory"}), cgroupMountsAt("/host/sys/fs/cgroup", []string{"pids"})...)
+	_, restore := mockCgroupMounts(mounts)
+	defer restore()
+	oldCgroupRootPrefix := *cgroupRootPrefix
+	*cgroupRootPrefix = "/host/"
+	defer func() { *cgroupRootPrefix = oldCgroupRootPrefix }()
+
+	subsystems, err := GetAllCgroupSubsystems()
+	assert.NoError(t, err)
+	// The pids hierarchy is already mounted under the prefix.
+	assertCgroupSubsystemsEqual(t, CgroupSubsystems{
+		MountPoints: map[string]string{
+			"memory": "/host/sys/fs/cgroup/memory",
+			"pids":   "/host/sys/fs/cgroup/pids",
+		},
+		Mounts: cgroupMountsAt("/host/sys/fs/cgroup", []string{"memory", "pids"}),
+	}, subsystems, "")
+	assert.Equal(t, "/sys/fs/cgroup/memory", mounts[0].Mountpoint, "the discovered mounts are left untouched")
+}
+
 func assertCgroupSubsystemsEqual(t *testing.T, expected, actual CgroupSubsystems, message string) {
 	if !reflect.DeepEqual(expected.MountPoints, actual.MountPoints) {
 		t.Fatalf("%s Expected %v == %v", message, expected.MountPoints, actual.MountPoints)
@@ -145,3 +244,139 @@ func clearTestData(t *testing.T, clearRefsPaths []string) {
 		assert.Nil(t, err)
 	}
 }
+
+func TestValidateFlags(t *testing.T) {
+	oldDiskStatsAggregateRegex := *diskStatsAggregateRegex
+	oldProcMetrics := *procMetricsFlag
+	oldDiskStatsDeviceAllowlist := *diskStatsDeviceAllowlist
+	oldDiskStatsDeviceDenylist := *diskStatsDeviceDenylist
+	defer func() {
+		*diskStatsAggregateRegex = oldDiskStatsAggregateRegex
+		*procMetricsFlag = oldProcMetrics
+		*diskStatsDeviceAllowlist = oldDiskStatsDeviceAllowlist
+		*diskStatsDeviceDenylist = oldDiskStatsDeviceDenylist
+	}()
+
+	*diskStatsAggregateRegex = ""
+	assert.Nil(t, ValidateFlags())
+	*diskStatsAggregateRegex = `^loop[0-9]+$`
+	assert.Nil(t, ValidateFlags())
+	*diskStatsAggregateRegex = `^loop[0-9+$`
+	assert.NotNil(t, ValidateFlags())
+	*diskStatsAggregateRegex = ""
+
+	*procMetricsFlag = "oom_score=oom_score"
+	assert.Nil(t, ValidateFlags())
+	*procMetricsFlag = "oom_score=../1/oom_score"
+	assert.NotNil(t, ValidateFlags())
+	*procMetricsFlag = ""
+
+	*diskStatsDeviceAllowlist = "nvme*"
+	*diskStatsDeviceDenylist = "nvme1n1"
+	assert.Nil(t, ValidateFlags())
+	*diskStatsDeviceAllowlist = "["
+	assert.NotNil(t, ValidateFlags())
+	*diskStatsDeviceAllowlist = ""
+	*diskStatsDeviceDenylist = "["
+	assert.NotNil(t, ValidateFlags())
+}
+
+func TestDiskStatsCopyAggregatesDevices(t *testing.T) {
+	names := map[DiskKey]string{
+		{Major: 7, Minor: 0}:  "loop0",
+		{Major: 7, Minor: 1}:  "loop1",
+		{Major: 8, Minor: 0}:  "sda",
+		{Major: 8, Minor: 16}: "sdb",
+	}
+	oldBlockDeviceName := blockDeviceName
+	blockDeviceName = func(major, minor uint64) (string, error) {
+		name, ok := names[DiskKey{Major: major, Minor: minor}]
+		if !ok {
+			return "", fmt.Errorf("unknown device %d:%d", major, minor)
+		}
+		return name, nil
+	}
+	defer func() { blockDeviceName = oldBlockDeviceName }()
+
+	blkioStats := []cgroups.BlkioStatEntry{
+		{Major: 7, Minor: 0, Op: "Read", Value: 1},
+		{Major: 7, Minor: 0, Op: "Write", Value: 2},
+		{Major: 7, Minor: 1, Op: "Read", Value: 10},
+		{Major: 8, Minor: 0, Op: "Read", Value: 100},
+		{Major: 8, Minor: 16, Op: "Read", Value: 1000},
+	}
+	byKey := func(stats []info.PerDiskStats) map[DiskKey]info.PerDiskStats {
+		result := map[DiskKey]info.PerDiskStats{}
+		for _, stat := range stats {
+			result[DiskKey{Major: stat.Major, Minor: stat.Minor}] = stat
+		}
+		return result
+	}
+
+	// Per-device stats by default.
+	assert.Len(t, diskStatsCopy(blkioStats, nil, nil), 4)
+
+	stats := byKey(diskStatsCopy(blkioStats, regexp.MustCompile(`^loop[0-9]+$`), nil))
+	assert.Equal(t, map[DiskKey]info.PerDiskStats{
+		AggregatedDiskKey:     {Device: AggregatedDiskDevice, Stats: map[string]uint64{"Read": 11, "Write": 2}},
+		{Major: 8, Minor: 0}:  {Major: 8, Minor: 0, Stats: map[string]uint64{"Read": 100}},
+		{Major: 8, Minor: 16}: {Major: 8, Minor: 16, Stats: map[string]uint64{"Read": 1000}},
+	}, stats)
+}
+
+func TestDiskStatsCopyFiltersDevices(t *testing.T) {
+	names := map[DiskKey]string{
+		{Major: 7, Minor: 8}:   "loop8",
+		{Major: 1, Minor: 3}:   "ram3",
+		{Major: 259, Minor: 0}: "nvme0n1",
+		{Major: 259, Minor: 1}: "nvme1n1",
+		{Major: 8, Minor: 32}:  "sdc",
+	}
+	oldBlockDeviceName := blockDeviceName
+	blockDeviceName = func(major, minor uint64) (string, error) {
+		name, ok := names[DiskKey{Major: major, Minor: minor}]
+		if !ok {
+			return "", fmt.Errorf("unknown device %d:%d", major, minor)
+		}
+		return name, nil
+	}
+	defer func() { blockDeviceName = oldBlockDeviceName }()
+
+	blkioStats := []cgroups.BlkioStatEntry{
+		{Major: 7, Minor: 8, Op: "Read", Value: 1},
+		{Major: 1, Minor: 3, Op: "Read", Value: 2},
+		{Major: 259, Minor: 0, Op: "Read", Value: 3},
+		{Major: 259, Minor: 1, Op: "Read", Value: 4},
+		{Major: 8, Minor: 32, Op: "Read", Value: 5},
+		{Major: 253, Minor: 99, Op: "Read", Value: 6},
+	}
+	devices := func(stats []info.PerDiskStats) []DiskKey {
+		keys := []DiskKey{}
+		for _, stat := range stats {
+			keys = append(keys, DiskKey{Major: stat.Major, Minor: stat.Minor})
+		}
+		return keys
+	}
+
+	filter := func(allowlist, denylist string) *diskDeviceFilter {
+		filter, err := newDiskDeviceFilter(allowlist, denylist)
+		assert.Nil(t, err)
+		return filter
+	}
+
+	assert.Nil(t, filter("", " , "))
+	_, err := newDiskDeviceFilter("nvme*,[", "")
+	assert.NotNil(t, err)
+	_, err = newDiskDeviceFilter("", "[")
+	assert.NotNil(t, err)
+
+	// The device whose name is unknown is kept without an allowlist.
+	denied := diskStatsCopy(blkioStats, nil, filter("", "loop*,ram*"))
+	assert.ElementsMatch(t, []DiskKey{{Major: 259, Minor: 0}, {Major: 259, Minor: 1}, {Major: 8, Minor: 32}, {Major: 253, Minor: 99}}, devices(denied))
+
+	allowed := diskStatsCopy(blkioStats, nil, filter("nvme*", ""))
+	assert.ElementsMatch(t, []DiskKey{{Major: 259, Minor: 0}, {Major: 259, Minor: 1}}, devices(allowed))
+
+	both := diskStatsCopy(blkioStats, nil, filter("nvme*,sd*,loop*", "loop*,nvme1n1"))
+	assert.ElementsMatch(t, []DiskKey{{Major: 259, Minor: 0}, {Major: 8, Minor: 32}}, devices(both))
+}
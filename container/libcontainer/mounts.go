@@ -0,0 +1,92 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcontainer
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/moby/sys/mountinfo"
+)
+
+// mountsCacheDuration is how long the mount table of a mount namespace is
+// reused before being read again. The mounts of a container rarely change
+// once it is started.
+// This is defined as a variable to help in testing.
+var mountsCacheDuration = time.Minute
+
+type cachedMounts struct {
+	mounts []*mountinfo.Info
+	readAt time.Time
+}
+
+var (
+	mountsCacheLock sync.Mutex
+	// Mount tables by mount namespace, e.g. "mnt:[4026532459]".
+	mountsCache = make(map[string]cachedMounts)
+	// Time the expired entries of mountsCache were last removed.
+	mountsCachePrunedAt time.Time
+)
+
+// procMounts returns the mount table of the mount namespace of the process.
+// Parsing mountinfo for every container at every housekeeping is expensive on
+// nodes with many containers and mounts, so the table is cached by mount
+// namespace for mountsCacheDuration. The returned mounts must not be
+// modified.
+func procMounts(rootFs string, pid int) ([]*mountinfo.Info, error) {
+	procPath := path.Join(rootFs, "/proc", strconv.Itoa(pid))
+	ns, err := os.Readlink(path.Join(procPath, "ns", "mnt"))
+	if err != nil {
+		return nil, err
+	}
+
+	mountsCacheLock.Lock()
+	defer mountsCacheLock.Unlock()
+	now := time.Now()
+	if now.Sub(mountsCachePrunedAt) >= mountsCacheDuration {
+		for key, cached := range mountsCache {
+			if now.Sub(cached.readAt) >= mountsCacheDuration {
+				delete(mountsCache, key)
+			}
+		}
+		mountsCachePrunedAt = now
+	}
+	if cached, ok := mountsCache[ns]; ok && now.Sub(cached.readAt) < mountsCacheDuration {
+		return cached.mounts, nil
+	}
+
+	file, err := os.Open(path.Join(procPath, "mountinfo"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	mounts, err := mountinfo.GetMountsFromReader(file, nil)
+	if err != nil {
+		return nil, err
+	}
+	mountsCache[ns] = cachedMounts{mounts: mounts, readAt: now}
+	return mounts, nil
+}
+
+// resetMountsCache empties the cache of the mount tables.
+func resetMountsCache() {
+	mountsCacheLock.Lock()
+	defer mountsCacheLock.Unlock()
+	mountsCache = make(map[string]cachedMounts)
+	mountsCachePrunedAt = time.Time{}
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcontainer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeProcMounts(t *testing.T, rootFs, pid, ns, mountinfo string) {
+	procPath := filepath.Join(rootFs, "proc", pid)
+	require.NoError(t, os.MkdirAll(filepath.Join(procPath, "ns"), 0755))
+	nsPath := filepath.Join(procPath, "ns", "mnt")
+	os.Remove(nsPath)
+	require.NoError(t, os.Symlink(ns, nsPath))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(procPath, "mountinfo"), []byte(mountinfo), 0644))
+}
+
+func TestProcMountsCachedByMountNamespace(t *testing.T) {
+	resetMountsCache()
+	defer resetMountsCache()
+	rootFs, err := ioutil.TempDir("", "mounts")
+	require.NoError(t, err)
+	defer os.RemoveAll(rootFs)
+
+	const root = "1 0 8:1 / / rw - ext4 /dev/sda1 rw\n"
+	const data = "2 1 8:16 / /data rw - ext4 /dev/sdb rw\n"
+	writeProcMounts(t, rootFs, "10", "mnt:[1]", root)
+	// Another process in the same mount namespace.
+	writeProcMounts(t, rootFs, "11", "mnt:[1]", root+data)
+	writeProcMounts(t, rootFs, "20", "mnt:[2]", root+data)
+
+	mounts, err := procMounts(rootFs, 10)
+	require.NoError(t, err)
+	assert.Len(t, mounts, 1)
+	mounts, err = procMounts(rootFs, 11)
+	require.NoError(t, err)
+	assert.Len(t, mounts, 1, "expected the mounts of the namespace to be cached")
+	mounts, err = procMounts(rootFs, 20)
+	require.NoError(t, err)
+	assert.Len(t, mounts, 2)
+
+	// The mounts are read again once the cached ones expire.
+	defer func(d time.Duration) { mountsCacheDuration = d }(mountsCacheDuration)
+	mountsCacheDuration = 0
+	mounts, err = procMounts(rootFs, 11)
+	require.NoError(t, err)
+	assert.Len(t, mounts, 2)
+
+	_, err = procMounts(rootFs, 30)
+	assert.Error(t, err)
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcontainer
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// Maximum number of files of /proc/<pid>/ which can be configured with
+// --proc_metrics, each of them being read for every container at every
+// housekeeping.
+const maxProcMetrics = 16
+
+var procMetricsFlag = flag.String("proc_metrics", "", fmt.Sprintf("Comma separated list of name=path pairs of files relative to /proc/<pid>/ holding a single number, e.g. oom_score=oom_score, not under its symlinks such as root or fd, read for the init process of each container and reported as its proc metrics under the given names. At most %d files can be configured.", maxProcMetrics))
+
+var (
+	procMetricsOnce sync.Once
+	procMetrics     []procMetric
+
+	procMetricNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	procMetricPathRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]+(/[a-zA-Z0-9_.-]+)*$`)
+
+	// procSymlinks are the entries of /proc/<pid>/ and /proc/<pid>/task/<tid>/
+	// which are symlinks, or directories of symlinks, out of /proc, e.g. into
+	// the filesystem of the container.
+	procSymlinks = map[string]struct{}{
+		"cwd":       {},
+		"exe":       {},
+		"fd":        {},
+		"map_files": {},
+		"ns":        {},
+		"root":      {},
+	}
+)
+
+// procMetric is a file of /proc/<pid>/ holding a single number.
+type procMetric struct {
+	name string
+	// Path relative to /proc/<pid>/.
+	path string
+}
+
+// getProcMetrics returns the files configured with --proc_metrics.
+func getProcMetrics() []procMetric {
+	procMetricsOnce.Do(func() {
+		var err error
+		procMetrics, err = parseProcMetrics(*procMetricsFlag)
+		if err != nil {
+			// Only reached when ValidateFlags wasn't called.
+			klog.Errorf("Invalid --proc_metrics %q, not reading proc metrics: %v", *procMetricsFlag, err)
+		}
+	})
+	return procMetrics
+}
+
+// parseProcMetrics parses a comma separated list of name=path pairs. Paths
+// must stay within /proc/<pid>/ and not follow its symlinks.
+func parseProcMetrics(value string) ([]procMetric, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var metrics []procMetric
+	names := map[string]struct{}{}
+	for _, pair := range strings.Split(value, ",") {
+		fields := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%q is not a name=path pair", pair)
+		}
+		metric := procMetric{name: fields[0], path: fields[1]}
+		if !procMetricNameRegexp.MatchString(metric.name) {
+			return nil, fmt.Errorf("invalid name %q", metric.name)
+		}
+		if _, ok := names[metric.name]; ok {
+			return nil, fmt.Errorf("duplicate name %q", metric.name)
+		}
+		names[metric.name] = struct{}{}
+		if !procMetricPathRegexp.MatchString(metric.path) || path.Clean(metric.path) != metric.path || strings.HasPrefix(metric.path, "..") {
+			return nil, fmt.Errorf("invalid path %q, paths must be relative to /proc/<pid>/", metric.path)
+		}
+		for _, element := range strings.Split(metric.path, "/") {
+			if element == "." || element == ".." {
+				return nil, fmt.Errorf("invalid path %q, paths must be relative to /proc/<pid>/", metric.path)
+			}
+			if _, ok := procSymlinks[element]; ok {
+				return nil, fmt.Errorf("invalid path %q, paths must not follow the %s symlink of /proc/<pid>/", metric.path, element)
+			}
+		}
+		metrics = append(metrics, metric)
+	}
+	if len(metrics) > maxProcMetrics {
+		return nil, fmt.Errorf("%d files configured, at most %d are allowed", len(metrics), maxProcMetrics)
+	}
+	return metrics, nil
+}
+
+// procMetricsFromProc reads the given files of the process, skipping the
+// missing and unparsable ones.
+func procMetricsFromProc(rootFs string, pid int, metrics []procMetric) map[string]float64 {
+	if len(metrics) == 0 {
+		return nil
+	}
+	values := make(map[string]float64, len(metrics))
+	for _, metric := range metrics {
+		filePath := path.Join(rootFs, "proc", strconv.Itoa(pid), metric.path)
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			klog.V(4).Infof("Unable to read proc metric %q from %q: %v", metric.name, filePath, err)
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(string(content)), 64)
+		if err != nil {
+			klog.V(4).Infof("Unable to parse proc metric %q from %q: %v", metric.name, filePath, err)
+			continue
+		}
+		values[metric.name] = value
+	}
+	return values
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcontainer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcMetrics(t *testing.T) {
+	metrics, err := parseProcMetrics("oom_score=oom_score, timerslack=timerslack_ns,io_syscr=io/syscr")
+	assert.NoError(t, err)
+	assert.Equal(t, []procMetric{
+		{name: "oom_score", path: "oom_score"},
+		{name: "timerslack", path: "timerslack_ns"},
+		{name: "io_syscr", path: "io/syscr"},
+	}, metrics)
+
+	metrics, err = parseProcMetrics("")
+	assert.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	tooMany := make([]string, maxProcMetrics+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("metric%d=oom_score", i)
+	}
+	for _, value := range []string{
+		"oom_score",
+		"oom-score=oom_score",
+		"oom_score=oom_score,oom_score=oom_adj",
+		"root=/etc/shadow",
+		"escape=../1/environ",
+		"escape=task/../../1/environ",
+		"dot=./oom_score",
+		"root=root/etc/shadow",
+		"cwd=cwd/secret",
+		"fd=fd/3",
+		"exe=exe",
+		"task_root=task/1234/root/etc/shadow",
+		"trailing=oom_score/",
+		strings.Join(tooMany, ","),
+	} {
+		_, err := parseProcMetrics(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestProcMetricsFromProc(t *testing.T) {
+	rootFs, err := ioutil.TempDir("", "proc_metrics")
+	require.NoError(t, err)
+	defer os.RemoveAll(rootFs)
+	procPath := filepath.Join(rootFs, "proc", "1234")
+	require.NoError(t, os.MkdirAll(procPath, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(procPath, "oom_score"), []byte("666\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(procPath, "timerslack_ns"), []byte("50000\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(procPath, "comm"), []byte("nginx\n"), 0644))
+
+	metrics, err := parseProcMetrics("oom_score=oom_score,timerslack=timerslack_ns,comm=comm,missing=autogroup")
+	require.NoError(t, err)
+	// The files which are missing or do not hold a number are skipped.
+	assert.Equal(t, map[string]float64{"oom_score": 666, "timerslack": 50000}, procMetricsFromProc(rootFs, 1234, metrics))
+	assert.Nil(t, procMetricsFromProc(rootFs, 1234, nil))
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcontainer
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	info "github.com/google/cadvisor/info/v1"
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+// statfs returns the statistics of the filesystem a path is on.
+// This is defined as a variable to help in testing.
+var statfs = unix.Statfs
+
+// tmpfsStatsFromProc returns the usage of the tmpfs filesystems mounted in the
+// mount namespace of the process, e.g. memory-backed emptyDir volumes, secrets
+// or /dev/shm. A filesystem mounted at several mount points is reported once.
+// The tmpfs mounted by the runtime to mask paths under /proc and /sys are
+// skipped.
+func tmpfsStatsFromProc(rootFs string, pid int) ([]info.FsStats, error) {
+	mounts, err := procMounts(rootFs, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	procPath := path.Join(rootFs, "/proc", strconv.Itoa(pid))
+	var stats []info.FsStats
+	seen := make(map[DiskKey]bool)
+	for _, mount := range mounts {
+		if mount.FSType != "tmpfs" || isMaskedPath(mount.Mountpoint) {
+			continue
+		}
+		key := DiskKey{Major: uint64(mount.Major), Minor: uint64(mount.Minor)}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		var buf unix.Statfs_t
+		// The mount point is resolved through the root of the process, as it
+		// is not visible in the mount namespace of cAdvisor.
+		if err := statfs(path.Join(procPath, "root", mount.Mountpoint), &buf); err != nil {
+			// The container may have unmounted it or exited meanwhile.
+			klog.V(5).Infof("Unable to statfs tmpfs %q of pid %d: %v", mount.Mountpoint, pid, err)
+			continue
+		}
+		bsize := uint64(buf.Bsize)
+		stats = append(stats, info.FsStats{
+			Device:     mount.Source,
+			Type:       "tmpfs",
+			MountType:  "tmpfs",
+			Mountpoint: mount.Mountpoint,
+			Limit:      buf.Blocks * bsize,
+			Usage:      (buf.Blocks - buf.Bfree) * bsize,
+			Available:  buf.Bavail * bsize,
+			HasInodes:  true,
+			Inodes:     buf.Files,
+			InodesFree: buf.Ffree,
+		})
+	}
+	return stats, nil
+}
+
+// isMaskedPath returns whether the mount point is under /proc or /sys, where
+// the runtime mounts tmpfs to mask paths from the container.
+func isMaskedPath(mountpoint string) bool {
+	for _, dir := range []string{"/proc", "/sys"} {
+		if mountpoint == dir || strings.HasPrefix(mountpoint, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
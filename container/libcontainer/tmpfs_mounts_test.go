@@ -0,0 +1,88 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcontainer
+
+import (
+	"fmt"
+	"testing"
+
+	info "github.com/google/cadvisor/info/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestTmpfsStatsFromProc(t *testing.T) {
+	defer func(f func(string, *unix.Statfs_t) error) { statfs = f }(statfs)
+	var statted []string
+	statfs = func(path string, buf *unix.Statfs_t) error {
+		statted = append(statted, path)
+		switch path {
+		case "testdata/procfs/proc/1234/root/dev/shm":
+			*buf = unix.Statfs_t{Bsize: 4096, Blocks: 16384, Bfree: 16128, Bavail: 16128, Files: 1024, Ffree: 1020}
+		case "testdata/procfs/proc/1234/root/var/run/secrets/kubernetes.io/serviceaccount":
+			*buf = unix.Statfs_t{Bsize: 4096, Blocks: 256, Bfree: 253, Bavail: 253, Files: 512, Ffree: 503}
+		default:
+			return fmt.Errorf("unexpected path %q", path)
+		}
+		return nil
+	}
+
+	stats, err := tmpfsStatsFromProc("testdata/procfs", 1234)
+	require.NoError(t, err)
+	// The tmpfs masking /proc/kcore is skipped and the secret mounted twice
+	// is reported once.
+	assert.Equal(t, []info.FsStats{
+		{
+			Device:     "shm",
+			Type:       "tmpfs",
+			MountType:  "tmpfs",
+			Mountpoint: "/dev/shm",
+			Limit:      64 << 20,
+			Usage:      1 << 20,
+			Available:  63 << 20,
+			HasInodes:  true,
+			Inodes:     1024,
+			InodesFree: 1020,
+		},
+		{
+			Device:     "tmpfs",
+			Type:       "tmpfs",
+			MountType:  "tmpfs",
+			Mountpoint: "/var/run/secrets/kubernetes.io/serviceaccount",
+			Limit:      1 << 20,
+			Usage:      12 << 10,
+			Available:  1012 << 10,
+			HasInodes:  true,
+			Inodes:     512,
+			InodesFree: 503,
+		},
+	}, stats)
+	assert.Len(t, statted, 2)
+}
+
+func TestIsMaskedPath(t *testing.T) {
+	for mountpoint, expected := range map[string]bool{
+		"/proc":              true,
+		"/proc/kcore":        true,
+		"/sys/firmware":      true,
+		"/dev/shm":           false,
+		"/processes":         false,
+		"/var/lib/proc/data": false,
+	} {
+		assert.Equal(t, expected, isMaskedPath(mountpoint), mountpoint)
+	}
+}
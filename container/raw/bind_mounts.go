@@ -0,0 +1,90 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raw
+
+import (
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// bindMountKey identifies a host directory by its device and inode, so that the
+// same directory is recognized whatever the path it is mounted from.
+type bindMountKey struct {
+	dev uint64
+	ino uint64
+}
+
+// major and minor return the device numbers of the filesystem of the directory.
+func (k bindMountKey) major() uint { return uint(unix.Major(k.dev)) }
+func (k bindMountKey) minor() uint { return uint(unix.Minor(k.dev)) }
+
+// statHostDir returns the key of a host directory.
+// This is defined as a variable to help in testing.
+var statHostDir = func(dir string) (bindMountKey, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(dir, &st); err != nil {
+		return bindMountKey{}, err
+	}
+	return bindMountKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}, nil
+}
+
+// bindMountTracker tracks the containers bind-mounting each host directory,
+// so that the usage of a directory mounted by several containers is not
+// attributed to each of them.
+type bindMountTracker struct {
+	lock sync.Mutex
+	// Names of the containers by host directory they mount.
+	containers map[bindMountKey]map[string]struct{}
+}
+
+func newBindMountTracker() *bindMountTracker {
+	return &bindMountTracker{containers: map[bindMountKey]map[string]struct{}{}}
+}
+
+// Tracker of the host directories mounted by raw containers.
+var bindMounts = newBindMountTracker()
+
+// add records that the container mounts the host directories with the given keys.
+func (t *bindMountTracker) add(containerName string, keys []bindMountKey) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, key := range keys {
+		if t.containers[key] == nil {
+			t.containers[key] = map[string]struct{}{}
+		}
+		t.containers[key][containerName] = struct{}{}
+	}
+}
+
+// remove forgets the host directories mounted by the container.
+func (t *bindMountTracker) remove(containerName string, keys []bindMountKey) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, key := range keys {
+		delete(t.containers[key], containerName)
+		if len(t.containers[key]) == 0 {
+			delete(t.containers, key)
+		}
+	}
+}
+
+// isShared returns whether the host directory is mounted by several containers.
+func (t *bindMountTracker) isShared(key bindMountKey) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.containers[key]) > 1
+}
@@ -16,6 +16,7 @@
 package raw
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/google/cadvisor/container"
@@ -37,11 +38,17 @@ type rawContainerHandler struct {
 	// (e.g.: "cpu" -> "/sys/fs/cgroup/cpu/test")
 	cgroupPaths map[string]string
 
-	fsInfo          fs.FsInfo
-	externalMounts  []common.Mount
-	includedMetrics container.MetricSet
+	fsInfo         fs.FsInfo
+	externalMounts []common.Mount
+	// Keys of the host directories of the external mounts.
+	externalMountKeys []bindMountKey
+	includedMetrics   container.MetricSet
 
 	libcontainerHandler *libcontainer.Handler
+
+	// Stages of the stats reads, given up on past the deadline of
+	// GetStatsContext.
+	statsStages common.StatsStages
 }
 
 func isRootCgroup(name string) bool {
@@ -77,6 +84,8 @@ func newRawContainerHandler(name string, cgroupSubsystems *libcontainer.CgroupSu
 		delete(cgroupPaths, "pids")
 	}
 
+	externalMountKeys := trackExternalMounts(name, externalMounts)
+
 	handler := libcontainer.NewHandler(cgroupManager, rootFs, pid, includedMetrics)
 
 	return &rawContainerHandler{
@@ -85,11 +94,28 @@ func newRawContainerHandler(name string, cgroupSubsystems *libcontainer.CgroupSu
 		cgroupPaths:         cgroupPaths,
 		fsInfo:              fsInfo,
 		externalMounts:      externalMounts,
+		externalMountKeys:   externalMountKeys,
 		includedMetrics:     includedMetrics,
 		libcontainerHandler: handler,
 	}, nil
 }
 
+// trackExternalMounts records the host directories mounted by the container
+// and returns their keys.
+func trackExternalMounts(name string, externalMounts []common.Mount) []bindMountKey {
+	var keys []bindMountKey
+	for _, mount := range externalMounts {
+		key, err := statHostDir(mount.HostDir)
+		if err != nil {
+			klog.V(4).Infof("Unable to stat host dir %q mounted by container %q: %v", mount.HostDir, name, err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	bindMounts.add(name, keys)
+	return keys
+}
+
 func (h *rawContainerHandler) ContainerReference() (info.ContainerReference, error) {
 	// We only know the container by its one name.
 	return info.ContainerReference{
@@ -113,12 +139,15 @@ func (h *rawContainerHandler) GetRootNetworkDevices() ([]info.NetInfo, error) {
 func (h *rawContainerHandler) Start() {}
 
 // Nothing to clean up.
-func (h *rawContainerHandler) Cleanup() {}
+func (h *rawContainerHandler) Cleanup() {
+	bindMounts.remove(h.name, h.externalMountKeys)
+}
 
 func (h *rawContainerHandler) GetSpec() (info.ContainerSpec, error) {
 	const hasNetwork = false
 	hasFilesystem := isRootCgroup(h.name) || len(h.externalMounts) > 0
-	spec, err := common.GetSpec(h.cgroupPaths, h.machineInfoFactory, hasNetwork, hasFilesystem)
+	spec, err := common.GetSpec(libcontainer.CurrentCgroupPaths(h.name, h.cgroupPaths), h.machineInfoFactory, hasNetwork, hasFilesystem)
+	spec.BindingLimits = common.GetBindingLimits(h.cgroupPaths, h.name)
 	if err != nil {
 		return spec, err
 	}
@@ -164,6 +193,7 @@ func fsToFsStats(fs *fs.Fs) info.FsStats {
 	return info.FsStats{
 		Device:          fs.Device,
 		Type:            fs.Type.String(),
+		MountType:       fs.MountType,
 		Limit:           fs.Capacity,
 		Usage:           fs.Capacity - fs.Free,
 		HasInodes:       hasInodes,
@@ -214,7 +244,9 @@ func (h *rawContainerHandler) getFsStats(stats *info.ContainerStats) error {
 	if h.includedMetrics.Has(container.DiskUsageMetrics) {
 		for i := range filesystems {
 			fs := filesystems[i]
-			stats.Filesystem = append(stats.Filesystem, fsToFsStats(&fs))
+			fsStats := fsToFsStats(&fs)
+			fsStats.Shared = h.isSharedFs(&fs)
+			stats.Filesystem = append(stats.Filesystem, fsStats)
 		}
 	}
 
@@ -225,22 +257,26 @@ func (h *rawContainerHandler) getFsStats(stats *info.ContainerStats) error {
 	return nil
 }
 
+// isSharedFs returns whether the filesystem holds a host directory mounted by
+// other containers, in which case its usage is not attributable to this one.
+func (h *rawContainerHandler) isSharedFs(fs *fs.Fs) bool {
+	for _, key := range h.externalMountKeys {
+		if key.major() == fs.Major && key.minor() == fs.Minor && bindMounts.isShared(key) {
+			return true
+		}
+	}
+	return false
+}
+
 func (h *rawContainerHandler) GetStats() (*info.ContainerStats, error) {
+	return h.GetStatsContext(context.Background())
+}
+
+func (h *rawContainerHandler) GetStatsContext(ctx context.Context) (*info.ContainerStats, error) {
 	if *disableRootCgroupStats && isRootCgroup(h.name) {
 		return nil, nil
 	}
-	stats, err := h.libcontainerHandler.GetStats()
-	if err != nil {
-		return stats, err
-	}
-
-	// Get filesystem stats.
-	err = h.getFsStats(stats)
-	if err != nil {
-		return stats, err
-	}
-
-	return stats, nil
+	return h.statsStages.Read(ctx, h.libcontainerHandler.GetStats, h.getFsStats)
 }
 
 func (h *rawContainerHandler) GetCgroupPath(resource string) (string, error) {
@@ -16,10 +16,13 @@
 package raw
 
 import (
+	"io/ioutil"
+	"os"
 	"reflect"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/google/cadvisor/container"
 	"github.com/google/cadvisor/container/common"
@@ -602,3 +605,59 @@ func (m machineInfo) GetMachineInfo() (*info.MachineInfo, error) {
 func (m machineInfo) GetVersionInfo() (*info.VersionInfo, error) {
 	panic("unsupported")
 }
+
+func TestGetFsStatsSharedBindMount(t *testing.T) {
+	shared, err := ioutil.TempDir("", "shared")
+	require.NoError(t, err)
+	defer os.RemoveAll(shared)
+	private, err := ioutil.TempDir("", "private")
+	require.NoError(t, err)
+	defer os.RemoveAll(private)
+
+	key, err := statHostDir(shared)
+	require.NoError(t, err)
+	getFsInfoForPath := func(mountSet map[string]struct{}) ([]fs.Fs, error) {
+		return []fs.Fs{{
+			DeviceInfo: fs.DeviceInfo{Device: "/dev/sda1", Major: key.major(), Minor: key.minor()},
+			Capacity:   1000,
+			Free:       500,
+		}}, nil
+	}
+	newHandler := func(name string, mounts ...common.Mount) *rawContainerHandler {
+		return &rawContainerHandler{
+			name:               name,
+			includedMetrics:    container.MetricSet{container.DiskUsageMetrics: struct{}{}},
+			fsInfo:             fsInfo{nil, getFsInfoForPath},
+			externalMounts:     mounts,
+			externalMountKeys:  trackExternalMounts(name, mounts),
+			machineInfoFactory: machineInfo{},
+		}
+	}
+
+	first := newHandler("/first", common.Mount{HostDir: shared, ContainerDir: "/data"})
+	defer first.Cleanup()
+	// The same host directory, through a different path.
+	second := newHandler("/second", common.Mount{HostDir: shared + "/.", ContainerDir: "/data"})
+	third := newHandler("/third", common.Mount{HostDir: private, ContainerDir: "/data"})
+	defer third.Cleanup()
+
+	for _, tc := range []struct {
+		handler  *rawContainerHandler
+		expected bool
+	}{
+		{first, true},
+		{second, true},
+		{third, false},
+	} {
+		stats := &info.ContainerStats{}
+		assert.NoError(t, tc.handler.getFsStats(stats))
+		require.Len(t, stats.Filesystem, 1)
+		assert.Equal(t, tc.expected, stats.Filesystem[0].Shared, tc.handler.name)
+	}
+
+	// Once the second container is gone, the directory is no longer shared.
+	second.Cleanup()
+	stats := &info.ContainerStats{}
+	assert.NoError(t, first.getFsStats(stats))
+	assert.False(t, stats.Filesystem[0].Shared)
+}
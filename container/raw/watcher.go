@@ -17,11 +17,15 @@
 package raw
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/google/cadvisor/container/common"
 	"github.com/google/cadvisor/container/libcontainer"
@@ -31,15 +35,20 @@ import (
 	"k8s.io/klog/v2"
 )
 
+var cgroupPollInterval = flag.Duration("raw_cgroup_poll_interval", 10*time.Second, "Interval between scans of the cgroup hierarchies for created and deleted cgroups, when inotify is unavailable or its watches are exhausted")
+
 type rawContainerWatcher struct {
 	// Absolute path to the root of the cgroup hierarchies
 	cgroupPaths map[string]string
 
 	cgroupSubsystems *libcontainer.CgroupSubsystems
 
-	// Inotify event watcher.
+	// Inotify event watcher, nil when polling the cgroup hierarchies.
 	watcher *common.InotifyWatcher
 
+	// Containers found by the last poll of the cgroup hierarchies.
+	polled map[string]struct{}
+
 	// Signal for watcher thread to stop.
 	stopWatcher chan error
 }
@@ -55,7 +64,9 @@ func NewRawContainerWatcher() (watcher.ContainerWatcher, error) {
 
 	watcher, err := common.NewInotifyWatcher()
 	if err != nil {
-		return nil, err
+		// Typically the limit of inotify instances is reached.
+		klog.Warningf("Inotify is unavailable, polling the cgroup hierarchies every %v instead: %v", *cgroupPollInterval, err)
+		watcher = nil
 	}
 
 	rawWatcher := &rawContainerWatcher{
@@ -69,10 +80,20 @@ func NewRawContainerWatcher() (watcher.ContainerWatcher, error) {
 }
 
 func (w *rawContainerWatcher) Start(events chan watcher.ContainerEvent) error {
+	if w.watcher == nil {
+		go w.poll(events)
+		return nil
+	}
+
 	// Watch this container (all its cgroups) and all subdirectories.
 	watched := make([]string, 0)
 	for _, cgroupPath := range w.cgroupPaths {
 		_, err := w.watchDirectory(events, cgroupPath, "/")
+		if isWatchesExhausted(err) {
+			w.fallBackToPolling(err)
+			go w.poll(events)
+			return nil
+		}
 		if err != nil {
 			for _, watchedCgroupPath := range watched {
 				_, removeErr := w.watcher.RemoveWatch("/", watchedCgroupPath)
@@ -91,6 +112,11 @@ func (w *rawContainerWatcher) Start(events chan watcher.ContainerEvent) error {
 			select {
 			case event := <-w.watcher.Event():
 				err := w.processEvent(event, events)
+				if isWatchesExhausted(err) {
+					w.fallBackToPolling(err)
+					w.poll(events)
+					return
+				}
 				if err != nil {
 					klog.Warningf("Error while processing event (%+v): %v", event, err)
 				}
@@ -109,6 +135,104 @@ func (w *rawContainerWatcher) Start(events chan watcher.ContainerEvent) error {
 	return nil
 }
 
+// isWatchesExhausted returns whether the error is due to the limit of inotify
+// watches of the user being reached.
+func isWatchesExhausted(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
+
+// fallBackToPolling stops watching the cgroup hierarchies with inotify. The
+// containers watched so far are already known, so that polling only reports the
+// containers created or deleted since.
+func (w *rawContainerWatcher) fallBackToPolling(err error) {
+	klog.Warningf("Inotify watches are exhausted, polling the cgroup hierarchies every %v instead: %v", *cgroupPollInterval, err)
+	w.polled = make(map[string]struct{})
+	for name := range w.watcher.GetWatches() {
+		if name != "/" {
+			w.polled[name] = struct{}{}
+		}
+	}
+	if err := w.watcher.Close(); err != nil {
+		klog.Warningf("Failed to close inotify watcher: %v", err)
+	}
+	w.watcher = nil
+}
+
+// poll scans the cgroup hierarchies for created and deleted containers until
+// the watcher is stopped.
+func (w *rawContainerWatcher) poll(events chan watcher.ContainerEvent) {
+	ticker := time.NewTicker(*cgroupPollInterval)
+	defer ticker.Stop()
+	for {
+		w.pollOnce(events)
+		select {
+		case <-ticker.C:
+		case <-w.stopWatcher:
+			w.stopWatcher <- nil
+			return
+		}
+	}
+}
+
+// pollOnce delivers events for the containers created and deleted since the
+// previous poll.
+func (w *rawContainerWatcher) pollOnce(events chan watcher.ContainerEvent) {
+	containers := make(map[string]struct{})
+	for _, cgroupPath := range w.cgroupPaths {
+		if err := listContainers(cgroupPath, "/", containers); err != nil {
+			klog.Warningf("Failed to list containers of %q: %v", cgroupPath, err)
+			// Don't report the containers of the hierarchy as deleted.
+			return
+		}
+	}
+
+	for name := range containers {
+		if _, ok := w.polled[name]; !ok {
+			events <- watcher.ContainerEvent{
+				EventType:   watcher.ContainerAdd,
+				Name:        name,
+				WatchSource: watcher.Raw,
+			}
+		}
+	}
+	for name := range w.polled {
+		if _, ok := containers[name]; !ok {
+			events <- watcher.ContainerEvent{
+				EventType:   watcher.ContainerDelete,
+				Name:        name,
+				WatchSource: watcher.Raw,
+			}
+		}
+	}
+	w.polled = containers
+}
+
+// listContainers adds the names of the containers below the given cgroup
+// directory of the named container to containers.
+func listContainers(dir string, containerName string, containers map[string]struct{}) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		subcontainerName := path.Join(containerName, entry.Name())
+		// .mount cgroups never have containers as sub-cgroups, like in watchDirectory.
+		if strings.HasSuffix(subcontainerName, ".mount") {
+			continue
+		}
+		containers[subcontainerName] = struct{}{}
+		// The directory may have been removed since it was listed.
+		err := listContainers(path.Join(dir, entry.Name()), subcontainerName, containers)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
 func (w *rawContainerWatcher) Stop() error {
 	// Rendezvous with the watcher thread.
 	w.stopWatcher <- nil
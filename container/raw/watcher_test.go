@@ -0,0 +1,156 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raw
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	inotify "k8s.io/utils/inotify"
+
+	"github.com/google/cadvisor/container/common"
+	"github.com/google/cadvisor/container/libcontainer"
+	"github.com/google/cadvisor/watcher"
+)
+
+func newTestRawContainerWatcher(t *testing.T, root string) *rawContainerWatcher {
+	inotifyWatcher, err := common.NewInotifyWatcher()
+	require.NoError(t, err)
+	return &rawContainerWatcher{
+		cgroupPaths: map[string]string{"cpu": root},
+		cgroupSubsystems: &libcontainer.CgroupSubsystems{
+			Mounts:      []cgroups.Mount{{Mountpoint: root, Subsystems: []string{"cpu"}}},
+			MountPoints: map[string]string{"cpu": root},
+		},
+		watcher:     inotifyWatcher,
+		stopWatcher: make(chan error),
+	}
+}
+
+// receiveEvents returns the events delivered so far, sorted by name.
+func receiveEvents(events chan watcher.ContainerEvent) []watcher.ContainerEvent {
+	var received []watcher.ContainerEvent
+	for {
+		select {
+		case event := <-events:
+			received = append(received, event)
+		default:
+			sort.Slice(received, func(i, j int) bool {
+				return received[i].Name < received[j].Name
+			})
+			return received
+		}
+	}
+}
+
+func TestProcessEvent(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	w := newTestRawContainerWatcher(t, root)
+	defer w.watcher.Close()
+	events := make(chan watcher.ContainerEvent, 10)
+
+	// A created cgroup is watched and reported once.
+	dir := filepath.Join(root, "foo")
+	require.NoError(t, os.Mkdir(dir, 0755))
+	created := &inotify.Event{Name: dir, Mask: inotify.InCreate | inotify.InIsdir}
+	require.NoError(t, w.processEvent(created, events))
+	require.NoError(t, w.processEvent(created, events))
+	assert.Equal(t, []watcher.ContainerEvent{
+		{EventType: watcher.ContainerAdd, Name: "/foo", WatchSource: watcher.Raw},
+	}, receiveEvents(events))
+	assert.Contains(t, w.watcher.GetWatches(), "/foo")
+
+	// A deleted cgroup is no longer watched and reported once.
+	deleted := &inotify.Event{Name: dir, Mask: inotify.InDelete | inotify.InIsdir}
+	require.NoError(t, w.processEvent(deleted, events))
+	require.NoError(t, w.processEvent(deleted, events))
+	assert.Equal(t, []watcher.ContainerEvent{
+		{EventType: watcher.ContainerDelete, Name: "/foo", WatchSource: watcher.Raw},
+	}, receiveEvents(events))
+	assert.NotContains(t, w.watcher.GetWatches(), "/foo")
+	require.NoError(t, os.Remove(dir))
+}
+
+func TestPollOnce(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	w := newTestRawContainerWatcher(t, root)
+	w.watcher.Close()
+	w.watcher = nil
+	events := make(chan watcher.ContainerEvent, 10)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "system.slice", "docker.service"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "system.slice", "var-lib.mount"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "cgroup.procs"), nil, 0644))
+
+	// The first poll reports the existing containers, except .mount cgroups.
+	w.pollOnce(events)
+	assert.Equal(t, []watcher.ContainerEvent{
+		{EventType: watcher.ContainerAdd, Name: "/system.slice", WatchSource: watcher.Raw},
+		{EventType: watcher.ContainerAdd, Name: "/system.slice/docker.service", WatchSource: watcher.Raw},
+	}, receiveEvents(events))
+
+	// Unchanged containers are not reported again.
+	w.pollOnce(events)
+	assert.Empty(t, receiveEvents(events))
+
+	require.NoError(t, os.Mkdir(filepath.Join(root, "system.slice", "foo.service"), 0755))
+	require.NoError(t, os.Remove(filepath.Join(root, "system.slice", "docker.service")))
+	w.pollOnce(events)
+	assert.Equal(t, []watcher.ContainerEvent{
+		{EventType: watcher.ContainerDelete, Name: "/system.slice/docker.service", WatchSource: watcher.Raw},
+		{EventType: watcher.ContainerAdd, Name: "/system.slice/foo.service", WatchSource: watcher.Raw},
+	}, receiveEvents(events))
+}
+
+func TestFallBackToPolling(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	w := newTestRawContainerWatcher(t, root)
+	events := make(chan watcher.ContainerEvent, 10)
+
+	require.NoError(t, os.Mkdir(filepath.Join(root, "foo"), 0755))
+	_, err = w.watchDirectory(events, root, "/")
+	require.NoError(t, err)
+	// The event of the already existing foo cgroup is delivered asynchronously.
+	assert.Equal(t, watcher.ContainerEvent{EventType: watcher.ContainerAdd, Name: "/foo", WatchSource: watcher.Raw}, <-events)
+
+	assert.False(t, isWatchesExhausted(os.ErrNotExist))
+	assert.True(t, isWatchesExhausted(&os.PathError{Op: "inotify_add_watch", Path: root, Err: syscall.ENOSPC}))
+
+	// Containers watched with inotify are not reported again once polling.
+	w.fallBackToPolling(syscall.ENOSPC)
+	assert.Nil(t, w.watcher)
+	require.NoError(t, os.Mkdir(filepath.Join(root, "bar"), 0755))
+	w.pollOnce(events)
+	assert.Equal(t, []watcher.ContainerEvent{
+		{EventType: watcher.ContainerAdd, Name: "/bar", WatchSource: watcher.Raw},
+	}, receiveEvents(events))
+
+	// The watcher can be stopped once polling.
+	go w.poll(events)
+	assert.NoError(t, w.Stop())
+}
@@ -0,0 +1,159 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package subtree reads the stats of the cgroups of a subtree directly,
+// without the manager: there is no container runtime client, no housekeeping
+// of the other containers of the machine and no stats history. It is meant to
+// export the metrics of a single workload from a constrained sidecar.
+package subtree
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/google/cadvisor/container"
+	"github.com/google/cadvisor/container/common"
+	"github.com/google/cadvisor/container/libcontainer"
+	info "github.com/google/cadvisor/info/v1"
+	v2 "github.com/google/cadvisor/info/v2"
+	"github.com/google/cadvisor/machine"
+	"github.com/google/cadvisor/version"
+
+	"k8s.io/klog/v2"
+)
+
+// InfoProvider provides the info of the cgroups of a subtree to the
+// PrometheusCollector, reading their stats on each request.
+type InfoProvider struct {
+	// Cgroup at the root of the subtree, e.g. /kubepods/pod<uid>.
+	root             string
+	cgroupSubsystems libcontainer.CgroupSubsystems
+	includedMetrics  container.MetricSet
+	machineInfo      *info.MachineInfo
+}
+
+// NewInfoProvider returns an InfoProvider of the subtree of the given cgroup,
+// on the cgroup hierarchies mounted on the machine.
+func NewInfoProvider(root string, includedMetrics container.MetricSet) (*InfoProvider, error) {
+	cgroupSubsystems, err := libcontainer.GetCgroupSubsystems(includedMetrics)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cgroup subsystems: %v", err)
+	}
+	machineInfo := &info.MachineInfo{NumCores: runtime.NumCPU()}
+	machineInfo.MemoryCapacity, err = machine.GetMachineMemoryCapacity()
+	if err != nil {
+		klog.Warningf("Unable to get the memory capacity of the machine: %v", err)
+	}
+	return newInfoProvider(root, cgroupSubsystems, includedMetrics, machineInfo), nil
+}
+
+func newInfoProvider(root string, cgroupSubsystems libcontainer.CgroupSubsystems, includedMetrics container.MetricSet, machineInfo *info.MachineInfo) *InfoProvider {
+	return &InfoProvider{
+		root:             path.Clean("/" + root),
+		cgroupSubsystems: cgroupSubsystems,
+		includedMetrics:  includedMetrics,
+		machineInfo:      machineInfo,
+	}
+}
+
+// GetMachineInfo returns the number of cores and memory capacity of the
+// machine, which bound the limits of the cgroups.
+func (p *InfoProvider) GetMachineInfo() (*info.MachineInfo, error) {
+	return p.machineInfo, nil
+}
+
+// GetVersionInfo returns the versions of cAdvisor and of the kernel.
+func (p *InfoProvider) GetVersionInfo() (*info.VersionInfo, error) {
+	return &info.VersionInfo{
+		KernelVersion:    machine.KernelVersion(),
+		CadvisorVersion:  version.Info["version"],
+		CadvisorRevision: version.Info["revision"],
+	}, nil
+}
+
+// inSubtree returns whether the cgroup is the root of the subtree or one of
+// its descendants.
+func (p *InfoProvider) inSubtree(name string) bool {
+	return p.root == "/" || name == p.root || strings.HasPrefix(name, p.root+"/")
+}
+
+// GetRequestedContainersInfo returns the spec and current stats of the given
+// cgroup and, if requested, of its descendants. "/" stands for the root of
+// the subtree. Only names are supported as container ids.
+func (p *InfoProvider) GetRequestedContainersInfo(containerName string, options v2.RequestOptions) (map[string]*info.ContainerInfo, error) {
+	if options.IdType != "" && options.IdType != v2.TypeName {
+		return nil, fmt.Errorf("unsupported container id type %q", options.IdType)
+	}
+	name := path.Clean("/" + containerName)
+	if name == "/" {
+		name = p.root
+	}
+	if !p.inSubtree(name) {
+		return nil, fmt.Errorf("container %q is not in the subtree of %q", containerName, p.root)
+	}
+
+	names := []string{name}
+	if options.Recursive {
+		refs, err := common.ListContainers(name, common.MakeCgroupPaths(p.cgroupSubsystems.MountPoints, name), container.ListRecursive)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range refs {
+			names = append(names, ref.Name)
+		}
+		sort.Strings(names[1:])
+	}
+
+	containers := make(map[string]*info.ContainerInfo, len(names))
+	for _, name := range names {
+		cInfo, err := p.containerInfo(name)
+		if err != nil {
+			// The cgroup may have been removed since it was listed.
+			klog.V(4).Infof("Unable to get the info of cgroup %q: %v", name, err)
+			continue
+		}
+		containers[name] = cInfo
+	}
+	return containers, nil
+}
+
+// containerInfo reads the spec and stats of a cgroup.
+func (p *InfoProvider) containerInfo(name string) (*info.ContainerInfo, error) {
+	cgroupPaths := common.MakeCgroupPaths(p.cgroupSubsystems.MountPoints, name)
+	if !common.CgroupExists(cgroupPaths) {
+		return nil, fmt.Errorf("cgroup %q does not exist", name)
+	}
+	cgroupManager, err := libcontainer.NewCgroupManager(name, cgroupPaths)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := common.GetSpec(cgroupPaths, p, false, false)
+	if err != nil {
+		return nil, err
+	}
+	// Without the pid of the container, the process and network stats are
+	// not read.
+	stats, err := libcontainer.NewHandler(cgroupManager, "/", 0, p.includedMetrics).GetStats()
+	if err != nil {
+		return nil, err
+	}
+	return &info.ContainerInfo{
+		ContainerReference: info.ContainerReference{Name: name},
+		Spec:               spec,
+		Stats:              []*info.ContainerStats{stats},
+	}, nil
+}
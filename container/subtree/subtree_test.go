@@ -0,0 +1,143 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subtree
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/cadvisor/container"
+	"github.com/google/cadvisor/container/libcontainer"
+	info "github.com/google/cadvisor/info/v1"
+	v2 "github.com/google/cadvisor/info/v2"
+	"github.com/google/cadvisor/metrics"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/clock"
+)
+
+// writeCgroup creates a fake cgroup using 2s of cpu and the given memory,
+// holding the files of both cgroup v1 and v2 so that it is read whatever the
+// cgroup mode of the machine.
+func writeCgroup(t *testing.T, dir string, memoryUsage string) {
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	for file, content := range map[string]string{
+		// cgroup v1.
+		"cpuacct.usage":             "2000000000",
+		"cpuacct.usage_percpu":      "2000000000",
+		"cpuacct.stat":              "user 100\nsystem 100",
+		"memory.usage_in_bytes":     memoryUsage,
+		"memory.max_usage_in_bytes": memoryUsage,
+		"memory.limit_in_bytes":     "9223372036854771712",
+		"memory.failcnt":            "0",
+		"memory.use_hierarchy":      "1",
+		// cgroup v2.
+		"cpu.stat":       "usage_usec 2000000\nuser_usec 1000000\nsystem_usec 1000000",
+		"memory.current": memoryUsage,
+		"memory.max":     "max",
+		// Read as the cache and rss on v1, and as the file and anon memory on v2.
+		"memory.stat": "cache 0\nrss " + memoryUsage + "\nfile 0\nanon " + memoryUsage,
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, file), []byte(content+"\n"), 0644))
+	}
+}
+
+func newTestInfoProvider(t *testing.T) (*InfoProvider, func()) {
+	// Read the fake cgroup files outside of a cgroupfs.
+	cgroups.TestMode = true
+	mountPoint, err := ioutil.TempDir("", "subtree")
+	require.NoError(t, err)
+	writeCgroup(t, filepath.Join(mountPoint, "kubepods/pod1"), "4096")
+	writeCgroup(t, filepath.Join(mountPoint, "kubepods/pod1/app"), "3072")
+	writeCgroup(t, filepath.Join(mountPoint, "kubepods/pod1/app/worker"), "1024")
+	// Outside of the subtree.
+	writeCgroup(t, filepath.Join(mountPoint, "kubepods/pod2"), "8192")
+
+	// All the controllers share the same directory, as on cgroup v2.
+	cgroupSubsystems := libcontainer.CgroupSubsystems{MountPoints: map[string]string{
+		"cpu":     mountPoint,
+		"cpuacct": mountPoint,
+		"memory":  mountPoint,
+	}}
+	includedMetrics := container.MetricSet{container.CpuUsageMetrics: struct{}{}, container.MemoryUsageMetrics: struct{}{}}
+	p := newInfoProvider("/kubepods/pod1", cgroupSubsystems, includedMetrics, &info.MachineInfo{NumCores: 4, MemoryCapacity: 1 << 30})
+	return p, func() {
+		cgroups.TestMode = false
+		os.RemoveAll(mountPoint)
+	}
+}
+
+func TestGetRequestedContainersInfo(t *testing.T) {
+	p, cleanup := newTestInfoProvider(t)
+	defer cleanup()
+
+	containers, err := p.GetRequestedContainersInfo("/", v2.RequestOptions{IdType: v2.TypeName, Count: 1, Recursive: true})
+	require.NoError(t, err)
+	require.Len(t, containers, 3)
+	for name, memoryUsage := range map[string]uint64{
+		"/kubepods/pod1":            4096,
+		"/kubepods/pod1/app":        3072,
+		"/kubepods/pod1/app/worker": 1024,
+	} {
+		cInfo, ok := containers[name]
+		require.True(t, ok, name)
+		assert.Equal(t, name, cInfo.Name)
+		require.Len(t, cInfo.Stats, 1)
+		assert.Equal(t, memoryUsage, cInfo.Stats[0].Memory.Usage, name)
+		assert.EqualValues(t, 2000000000, cInfo.Stats[0].Cpu.Usage.Total, name)
+	}
+
+	containers, err = p.GetRequestedContainersInfo("/kubepods/pod1/app", v2.RequestOptions{IdType: v2.TypeName, Count: 1})
+	require.NoError(t, err)
+	assert.Len(t, containers, 1)
+
+	_, err = p.GetRequestedContainersInfo("/kubepods/pod2", v2.RequestOptions{IdType: v2.TypeName, Count: 1})
+	assert.Error(t, err)
+}
+
+func TestPrometheusCollector(t *testing.T) {
+	p, cleanup := newTestInfoProvider(t)
+	defer cleanup()
+
+	collector := metrics.NewPrometheusCollector(p, nil, p.includedMetrics, clock.RealClock{}, v2.RequestOptions{IdType: v2.TypeName, Count: 1, Recursive: true})
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	usage := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "container_memory_usage_bytes" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "id" {
+					usage[l.GetValue()] = m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	assert.Equal(t, map[string]float64{
+		"/kubepods/pod1":            4096,
+		"/kubepods/pod1/app":        3072,
+		"/kubepods/pod1/app/worker": 1024,
+	}, usage)
+}
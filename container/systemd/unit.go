@@ -0,0 +1,152 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	systemddbus "github.com/coreos/go-systemd/v22/dbus"
+	info "github.com/google/cadvisor/info/v1"
+
+	"k8s.io/klog/v2"
+)
+
+// Timeout of a single query of the state of the units.
+const unitStateTimeout = time.Second
+
+// Interval between refreshes of the cached states of the units.
+const unitStatesRefreshInterval = 10 * time.Second
+
+// dbusConnection is the subset of the systemd D-Bus API used to read the
+// state of units.
+type dbusConnection interface {
+	ListUnitsContext(ctx context.Context) ([]systemddbus.UnitStatus, error)
+	Close()
+}
+
+// newDbusConnection connects to systemd on the system bus.
+// This is defined as a variable to help in testing.
+var newDbusConnection = func() (dbusConnection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), unitStateTimeout)
+	defer cancel()
+	return systemddbus.NewSystemConnectionContext(ctx)
+}
+
+// UnitStateReader reads the state of the systemd units of containers created
+// with the systemd cgroup driver. The states of all the units are listed in a
+// single query, at most once per unitStatesRefreshInterval, rather than
+// querying systemd for each container.
+type UnitStateReader struct {
+	lock sync.Mutex
+	conn dbusConnection
+	// Whether connecting to systemd failed, in which case unit states are not
+	// reported.
+	unavailable bool
+	// States of the loaded units by name, and when they were listed.
+	states      map[string]info.SystemdUnit
+	refreshedAt time.Time
+}
+
+// NewUnitStateReader returns a reader which connects to systemd when the
+// first unit state is read.
+func NewUnitStateReader() *UnitStateReader {
+	return &UnitStateReader{}
+}
+
+// UnitName returns the name of the systemd unit of the container with the
+// given cgroup name, or an empty string if it is not managed by systemd.
+func UnitName(containerName string) string {
+	name := path.Base(containerName)
+	if strings.HasSuffix(name, ".scope") || strings.HasSuffix(name, ".service") {
+		return name
+	}
+	return ""
+}
+
+// UnitState returns the state of the systemd unit of the container with the
+// given cgroup name. It returns nil if the container is not managed by
+// systemd, its unit is not loaded, or the states can't be read from systemd.
+func (r *UnitStateReader) UnitState(containerName string) *info.SystemdUnit {
+	unit := UnitName(containerName)
+	if unit == "" {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.unavailable {
+		return nil
+	}
+	if time.Since(r.refreshedAt) >= unitStatesRefreshInterval {
+		r.refresh()
+	}
+	state, ok := r.states[unit]
+	if !ok {
+		return nil
+	}
+	return &state
+}
+
+// refresh lists the states of the units. r.lock must be held.
+func (r *UnitStateReader) refresh() {
+	// The states are not read again before the next interval, even on failure.
+	r.refreshedAt = time.Now()
+	r.states = nil
+	if r.conn == nil {
+		conn, err := newDbusConnection()
+		if err != nil {
+			klog.V(2).Infof("Systemd unit states will not be reported, failed to connect to systemd: %v", err)
+			r.unavailable = true
+			return
+		}
+		r.conn = conn
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), unitStateTimeout)
+	defer cancel()
+	units, err := r.conn.ListUnitsContext(ctx)
+	if err != nil {
+		klog.V(4).Infof("Failed to list systemd units: %v", err)
+		// The connection may have been lost, reconnect on the next refresh.
+		r.conn.Close()
+		r.conn = nil
+		return
+	}
+	r.states = make(map[string]info.SystemdUnit, len(units))
+	for _, unit := range units {
+		if UnitName(unit.Name) == "" {
+			continue
+		}
+		r.states[unit.Name] = info.SystemdUnit{
+			Name:        unit.Name,
+			ActiveState: unit.ActiveState,
+			SubState:    unit.SubState,
+		}
+	}
+}
+
+// Close closes the connection to systemd.
+func (r *UnitStateReader) Close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	systemddbus "github.com/coreos/go-systemd/v22/dbus"
+	info "github.com/google/cadvisor/info/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockDbusConnection struct {
+	mock.Mock
+}
+
+func (c *mockDbusConnection) ListUnitsContext(ctx context.Context) ([]systemddbus.UnitStatus, error) {
+	args := c.Called()
+	return args.Get(0).([]systemddbus.UnitStatus), args.Error(1)
+}
+
+func (c *mockDbusConnection) Close() {
+	c.Called()
+}
+
+// mockDbus replaces the connection to systemd and returns a function
+// restoring it.
+func mockDbus(conn dbusConnection, err error) func() {
+	original := newDbusConnection
+	newDbusConnection = func() (dbusConnection, error) {
+		return conn, err
+	}
+	return func() {
+		newDbusConnection = original
+	}
+}
+
+func TestUnitName(t *testing.T) {
+	assert.Equal(t, "docker-abc.scope", UnitName("/system.slice/docker-abc.scope"))
+	assert.Equal(t, "kubelet.service", UnitName("/system.slice/kubelet.service"))
+	assert.Equal(t, "", UnitName("/docker/abc"))
+	assert.Equal(t, "", UnitName("/kubepods.slice"))
+	assert.Equal(t, "", UnitName("/"))
+}
+
+func TestUnitState(t *testing.T) {
+	conn := &mockDbusConnection{}
+	conn.On("ListUnitsContext").Return([]systemddbus.UnitStatus{
+		{Name: "docker-abc.scope", ActiveState: "active", SubState: "running"},
+		{Name: "kubelet.service", ActiveState: "failed", SubState: "failed"},
+		{Name: "system.slice", ActiveState: "active", SubState: "active"},
+	}, nil)
+	defer mockDbus(conn, nil)()
+
+	reader := NewUnitStateReader()
+	assert.Equal(t, &info.SystemdUnit{
+		Name:        "docker-abc.scope",
+		ActiveState: "active",
+		SubState:    "running",
+	}, reader.UnitState("/system.slice/docker-abc.scope"))
+	assert.Equal(t, &info.SystemdUnit{
+		Name:        "kubelet.service",
+		ActiveState: "failed",
+		SubState:    "failed",
+	}, reader.UnitState("/system.slice/kubelet.service"))
+
+	// Containers not created by systemd have no unit, nor do units which are
+	// not loaded.
+	assert.Nil(t, reader.UnitState("/docker/abc"))
+	assert.Nil(t, reader.UnitState("/system.slice/docker-def.scope"))
+
+	// The states were listed once for all the containers.
+	conn.AssertNumberOfCalls(t, "ListUnitsContext", 1)
+
+	// They are listed again after the refresh interval.
+	reader.refreshedAt = reader.refreshedAt.Add(-unitStatesRefreshInterval)
+	assert.NotNil(t, reader.UnitState("/system.slice/docker-abc.scope"))
+	conn.AssertNumberOfCalls(t, "ListUnitsContext", 2)
+}
+
+func TestUnitStateReconnectsAfterFailure(t *testing.T) {
+	conn := &mockDbusConnection{}
+	conn.On("ListUnitsContext").Return([]systemddbus.UnitStatus(nil), fmt.Errorf("connection closed")).Once()
+	conn.On("ListUnitsContext").Return([]systemddbus.UnitStatus{
+		{Name: "kubelet.service", ActiveState: "failed", SubState: "failed"},
+	}, nil).Once()
+	conn.On("Close").Return()
+	defer mockDbus(conn, nil)()
+
+	reader := NewUnitStateReader()
+	assert.Nil(t, reader.UnitState("/system.slice/kubelet.service"))
+	assert.Nil(t, reader.conn)
+
+	// The failed listing isn't retried before the next refresh.
+	assert.Nil(t, reader.UnitState("/system.slice/kubelet.service"))
+	reader.refreshedAt = reader.refreshedAt.Add(-unitStatesRefreshInterval)
+	assert.Equal(t, &info.SystemdUnit{
+		Name:        "kubelet.service",
+		ActiveState: "failed",
+		SubState:    "failed",
+	}, reader.UnitState("/system.slice/kubelet.service"))
+	conn.AssertExpectations(t)
+}
+
+func TestUnitStateWithoutDbus(t *testing.T) {
+	defer mockDbus(nil, fmt.Errorf("no such file or directory"))()
+
+	reader := NewUnitStateReader()
+	assert.Nil(t, reader.UnitState("/system.slice/docker-abc.scope"))
+	assert.True(t, reader.unavailable)
+
+	// No further connection attempts are made.
+	reader.refreshedAt = reader.refreshedAt.Add(-unitStatesRefreshInterval)
+	newDbusConnection = func() (dbusConnection, error) {
+		t.Fatal("unexpected connection to systemd")
+		return nil, nil
+	}
+	assert.Nil(t, reader.UnitState("/system.slice/docker-abc.scope"))
+}
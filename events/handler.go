@@ -19,6 +19,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	info "github.com/google/cadvisor/info/v1"
@@ -39,6 +40,9 @@ func (e byTimestamp) Swap(i, j int) {
 }
 
 func (e byTimestamp) Less(i, j int) bool {
+	if e[i].Timestamp.Equal(e[j].Timestamp) {
+		return e[i].Sequence < e[j].Sequence
+	}
 	return e[i].Timestamp.Before(e[j].Timestamp)
 }
 
@@ -60,6 +64,14 @@ type Request struct {
 	// events falling after EndTime do not satisfy the request. EndTime
 	// must be left blank in calls to WatchEvents
 	EndTime time.Time
+	// only events occurring strictly after Since satisfy the request. Unlike
+	// StartTime it may be set in calls to WatchEvents, which allows consumers
+	// to catch up on the events they missed while disconnected
+	Since time.Time
+	// only events whose sequence number is greater than SinceSequence satisfy
+	// the request, when set. Unlike Since it identifies the last event a
+	// consumer received, even if other events share its timestamp
+	SinceSequence uint64
 	// EventType is a map that specifies the type(s) of events wanted
 	EventType map[info.EventType]bool
 	// allows the caller to put a limit on how many
@@ -103,6 +115,10 @@ type events struct {
 	lastID int
 	// Event storage policy.
 	storagePolicy StoragePolicy
+	// persistence of events across restarts, nil if disabled.
+	persistence *eventPersistence
+	// sequence number of the last added event.
+	lastSequence uint64
 }
 
 // initialized by a call to WatchEvents(), a watch struct will then be added
@@ -136,6 +152,10 @@ type StoragePolicy struct {
 	// Per-event type limits.
 	PerTypeMaxAge       map[info.EventType]time.Duration
 	PerTypeMaxNumEvents map[info.EventType]int
+
+	// File in which events are persisted so that they survive restarts.
+	// Persistence is disabled if empty.
+	PersistencePath string
 }
 
 func DefaultStoragePolicy() StoragePolicy {
@@ -149,11 +169,20 @@ func DefaultStoragePolicy() StoragePolicy {
 
 // returns a pointer to an initialized Events object.
 func NewEventManager(storagePolicy StoragePolicy) EventManager {
-	return &events{
+	e := &events{
 		eventStore:    make(map[info.EventType]*utils.TimedStore),
 		watchers:      make(map[int]*watch),
 		storagePolicy: storagePolicy,
 	}
+	if storagePolicy.PersistencePath != "" {
+		persistence, err := newEventPersistence(storagePolicy.PersistencePath, e)
+		if err != nil {
+			klog.Errorf("Unable to persist events in %q: %v", storagePolicy.PersistencePath, err)
+		} else {
+			e.persistence = persistence
+		}
+	}
+	return e
 }
 
 // returns a pointer to an initialized Request object
@@ -207,6 +236,12 @@ func checkIfEventSatisfiesRequest(request *Request, event *info.Event) bool {
 	startTime := request.StartTime
 	endTime := request.EndTime
 	eventTime := event.Timestamp
+	if !request.Since.IsZero() && !eventTime.After(request.Since) {
+		return false
+	}
+	if request.SinceSequence > 0 && event.Sequence <= request.SinceSequence {
+		return false
+	}
 	if !startTime.IsZero() {
 		if startTime.After(eventTime) {
 			return false
@@ -280,6 +315,10 @@ func (e *events) WatchEvents(request *Request) (*EventChannel, error) {
 func (e *events) updateEventStore(event *info.Event) {
 	e.eventsLock.Lock()
 	defer e.eventsLock.Unlock()
+	e.updateEventStoreLocked(event)
+}
+
+func (e *events) updateEventStoreLocked(event *info.Event) {
 	if _, ok := e.eventStore[event.EventType]; !ok {
 		maxNumEvents := e.storagePolicy.DefaultMaxNumEvents
 		if numEvents, ok := e.storagePolicy.PerTypeMaxNumEvents[event.EventType]; ok {
@@ -290,16 +329,19 @@ func (e *events) updateEventStore(event *info.Event) {
 			return
 		}
 
-		maxAge := e.storagePolicy.DefaultMaxAge
-		if age, ok := e.storagePolicy.PerTypeMaxAge[event.EventType]; ok {
-			maxAge = age
-		}
-
-		e.eventStore[event.EventType] = utils.NewTimedStore(maxAge, maxNumEvents)
+		e.eventStore[event.EventType] = utils.NewTimedStore(e.maxAge(event.EventType), maxNumEvents)
 	}
 	e.eventStore[event.EventType].Add(event.Timestamp, event)
 }
 
+// returns the max duration for which events of eventType are stored
+func (e *events) maxAge(eventType info.EventType) time.Duration {
+	if age, ok := e.storagePolicy.PerTypeMaxAge[eventType]; ok {
+		return age
+	}
+	return e.storagePolicy.DefaultMaxAge
+}
+
 func (e *events) findValidWatchers(event *info.Event) []*watch {
 	watchesToSend := make([]*watch, 0)
 	for _, watcher := range e.watchers {
@@ -313,9 +355,22 @@ func (e *events) findValidWatchers(event *info.Event) []*watch {
 
 // method of Events object that adds the argument Event object to the
 // eventStore. It also feeds the event to a set of watch channels
-// held by the manager if it satisfies the request keys of the channels
+// held by the manager if it satisfies the request keys of the channels.
+// The event is assigned the next sequence number.
 func (e *events) AddEvent(event *info.Event) error {
-	e.updateEventStore(event)
+	func() {
+		// The event is stored and persisted at once, so that a compaction of
+		// the persistence file can't miss it nor persist it twice.
+		e.eventsLock.Lock()
+		defer e.eventsLock.Unlock()
+		event.Sequence = atomic.AddUint64(&e.lastSequence, 1)
+		e.updateEventStoreLocked(event)
+		if e.persistence != nil {
+			if err := e.persistence.add(event); err != nil {
+				klog.Warningf("Unable to persist event %v: %v", event, err)
+			}
+		}
+	}()
 	e.watcherLock.RLock()
 	defer e.watcherLock.RUnlock()
 	watchesToSend := e.findValidWatchers(event)
@@ -21,6 +21,7 @@ import (
 	info "github.com/google/cadvisor/info/v1"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func createOldTime(t *testing.T) time.Time {
@@ -196,3 +197,41 @@ func TestGetEventsForNoTypeRequested(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, receivedEvents, 0)
 }
+
+func TestGetEventsSince(t *testing.T) {
+	myEventHolder, myRequest, _, _ := initializeScenario(t)
+	myRequest.MaxEventsReturned = -1
+	myRequest.EventType[info.EventOom] = true
+
+	now := time.Now()
+	for i := 3; i > 0; i-- {
+		err := myEventHolder.AddEvent(makeEvent(now.Add(-time.Duration(i)*time.Minute), "/"))
+		assert.NoError(t, err)
+	}
+
+	// Events at exactly the since timestamp were already seen by the consumer.
+	myRequest.Since = now.Add(-2 * time.Minute)
+	receivedEvents, err := myEventHolder.GetEvents(myRequest)
+	assert.NoError(t, err)
+	assert.Len(t, receivedEvents, 1)
+	assert.Equal(t, now.Add(-time.Minute), receivedEvents[0].Timestamp)
+}
+
+func TestGetEventsSinceSequence(t *testing.T) {
+	manager := NewEventManager(DefaultStoragePolicy())
+	now := time.Now()
+	for _, name := range []string{"/a", "/b", "/c"} {
+		// The events share a timestamp, their sequence number tells them apart.
+		require.NoError(t, manager.AddEvent(makeEvent(now, name)))
+	}
+	request := NewRequest()
+	request.EventType[info.EventOom] = true
+	request.SinceSequence = 1
+	events, err := manager.GetEvents(request)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "/b", events[0].ContainerName)
+	assert.EqualValues(t, 2, events[0].Sequence)
+	assert.Equal(t, "/c", events[1].ContainerName)
+	assert.EqualValues(t, 3, events[1].Sequence)
+}
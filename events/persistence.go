@@ -0,0 +1,187 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+
+	"k8s.io/klog/v2"
+)
+
+// minCompactionSize is the minimum number of bytes appended to the
+// persistence file before it is rewritten with only the retained events.
+const minCompactionSize = 1 << 20
+
+// eventPersistence appends events to a file and restores them on startup. The
+// file is compacted to the events retained by the event store once it doubled
+// in size, or once events may have expired, so it is bounded by the same age
+// and count limits. Its methods are called with the eventsLock of the events
+// held, so that the events are stored and persisted at once.
+type eventPersistence struct {
+	path string
+	// file the events are appended to.
+	file *os.File
+	// size of the file, and its size after the last compaction.
+	size          int64
+	compactedSize int64
+	// time of the last compaction, and the shortest max age of the events.
+	compactedAt time.Time
+	minMaxAge   time.Duration
+	events      *events
+}
+
+func newEventPersistence(path string, e *events) (*eventPersistence, error) {
+	minMaxAge := e.storagePolicy.DefaultMaxAge
+	for _, age := range e.storagePolicy.PerTypeMaxAge {
+		if age < minMaxAge {
+			minMaxAge = age
+		}
+	}
+	p := &eventPersistence{
+		path:      path,
+		minMaxAge: minMaxAge,
+		events:    e,
+	}
+	e.eventsLock.Lock()
+	defer e.eventsLock.Unlock()
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	if err := p.compact(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// load restores the persisted events which are still within their max age.
+func (p *eventPersistence) load() error {
+	f, err := os.Open(p.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		event := &info.Event{}
+		if err := json.Unmarshal(scanner.Bytes(), event); err != nil {
+			klog.Warningf("Skipping malformed event in %q: %v", p.path, err)
+			continue
+		}
+		// The sequence numbers continue after the restored events.
+		if event.Sequence > p.events.lastSequence {
+			p.events.lastSequence = event.Sequence
+		}
+		if time.Since(event.Timestamp) > p.events.maxAge(event.EventType) {
+			continue
+		}
+		p.events.updateEventStoreLocked(event)
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the persistence file with the events currently retained by
+// the event store and reopens it for appending. The eventsLock is held from
+// reading the events until the new file replaces the old one, so that no event
+// added meanwhile is lost.
+func (p *eventPersistence) compact() error {
+	tmpPath := p.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, event := range p.events.storedEventsLocked() {
+		n, err := writeEvent(tmp, event)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		size += n
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, p.path); err != nil {
+		return err
+	}
+
+	if p.file != nil {
+		p.file.Close()
+	}
+	p.file, err = os.OpenFile(p.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	p.size = size
+	p.compactedSize = size
+	p.compactedAt = time.Now()
+	return nil
+}
+
+func (p *eventPersistence) add(event *info.Event) error {
+	n, err := writeEvent(p.file, event)
+	if err != nil {
+		return err
+	}
+	p.size += n
+	if p.size-p.compactedSize >= minCompactionSize && p.size >= 2*p.compactedSize {
+		return p.compact()
+	}
+	if p.minMaxAge > 0 && time.Since(p.compactedAt) >= p.minMaxAge {
+		return p.compact()
+	}
+	return nil
+}
+
+// writeEvent writes the JSON encoding of an event on its own line and returns
+// the number of bytes written.
+func writeEvent(f *os.File, event *info.Event) (int64, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+	n, err := f.Write(append(data, '\n'))
+	return int64(n), err
+}
+
+// storedEvents returns all events retained by the event store in chronological order.
+func (e *events) storedEvents() []*info.Event {
+	e.eventsLock.RLock()
+	defer e.eventsLock.RUnlock()
+	return e.storedEventsLocked()
+}
+
+func (e *events) storedEventsLocked() []*info.Event {
+	stored := []*info.Event{}
+	var empty time.Time
+	for _, store := range e.eventStore {
+		for _, item := range store.InTimeRange(empty, empty, -1) {
+			stored = append(stored, item.(*info.Event))
+		}
+	}
+	sort.Sort(byTimestamp(stored))
+	return stored
+}
@@ -0,0 +1,152 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsArePersistedAcrossRestarts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "events")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	policy := DefaultStoragePolicy()
+	policy.DefaultMaxAge = time.Hour
+	policy.PersistencePath = filepath.Join(dir, "events")
+
+	now := time.Now().Truncate(time.Second)
+	before := NewEventManager(policy)
+	for _, event := range []*info.Event{
+		makeEvent(now.Add(-2*time.Hour), "/expired"),
+		makeEvent(now.Add(-2*time.Minute), "/old"),
+		makeEvent(now.Add(-time.Minute), "/new"),
+	} {
+		require.NoError(t, before.AddEvent(event))
+	}
+
+	// Events past their max age are dropped and only events after since are returned.
+	after := NewEventManager(policy)
+	request := NewRequest()
+	request.EventType[info.EventOom] = true
+	request.Since = now.Add(-2 * time.Minute)
+	events, err := after.GetEvents(request)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "/new", events[0].ContainerName)
+	assert.True(t, now.Add(-time.Minute).Equal(events[0].Timestamp))
+
+	request.Since = time.Time{}
+	events, err = after.GetEvents(request)
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+}
+
+func TestEventPersistenceIsCompacted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "events")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	policy := DefaultStoragePolicy()
+	policy.DefaultMaxNumEvents = 10
+	policy.PersistencePath = filepath.Join(dir, "events")
+
+	manager := NewEventManager(policy)
+	now := time.Now()
+	for i := 0; i < 3*minCompactionSize/100; i++ {
+		require.NoError(t, manager.AddEvent(makeEvent(now.Add(time.Duration(i)*time.Millisecond), "/")))
+	}
+
+	// The file was rewritten with only the retained events each time it grew
+	// by the minimum compaction size.
+	fi, err := os.Stat(policy.PersistencePath)
+	require.NoError(t, err)
+	assert.True(t, fi.Size() < 2*minCompactionSize, "file size %d", fi.Size())
+
+	restored := NewEventManager(policy).(*events)
+	assert.Len(t, restored.storedEvents(), 10)
+	// The sequence numbers continue after the restored events.
+	assert.EqualValues(t, 3*minCompactionSize/100, restored.lastSequence)
+}
+
+func TestEventPersistenceIsCompactedOnAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "events")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	policy := DefaultStoragePolicy()
+	policy.DefaultMaxNumEvents = 1
+	policy.PerTypeMaxAge[info.EventOom] = 10 * time.Millisecond
+	policy.PersistencePath = filepath.Join(dir, "events")
+
+	manager := NewEventManager(policy)
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, manager.AddEvent(makeEvent(now.Add(time.Duration(i)*time.Millisecond), "/")))
+	}
+	content, err := ioutil.ReadFile(policy.PersistencePath)
+	require.NoError(t, err)
+	assert.Equal(t, 5, strings.Count(string(content), "\n"))
+
+	// Once events may have expired, the file is compacted at the next event.
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, manager.AddEvent(makeEvent(time.Now(), "/")))
+	content, err = ioutil.ReadFile(policy.PersistencePath)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(content), "\n"))
+}
+
+func TestEventPersistenceCompactionKeepsConcurrentEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "events")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	policy := DefaultStoragePolicy()
+	policy.DefaultMaxAge = time.Hour
+	policy.PersistencePath = filepath.Join(dir, "events")
+
+	manager := NewEventManager(policy).(*events)
+	// Compact at every event.
+	manager.persistence.minMaxAge = time.Nanosecond
+	now := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				assert.NoError(t, manager.AddEvent(makeEvent(now.Add(time.Duration(i*50+j)*time.Millisecond), "/")))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Each event is persisted exactly once.
+	content, err := ioutil.ReadFile(policy.PersistencePath)
+	require.NoError(t, err)
+	assert.Equal(t, 400, strings.Count(string(content), "\n"))
+	assert.Len(t, NewEventManager(policy).(*events).storedEvents(), 400)
+}
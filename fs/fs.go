@@ -426,6 +426,7 @@ func (i *RealFsInfo) GetFsInfoForPath(mountSet map[string]struct{}) ([]Fs, error
 				klog.V(4).Infof("Stat fs failed. Error: %v", err)
 			} else {
 				deviceSet[device] = struct{}{}
+				fs.MountType = partition.fsType
 				fs.DeviceInfo = DeviceInfo{
 					Device: device,
 					Major:  uint(partition.major),
@@ -16,9 +16,12 @@ package fs
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	mount "github.com/moby/sys/mountinfo"
@@ -592,3 +595,42 @@ func TestProcessMounts(t *testing.T) {
 		}
 	}
 }
+
+func TestGetFsInfoForPathMountType(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mount_type")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	mountpoints := map[string]string{}
+	for _, name := range []string{"ext4", "xfs", "overlay", "tmpfs", "nfs4"} {
+		mountpoints[name] = filepath.Join(dir, name)
+		require.NoError(t, os.Mkdir(mountpoints[name], 0755))
+	}
+	mountInfo := fmt.Sprintf(`22 1 8:1 / %s rw,relatime shared:1 - ext4 /dev/sda1 rw
+23 1 8:2 / %s rw,relatime shared:2 - xfs /dev/sdb1 rw,attr2,inode64
+24 1 0:45 / %s rw,relatime shared:3 - overlay overlay rw,lowerdir=/l,upperdir=/u,workdir=/w
+25 1 0:46 / %s rw,nosuid,nodev shared:4 - tmpfs tmpfs rw,size=65536k
+26 1 0:47 / %s rw,relatime shared:5 - nfs4 10.0.0.1:/export rw,vers=4.2
+27 1 0:48 / /proc rw,nosuid,nodev,noexec shared:6 - proc proc rw
+`, mountpoints["ext4"], mountpoints["xfs"], mountpoints["overlay"], mountpoints["tmpfs"], mountpoints["nfs4"])
+	mounts, err := mount.GetMountsFromReader(strings.NewReader(mountInfo), nil)
+	require.NoError(t, err)
+
+	fsInfo := &RealFsInfo{partitions: processMounts(mounts, nil)}
+	filesystems, err := fsInfo.GetFsInfoForPath(nil)
+	require.NoError(t, err)
+
+	actual := map[string]string{}
+	for _, fs := range filesystems {
+		assert.Equal(t, VFS, fs.Type, fs.Device)
+		actual[fs.Device] = fs.MountType
+	}
+	expected := map[string]string{
+		"/dev/sda1":          "ext4",
+		"/dev/sdb1":          "xfs",
+		"overlay_0-45":       "overlay",
+		mountpoints["tmpfs"]: "tmpfs",
+		"10.0.0.1:/export":   "nfs4",
+	}
+	assert.Equal(t, expected, actual)
+}
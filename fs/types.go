@@ -55,6 +55,7 @@ const (
 type Fs struct {
 	DeviceInfo
 	Type       FsType
+	MountType  string // Filesystem type from mountinfo, e.g. ext4, xfs or nfs4.
 	Capacity   uint64
 	Free       uint64
 	Available  uint64
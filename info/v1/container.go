@@ -25,6 +25,18 @@ type CpuSpec struct {
 	Mask     string `json:"mask,omitempty"`
 	Quota    uint64 `json:"quota,omitempty"`
 	Period   uint64 `json:"period,omitempty"`
+	// Cpu time, in microseconds, the unused quota of the previous periods can
+	// accumulate to and be spent beyond the quota of a period: cpu.max.burst
+	// on cgroup v2 or cpu.cfs_burst_us on cgroup v1.
+	Burst uint64 `json:"burst,omitempty"`
+	// Memory nodes the container is allowed to allocate from, e.g. 0-1.
+	MemoryNodes string `json:"memory_nodes,omitempty"`
+	// Utilization clamps of the tasks of the container, as read from
+	// cpu.uclamp.min and cpu.uclamp.max on cgroup v2, in percent of the
+	// capacity of a CPU. 100 means unclamped. Nil when util-clamp isn't
+	// supported by the kernel.
+	UclampMin *float64 `json:"uclamp_min,omitempty"`
+	UclampMax *float64 `json:"uclamp_max,omitempty"`
 }
 
 type MemorySpec struct {
@@ -39,20 +51,149 @@ type MemorySpec struct {
 	// The amount of swap space requested. Default is unlimited (-1).
 	// Units: bytes.
 	SwapLimit uint64 `json:"swap_limit,omitempty"`
+
+	// The amount of memory below which the container is protected from
+	// reclaim when there is memory pressure: memory.soft_limit_in_bytes on
+	// cgroup v1 (default unlimited (-1)) and memory.low on cgroup v2 (default 0).
+	// Units: bytes.
+	SoftLimit uint64 `json:"soft_limit,omitempty"`
+
+	// The amount of memory the container is guaranteed to keep, which is never
+	// reclaimed: memory.min on cgroup v2. Default is 0, no guarantee. Not
+	// available on cgroup v1.
+	// Units: bytes.
+	Min uint64 `json:"min,omitempty"`
+
+	// The lowest memory limit of the container and of its ancestor cgroups,
+	// i.e. the limit the kernel enforces. Default is unlimited (-1).
+	// Units: bytes.
+	EffectiveLimit uint64 `json:"effective_limit,omitempty"`
 }
 
 type ProcessSpec struct {
 	Limit uint64 `json:"limit,omitempty"`
 }
 
+type DiskIoSpec struct {
+	// Default io.weight of the container, in the range [1-10000]. Only available on cgroup v2.
+	Weight uint64 `json:"weight,omitempty"`
+
+	// Per-device io.weight overrides.
+	DeviceWeights []PerDeviceIoSpec `json:"device_weights,omitempty"`
+
+	// Per-device io.latency targets. Units: microseconds.
+	LatencyTargets []PerDeviceIoSpec `json:"latency_targets,omitempty"`
+
+	// Per-device throttle limits, from io.max on cgroup v2 or the
+	// blkio.throttle files on cgroup v1. Devices without limit are omitted.
+	// Units: bytes per second.
+	ReadBpsLimits  []PerDeviceIoSpec `json:"read_bps_limits,omitempty"`
+	WriteBpsLimits []PerDeviceIoSpec `json:"write_bps_limits,omitempty"`
+	// Units: operations per second.
+	ReadIopsLimits  []PerDeviceIoSpec `json:"read_iops_limits,omitempty"`
+	WriteIopsLimits []PerDeviceIoSpec `json:"write_iops_limits,omitempty"`
+}
+
+type PerDeviceIoSpec struct {
+	Major uint64 `json:"major"`
+	Minor uint64 `json:"minor"`
+	Value uint64 `json:"value"`
+}
+
+type SystemdUnit struct {
+	// Name of the unit, e.g. docker-<id>.scope.
+	Name string `json:"name"`
+
+	// High-level state of the unit: active, reloading, inactive, failed,
+	// activating or deactivating.
+	ActiveState string `json:"active_state"`
+
+	// Low-level state of the unit, which depends on the unit type.
+	SubState string `json:"sub_state"`
+}
+
+type RlimitSpec struct {
+	// Soft limit, enforced by the kernel.
+	Soft uint64 `json:"soft"`
+
+	// Hard limit, up to which the soft limit can be raised.
+	Hard uint64 `json:"hard"`
+}
+
+type CapabilitiesSpec struct {
+	// Capabilities the container's process can ever gain, e.g. CAP_NET_RAW.
+	Bounding []string `json:"bounding,omitempty"`
+
+	// Capabilities checked by the kernel for the container's process.
+	Effective []string `json:"effective,omitempty"`
+
+	// Capabilities the container's process may assume.
+	Permitted []string `json:"permitted,omitempty"`
+}
+
+type SeccompProfileSpec struct {
+	// Action taken on the syscalls no rule of the profile matches, e.g.
+	// SCMP_ACT_ERRNO, or "unconfined" if the container has no profile.
+	DefaultAction string `json:"default_action"`
+
+	// Number of distinct syscalls the rules of the profile explicitly allow.
+	AllowedSyscalls int `json:"allowed_syscalls"`
+}
+
+type SecuritySpec struct {
+	// Seccomp mode of the container's init process: "disabled", "strict" or
+	// "filter". Empty if unknown, e.g. the process status can't be read.
+	SeccompMode string `json:"seccomp_mode,omitempty"`
+
+	// AppArmor profile confining the container's init process, "unconfined" if none.
+	AppArmorProfile string `json:"apparmor_profile,omitempty"`
+
+	// AppArmor mode of the profile (e.g. "enforce" or "complain"), if any.
+	AppArmorMode string `json:"apparmor_mode,omitempty"`
+}
+
+type OomSpec struct {
+	// OOM score adjustment of the container's init process, from -1000 (never
+	// killed) to 1000, as read from /proc/<pid>/oom_score_adj.
+	ScoreAdj int `json:"score_adj"`
+
+	// Current OOM score of the container's init process, the higher the more
+	// likely it is to be killed first, as read from /proc/<pid>/oom_score.
+	Score int `json:"score"`
+}
+
+type SchedulingSpec struct {
+	// Nice value of the container's init process, from -20 (highest
+	// priority) to 19, as read from /proc/<pid>/stat.
+	Nice int `json:"nice"`
+
+	// Kernel scheduling priority of the container's init process, as read
+	// from /proc/<pid>/stat. It is 20 plus the nice value for processes of
+	// the normal scheduling policies.
+	Priority int `json:"priority"`
+
+	// Nice value configured in the runtime spec of the container, if any.
+	ConfiguredNice *int `json:"configured_nice,omitempty"`
+}
+
 type ContainerSpec struct {
 	// Time at which the container was created.
 	CreationTime time.Time `json:"creation_time,omitempty"`
 
+	// Time at which the init process of the container started. The difference
+	// with CreationTime is the time taken to set up the container.
+	StartTime time.Time `json:"start_time,omitempty"`
+
 	// Metadata labels associated with this container.
 	Labels map[string]string `json:"labels,omitempty"`
 	// Metadata envs associated with this container. Only whitelisted envs are added.
 	Envs map[string]string `json:"envs,omitempty"`
+	// Number of environment variables of the container, whether collected
+	// or not.
+	EnvCount int `json:"env_count,omitempty"`
+	// Whether each of the environment variable keys configured with
+	// --env_presence_keys is set in the container, without its value.
+	EnvPresence map[string]bool `json:"env_presence,omitempty"`
 
 	HasCpu bool    `json:"has_cpu"`
 	Cpu    CpuSpec `json:"cpu,omitempty"`
@@ -70,13 +211,79 @@ type ContainerSpec struct {
 	HasFilesystem bool `json:"has_filesystem"`
 
 	// HasDiskIo when true, indicates that DiskIo stats will be available.
-	HasDiskIo bool `json:"has_diskio"`
+	HasDiskIo bool       `json:"has_diskio"`
+	DiskIo    DiskIoSpec `json:"diskio,omitempty"`
 
 	HasCustomMetrics bool         `json:"has_custom_metrics"`
 	CustomMetrics    []MetricSpec `json:"custom_metrics,omitempty"`
 
+	// Security confinement of the container's init process.
+	Security SecuritySpec `json:"security,omitempty"`
+
+	// The systemd unit of the container, if it was created with the systemd
+	// cgroup driver.
+	SystemdUnit *SystemdUnit `json:"systemd_unit,omitempty"`
+
+	// Resource limits of the container's process as configured in its runtime
+	// spec, by type, e.g. RLIMIT_NOFILE.
+	Rlimits map[string]RlimitSpec `json:"rlimits,omitempty"`
+
+	// Linux capability sets of the container's process as configured in its
+	// runtime spec, if known.
+	Capabilities *CapabilitiesSpec `json:"capabilities,omitempty"`
+
+	// Summary of the seccomp profile of the container's process as configured
+	// in its runtime spec, if known.
+	SeccompProfile *SeccompProfileSpec `json:"seccomp_profile,omitempty"`
+
+	// Whether the root filesystem of the container is mounted read-only, as
+	// configured in its runtime spec.
+	RootfsReadonly bool `json:"rootfs_readonly,omitempty"`
+
+	// Mount propagation of the root filesystem of the container as configured
+	// in its runtime spec, e.g. rprivate or rslave, if set.
+	RootfsPropagation string `json:"rootfs_propagation,omitempty"`
+
+	// Inode numbers of the namespaces of the container's init process, by
+	// type, e.g. net. Containers sharing a namespace with the host have the
+	// same inode number as the host.
+	Namespaces map[string]uint64 `json:"namespaces,omitempty"`
+
+	// Ancestor cgroups whose limit is tighter than the container's own, and
+	// thus binds it, by resource: cpu, memory or pids.
+	BindingLimits map[string]string `json:"binding_limits,omitempty"`
+
+	// Controllers available in the cgroup of the container, as listed in its
+	// cgroup.controllers file. Only reported on cgroup v2, where the stats of
+	// the controllers missing here, e.g. memory, are not reported.
+	CgroupControllers []string `json:"cgroup_controllers,omitempty"`
+
+	// Controllers enabled for the children of the cgroup of the container, as
+	// listed in its cgroup.subtree_control file. Only reported on cgroup v2.
+	CgroupSubtreeControl []string `json:"cgroup_subtree_control,omitempty"`
+
+	// OOM killer priority of the container's init process, if it is running.
+	Oom *OomSpec `json:"oom,omitempty"`
+
+	// Scheduling priority of the container's init process, if it is running.
+	Scheduling *SchedulingSpec `json:"scheduling,omitempty"`
+
+	// Runtime running the container, e.g. io.containerd.runc.v2, if known.
+	Runtime string `json:"runtime,omitempty"`
+
+	// Sandboxed when true, indicates that the container runs in a sandbox,
+	// e.g. the VM of Kata Containers or the sentry of gVisor. Its stats are
+	// then those of the whole sandbox, as seen from the host, rather than
+	// those of the workload.
+	Sandboxed bool `json:"sandboxed,omitempty"`
+
 	// Image name used for this container.
 	Image string `json:"image,omitempty"`
+
+	// Time at which the image was created in the image store of the runtime,
+	// i.e. when it was last pulled, if known. A container started shortly after
+	// its image was pulled had to fetch its layers.
+	ImageCreationTime time.Time `json:"image_creation_time,omitempty"`
 }
 
 // Container reference contains enough information to uniquely identify a container
@@ -94,6 +301,15 @@ type ContainerReference struct {
 	// Namespace under which the aliases of a container are unique.
 	// An example of a namespace is "docker" for Docker containers.
 	Namespace string `json:"namespace,omitempty"`
+
+	// The id of the container's cgroup as seen by the kernel (e.g. by BPF programs),
+	// which is the inode number of its cgroup directory on cgroup v2. On cgroup v1
+	// it is only the inode of its memory (or cpu) cgroup directory.
+	CgroupId uint64 `json:"cgroup_id,omitempty"`
+
+	// Number of levels of the container's cgroup below the root cgroup, e.g.
+	// 2 for /system.slice/docker.service.
+	Depth int `json:"depth,omitempty"`
 }
 
 // Sorts by container name.
@@ -279,6 +495,21 @@ type LoadStats struct {
 	NrIoWait uint64 `json:"nr_io_wait"`
 }
 
+// Delays of the tasks of a container, from the kernel delay accounting.
+type DelayStats struct {
+	// Time spent waiting for the completion of block IO.
+	// Unit: nanoseconds.
+	BlkioDelay uint64 `json:"blkio_delay"`
+
+	// Time spent waiting for pages to be swapped in.
+	// Unit: nanoseconds.
+	SwapinDelay uint64 `json:"swapin_delay"`
+
+	// Time spent reclaiming memory.
+	// Unit: nanoseconds.
+	FreepagesDelay uint64 `json:"freepages_delay"`
+}
+
 // CPU usage time statistics.
 type CpuUsage struct {
 	// Total CPU usage.
@@ -289,11 +520,14 @@ type CpuUsage struct {
 	// Unit: nanoseconds.
 	PerCpu []uint64 `json:"per_cpu_usage,omitempty"`
 
-	// Time spent in user space.
+	// Time spent in user space, read from cpuacct.stat in USER_HZ with cgroup
+	// v1 and from cpu.stat in microseconds with cgroup v2. It includes the
+	// time of niced processes, which cgroups don't account separately.
 	// Unit: nanoseconds.
 	User uint64 `json:"user"`
 
-	// Time spent in kernel space.
+	// Time spent in kernel space, including servicing interrupts (irq and
+	// softirq), which cgroups don't account separately.
 	// Unit: nanoseconds.
 	System uint64 `json:"system"`
 }
@@ -309,6 +543,16 @@ type CpuCFS struct {
 	// Total time duration for which tasks in the cgroup have been throttled.
 	// Unit: nanoseconds.
 	ThrottledTime uint64 `json:"throttled_time"`
+
+	// Total number of periods in which tasks in the cgroup used their burst,
+	// i.e. more than the quota, and the cpu time they used beyond the quota.
+	// Unit: nanoseconds.
+	Bursts    uint64 `json:"bursts,omitempty"`
+	BurstTime uint64 `json:"burst_time,omitempty"`
+
+	// Fraction of the runnable time of the cgroup lost to throttling since the
+	// previous sample, i.e. throttled time / (throttled time + cpu usage).
+	ThrottledFraction float64 `json:"throttled_fraction,omitempty"`
 }
 
 // Cpu Aggregated scheduler statistics
@@ -328,6 +572,10 @@ type CpuStats struct {
 	Usage     CpuUsage     `json:"usage"`
 	CFS       CpuCFS       `json:"cfs"`
 	Schedstat CpuSchedstat `json:"schedstat"`
+	// Fraction of the cores allocated to the container used since the
+	// previous sample. The cores are those of its CFS quota, i.e. quota /
+	// period, or all the cores of the machine without quota.
+	LimitUtilization float64 `json:"limit_utilization,omitempty"`
 	// Smoothed average of number of runnable threads x 1000.
 	// We multiply by thousand to avoid using floats, but preserving precision.
 	// Load is smoothed over the last 10 seconds. Instantaneous value can be read
@@ -340,6 +588,10 @@ type PerDiskStats struct {
 	Major  uint64            `json:"major"`
 	Minor  uint64            `json:"minor"`
 	Stats  map[string]uint64 `json:"stats"`
+
+	// Mount points, in the mount namespace of the container, of the
+	// filesystems on the device or on its partitions.
+	Mounts []string `json:"mounts,omitempty"`
 }
 
 type DiskIoStats struct {
@@ -351,6 +603,26 @@ type DiskIoStats struct {
 	IoWaitTime     []PerDiskStats `json:"io_wait_time,omitempty"`
 	IoMerged       []PerDiskStats `json:"io_merged,omitempty"`
 	IoTime         []PerDiskStats `json:"io_time,omitempty"`
+	// Fraction of the throttle limits of the devices used since the previous
+	// collection. Only the devices with limits are reported.
+	ThrottleUtilization []PerDiskUtilization `json:"throttle_utilization,omitempty"`
+}
+
+// Keys of the utilization of the throttle limits of a device.
+const (
+	ReadBpsUtilization   = "read_bps"
+	WriteBpsUtilization  = "write_bps"
+	ReadIopsUtilization  = "read_iops"
+	WriteIopsUtilization = "write_iops"
+)
+
+type PerDiskUtilization struct {
+	Device string `json:"device"`
+	Major  uint64 `json:"major"`
+	Minor  uint64 `json:"minor"`
+	// Utilization of each limit set on the device, by the keys above. It is
+	// usually in the range [0-1].
+	Utilization map[string]float64 `json:"utilization"`
 }
 
 type HugetlbStats struct {
@@ -397,10 +669,165 @@ type MemoryStats struct {
 
 	ContainerData    MemoryStatsMemoryData `json:"container_data,omitempty"`
 	HierarchicalData MemoryStatsMemoryData `json:"hierarchical_data,omitempty"`
+
+	// Breakdown of the memory usage from memory.stat, only reported on cgroup v2.
+	CgroupV2 *MemoryStatsCgroupV2 `json:"cgroup_v2,omitempty"`
+
+	// Memory used by TCP socket buffers, only reported on cgroup v1 when the
+	// kernel accounts it. On cgroup v2 it is CgroupV2.Sock.
+	TCP *TCPMemoryStats `json:"tcp,omitempty"`
+
+	// Memory allocated by the kernel on behalf of the container, only
+	// reported when the kernel_memory metrics are enabled.
+	Kernel *KernelMemoryStats `json:"kernel,omitempty"`
+
+	// Pages swapped in and out by the container, nil when the kernel doesn't
+	// report them in memory.stat, e.g. on cgroup v1, or when swap accounting
+	// is off.
+	SwapActivity *SwapActivityStats `json:"swap_activity,omitempty"`
+}
+
+// SwapActivityStats counts the pages swapped in and out by a cgroup v2, as
+// read from its memory.stat file.
+type SwapActivityStats struct {
+	// Number of pages swapped into memory.
+	Pswpin uint64 `json:"pswpin"`
+	// Number of pages swapped out of memory.
+	Pswpout uint64 `json:"pswpout"`
+}
+
+// KernelMemoryStats is the kernel memory usage of a cgroup. It is zero when the
+// kernel doesn't account kernel memory, e.g. when booted with
+// cgroup.memory=nokmem.
+// Units: Bytes.
+type KernelMemoryStats struct {
+	// Current usage, read from memory.kmem.usage_in_bytes on cgroup v1 and
+	// from the kernel entry of memory.stat on cgroup v2.
+	Usage uint64 `json:"usage"`
+	// Maximum usage recorded, only reported on cgroup v1.
+	MaxUsage uint64 `json:"max_usage"`
+	// Memory used for in-kernel data structures, only reported on cgroup v2.
+	Slab uint64 `json:"slab"`
+	// Memory allocated to kernel stacks, only reported on cgroup v2.
+	KernelStack uint64 `json:"kernel_stack"`
+}
+
+// TCPMemoryStats is the TCP socket buffer memory of a cgroup v1, as read from
+// its memory.kmem.tcp.* files.
+// Units: Bytes.
+type TCPMemoryStats struct {
+	// Current usage.
+	Usage uint64 `json:"usage"`
+	// Maximum usage recorded.
+	MaxUsage uint64 `json:"max_usage"`
+	// Limit, which is the page aligned maximum int64 when unlimited.
+	Limit uint64 `json:"limit"`
+	// Number of times the usage hit the limit.
+	Failcnt uint64 `json:"failcnt"`
+}
+
+// MemoryStatsCgroupV2 is the breakdown of the memory usage of a cgroup v2
+// reported in its memory.stat file.
+// Units: Bytes.
+type MemoryStatsCgroupV2 struct {
+	// Anonymous memory, including transparent hugepages.
+	Anon uint64 `json:"anon"`
+	// Page cache memory, including tmpfs and shared memory.
+	File uint64 `json:"file"`
+	// Kernel memory: kernel stacks, page tables, per-cpu memory and slab.
+	Kernel uint64 `json:"kernel"`
+	// Memory allocated to kernel stacks.
+	KernelStack uint64 `json:"kernel_stack"`
+	// Memory allocated for page tables.
+	PageTables uint64 `json:"pagetables"`
+	// Memory used for in-kernel data structures.
+	Slab uint64 `json:"slab"`
+	// Part of slab that might be reclaimed, such as dentries and inodes.
+	SlabReclaimable uint64 `json:"slab_reclaimable"`
+	// Part of slab that cannot be reclaimed on memory pressure.
+	SlabUnreclaimable uint64 `json:"slab_unreclaimable"`
+	// Memory used in network transmission buffers.
+	Sock uint64 `json:"sock"`
+	// Cached filesystem data that is swap-backed, such as tmpfs and shm segments.
+	Shmem uint64 `json:"shmem"`
+	// Cached filesystem data that was modified but not yet written back to disk.
+	FileDirty uint64 `json:"file_dirty"`
+	// Cached filesystem data that was modified and is being written back to disk.
+	FileWriteback uint64 `json:"file_writeback"`
+
+	// Number of refaults of previously evicted pages, which indicate thrashing
+	// of the working set.
+	WorkingsetRefault uint64 `json:"workingset_refault"`
+	// Number of refaults of previously evicted anonymous pages. Only reported
+	// by Linux 5.9 and later.
+	WorkingsetRefaultAnon uint64 `json:"workingset_refault_anon,omitempty"`
+	// Number of refaults of previously evicted file pages. Only reported by
+	// Linux 5.9 and later.
+	WorkingsetRefaultFile uint64 `json:"workingset_refault_file,omitempty"`
+	// Number of refaulted pages that were immediately activated.
+	WorkingsetActivate uint64 `json:"workingset_activate"`
+	// Number of refaulted anonymous pages that were immediately activated. Only
+	// reported by Linux 5.9 and later.
+	WorkingsetActivateAnon uint64 `json:"workingset_activate_anon,omitempty"`
+	// Number of refaulted file pages that were immediately activated. Only
+	// reported by Linux 5.9 and later.
+	WorkingsetActivateFile uint64 `json:"workingset_activate_file,omitempty"`
+
+	// Number of times the usage went over memory.high and the processes were
+	// throttled and put under direct reclaim, from memory.events.
+	HighEvents uint64 `json:"high_events"`
+
+	// Usage of the compressed swap cache, nil when the kernel doesn't support
+	// zswap.
+	Zswap *ZswapStats `json:"zswap,omitempty"`
+
+	// Page reclaim and compaction activity, nil when the kernel reports none
+	// of its counters.
+	Reclaim *ReclaimStats `json:"reclaim,omitempty"`
+}
+
+// ReclaimStats counts the pages scanned and reclaimed from a cgroup v2 by
+// kswapd and by direct reclaim, and the allocations stalled on compaction, as
+// read from its memory.stat file. Each counter is nil when the kernel doesn't
+// report it: the kswapd and direct breakdown is reported by Linux 5.13 and
+// later.
+type ReclaimStats struct {
+	// Number of pages scanned by kswapd.
+	PgscanKswapd *uint64 `json:"pgscan_kswapd,omitempty"`
+	// Number of pages scanned by direct reclaim.
+	PgscanDirect *uint64 `json:"pgscan_direct,omitempty"`
+	// Number of pages reclaimed by kswapd.
+	PgstealKswapd *uint64 `json:"pgsteal_kswapd,omitempty"`
+	// Number of pages reclaimed by direct reclaim.
+	PgstealDirect *uint64 `json:"pgsteal_direct,omitempty"`
+	// Number of allocations which stalled to compact memory, a sign of
+	// fragmentation.
+	CompactStall *uint64 `json:"compact_stall,omitempty"`
+}
+
+// ZswapStats is the usage of the zswap compressed swap cache by a cgroup v2.
+type ZswapStats struct {
+	// Size of the compressed pages of the cgroup in zswap, from
+	// memory.zswap.current.
+	// Units: Bytes.
+	Usage uint64 `json:"usage"`
+	// Maximum size of the compressed pages of the cgroup in zswap, from
+	// memory.zswap.max. Default is unlimited (-1).
+	// Units: Bytes.
+	Limit uint64 `json:"limit"`
+	// Number of pages read back from zswap.
+	Zswpin uint64 `json:"zswpin"`
+	// Number of pages compressed into zswap.
+	Zswpout uint64 `json:"zswpout"`
+	// Number of pages written back from zswap to swap. Only reported by Linux
+	// 6.8 and later.
+	Zswpwb uint64 `json:"zswpwb,omitempty"`
 }
 
 type CPUSetStats struct {
 	MemoryMigrate uint64 `json:"memory_migrate"`
+	// CPUs the container may run on according to its cpuset, e.g. 0-3,8.
+	Cpus string `json:"cpus,omitempty"`
 }
 
 type MemoryNumaStats struct {
@@ -426,6 +853,14 @@ type InterfaceStats struct {
 	RxErrors uint64 `json:"rx_errors"`
 	// Cumulative count of packets dropped while receiving.
 	RxDropped uint64 `json:"rx_dropped"`
+	// Cumulative count of receive FIFO buffer errors.
+	RxFifo uint64 `json:"rx_fifo,omitempty"`
+	// Cumulative count of packet framing errors encountered while receiving.
+	RxFrame uint64 `json:"rx_frame,omitempty"`
+	// Cumulative count of compressed packets received.
+	RxCompressed uint64 `json:"rx_compressed,omitempty"`
+	// Cumulative count of multicast packets received.
+	RxMulticast uint64 `json:"rx_multicast,omitempty"`
 	// Cumulative count of bytes transmitted.
 	TxBytes uint64 `json:"tx_bytes"`
 	// Cumulative count of packets transmitted.
@@ -434,6 +869,14 @@ type InterfaceStats struct {
 	TxErrors uint64 `json:"tx_errors"`
 	// Cumulative count of packets dropped while transmitting.
 	TxDropped uint64 `json:"tx_dropped"`
+	// Cumulative count of transmit FIFO buffer errors.
+	TxFifo uint64 `json:"tx_fifo,omitempty"`
+	// Cumulative count of collisions detected while transmitting.
+	TxCollisions uint64 `json:"tx_collisions,omitempty"`
+	// Cumulative count of carrier losses detected while transmitting.
+	TxCarrier uint64 `json:"tx_carrier,omitempty"`
+	// Cumulative count of compressed packets transmitted.
+	TxCompressed uint64 `json:"tx_compressed,omitempty"`
 }
 
 type NetworkStats struct {
@@ -736,16 +1179,32 @@ type FsStats struct {
 	// Type of the filesytem.
 	Type string `json:"type"`
 
+	// Filesystem type of the mount backing the device as found in
+	// mountinfo, e.g. overlay, xfs, ext4, tmpfs or nfs4.
+	MountType string `json:"mount_type,omitempty"`
+
 	// Number of bytes that can be consumed by the container on this filesystem.
 	Limit uint64 `json:"capacity"`
 
 	// Number of bytes that is consumed by the container on this filesystem.
 	Usage uint64 `json:"usage"`
 
+	// Whether the filesystem holds a host directory bind-mounted by several
+	// containers, so that its usage is not attributable solely to this one.
+	Shared bool `json:"shared,omitempty"`
+
+	// Mount point of the filesystem in the container. Only set for the
+	// filesystems resolved from the mount namespace of the container.
+	Mountpoint string `json:"mountpoint,omitempty"`
+
 	// Base Usage that is consumed by the container's writable layer.
 	// This field is only applicable for docker container's as of now.
 	BaseUsage uint64 `json:"base_usage"`
 
+	// Number of bytes used by the log files of the container, when they are
+	// known to the container runtime.
+	LogUsage uint64 `json:"log_usage,omitempty"`
+
 	// Number of bytes available for non-root user.
 	Available uint64 `json:"available"`
 
@@ -831,9 +1290,23 @@ type AcceleratorStats struct {
 	// unit: bytes
 	MemoryUsed uint64 `json:"memory_used"`
 
+	// Accelerator memory allocated by the processes of the container. Unlike
+	// MemoryUsed, it excludes memory allocated by other containers sharing the
+	// accelerator or its MIG devices.
+	// unit: bytes
+	ProcessMemoryUsed uint64 `json:"process_memory_used,omitempty"`
+
 	// Percent of time over the past sample period during which
 	// the accelerator was actively processing.
 	DutyCycle uint64 `json:"duty_cycle"`
+
+	// Percent of time over the past sample period during which the video
+	// encoder of the accelerator was in use, e.g. NVENC.
+	EncoderUtilization uint64 `json:"encoder_utilization,omitempty"`
+
+	// Percent of time over the past sample period during which the video
+	// decoder of the accelerator was in use, e.g. NVDEC.
+	DecoderUtilization uint64 `json:"decoder_utilization,omitempty"`
 }
 
 // PerfStat represents value of a single monitored perf event.
@@ -922,8 +1395,43 @@ type ProcessStats struct {
 	// Maxium number of threads allowed in container
 	ThreadsMax uint64 `json:"threads_max,omitempty"`
 
+	// Number of times a fork or clone failed because the container reached
+	// its pids.max limit, as counted by the max entry of pids.events.
+	PidsLimitHits uint64 `json:"pids_limit_hits,omitempty"`
+
 	// Ulimits for the top-level container process
 	Ulimits []UlimitSpec `json:"ulimits,omitempty"`
+
+	// Time spent on the cpu by the processes of the container, including the
+	// ones which exited, in nanoseconds, i.e. Cpu.Schedstat.RunTime. Only
+	// reported with the sched metrics.
+	SchedRunTime uint64 `json:"sched_run_time,omitempty"`
+
+	// Time spent waiting on a runqueue by the processes of the container,
+	// including the ones which exited, in nanoseconds, i.e.
+	// Cpu.Schedstat.RunqueueTime. Only reported with the sched metrics.
+	SchedWaitTime uint64 `json:"sched_wait_time,omitempty"`
+
+	// Number of times the threads of the container gave up the cpu
+	// voluntarily, e.g. to wait for IO or a lock, as found in
+	// /proc/<pid>/task/<tid>/status. The threads which exited since cAdvisor
+	// started watching the container are still counted.
+	VoluntaryContextSwitches uint64 `json:"voluntary_context_switches,omitempty"`
+
+	// Number of times the threads of the container were preempted, e.g. at
+	// the end of their time slice. Many involuntary context switches signal
+	// contention for the cpu.
+	InvoluntaryContextSwitches uint64 `json:"involuntary_context_switches,omitempty"`
+
+	// Number of times the threads of the container were migrated to another
+	// cpu, as found in /proc/<pid>/task/<tid>/sched. Requires a kernel built
+	// with CONFIG_SCHED_DEBUG.
+	CpuMigrations uint64 `json:"cpu_migrations,omitempty"`
+
+	// Number of processes currently in the container by state, as found in
+	// /proc/<pid>/stat, e.g. R (running), D (uninterruptible sleep) or Z
+	// (zombie).
+	States map[string]uint64 `json:"states,omitempty"`
 }
 
 type ContainerStats struct {
@@ -937,9 +1445,19 @@ type ContainerStats struct {
 	// Filesystem statistics
 	Filesystem []FsStats `json:"filesystem,omitempty"`
 
+	// Statistics of the tmpfs filesystems mounted in the container, e.g.
+	// memory-backed emptyDir volumes or /dev/shm. The pages of their files are
+	// charged as shared memory to the cgroup that wrote them, not to a disk,
+	// so they are not part of Filesystem.
+	TmpfsFilesystems []FsStats `json:"tmpfs_filesystems,omitempty"`
+
 	// Task load stats
 	TaskStats LoadStats `json:"task_stats,omitempty"`
 
+	// Delays of the threads of the processes of the container, including the
+	// processes which exited, from the kernel delay accounting.
+	Delay *DelayStats `json:"delay,omitempty"`
+
 	// Metrics for Accelerators. Each Accelerator corresponds to one element in the array.
 	Accelerators []AcceleratorStats `json:"accelerators,omitempty"`
 
@@ -959,12 +1477,33 @@ type ContainerStats struct {
 	// Referenced memory
 	ReferencedMemory uint64 `json:"referenced_memory,omitempty"`
 
+	// Values of the files of /proc/<pid>/ of the container's init process
+	// configured with --proc_metrics, by name.
+	ProcMetrics map[string]float64 `json:"proc_metrics,omitempty"`
+
 	// Resource Control (resctrl) statistics
 	Resctrl ResctrlStats `json:"resctrl,omitempty"`
 
 	CpuSet CPUSetStats `json:"cpuset,omitempty"`
 
 	OOMEvents uint64 `json:"oom_events,omitempty"`
+
+	// Stale when true, indicates that the collection of the stats has been
+	// failing since FailingSince and that these are the last stats collected.
+	// They are only reported for --stale_stats_ttl after the collection
+	// starts failing.
+	Stale        bool       `json:"stale,omitempty"`
+	FailingSince *time.Time `json:"failing_since,omitempty"`
+
+	// WarmingUp when true, indicates that these are among the first stats of
+	// the container, collected within --warmup_samples, whose derived rates
+	// such as Cpu.LimitUtilization are not computed.
+	WarmingUp bool `json:"warming_up,omitempty"`
+
+	// Partial when true, indicates that the collection of these stats
+	// exceeded --container_collection_timeout, and that the stats of the
+	// subsystems not read in time, e.g. the filesystems, are missing.
+	Partial bool `json:"partial,omitempty"`
 }
 
 func timeEq(t1, t2 time.Time, tolerance time.Duration) bool {
@@ -1017,6 +1556,9 @@ func (a *ContainerStats) StatsEq(b *ContainerStats) bool {
 	if !reflect.DeepEqual(a.TaskStats, b.TaskStats) {
 		return false
 	}
+	if !reflect.DeepEqual(a.Delay, b.Delay) {
+		return false
+	}
 	if !reflect.DeepEqual(a.Accelerators, b.Accelerators) {
 		return false
 	}
@@ -1042,6 +1584,9 @@ type Event struct {
 	// the original event object and all of its extraneous data, ex. an
 	// OomInstance
 	EventData EventData `json:"event_data,omitempty"`
+	// Sequence number of the event, assigned in increasing order when it is
+	// added to the event manager. Unlike the timestamp it identifies the event.
+	Sequence uint64 `json:"sequence,omitempty"`
 }
 
 // EventType is an enumerated type which lists the categories under which
@@ -1053,12 +1598,20 @@ const (
 	EventOomKill           EventType = "oomKill"
 	EventContainerCreation EventType = "containerCreation"
 	EventContainerDeletion EventType = "containerDeletion"
+	EventCounterReset      EventType = "counterReset"
+	EventCpusetChange      EventType = "cpusetChange"
 )
 
 // Extra information about an event. Only one type will be set.
 type EventData struct {
 	// Information about an OOM kill event.
 	OomKill *OomKillEventData `json:"oom,omitempty"`
+
+	// Information about the reset of a cumulative counter of the container.
+	CounterReset *CounterResetEventData `json:"counter_reset,omitempty"`
+
+	// Information about a change of the CPUs of the container.
+	CpusetChange *CpusetChangeEventData `json:"cpuset_change,omitempty"`
 }
 
 // Information related to an OOM kill instance
@@ -1069,3 +1622,22 @@ type OomKillEventData struct {
 	// The name of the killed process
 	ProcessName string `json:"process_name"`
 }
+
+// Information related to the reset of a cumulative counter, e.g. when the
+// container restarted within the same cgroup.
+type CounterResetEventData struct {
+	// Name of the counter, e.g. cpu_usage_total or network_rx_bytes.
+	Counter string `json:"counter"`
+
+	// Value of the counter in the previous and current samples.
+	Previous uint64 `json:"previous"`
+	Current  uint64 `json:"current"`
+}
+
+// Information related to a change of the cpuset of a container, e.g. when
+// its CPUs were repinned.
+type CpusetChangeEventData struct {
+	// CPUs of the container in the previous and current samples, e.g. 0-3,8.
+	Previous string `json:"previous"`
+	Current  string `json:"current"`
+}
@@ -30,6 +30,9 @@ type FsInfo struct {
 	// Type of device.
 	Type string `json:"type"`
 
+	// Filesystem type of the mount backing the device, e.g. ext4 or xfs.
+	MountType string `json:"mount_type,omitempty"`
+
 	// Total number of inodes available on the filesystem.
 	Inodes uint64 `json:"inodes"`
 
@@ -234,6 +237,10 @@ type MachineInfo struct {
 
 	// ID of cloud instance (e.g. instance-1) given to it by the cloud provider.
 	InstanceID InstanceID `json:"instance_id"`
+
+	// Static metadata about the machine (e.g. rack, hardware SKU) read from
+	// the file given by --machine_metadata_file.
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 func (m *MachineInfo) Clone() *MachineInfo {
@@ -251,6 +258,13 @@ func (m *MachineInfo) Clone() *MachineInfo {
 			diskMap[k] = info
 		}
 	}
+	metadata := m.Metadata
+	if len(m.Metadata) > 0 {
+		metadata = make(map[string]string, len(m.Metadata))
+		for k, v := range m.Metadata {
+			metadata[k] = v
+		}
+	}
 	copy := MachineInfo{
 		CPUVendorID:      m.CPUVendorID,
 		Timestamp:        m.Timestamp,
@@ -272,6 +286,7 @@ func (m *MachineInfo) Clone() *MachineInfo {
 		CloudProvider:    m.CloudProvider,
 		InstanceType:     m.InstanceType,
 		InstanceID:       m.InstanceID,
+		Metadata:         metadata,
 	}
 	return &copy
 }
@@ -40,6 +40,12 @@ type CpuSpec struct {
 	Quota uint64 `json:"quota,omitempty"`
 	// Period is the CPU reference time in ns e.g the quota is compared against this.
 	Period uint64 `json:"period,omitempty"`
+	// Memory nodes the container is allowed to allocate from, e.g. 0-1.
+	MemoryNodes string `json:"memory_nodes,omitempty"`
+	// Utilization clamps of the tasks of the container, in percent of the
+	// capacity of a CPU. 100 means unclamped.
+	UclampMin *float64 `json:"uclamp_min,omitempty"`
+	UclampMax *float64 `json:"uclamp_max,omitempty"`
 }
 
 type MemorySpec struct {
@@ -54,6 +60,16 @@ type MemorySpec struct {
 	// The amount of swap space requested. Default is unlimited (-1).
 	// Units: bytes.
 	SwapLimit uint64 `json:"swap_limit,omitempty"`
+
+	// The amount of memory below which the container is protected from
+	// reclaim when there is memory pressure.
+	// Units: bytes.
+	SoftLimit uint64 `json:"soft_limit,omitempty"`
+
+	// The amount of memory the container is guaranteed to keep, which is never
+	// reclaimed. Default is 0, no guarantee.
+	// Units: bytes.
+	Min uint64 `json:"min,omitempty"`
 }
 
 type ContainerInfo struct {
@@ -68,6 +84,9 @@ type ContainerSpec struct {
 	// Time at which the container was created.
 	CreationTime time.Time `json:"creation_time,omitempty"`
 
+	// Time at which the init process of the container started.
+	StartTime time.Time `json:"start_time,omitempty"`
+
 	// Other names by which the container is known within a certain namespace.
 	// This is unique within that namespace.
 	Aliases []string `json:"aliases,omitempty"`
@@ -80,6 +99,11 @@ type ContainerSpec struct {
 	Labels map[string]string `json:"labels,omitempty"`
 	// Metadata envs associated with this container. Only whitelisted envs are added.
 	Envs map[string]string `json:"envs,omitempty"`
+	// Number of environment variables of the container.
+	EnvCount int `json:"env_count,omitempty"`
+	// Whether each of the configured environment variable keys is set in the
+	// container.
+	EnvPresence map[string]bool `json:"env_presence,omitempty"`
 
 	HasCpu bool    `json:"has_cpu"`
 	Cpu    CpuSpec `json:"cpu,omitempty"`
@@ -100,8 +124,19 @@ type ContainerSpec struct {
 	HasFilesystem bool `json:"has_filesystem"`
 	HasDiskIo     bool `json:"has_diskio"`
 
+	// Runtime running the container, e.g. io.containerd.runc.v2, if known.
+	Runtime string `json:"runtime,omitempty"`
+
+	// Whether the container runs in a sandbox, e.g. a VM, whose stats are
+	// reported instead of those of the workload.
+	Sandboxed bool `json:"sandboxed,omitempty"`
+
 	// Image name used for this container.
 	Image string `json:"image,omitempty"`
+
+	// Time at which the image was created in the image store of the runtime,
+	// i.e. when it was last pulled, if known.
+	ImageCreationTime time.Time `json:"image_creation_time,omitempty"`
 }
 
 type DeprecatedContainerStats struct {
@@ -183,6 +218,10 @@ type ContainerStats struct {
 	ReferencedMemory uint64 `json:"referenced_memory,omitempty"`
 	// Resource Control (resctrl) statistics
 	Resctrl v1.ResctrlStats `json:"resctrl,omitempty"`
+	// Stale when true, indicates that the collection of the stats has been
+	// failing since FailingSince and that these are the last stats collected.
+	Stale        bool       `json:"stale,omitempty"`
+	FailingSince *time.Time `json:"failing_since,omitempty"`
 }
 
 type Percentiles struct {
@@ -272,6 +311,72 @@ type RequestOptions struct {
 	// Update stats if they are older than MaxAge
 	// nil indicates no update, and 0 will always trigger an update.
 	MaxAge *time.Duration `json:"max_age"`
+	// Comma separated requirements on the labels of the containers to return,
+	// e.g. app=web,tier!=db,canary. Empty returns all the containers.
+	LabelSelector string `json:"label_selector,omitempty"`
+}
+
+// PodStats aggregates the latest stats of the containers of a Kubernetes pod,
+// including its pause container.
+type PodStats struct {
+	// UID of the pod.
+	PodUID string `json:"pod_uid"`
+	// Cgroup of the pod.
+	Name string `json:"name"`
+	// Containers whose stats are aggregated.
+	Containers []string `json:"containers"`
+	// Time of the most recent stats of the containers.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Cumulative CPU usage of the containers, in nanoseconds.
+	CpuUsageTotal  uint64 `json:"cpu_usage_total"`
+	CpuUsageUser   uint64 `json:"cpu_usage_user"`
+	CpuUsageSystem uint64 `json:"cpu_usage_system"`
+
+	// Memory usage of the containers, in bytes.
+	MemoryUsage      uint64 `json:"memory_usage"`
+	MemoryWorkingSet uint64 `json:"memory_working_set"`
+	MemoryRSS        uint64 `json:"memory_rss"`
+	MemoryCache      uint64 `json:"memory_cache"`
+
+	// Number of processes in the containers.
+	ProcessCount uint64 `json:"process_count"`
+
+	// Quality of service class of the pod, Guaranteed, Burstable or
+	// BestEffort, as found in the path of its cgroup.
+	QOSClass string `json:"qos_class,omitempty"`
+	// CPU request of the pod in millicores, estimated from the cpu shares of
+	// its cgroup. 0 without request.
+	CpuRequestMillicores uint64 `json:"cpu_request_millicores,omitempty"`
+	// CPU limit of the pod in millicores, from the CFS quota of its cgroup. 0
+	// without limit.
+	CpuLimitMillicores uint64 `json:"cpu_limit_millicores,omitempty"`
+}
+
+// EphemeralStats sums the latest stats of the containers of a namespace which
+// were deleted before running for --ephemeral_container_threshold.
+type EphemeralStats struct {
+	// Kubernetes namespace of the containers or, outside of Kubernetes, the
+	// namespace of their runtime, e.g. docker.
+	Namespace string `json:"namespace"`
+	// Number of containers summed.
+	Containers uint64 `json:"containers"`
+
+	// Cumulative CPU usage of the containers, in nanoseconds.
+	CpuUsageTotal  uint64 `json:"cpu_usage_total"`
+	CpuUsageUser   uint64 `json:"cpu_usage_user"`
+	CpuUsageSystem uint64 `json:"cpu_usage_system"`
+
+	// Cumulative network usage of the containers, in bytes.
+	NetworkRxBytes uint64 `json:"network_rx_bytes"`
+	NetworkTxBytes uint64 `json:"network_tx_bytes"`
+}
+
+// IsEphemeralContainer returns whether the container is younger than the
+// threshold. Only the containers of a runtime, i.e. having an image, can be
+// ephemeral. A threshold of 0 disables ephemeral containers.
+func IsEphemeralContainer(spec *v1.ContainerSpec, threshold time.Duration, now time.Time) bool {
+	return threshold > 0 && spec.Image != "" && now.Sub(spec.CreationTime) < threshold
 }
 
 type ProcessInfo struct {
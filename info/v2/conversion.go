@@ -103,6 +103,8 @@ func ContainerStatsFromV1(containerName string, spec *v1.ContainerSpec, stats []
 		stat := &ContainerStats{
 			Timestamp:        val.Timestamp,
 			ReferencedMemory: val.ReferencedMemory,
+			Stale:            val.Stale,
+			FailingSince:     val.FailingSince,
 		}
 		if spec.HasCpu {
 			stat.Cpu = &val.Cpu
@@ -228,8 +230,11 @@ func DeprecatedStatsFromV1(cont *v1.ContainerInfo) []DeprecatedContainerStats {
 	return stats
 }
 
+// InstCpuStats returns the cpu rates between last and cur. There are none
+// when either is warming up, i.e. the samples warming up are not used as
+// baseline.
 func InstCpuStats(last, cur *v1.ContainerStats) (*CpuInstStats, error) {
-	if last == nil {
+	if last == nil || last.WarmingUp || cur.WarmingUp {
 		return nil, nil
 	}
 	if !cur.Timestamp.After(last.Timestamp) {
@@ -283,28 +288,39 @@ func InstCpuStats(last, cur *v1.ContainerStats) (*CpuInstStats, error) {
 // Get V2 container spec from v1 container info.
 func ContainerSpecFromV1(specV1 *v1.ContainerSpec, aliases []string, namespace string) ContainerSpec {
 	specV2 := ContainerSpec{
-		CreationTime:     specV1.CreationTime,
-		HasCpu:           specV1.HasCpu,
-		HasMemory:        specV1.HasMemory,
-		HasHugetlb:       specV1.HasHugetlb,
-		HasFilesystem:    specV1.HasFilesystem,
-		HasNetwork:       specV1.HasNetwork,
-		HasProcesses:     specV1.HasProcesses,
-		HasDiskIo:        specV1.HasDiskIo,
-		HasCustomMetrics: specV1.HasCustomMetrics,
-		Image:            specV1.Image,
-		Labels:           specV1.Labels,
-		Envs:             specV1.Envs,
+		CreationTime:      specV1.CreationTime,
+		StartTime:         specV1.StartTime,
+		HasCpu:            specV1.HasCpu,
+		HasMemory:         specV1.HasMemory,
+		HasHugetlb:        specV1.HasHugetlb,
+		HasFilesystem:     specV1.HasFilesystem,
+		HasNetwork:        specV1.HasNetwork,
+		HasProcesses:      specV1.HasProcesses,
+		HasDiskIo:         specV1.HasDiskIo,
+		HasCustomMetrics:  specV1.HasCustomMetrics,
+		Runtime:           specV1.Runtime,
+		Sandboxed:         specV1.Sandboxed,
+		Image:             specV1.Image,
+		ImageCreationTime: specV1.ImageCreationTime,
+		Labels:            specV1.Labels,
+		Envs:              specV1.Envs,
+		EnvCount:          specV1.EnvCount,
+		EnvPresence:       specV1.EnvPresence,
 	}
 	if specV1.HasCpu {
 		specV2.Cpu.Limit = specV1.Cpu.Limit
 		specV2.Cpu.MaxLimit = specV1.Cpu.MaxLimit
 		specV2.Cpu.Mask = specV1.Cpu.Mask
+		specV2.Cpu.MemoryNodes = specV1.Cpu.MemoryNodes
+		specV2.Cpu.UclampMin = specV1.Cpu.UclampMin
+		specV2.Cpu.UclampMax = specV1.Cpu.UclampMax
 	}
 	if specV1.HasMemory {
 		specV2.Memory.Limit = specV1.Memory.Limit
 		specV2.Memory.Reservation = specV1.Memory.Reservation
 		specV2.Memory.SwapLimit = specV1.Memory.SwapLimit
+		specV2.Memory.SoftLimit = specV1.Memory.SoftLimit
+		specV2.Memory.Min = specV1.Memory.Min
 	}
 	if specV1.HasCustomMetrics {
 		specV2.CustomMetrics = specV1.CustomMetrics
@@ -46,6 +46,7 @@ func TestContainerSpecFromV1(t *testing.T) {
 			Limit:       2048,
 			Reservation: 1024,
 			SwapLimit:   8192,
+			SoftLimit:   1024,
 		},
 		HasHugetlb:       true,
 		HasNetwork:       true,
@@ -80,6 +81,7 @@ func TestContainerSpecFromV1(t *testing.T) {
 			Limit:       2048,
 			Reservation: 1024,
 			SwapLimit:   8192,
+			SoftLimit:   1024,
 		},
 		HasHugetlb:       true,
 		HasNetwork:       true,
@@ -119,6 +121,7 @@ func TestContainerStatsFromV1(t *testing.T) {
 			Limit:       2048,
 			Reservation: 1024,
 			SwapLimit:   8192,
+			SoftLimit:   1024,
 		},
 		HasHugetlb:       true,
 		HasNetwork:       true,
@@ -297,6 +300,38 @@ func TestInstCpuStats(t *testing.T) {
 			&v1.ContainerStats{},
 			nil,
 		},
+		// Last is warming up
+		{
+			&v1.ContainerStats{
+				Timestamp: time.Unix(100, 0),
+				WarmingUp: true,
+			},
+			&v1.ContainerStats{
+				Timestamp: time.Unix(100, 0).Add(time.Second),
+				Cpu: v1.CpuStats{
+					Usage: v1.CpuUsage{
+						Total: 1000,
+					},
+				},
+			},
+			nil,
+		},
+		// Cur is warming up
+		{
+			&v1.ContainerStats{
+				Timestamp: time.Unix(100, 0),
+			},
+			&v1.ContainerStats{
+				Timestamp: time.Unix(100, 0).Add(time.Second),
+				Cpu: v1.CpuStats{
+					Usage: v1.CpuUsage{
+						Total: 1000,
+					},
+				},
+				WarmingUp: true,
+			},
+			nil,
+		},
 		// Goes back in time
 		{
 			&v1.ContainerStats{
@@ -73,6 +73,9 @@ type Attributes struct {
 
 	// Type of cloud instance (e.g. GCE standard) the machine is.
 	InstanceType v1.InstanceType `json:"instance_type"`
+
+	// Static metadata about the machine.
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 func GetAttributes(mi *v1.MachineInfo, vi *v1.VersionInfo) Attributes {
@@ -94,6 +97,7 @@ func GetAttributes(mi *v1.MachineInfo, vi *v1.VersionInfo) Attributes {
 		Topology:           mi.Topology,
 		CloudProvider:      mi.CloudProvider,
 		InstanceType:       mi.InstanceType,
+		Metadata:           mi.Metadata,
 	}
 }
 
@@ -115,6 +119,69 @@ type MachineStats struct {
 	Load *v1.LoadStats `json:"load_stats,omitempty"`
 }
 
+// NodeDiskStats contains the utilization of a block device of the machine over
+// the last interval.
+type NodeDiskStats struct {
+	// Name of the block device, e.g. sda.
+	Device string `json:"device"`
+
+	// The time at the end of the interval.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Duration of the interval.
+	Interval time.Duration `json:"interval"`
+
+	// Percentage of the interval during which the device was busy processing
+	// requests.
+	Utilization float64 `json:"utilization"`
+
+	// Average number of requests in flight on the device.
+	AvgQueueSize float64 `json:"avg_queue_size"`
+
+	// Average time spent by read requests, including the time in queue.
+	ReadAwait time.Duration `json:"read_await"`
+
+	// Average time spent by write requests, including the time in queue.
+	WriteAwait time.Duration `json:"write_await"`
+
+	// Average time spent by read and write requests, including the time in queue.
+	Await time.Duration `json:"await"`
+
+	// Number of read requests completed during the interval.
+	Reads uint64 `json:"reads"`
+
+	// Number of write requests completed during the interval.
+	Writes uint64 `json:"writes"`
+
+	// Number of requests in flight on the device at the end of the interval.
+	InFlight uint64 `json:"in_flight"`
+}
+
+// NodeDiskLatency is a cumulative histogram of the time spent by the requests
+// of a block device of the machine, including the time in queue.
+type NodeDiskLatency struct {
+	// Name of the block device, e.g. sda.
+	Device string `json:"device"`
+
+	// Number of requests completed.
+	Count uint64 `json:"count"`
+
+	// Total time spent by the requests, in seconds.
+	Sum float64 `json:"sum"`
+
+	// Buckets of the histogram, in increasing order of upper bound.
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+// HistogramBucket is a bucket of a cumulative histogram.
+type HistogramBucket struct {
+	// Upper bound of the bucket, inclusive.
+	UpperBound float64 `json:"upper_bound"`
+
+	// Number of observations lower than or equal to the upper bound.
+	Count uint64 `json:"count"`
+}
+
 // MachineFsStats contains per filesystem capacity and usage information.
 type MachineFsStats struct {
 	// The block device name associated with the filesystem.
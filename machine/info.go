@@ -17,6 +17,7 @@ package machine
 import (
 	"bytes"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"path/filepath"
 	"strings"
@@ -38,6 +39,7 @@ const hugepagesDirectory = "/sys/kernel/mm/hugepages/"
 const memoryControllerPath = "/sys/devices/system/edac/mc/"
 
 var machineIDFilePath = flag.String("machine_id_file", "/etc/machine-id,/var/lib/dbus/machine-id", "Comma-separated list of files to check for machine-id. Use the first one that exists.")
+var machineMetadataFile = flag.String("machine_metadata_file", "", "File with static metadata about the machine (e.g. rack, hardware SKU) to report in machine info, one key=value pair per line. Lines starting with # are ignored.")
 var bootIDFilePath = flag.String("boot_id_file", "/proc/sys/kernel/random/boot_id", "Comma-separated list of files to check for boot-id. Use the first one that exists.")
 
 func getInfoFromFiles(filePaths string) string {
@@ -54,6 +56,38 @@ func getInfoFromFiles(filePaths string) string {
 	return ""
 }
 
+// readMetadataFile reads static machine metadata from a file with one
+// key=value pair per line. Empty lines and lines starting with # are ignored.
+func readMetadataFile(filePath string) (map[string]string, error) {
+	if filePath == "" {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read machine metadata file: %v", err)
+	}
+	metadata := map[string]string{}
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid line %d in machine metadata file %q: expected key=value", i+1, filePath)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if key == "" {
+			return nil, fmt.Errorf("invalid line %d in machine metadata file %q: empty key", i+1, filePath)
+		}
+		if _, ok := metadata[key]; ok {
+			return nil, fmt.Errorf("invalid line %d in machine metadata file %q: duplicate key %q", i+1, filePath, key)
+		}
+		metadata[key] = value
+	}
+	return metadata, nil
+}
+
 func Info(sysFs sysfs.SysFs, fsInfo fs.FsInfo, inHostNamespace bool) (*info.MachineInfo, error) {
 	rootFs := "/"
 	if !inHostNamespace {
@@ -114,6 +148,11 @@ func Info(sysFs sysfs.SysFs, fsInfo fs.FsInfo, inHostNamespace bool) (*info.Mach
 		klog.Errorf("Failed to get system UUID: %v", err)
 	}
 
+	metadata, err := readMetadataFile(*machineMetadataFile)
+	if err != nil {
+		return nil, err
+	}
+
 	realCloudInfo := cloudinfo.NewRealCloudInfo()
 	cloudProvider := realCloudInfo.GetCloudProvider()
 	instanceType := realCloudInfo.GetInstanceType()
@@ -139,6 +178,7 @@ func Info(sysFs sysfs.SysFs, fsInfo fs.FsInfo, inHostNamespace bool) (*info.Mach
 		CloudProvider:    cloudProvider,
 		InstanceType:     instanceType,
 		InstanceID:       instanceID,
+		Metadata:         metadata,
 	}
 
 	for i := range filesystems {
@@ -147,7 +187,7 @@ func Info(sysFs sysfs.SysFs, fsInfo fs.FsInfo, inHostNamespace bool) (*info.Mach
 		if fs.Inodes != nil {
 			inodes = *fs.Inodes
 		}
-		machineInfo.Filesystems = append(machineInfo.Filesystems, info.FsInfo{Device: fs.Device, DeviceMajor: uint64(fs.Major), DeviceMinor: uint64(fs.Minor), Type: fs.Type.String(), Capacity: fs.Capacity, Inodes: inodes, HasInodes: fs.Inodes != nil})
+		machineInfo.Filesystems = append(machineInfo.Filesystems, info.FsInfo{Device: fs.Device, DeviceMajor: uint64(fs.Major), DeviceMinor: uint64(fs.Minor), Type: fs.Type.String(), MountType: fs.MountType, Capacity: fs.Capacity, Inodes: inodes, HasInodes: fs.Inodes != nil})
 	}
 
 	return machineInfo, nil
@@ -0,0 +1,47 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package machine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadMetadataFile(t *testing.T) {
+	metadata, err := readMetadataFile("./testdata/metadata/valid")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"rack":              "r12",
+		"hardware_sku":      "n2-highmem",
+		"provisioning_date": "2021-03-04",
+		"note":              "a=b",
+	}, metadata)
+
+	metadata, err = readMetadataFile("")
+	assert.Nil(t, err)
+	assert.Nil(t, metadata)
+}
+
+func TestReadMetadataFileInvalid(t *testing.T) {
+	for _, file := range []string{
+		"./testdata/metadata/duplicate",
+		"./testdata/metadata/no_separator",
+		"./testdata/metadata/does_not_exist",
+	} {
+		_, err := readMetadataFile(file)
+		assert.NotNil(t, err, "file %q", file)
+	}
+}
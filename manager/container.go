@@ -15,11 +15,17 @@
 package manager
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"math"
 	"math/rand"
+	"os"
 	"os/exec"
 	"path"
 	"regexp"
@@ -28,18 +34,24 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/google/cadvisor/cache/memory"
 	"github.com/google/cadvisor/collector"
 	"github.com/google/cadvisor/container"
+	"github.com/google/cadvisor/container/systemd"
+	"github.com/google/cadvisor/events"
 	info "github.com/google/cadvisor/info/v1"
 	v2 "github.com/google/cadvisor/info/v2"
 	"github.com/google/cadvisor/stats"
 	"github.com/google/cadvisor/summary"
 	"github.com/google/cadvisor/utils/cpuload"
+	"github.com/google/cadvisor/utils/delayacct"
+	"github.com/google/cadvisor/utils/ratelimitedlog"
 
 	"github.com/docker/go-units"
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/clock"
 )
@@ -47,6 +59,47 @@ import (
 // Housekeeping interval.
 var enableLoadReader = flag.Bool("enable_load_reader", false, "Whether to enable cpu load reader")
 var HousekeepingInterval = flag.Duration("housekeeping_interval", 1*time.Second, "Interval between container housekeepings")
+var housekeepingJitter = flag.Float64("housekeeping_jitter", 1.0, "Maximum delay added to the housekeeping interval of the containers to spread their housekeepings, as a fraction of the interval. Zero disables the jitter.")
+var deterministicHousekeepingJitter = flag.Bool("deterministic_housekeeping_jitter", false, "Whether to derive the housekeeping jitter of each container from a hash of the host and container names rather than drawing it at each housekeeping. The housekeepings of a container then happen at a stable interval, offset from those of the other containers.")
+var skipUnchangedContainers = flag.Bool("skip_unchanged_containers", false, "Whether to skip full stats collection for containers whose cpu usage did not change since the last housekeeping, reusing the previous sample instead. A full collection is still done at least once per max_housekeeping_interval.")
+var staleStatsTTL = flag.Duration("stale_stats_ttl", 0, "Duration for which the last collected stats of a container are served, marked stale, while its stats collection fails. Past it, the stats of the container are dropped until a collection succeeds. Zero disables stale stats.")
+var specRefreshInterval = flag.Duration("spec_refresh_interval", 5*time.Second, "Interval between re-reads of the spec of a container, e.g. its limits, env and labels, when its info is requested. The spec is re-read sooner when housekeeping sees the limits in the cgroup files of the container change.")
+var warmupSamples = flag.Int("warmup_samples", 0, "Number of samples collected after a container is created during which the rates derived from its stats, e.g. its cpu limit utilization and throttled fraction, are not reported, its cumulative counters only being reported until they have a stable baseline.")
+var collectionTimeout = flag.Duration("container_collection_timeout", 0, "Maximum duration of the stats collection of a container during housekeeping. A stage of the collection exceeding it is abandoned and skipped until the abandoned read returns. The stats collected before it, e.g. before the filesystem or perf stats, are stored, marked partial. Zero disables the timeout.")
+
+// CollectionTimeouts counts the stats collections of containers abandoned after
+// exceeding --container_collection_timeout.
+var CollectionTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cadvisor_container_collection_timeouts_total",
+	Help: "Number of container stats collections abandoned because they exceeded the collection timeout, by collection stage.",
+}, []string{"stage"})
+
+// CollectionDuration tracks the duration of the stats collections of containers.
+// Each observation carries the container it was made for as exemplar.
+var CollectionDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name:    "cadvisor_container_collection_duration_seconds",
+	Help:    "Duration of the stats collection of a container during housekeeping.",
+	Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+})
+
+func observeCollectionDuration(containerName string, duration time.Duration) {
+	CollectionDuration.(prometheus.ExemplarObserver).ObserveWithExemplar(duration.Seconds(), collectionExemplar(containerName))
+}
+
+// collectionExemplar returns the exemplar labels identifying a container,
+// truncated to the size allowed for exemplars.
+func collectionExemplar(containerName string) prometheus.Labels {
+	const label = "container"
+	value := []rune(path.Base(containerName))
+	if max := prometheus.ExemplarMaxRunes - len(label); len(value) > max {
+		value = value[:max]
+	}
+	return prometheus.Labels{label: string(value)}
+}
+
+// errCollectionTimeout is returned by a stage of the stats collection of a
+// container which did not complete before the collection timeout.
+var errCollectionTimeout = errors.New("stats collection timed out")
 
 // TODO: replace regular expressions with something simpler, such as strings.Split().
 // cgroup type chosen to fetch the cgroup path of a process.
@@ -69,6 +122,7 @@ type containerData struct {
 	memoryCache              *memory.InMemoryCache
 	lock                     sync.Mutex
 	loadReader               cpuload.CpuLoadReader
+	delayReader              delayacct.DelayReader
 	summaryReader            *summary.StatsSummary
 	loadAvg                  float64 // smoothed load average seen so far.
 	housekeepingInterval     time.Duration
@@ -77,6 +131,8 @@ type containerData struct {
 	infoLastUpdatedTime      time.Time
 	statsLastUpdatedTime     time.Time
 	lastErrorTime            time.Time
+	// Logger of the errors reported at every housekeeping.
+	log *ratelimitedlog.Logger
 	//  used to track time
 	clock clock.Clock
 
@@ -98,13 +154,77 @@ type containerData struct {
 	// nvidiaCollector updates stats for Nvidia GPUs attached to the container.
 	nvidiaCollector stats.Collector
 
+	// amdCollector updates stats for AMD GPUs attached to the container.
+	amdCollector stats.Collector
+
 	// perfCollector updates stats for perf_event cgroup controller.
 	perfCollector stats.Collector
 
 	// resctrlCollector updates stats for resctrl controller.
 	resctrlCollector stats.Collector
 
+	// systemdUnitReader reads the state of the systemd unit of the container.
+	systemdUnitReader *systemd.UnitStateReader
+
+	// abandonedStage receives the result of a collection stage abandoned after
+	// the collection timeout, once it returns.
+	abandonedStage <-chan error
+
 	oomEvents uint64
+
+	// Used to detect idle containers when skipUnchangedContainers is set.
+	lastChangeIndicator  []byte
+	lastCollectedStats   *info.ContainerStats
+	lastFullCollectionAt time.Time
+
+	// Last collected stats, and since when the collection fails and the time
+	// of the stats served as stale, used to serve stale stats when
+	// staleStatsTTL is set. failingSince and staleTimestamp are guarded by
+	// lock.
+	lastStats      *info.ContainerStats
+	failingSince   time.Time
+	staleTimestamp time.Time
+
+	// Cpu stats of the previous collection and their time, to compute the
+	// throttled fraction and the utilization of the cpu limit.
+	lastCpuStats     *info.CpuStats
+	lastCpuStatsTime time.Time
+
+	// Disk IO stats of the previous collection and their time, to compute the
+	// utilization of the throttle limits.
+	lastDiskIoStats     *info.DiskIoStats
+	lastDiskIoStatsTime time.Time
+
+	// Number of samples whose derived rates are suppressed after the
+	// container is created, and number of samples collected so far.
+	warmupSamples    int
+	collectedSamples int
+
+	// Number of cores of the machine, the cpu limit of the containers without
+	// CFS quota.
+	numCores int
+
+	// Values of the resettableCounters and CPUs of the cpuset in the previous
+	// collection, and the handler their resets and changes are reported to.
+	lastCounters   []uint64
+	lastCpusetCpus string
+	eventHandler   events.EventManager
+
+	// Delays of the processes of the container, including those which exited.
+	delays delaysCache
+
+	// Inode of the container's cgroup directory, looked up on first use under
+	// lock.
+	cgroupID uint64
+
+	// Content of the limit files of the cgroup at the last housekeeping, once
+	// limitsChecked is set.
+	specLimitsIndicator []byte
+	limitsChecked       bool
+
+	// Offset of the housekeepings of the container within the housekeeping
+	// interval, as a fraction of the jitter, when the jitter is deterministic.
+	housekeepingPhase float64
 }
 
 // jitter returns a time.Duration between duration and duration + maxFactor * duration,
@@ -118,6 +238,34 @@ func jitter(duration time.Duration, maxFactor float64) time.Duration {
 	return wait
 }
 
+// hostname returns the name of the host, used to offset the housekeepings of
+// containers of the same name on different hosts.
+// This is defined as a variable to help in testing.
+var hostname = os.Hostname
+
+// housekeepingPhase returns a fraction in [0, 1) derived from the name of the
+// container and of the host.
+func housekeepingPhase(containerName string) float64 {
+	h := sha256.New()
+	if name, err := hostname(); err == nil {
+		h.Write([]byte(name))
+	}
+	h.Write([]byte(containerName))
+	return float64(binary.BigEndian.Uint64(h.Sum(nil))>>11) / (1 << 53)
+}
+
+// deterministicJitter returns the time until the next housekeeping of the
+// container, such that its housekeepings happen every interval at its offset
+// within the interval, up to maxFactor * interval.
+func (cd *containerData) deterministicJitter(interval time.Duration, maxFactor float64) time.Duration {
+	if maxFactor > 1.0 {
+		maxFactor = 1.0
+	}
+	offset := time.Duration(cd.housekeepingPhase * maxFactor * float64(interval))
+	elapsed := time.Duration(cd.clock.Now().UnixNano()) - offset
+	return interval - elapsed%interval
+}
+
 func (cd *containerData) Start() error {
 	go cd.housekeeping()
 	return nil
@@ -174,7 +322,9 @@ func (cd *containerData) notifyOnDemand() {
 
 func (cd *containerData) GetInfo(shouldUpdateSubcontainers bool) (*containerInfo, error) {
 	// Get spec and subcontainers.
-	if cd.clock.Since(cd.infoLastUpdatedTime) > 5*time.Second || shouldUpdateSubcontainers {
+	// The spec rarely changes, so it is only re-read periodically. Updates of
+	// the limits of the container are picked up sooner by housekeeping.
+	if cd.clock.Since(cd.infoLastUpdatedTime) > *specRefreshInterval || shouldUpdateSubcontainers {
 		err := cd.updateSpec()
 		if err != nil {
 			return nil, err
@@ -197,9 +347,111 @@ func (cd *containerData) GetInfo(shouldUpdateSubcontainers bool) (*containerInfo
 	cInfo.Name = cd.info.Name
 	cInfo.Aliases = cd.info.Aliases
 	cInfo.Namespace = cd.info.Namespace
+	cInfo.CgroupId = cd.getCgroupID()
+	cInfo.Depth = cgroupDepth(cd.info.Name)
 	return &cInfo, nil
 }
 
+// cgroupDepth returns the number of levels of the cgroup of the container with
+// the given name below the root cgroup.
+func cgroupDepth(name string) int {
+	depth := 0
+	for _, segment := range strings.Split(name, "/") {
+		if segment != "" {
+			depth++
+		}
+	}
+	return depth
+}
+
+// getCgroupID returns the id of the container's cgroup, looked up once it is
+// found. On cgroup v2 all controllers share a directory whose inode is the
+// cgroup id used by the kernel, e.g. by BPF tools. On v1 it is only the inode
+// of the memory (or cpu) controller directory, which BPF tools don't know.
+// cd.lock must be held.
+func (cd *containerData) getCgroupID() uint64 {
+	if cd.cgroupID != 0 {
+		return cd.cgroupID
+	}
+	for _, resource := range []string{"memory", "cpu"} {
+		cgroupPath, err := cd.handler.GetCgroupPath(resource)
+		if err != nil {
+			continue
+		}
+		fi, err := os.Stat(cgroupPath)
+		if err != nil {
+			klog.V(4).Infof("Unable to stat cgroup %q of container %q: %v", cgroupPath, cd.info.Name, err)
+			continue
+		}
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+			cd.cgroupID = st.Ino
+			break
+		}
+	}
+	return cd.cgroupID
+}
+
+// specLimitFiles are the files holding the limits of a container in its
+// cgroup directories, by controller, on cgroup v1 and v2.
+var specLimitFiles = []struct {
+	controller string
+	files      []string
+}{
+	{"memory", []string{"memory.max", "memory.high", "memory.low", "memory.min", "memory.swap.max", "memory.limit_in_bytes", "memory.soft_limit_in_bytes", "memory.memsw.limit_in_bytes"}},
+	{"cpu", []string{"cpu.max", "cpu.weight", "cpu.shares", "cpu.cfs_quota_us", "cpu.cfs_period_us"}},
+	{"cpuset", []string{"cpuset.cpus", "cpuset.mems"}},
+	{"pids", []string{"pids.max"}},
+}
+
+// readLimitsIndicator returns the content of the limit files of the
+// container's cgroup, which changes whenever its limits are updated, e.g. by
+// docker update. Writing cgroup files changes neither their modification time
+// nor the one of their directory.
+func (cd *containerData) readLimitsIndicator() []byte {
+	var indicator bytes.Buffer
+	read := map[string]bool{}
+	for _, limits := range specLimitFiles {
+		dir, err := cd.handler.GetCgroupPath(limits.controller)
+		if err != nil {
+			continue
+		}
+		for _, file := range limits.files {
+			// All the controllers share the same directory on cgroup v2.
+			filePath := path.Join(dir, file)
+			if read[filePath] {
+				continue
+			}
+			read[filePath] = true
+			content, err := ioutil.ReadFile(filePath)
+			if err != nil {
+				continue
+			}
+			indicator.WriteString(filePath)
+			indicator.WriteByte(0)
+			indicator.Write(content)
+		}
+	}
+	return indicator.Bytes()
+}
+
+// updateSpecOnLimitsChange re-reads the spec when the limits of the container
+// changed since the last housekeeping. It runs at housekeeping to keep reading
+// the limit files off the path of info requests.
+func (cd *containerData) updateSpecOnLimitsChange() {
+	limits := cd.readLimitsIndicator()
+	cd.lock.Lock()
+	changed := cd.limitsChecked && !bytes.Equal(limits, cd.specLimitsIndicator)
+	cd.specLimitsIndicator = limits
+	cd.limitsChecked = true
+	cd.lock.Unlock()
+	if !changed {
+		return
+	}
+	if err := cd.updateSpec(); err != nil && cd.allowErrorLogging() {
+		klog.Warningf("Failed to update spec for container %q: %v", cd.info.Name, err)
+	}
+}
+
 func (cd *containerData) DerivedStats() (v2.DerivedStats, error) {
 	if cd.summaryReader == nil {
 		return v2.DerivedStats{}, fmt.Errorf("derived stats not enabled for container %q", cd.info.Name)
@@ -450,9 +702,15 @@ func newContainerData(containerName string, memoryCache *memory.InMemoryCache, h
 		clock:                    clock,
 		perfCollector:            &stats.NoopCollector{},
 		nvidiaCollector:          &stats.NoopCollector{},
+		amdCollector:             &stats.NoopCollector{},
 		resctrlCollector:         &stats.NoopCollector{},
+		log:                      ratelimitedlog.New(),
+		warmupSamples:            *warmupSamples,
 	}
 	cont.info.ContainerReference = ref
+	if *deterministicHousekeepingJitter {
+		cont.housekeepingPhase = housekeepingPhase(containerName)
+	}
 
 	cont.loadDecay = math.Exp(float64(-cont.housekeepingInterval.Seconds() / 10))
 
@@ -503,7 +761,13 @@ func (cd *containerData) nextHousekeepingInterval() time.Duration {
 		}
 	}
 
-	return jitter(cd.housekeepingInterval, 1.0)
+	if *housekeepingJitter <= 0 {
+		return cd.housekeepingInterval
+	}
+	if *deterministicHousekeepingJitter {
+		return cd.deterministicJitter(cd.housekeepingInterval, *housekeepingJitter)
+	}
+	return jitter(cd.housekeepingInterval, *housekeepingJitter)
 }
 
 // TODO(vmarmol): Implement stats collecting as a custom collector.
@@ -590,8 +854,10 @@ func (cd *containerData) housekeepingTick(timer <-chan time.Time, longHousekeepi
 			klog.Warningf("Failed to update stats for container \"%s\": %s", cd.info.Name, err)
 		}
 	}
+	cd.updateSpecOnLimitsChange()
 	// Log if housekeeping took too long.
 	duration := cd.clock.Since(start)
+	observeCollectionDuration(cd.info.Name, duration)
 	if duration >= longHousekeeping {
 		klog.V(3).Infof("[%s] Housekeeping took %s", cd.info.Name, duration)
 	}
@@ -620,6 +886,9 @@ func (cd *containerData) updateSpec() error {
 		spec.HasCustomMetrics = true
 		spec.CustomMetrics = customMetrics
 	}
+	if cd.systemdUnitReader != nil {
+		spec.SystemdUnit = cd.systemdUnitReader.UnitState(cd.info.Name)
+	}
 	cd.lock.Lock()
 	defer cd.lock.Unlock()
 	cd.info.Spec = spec
@@ -637,8 +906,271 @@ func (cd *containerData) updateLoad(newLoad uint64) {
 	}
 }
 
+// throttledFraction returns the fraction of the runnable time lost to throttling
+// between the previous and current cpu stats. It is 0 without a previous sample,
+// when the container neither ran nor was throttled, or when counters were reset.
+func throttledFraction(prev, cur *info.CpuStats) float64 {
+	if prev == nil || cur.CFS.ThrottledTime < prev.CFS.ThrottledTime || cur.Usage.Total < prev.Usage.Total {
+		return 0
+	}
+	throttled := cur.CFS.ThrottledTime - prev.CFS.ThrottledTime
+	runnable := throttled + cur.Usage.Total - prev.Usage.Total
+	if runnable == 0 {
+		return 0
+	}
+	return float64(throttled) / float64(runnable)
+}
+
+// cpuLimitCores returns the number of cores allocated to a container, by its
+// CFS quota, or numCores without quota.
+func cpuLimitCores(spec info.CpuSpec, numCores int) float64 {
+	if spec.Quota > 0 && spec.Period > 0 {
+		return float64(spec.Quota) / float64(spec.Period)
+	}
+	return float64(numCores)
+}
+
+// cpuLimitUtilization returns the fraction of the given cores used between the
+// previous cpu stats, collected at prevTime, and the current stats. It is 0
+// without a previous sample, without cores, or when counters were reset.
+// The cpu time used beyond the CFS quota thanks to its burst is not counted,
+// so that a container spending the quota it saved up doesn't exceed its limit.
+func cpuLimitUtilization(prev *info.CpuStats, prevTime time.Time, cur *info.ContainerStats, cores float64) float64 {
+	if prev == nil || cores <= 0 || cur.Cpu.Usage.Total < prev.Usage.Total {
+		return 0
+	}
+	elapsed := cur.Timestamp.Sub(prevTime)
+	if elapsed <= 0 {
+		return 0
+	}
+	used := cur.Cpu.Usage.Total - prev.Usage.Total
+	if cur.Cpu.CFS.BurstTime >= prev.CFS.BurstTime {
+		if burst := cur.Cpu.CFS.BurstTime - prev.CFS.BurstTime; burst <= used {
+			used -= burst
+		}
+	}
+	return float64(used) / (float64(elapsed) * cores)
+}
+
+// diskThrottleUtilization returns the fraction of the throttle limits of the
+// devices used between the previous disk IO stats, collected at prevTime, and
+// the current stats. Devices without limits, without previous sample, or whose
+// counters were reset are skipped.
+func diskThrottleUtilization(prev *info.DiskIoStats, prevTime time.Time, cur *info.ContainerStats, spec info.DiskIoSpec) []info.PerDiskUtilization {
+	if prev == nil {
+		return nil
+	}
+	elapsed := cur.Timestamp.Sub(prevTime).Seconds()
+	if elapsed <= 0 {
+		return nil
+	}
+	var utilizations []info.PerDiskUtilization
+	byDevice := map[[2]uint64]int{}
+	for _, throttle := range []struct {
+		key    string
+		limits []info.PerDeviceIoSpec
+		prev   []info.PerDiskStats
+		cur    []info.PerDiskStats
+		op     string
+	}{
+		{info.ReadBpsUtilization, spec.ReadBpsLimits, prev.IoServiceBytes, cur.DiskIo.IoServiceBytes, "Read"},
+		{info.WriteBpsUtilization, spec.WriteBpsLimits, prev.IoServiceBytes, cur.DiskIo.IoServiceBytes, "Write"},
+		{info.ReadIopsUtilization, spec.ReadIopsLimits, prev.IoServiced, cur.DiskIo.IoServiced, "Read"},
+		{info.WriteIopsUtilization, spec.WriteIopsLimits, prev.IoServiced, cur.DiskIo.IoServiced, "Write"},
+	} {
+		for _, limit := range throttle.limits {
+			if limit.Value == 0 {
+				continue
+			}
+			curStats, ok := findPerDiskStats(throttle.cur, limit.Major, limit.Minor)
+			if !ok {
+				continue
+			}
+			prevStats, ok := findPerDiskStats(throttle.prev, limit.Major, limit.Minor)
+			if !ok || curStats.Stats[throttle.op] < prevStats.Stats[throttle.op] {
+				continue
+			}
+			rate := float64(curStats.Stats[throttle.op]-prevStats.Stats[throttle.op]) / elapsed
+			device := [2]uint64{limit.Major, limit.Minor}
+			i, ok := byDevice[device]
+			if !ok {
+				i = len(utilizations)
+				byDevice[device] = i
+				utilizations = append(utilizations, info.PerDiskUtilization{
+					Device:      curStats.Device,
+					Major:       limit.Major,
+					Minor:       limit.Minor,
+					Utilization: map[string]float64{},
+				})
+			}
+			utilizations[i].Utilization[throttle.key] = rate / float64(limit.Value)
+		}
+	}
+	return utilizations
+}
+
+// findPerDiskStats returns the stats of the given device.
+func findPerDiskStats(stats []info.PerDiskStats, major, minor uint64) (info.PerDiskStats, bool) {
+	for _, s := range stats {
+		if s.Major == major && s.Minor == minor {
+			return s, true
+		}
+	}
+	return info.PerDiskStats{}, false
+}
+
+// readChangeIndicator returns the cumulative cpu usage of the container as reported by
+// its cgroup. It is cheap to read and changes whenever the container does any work.
+func (cd *containerData) readChangeIndicator() ([]byte, error) {
+	if cpuacctPath, err := cd.handler.GetCgroupPath("cpuacct"); err == nil {
+		if usage, err := ioutil.ReadFile(path.Join(cpuacctPath, "cpuacct.usage")); err == nil {
+			return usage, nil
+		}
+	}
+	cpuPath, err := cd.handler.GetCgroupPath("cpu")
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(path.Join(cpuPath, "cpu.stat"))
+}
+
+// unchangedStats returns a copy of the last collected stats, timestamped now, if the
+// container did not change since they were collected. It returns nil if a full
+// collection is required.
+func (cd *containerData) unchangedStats() *info.ContainerStats {
+	indicator, err := cd.readChangeIndicator()
+	if err != nil {
+		klog.V(4).Infof("Unable to read change indicator for %q: %v", cd.info.Name, err)
+		cd.lastChangeIndicator = nil
+		return nil
+	}
+	changed := cd.lastChangeIndicator == nil || !bytes.Equal(indicator, cd.lastChangeIndicator)
+	cd.lastChangeIndicator = indicator
+	if changed || cd.lastCollectedStats == nil || cd.clock.Since(cd.lastFullCollectionAt) >= cd.maxHousekeepingInterval {
+		return nil
+	}
+
+	// The copy shares the underlying maps and slices, which are never modified after collection.
+	stats := *cd.lastCollectedStats
+	stats.Timestamp = cd.clock.Now()
+	// The container did not run, so it was not throttled either.
+	stats.Cpu.CFS.ThrottledFraction = 0
+	stats.Cpu.LimitUtilization = 0
+	stats.DiskIo.ThrottleUtilization = nil
+	stats.OOMEvents = atomic.LoadUint64(&cd.oomEvents)
+	return &stats
+}
+
+// updateStats collects and stores the stats of the container. When the
+// collection fails, the last collected stats are served marked stale, see
+// markStale, for up to staleStatsTTL.
 func (cd *containerData) updateStats() error {
-	stats, statsErr := cd.handler.GetStats()
+	lastStats := cd.lastStats
+	err := cd.collectStats()
+	if err == nil || *staleStatsTTL <= 0 || cd.lastStats != lastStats {
+		// No stats or new stats, possibly partial, were stored.
+		cd.setFailing(time.Time{}, time.Time{})
+		return err
+	}
+	if cd.lastStats == nil {
+		return err
+	}
+
+	now := cd.clock.Now()
+	failingSince, _ := cd.getFailing()
+	if failingSince.IsZero() {
+		failingSince = now
+		cd.setFailing(now, cd.lastStats.Timestamp)
+	}
+	if now.Sub(failingSince) >= *staleStatsTTL {
+		klog.V(3).Infof("Dropping stats of container %q, failing since %s", cd.info.Name, failingSince)
+		cd.lastStats = nil
+		if removeErr := cd.memoryCache.RemoveContainer(cd.info.Name); removeErr != nil {
+			klog.Warningf("Failed to drop stats of container %q: %v", cd.info.Name, removeErr)
+		}
+	}
+	return err
+}
+
+func (cd *containerData) getFailing() (failingSince, staleTimestamp time.Time) {
+	cd.lock.Lock()
+	defer cd.lock.Unlock()
+	return cd.failingSince, cd.staleTimestamp
+}
+
+func (cd *containerData) setFailing(failingSince, staleTimestamp time.Time) {
+	cd.lock.Lock()
+	defer cd.lock.Unlock()
+	cd.failingSince = failingSince
+	cd.staleTimestamp = staleTimestamp
+}
+
+// markStale returns the stats read from the memory cache with the last
+// collected sample marked stale if the stats collection of the container is
+// failing. The stored stats are left untouched.
+func (cd *containerData) markStale(stats []*info.ContainerStats) []*info.ContainerStats {
+	if *staleStatsTTL <= 0 || len(stats) == 0 {
+		return stats
+	}
+	failingSince, staleTimestamp := cd.getFailing()
+	if failingSince.IsZero() || !stats[len(stats)-1].Timestamp.Equal(staleTimestamp) {
+		return stats
+	}
+	last := *stats[len(stats)-1]
+	last.Stale = true
+	last.FailingSince = &failingSince
+	marked := make([]*info.ContainerStats, len(stats))
+	copy(marked, stats)
+	marked[len(marked)-1] = &last
+	return marked
+}
+
+// collectStats collects the stats of the container and stores them.
+func (cd *containerData) collectStats() error {
+	if *skipUnchangedContainers {
+		if stats := cd.unchangedStats(); stats != nil {
+			return cd.addUnchangedStats(stats)
+		}
+	}
+	if cd.abandonedStage != nil {
+		select {
+		case <-cd.abandonedStage:
+			cd.abandonedStage = nil
+		default:
+			return fmt.Errorf("skipping collection, an abandoned collection is still running: %w", errCollectionTimeout)
+		}
+	}
+	ctx := context.Background()
+	if *collectionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *collectionTimeout)
+		defer cancel()
+	}
+
+	var stats *info.ContainerStats
+	var statsErr error
+	// The first stage exceeding the collection timeout, the stages after it are skipped.
+	var timeoutErr error
+	if h, ok := cd.handler.(container.StatsContextHandler); ok && ctx.Done() != nil {
+		// The handler gives up on the subsystems it can't read in time
+		// itself, and returns the stats of the others.
+		stats, statsErr = h.GetStatsContext(ctx)
+		if errors.Is(statsErr, container.ErrPartialStats) {
+			if ctx.Err() != nil {
+				CollectionTimeouts.WithLabelValues("stats").Inc()
+			}
+			timeoutErr = fmt.Errorf("stats: %v: %w", statsErr, errCollectionTimeout)
+			statsErr = nil
+		}
+	} else {
+		err := cd.runStage(ctx, "stats", func() error {
+			stats, statsErr = cd.handler.GetStats()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
 	if statsErr != nil {
 		// Ignore errors if the container is dead.
 		if !cd.handler.Exists() {
@@ -649,23 +1181,78 @@ func (cd *containerData) updateStats() error {
 		statsErr = fmt.Errorf("%v, continuing to push stats", statsErr)
 	}
 	if stats == nil {
+		if timeoutErr != nil {
+			return timeoutErr
+		}
 		return statsErr
 	}
+	stats.Cpu.CFS.ThrottledFraction = throttledFraction(cd.lastCpuStats, &stats.Cpu)
+	cd.lock.Lock()
+	cpuSpec := cd.info.Spec.Cpu
+	diskIoSpec := cd.info.Spec.DiskIo
+	cd.lock.Unlock()
+	stats.Cpu.LimitUtilization = cpuLimitUtilization(cd.lastCpuStats, cd.lastCpuStatsTime, stats, cpuLimitCores(cpuSpec, cd.numCores))
+	lastCpuStats := stats.Cpu
+	cd.lastCpuStats = &lastCpuStats
+	cd.lastCpuStatsTime = stats.Timestamp
+	stats.DiskIo.ThrottleUtilization = diskThrottleUtilization(cd.lastDiskIoStats, cd.lastDiskIoStatsTime, stats, diskIoSpec)
+	lastDiskIoStats := stats.DiskIo
+	cd.lastDiskIoStats = &lastDiskIoStats
+	cd.lastDiskIoStatsTime = stats.Timestamp
+	// The first samples of a container, e.g. partially read while it starts,
+	// only serve as baseline for the rates of the following ones.
+	if cd.collectedSamples < cd.warmupSamples {
+		cd.collectedSamples++
+		stats.WarmingUp = true
+		stats.Cpu.CFS.ThrottledFraction = 0
+		stats.Cpu.LimitUtilization = 0
+		stats.DiskIo.ThrottleUtilization = nil
+	}
+	cd.detectCounterResets(stats)
+	cd.detectCpusetChange(stats)
 	if cd.loadReader != nil {
 		// TODO(vmarmol): Cache this path.
 		path, err := cd.handler.GetCgroupPath("cpu")
 		if err == nil {
-			loadStats, err := cd.loadReader.GetCpuLoad(cd.info.Name, path)
-			if err != nil {
+			var loadStats info.LoadStats
+			err = cd.runStage(ctx, "load", func() (err error) {
+				loadStats, err = cd.loadReader.GetCpuLoad(cd.info.Name, path)
+				return err
+			})
+			if errors.Is(err, errCollectionTimeout) {
+				timeoutErr = err
+			} else if err != nil {
 				return fmt.Errorf("failed to get load stat for %q - path %q, error %s", cd.info.Name, path, err)
+			} else {
+				stats.TaskStats = loadStats
+				cd.updateLoad(loadStats.NrRunning)
+				// convert to 'milliLoad' to avoid floats and preserve precision.
+				stats.Cpu.LoadAverage = int32(cd.loadAvg * 1000)
 			}
-			stats.TaskStats = loadStats
-			cd.updateLoad(loadStats.NrRunning)
-			// convert to 'milliLoad' to avoid floats and preserve precision.
-			stats.Cpu.LoadAverage = int32(cd.loadAvg * 1000)
 		}
 	}
-	if cd.summaryReader != nil {
+	if cd.delayReader != nil {
+		var delayStats map[int]info.DelayStats
+		err := cd.runStage(ctx, "delay", func() error {
+			pids, err := cd.handler.ListProcesses(container.ListSelf)
+			if err != nil {
+				return err
+			}
+			delayStats, err = cd.delayReader.GetDelayStats(pids)
+			return err
+		})
+		if errors.Is(err, errCollectionTimeout) {
+			if timeoutErr == nil {
+				timeoutErr = err
+			}
+		} else if err != nil {
+			klog.V(4).Infof("Failed to get the delays of %q: %v", cd.info.Name, err)
+		} else {
+			delays := cd.delays.update(delayStats)
+			stats.Delay = &delays
+		}
+	}
+	if cd.summaryReader != nil && !stats.WarmingUp {
 		err := cd.summaryReader.AddSample(*stats)
 		if err != nil {
 			// Ignore summary errors for now.
@@ -679,12 +1266,22 @@ func (cd *containerData) updateStats() error {
 	cm := cd.collectorManager.(*collector.GenericCollectorManager)
 	if len(cm.Collectors) > 0 {
 		if cm.NextCollectionTime.Before(cd.clock.Now()) {
-			customStats, err := cd.updateCustomStats()
-			if customStats != nil {
-				stats.CustomMetrics = customStats
-			}
-			if err != nil {
-				customStatsErr = err
+			var customStats map[string][]info.MetricVal
+			err := cd.runStage(ctx, "custom_metrics", func() (err error) {
+				customStats, err = cd.updateCustomStats()
+				return err
+			})
+			if errors.Is(err, errCollectionTimeout) {
+				if timeoutErr == nil {
+					timeoutErr = err
+				}
+			} else {
+				if customStats != nil {
+					stats.CustomMetrics = customStats
+				}
+				if err != nil {
+					customStatsErr = err
+				}
 			}
 		}
 	}
@@ -692,12 +1289,26 @@ func (cd *containerData) updateStats() error {
 	var nvidiaStatsErr error
 	if cd.nvidiaCollector != nil {
 		// This updates the Accelerators field of the stats struct
-		nvidiaStatsErr = cd.nvidiaCollector.UpdateStats(stats)
+		nvidiaStatsErr = cd.runCollectorStage(ctx, "accelerators", cd.nvidiaCollector, stats)
+	}
+
+	var amdStatsErr error
+	if cd.amdCollector != nil {
+		amdStatsErr = cd.runCollectorStage(ctx, "accelerators", cd.amdCollector, stats)
 	}
 
-	perfStatsErr := cd.perfCollector.UpdateStats(stats)
+	perfStatsErr := cd.runCollectorStage(ctx, "perf", cd.perfCollector, stats)
+
+	resctrlStatsErr := cd.runCollectorStage(ctx, "resctrl", cd.resctrlCollector, stats)
+
+	for _, err := range []error{nvidiaStatsErr, amdStatsErr, perfStatsErr, resctrlStatsErr} {
+		if timeoutErr == nil && errors.Is(err, errCollectionTimeout) {
+			timeoutErr = err
+		}
+	}
 
-	resctrlStatsErr := cd.resctrlCollector.UpdateStats(stats)
+	// The stats of the stages skipped are missing.
+	stats.Partial = timeoutErr != nil
 
 	ref, err := cd.handler.ContainerReference()
 	if err != nil {
@@ -716,24 +1327,103 @@ func (cd *containerData) updateStats() error {
 	if err != nil {
 		return err
 	}
+	if *staleStatsTTL > 0 {
+		cd.lastStats = stats
+	}
+	if *skipUnchangedContainers && statsErr == nil && timeoutErr == nil {
+		cd.lastCollectedStats = stats
+		cd.lastFullCollectionAt = cd.clock.Now()
+	}
 	if statsErr != nil {
 		return statsErr
 	}
+	if timeoutErr != nil {
+		return timeoutErr
+	}
 	if nvidiaStatsErr != nil {
-		klog.Errorf("error occurred while collecting nvidia stats for container %s: %s", cInfo.Name, err)
+		cd.log.Errorf("error occurred while collecting nvidia stats for container %s: %s", cInfo.Name, err)
 		return nvidiaStatsErr
 	}
+	if amdStatsErr != nil {
+		cd.log.Errorf("error occurred while collecting amd stats for container %s: %s", cInfo.Name, amdStatsErr)
+		return amdStatsErr
+	}
 	if perfStatsErr != nil {
-		klog.Errorf("error occurred while collecting perf stats for container %s: %s", cInfo.Name, err)
+		cd.log.Errorf("error occurred while collecting perf stats for container %s: %s", cInfo.Name, err)
 		return perfStatsErr
 	}
 	if resctrlStatsErr != nil {
-		klog.Errorf("error occurred while collecting resctrl stats for container %s: %s", cInfo.Name, resctrlStatsErr)
+		cd.log.Errorf("error occurred while collecting resctrl stats for container %s: %s", cInfo.Name, resctrlStatsErr)
 		return resctrlStatsErr
 	}
 	return customStatsErr
 }
 
+// runStage runs a stage of the stats collection of the container, giving up
+// once ctx is done. An abandoned stage keeps running in the background, and the
+// container is not collected again until it returns.
+func (cd *containerData) runStage(ctx context.Context, stage string, collect func() error) error {
+	if ctx.Done() == nil {
+		return collect()
+	}
+	if ctx.Err() != nil {
+		// An earlier stage already timed out.
+		return fmt.Errorf("%s: %w", stage, errCollectionTimeout)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- collect()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		CollectionTimeouts.WithLabelValues(stage).Inc()
+		cd.abandonedStage = done
+		return fmt.Errorf("%s took longer than %v: %w", stage, *collectionTimeout, errCollectionTimeout)
+	}
+}
+
+// runCollectorStage updates containerStats with collector in a stage of the
+// stats collection. The collector works on a copy so that, if abandoned, it
+// does not modify stats which have already been stored.
+func (cd *containerData) runCollectorStage(ctx context.Context, stage string, collector stats.Collector, containerStats *info.ContainerStats) error {
+	if ctx.Done() == nil {
+		return collector.UpdateStats(containerStats)
+	}
+	updated := *containerStats
+	err := cd.runStage(ctx, stage, func() error {
+		return collector.UpdateStats(&updated)
+	})
+	if !errors.Is(err, errCollectionTimeout) {
+		*containerStats = updated
+	}
+	return err
+}
+
+// addUnchangedStats stores a sample reused from a previous collection. Counters are
+// unchanged, so rates computed over the interval correctly come out as zero.
+func (cd *containerData) addUnchangedStats(stats *info.ContainerStats) error {
+	if cd.summaryReader != nil {
+		err := cd.summaryReader.AddSample(*stats)
+		if err != nil {
+			// Ignore summary errors for now.
+			klog.V(2).Infof("Failed to add summary stats for %q: %v", cd.info.Name, err)
+		}
+	}
+
+	ref, err := cd.handler.ContainerReference()
+	if err != nil {
+		// Ignore errors if the container is dead.
+		if !cd.handler.Exists() {
+			return nil
+		}
+		return err
+	}
+
+	return cd.memoryCache.AddStats(&info.ContainerInfo{ContainerReference: ref}, stats)
+}
+
 func (cd *containerData) updateCustomStats() (map[string][]info.MetricVal, error) {
 	_, customStats, customStatsErr := cd.collectorManager.Collect()
 	if customStatsErr != nil {
@@ -17,9 +17,16 @@
 package manager
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -27,12 +34,17 @@ import (
 	"github.com/google/cadvisor/collector"
 	"github.com/google/cadvisor/container"
 	containertest "github.com/google/cadvisor/container/testing"
+	"github.com/google/cadvisor/events"
 	info "github.com/google/cadvisor/info/v1"
 	itest "github.com/google/cadvisor/info/v1/test"
 	v2 "github.com/google/cadvisor/info/v2"
+	"github.com/google/cadvisor/stats"
 
 	"github.com/mindprince/gonvml"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	clock "k8s.io/utils/clock/testing"
 
@@ -152,6 +164,433 @@ func TestUpdateStats(t *testing.T) {
 	mockHandler.AssertExpectations(t)
 }
 
+func TestUpdateStatsSkipsUnchangedContainers(t *testing.T) {
+	defer func(skip bool) { *skipUnchangedContainers = skip }(*skipUnchangedContainers)
+	*skipUnchangedContainers = true
+
+	cgroupPath, err := ioutil.TempDir("", "cpuacct")
+	require.Nil(t, err)
+	defer os.RemoveAll(cgroupPath)
+	usageFile := filepath.Join(cgroupPath, "cpuacct.usage")
+	require.Nil(t, ioutil.WriteFile(usageFile, []byte("1000\n"), 0644))
+
+	statsList := itest.GenerateRandomStats(2, 4, 1*time.Second)
+	cd, mockHandler, _, fakeClock := newTestContainerData(t)
+	memoryCache := memory.New(time.Minute, nil)
+	cd.memoryCache = memoryCache
+	statsList[0].Timestamp = fakeClock.Now()
+	statsList[1].Timestamp = fakeClock.Now().Add(2 * time.Second)
+	mockHandler.On("GetCgroupPath", "cpuacct").Return(cgroupPath, nil)
+	mockHandler.On("GetStats").Return(statsList[0], nil).Once()
+
+	// The first housekeeping always does a full collection.
+	require.Nil(t, cd.updateStats())
+	checkNumStats(t, memoryCache, 1)
+
+	// Unchanged cpu usage reuses the previous sample.
+	fakeClock.Step(time.Second)
+	require.Nil(t, cd.updateStats())
+	checkNumStats(t, memoryCache, 2)
+	mockHandler.AssertNumberOfCalls(t, "GetStats", 1)
+
+	var empty time.Time
+	stats, err := memoryCache.RecentStats(containerName, empty, empty, 2)
+	require.Nil(t, err)
+	assert.True(t, stats[0].StatsEq(stats[1]))
+	assert.Equal(t, fakeClock.Now(), stats[1].Timestamp)
+
+	// Changed cpu usage triggers a full collection.
+	require.Nil(t, ioutil.WriteFile(usageFile, []byte("2000\n"), 0644))
+	mockHandler.On("GetStats").Return(statsList[1], nil).Once()
+	fakeClock.Step(time.Second)
+	require.Nil(t, cd.updateStats())
+	checkNumStats(t, memoryCache, 3)
+	mockHandler.AssertNumberOfCalls(t, "GetStats", 2)
+}
+
+func TestUpdateStatsStaleStats(t *testing.T) {
+	defer func(ttl time.Duration) { *staleStatsTTL = ttl }(*staleStatsTTL)
+	*staleStatsTTL = 10 * time.Second
+
+	cd, mockHandler, _, fakeClock := newTestContainerData(t)
+	memoryCache := memory.New(time.Minute, nil)
+	cd.memoryCache = memoryCache
+	stats := itest.GenerateRandomStats(1, 4, time.Second)[0]
+	collectedAt := fakeClock.Now()
+	stats.Timestamp = collectedAt
+	mockHandler.On("GetStats").Return(stats, nil).Once()
+	require.Nil(t, cd.updateStats())
+
+	// The collection fails for less than the TTL, the last stats are still
+	// served, marked stale, but no stats are stored.
+	mockHandler.On("GetStats").Return((*info.ContainerStats)(nil), errors.New("runtime unavailable"))
+	mockHandler.On("Exists").Return(true)
+	failingSince := fakeClock.Now().Add(4 * time.Second)
+	for i := 0; i < 3; i++ {
+		fakeClock.Step(4 * time.Second)
+		assert.Error(t, cd.updateStats())
+		checkNumStats(t, memoryCache, 1)
+		var empty time.Time
+		recent, err := memoryCache.RecentStats(containerName, empty, empty, 1)
+		require.Nil(t, err)
+		assert.False(t, recent[0].Stale)
+		served := cd.markStale(recent)
+		assert.True(t, served[0].Stale)
+		require.NotNil(t, served[0].FailingSince)
+		assert.Equal(t, failingSince, *served[0].FailingSince)
+		assert.Equal(t, collectedAt, served[0].Timestamp)
+		assert.True(t, stats.StatsEq(served[0]))
+	}
+
+	// Past the TTL since the first failure, the stats of the container are
+	// dropped.
+	fakeClock.Step(4 * time.Second)
+	assert.Error(t, cd.updateStats())
+	var empty time.Time
+	_, err := memoryCache.RecentStats(containerName, empty, empty, -1)
+	assert.Equal(t, memory.ErrDataNotFound, err)
+	fakeClock.Step(4 * time.Second)
+	assert.Error(t, cd.updateStats())
+	_, err = memoryCache.RecentStats(containerName, empty, empty, -1)
+	assert.Equal(t, memory.ErrDataNotFound, err)
+}
+
+func TestUpdateStatsThrottledFraction(t *testing.T) {
+	cd, mockHandler, memoryCache, fakeClock := newTestContainerData(t)
+	samples := []struct {
+		usage     uint64
+		throttled uint64
+		expected  float64
+	}{
+		// No previous sample.
+		{usage: 1000, throttled: 500, expected: 0},
+		// 300ns throttled out of 300ns throttled + 900ns used.
+		{usage: 1900, throttled: 800, expected: 0.25},
+		// Neither used nor throttled.
+		{usage: 1900, throttled: 800, expected: 0},
+		// Throttled without using cpu.
+		{usage: 1900, throttled: 1000, expected: 1},
+		// Counters reset.
+		{usage: 100, throttled: 0, expected: 0},
+	}
+	for i, sample := range samples {
+		stats := &info.ContainerStats{Timestamp: fakeClock.Now()}
+		stats.Cpu.Usage.Total = sample.usage
+		stats.Cpu.CFS.ThrottledTime = sample.throttled
+		mockHandler.On("GetStats").Return(stats, nil).Once()
+		require.Nil(t, cd.updateStats())
+		fakeClock.Step(time.Second)
+
+		var empty time.Time
+		latest, err := memoryCache.RecentStats(containerName, empty, empty, 1)
+		require.Nil(t, err)
+		require.Len(t, latest, 1)
+		assert.Equal(t, sample.expected, latest[0].Cpu.CFS.ThrottledFraction, "sample %d", i)
+	}
+}
+
+func TestUpdateStatsWarmup(t *testing.T) {
+	// Half a core allocated by the CFS quota.
+	cd, mockHandler, memoryCache, fakeClock := setupContainerData(t, info.ContainerSpec{
+		HasCpu: true,
+		Cpu:    info.CpuSpec{Quota: 50000, Period: 100000},
+	})
+	require.Nil(t, cd.updateSpec())
+	cd.warmupSamples = 2
+	samples := []struct {
+		usage     uint64
+		warmingUp bool
+		expected  float64
+	}{
+		// A partial first read.
+		{usage: 1000, warmingUp: true, expected: 0},
+		// The spike from the partial read is suppressed.
+		{usage: 1000000000, warmingUp: true, expected: 0},
+		// 250ms used over 1s out of 0.5 core.
+		{usage: 1250000000, warmingUp: false, expected: 0.5},
+		{usage: 1500000000, warmingUp: false, expected: 0.5},
+	}
+	for i, sample := range samples {
+		stats := &info.ContainerStats{Timestamp: fakeClock.Now()}
+		stats.Cpu.Usage.Total = sample.usage
+		mockHandler.On("GetStats").Return(stats, nil).Once()
+		require.Nil(t, cd.updateStats())
+		fakeClock.Step(time.Second)
+
+		var empty time.Time
+		latest, err := memoryCache.RecentStats(containerName, empty, empty, 1)
+		require.Nil(t, err)
+		require.Len(t, latest, 1)
+		assert.Equal(t, sample.warmingUp, latest[0].WarmingUp, "sample %d", i)
+		assert.Equal(t, sample.expected, latest[0].Cpu.LimitUtilization, "sample %d", i)
+		// Cumulative counters are still reported.
+		assert.Equal(t, sample.usage, latest[0].Cpu.Usage.Total, "sample %d", i)
+	}
+}
+
+func TestUpdateStatsCpuLimitUtilization(t *testing.T) {
+	// Half a core allocated by the CFS quota.
+	cd, mockHandler, memoryCache, fakeClock := setupContainerData(t, info.ContainerSpec{
+		HasCpu: true,
+		Cpu:    info.CpuSpec{Quota: 50000, Period: 100000},
+	})
+	require.Nil(t, cd.updateSpec())
+	samples := []struct {
+		usage    uint64
+		expected float64
+	}{
+		// No previous sample.
+		{usage: 1000000000, expected: 0},
+		// 250ms used over 1s out of 0.5 core.
+		{usage: 1250000000, expected: 0.5},
+		// The whole quota used.
+		{usage: 1750000000, expected: 1},
+		// Counters reset.
+		{usage: 100, expected: 0},
+	}
+	for i, sample := range samples {
+		stats := &info.ContainerStats{Timestamp: fakeClock.Now()}
+		stats.Cpu.Usage.Total = sample.usage
+		mockHandler.On("GetStats").Return(stats, nil).Once()
+		require.Nil(t, cd.updateStats())
+		fakeClock.Step(time.Second)
+
+		var empty time.Time
+		latest, err := memoryCache.RecentStats(containerName, empty, empty, 1)
+		require.Nil(t, err)
+		require.Len(t, latest, 1)
+		assert.Equal(t, sample.expected, latest[0].Cpu.LimitUtilization, "sample %d", i)
+	}
+}
+
+func TestUpdateStatsCpuLimitUtilizationBurst(t *testing.T) {
+	// Half a core allocated by the CFS quota, with a burst of 20ms per period.
+	cd, mockHandler, memoryCache, fakeClock := setupContainerData(t, info.ContainerSpec{
+		HasCpu: true,
+		Cpu:    info.CpuSpec{Quota: 50000, Period: 100000, Burst: 20000},
+	})
+	require.Nil(t, cd.updateSpec())
+	samples := []struct {
+		usage     uint64
+		burstTime uint64
+		expected  float64
+	}{
+		// No previous sample.
+		{usage: 1000000000, expected: 0},
+		// 600ms used over 1s, 100ms of which beyond the quota.
+		{usage: 1600000000, burstTime: 100000000, expected: 1},
+		// 250ms used without burst.
+		{usage: 1850000000, burstTime: 100000000, expected: 0.5},
+		// The burst counter reset, the whole usage is counted.
+		{usage: 2450000000, expected: 1.2},
+	}
+	for i, sample := range samples {
+		stats := &info.ContainerStats{Timestamp: fakeClock.Now()}
+		stats.Cpu.Usage.Total = sample.usage
+		stats.Cpu.CFS.BurstTime = sample.burstTime
+		mockHandler.On("GetStats").Return(stats, nil).Once()
+		require.Nil(t, cd.updateStats())
+		fakeClock.Step(time.Second)
+
+		var empty time.Time
+		latest, err := memoryCache.RecentStats(containerName, empty, empty, 1)
+		require.Nil(t, err)
+		require.Len(t, latest, 1)
+		assert.InDelta(t, sample.expected, latest[0].Cpu.LimitUtilization, 1e-9, "sample %d", i)
+	}
+}
+
+func TestUpdateStatsDiskThrottleUtilization(t *testing.T) {
+	// 1MiB/s of reads and 100 writes per second allowed on 8:0, no limit on 8:16.
+	cd, mockHandler, memoryCache, fakeClock := setupContainerData(t, info.ContainerSpec{
+		HasDiskIo: true,
+		DiskIo: info.DiskIoSpec{
+			ReadBpsLimits:   []info.PerDeviceIoSpec{{Major: 8, Minor: 0, Value: 1048576}},
+			WriteIopsLimits: []info.PerDeviceIoSpec{{Major: 8, Minor: 0, Value: 100}},
+		},
+	})
+	require.Nil(t, cd.updateSpec())
+	perDisk := func(major, minor, read, write uint64) info.PerDiskStats {
+		return info.PerDiskStats{Device: "/dev/sda", Major: major, Minor: minor, Stats: map[string]uint64{"Read": read, "Write": write}}
+	}
+	samples := []struct {
+		readBytes uint64
+		writes    uint64
+		expected  []info.PerDiskUtilization
+	}{
+		// No previous sample.
+		{readBytes: 1048576, writes: 1000},
+		// 512KiB read and 25 writes over 1s.
+		{readBytes: 1572864, writes: 1025, expected: []info.PerDiskUtilization{{
+			Device: "/dev/sda", Major: 8, Minor: 0,
+			Utilization: map[string]float64{info.ReadBpsUtilization: 0.5, info.WriteIopsUtilization: 0.25},
+		}}},
+		// Counters reset.
+		{readBytes: 100, writes: 1},
+	}
+	for i, sample := range samples {
+		stats := &info.ContainerStats{Timestamp: fakeClock.Now()}
+		stats.DiskIo.IoServiceBytes = []info.PerDiskStats{perDisk(8, 0, sample.readBytes, 0), perDisk(8, 16, 4096, 4096)}
+		stats.DiskIo.IoServiced = []info.PerDiskStats{perDisk(8, 0, 0, sample.writes), perDisk(8, 16, 1, 1)}
+		mockHandler.On("GetStats").Return(stats, nil).Once()
+		require.Nil(t, cd.updateStats())
+		fakeClock.Step(time.Second)
+
+		var empty time.Time
+		latest, err := memoryCache.RecentStats(containerName, empty, empty, 1)
+		require.Nil(t, err)
+		require.Len(t, latest, 1)
+		assert.Equal(t, sample.expected, latest[0].DiskIo.ThrottleUtilization, "sample %d", i)
+	}
+}
+
+func TestCpuLimitCores(t *testing.T) {
+	assert.Equal(t, 2.5, cpuLimitCores(info.CpuSpec{Quota: 250000, Period: 100000}, 8))
+	// Without quota, the containers are limited by the cores of the machine.
+	assert.Equal(t, 8.0, cpuLimitCores(info.CpuSpec{}, 8))
+	assert.Equal(t, 8.0, cpuLimitCores(info.CpuSpec{Period: 100000}, 8))
+
+	// Without cores, the utilization is 0 rather than infinite.
+	prev := &info.CpuStats{}
+	cur := &info.ContainerStats{Timestamp: time.Unix(1, 0)}
+	cur.Cpu.Usage.Total = 1000
+	assert.Equal(t, 0.0, cpuLimitUtilization(prev, time.Unix(0, 0), cur, cpuLimitCores(info.CpuSpec{}, 0)))
+}
+
+// blockingCollector blocks in UpdateStats until unblocked.
+type blockingCollector struct {
+	stats.NoopDestroy
+	unblock chan struct{}
+}
+
+func (c *blockingCollector) UpdateStats(s *info.ContainerStats) error {
+	<-c.unblock
+	s.PerfStats = []info.PerfStat{{}}
+	return nil
+}
+
+func TestUpdateStatsTimesOut(t *testing.T) {
+	defer func(timeout time.Duration) { *collectionTimeout = timeout }(*collectionTimeout)
+	*collectionTimeout = 50 * time.Millisecond
+
+	statsList := itest.GenerateRandomStats(2, 4, 1*time.Second)
+	cd, mockHandler, memoryCache, _ := newTestContainerData(t)
+	mockHandler.On("GetStats").Return(statsList[0], nil).Once()
+	mockHandler.On("GetStats").Return(statsList[1], nil).Once()
+	collector := &blockingCollector{unblock: make(chan struct{})}
+	cd.perfCollector = collector
+	timeouts := testutil.ToFloat64(CollectionTimeouts.WithLabelValues("perf"))
+
+	// The hung collector is abandoned, the stats collected before it are stored.
+	start := time.Now()
+	err := cd.updateStats()
+	assert.True(t, errors.Is(err, errCollectionTimeout), "unexpected error: %v", err)
+	assert.True(t, time.Since(start) < 10*time.Second)
+	assert.Equal(t, timeouts+1, testutil.ToFloat64(CollectionTimeouts.WithLabelValues("perf")))
+	checkNumStats(t, memoryCache, 1)
+	stored, err := memoryCache.RecentStats(containerName, time.Time{}, time.Time{}, 1)
+	require.Nil(t, err)
+	assert.Empty(t, stored[0].PerfStats)
+	assert.True(t, stored[0].Partial)
+
+	// The container is skipped while the abandoned collector is still running.
+	err = cd.updateStats()
+	assert.True(t, errors.Is(err, errCollectionTimeout), "unexpected error: %v", err)
+	mockHandler.AssertNumberOfCalls(t, "GetStats", 1)
+
+	// Collection proceeds once it returns.
+	close(collector.unblock)
+	assert.Eventually(t, func() bool {
+		return cd.updateStats() == nil
+	}, 10*time.Second, 10*time.Millisecond)
+	mockHandler.AssertNumberOfCalls(t, "GetStats", 2)
+}
+
+func TestUpdateStatsTimesOutReadingStats(t *testing.T) {
+	defer func(timeout time.Duration) { *collectionTimeout = timeout }(*collectionTimeout)
+	*collectionTimeout = 50 * time.Millisecond
+
+	statsList := itest.GenerateRandomStats(2, 4, 1*time.Second)
+	cd, mockHandler, memoryCache, _ := newTestContainerData(t)
+	unblock := make(chan time.Time)
+	mockHandler.On("GetStats").Return(statsList[0], nil).WaitUntil(unblock).Once()
+	mockHandler.On("GetStats").Return(statsList[1], nil).Once()
+	timeouts := testutil.ToFloat64(CollectionTimeouts.WithLabelValues("stats"))
+
+	// The hung read is abandoned, without stats to store.
+	start := time.Now()
+	err := cd.updateStats()
+	assert.True(t, errors.Is(err, errCollectionTimeout), "unexpected error: %v", err)
+	assert.True(t, time.Since(start) < 10*time.Second)
+	assert.Equal(t, timeouts+1, testutil.ToFloat64(CollectionTimeouts.WithLabelValues("stats")))
+	_, err = memoryCache.RecentStats(containerName, time.Time{}, time.Time{}, -1)
+	assert.Error(t, err)
+
+	// The container is skipped while the read is still hung.
+	err = cd.updateStats()
+	assert.True(t, errors.Is(err, errCollectionTimeout), "unexpected error: %v", err)
+	mockHandler.AssertNumberOfCalls(t, "GetStats", 1)
+
+	// Collection proceeds once it returns.
+	close(unblock)
+	assert.Eventually(t, func() bool {
+		return cd.updateStats() == nil
+	}, 10*time.Second, 10*time.Millisecond)
+	mockHandler.AssertNumberOfCalls(t, "GetStats", 2)
+	checkNumStats(t, memoryCache, 1)
+}
+
+// stagedStatsHandler reads the stats of the container in stages, like the
+// runtime handlers, with getStatsContext.
+type stagedStatsHandler struct {
+	*containertest.MockContainerHandler
+	getStatsContext func(ctx context.Context) (*info.ContainerStats, error)
+}
+
+func (h *stagedStatsHandler) GetStatsContext(ctx context.Context) (*info.ContainerStats, error) {
+	return h.getStatsContext(ctx)
+}
+
+func TestUpdateStatsStoresPartialStats(t *testing.T) {
+	defer func(timeout time.Duration) { *collectionTimeout = timeout }(*collectionTimeout)
+	*collectionTimeout = 50 * time.Millisecond
+
+	statsList := itest.GenerateRandomStats(2, 4, 1*time.Second)
+	cd, mockHandler, memoryCache, _ := newTestContainerData(t)
+	hung := true
+	cd.handler = &stagedStatsHandler{
+		MockContainerHandler: mockHandler,
+		getStatsContext: func(ctx context.Context) (*info.ContainerStats, error) {
+			if !hung {
+				return statsList[1], nil
+			}
+			// The filesystem stats are given up on past the deadline.
+			<-ctx.Done()
+			return statsList[0], fmt.Errorf("reading the filesystem stats: %w", container.ErrPartialStats)
+		},
+	}
+	timeouts := testutil.ToFloat64(CollectionTimeouts.WithLabelValues("stats"))
+
+	// The stats read before the deadline are stored, marked partial.
+	err := cd.updateStats()
+	assert.True(t, errors.Is(err, errCollectionTimeout), "unexpected error: %v", err)
+	assert.Equal(t, timeouts+1, testutil.ToFloat64(CollectionTimeouts.WithLabelValues("stats")))
+	stored, err := memoryCache.RecentStats(containerName, time.Time{}, time.Time{}, -1)
+	require.Nil(t, err)
+	require.Len(t, stored, 1)
+	assert.True(t, stored[0].Partial)
+
+	// The handler skips the hung subsystem itself, so the container is
+	// collected again right away.
+	hung = false
+	require.Nil(t, cd.updateStats())
+	stored, err = memoryCache.RecentStats(containerName, time.Time{}, time.Time{}, 1)
+	require.Nil(t, err)
+	require.Len(t, stored, 1)
+	assert.Equal(t, statsList[1].Timestamp, stored[0].Timestamp)
+	assert.False(t, stored[0].Partial)
+}
+
 func TestUpdateSpec(t *testing.T) {
 	spec := itest.GenerateRandomContainerSpec(4)
 	cd, mockHandler, _, _ := newTestContainerData(t)
@@ -180,6 +619,7 @@ func TestGetInfo(t *testing.T) {
 		subcontainers,
 		nil,
 	)
+	mockHandler.On("GetCgroupPath", mock.Anything).Return("", fmt.Errorf("no cgroup"))
 	mockHandler.Aliases = []string{"a1", "a2"}
 
 	info, err := cd.GetInfo(true)
@@ -214,6 +654,95 @@ func TestGetInfo(t *testing.T) {
 	}
 }
 
+func TestGetInfoCgroupId(t *testing.T) {
+	cgroupPath, err := ioutil.TempDir("", "memory")
+	require.Nil(t, err)
+	defer os.RemoveAll(cgroupPath)
+	fi, err := os.Stat(cgroupPath)
+	require.Nil(t, err)
+	inode := fi.Sys().(*syscall.Stat_t).Ino
+
+	cd, mockHandler, _, _ := newTestContainerData(t)
+	mockHandler.On("GetCgroupPath", "memory").Return(cgroupPath, nil)
+	mockHandler.On("GetCgroupPath", mock.Anything).Return("", fmt.Errorf("no cgroup"))
+
+	info, err := cd.GetInfo(false)
+	require.Nil(t, err)
+	assert.Equal(t, inode, info.CgroupId)
+
+	// The id is looked up only once.
+	require.Nil(t, os.RemoveAll(cgroupPath))
+	info, err = cd.GetInfo(false)
+	require.Nil(t, err)
+	assert.Equal(t, inode, info.CgroupId)
+}
+
+func TestGetInfoThrottlesSpecReads(t *testing.T) {
+	cgroupPath, err := ioutil.TempDir("", "memory")
+	require.Nil(t, err)
+	defer os.RemoveAll(cgroupPath)
+	limitFile := filepath.Join(cgroupPath, "memory.max")
+	require.Nil(t, ioutil.WriteFile(limitFile, []byte("max\n"), 0644))
+
+	cd, mockHandler, _, fakeClock := newTestContainerData(t)
+	mockHandler.On("GetCgroupPath", mock.Anything).Return(cgroupPath, nil)
+	mockHandler.On("GetStats").Return(itest.GenerateRandomStats(1, 4, 1*time.Second)[0], nil)
+	// The spec was read once when creating the container data.
+	mockHandler.AssertNumberOfCalls(t, "GetSpec", 1)
+
+	housekeeping := func() {
+		timer := make(chan time.Time, 1)
+		timer <- fakeClock.Now()
+		require.True(t, cd.housekeepingTick(timer, testLongHousekeeping))
+	}
+
+	for i := 0; i < 5; i++ {
+		_, err := cd.GetInfo(false)
+		require.Nil(t, err)
+		housekeeping()
+		fakeClock.Step(time.Second)
+	}
+	// Only the first request re-read the spec, the stats were read each time.
+	mockHandler.AssertNumberOfCalls(t, "GetSpec", 2)
+	mockHandler.AssertNumberOfCalls(t, "GetStats", 5)
+
+	// Past the refresh interval, the spec is read again.
+	fakeClock.Step(*specRefreshInterval)
+	_, err = cd.GetInfo(false)
+	require.Nil(t, err)
+	mockHandler.AssertNumberOfCalls(t, "GetSpec", 3)
+
+	// Requests don't look at the limits, the next housekeeping re-reads the
+	// spec as soon as a limit is updated.
+	require.Nil(t, ioutil.WriteFile(limitFile, []byte("1073741824\n"), 0644))
+	_, err = cd.GetInfo(false)
+	require.Nil(t, err)
+	mockHandler.AssertNumberOfCalls(t, "GetSpec", 3)
+	housekeeping()
+	mockHandler.AssertNumberOfCalls(t, "GetSpec", 4)
+	housekeeping()
+	mockHandler.AssertNumberOfCalls(t, "GetSpec", 4)
+}
+
+func TestCgroupDepth(t *testing.T) {
+	for name, depth := range map[string]int{
+		"/":                            0,
+		"/system.slice":                1,
+		"/system.slice/docker.service": 2,
+		"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod6a3c1e2f.slice":                                                3,
+		"/kubepods/burstable/pod6a3c1e2f-4d5b-4c8e-9f0a-1b2c3d4e5f60/40af7cdcbe507acad47a5a62025743ad3ddc6ab93b77b21363aa1c1d641047c9": 4,
+		"/system.slice/": 1,
+	} {
+		assert.Equal(t, depth, cgroupDepth(name), name)
+	}
+
+	cd, mockHandler, _, _ := newTestContainerData(t)
+	mockHandler.On("GetCgroupPath", mock.Anything).Return("", fmt.Errorf("no cgroup"))
+	info, err := cd.GetInfo(false)
+	require.Nil(t, err)
+	assert.Equal(t, 1, info.Depth)
+}
+
 func TestUpdateNvidiaStats(t *testing.T) {
 	cd, _, _, _ := newTestContainerData(t)
 	stats := info.ContainerStats{}
@@ -239,6 +768,7 @@ func TestOnDemandHousekeeping(t *testing.T) {
 
 	cd, mockHandler, memoryCache, fakeClock := newTestContainerData(t)
 	mockHandler.On("GetStats").Return(stats, nil)
+	mockHandler.On("GetCgroupPath", mock.Anything).Return("", fmt.Errorf("no cgroup"))
 	defer func() {
 		err := cd.Stop()
 		assert.NoError(t, err)
@@ -266,6 +796,7 @@ func TestConcurrentOnDemandHousekeeping(t *testing.T) {
 
 	cd, mockHandler, memoryCache, fakeClock := newTestContainerData(t)
 	mockHandler.On("GetStats").Return(stats, nil)
+	mockHandler.On("GetCgroupPath", mock.Anything).Return("", fmt.Errorf("no cgroup"))
 	defer func() {
 		err := cd.Stop()
 		assert.NoError(t, err)
@@ -302,6 +833,7 @@ func TestOnDemandHousekeepingReturnsAfterStopped(t *testing.T) {
 
 	cd, mockHandler, memoryCache, fakeClock := newTestContainerData(t)
 	mockHandler.On("GetStats").Return(stats, nil)
+	mockHandler.On("GetCgroupPath", mock.Anything).Return("", fmt.Errorf("no cgroup"))
 
 	// trigger housekeeping update
 	go cd.OnDemandHousekeeping(0 * time.Second)
@@ -328,6 +860,7 @@ func TestOnDemandHousekeepingRace(t *testing.T) {
 
 	cd, mockHandler, _, _ := newTestContainerData(t)
 	mockHandler.On("GetStats").Return(stats, nil)
+	mockHandler.On("GetCgroupPath", mock.Anything).Return("", fmt.Errorf("no cgroup"))
 
 	wg := sync.WaitGroup{}
 	wg.Add(1002)
@@ -557,3 +1090,169 @@ func TestGetCgroupPath(t *testing.T) {
 		})
 	}
 }
+
+func TestCollectionExemplar(t *testing.T) {
+	assert.Equal(t, prometheus.Labels{"container": "abc"}, collectionExemplar("/docker/abc"))
+
+	// Long container names are truncated to fit in an exemplar.
+	id := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	labels := collectionExemplar("/kubepods/burstable/pod1234/" + id)
+	assert.Equal(t, id[:prometheus.ExemplarMaxRunes-len("container")], labels["container"])
+}
+
+func TestDeterministicHousekeepingJitter(t *testing.T) {
+	originalHostname := hostname
+	defer func() {
+		hostname = originalHostname
+	}()
+	hostname = func() (string, error) {
+		return "node-1", nil
+	}
+
+	const interval = 10 * time.Second
+	fakeClock := clock.NewFakeClock(time.Unix(1600000000, 123456789))
+	offsets := make(map[time.Duration]struct{})
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("/docker/container-%d", i)
+		cd := &containerData{clock: fakeClock, housekeepingPhase: housekeepingPhase(name)}
+		assert.Equal(t, cd.housekeepingPhase, housekeepingPhase(name))
+
+		// Housekeepings happen at a stable interval, whatever the duration of
+		// the collections.
+		var last time.Time
+		for j := 0; j < 5; j++ {
+			wait := cd.deterministicJitter(interval, 1.0)
+			assert.True(t, wait > 0 && wait <= interval, "unexpected wait %v", wait)
+			fakeClock.Step(wait)
+			if !last.IsZero() {
+				assert.Equal(t, interval, fakeClock.Now().Sub(last))
+			}
+			last = fakeClock.Now()
+			fakeClock.Step(time.Duration(j*100) * time.Millisecond)
+		}
+		offsets[time.Duration(last.UnixNano())%interval] = struct{}{}
+	}
+	// The housekeepings of the containers are spread over the interval.
+	assert.Len(t, offsets, 20)
+	var min, max time.Duration = interval, 0
+	for offset := range offsets {
+		if offset < min {
+			min = offset
+		}
+		if offset > max {
+			max = offset
+		}
+	}
+	assert.True(t, max-min > interval/2, "housekeepings spread over %v only", max-min)
+
+	// Containers of the same name on different hosts are offset differently.
+	phase := housekeepingPhase("/docker/container-0")
+	hostname = func() (string, error) {
+		return "node-2", nil
+	}
+	assert.NotEqual(t, phase, housekeepingPhase("/docker/container-0"))
+}
+
+func TestNextHousekeepingIntervalWithoutJitter(t *testing.T) {
+	originalJitter := *housekeepingJitter
+	defer func() {
+		*housekeepingJitter = originalJitter
+	}()
+	*housekeepingJitter = 0
+
+	cd, _, _, _ := newTestContainerData(t)
+	cd.allowDynamicHousekeeping = false
+	assert.Equal(t, *HousekeepingInterval, cd.nextHousekeepingInterval())
+}
+
+func TestCounterResetEvents(t *testing.T) {
+	cd, mockHandler, _, _ := newTestContainerData(t)
+	cd.eventHandler = events.NewEventManager(events.DefaultStoragePolicy())
+
+	newStats := func(cpu, rx uint64) *info.ContainerStats {
+		stats := &info.ContainerStats{Timestamp: time.Now()}
+		stats.Cpu.Usage.Total = cpu
+		stats.Network.RxBytes = rx
+		return stats
+	}
+	for _, stats := range []*info.ContainerStats{
+		newStats(1000, math.MaxUint32-100),
+		// The rx bytes of a 32 bits counter wrap around.
+		newStats(2000, 200),
+		// The cpu usage is reset by a restart of the container.
+		newStats(300, 400),
+		// Missing counters aren't resets.
+		newStats(400, 0),
+		// The cpu usage is a 64 bits counter, which doesn't wrap around.
+		newStats(math.MaxUint64-10, 500),
+		newStats(5, 600),
+	} {
+		mockHandler.On("GetStats").Return(stats, nil).Once()
+		require.Nil(t, cd.updateStats())
+	}
+
+	request := events.NewRequest()
+	request.EventType[info.EventCounterReset] = true
+	request.ContainerName = containerName
+	resets, err := cd.eventHandler.GetEvents(request)
+	require.Nil(t, err)
+	require.Len(t, resets, 2)
+	assert.Equal(t, containerName, resets[0].ContainerName)
+	assert.Equal(t, &info.CounterResetEventData{
+		Counter:  "cpu_usage_total",
+		Previous: 2000,
+		Current:  300,
+	}, resets[0].EventData.CounterReset)
+	assert.Equal(t, &info.CounterResetEventData{
+		Counter:  "cpu_usage_total",
+		Previous: math.MaxUint64 - 10,
+		Current:  5,
+	}, resets[1].EventData.CounterReset)
+}
+
+func TestCpusetChangeEvents(t *testing.T) {
+	cd, mockHandler, _, _ := newTestContainerData(t)
+	cd.eventHandler = events.NewEventManager(events.DefaultStoragePolicy())
+
+	for _, cpus := range []string{"0-3", "0-3", "", "4-7"} {
+		stats := &info.ContainerStats{Timestamp: time.Now()}
+		stats.CpuSet.Cpus = cpus
+		mockHandler.On("GetStats").Return(stats, nil).Once()
+		require.Nil(t, cd.updateStats())
+	}
+
+	request := events.NewRequest()
+	request.EventType[info.EventCpusetChange] = true
+	request.ContainerName = containerName
+	changes, err := cd.eventHandler.GetEvents(request)
+	require.Nil(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, &info.CpusetChangeEventData{
+		Previous: "0-3",
+		Current:  "4-7",
+	}, changes[0].EventData.CpusetChange)
+}
+
+func TestCounterWrapped(t *testing.T) {
+	assert.True(t, counterWrapped(math.MaxUint32-10, 5))
+	assert.False(t, counterWrapped(math.MaxUint64-10, 5))
+	assert.False(t, counterWrapped(1<<20, 5))
+	assert.False(t, counterWrapped(math.MaxUint32-10, 1<<31))
+}
+
+func TestDelaysCache(t *testing.T) {
+	var cache delaysCache
+	assert.Equal(t, info.DelayStats{BlkioDelay: 30, SwapinDelay: 3}, cache.update(map[int]info.DelayStats{
+		1: {BlkioDelay: 10, SwapinDelay: 1},
+		2: {BlkioDelay: 20, SwapinDelay: 2},
+	}))
+	// The delays of process 2, which exited, are kept, and process 1 reusing
+	// a pid after exiting is a new process.
+	assert.Equal(t, info.DelayStats{BlkioDelay: 35, SwapinDelay: 3}, cache.update(map[int]info.DelayStats{
+		1: {BlkioDelay: 5},
+	}))
+	assert.Equal(t, info.DelayStats{BlkioDelay: 37, SwapinDelay: 3, FreepagesDelay: 4}, cache.update(map[int]info.DelayStats{
+		1: {BlkioDelay: 7},
+		3: {FreepagesDelay: 4},
+	}))
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"math"
+
+	info "github.com/google/cadvisor/info/v1"
+
+	"k8s.io/klog/v2"
+)
+
+// resettableCounters are the cumulative counters of the containers whose
+// resets are reported as events, e.g. when the container restarted within the
+// same cgroup. The network counters may be 32 bits counters, as some network
+// drivers report them on 32 bits, and wrap around; the other ones are 64 bits
+// counters, which never do in practice.
+var resettableCounters = []struct {
+	name    string
+	value   func(*info.ContainerStats) uint64
+	wraps32 bool
+}{
+	{"cpu_usage_total", func(s *info.ContainerStats) uint64 { return s.Cpu.Usage.Total }, false},
+	{"network_rx_bytes", func(s *info.ContainerStats) uint64 { return s.Network.RxBytes }, true},
+	{"network_tx_bytes", func(s *info.ContainerStats) uint64 { return s.Network.TxBytes }, true},
+}
+
+// counterWrapped returns whether a 32 bits counter decreasing from previous to
+// current wrapped around rather than being reset: the previous value was in
+// the upper quarter of the range of the counter and the current one is in its
+// lower quarter.
+func counterWrapped(previous, current uint64) bool {
+	const quarter = math.MaxUint32/4 + 1
+	return previous <= math.MaxUint32 && previous >= math.MaxUint32-quarter+1 && current < quarter
+}
+
+// detectCounterResets adds an event for each cumulative counter of the stats
+// lower than in the previous stats of the container, unless it is a 32 bits
+// counter which wrapped around.
+// Counters at zero are ignored, as they are usually missing rather than reset.
+func (cd *containerData) detectCounterResets(stats *info.ContainerStats) {
+	previous := cd.lastCounters
+	cd.lastCounters = make([]uint64, len(resettableCounters))
+	for i, counter := range resettableCounters {
+		cd.lastCounters[i] = counter.value(stats)
+	}
+	if previous == nil || cd.eventHandler == nil {
+		return
+	}
+	for i, counter := range resettableCounters {
+		current := cd.lastCounters[i]
+		if current == 0 || current >= previous[i] {
+			continue
+		}
+		if counter.wraps32 && counterWrapped(previous[i], current) {
+			klog.V(4).Infof("Counter %s of container %q wrapped around from %d to %d", counter.name, cd.info.Name, previous[i], current)
+			continue
+		}
+		klog.V(3).Infof("Counter %s of container %q was reset from %d to %d", counter.name, cd.info.Name, previous[i], current)
+		err := cd.eventHandler.AddEvent(&info.Event{
+			ContainerName: cd.info.Name,
+			Timestamp:     stats.Timestamp,
+			EventType:     info.EventCounterReset,
+			EventData: info.EventData{
+				CounterReset: &info.CounterResetEventData{
+					Counter:  counter.name,
+					Previous: previous[i],
+					Current:  current,
+				},
+			},
+		})
+		if err != nil {
+			klog.Errorf("Failed to add counter reset event for container %q: %v", cd.info.Name, err)
+		}
+	}
+}
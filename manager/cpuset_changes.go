@@ -0,0 +1,52 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	info "github.com/google/cadvisor/info/v1"
+
+	"k8s.io/klog/v2"
+)
+
+// detectCpusetChange adds an event when the CPUs of the container differ from
+// the ones of its previous stats, e.g. when its workload was repinned. Stats
+// without CPUs, such as those of containers without cpuset controller, are
+// ignored.
+func (cd *containerData) detectCpusetChange(stats *info.ContainerStats) {
+	current := stats.CpuSet.Cpus
+	if current == "" {
+		return
+	}
+	previous := cd.lastCpusetCpus
+	cd.lastCpusetCpus = current
+	if previous == "" || previous == current || cd.eventHandler == nil {
+		return
+	}
+	klog.V(3).Infof("CPUs of container %q changed from %s to %s", cd.info.Name, previous, current)
+	err := cd.eventHandler.AddEvent(&info.Event{
+		ContainerName: cd.info.Name,
+		Timestamp:     stats.Timestamp,
+		EventType:     info.EventCpusetChange,
+		EventData: info.EventData{
+			CpusetChange: &info.CpusetChangeEventData{
+				Previous: previous,
+				Current:  current,
+			},
+		},
+	})
+	if err != nil {
+		klog.Errorf("Failed to add cpuset change event for container %q: %v", cd.info.Name, err)
+	}
+}
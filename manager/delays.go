@@ -0,0 +1,52 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// delaysCache keeps the delays of the processes which exited, so that the
+// delays of a container don't decrease when its processes exit.
+type delaysCache struct {
+	// Delays of the processes seen last time, by pid.
+	processes map[int]info.DelayStats
+	// Sum of the delays of the processes which exited.
+	exited info.DelayStats
+}
+
+func addDelays(sum *info.DelayStats, delays info.DelayStats) {
+	sum.BlkioDelay += delays.BlkioDelay
+	sum.SwapinDelay += delays.SwapinDelay
+	sum.FreepagesDelay += delays.FreepagesDelay
+}
+
+// update replaces the delays of the processes by the current ones, and returns
+// the delays of the container, including the processes which exited.
+func (c *delaysCache) update(processes map[int]info.DelayStats) info.DelayStats {
+	for pid, last := range c.processes {
+		current, ok := processes[pid]
+		// A process whose delays went down is a new process reusing the pid.
+		if !ok || current.BlkioDelay < last.BlkioDelay || current.SwapinDelay < last.SwapinDelay || current.FreepagesDelay < last.FreepagesDelay {
+			addDelays(&c.exited, last)
+		}
+	}
+	c.processes = processes
+	total := c.exited
+	for _, delays := range processes {
+		addDelays(&total, delays)
+	}
+	return total
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	v2 "github.com/google/cadvisor/info/v2"
+	"github.com/google/cadvisor/utils/diskstats"
+)
+
+// Powers of 2 from 0.1ms to 13s.
+const defaultDiskLatencyBuckets = "0.0001,0.0002,0.0004,0.0008,0.0016,0.0032,0.0064,0.0128,0.0256,0.0512,0.1024,0.2048,0.4096,0.8192,1.6384,3.2768,6.5536,13.1072"
+
+var diskLatencyBuckets = flag.String("disk_latency_buckets", defaultDiskLatencyBuckets, "Comma separated list of the upper bounds in seconds of the buckets of the machine_disk_io_latency_seconds histogram of the latency of the block devices of the machine, in increasing order. Defaults to powers of 2 from 0.1ms to 13s.")
+
+// Path of the diskstats file.
+// This is defined as a variable to help in testing.
+var diskStatsPath = "/proc/diskstats"
+
+// parseDiskLatencyBuckets parses a comma separated list of strictly increasing
+// positive bucket upper bounds in seconds.
+func parseDiskLatencyBuckets(value string) ([]float64, error) {
+	var upperBounds []float64
+	for _, field := range strings.Split(value, ",") {
+		upperBound, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid disk latency bucket %q: %v", field, err)
+		}
+		// The +Inf bucket is implicit.
+		if upperBound <= 0 || math.IsInf(upperBound, 0) || math.IsNaN(upperBound) {
+			return nil, fmt.Errorf("disk latency buckets must be positive and finite, got %v", upperBound)
+		}
+		if len(upperBounds) > 0 && upperBound <= upperBounds[len(upperBounds)-1] {
+			return nil, fmt.Errorf("disk latency buckets must be in increasing order, got %v after %v", upperBound, upperBounds[len(upperBounds)-1])
+		}
+		upperBounds = append(upperBounds, upperBound)
+	}
+	return upperBounds, nil
+}
+
+// updateNodeDiskStats reads a new snapshot of the stats of the block devices of
+// the machine and computes their utilization since the previous one.
+func (m *manager) updateNodeDiskStats() error {
+	// Partitions are not listed in the disk map of the machine, skip them to
+	// not account for their IO twice.
+	wholeDevices := map[string]struct{}{}
+	m.machineMu.RLock()
+	for _, disk := range m.machineInfo.DiskMap {
+		wholeDevices[disk.Name] = struct{}{}
+	}
+	m.machineMu.RUnlock()
+
+	snapshot, err := diskstats.Read(diskStatsPath, wholeDevices)
+	if err != nil {
+		return err
+	}
+
+	m.nodeDiskStatsMu.Lock()
+	defer m.nodeDiskStatsMu.Unlock()
+	if !m.lastDiskStats.Timestamp.IsZero() {
+		m.nodeDiskStats = diskstats.Utilization(m.lastDiskStats, snapshot)
+		if m.nodeDiskLatency == nil {
+			m.nodeDiskLatency = map[string]*v2.NodeDiskLatency{}
+		}
+		for _, stats := range m.nodeDiskStats {
+			latency, ok := m.nodeDiskLatency[stats.Device]
+			if !ok {
+				latency = diskstats.NewLatency(stats.Device, m.diskLatencyBuckets)
+				m.nodeDiskLatency[stats.Device] = latency
+			}
+			diskstats.ObserveLatency(latency, stats)
+		}
+	}
+	m.lastDiskStats = snapshot
+	return nil
+}
+
+// GetNodeDiskStats returns the utilization of the block devices of the
+// machine over the last global housekeeping interval.
+func (m *manager) GetNodeDiskStats() ([]v2.NodeDiskStats, error) {
+	m.nodeDiskStatsMu.RLock()
+	defer m.nodeDiskStatsMu.RUnlock()
+	return m.nodeDiskStats, nil
+}
+
+// GetNodeDiskLatency returns the histograms of the time spent by the requests
+// of the block devices of the machine since cAdvisor started.
+func (m *manager) GetNodeDiskLatency() ([]v2.NodeDiskLatency, error) {
+	m.nodeDiskStatsMu.RLock()
+	defer m.nodeDiskStatsMu.RUnlock()
+	result := make([]v2.NodeDiskLatency, 0, len(m.nodeDiskLatency))
+	for _, latency := range m.nodeDiskLatency {
+		latencyCopy := *latency
+		latencyCopy.Buckets = append([]v2.HistogramBucket(nil), latency.Buckets...)
+		result = append(result, latencyCopy)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Device < result[j].Device
+	})
+	return result, nil
+}
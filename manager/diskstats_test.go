@@ -0,0 +1,93 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	v2 "github.com/google/cadvisor/info/v2"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateNodeDiskStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskstats")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	oldDiskStatsPath := diskStatsPath
+	diskStatsPath = filepath.Join(dir, "diskstats")
+	defer func() { diskStatsPath = oldDiskStatsPath }()
+
+	m := &manager{
+		machineInfo: info.MachineInfo{
+			DiskMap: map[string]info.DiskInfo{"8:0": {Name: "sda", Major: 8, Minor: 0}},
+		},
+		diskLatencyBuckets: []float64{0.001, 0.005, 0.01},
+	}
+
+	require.NoError(t, ioutil.WriteFile(diskStatsPath, []byte("   8       0 sda 10 0 80 20 0 0 0 0 0 10 20\n   8       1 sda1 10 0 80 20 0 0 0 0 0 10 20\n"), 0644))
+	require.NoError(t, m.updateNodeDiskStats())
+	stats, err := m.GetNodeDiskStats()
+	assert.NoError(t, err)
+	assert.Empty(t, stats, "utilization needs two snapshots")
+
+	require.NoError(t, ioutil.WriteFile(diskStatsPath, []byte("   8       0 sda 20 0 160 60 0 0 0 0 0 30 60\n   8       1 sda1 20 0 160 60 0 0 0 0 0 30 60\n"), 0644))
+	require.NoError(t, m.updateNodeDiskStats())
+	stats, err = m.GetNodeDiskStats()
+	assert.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.Equal(t, "sda", stats[0].Device)
+	assert.Equal(t, 4*time.Millisecond, stats[0].Await)
+
+	latency, err := m.GetNodeDiskLatency()
+	assert.NoError(t, err)
+	assert.Equal(t, []v2.NodeDiskLatency{{
+		Device: "sda",
+		Count:  10,
+		Sum:    0.04,
+		Buckets: []v2.HistogramBucket{
+			{UpperBound: 0.001, Count: 0},
+			{UpperBound: 0.005, Count: 10},
+			{UpperBound: 0.01, Count: 10},
+		},
+	}}, latency)
+}
+
+func TestParseDiskLatencyBuckets(t *testing.T) {
+	buckets, err := parseDiskLatencyBuckets(defaultDiskLatencyBuckets)
+	assert.NoError(t, err)
+	assert.Len(t, buckets, 18)
+	assert.Equal(t, 0.0001, buckets[0])
+
+	buckets, err = parseDiskLatencyBuckets("0.001, 0.01,0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0.001, 0.01, 0.1}, buckets)
+
+	_, err = parseDiskLatencyBuckets("0.01,0.001")
+	assert.Error(t, err)
+	_, err = parseDiskLatencyBuckets("fast")
+	assert.Error(t, err)
+	_, err = parseDiskLatencyBuckets("0,0.001")
+	assert.Error(t, err)
+	_, err = parseDiskLatencyBuckets("0.001,+Inf")
+	assert.Error(t, err)
+}
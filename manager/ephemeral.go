@@ -0,0 +1,93 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"flag"
+	"sort"
+	"time"
+
+	v2 "github.com/google/cadvisor/info/v2"
+
+	"k8s.io/klog/v2"
+)
+
+// EphemeralContainerThreshold is the lifetime below which the containers of a
+// runtime are ephemeral: they are not exported individually but summed by
+// namespace once deleted.
+var EphemeralContainerThreshold = flag.Duration("ephemeral_container_threshold", 0, "Containers of a runtime deleted before running for this long are not exported individually by the Prometheus endpoint, but summed by Kubernetes or runtime namespace as container_ephemeral_* metrics, to bound the number of series created by short-lived containers. 0 disables.")
+
+// Label of the Kubernetes namespace of the containers of a pod.
+const kubernetesNamespaceLabel = "io.kubernetes.pod.namespace"
+
+// ephemeralNamespace returns the namespace by which the ephemeral container
+// is summed: its Kubernetes namespace, or else the namespace of its runtime.
+func ephemeralNamespace(cont *containerData) string {
+	if namespace := cont.info.Spec.Labels[kubernetesNamespaceLabel]; namespace != "" {
+		return namespace
+	}
+	if cont.info.Namespace != "" {
+		return cont.info.Namespace
+	}
+	return "unknown"
+}
+
+// recordEphemeralContainer adds the latest stats of the container being
+// deleted to the stats of its namespace if it is ephemeral.
+func (m *manager) recordEphemeralContainer(cont *containerData, now time.Time) {
+	if !v2.IsEphemeralContainer(&cont.info.Spec, m.ephemeralThreshold, now) {
+		return
+	}
+	namespace := ephemeralNamespace(cont)
+
+	m.ephemeralStatsLock.Lock()
+	defer m.ephemeralStatsLock.Unlock()
+	if m.ephemeralStats == nil {
+		m.ephemeralStats = make(map[string]*v2.EphemeralStats)
+	}
+	ephemeral, ok := m.ephemeralStats[namespace]
+	if !ok {
+		ephemeral = &v2.EphemeralStats{Namespace: namespace}
+		m.ephemeralStats[namespace] = ephemeral
+	}
+	ephemeral.Containers++
+
+	stats, err := m.memoryCache.RecentStats(cont.info.Name, time.Time{}, time.Time{}, 1)
+	if err != nil || len(stats) == 0 {
+		klog.V(4).Infof("No stats of ephemeral container %q: %v", cont.info.Name, err)
+		return
+	}
+	last := stats[0]
+	ephemeral.CpuUsageTotal += last.Cpu.Usage.Total
+	ephemeral.CpuUsageUser += last.Cpu.Usage.User
+	ephemeral.CpuUsageSystem += last.Cpu.Usage.System
+	ephemeral.NetworkRxBytes += last.Network.RxBytes
+	ephemeral.NetworkTxBytes += last.Network.TxBytes
+}
+
+// GetEphemeralStats returns the summed stats of the ephemeral containers
+// deleted since cAdvisor started, by namespace.
+func (m *manager) GetEphemeralStats() ([]v2.EphemeralStats, error) {
+	m.ephemeralStatsLock.Lock()
+	defer m.ephemeralStatsLock.Unlock()
+	result := make([]v2.EphemeralStats, 0, len(m.ephemeralStats))
+	for _, ephemeral := range m.ephemeralStats {
+		result = append(result, *ephemeral)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Namespace < result[j].Namespace
+	})
+	return result, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/cache/memory"
+	containertest "github.com/google/cadvisor/container/testing"
+	"github.com/google/cadvisor/events"
+	info "github.com/google/cadvisor/info/v1"
+	v2 "github.com/google/cadvisor/info/v2"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEphemeralContainers(t *testing.T) {
+	now := time.Now()
+	containers := map[string]struct {
+		age       time.Duration
+		image     string
+		namespace string
+		labels    map[string]string
+	}{
+		// Short-lived containers of a Kubernetes job and of docker.
+		"/kubepods/burstable/pod1/job1": {time.Second, "busybox", "containerd", map[string]string{kubernetesNamespaceLabel: "ci"}},
+		"/kubepods/burstable/pod2/job2": {10 * time.Second, "busybox", "containerd", map[string]string{kubernetesNamespaceLabel: "ci"}},
+		"/docker/build":                 {20 * time.Second, "golang", "docker", nil},
+		// Long-lived container.
+		"/docker/web": {time.Hour, "nginx", "docker", nil},
+		// Short-lived cgroup without image.
+		"/system.slice/cron.service": {time.Second, "", "", nil},
+	}
+	names := make([]string, 0, len(containers))
+	for name := range containers {
+		names = append(names, name)
+	}
+	memoryCache := memory.New(time.Minute, nil)
+	m := createManagerAndAddContainers(memoryCache, nil, names, func(h *containertest.MockContainerHandler) {}, t)
+	m.eventHandler = events.NewEventManager(events.DefaultStoragePolicy())
+	m.ephemeralThreshold = time.Minute
+
+	for name, c := range containers {
+		cont := m.containers[namespacedContainerName{Name: name}]
+		cont.info.Spec.CreationTime = now.Add(-c.age)
+		cont.info.Spec.Image = c.image
+		cont.info.Spec.Labels = c.labels
+		cont.info.Namespace = c.namespace
+
+		stats := &info.ContainerStats{Timestamp: now}
+		stats.Cpu.Usage.Total = 1000
+		stats.Cpu.Usage.User = 600
+		stats.Cpu.Usage.System = 400
+		stats.Network.RxBytes = 10
+		stats.Network.TxBytes = 20
+		require.Nil(t, memoryCache.AddStats(&info.ContainerInfo{ContainerReference: info.ContainerReference{Name: name}}, stats))
+	}
+
+	ephemeral, err := m.GetEphemeralStats()
+	require.Nil(t, err)
+	assert.Empty(t, ephemeral)
+
+	for _, name := range names {
+		require.Nil(t, m.destroyContainer(name))
+	}
+
+	ephemeral, err = m.GetEphemeralStats()
+	require.Nil(t, err)
+	assert.Equal(t, []v2.EphemeralStats{
+		{Namespace: "ci", Containers: 2, CpuUsageTotal: 2000, CpuUsageUser: 1200, CpuUsageSystem: 800, NetworkRxBytes: 20, NetworkTxBytes: 40},
+		{Namespace: "docker", Containers: 1, CpuUsageTotal: 1000, CpuUsageUser: 600, CpuUsageSystem: 400, NetworkRxBytes: 10, NetworkTxBytes: 20},
+	}, ephemeral)
+}
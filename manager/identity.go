@@ -0,0 +1,122 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+var containerIdentity = flag.String("container_identity", "id", "Key containers can be looked up by in the API, in addition to their name and aliases: id (their name, as in the id label of the metrics), name (their first alias, as in the name label of the metrics) or label:<key> (the value of their label <key>). When several containers have the same key, the one whose name sorts first is returned.")
+
+// identityNamespace is the namespace the containers are registered in under
+// the key chosen by --container_identity.
+const identityNamespace = "identity"
+
+// identityKey returns the key a container is looked up by, or an empty string
+// if it has none.
+type identityKey func(cont *containerData) string
+
+// newIdentityKey returns the key of the --container_identity strategy, or nil
+// when the containers are only looked up by their names.
+func newIdentityKey(strategy string) (identityKey, error) {
+	switch {
+	case strategy == "id":
+		return nil, nil
+	case strategy == "name":
+		return func(cont *containerData) string {
+			if len(cont.info.Aliases) == 0 {
+				return ""
+			}
+			return cont.info.Aliases[0]
+		}, nil
+	case strings.HasPrefix(strategy, "label:") && len(strategy) > len("label:"):
+		label := strings.TrimPrefix(strategy, "label:")
+		return func(cont *containerData) string {
+			cont.lock.Lock()
+			defer cont.lock.Unlock()
+			return cont.info.Spec.Labels[label]
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid container identity %q, must be id, name or label:<key>", strategy)
+}
+
+// lookupContainerLocked returns the container with the given name or, failing
+// that, identity key. The containersLock must be held.
+func (m *manager) lookupContainerLocked(name string) (*containerData, bool) {
+	if cont, ok := m.containers[namespacedContainerName{Name: name}]; ok {
+		return cont, true
+	}
+	if m.identityKey == nil {
+		return nil, false
+	}
+	cont, ok := m.containers[namespacedContainerName{Namespace: identityNamespace, Name: name}]
+	return cont, ok
+}
+
+// addIdentityLocked registers the container under its identity key. A key
+// shared by several containers is kept by the one whose name sorts first, so
+// that the container a key resolves to does not depend on the order they were
+// created in. The containersLock must be held.
+func (m *manager) addIdentityLocked(cont *containerData) {
+	if m.identityKey == nil {
+		return
+	}
+	key := m.identityKey(cont)
+	if key == "" {
+		return
+	}
+	name := namespacedContainerName{Namespace: identityNamespace, Name: key}
+	if other, ok := m.containers[name]; ok && other != cont {
+		klog.V(3).Infof("Containers %q and %q have the same identity %q", other.info.Name, cont.info.Name, key)
+		if other.info.Name < cont.info.Name {
+			return
+		}
+	}
+	m.containers[name] = cont
+}
+
+// removeIdentityLocked unregisters the container from its identity key, which
+// then resolves to the other container with the same key whose name sorts
+// first, if any. The containersLock must be held.
+func (m *manager) removeIdentityLocked(cont *containerData) {
+	if m.identityKey == nil {
+		return
+	}
+	var key string
+	for name, c := range m.containers {
+		if name.Namespace == identityNamespace && c == cont {
+			key = name.Name
+			delete(m.containers, name)
+			break
+		}
+	}
+	if key == "" {
+		return
+	}
+	var others []*containerData
+	for name, c := range m.containers {
+		// Only consider the canonical names.
+		if name.Namespace == "" && c != cont && m.identityKey(c) == key {
+			others = append(others, c)
+		}
+	}
+	for _, other := range others {
+		m.addIdentityLocked(other)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"fmt"
+	"strings"
+)
+
+// labelRequirement is a requirement of a label selector on a label of the
+// containers.
+type labelRequirement struct {
+	key string
+	// Whether the label must be set, or unset for a requirement without value.
+	exists bool
+	// Value the label must have, or not have if exists is false.
+	value    string
+	hasValue bool
+}
+
+// labelSelector selects the containers whose labels meet all its
+// requirements.
+type labelSelector []labelRequirement
+
+// parseLabelSelector parses a comma separated list of requirements of the
+// form key=value, key==value, key!=value, key or !key.
+func parseLabelSelector(selector string) (labelSelector, error) {
+	var requirements labelSelector
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+		var r labelRequirement
+		switch {
+		case strings.Contains(term, "!="):
+			parts := strings.SplitN(term, "!=", 2)
+			r = labelRequirement{key: parts[0], value: parts[1], hasValue: true}
+		case strings.Contains(term, "="):
+			parts := strings.SplitN(strings.Replace(term, "==", "=", 1), "=", 2)
+			r = labelRequirement{key: parts[0], exists: true, value: parts[1], hasValue: true}
+		case strings.HasPrefix(term, "!"):
+			r = labelRequirement{key: strings.TrimPrefix(term, "!")}
+		default:
+			r = labelRequirement{key: term, exists: true}
+		}
+		r.key = strings.TrimSpace(r.key)
+		r.value = strings.TrimSpace(r.value)
+		if r.key == "" || strings.ContainsAny(r.key, "!=") || strings.ContainsAny(r.value, "!=") {
+			return nil, fmt.Errorf("invalid label selector %q: invalid requirement %q", selector, term)
+		}
+		requirements = append(requirements, r)
+	}
+	return requirements, nil
+}
+
+// matches returns whether the labels meet all the requirements of the
+// selector.
+func (s labelSelector) matches(labels map[string]string) bool {
+	for _, r := range s {
+		value, ok := labels[r.key]
+		switch {
+		case r.hasValue && r.exists:
+			if !ok || value != r.value {
+				return false
+			}
+		case r.hasValue:
+			if ok && value == r.value {
+				return false
+			}
+		case ok != r.exists:
+			return false
+		}
+	}
+	return true
+}
@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -32,7 +33,9 @@ import (
 	"github.com/google/cadvisor/collector"
 	"github.com/google/cadvisor/container"
 	"github.com/google/cadvisor/container/docker"
+	"github.com/google/cadvisor/container/libcontainer"
 	"github.com/google/cadvisor/container/raw"
+	"github.com/google/cadvisor/container/systemd"
 	"github.com/google/cadvisor/events"
 	"github.com/google/cadvisor/fs"
 	info "github.com/google/cadvisor/info/v1"
@@ -42,6 +45,8 @@ import (
 	"github.com/google/cadvisor/perf"
 	"github.com/google/cadvisor/resctrl"
 	"github.com/google/cadvisor/stats"
+	"github.com/google/cadvisor/utils/delayacct"
+	"github.com/google/cadvisor/utils/diskstats"
 	"github.com/google/cadvisor/utils/oomparser"
 	"github.com/google/cadvisor/utils/sysfs"
 	"github.com/google/cadvisor/version"
@@ -59,6 +64,8 @@ var updateMachineInfoInterval = flag.Duration("update_machine_info_interval", 5*
 var logCadvisorUsage = flag.Bool("log_cadvisor_usage", false, "Whether to log the usage of the cAdvisor container")
 var eventStorageAgeLimit = flag.String("event_storage_age_limit", "default=24h", "Max length of time for which to store events (per type). Value is a comma separated list of key values, where the keys are event types (e.g.: creation, oom) or \"default\" and the value is a duration. Default is applied to all non-specified event types")
 var eventStorageEventLimit = flag.String("event_storage_event_limit", "default=100000", "Max number of events to store (per type). Value is a comma separated list of key values, where the keys are event types (e.g.: creation, oom) or \"default\" and the value is an integer. Default is applied to all non-specified event types")
+var eventStoragePath = flag.String("event_storage_path", "", "File in which events are persisted so that they survive restarts, subject to the same limits as the in-memory event storage. Empty disables persistence.")
+var minContainerAge = flag.Duration("min_container_age", 0, "Minimum age a container must reach after its creation event before cAdvisor starts collecting and exporting it. Containers deleted earlier are never exported. Zero disables the delay.")
 var applicationMetricsCountLimit = flag.Int("application_metrics_count_limit", 100, "Max number of application metrics to store (per container)")
 
 var HousekeepingConfigFlags = HouskeepingConfig{
@@ -142,6 +149,40 @@ type Manager interface {
 
 	// Returns debugging information. Map of lines per category.
 	DebugInfo() map[string][]string
+
+	// Get the stats of the containers of each Kubernetes pod, aggregated.
+	GetPodStats() ([]v2.PodStats, error)
+
+	// Get the summed stats of the ephemeral containers deleted since
+	// cAdvisor started, by namespace.
+	GetEphemeralStats() ([]v2.EphemeralStats, error)
+
+	// Get the utilization of the block devices of the machine over the last
+	// global housekeeping interval.
+	GetNodeDiskStats() ([]v2.NodeDiskStats, error)
+
+	// Get the histograms of the latency of the block devices of the machine
+	// since cAdvisor started.
+	GetNodeDiskLatency() ([]v2.NodeDiskLatency, error)
+
+	// Get the metrics currently collected.
+	IncludedMetrics() container.MetricSet
+
+	// Replace the metrics collected, from the next housekeeping of each
+	// container on. The specs of the containers are updated right away.
+	UpdateIncludedMetrics(includedMetrics container.MetricSet) error
+}
+
+// Metrics set up when the manager starts or a container is created, which
+// cannot be enabled or disabled at runtime.
+var restartOnlyMetrics = container.MetricSet{
+	container.AcceleratorUsageMetrics: struct{}{},
+	container.AppMetrics:              struct{}{},
+	container.CPUTopologyMetrics:      struct{}{},
+	container.DelayAccountingMetrics:  struct{}{},
+	container.DiskUsageMetrics:        struct{}{},
+	container.PerfMetrics:             struct{}{},
+	container.ResctrlMetrics:          struct{}{},
 }
 
 // Housekeeping configuration for the manager
@@ -188,6 +229,19 @@ func New(memoryCache *memory.InMemoryCache, sysfs sysfs.SysFs, houskeepingConfig
 		inHostNamespace = true
 	}
 
+	diskLatencyBuckets, err := parseDiskLatencyBuckets(*diskLatencyBuckets)
+	if err != nil {
+		return nil, err
+	}
+	normalizeName, err := newNameNormalizer(*containerNameNormalizers)
+	if err != nil {
+		return nil, err
+	}
+	identityKey, err := newIdentityKey(*containerIdentity)
+	if err != nil {
+		return nil, err
+	}
+
 	// Register for new subcontainers.
 	eventsChannel := make(chan watcher.ContainerEvent, 16)
 
@@ -207,8 +261,16 @@ func New(memoryCache *memory.InMemoryCache, sysfs sysfs.SysFs, houskeepingConfig
 		eventsChannel:                         eventsChannel,
 		collectorHTTPClient:                   collectorHTTPClient,
 		nvidiaManager:                         accelerators.NewNvidiaManager(includedMetricsSet),
+		amdManager:                            accelerators.NewAMDManager(includedMetricsSet),
+		systemdUnitReader:                     systemd.NewUnitStateReader(),
 		rawContainerCgroupPathPrefixWhiteList: rawContainerCgroupPathPrefixWhiteList,
 		containerEnvMetadataWhiteList:         containerEnvMetadataWhiteList,
+		diskLatencyBuckets:                    diskLatencyBuckets,
+		names:                                 newContainerNames(normalizeName),
+		identityKey:                           identityKey,
+		ephemeralThreshold:                    *EphemeralContainerThreshold,
+		minContainerAge:                       *minContainerAge,
+		pendingContainers:                     make(map[string]*time.Timer),
 	}
 
 	machineInfo, err := machine.Info(sysfs, fsInfo, inHostNamespace)
@@ -235,6 +297,9 @@ func New(memoryCache *memory.InMemoryCache, sysfs sysfs.SysFs, houskeepingConfig
 	klog.V(1).Infof("Version: %+v", *versionInfo)
 
 	newManager.eventHandler = events.NewEventManager(parseEventsStoragePolicy())
+	if normalizeName != nil {
+		newManager.eventHandler = exposedNameEvents{EventManager: newManager.eventHandler, names: newManager.names}
+	}
 	return newManager, nil
 }
 
@@ -263,12 +328,36 @@ type manager struct {
 	maxHousekeepingInterval  time.Duration
 	allowDynamicHousekeeping bool
 	includedMetrics          container.MetricSet
+	includedMetricsLock      sync.Mutex // serializes the updates of includedMetrics
 	containerWatchers        []watcher.ContainerWatcher
 	eventsChannel            chan watcher.ContainerEvent
 	collectorHTTPClient      *http.Client
 	nvidiaManager            stats.Manager
+	amdManager               stats.Manager
 	perfManager              stats.Manager
 	resctrlManager           resctrl.Manager
+	systemdUnitReader        *systemd.UnitStateReader
+	podCpuUsage              podCpuAccounting
+	nodeDiskStatsMu          sync.RWMutex // protects nodeDiskStats, lastDiskStats and nodeDiskLatency
+	nodeDiskStats            []v2.NodeDiskStats
+	lastDiskStats            diskstats.Snapshot
+	nodeDiskLatency          map[string]*v2.NodeDiskLatency
+	diskLatencyBuckets       []float64
+	// Names under which the containers are exposed.
+	names *containerNames
+	// Key the containers are also registered under, nil if they are only
+	// registered under their names and aliases.
+	identityKey identityKey
+	// Reader of the kernel delay accounting, nil when unavailable.
+	delayReader delayacct.DelayReader
+	// Lifetime below which deleted containers are summed as ephemeral.
+	ephemeralThreshold time.Duration
+	ephemeralStatsLock sync.Mutex
+	ephemeralStats     map[string]*v2.EphemeralStats
+	// Age a container must reach before it is created, and the timers
+	// creating the containers which have not reached it yet, by name.
+	minContainerAge   time.Duration
+	pendingContainers map[string]*time.Timer
 	// List of raw container cgroup path prefix whitelist.
 	rawContainerCgroupPathPrefixWhiteList []string
 	// List of container env prefix whitelist, the matched container envs would be collected into metrics as extra labels.
@@ -290,6 +379,15 @@ func (m *manager) Start() error {
 	}
 	m.containerWatchers = append(m.containerWatchers, rawWatcher)
 
+	if m.includedMetrics.Has(container.DelayAccountingMetrics) {
+		delayReader, err := delayacct.New()
+		if err != nil {
+			klog.Warningf("Delay accounting metrics will not be available: %v", err)
+		} else {
+			m.delayReader = delayReader
+		}
+	}
+
 	// Watch for OOMs.
 	err = m.watchForNewOoms()
 	if err != nil {
@@ -335,7 +433,14 @@ func (m *manager) Start() error {
 
 func (m *manager) Stop() error {
 	defer m.nvidiaManager.Destroy()
+	defer m.amdManager.Destroy()
+	defer m.systemdUnitReader.Close()
+	if m.delayReader != nil {
+		defer m.delayReader.Stop()
+	}
 	defer m.destroyCollectors()
+	// Run after the watchers quit so that no container becomes pending anymore.
+	defer m.stopPendingContainers()
 	// Stop and wait on all quit channels.
 	for i, c := range m.quitChannels {
 		// Send the exit signal and wait on the thread to exit (by closing the channel).
@@ -401,6 +506,12 @@ func (m *manager) globalHousekeeping(quit chan error) {
 				klog.Errorf("Failed to detect containers: %s", err)
 			}
 
+			if m.includedMetrics.Has(container.DiskIOMetrics) {
+				if err := m.updateNodeDiskStats(); err != nil {
+					klog.V(4).Infof("Failed to update node disk stats: %v", err)
+				}
+			}
+
 			// Log if housekeeping took too long.
 			duration := time.Since(start)
 			if duration >= longHousekeeping {
@@ -423,9 +534,7 @@ func (m *manager) getContainerData(containerName string) (*containerData, error)
 		defer m.containersLock.RUnlock()
 
 		// Ensure we have the container.
-		cont, ok = m.containers[namespacedContainerName{
-			Name: containerName,
-		}]
+		cont, ok = m.lookupContainerLocked(containerName)
 	}()
 	if !ok {
 		return nil, fmt.Errorf("unknown container %q", containerName)
@@ -445,7 +554,7 @@ func (m *manager) GetDerivedStats(containerName string, options v2.RequestOption
 		if err != nil {
 			errs.append(name, "DerivedStats", err)
 		}
-		stats[name] = d
+		stats[m.names.name(name)] = d
 	}
 	return stats, errs.OrNil()
 }
@@ -463,7 +572,7 @@ func (m *manager) GetContainerSpec(containerName string, options v2.RequestOptio
 			errs.append(name, "GetInfo", err)
 		}
 		spec := m.getV2Spec(cinfo)
-		specs[name] = spec
+		specs[m.names.name(name)] = spec
 	}
 	return specs, errs.OrNil()
 }
@@ -471,7 +580,8 @@ func (m *manager) GetContainerSpec(containerName string, options v2.RequestOptio
 // Get V2 container spec from v1 container info.
 func (m *manager) getV2Spec(cinfo *containerInfo) v2.ContainerSpec {
 	spec := m.getAdjustedSpec(cinfo)
-	return v2.ContainerSpecFromV1(&spec, cinfo.Aliases, cinfo.Namespace)
+	ref := m.names.reference(cinfo.ContainerReference)
+	return v2.ContainerSpecFromV1(&spec, ref.Aliases, ref.Namespace)
 }
 
 func (m *manager) getAdjustedSpec(cinfo *containerInfo) info.ContainerSpec {
@@ -508,11 +618,12 @@ func (m *manager) GetContainerInfoV2(containerName string, options v2.RequestOpt
 
 	infos := make(map[string]v2.ContainerInfo, len(containers))
 	for name, container := range containers {
+		exposedName := m.names.name(name)
 		result := v2.ContainerInfo{}
 		cinfo, err := container.GetInfo(false)
 		if err != nil {
 			errs.append(name, "GetInfo", err)
-			infos[name] = result
+			infos[exposedName] = result
 			continue
 		}
 		result.Spec = m.getV2Spec(cinfo)
@@ -520,12 +631,12 @@ func (m *manager) GetContainerInfoV2(containerName string, options v2.RequestOpt
 		stats, err := m.memoryCache.RecentStats(name, nilTime, nilTime, options.Count)
 		if err != nil {
 			errs.append(name, "RecentStats", err)
-			infos[name] = result
+			infos[exposedName] = result
 			continue
 		}
 
-		result.Stats = v2.ContainerStatsFromV1(containerName, &cinfo.Spec, stats)
-		infos[name] = result
+		result.Stats = v2.ContainerStatsFromV1(containerName, &cinfo.Spec, container.markStale(stats))
+		infos[exposedName] = result
 	}
 
 	return infos, errs.OrNil()
@@ -542,11 +653,19 @@ func (m *manager) containerDataToContainerInfo(cont *containerData, query *info.
 	if err != nil {
 		return nil, err
 	}
+	stats = cont.markStale(stats)
 
 	// Make a copy of the info for the user.
+	subcontainers := cinfo.Subcontainers
+	if m.names.enabled() {
+		subcontainers = make([]info.ContainerReference, len(cinfo.Subcontainers))
+		for i, ref := range cinfo.Subcontainers {
+			subcontainers[i] = m.names.reference(ref)
+		}
+	}
 	ret := &info.ContainerInfo{
-		ContainerReference: cinfo.ContainerReference,
-		Subcontainers:      cinfo.Subcontainers,
+		ContainerReference: m.names.reference(cinfo.ContainerReference),
+		Subcontainers:      subcontainers,
 		Spec:               m.getAdjustedSpec(cinfo),
 		Stats:              stats,
 	}
@@ -556,7 +675,7 @@ func (m *manager) containerDataToContainerInfo(cont *containerData, query *info.
 func (m *manager) getContainer(containerName string) (*containerData, error) {
 	m.containersLock.RLock()
 	defer m.containersLock.RUnlock()
-	cont, ok := m.containers[namespacedContainerName{Name: containerName}]
+	cont, ok := m.lookupContainerLocked(containerName)
 	if !ok {
 		return nil, fmt.Errorf("unknown container %q", containerName)
 	}
@@ -620,7 +739,7 @@ func (m *manager) AllDockerContainers(query *info.ContainerInfoRequest) (map[str
 			}
 			return nil, err
 		}
-		output[name] = *inf
+		output[m.names.name(name)] = *inf
 	}
 	return output, nil
 }
@@ -707,7 +826,7 @@ func (m *manager) GetRequestedContainersInfo(containerName string, options v2.Re
 			}
 			errs.append(name, "containerDataToContainerInfo", err)
 		}
-		containersMap[name] = info
+		containersMap[m.names.name(name)] = info
 	}
 	return containersMap, errs.OrNil()
 }
@@ -745,6 +864,20 @@ func (m *manager) getRequestedContainers(containerName string, options v2.Reques
 	default:
 		return containersMap, fmt.Errorf("invalid request type %q", options.IdType)
 	}
+	if options.LabelSelector != "" {
+		selector, err := parseLabelSelector(options.LabelSelector)
+		if err != nil {
+			return nil, err
+		}
+		for name, cont := range containersMap {
+			cont.lock.Lock()
+			labels := cont.info.Spec.Labels
+			cont.lock.Unlock()
+			if !selector.matches(labels) {
+				delete(containersMap, name)
+			}
+		}
+	}
 	if options.MaxAge != nil {
 		// update stats for all containers in containersMap
 		var waitGroup sync.WaitGroup
@@ -940,6 +1073,12 @@ func (m *manager) createContainerLocked(containerName string, watchSource watche
 	if err != nil {
 		return err
 	}
+	cont.eventHandler = m.eventHandler
+	cont.systemdUnitReader = m.systemdUnitReader
+	m.machineMu.RLock()
+	cont.numCores = m.machineInfo.NumCores
+	m.machineMu.RUnlock()
+	cont.delayReader = m.delayReader
 
 	if cgroups.IsCgroup2UnifiedMode() {
 		if m.includedMetrics.Has(container.PerfMetrics) {
@@ -958,6 +1097,10 @@ func (m *manager) createContainerLocked(containerName string, watchSource watche
 			if err != nil {
 				klog.V(4).Infof("GPU metrics may be unavailable/incomplete for container %s: %s", cont.info.Name, err)
 			}
+			cont.amdCollector, err = m.amdManager.GetCollector(devicesCgroupPath)
+			if err != nil {
+				klog.V(4).Infof("AMD GPU metrics may be unavailable/incomplete for container %s: %s", cont.info.Name, err)
+			}
 		}
 		if m.includedMetrics.Has(container.PerfMetrics) {
 			perfCgroupPath, err := handler.GetCgroupPath("perf_event")
@@ -997,6 +1140,8 @@ func (m *manager) createContainerLocked(containerName string, watchSource watche
 			Name:      alias,
 		}] = cont
 	}
+	m.addIdentityLocked(cont)
+	m.names.add(containerName)
 
 	klog.V(3).Infof("Added container: %q (aliases: %v, namespace: %q)", containerName, cont.info.Aliases, cont.info.Namespace)
 
@@ -1023,10 +1168,52 @@ func (m *manager) createContainerLocked(containerName string, watchSource watche
 	return cont.Start()
 }
 
+// createContainerAfterMinAge creates a container once it reaches the minimum
+// age, unless it is destroyed before.
+func (m *manager) createContainerAfterMinAge(containerName string, watchSource watcher.ContainerWatchSource) {
+	m.containersLock.Lock()
+	defer m.containersLock.Unlock()
+
+	if _, ok := m.pendingContainers[containerName]; ok {
+		return
+	}
+	m.pendingContainers[containerName] = time.AfterFunc(m.minContainerAge, func() {
+		m.containersLock.Lock()
+		defer m.containersLock.Unlock()
+
+		// The container was destroyed meanwhile.
+		if _, ok := m.pendingContainers[containerName]; !ok {
+			return
+		}
+		delete(m.pendingContainers, containerName)
+		if err := m.createContainerLocked(containerName, watchSource); err != nil {
+			klog.Warningf("Failed to create container %q: %v", containerName, err)
+		}
+	})
+}
+
+// stopPendingContainers forgets the containers waiting for the minimum age, so
+// that they are never created.
+func (m *manager) stopPendingContainers() {
+	m.containersLock.Lock()
+	defer m.containersLock.Unlock()
+
+	for containerName, timer := range m.pendingContainers {
+		timer.Stop()
+		delete(m.pendingContainers, containerName)
+	}
+}
+
 func (m *manager) destroyContainer(containerName string) error {
 	m.containersLock.Lock()
 	defer m.containersLock.Unlock()
 
+	if timer, ok := m.pendingContainers[containerName]; ok {
+		timer.Stop()
+		delete(m.pendingContainers, containerName)
+		klog.V(3).Infof("Container %q was destroyed before reaching the minimum age, not exporting it", containerName)
+		return nil
+	}
 	return m.destroyContainerLocked(containerName)
 }
 
@@ -1040,13 +1227,19 @@ func (m *manager) destroyContainerLocked(containerName string) error {
 		return nil
 	}
 
+	// Its stats are gone once stopped.
+	m.recordEphemeralContainer(cont, time.Now())
+
 	// Tell the container to stop.
 	err := cont.Stop()
 	if err != nil {
 		return err
 	}
 
-	// Remove the container from our records (and all its aliases).
+	// Remove the container from our records (and all its aliases). Its
+	// deletion event is still added under its exposed name.
+	m.removeIdentityLocked(cont)
+	defer m.names.remove(containerName)
 	delete(m.containers, namespacedName)
 	for _, alias := range cont.info.Aliases {
 		delete(m.containers, namespacedContainerName{
@@ -1106,6 +1299,11 @@ func (m *manager) getContainersDiff(containerName string) (added []info.Containe
 	// Added containers
 	for _, c := range allContainers {
 		delete(allContainersSet, c.Name)
+		// Containers which have not reached the minimum age yet are created
+		// once they do.
+		if _, pending := m.pendingContainers[c.Name]; pending {
+			continue
+		}
 		_, ok := m.containers[namespacedContainerName{
 			Name: c.Name,
 		}]
@@ -1180,7 +1378,11 @@ func (m *manager) watchForNewContainers(quit chan error) error {
 				case event.EventType == watcher.ContainerAdd:
 					switch event.WatchSource {
 					default:
-						err = m.createContainer(event.Name, event.WatchSource)
+						if m.minContainerAge > 0 {
+							m.createContainerAfterMinAge(event.Name, event.WatchSource)
+						} else {
+							err = m.createContainer(event.Name, event.WatchSource)
+						}
 					}
 				case event.EventType == watcher.ContainerDelete:
 					err = m.destroyContainer(event.Name)
@@ -1332,6 +1534,8 @@ func parseEventsStoragePolicy() events.StoragePolicy {
 		policy.PerTypeMaxNumEvents[info.EventType(items[0])] = val
 	}
 
+	policy.PersistencePath = *eventStoragePath
+
 	return policy
 }
 
@@ -1343,6 +1547,54 @@ func (m *manager) DockerInfo() (info.DockerStatus, error) {
 	return docker.Status()
 }
 
+// updateCgroupSubsystems re-derives the cgroup subsystems read for the
+// included metrics.
+// This is defined as a variable to help in testing.
+var updateCgroupSubsystems = libcontainer.UpdateCgroupSubsystems
+
+func (m *manager) IncludedMetrics() container.MetricSet {
+	return m.includedMetrics.Clone()
+}
+
+func (m *manager) UpdateIncludedMetrics(includedMetrics container.MetricSet) error {
+	m.includedMetricsLock.Lock()
+	defer m.includedMetricsLock.Unlock()
+
+	var changed []string
+	for kind := range restartOnlyMetrics {
+		if m.includedMetrics.Has(kind) != includedMetrics.Has(kind) {
+			changed = append(changed, string(kind))
+		}
+	}
+	if len(changed) > 0 {
+		sort.Strings(changed)
+		return fmt.Errorf("metrics %s cannot be enabled or disabled without a restart", strings.Join(changed, ", "))
+	}
+
+	// The subsystems are derived first, so that a failure leaves the
+	// included metrics untouched.
+	if err := updateCgroupSubsystems(includedMetrics); err != nil {
+		return fmt.Errorf("failed to get cgroup subsystems: %v", err)
+	}
+	klog.Infof("Updating enabled metrics from %s to %s", m.includedMetrics, includedMetrics)
+	m.includedMetrics.Update(includedMetrics)
+
+	// The specs tell which metrics the containers have, e.g. HasMemory, so
+	// they are re-derived rather than waiting for their periodic refresh.
+	m.containersLock.RLock()
+	conts := make(map[*containerData]struct{}, len(m.containers))
+	for _, cont := range m.containers {
+		conts[cont] = struct{}{}
+	}
+	m.containersLock.RUnlock()
+	for cont := range conts {
+		if err := cont.updateSpec(); err != nil {
+			klog.Warningf("Failed to update the spec of container %q: %v", cont.info.Name, err)
+		}
+	}
+	return nil
+}
+
 func (m *manager) DebugInfo() map[string][]string {
 	debugInfo := container.DebugInfo()
 
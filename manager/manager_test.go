@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -32,8 +33,11 @@ import (
 	itest "github.com/google/cadvisor/info/v1/test"
 	"github.com/google/cadvisor/info/v2"
 	"github.com/google/cadvisor/utils/sysfs/fakesysfs"
+	"github.com/google/cadvisor/watcher"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	clock "k8s.io/utils/clock/testing"
 
 	// install all the container runtimes included in the library version for testing.
@@ -66,6 +70,7 @@ func createManagerAndAddContainers(
 			spec,
 			nil,
 		).Once()
+		mockHandler.On("GetCgroupPath", mock.Anything).Return("", fmt.Errorf("no cgroup"))
 		cont, err := newContainerData(name, memoryCache, mockHandler, false, &collector.GenericCollectorManager{}, 60*time.Second, true, clock.NewFakeClock(time.Now()))
 		if err != nil {
 			t.Fatal(err)
@@ -125,6 +130,7 @@ func createManagerAndAddSubContainers(
 			spec,
 			nil,
 		).Once()
+		mockHandler.On("GetCgroupPath", mock.Anything).Return("", fmt.Errorf("no cgroup"))
 		mockHandler.On("ListContainers", container.ListSelf).Return(
 			subcontainerList[idx],
 			nil,
@@ -316,6 +322,7 @@ func TestGetContainerInfo(t *testing.T) {
 		handler.AssertExpectations(t)
 		returned := returnedInfos[container]
 		expected := infosMap[container]
+		expected.Depth = cgroupDepth(container)
 		if !reflect.DeepEqual(returned, expected) {
 			t.Errorf("returned unexpected info for container %v; returned %+v; expected %+v", container, returned, expected)
 		}
@@ -355,6 +362,157 @@ func TestGetContainerInfoV2(t *testing.T) {
 	}
 }
 
+func TestGetContainerInfoV2NormalizedNames(t *testing.T) {
+	containers := []string{
+		"/",
+		"/system.slice/a\\x2db.service",
+	}
+	options := v2.RequestOptions{
+		IdType:    v2.TypeName,
+		Count:     1,
+		Recursive: true,
+	}
+	query := &info.ContainerInfoRequest{
+		NumStats: 2,
+	}
+
+	m, _, _ := expectManagerWithContainersV2(containers, query, t)
+	m.names = newContainerNames(unescapeSystemdName)
+	for _, name := range containers {
+		m.names.add(name)
+	}
+
+	// The containers are requested by their original names and keyed by
+	// their exposed names.
+	infos, err := m.GetContainerInfoV2("/system.slice/a\\x2db.service", options)
+	require.NoError(t, err)
+	assert.Len(t, infos, 1)
+	assert.Contains(t, infos, "/system.slice/a-b.service")
+}
+
+func TestGetContainerInfoV2StaleStats(t *testing.T) {
+	defer func(ttl time.Duration) { *staleStatsTTL = ttl }(*staleStatsTTL)
+	*staleStatsTTL = 10 * time.Second
+
+	options := v2.RequestOptions{
+		IdType: v2.TypeName,
+		Count:  1,
+	}
+	query := &info.ContainerInfoRequest{
+		NumStats: 2,
+	}
+	m, _, _ := expectManagerWithContainersV2([]string{"/c1"}, query, t)
+	stats, err := m.memoryCache.RecentStats("/c1", time.Time{}, time.Time{}, 1)
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	failingSince := stats[0].Timestamp.Add(time.Second)
+	m.containers[namespacedContainerName{Name: "/c1"}].setFailing(failingSince, stats[0].Timestamp)
+
+	// The last stats of a failing container are marked stale, as in v1.
+	infos, err := m.GetContainerInfoV2("/c1", options)
+	require.NoError(t, err)
+	require.Len(t, infos["/c1"].Stats, 1)
+	assert.True(t, infos["/c1"].Stats[0].Stale)
+	require.NotNil(t, infos["/c1"].Stats[0].FailingSince)
+	assert.Equal(t, failingSince, *infos["/c1"].Stats[0].FailingSince)
+}
+
+func TestGetRequestedContainersLabelSelector(t *testing.T) {
+	labels := map[string]map[string]string{
+		"/":   nil,
+		"/c1": {"app": "web", "tier": "frontend"},
+		"/c2": {"app": "web", "canary": "true"},
+		"/c3": {"app": "db"},
+	}
+	containers := []string{"/", "/c1", "/c2", "/c3"}
+	m := createManagerAndAddContainers(memory.New(time.Minute, nil), &fakesysfs.FakeSysFs{}, containers, func(*containertest.MockContainerHandler) {}, t)
+	for name, cont := range m.containers {
+		cont.info.Spec.Labels = labels[name.Name]
+	}
+
+	for selector, expected := range map[string][]string{
+		"":                 {"/", "/c1", "/c2", "/c3"},
+		"app=web":          {"/c1", "/c2"},
+		"app==web,!canary": {"/c1"},
+		"app!=web":         {"/", "/c3"},
+		"canary":           {"/c2"},
+		"unknown=label":    {},
+	} {
+		conts, err := m.getRequestedContainers("/", v2.RequestOptions{
+			IdType:        v2.TypeName,
+			Recursive:     true,
+			LabelSelector: selector,
+		})
+		require.NoError(t, err, selector)
+		names := []string{}
+		for name := range conts {
+			names = append(names, name)
+		}
+		assert.ElementsMatch(t, expected, names, selector)
+	}
+
+	for _, selector := range []string{",", "app=web,", "=web", "app=a=b", "!"} {
+		_, err := m.getRequestedContainers("/", v2.RequestOptions{
+			IdType:        v2.TypeName,
+			Recursive:     true,
+			LabelSelector: selector,
+		})
+		assert.Error(t, err, selector)
+	}
+}
+
+func TestContainerIdentityByName(t *testing.T) {
+	identityKey, err := newIdentityKey("name")
+	require.NoError(t, err)
+	m := &manager{
+		containers:  make(map[namespacedContainerName]*containerData),
+		memoryCache: memory.New(time.Minute, nil),
+		identityKey: identityKey,
+	}
+	add := func(name string, aliases ...string) *containerData {
+		mockHandler := containertest.NewMockContainerHandler(name)
+		mockHandler.Aliases = aliases
+		mockHandler.On("GetSpec").Return(info.ContainerSpec{}, nil)
+		cont, err := newContainerData(name, m.memoryCache, mockHandler, false, &collector.GenericCollectorManager{}, time.Minute, false, clock.NewFakeClock(time.Now()))
+		require.NoError(t, err)
+		m.containers[namespacedContainerName{Name: name}] = cont
+		m.addIdentityLocked(cont)
+		return cont
+	}
+	web := add("/docker/b2c4", "web", "b2c4")
+	db := add("/docker/d8e1", "db", "d8e1")
+	// Containers without alias are only looked up by their names.
+	add("/system.slice/docker.service")
+	// The container whose name sorts first keeps a shared key.
+	dup := add("/docker/a17f", "web", "a17f")
+
+	for key, expected := range map[string]*containerData{
+		"web":          dup,
+		"db":           db,
+		"/docker/b2c4": web,
+	} {
+		cont, err := m.getContainer(key)
+		require.NoError(t, err, key)
+		assert.Equal(t, expected, cont, key)
+	}
+	_, err = m.getContainer("b2c4")
+	assert.Error(t, err)
+
+	// Once the container holding a shared key is gone, the key resolves to
+	// the other one.
+	m.removeIdentityLocked(dup)
+	delete(m.containers, namespacedContainerName{Name: "/docker/a17f"})
+	cont, err := m.getContainerData("web")
+	require.NoError(t, err)
+	assert.Equal(t, web, cont)
+
+	_, err = newIdentityKey("label:")
+	assert.Error(t, err)
+	identityKey, err = newIdentityKey("id")
+	assert.NoError(t, err)
+	assert.Nil(t, identityKey)
+}
+
 func TestGetContainerInfoV2Failure(t *testing.T) {
 	successful := "/"
 	statless := "/c1"
@@ -533,3 +691,123 @@ func TestDockerContainersInfo(t *testing.T) {
 		t.Errorf("expected error %q but received %q", expectedError, err)
 	}
 }
+
+// recordingFactory records the containers it is asked about and ignores them.
+type recordingFactory struct {
+	lock  sync.Mutex
+	names []string
+}
+
+func (f *recordingFactory) String() string {
+	return "recording"
+}
+
+func (f *recordingFactory) DebugInfo() map[string][]string {
+	return map[string][]string{}
+}
+
+func (f *recordingFactory) CanHandleAndAccept(name string) (bool, bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.names = append(f.names, name)
+	return true, false, nil
+}
+
+func (f *recordingFactory) NewContainerHandler(name string, metadataEnvAllowList []string, inHostNamespace bool) (container.ContainerHandler, error) {
+	return nil, fmt.Errorf("unexpected container handler creation for %q", name)
+}
+
+func (f *recordingFactory) seen() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string(nil), f.names...)
+}
+
+func TestMinContainerAge(t *testing.T) {
+	container.ClearContainerHandlerFactories()
+	defer container.ClearContainerHandlerFactories()
+	factory := &recordingFactory{}
+	container.RegisterContainerHandlerFactory(factory, []watcher.ContainerWatchSource{watcher.Raw})
+
+	m := &manager{
+		containers:        make(map[namespacedContainerName]*containerData),
+		minContainerAge:   100 * time.Millisecond,
+		pendingContainers: make(map[string]*time.Timer),
+	}
+	m.createContainerAfterMinAge("/short-lived", watcher.Raw)
+	m.createContainerAfterMinAge("/long-lived", watcher.Raw)
+	// Events of a container already waiting are ignored.
+	m.createContainerAfterMinAge("/long-lived", watcher.Raw)
+	assert.Empty(t, factory.seen())
+
+	// The short-lived container is deleted before reaching the minimum age,
+	// so no handler is ever created for it.
+	assert.NoError(t, m.destroyContainer("/short-lived"))
+
+	assert.Eventually(t, func() bool { return len(factory.seen()) > 0 }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, []string{"/long-lived"}, factory.seen())
+	assert.Empty(t, m.pendingContainers)
+}
+
+func TestStopPendingContainers(t *testing.T) {
+	container.ClearContainerHandlerFactories()
+	defer container.ClearContainerHandlerFactories()
+	factory := &recordingFactory{}
+	container.RegisterContainerHandlerFactory(factory, []watcher.ContainerWatchSource{watcher.Raw})
+
+	m := &manager{
+		containers:        make(map[namespacedContainerName]*containerData),
+		minContainerAge:   50 * time.Millisecond,
+		pendingContainers: make(map[string]*time.Timer),
+	}
+	m.createContainerAfterMinAge("/pending", watcher.Raw)
+	m.stopPendingContainers()
+	assert.Empty(t, m.pendingContainers)
+
+	time.Sleep(150 * time.Millisecond)
+	assert.Empty(t, factory.seen())
+}
+
+func TestUpdateIncludedMetrics(t *testing.T) {
+	defer func(f func(container.MetricSet) error) { updateCgroupSubsystems = f }(updateCgroupSubsystems)
+	var derived []container.MetricSet
+	updateCgroupSubsystems = func(includedMetrics container.MetricSet) error {
+		derived = append(derived, includedMetrics)
+		return nil
+	}
+
+	included := container.MetricSet{
+		container.CpuUsageMetrics:  struct{}{},
+		container.DiskUsageMetrics: struct{}{},
+	}
+	m := createManagerAndAddContainers(memory.New(time.Minute, nil), &fakesysfs.FakeSysFs{}, []string{"/c1"}, func(h *containertest.MockContainerHandler) {
+		// The spec derived once the metrics are updated.
+		h.On("GetSpec").Return(info.ContainerSpec{HasCpu: true, HasNetwork: true}, nil).Once()
+	}, t)
+	m.includedMetrics = included
+	cont := m.containers[namespacedContainerName{Name: "/c1"}]
+	assert.False(t, cont.info.Spec.HasNetwork)
+
+	// The disk usage metrics are set up when containers are created.
+	err := m.UpdateIncludedMetrics(container.MetricSet{container.CpuUsageMetrics: struct{}{}})
+	assert.EqualError(t, err, "metrics disk cannot be enabled or disabled without a restart")
+	assert.Empty(t, derived)
+
+	updated := container.MetricSet{
+		container.CpuUsageMetrics:     struct{}{},
+		container.DiskUsageMetrics:    struct{}{},
+		container.HugetlbUsageMetrics: struct{}{},
+	}
+	require.NoError(t, m.UpdateIncludedMetrics(updated))
+	assert.Equal(t, []container.MetricSet{updated}, derived)
+	// The set shared with the container handlers is updated in place.
+	assert.True(t, included.Has(container.HugetlbUsageMetrics))
+	assert.Equal(t, updated, m.IncludedMetrics())
+	// The specs of the existing containers are re-derived.
+	assert.True(t, cont.info.Spec.HasNetwork)
+
+	updateCgroupSubsystems = func(container.MetricSet) error { return fmt.Errorf("no cgroup mounts") }
+	assert.Error(t, m.UpdateIncludedMetrics(container.MetricSet{container.DiskUsageMetrics: struct{}{}}))
+	assert.Equal(t, updated, m.IncludedMetrics())
+}
@@ -0,0 +1,281 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/cadvisor/events"
+	info "github.com/google/cadvisor/info/v1"
+
+	"k8s.io/klog/v2"
+)
+
+var containerNameNormalizers = flag.String("container_name_normalizers", "", "Comma separated list of the normalizers applied in order to the names and aliases of containers before they are exposed, e.g. kubepods,systemd_unescape. Names are exposed unchanged by default.")
+
+// NameNormalizer rewrites the name or an alias of a container before it is
+// exposed by the API and the metrics. Containers are still looked up by their
+// original names.
+type NameNormalizer func(name string) string
+
+var (
+	nameNormalizersLock sync.Mutex
+	nameNormalizers     = map[string]NameNormalizer{
+		"kubepods":         normalizeKubepodsName,
+		"systemd_unescape": unescapeSystemdName,
+	}
+)
+
+// RegisterNameNormalizer makes a normalizer available to the
+// --container_name_normalizers flag. It must be called before New.
+func RegisterNameNormalizer(name string, normalizer NameNormalizer) error {
+	nameNormalizersLock.Lock()
+	defer nameNormalizersLock.Unlock()
+	if _, found := nameNormalizers[name]; found {
+		return fmt.Errorf("name normalizer %q was registered twice", name)
+	}
+	nameNormalizers[name] = normalizer
+	return nil
+}
+
+// newNameNormalizer returns the composition of the comma separated list of
+// registered normalizers, or nil if the list is empty.
+func newNameNormalizer(names string) (NameNormalizer, error) {
+	if names == "" {
+		return nil, nil
+	}
+	nameNormalizersLock.Lock()
+	defer nameNormalizersLock.Unlock()
+	var normalizers []NameNormalizer
+	for _, name := range strings.Split(names, ",") {
+		normalizer, ok := nameNormalizers[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown container name normalizer %q", name)
+		}
+		normalizers = append(normalizers, normalizer)
+	}
+	return func(name string) string {
+		for _, normalizer := range normalizers {
+			name = normalizer(name)
+		}
+		return name
+	}, nil
+}
+
+// containerNames tracks the names under which the containers are exposed, so
+// that a container is exposed under the same name by all the outputs of the
+// manager. A nil *containerNames, or one without normalizer, exposes the
+// names unchanged.
+type containerNames struct {
+	normalize NameNormalizer
+
+	lock sync.RWMutex
+	// Exposed names by container name.
+	exposed map[string]string
+	// Container names by exposed name, to detect collisions.
+	owners map[string]string
+}
+
+func newContainerNames(normalize NameNormalizer) *containerNames {
+	return &containerNames{
+		normalize: normalize,
+		exposed:   make(map[string]string),
+		owners:    make(map[string]string),
+	}
+}
+
+// enabled returns whether the names are normalized.
+func (n *containerNames) enabled() bool {
+	return n != nil && n.normalize != nil
+}
+
+// add chooses the exposed name of a new container. A container whose
+// normalized name is already the exposed name of another container keeps its
+// original name.
+func (n *containerNames) add(name string) {
+	if !n.enabled() {
+		return
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	exposed := n.normalize(name)
+	if owner, ok := n.owners[exposed]; ok && owner != name && exposed != name {
+		klog.Warningf("Container %q is normalized to %q like container %q, exposing it under its original name", name, exposed, owner)
+		exposed = name
+	}
+	n.claimLocked(name, exposed)
+}
+
+// claimLocked exposes the container under the given name. If it is the
+// normalized name of another container, which can only happen when it is the
+// original name of the container, the other container gets back its original
+// name.
+func (n *containerNames) claimLocked(name, exposed string) {
+	if owner, ok := n.owners[exposed]; ok && owner != name {
+		klog.Warningf("Container %q was normalized to the name of container %q, exposing it under its original name", owner, name)
+		n.claimLocked(owner, owner)
+	}
+	if previous, ok := n.exposed[name]; ok && n.owners[previous] == name {
+		delete(n.owners, previous)
+	}
+	n.exposed[name] = exposed
+	n.owners[exposed] = name
+}
+
+// remove forgets the exposed name of a destroyed container.
+func (n *containerNames) remove(name string) {
+	if !n.enabled() {
+		return
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if exposed, ok := n.exposed[name]; ok && n.owners[exposed] == name {
+		delete(n.owners, exposed)
+	}
+	delete(n.exposed, name)
+}
+
+// name returns the exposed name of a container. The names of the containers
+// which aren't tracked, e.g. the victims of OOM kills, are normalized.
+func (n *containerNames) name(name string) string {
+	if !n.enabled() {
+		return name
+	}
+	n.lock.RLock()
+	exposed, ok := n.exposed[name]
+	n.lock.RUnlock()
+	if ok {
+		return exposed
+	}
+	return n.normalize(name)
+}
+
+// reference returns a copy of ref with the exposed name and the normalized
+// aliases of the container.
+func (n *containerNames) reference(ref info.ContainerReference) info.ContainerReference {
+	if !n.enabled() {
+		return ref
+	}
+	ref.Name = n.name(ref.Name)
+	if len(ref.Aliases) > 0 {
+		aliases := make([]string, len(ref.Aliases))
+		for i, alias := range ref.Aliases {
+			aliases[i] = n.normalize(alias)
+		}
+		ref.Aliases = aliases
+	}
+	return ref
+}
+
+// exposedNameEvents is an events.EventManager storing the events under the
+// exposed names of their containers, and looking them up by the original
+// names.
+type exposedNameEvents struct {
+	events.EventManager
+	names *containerNames
+}
+
+func (e exposedNameEvents) AddEvent(event *info.Event) error {
+	exposed := *event
+	exposed.ContainerName = e.names.name(event.ContainerName)
+	return e.EventManager.AddEvent(&exposed)
+}
+
+func (e exposedNameEvents) GetEvents(request *events.Request) ([]*info.Event, error) {
+	return e.EventManager.GetEvents(e.exposedRequest(request))
+}
+
+func (e exposedNameEvents) WatchEvents(request *events.Request) (*events.EventChannel, error) {
+	return e.EventManager.WatchEvents(e.exposedRequest(request))
+}
+
+func (e exposedNameEvents) exposedRequest(request *events.Request) *events.Request {
+	if request.ContainerName == "" {
+		return request
+	}
+	exposed := *request
+	exposed.ContainerName = e.names.name(request.ContainerName)
+	return &exposed
+}
+
+// unescapeSystemdName replaces the \xNN escape sequences of the names of
+// systemd units, e.g. "system-serial\x2dgetty.slice", by the bytes they stand
+// for.
+func unescapeSystemdName(name string) string {
+	if !strings.Contains(name, `\x`) {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+4 <= len(name) && name[i+1] == 'x' {
+			if c, err := strconv.ParseUint(name[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// containerScopePrefixes are the prefixes of the systemd scopes the container
+// runtimes run the containers of Kubernetes pods in.
+var containerScopePrefixes = []string{"docker-", "cri-containerd-", "crio-"}
+
+// normalizeKubepodsName names the cgroups of the Kubernetes pods and of their
+// containers created by the systemd cgroup driver like the cgroupfs driver
+// does, e.g.
+// "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod12_34.slice/cri-containerd-abcd.scope"
+// becomes "/kubepods/burstable/pod12-34/abcd". Other names are left as is.
+func normalizeKubepodsName(name string) string {
+	parts := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	if parts[0] != "kubepods.slice" {
+		return name
+	}
+	normalized := []string{"", "kubepods"}
+	for _, part := range parts[1:] {
+		switch {
+		case strings.HasPrefix(part, "kubepods-") && strings.HasSuffix(part, ".slice"):
+			// The slices are named after their parent slices, e.g.
+			// kubepods-burstable-pod<uid>.slice. The dashes of the pod UID
+			// are escaped as underscores.
+			unit := strings.TrimSuffix(part, ".slice")
+			unit = strings.Replace(unit[strings.LastIndex(unit, "-")+1:], "_", "-", -1)
+			normalized = append(normalized, unit)
+		case strings.HasSuffix(part, ".scope"):
+			id := ""
+			for _, prefix := range containerScopePrefixes {
+				if strings.HasPrefix(part, prefix) {
+					id = strings.TrimSuffix(strings.TrimPrefix(part, prefix), ".scope")
+					break
+				}
+			}
+			// Other scopes, e.g. the crio-conmon-<id>.scope of the monitor
+			// of a container, would be mistaken for the container.
+			if id == "" || strings.Contains(id, "-") {
+				return name
+			}
+			normalized = append(normalized, id)
+		default:
+			return name
+		}
+	}
+	return strings.Join(normalized, "/")
+}
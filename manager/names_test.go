@@ -0,0 +1,167 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/events"
+	info "github.com/google/cadvisor/info/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnescapeSystemdName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"/system.slice/system-serial\\x2dgetty.slice/serial-getty@ttyS0.service": "/system.slice/system-serial-getty.slice/serial-getty@ttyS0.service",
+		"/system.slice/var-lib-docker-overlay2\\x2dabc.mount":                    "/system.slice/var-lib-docker-overlay2-abc.mount",
+		"/system.slice/docker.service":                                           "/system.slice/docker.service",
+		// Invalid and truncated escape sequences are left as is.
+		"/system.slice/foo\\xzz.service": "/system.slice/foo\\xzz.service",
+		"/system.slice/foo\\x2":          "/system.slice/foo\\x2",
+	} {
+		assert.Equal(t, expected, unescapeSystemdName(name), name)
+	}
+}
+
+func TestNormalizeKubepodsName(t *testing.T) {
+	const (
+		uid = "2b9a4fb0-7e0f-4d1c-9a3e-1f2d3c4b5a69"
+		id  = "0f1e2d3c4b5a69788796a5b4c3d2e1f00f1e2d3c4b5a69788796a5b4c3d2e1f0"
+	)
+	systemdUID := strings.Replace(uid, "-", "_", -1)
+	for name, expected := range map[string]string{
+		// systemd cgroup driver.
+		"/kubepods.slice":                          "/kubepods",
+		"/kubepods.slice/kubepods-burstable.slice": "/kubepods/burstable",
+		"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" + systemdUID + ".slice":                         "/kubepods/burstable/pod" + uid,
+		"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" + systemdUID + ".slice/docker-" + id + ".scope": "/kubepods/burstable/pod" + uid + "/" + id,
+		"/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod" + systemdUID + ".slice/crio-" + id + ".scope": "/kubepods/besteffort/pod" + uid + "/" + id,
+		"/kubepods.slice/kubepods-pod" + systemdUID + ".slice/cri-containerd-" + id + ".scope":                            "/kubepods/pod" + uid + "/" + id,
+		// cgroupfs cgroup driver.
+		"/kubepods/burstable/pod" + uid + "/" + id: "/kubepods/burstable/pod" + uid + "/" + id,
+		"/kubepods/pod" + uid + "/" + id:           "/kubepods/pod" + uid + "/" + id,
+		// Other names are left as is.
+		"/kubepods.slice/kubepods-pod" + systemdUID + ".slice/crio-conmon-" + id + ".scope": "/kubepods.slice/kubepods-pod" + systemdUID + ".slice/crio-conmon-" + id + ".scope",
+		"/kubepods.slice/foo.service":  "/kubepods.slice/foo.service",
+		"/system.slice/docker.service": "/system.slice/docker.service",
+		"/":                            "/",
+	} {
+		assert.Equal(t, expected, normalizeKubepodsName(name), name)
+	}
+}
+
+func TestNewNameNormalizer(t *testing.T) {
+	normalize, err := newNameNormalizer("")
+	require.NoError(t, err)
+	assert.Nil(t, normalize)
+
+	_, err = newNameNormalizer("systemd_unescape,unknown")
+	assert.Error(t, err)
+
+	require.NoError(t, RegisterNameNormalizer("test_upper", strings.ToUpper))
+	defer func() {
+		nameNormalizersLock.Lock()
+		delete(nameNormalizers, "test_upper")
+		nameNormalizersLock.Unlock()
+	}()
+	assert.Error(t, RegisterNameNormalizer("test_upper", strings.ToLower))
+
+	// Normalizers are applied in order to the name and the aliases.
+	normalize, err = newNameNormalizer("systemd_unescape, test_upper")
+	require.NoError(t, err)
+	names := newContainerNames(normalize)
+	ref := info.ContainerReference{
+		Name:    "/system.slice/system-serial\\x2dgetty.slice",
+		Aliases: []string{"getty\\x2d1"},
+	}
+	names.add(ref.Name)
+	assert.Equal(t, info.ContainerReference{
+		Name:    "/SYSTEM.SLICE/SYSTEM-SERIAL-GETTY.SLICE",
+		Aliases: []string{"GETTY-1"},
+	}, names.reference(ref))
+	// The original reference is left unchanged.
+	assert.Equal(t, "getty\\x2d1", ref.Aliases[0])
+
+	// Names are exposed unchanged by default.
+	var unchanged *containerNames
+	assert.Equal(t, ref, unchanged.reference(ref))
+	assert.Equal(t, ref, newContainerNames(nil).reference(ref))
+}
+
+func TestContainerNamesCollisions(t *testing.T) {
+	names := newContainerNames(unescapeSystemdName)
+	const escaped = "/system.slice/a\\x2db.service"
+	const unescaped = "/system.slice/a-b.service"
+
+	names.add(escaped)
+	assert.Equal(t, unescaped, names.name(escaped))
+
+	// The original name of a container takes precedence over the normalized
+	// name of another one.
+	names.add(unescaped)
+	assert.Equal(t, unescaped, names.name(unescaped))
+	assert.Equal(t, escaped, names.name(escaped))
+
+	// A container normalized to the exposed name of another one keeps its
+	// original name.
+	const other = "/system.slice/a\\x2db\\x2e.service"
+	names.add(other)
+	assert.Equal(t, "/system.slice/a-b..service", names.name(other))
+	const collision = "/system.slice/a-b\\x2e.service"
+	names.add(collision)
+	assert.Equal(t, collision, names.name(collision))
+
+	// The exposed name is released when the container is destroyed.
+	names.remove(other)
+	names.remove(collision)
+	names.add(collision)
+	assert.Equal(t, "/system.slice/a-b..service", names.name(collision))
+
+	// The containers which aren't tracked are normalized.
+	assert.Equal(t, "/system.slice/c-d.service", names.name("/system.slice/c\\x2dd.service"))
+}
+
+func TestExposedNameEvents(t *testing.T) {
+	names := newContainerNames(unescapeSystemdName)
+	const name = "/system.slice/a\\x2db.service"
+	names.add(name)
+	handler := exposedNameEvents{
+		EventManager: events.NewEventManager(events.DefaultStoragePolicy()),
+		names:        names,
+	}
+
+	event := &info.Event{
+		ContainerName: name,
+		Timestamp:     time.Unix(1000, 0),
+		EventType:     info.EventContainerCreation,
+	}
+	require.NoError(t, handler.AddEvent(event))
+	// The event of the caller is left unchanged.
+	assert.Equal(t, name, event.ContainerName)
+
+	request := events.NewRequest()
+	request.ContainerName = name
+	request.EventType[info.EventContainerCreation] = true
+	request.MaxEventsReturned = 10
+	found, err := handler.GetEvents(request)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, "/system.slice/a-b.service", found[0].ContainerName)
+	assert.Equal(t, name, request.ContainerName)
+}
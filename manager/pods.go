@@ -0,0 +1,257 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	v2 "github.com/google/cadvisor/info/v2"
+
+	"k8s.io/klog/v2"
+)
+
+var (
+	// Pod cgroup created by the cgroupfs driver, e.g. /kubepods/burstable/pod<uid>.
+	cgroupfsPodRegexp = regexp.MustCompile(`^pod([0-9a-f-]+)$`)
+	// Pod cgroup created by the systemd driver, e.g.
+	// /kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<uid>.slice
+	// with the dashes of the uid replaced by underscores.
+	systemdPodRegexp = regexp.MustCompile(`^kubepods(?:-besteffort|-burstable)?-pod([0-9a-f_]+)\.slice$`)
+)
+
+// podUID returns the UID of the pod whose cgroup is the given one, or an empty
+// string if it is not a pod cgroup.
+func podUID(cgroup string) string {
+	if !strings.HasPrefix(cgroup, "/kubepods") {
+		return ""
+	}
+	name := path.Base(cgroup)
+	if matches := cgroupfsPodRegexp.FindStringSubmatch(name); matches != nil {
+		return matches[1]
+	}
+	if matches := systemdPodRegexp.FindStringSubmatch(name); matches != nil {
+		return strings.Replace(matches[1], "_", "-", -1)
+	}
+	return ""
+}
+
+// podQOSClass returns the quality of service class of the pod whose cgroup is
+// the given one. The kubelet creates the cgroups of Burstable and BestEffort
+// pods under a cgroup named after their class, and those of Guaranteed pods
+// directly under the kubepods cgroup.
+func podQOSClass(cgroup string) string {
+	name := path.Base(cgroup)
+	switch {
+	case strings.HasPrefix(name, "kubepods-burstable-"), path.Base(path.Dir(cgroup)) == "burstable":
+		return "Burstable"
+	case strings.HasPrefix(name, "kubepods-besteffort-"), path.Base(path.Dir(cgroup)) == "besteffort":
+		return "BestEffort"
+	default:
+		return "Guaranteed"
+	}
+}
+
+// cpuRequestMillicores estimates the CPU request in millicores which the
+// kubelet converted to the given cpu shares, i.e. 1024 shares per core with a
+// minimum of 2 shares for the pods without request.
+func cpuRequestMillicores(shares uint64) uint64 {
+	if shares <= 2 {
+		return 0
+	}
+	return (shares*1000 + 512) / 1024
+}
+
+// cpuLimitMillicores returns the CPU limit in millicores of the given CFS
+// quota, or 0 without quota.
+func cpuLimitMillicores(spec info.CpuSpec) uint64 {
+	if spec.Quota == 0 || spec.Period == 0 {
+		return 0
+	}
+	return spec.Quota * 1000 / spec.Period
+}
+
+// aggregatePodStats sums the stats of the containers of each pod, given the
+// latest stats of containers by name. Only the direct children of a pod cgroup
+// are summed: the pod cgroup already accounts for its children, and the
+// children of a container are accounted for by the container.
+func aggregatePodStats(containerStats map[string]*info.ContainerStats) []v2.PodStats {
+	pods := map[string]*v2.PodStats{}
+	for name, stats := range containerStats {
+		if stats == nil {
+			continue
+		}
+		if strings.HasPrefix(path.Base(name), "crio-conmon-") {
+			// The conmon process monitoring a CRI-O container.
+			continue
+		}
+		podCgroup := path.Dir(name)
+		uid := podUID(podCgroup)
+		if uid == "" {
+			continue
+		}
+		pod, ok := pods[podCgroup]
+		if !ok {
+			pod = &v2.PodStats{PodUID: uid, Name: podCgroup}
+			pods[podCgroup] = pod
+		}
+		pod.Containers = append(pod.Containers, name)
+		if stats.Timestamp.After(pod.Timestamp) {
+			pod.Timestamp = stats.Timestamp
+		}
+		pod.CpuUsageTotal += stats.Cpu.Usage.Total
+		pod.CpuUsageUser += stats.Cpu.Usage.User
+		pod.CpuUsageSystem += stats.Cpu.Usage.System
+		pod.MemoryUsage += stats.Memory.Usage
+		pod.MemoryWorkingSet += stats.Memory.WorkingSet
+		pod.MemoryRSS += stats.Memory.RSS
+		pod.MemoryCache += stats.Memory.Cache
+		pod.ProcessCount += stats.Processes.ProcessCount
+	}
+
+	result := make([]v2.PodStats, 0, len(pods))
+	for _, pod := range pods {
+		sort.Strings(pod.Containers)
+		result = append(result, *pod)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// GetPodStats returns the aggregated stats of the Kubernetes pods running on
+// the machine.
+func (m *manager) GetPodStats() ([]v2.PodStats, error) {
+	m.containersLock.RLock()
+	// Containers are also registered under their aliases, deduplicate them.
+	names := map[string]struct{}{}
+	// The cgroups of the pods hold the requests and limits of their containers.
+	podSpecs := map[string]info.CpuSpec{}
+	for _, cont := range m.containers {
+		if podUID(path.Dir(cont.info.Name)) != "" {
+			names[cont.info.Name] = struct{}{}
+		} else if podUID(cont.info.Name) != "" {
+			cont.lock.Lock()
+			podSpecs[cont.info.Name] = cont.info.Spec.Cpu
+			cont.lock.Unlock()
+		}
+	}
+	m.containersLock.RUnlock()
+
+	containerStats := make(map[string]*info.ContainerStats, len(names))
+	for name := range names {
+		stats, err := m.memoryCache.RecentStats(name, time.Time{}, time.Time{}, 1)
+		if err != nil {
+			klog.V(4).Infof("Unable to get stats of container %q for its pod: %v", name, err)
+			continue
+		}
+		if len(stats) > 0 {
+			containerStats[name] = stats[0]
+		}
+	}
+	pods := aggregatePodStats(containerStats)
+	m.podCpuUsage.addExitedContainers(pods, containerStats, names)
+	for i := range pods {
+		pods[i].QOSClass = podQOSClass(pods[i].Name)
+		if spec, ok := podSpecs[pods[i].Name]; ok {
+			pods[i].CpuRequestMillicores = cpuRequestMillicores(spec.Limit)
+			pods[i].CpuLimitMillicores = cpuLimitMillicores(spec)
+		}
+	}
+	if m.names.enabled() {
+		for i := range pods {
+			pods[i].Name = m.names.name(pods[i].Name)
+			containers := make([]string, len(pods[i].Containers))
+			for j, name := range pods[i].Containers {
+				containers[j] = m.names.name(name)
+			}
+			sort.Strings(containers)
+			pods[i].Containers = containers
+		}
+		sort.Slice(pods, func(i, j int) bool {
+			return pods[i].Name < pods[j].Name
+		})
+	}
+	return pods, nil
+}
+
+// podCpuUsage holds the last cpu usage of the containers of a pod, and the
+// sum of the cpu usage of its containers which exited.
+type podCpuUsage struct {
+	containers map[string]info.CpuUsage
+	exited     info.CpuUsage
+}
+
+// podCpuAccounting keeps the cpu usage of the exited containers of pods, so
+// that the cumulative cpu usage of a pod doesn't decrease when one of its
+// containers exits or is restarted.
+type podCpuAccounting struct {
+	lock sync.Mutex
+	pods map[string]*podCpuUsage
+}
+
+// addExitedContainers adds the cpu usage of the exited containers of the pods
+// to their cumulative cpu usage, given the latest stats of the containers and
+// the registered containers. A registered container without stats is counted
+// with its last cpu usage.
+func (a *podCpuAccounting) addExitedContainers(pods []v2.PodStats, containerStats map[string]*info.ContainerStats, registered map[string]struct{}) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	seen := make(map[string]*podCpuUsage, len(pods))
+	for i := range pods {
+		pod := &pods[i]
+		usage, ok := a.pods[pod.Name]
+		if !ok {
+			usage = &podCpuUsage{}
+		}
+		seen[pod.Name] = usage
+		current := make(map[string]info.CpuUsage, len(pod.Containers))
+		for _, name := range pod.Containers {
+			current[name] = containerStats[name].Cpu.Usage
+		}
+		for name, last := range usage.containers {
+			cur, ok := current[name]
+			if !ok {
+				if _, ok := registered[name]; ok {
+					current[name] = last
+					addCpuUsage(pod, last)
+					continue
+				}
+			}
+			// The container exited or its counters were reset.
+			if !ok || cur.Total < last.Total {
+				usage.exited.Total += last.Total
+				usage.exited.User += last.User
+				usage.exited.System += last.System
+			}
+		}
+		usage.containers = current
+		addCpuUsage(pod, usage.exited)
+	}
+	// Forget the pods which were deleted.
+	a.pods = seen
+}
+
+func addCpuUsage(pod *v2.PodStats, usage info.CpuUsage) {
+	pod.CpuUsageTotal += usage.Total
+	pod.CpuUsageUser += usage.User
+	pod.CpuUsageSystem += usage.System
+}
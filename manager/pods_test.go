@@ -0,0 +1,191 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/cache/memory"
+	containertest "github.com/google/cadvisor/container/testing"
+	info "github.com/google/cadvisor/info/v1"
+	v2 "github.com/google/cadvisor/info/v2"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPodUID    = "6a3c1e2f-4d5b-4c8e-9f0a-1b2c3d4e5f60"
+	testPodCgroup = "/kubepods/burstable/pod" + testPodUID
+)
+
+func podContainerStats(timestamp time.Time, cpu, memory, processes uint64) *info.ContainerStats {
+	stats := &info.ContainerStats{Timestamp: timestamp}
+	stats.Cpu.Usage.Total = cpu
+	stats.Cpu.Usage.User = cpu / 2
+	stats.Cpu.Usage.System = cpu / 4
+	stats.Memory.Usage = memory
+	stats.Memory.WorkingSet = memory / 2
+	stats.Memory.RSS = memory / 4
+	stats.Memory.Cache = memory / 8
+	stats.Processes.ProcessCount = processes
+	return stats
+}
+
+func TestPodUID(t *testing.T) {
+	assert.Equal(t, testPodUID, podUID(testPodCgroup))
+	assert.Equal(t, testPodUID, podUID("/kubepods/pod"+testPodUID))
+	assert.Equal(t, testPodUID, podUID("/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod6a3c1e2f_4d5b_4c8e_9f0a_1b2c3d4e5f60.slice"))
+	assert.Equal(t, testPodUID, podUID("/kubepods.slice/kubepods-pod6a3c1e2f_4d5b_4c8e_9f0a_1b2c3d4e5f60.slice"))
+	assert.Equal(t, "", podUID("/kubepods/burstable"))
+	assert.Equal(t, "", podUID("/kubepods.slice/kubepods-burstable.slice"))
+	assert.Equal(t, "", podUID("/docker/pod1234"))
+	assert.Equal(t, "", podUID("/"))
+}
+
+func TestPodQOSClass(t *testing.T) {
+	assert.Equal(t, "Burstable", podQOSClass(testPodCgroup))
+	assert.Equal(t, "BestEffort", podQOSClass("/kubepods/besteffort/pod"+testPodUID))
+	assert.Equal(t, "Guaranteed", podQOSClass("/kubepods/pod"+testPodUID))
+	assert.Equal(t, "Burstable", podQOSClass("/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod6a3c1e2f_4d5b_4c8e_9f0a_1b2c3d4e5f60.slice"))
+	assert.Equal(t, "BestEffort", podQOSClass("/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod6a3c1e2f_4d5b_4c8e_9f0a_1b2c3d4e5f60.slice"))
+	assert.Equal(t, "Guaranteed", podQOSClass("/kubepods.slice/kubepods-pod6a3c1e2f_4d5b_4c8e_9f0a_1b2c3d4e5f60.slice"))
+}
+
+func TestCpuRequestMillicores(t *testing.T) {
+	// The cpu shares the kubelet sets for the requests, by request.
+	for millicores, shares := range map[uint64]uint64{
+		0:    2,
+		10:   10,
+		100:  102,
+		250:  256,
+		500:  512,
+		1000: 1024,
+		1500: 1536,
+		4000: 4096,
+	} {
+		assert.Equal(t, millicores, cpuRequestMillicores(shares), "%d shares", shares)
+	}
+}
+
+func TestCpuLimitMillicores(t *testing.T) {
+	assert.EqualValues(t, 1500, cpuLimitMillicores(info.CpuSpec{Quota: 150000, Period: 100000}))
+	assert.EqualValues(t, 0, cpuLimitMillicores(info.CpuSpec{Period: 100000}))
+	assert.EqualValues(t, 0, cpuLimitMillicores(info.CpuSpec{}))
+}
+
+func TestAggregatePodStats(t *testing.T) {
+	now := time.Now()
+	pods := aggregatePodStats(map[string]*info.ContainerStats{
+		// The pod cgroup includes the usage of its containers.
+		testPodCgroup: podContainerStats(now, 1000, 3000, 3),
+		// Pause and application containers.
+		testPodCgroup + "/pause":   podContainerStats(now.Add(-time.Second), 100, 1000, 1),
+		testPodCgroup + "/app":     podContainerStats(now, 900, 2000, 2),
+		testPodCgroup + "/app/sub": podContainerStats(now, 400, 500, 1),
+		// Not in a pod.
+		"/docker/abc": podContainerStats(now, 5000, 5000, 5),
+		"/kubepods":   podContainerStats(now, 9000, 9000, 9),
+	})
+
+	assert.Equal(t, []v2.PodStats{{
+		PodUID:           testPodUID,
+		Name:             testPodCgroup,
+		Containers:       []string{testPodCgroup + "/app", testPodCgroup + "/pause"},
+		Timestamp:        now,
+		CpuUsageTotal:    1000,
+		CpuUsageUser:     500,
+		CpuUsageSystem:   250,
+		MemoryUsage:      3000,
+		MemoryWorkingSet: 1500,
+		MemoryRSS:        750,
+		MemoryCache:      375,
+		ProcessCount:     3,
+	}}, pods)
+}
+
+func TestGetPodStats(t *testing.T) {
+	containers := []string{
+		testPodCgroup,
+		testPodCgroup + "/pause",
+		testPodCgroup + "/app",
+		"/docker/abc",
+	}
+	memoryCache := memory.New(time.Minute, nil)
+	m := createManagerAndAddContainers(memoryCache, nil, containers, func(h *containertest.MockContainerHandler) {}, t)
+
+	now := time.Now()
+	for name, stats := range map[string]*info.ContainerStats{
+		testPodCgroup:            podContainerStats(now, 1000, 3000, 3),
+		testPodCgroup + "/pause": podContainerStats(now, 100, 1000, 1),
+		testPodCgroup + "/app":   podContainerStats(now, 900, 2000, 2),
+		"/docker/abc":            podContainerStats(now, 5000, 5000, 5),
+	} {
+		cInfo := &info.ContainerInfo{ContainerReference: info.ContainerReference{Name: name}}
+		require.Nil(t, memoryCache.AddStats(cInfo, stats))
+	}
+
+	// A Burstable pod requesting a quarter of a core, limited to half a core.
+	m.containers[namespacedContainerName{Name: testPodCgroup}].info.Spec.Cpu = info.CpuSpec{Limit: 256, Quota: 50000, Period: 100000}
+
+	pods, err := m.GetPodStats()
+	require.Nil(t, err)
+	require.Len(t, pods, 1)
+	assert.Equal(t, testPodUID, pods[0].PodUID)
+	assert.Equal(t, []string{testPodCgroup + "/app", testPodCgroup + "/pause"}, pods[0].Containers)
+	assert.EqualValues(t, 1000, pods[0].CpuUsageTotal)
+	assert.EqualValues(t, 3000, pods[0].MemoryUsage)
+	assert.EqualValues(t, 3, pods[0].ProcessCount)
+	assert.Equal(t, "Burstable", pods[0].QOSClass)
+	assert.EqualValues(t, 250, pods[0].CpuRequestMillicores)
+	assert.EqualValues(t, 500, pods[0].CpuLimitMillicores)
+}
+
+func TestPodCpuUsageKeepsExitedContainers(t *testing.T) {
+	now := time.Now()
+	app := testPodCgroup + "/app"
+	pause := testPodCgroup + "/pause"
+	accounting := podCpuAccounting{}
+	podCpuTotal := func(containerStats map[string]*info.ContainerStats, registered ...string) uint64 {
+		names := map[string]struct{}{}
+		for _, name := range registered {
+			names[name] = struct{}{}
+		}
+		pods := aggregatePodStats(containerStats)
+		accounting.addExitedContainers(pods, containerStats, names)
+		require.Len(t, pods, 1)
+		return pods[0].CpuUsageTotal
+	}
+
+	assert.EqualValues(t, 1000, podCpuTotal(map[string]*info.ContainerStats{
+		pause: podContainerStats(now, 100, 0, 1),
+		app:   podContainerStats(now, 900, 0, 1),
+	}, pause, app))
+	// The app container was restarted in place: its counters were reset.
+	assert.EqualValues(t, 1150, podCpuTotal(map[string]*info.ContainerStats{
+		pause: podContainerStats(now, 100, 0, 1),
+		app:   podContainerStats(now, 150, 0, 1),
+	}, pause, app))
+	// The app container is registered but its stats are missing.
+	assert.EqualValues(t, 1150, podCpuTotal(map[string]*info.ContainerStats{
+		pause: podContainerStats(now, 100, 0, 1),
+	}, pause, app))
+	// The app container exited and was replaced by a new one.
+	assert.EqualValues(t, 1200, podCpuTotal(map[string]*info.ContainerStats{
+		pause:           podContainerStats(now, 100, 0, 1),
+		app + "-second": podContainerStats(now, 50, 0, 1),
+	}, pause, app+"-second"))
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/cadvisor/container"
@@ -50,6 +51,20 @@ func fsValues(fsStats []info.FsStats, valueFn func(*info.FsStats) float64, times
 	return values
 }
 
+// tmpfsValues is a helper method for assembling per-mount point stats of the
+// memory-backed filesystems.
+func tmpfsValues(fsStats []info.FsStats, valueFn func(*info.FsStats) float64, timestamp time.Time) metricValues {
+	values := make(metricValues, 0, len(fsStats))
+	for _, stat := range fsStats {
+		values = append(values, metricValue{
+			value:     valueFn(&stat),
+			labels:    []string{stat.Mountpoint},
+			timestamp: timestamp,
+		})
+	}
+	return values
+}
+
 // ioValues is a helper method for assembling per-disk and per-filesystem stats.
 func ioValues(ioStats []info.PerDiskStats, ioType string, ioValueFn func(uint64) float64,
 	fsStats []info.FsStats, valueFn func(*info.FsStats) float64, timestamp time.Time) metricValues {
@@ -99,6 +114,32 @@ type PrometheusCollector struct {
 	containerLabelsFunc ContainerLabelsFunc
 	includedMetrics     container.MetricSet
 	opts                v2.RequestOptions
+	metricNamePrefix    string
+	now                 clock.Clock
+	// Age below which the containers of a runtime are not exported, 0 to
+	// export all containers.
+	ephemeralThreshold time.Duration
+}
+
+// DefaultMetricNamePrefix is the prefix of the names of the container metrics.
+const DefaultMetricNamePrefix = "container_"
+
+var metricNamePrefixRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// ValidateMetricNamePrefix returns an error if metric names starting with the
+// given prefix are not valid Prometheus metric names.
+func ValidateMetricNamePrefix(prefix string) error {
+	if !metricNamePrefixRegexp.MatchString(prefix) {
+		return fmt.Errorf("invalid metric name prefix %q: it must match %s", prefix, metricNamePrefixRegexp)
+	}
+	return nil
+}
+
+func newScrapeErrorGauge(name, help string) prometheus.Gauge {
+	return prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: name,
+		Help: help,
+	})
 }
 
 // NewPrometheusCollector returns a new PrometheusCollector. The passed
@@ -112,11 +153,8 @@ func NewPrometheusCollector(i infoProvider, f ContainerLabelsFunc, includedMetri
 	c := &PrometheusCollector{
 		infoProvider:        i,
 		containerLabelsFunc: f,
-		errors: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: "container",
-			Name:      "scrape_error",
-			Help:      "1 if there was an error while getting container metrics, 0 otherwise",
-		}),
+		errors:              newScrapeErrorGauge(DefaultMetricNamePrefix+"scrape_error", containerScrapeErrorHelp),
+		metricNamePrefix:    DefaultMetricNamePrefix,
 		containerMetrics: []containerMetric{
 			{
 				name:      "container_last_seen",
@@ -132,6 +170,7 @@ func NewPrometheusCollector(i infoProvider, f ContainerLabelsFunc, includedMetri
 		},
 		includedMetrics: includedMetrics,
 		opts:            opts,
+		now:             now,
 	}
 	if includedMetrics.Has(container.CpuUsageMetrics) {
 		c.containerMetrics = append(c.containerMetrics, []containerMetric{
@@ -222,6 +261,47 @@ func NewPrometheusCollector(i infoProvider, f ContainerLabelsFunc, includedMetri
 							timestamp: s.Timestamp,
 						}}
 				},
+			}, {
+				name:      "container_cpu_cfs_burst_periods_total",
+				help:      "Number of periods in which the container used more than its CFS quota thanks to its burst.",
+				valueType: prometheus.CounterValue,
+				condition: func(s info.ContainerSpec) bool { return s.Cpu.Burst != 0 },
+				getValues: func(s *info.ContainerStats) metricValues {
+					return metricValues{{value: float64(s.Cpu.CFS.Bursts), timestamp: s.Timestamp}}
+				},
+			}, {
+				name:      "container_cpu_cfs_burst_seconds_total",
+				help:      "Total cpu time the container used beyond its CFS quota thanks to its burst.",
+				valueType: prometheus.CounterValue,
+				condition: func(s info.ContainerSpec) bool { return s.Cpu.Burst != 0 },
+				getValues: func(s *info.ContainerStats) metricValues {
+					return metricValues{{value: float64(s.Cpu.CFS.BurstTime) / float64(time.Second), timestamp: s.Timestamp}}
+				},
+			}, {
+				name:      "container_cpu_cfs_throttled_fraction",
+				help:      "Fraction of the runnable time of the container lost to throttling over the last housekeeping interval.",
+				valueType: prometheus.GaugeValue,
+				condition: func(s info.ContainerSpec) bool { return s.Cpu.Quota != 0 },
+				getValues: func(s *info.ContainerStats) metricValues {
+					if s.WarmingUp {
+						return nil
+					}
+					return metricValues{
+						{
+							value:     s.Cpu.CFS.ThrottledFraction,
+							timestamp: s.Timestamp,
+						}}
+				},
+			}, {
+				name:      "container_cpu_limit_utilization",
+				help:      "Fraction of the cores allocated to the container, by its CFS quota or else all the cores of the machine, used over the last housekeeping interval.",
+				valueType: prometheus.GaugeValue,
+				getValues: func(s *info.ContainerStats) metricValues {
+					if s.WarmingUp {
+						return nil
+					}
+					return metricValues{{value: s.Cpu.LimitUtilization, timestamp: s.Timestamp}}
+				},
 			},
 		}...)
 	}
@@ -452,6 +532,115 @@ func NewPrometheusCollector(i infoProvider, f ContainerLabelsFunc, includedMetri
 						},
 					}
 				},
+			}, {
+				name:      "container_memory_high_events_total",
+				help:      "Cumulative count of times the memory usage went over memory.high and the container was throttled. Only reported on cgroup v2.",
+				valueType: prometheus.CounterValue,
+				getValues: func(s *info.ContainerStats) metricValues {
+					if s.Memory.CgroupV2 == nil {
+						return nil
+					}
+					return metricValues{{value: float64(s.Memory.CgroupV2.HighEvents), timestamp: s.Timestamp}}
+				},
+			}, {
+				name:      "container_memory_swapped_in_pages_total",
+				help:      "Cumulative count of pages swapped into memory by the container. Only reported on cgroup v2 with swap accounting.",
+				valueType: prometheus.CounterValue,
+				getValues: func(s *info.ContainerStats) metricValues {
+					if s.Memory.SwapActivity == nil {
+						return nil
+					}
+					return metricValues{{value: float64(s.Memory.SwapActivity.Pswpin), timestamp: s.Timestamp}}
+				},
+			}, {
+				name:      "container_memory_swapped_out_pages_total",
+				help:      "Cumulative count of pages swapped out of memory by the container. Only reported on cgroup v2 with swap accounting.",
+				valueType: prometheus.CounterValue,
+				getValues: func(s *info.ContainerStats) metricValues {
+					if s.Memory.SwapActivity == nil {
+						return nil
+					}
+					return metricValues{{value: float64(s.Memory.SwapActivity.Pswpout), timestamp: s.Timestamp}}
+				},
+			}, {
+				name:        "container_memory_reclaim_scanned_pages_total",
+				help:        "Cumulative count of pages of the container scanned for reclaim by kswapd or by direct reclaim. Only reported on cgroup v2 by Linux 5.13 and later.",
+				valueType:   prometheus.CounterValue,
+				extraLabels: []string{"reclaimer"},
+				getValues: func(s *info.ContainerStats) metricValues {
+					if s.Memory.CgroupV2 == nil || s.Memory.CgroupV2.Reclaim == nil {
+						return nil
+					}
+					reclaim := s.Memory.CgroupV2.Reclaim
+					return reclaimerValues(reclaim.PgscanKswapd, reclaim.PgscanDirect, s.Timestamp)
+				},
+			}, {
+				name:        "container_memory_reclaimed_pages_total",
+				help:        "Cumulative count of pages of the container reclaimed by kswapd or by direct reclaim. Only reported on cgroup v2 by Linux 5.13 and later.",
+				valueType:   prometheus.CounterValue,
+				extraLabels: []string{"reclaimer"},
+				getValues: func(s *info.ContainerStats) metricValues {
+					if s.Memory.CgroupV2 == nil || s.Memory.CgroupV2.Reclaim == nil {
+						return nil
+					}
+					reclaim := s.Memory.CgroupV2.Reclaim
+					return reclaimerValues(reclaim.PgstealKswapd, reclaim.PgstealDirect, s.Timestamp)
+				},
+			}, {
+				name:      "container_memory_compaction_stalls_total",
+				help:      "Cumulative count of allocations of the container which stalled to compact memory. Only reported on cgroup v2 when the kernel counts them.",
+				valueType: prometheus.CounterValue,
+				getValues: func(s *info.ContainerStats) metricValues {
+					if s.Memory.CgroupV2 == nil || s.Memory.CgroupV2.Reclaim == nil || s.Memory.CgroupV2.Reclaim.CompactStall == nil {
+						return nil
+					}
+					return metricValues{{value: float64(*s.Memory.CgroupV2.Reclaim.CompactStall), timestamp: s.Timestamp}}
+				},
+			},
+		}...)
+	}
+	if includedMetrics.Has(container.KernelMemoryMetrics) {
+		c.containerMetrics = append(c.containerMetrics, []containerMetric{
+			{
+				name:      "container_memory_kernel_usage_bytes",
+				help:      "Kernel memory usage of the container in bytes",
+				valueType: prometheus.GaugeValue,
+				getValues: func(s *info.ContainerStats) metricValues {
+					if s.Memory.Kernel == nil {
+						return nil
+					}
+					return metricValues{{value: float64(s.Memory.Kernel.Usage), timestamp: s.Timestamp}}
+				},
+			}, {
+				name:      "container_memory_kernel_max_usage_bytes",
+				help:      "Maximum kernel memory usage recorded for the container in bytes, cgroup v1 only",
+				valueType: prometheus.GaugeValue,
+				getValues: func(s *info.ContainerStats) metricValues {
+					if s.Memory.Kernel == nil {
+						return nil
+					}
+					return metricValues{{value: float64(s.Memory.Kernel.MaxUsage), timestamp: s.Timestamp}}
+				},
+			}, {
+				name:      "container_memory_slab_bytes",
+				help:      "Memory used by the container for in-kernel data structures in bytes, cgroup v2 only",
+				valueType: prometheus.GaugeValue,
+				getValues: func(s *info.ContainerStats) metricValues {
+					if s.Memory.Kernel == nil {
+						return nil
+					}
+					return metricValues{{value: float64(s.Memory.Kernel.Slab), timestamp: s.Timestamp}}
+				},
+			}, {
+				name:      "container_memory_kernel_stack_bytes",
+				help:      "Memory allocated to the kernel stacks of the container in bytes, cgroup v2 only",
+				valueType: prometheus.GaugeValue,
+				getValues: func(s *info.ContainerStats) metricValues {
+					if s.Memory.Kernel == nil {
+						return nil
+					}
+					return metricValues{{value: float64(s.Memory.Kernel.KernelStack), timestamp: s.Timestamp}}
+				},
 			},
 		}...)
 	}
@@ -526,6 +715,22 @@ func NewPrometheusCollector(i infoProvider, f ContainerLabelsFunc, includedMetri
 					}
 					return values
 				},
+			}, {
+				name:        "container_accelerator_process_memory_used_bytes",
+				help:        "Accelerator memory allocated by the processes of the container.",
+				valueType:   prometheus.GaugeValue,
+				extraLabels: []string{"make", "model", "acc_id"},
+				getValues: func(s *info.ContainerStats) metricValues {
+					values := make(metricValues, 0, len(s.Accelerators))
+					for _, value := range s.Accelerators {
+						values = append(values, metricValue{
+							value:     float64(value.ProcessMemoryUsed),
+							labels:    []string{value.Make, value.Model, value.ID},
+							timestamp: s.Timestamp,
+						})
+					}
+					return values
+				},
 			}, {
 				name:        "container_accelerator_duty_cycle",
 				help:        "Percent of time over the past sample period during which the accelerator was actively processing.",
@@ -542,6 +747,38 @@ func NewPrometheusCollector(i infoProvider, f ContainerLabelsFunc, includedMetri
 					}
 					return values
 				},
+			}, {
+				name:        "container_accelerator_encoder_utilization",
+				help:        "Percent of time over the past sample period during which the video encoder of the accelerator was in use.",
+				valueType:   prometheus.GaugeValue,
+				extraLabels: []string{"make", "model", "acc_id"},
+				getValues: func(s *info.ContainerStats) metricValues {
+					values := make(metricValues, 0, len(s.Accelerators))
+					for _, value := range s.Accelerators {
+						values = append(values, metricValue{
+							value:     float64(value.EncoderUtilization),
+							labels:    []string{value.Make, value.Model, value.ID},
+							timestamp: s.Timestamp,
+						})
+					}
+					return values
+				},
+			}, {
+				name:        "container_accelerator_decoder_utilization",
+				help:        "Percent of time over the past sample period during which the video decoder of the accelerator was in use.",
+				valueType:   prometheus.GaugeValue,
+				extraLabels: []string{"make", "model", "acc_id"},
+				getValues: func(s *info.ContainerStats) metricValues {
+					values := make(metricValues, 0, len(s.Accelerators))
+					for _, value := range s.Accelerators {
+						values = append(values, metricValue{
+							value:     float64(value.DecoderUtilization),
+							labels:    []string{value.Make, value.Model, value.ID},
+							timestamp: s.Timestamp,
+						})
+					}
+					return values
+				},
 			},
 		}...)
 	}
@@ -577,6 +814,26 @@ func NewPrometheusCollector(i infoProvider, f ContainerLabelsFunc, includedMetri
 						return float64(fs.Limit)
 					}, s.Timestamp)
 				},
+			}, {
+				name:        "container_fs_tmpfs_limit_bytes",
+				help:        "Number of bytes that can be consumed by the container on this memory-backed filesystem.",
+				valueType:   prometheus.GaugeValue,
+				extraLabels: []string{"mountpoint"},
+				getValues: func(s *info.ContainerStats) metricValues {
+					return tmpfsValues(s.TmpfsFilesystems, func(fs *info.FsStats) float64 {
+						return float64(fs.Limit)
+					}, s.Timestamp)
+				},
+			}, {
+				name:        "container_fs_tmpfs_usage_bytes",
+				help:        "Number of bytes that are consumed on this memory-backed filesystem, charged to the memory of the cgroup that wrote them.",
+				valueType:   prometheus.GaugeValue,
+				extraLabels: []string{"mountpoint"},
+				getValues: func(s *info.ContainerStats) metricValues {
+					return tmpfsValues(s.TmpfsFilesystems, func(fs *info.FsStats) float64 {
+						return float64(fs.Usage)
+					}, s.Timestamp)
+				},
 			}, {
 				name:        "container_fs_usage_bytes",
 				help:        "Number of bytes that are consumed by the container on this filesystem.",
@@ -788,6 +1045,46 @@ func NewPrometheusCollector(i infoProvider, f ContainerLabelsFunc, includedMetri
 					}
 					return values
 				},
+			}, {
+				name:        "container_blkio_device_time_seconds_total",
+				help:        "Cumulative time the block devices were allocated to the container",
+				valueType:   prometheus.CounterValue,
+				extraLabels: []string{"device", "major", "minor"},
+				getValues: func(s *info.ContainerStats) metricValues {
+					values := make(metricValues, 0, len(s.DiskIo.IoTime))
+					for _, diskStat := range s.DiskIo.IoTime {
+						// The blkio time files are in milliseconds.
+						values = append(values, metricValue{
+							value: float64(diskStat.Stats["Count"]) / 1000,
+							labels: []string{diskStat.Device,
+								strconv.Itoa(int(diskStat.Major)),
+								strconv.Itoa(int(diskStat.Minor))},
+							timestamp: s.Timestamp,
+						})
+					}
+					return values
+				},
+			}, {
+				name:        "container_blkio_throttle_utilization",
+				help:        "Fraction of the blkio throttle limits of the block devices used by the container",
+				valueType:   prometheus.GaugeValue,
+				extraLabels: []string{"device", "major", "minor", "limit"},
+				getValues: func(s *info.ContainerStats) metricValues {
+					var values metricValues
+					for _, device := range s.DiskIo.ThrottleUtilization {
+						for limit, value := range device.Utilization {
+							values = append(values, metricValue{
+								value: value,
+								labels: []string{device.Device,
+									strconv.Itoa(int(device.Major)),
+									strconv.Itoa(int(device.Minor)),
+									limit},
+								timestamp: s.Timestamp,
+							})
+						}
+					}
+					return values
+				},
 			},
 		}...)
 	}
@@ -1547,6 +1844,23 @@ func NewPrometheusCollector(i infoProvider, f ContainerLabelsFunc, includedMetri
 					return metricValues{{value: float64(s.Processes.ProcessCount), timestamp: s.Timestamp}}
 				},
 			},
+			{
+				name:        "container_processes_by_state",
+				help:        "Number of processes inside the container by state, e.g. D for uninterruptible sleep or Z for zombie.",
+				valueType:   prometheus.GaugeValue,
+				extraLabels: []string{"state"},
+				getValues: func(s *info.ContainerStats) metricValues {
+					values := make(metricValues, 0, len(s.Processes.States))
+					for state, count := range s.Processes.States {
+						values = append(values, metricValue{
+							value:     float64(count),
+							labels:    []string{state},
+							timestamp: s.Timestamp,
+						})
+					}
+					return values
+				},
+			},
 			{
 				name:      "container_file_descriptors",
 				help:      "Number of open file descriptors for the container.",
@@ -1563,6 +1877,34 @@ func NewPrometheusCollector(i infoProvider, f ContainerLabelsFunc, includedMetri
 					return metricValues{{value: float64(s.Processes.SocketCount), timestamp: s.Timestamp}}
 				},
 			},
+			{
+				name:      "container_pids_limit_hits_total",
+				help:      "Number of times a fork or clone failed because the container reached its pids limit.",
+				valueType: prometheus.CounterValue,
+				getValues: func(s *info.ContainerStats) metricValues {
+					return metricValues{{value: float64(s.Processes.PidsLimitHits), timestamp: s.Timestamp}}
+				},
+			},
+			{
+				name:        "container_context_switches_total",
+				help:        "Number of context switches of the threads of the container, by type. Many involuntary context switches signal contention for the cpu.",
+				valueType:   prometheus.CounterValue,
+				extraLabels: []string{"type"},
+				getValues: func(s *info.ContainerStats) metricValues {
+					return metricValues{
+						{value: float64(s.Processes.VoluntaryContextSwitches), labels: []string{"voluntary"}, timestamp: s.Timestamp},
+						{value: float64(s.Processes.InvoluntaryContextSwitches), labels: []string{"involuntary"}, timestamp: s.Timestamp},
+					}
+				},
+			},
+			{
+				name:      "container_cpu_migrations_total",
+				help:      "Number of migrations between cpus of the threads of the container.",
+				valueType: prometheus.CounterValue,
+				getValues: func(s *info.ContainerStats) metricValues {
+					return metricValues{{value: float64(s.Processes.CpuMigrations), timestamp: s.Timestamp}}
+				},
+			},
 			{
 				name:      "container_threads_max",
 				help:      "Maximum number of threads allowed inside the container, infinity if value is zero",
@@ -1576,6 +1918,23 @@ func NewPrometheusCollector(i infoProvider, f ContainerLabelsFunc, includedMetri
 					}
 				},
 			},
+			{
+				name:        "container_proc_metric",
+				help:        "Value of a file of /proc/<pid>/ of the init process of the container configured with --proc_metrics.",
+				valueType:   prometheus.GaugeValue,
+				extraLabels: []string{"metric"},
+				getValues: func(s *info.ContainerStats) metricValues {
+					values := make(metricValues, 0, len(s.ProcMetrics))
+					for name, value := range s.ProcMetrics {
+						values = append(values, metricValue{
+							value:     value,
+							labels:    []string{name},
+							timestamp: s.Timestamp,
+						})
+					}
+					return values
+				},
+			},
 			{
 				name:      "container_threads",
 				help:      "Number of threads running inside the container",
@@ -1767,17 +2126,74 @@ func NewPrometheusCollector(i infoProvider, f ContainerLabelsFunc, includedMetri
 			},
 		})
 	}
+	if includedMetrics.Has(container.DelayAccountingMetrics) {
+		c.containerMetrics = append(c.containerMetrics, []containerMetric{
+			{
+				name:      "container_blkio_delay_seconds_total",
+				help:      "Cumulative time the processes of the container waited for block IO to complete in seconds",
+				valueType: prometheus.CounterValue,
+				getValues: func(s *info.ContainerStats) metricValues {
+					if s.Delay == nil {
+						return nil
+					}
+					return metricValues{{value: float64(s.Delay.BlkioDelay) / float64(time.Second), timestamp: s.Timestamp}}
+				},
+			}, {
+				name:      "container_swapin_delay_seconds_total",
+				help:      "Cumulative time the processes of the container waited for pages to be swapped in in seconds",
+				valueType: prometheus.CounterValue,
+				getValues: func(s *info.ContainerStats) metricValues {
+					if s.Delay == nil {
+						return nil
+					}
+					return metricValues{{value: float64(s.Delay.SwapinDelay) / float64(time.Second), timestamp: s.Timestamp}}
+				},
+			}, {
+				name:      "container_memory_reclaim_delay_seconds_total",
+				help:      "Cumulative time the processes of the container spent reclaiming memory in seconds",
+				valueType: prometheus.CounterValue,
+				getValues: func(s *info.ContainerStats) metricValues {
+					if s.Delay == nil {
+						return nil
+					}
+					return metricValues{{value: float64(s.Delay.FreepagesDelay) / float64(time.Second), timestamp: s.Timestamp}}
+				},
+			},
+		}...)
+	}
 
 	return c
 }
 
-var (
-	versionInfoDesc = prometheus.NewDesc("cadvisor_version_info", "A metric with a constant '1' value labeled by kernel version, OS version, docker version, cadvisor version & cadvisor revision.", []string{"kernelVersion", "osVersion", "dockerVersion", "cadvisorVersion", "cadvisorRevision"}, nil)
-	startTimeDesc   = prometheus.NewDesc("container_start_time_seconds", "Start time of the container since unix epoch in seconds.", nil, nil)
-	cpuPeriodDesc   = prometheus.NewDesc("container_spec_cpu_period", "CPU period of the container.", nil, nil)
-	cpuQuotaDesc    = prometheus.NewDesc("container_spec_cpu_quota", "CPU quota of the container.", nil, nil)
-	cpuSharesDesc   = prometheus.NewDesc("container_spec_cpu_shares", "CPU share of the container.", nil, nil)
-)
+const containerScrapeErrorHelp = "1 if there was an error while getting container metrics, 0 otherwise"
+
+// WithMetricNamePrefix replaces the container_ prefix of the names of the
+// metrics exported by the collector with the given one, which must be valid
+// according to ValidateMetricNamePrefix.
+func (c *PrometheusCollector) WithMetricNamePrefix(prefix string) *PrometheusCollector {
+	for i := range c.containerMetrics {
+		c.containerMetrics[i].name = prefix + strings.TrimPrefix(c.containerMetrics[i].name, c.metricNamePrefix)
+	}
+	c.metricNamePrefix = prefix
+	c.errors = newScrapeErrorGauge(c.metricName("scrape_error"), containerScrapeErrorHelp)
+	return c
+}
+
+// WithEphemeralThreshold makes the collector skip the containers of a runtime,
+// i.e. having an image, younger than the threshold. Once deleted, they are
+// exported summed by the PrometheusEphemeralCollector instead.
+func (c *PrometheusCollector) WithEphemeralThreshold(threshold time.Duration) *PrometheusCollector {
+	c.ephemeralThreshold = threshold
+	return c
+}
+
+// metricName returns the full name of the container metric with the given
+// name, without prefix.
+func (c *PrometheusCollector) metricName(name string) string {
+	return c.metricNamePrefix + name
+}
+
+var versionInfoDesc = prometheus.NewDesc("cadvisor_version_info", "A metric with a constant '1' value labeled by kernel version, OS version, docker version, cadvisor version & cadvisor revision.", []string{"kernelVersion", "osVersion", "dockerVersion", "cadvisorVersion", "cadvisorRevision"}, nil)
 
 // Describe describes all the metrics ever exported by cadvisor. It
 // implements prometheus.PrometheusCollector.
@@ -1786,10 +2202,11 @@ func (c *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
 	for _, cm := range c.containerMetrics {
 		ch <- cm.desc([]string{})
 	}
-	ch <- startTimeDesc
-	ch <- cpuPeriodDesc
-	ch <- cpuQuotaDesc
-	ch <- cpuSharesDesc
+	ch <- prometheus.NewDesc(c.metricName("start_time_seconds"), "Start time of the container since unix epoch in seconds.", nil, nil)
+	ch <- prometheus.NewDesc(c.metricName("spec_cpu_period"), "CPU period of the container.", nil, nil)
+	ch <- prometheus.NewDesc(c.metricName("spec_cpu_quota"), "CPU quota of the container.", nil, nil)
+	ch <- prometheus.NewDesc(c.metricName("spec_cpu_burst"), "CPU burst of the CFS quota of the container.", nil, nil)
+	ch <- prometheus.NewDesc(c.metricName("spec_cpu_shares"), "CPU share of the container.", nil, nil)
 	ch <- versionInfoDesc
 }
 
@@ -1870,6 +2287,14 @@ func (c *PrometheusCollector) collectContainersInfo(ch chan<- prometheus.Metric)
 		klog.Warningf("Couldn't get containers: %s", err)
 		return
 	}
+	if c.ephemeralThreshold > 0 {
+		now := c.now.Now()
+		for name, cont := range containers {
+			if v2.IsEphemeralContainer(&cont.Spec, c.ephemeralThreshold, now) {
+				delete(containers, name)
+			}
+		}
+	}
 	rawLabels := map[string]struct{}{}
 	for _, container := range containers {
 		for l := range c.containerLabelsFunc(container) {
@@ -1897,27 +2322,35 @@ func (c *PrometheusCollector) collectContainersInfo(ch chan<- prometheus.Metric)
 		}
 
 		// Container spec
-		desc := prometheus.NewDesc("container_start_time_seconds", "Start time of the container since unix epoch in seconds.", labels, nil)
+		desc := prometheus.NewDesc(c.metricName("start_time_seconds"), "Start time of the container since unix epoch in seconds.", labels, nil)
 		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(cont.Spec.CreationTime.Unix()), values...)
 
 		if cont.Spec.HasCpu {
-			desc = prometheus.NewDesc("container_spec_cpu_period", "CPU period of the container.", labels, nil)
+			desc = prometheus.NewDesc(c.metricName("spec_cpu_period"), "CPU period of the container.", labels, nil)
 			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(cont.Spec.Cpu.Period), values...)
 			if cont.Spec.Cpu.Quota != 0 {
-				desc = prometheus.NewDesc("container_spec_cpu_quota", "CPU quota of the container.", labels, nil)
+				desc = prometheus.NewDesc(c.metricName("spec_cpu_quota"), "CPU quota of the container.", labels, nil)
 				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(cont.Spec.Cpu.Quota), values...)
 			}
-			desc := prometheus.NewDesc("container_spec_cpu_shares", "CPU share of the container.", labels, nil)
+			if cont.Spec.Cpu.Burst != 0 {
+				desc = prometheus.NewDesc(c.metricName("spec_cpu_burst"), "CPU burst of the CFS quota of the container.", labels, nil)
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(cont.Spec.Cpu.Burst), values...)
+			}
+			desc := prometheus.NewDesc(c.metricName("spec_cpu_shares"), "CPU share of the container.", labels, nil)
 			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(cont.Spec.Cpu.Limit), values...)
 
 		}
 		if cont.Spec.HasMemory {
-			desc := prometheus.NewDesc("container_spec_memory_limit_bytes", "Memory limit for the container.", labels, nil)
+			desc := prometheus.NewDesc(c.metricName("spec_memory_limit_bytes"), "Memory limit for the container.", labels, nil)
 			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, specMemoryValue(cont.Spec.Memory.Limit), values...)
-			desc = prometheus.NewDesc("container_spec_memory_swap_limit_bytes", "Memory swap limit for the container.", labels, nil)
+			desc = prometheus.NewDesc(c.metricName("spec_memory_swap_limit_bytes"), "Memory swap limit for the container.", labels, nil)
 			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, specMemoryValue(cont.Spec.Memory.SwapLimit), values...)
-			desc = prometheus.NewDesc("container_spec_memory_reservation_limit_bytes", "Memory reservation limit for the container.", labels, nil)
+			desc = prometheus.NewDesc(c.metricName("spec_memory_reservation_limit_bytes"), "Memory reservation limit for the container.", labels, nil)
 			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, specMemoryValue(cont.Spec.Memory.Reservation), values...)
+			desc = prometheus.NewDesc(c.metricName("spec_memory_min_bytes"), "Memory guaranteed to the container, which is never reclaimed.", labels, nil)
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, specMemoryValue(cont.Spec.Memory.Min), values...)
+			desc = prometheus.NewDesc(c.metricName("spec_memory_effective_limit_bytes"), "Lowest memory limit of the container and of its ancestor cgroups.", labels, nil)
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, specMemoryValue(cont.Spec.Memory.EffectiveLimit), values...)
 		}
 
 		// Now for the actual metrics
@@ -1985,6 +2418,19 @@ func sanitizeLabelName(name string) string {
 	return invalidNameCharRE.ReplaceAllString(name, "_")
 }
 
+// reclaimerValues returns the given page reclaim counters of kswapd and of
+// direct reclaim labeled by reclaimer, skipping those the kernel doesn't report.
+func reclaimerValues(kswapd, direct *uint64, timestamp time.Time) metricValues {
+	var values metricValues
+	if kswapd != nil {
+		values = append(values, metricValue{value: float64(*kswapd), labels: []string{"kswapd"}, timestamp: timestamp})
+	}
+	if direct != nil {
+		values = append(values, metricValue{value: float64(*direct), labels: []string{"direct"}, timestamp: timestamp})
+	}
+	return values
+}
+
 func getNumaStatsPerNode(nodeStats map[uint8]uint64, labels []string, timestamp time.Time) metricValues {
 	mValues := make(metricValues, 0, len(nodeStats))
 	for node, stat := range nodeStats {
@@ -0,0 +1,113 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	v2 "github.com/google/cadvisor/info/v2"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s.io/klog/v2"
+)
+
+// diskLatencyProvider will usually be manager.Manager, but can be swapped out for testing.
+type diskLatencyProvider interface {
+	// GetNodeDiskStats provides the utilization of the block devices of the
+	// machine over the last global housekeeping interval.
+	GetNodeDiskStats() ([]v2.NodeDiskStats, error)
+
+	// GetNodeDiskLatency provides the latency histograms of the block devices
+	// of the machine.
+	GetNodeDiskLatency() ([]v2.NodeDiskLatency, error)
+}
+
+var diskLatencyDesc = prometheus.NewDesc(
+	"machine_disk_io_await_seconds",
+	"Average time spent by the requests of the block device completed during the last global housekeeping interval, including the time in queue, in seconds.",
+	[]string{"device"}, nil)
+
+var diskLatencyHistogramDesc = prometheus.NewDesc(
+	"machine_disk_io_latency_seconds",
+	"Time spent by the requests of the block device, including the time in queue, in seconds. Requests are counted in the bucket of the average time of the requests completed during the same global housekeeping interval.",
+	[]string{"device"}, nil)
+
+var diskInFlightDesc = prometheus.NewDesc(
+	"machine_disk_io_in_flight",
+	"Number of requests in flight on the block device at the end of the last global housekeeping interval.",
+	[]string{"device"}, nil)
+
+// PrometheusDiskLatencyCollector implements prometheus.Collector.
+type PrometheusDiskLatencyCollector struct {
+	provider diskLatencyProvider
+	errors   prometheus.Gauge
+}
+
+// NewPrometheusDiskLatencyCollector returns a new PrometheusDiskLatencyCollector
+// exposing the average latency, a latency histogram and the requests in flight
+// of each block device of the machine.
+func NewPrometheusDiskLatencyCollector(p diskLatencyProvider) *PrometheusDiskLatencyCollector {
+	return &PrometheusDiskLatencyCollector{
+		provider: p,
+		errors: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "machine_disk",
+			Name:      "scrape_error",
+			Help:      "1 if there was an error while getting disk latency metrics, 0 otherwise.",
+		}),
+	}
+}
+
+// Describe describes all the metrics ever exported by cadvisor. It
+// implements prometheus.PrometheusCollector.
+func (collector *PrometheusDiskLatencyCollector) Describe(ch chan<- *prometheus.Desc) {
+	collector.errors.Describe(ch)
+	ch <- diskLatencyDesc
+	ch <- diskInFlightDesc
+	ch <- diskLatencyHistogramDesc
+}
+
+// Collect fetches the average latency, the latency histograms and the requests
+// in flight of the block devices and delivers them as Prometheus metrics. It implements prometheus.PrometheusCollector.
+func (collector *PrometheusDiskLatencyCollector) Collect(ch chan<- prometheus.Metric) {
+	collector.errors.Set(0)
+	collector.collectDiskLatency(ch)
+	collector.errors.Collect(ch)
+}
+
+func (collector *PrometheusDiskLatencyCollector) collectDiskLatency(ch chan<- prometheus.Metric) {
+	disks, err := collector.provider.GetNodeDiskStats()
+	if err != nil {
+		collector.errors.Set(1)
+		klog.Warningf("Couldn't get disk latency: %s", err)
+		return
+	}
+
+	for _, disk := range disks {
+		ch <- prometheus.MustNewConstMetric(diskLatencyDesc, prometheus.GaugeValue, disk.Await.Seconds(), disk.Device)
+		ch <- prometheus.MustNewConstMetric(diskInFlightDesc, prometheus.GaugeValue, float64(disk.InFlight), disk.Device)
+	}
+
+	latencies, err := collector.provider.GetNodeDiskLatency()
+	if err != nil {
+		collector.errors.Set(1)
+		klog.Warningf("Couldn't get disk latency histograms: %s", err)
+		return
+	}
+	for _, latency := range latencies {
+		buckets := make(map[float64]uint64, len(latency.Buckets))
+		for _, bucket := range latency.Buckets {
+			buckets[bucket.UpperBound] = bucket.Count
+		}
+		ch <- prometheus.MustNewConstHistogram(diskLatencyHistogramDesc, latency.Count, latency.Sum, buckets, latency.Device)
+	}
+}
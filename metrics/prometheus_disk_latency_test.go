@@ -0,0 +1,99 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	v2 "github.com/google/cadvisor/info/v2"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type testDiskLatencyProvider struct {
+	disks     []v2.NodeDiskStats
+	latencies []v2.NodeDiskLatency
+	err       error
+}
+
+func (p testDiskLatencyProvider) GetNodeDiskStats() ([]v2.NodeDiskStats, error) {
+	return p.disks, p.err
+}
+
+func (p testDiskLatencyProvider) GetNodeDiskLatency() ([]v2.NodeDiskLatency, error) {
+	return p.latencies, p.err
+}
+
+func TestPrometheusDiskLatencyCollector(t *testing.T) {
+	provider := testDiskLatencyProvider{
+		disks: []v2.NodeDiskStats{
+			{Device: "sda", Await: 4 * time.Millisecond, Reads: 8, Writes: 2, InFlight: 3},
+			{Device: "sdb"},
+		},
+		latencies: []v2.NodeDiskLatency{{
+			Device: "sda",
+			Count:  12,
+			Sum:    0.5,
+			Buckets: []v2.HistogramBucket{
+				{UpperBound: 0.0001, Count: 0},
+				{UpperBound: 0.001, Count: 2},
+				{UpperBound: 0.01, Count: 10},
+				{UpperBound: 0.1, Count: 11},
+			},
+		}},
+	}
+	collector := NewPrometheusDiskLatencyCollector(provider)
+
+	expected := `
+# HELP machine_disk_io_await_seconds Average time spent by the requests of the block device completed during the last global housekeeping interval, including the time in queue, in seconds.
+# TYPE machine_disk_io_await_seconds gauge
+machine_disk_io_await_seconds{device="sda"} 0.004
+machine_disk_io_await_seconds{device="sdb"} 0
+# HELP machine_disk_io_in_flight Number of requests in flight on the block device at the end of the last global housekeeping interval.
+# TYPE machine_disk_io_in_flight gauge
+machine_disk_io_in_flight{device="sda"} 3
+machine_disk_io_in_flight{device="sdb"} 0
+# HELP machine_disk_io_latency_seconds Time spent by the requests of the block device, including the time in queue, in seconds. Requests are counted in the bucket of the average time of the requests completed during the same global housekeeping interval.
+# TYPE machine_disk_io_latency_seconds histogram
+machine_disk_io_latency_seconds_bucket{device="sda",le="0.0001"} 0
+machine_disk_io_latency_seconds_bucket{device="sda",le="0.001"} 2
+machine_disk_io_latency_seconds_bucket{device="sda",le="0.01"} 10
+machine_disk_io_latency_seconds_bucket{device="sda",le="0.1"} 11
+machine_disk_io_latency_seconds_bucket{device="sda",le="+Inf"} 12
+machine_disk_io_latency_seconds_sum{device="sda"} 0.5
+machine_disk_io_latency_seconds_count{device="sda"} 12
+# HELP machine_disk_scrape_error 1 if there was an error while getting disk latency metrics, 0 otherwise.
+# TYPE machine_disk_scrape_error gauge
+machine_disk_scrape_error 0
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected))
+	assert.Nil(t, err)
+}
+
+func TestPrometheusDiskLatencyCollectorWithFailure(t *testing.T) {
+	collector := NewPrometheusDiskLatencyCollector(testDiskLatencyProvider{err: fmt.Errorf("failure")})
+
+	expected := `
+# HELP machine_disk_scrape_error 1 if there was an error while getting disk latency metrics, 0 otherwise.
+# TYPE machine_disk_scrape_error gauge
+machine_disk_scrape_error 1
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected))
+	assert.Nil(t, err)
+}
@@ -0,0 +1,152 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"strings"
+	"time"
+
+	v2 "github.com/google/cadvisor/info/v2"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s.io/klog/v2"
+)
+
+// ephemeralStatsProvider will usually be manager.Manager, but can be swapped out for testing.
+type ephemeralStatsProvider interface {
+	// GetEphemeralStats provides the summed stats of the deleted ephemeral
+	// containers by namespace.
+	GetEphemeralStats() ([]v2.EphemeralStats, error)
+}
+
+var ephemeralLabelsNames = []string{"namespace"}
+
+// ephemeralMetric describes a metric used for exposing a certain type of
+// summed statistic of ephemeral containers.
+type ephemeralMetric struct {
+	name     string
+	help     string
+	getValue func(ephemeral *v2.EphemeralStats) float64
+}
+
+func (metric *ephemeralMetric) desc() *prometheus.Desc {
+	return prometheus.NewDesc(metric.name, metric.help, ephemeralLabelsNames, nil)
+}
+
+// PrometheusEphemeralCollector implements prometheus.Collector.
+type PrometheusEphemeralCollector struct {
+	provider         ephemeralStatsProvider
+	errors           prometheus.Gauge
+	ephemeralMetrics []ephemeralMetric
+	metricNamePrefix string
+}
+
+const ephemeralScrapeErrorHelp = "1 if there was an error while getting ephemeral container metrics, 0 otherwise."
+
+// NewPrometheusEphemeralCollector returns a new PrometheusEphemeralCollector
+// exposing the stats of the ephemeral containers deleted since cAdvisor
+// started, summed into one series per namespace. All the metrics are counters,
+// increasing as containers are deleted.
+func NewPrometheusEphemeralCollector(p ephemeralStatsProvider) *PrometheusEphemeralCollector {
+	return &PrometheusEphemeralCollector{
+		provider:         p,
+		errors:           newScrapeErrorGauge(DefaultMetricNamePrefix+"ephemeral_scrape_error", ephemeralScrapeErrorHelp),
+		metricNamePrefix: DefaultMetricNamePrefix,
+		ephemeralMetrics: []ephemeralMetric{
+			{
+				name: "container_ephemeral_containers_total",
+				help: "Number of ephemeral containers deleted.",
+				getValue: func(ephemeral *v2.EphemeralStats) float64 {
+					return float64(ephemeral.Containers)
+				},
+			}, {
+				name: "container_ephemeral_cpu_usage_seconds_total",
+				help: "Cumulative cpu time consumed by the deleted ephemeral containers in seconds.",
+				getValue: func(ephemeral *v2.EphemeralStats) float64 {
+					return float64(ephemeral.CpuUsageTotal) / float64(time.Second)
+				},
+			}, {
+				name: "container_ephemeral_cpu_user_seconds_total",
+				help: "Cumulative user cpu time consumed by the deleted ephemeral containers in seconds.",
+				getValue: func(ephemeral *v2.EphemeralStats) float64 {
+					return float64(ephemeral.CpuUsageUser) / float64(time.Second)
+				},
+			}, {
+				name: "container_ephemeral_cpu_system_seconds_total",
+				help: "Cumulative system cpu time consumed by the deleted ephemeral containers in seconds.",
+				getValue: func(ephemeral *v2.EphemeralStats) float64 {
+					return float64(ephemeral.CpuUsageSystem) / float64(time.Second)
+				},
+			}, {
+				name: "container_ephemeral_network_receive_bytes_total",
+				help: "Cumulative count of bytes received by the deleted ephemeral containers.",
+				getValue: func(ephemeral *v2.EphemeralStats) float64 {
+					return float64(ephemeral.NetworkRxBytes)
+				},
+			}, {
+				name: "container_ephemeral_network_transmit_bytes_total",
+				help: "Cumulative count of bytes transmitted by the deleted ephemeral containers.",
+				getValue: func(ephemeral *v2.EphemeralStats) float64 {
+					return float64(ephemeral.NetworkTxBytes)
+				},
+			},
+		},
+	}
+}
+
+// WithMetricNamePrefix replaces the container_ prefix of the names of the
+// metrics exported by the collector with the given one, e.g. the ephemeral
+// metrics are named <prefix>ephemeral_containers_total.
+func (collector *PrometheusEphemeralCollector) WithMetricNamePrefix(prefix string) *PrometheusEphemeralCollector {
+	for i := range collector.ephemeralMetrics {
+		collector.ephemeralMetrics[i].name = prefix + strings.TrimPrefix(collector.ephemeralMetrics[i].name, collector.metricNamePrefix)
+	}
+	collector.metricNamePrefix = prefix
+	collector.errors = newScrapeErrorGauge(prefix+"ephemeral_scrape_error", ephemeralScrapeErrorHelp)
+	return collector
+}
+
+// Describe describes all the ephemeral container metrics ever exported by
+// cadvisor. It implements prometheus.PrometheusCollector.
+func (collector *PrometheusEphemeralCollector) Describe(ch chan<- *prometheus.Desc) {
+	collector.errors.Describe(ch)
+	for _, metric := range collector.ephemeralMetrics {
+		ch <- metric.desc()
+	}
+}
+
+// Collect fetches the summed stats of ephemeral containers and delivers them
+// as Prometheus metrics. It implements prometheus.PrometheusCollector.
+func (collector *PrometheusEphemeralCollector) Collect(ch chan<- prometheus.Metric) {
+	collector.errors.Set(0)
+	collector.collectEphemeralStats(ch)
+	collector.errors.Collect(ch)
+}
+
+func (collector *PrometheusEphemeralCollector) collectEphemeralStats(ch chan<- prometheus.Metric) {
+	stats, err := collector.provider.GetEphemeralStats()
+	if err != nil {
+		collector.errors.Set(1)
+		klog.Warningf("Couldn't get ephemeral container stats: %s", err)
+		return
+	}
+
+	for i := range stats {
+		ephemeral := &stats[i]
+		for _, metric := range collector.ephemeralMetrics {
+			ch <- prometheus.MustNewConstMetric(metric.desc(), prometheus.CounterValue, metric.getValue(ephemeral), ephemeral.Namespace)
+		}
+	}
+}
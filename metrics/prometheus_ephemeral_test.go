@@ -0,0 +1,108 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/container"
+	v2 "github.com/google/cadvisor/info/v2"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type testEphemeralStatsProvider struct {
+	stats []v2.EphemeralStats
+	err   error
+}
+
+func (p testEphemeralStatsProvider) GetEphemeralStats() ([]v2.EphemeralStats, error) {
+	return p.stats, p.err
+}
+
+func TestPrometheusEphemeralCollector(t *testing.T) {
+	provider := testEphemeralStatsProvider{stats: []v2.EphemeralStats{{
+		Namespace:      "ci",
+		Containers:     42,
+		CpuUsageTotal:  uint64(90 * time.Second),
+		NetworkRxBytes: 1024,
+	}}}
+	collector := NewPrometheusEphemeralCollector(provider)
+
+	expected := `
+# HELP container_ephemeral_containers_total Number of ephemeral containers deleted.
+# TYPE container_ephemeral_containers_total counter
+container_ephemeral_containers_total{namespace="ci"} 42
+# HELP container_ephemeral_cpu_usage_seconds_total Cumulative cpu time consumed by the deleted ephemeral containers in seconds.
+# TYPE container_ephemeral_cpu_usage_seconds_total counter
+container_ephemeral_cpu_usage_seconds_total{namespace="ci"} 90
+# HELP container_ephemeral_network_receive_bytes_total Cumulative count of bytes received by the deleted ephemeral containers.
+# TYPE container_ephemeral_network_receive_bytes_total counter
+container_ephemeral_network_receive_bytes_total{namespace="ci"} 1024
+# HELP container_ephemeral_scrape_error 1 if there was an error while getting ephemeral container metrics, 0 otherwise.
+# TYPE container_ephemeral_scrape_error gauge
+container_ephemeral_scrape_error 0
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "container_ephemeral_containers_total", "container_ephemeral_cpu_usage_seconds_total", "container_ephemeral_network_receive_bytes_total", "container_ephemeral_scrape_error")
+	assert.Nil(t, err)
+}
+
+func TestPrometheusEphemeralCollectorWithMetricNamePrefix(t *testing.T) {
+	provider := testEphemeralStatsProvider{stats: []v2.EphemeralStats{{Namespace: "ci", Containers: 1}}}
+	collector := NewPrometheusEphemeralCollector(provider).WithMetricNamePrefix("node_container_")
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	metricFamilies, err := reg.Gather()
+	assert.NoError(t, err)
+	names := map[string]bool{}
+	for _, metricFamily := range metricFamilies {
+		name := metricFamily.GetName()
+		names[name] = true
+		assert.True(t, strings.HasPrefix(name, "node_container_ephemeral_"), "metric %q lacks the prefix", name)
+	}
+	for _, name := range []string{"node_container_ephemeral_containers_total", "node_container_ephemeral_scrape_error"} {
+		assert.True(t, names[name], "metric %q is missing", name)
+	}
+}
+
+func TestPrometheusCollectorWithEphemeralThreshold(t *testing.T) {
+	// The test container was created more than 4 years before now.
+	for _, tc := range []struct {
+		threshold time.Duration
+		exported  bool
+	}{
+		{0, true},
+		{time.Hour, true},
+		{10 * 365 * 24 * time.Hour, false},
+	} {
+		c := NewPrometheusCollector(testSubcontainersInfoProvider{}, nil, container.MetricSet{container.CpuUsageMetrics: struct{}{}}, now, v2.RequestOptions{}).WithEphemeralThreshold(tc.threshold)
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(c)
+		metricFamilies, err := reg.Gather()
+		assert.NoError(t, err)
+		exported := false
+		for _, metricFamily := range metricFamilies {
+			if metricFamily.GetName() == "container_cpu_usage_seconds_total" {
+				exported = true
+			}
+		}
+		assert.Equal(t, tc.exported, exported, "threshold %v", tc.threshold)
+	}
+}
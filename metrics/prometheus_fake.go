@@ -279,6 +279,7 @@ func (p testSubcontainersInfoProvider) GetRequestedContainersInfo(string, v2.Req
 					Limit:  1000,
 					Period: 100000,
 					Quota:  10000,
+					Burst:  5000,
 				},
 				Memory: info.MemorySpec{
 					Limit:       2048,
@@ -309,16 +310,20 @@ func (p testSubcontainersInfoProvider) GetRequestedContainersInfo(string, v2.Req
 							System: 7,
 						},
 						CFS: info.CpuCFS{
-							Periods:          723,
-							ThrottledPeriods: 18,
-							ThrottledTime:    1724314000,
+							Periods:           723,
+							ThrottledPeriods:  18,
+							ThrottledTime:     1724314000,
+							ThrottledFraction: 0.25,
+							Bursts:            7,
+							BurstTime:         350000000,
 						},
 						Schedstat: info.CpuSchedstat{
 							RunTime:      53643567,
 							RunqueueTime: 479424566378,
 							RunPeriods:   984285,
 						},
-						LoadAverage: 2,
+						LimitUtilization: 0.75,
+						LoadAverage:      2,
 					},
 					Memory: info.MemoryStats{
 						Usage:      8,
@@ -346,6 +351,26 @@ func (p testSubcontainersInfoProvider) GetRequestedContainersInfo(string, v2.Req
 						RSS:        15,
 						MappedFile: 16,
 						Swap:       8192,
+						CgroupV2: &info.MemoryStatsCgroupV2{
+							HighEvents: 42,
+							Reclaim: &info.ReclaimStats{
+								PgscanKswapd:  uint64Ptr(1200),
+								PgscanDirect:  uint64Ptr(300),
+								PgstealKswapd: uint64Ptr(1000),
+								PgstealDirect: uint64Ptr(250),
+								CompactStall:  uint64Ptr(7),
+							},
+						},
+						Kernel: &info.KernelMemoryStats{
+							Usage:       65536,
+							MaxUsage:    131072,
+							Slab:        32768,
+							KernelStack: 16384,
+						},
+						SwapActivity: &info.SwapActivityStats{
+							Pswpin:  320,
+							Pswpout: 640,
+						},
 					},
 					Hugetlb: map[string]info.HugetlbStats{
 						"2Mi": {
@@ -538,6 +563,23 @@ func (p testSubcontainersInfoProvider) GetRequestedContainersInfo(string, v2.Req
 								"Write":   6,
 							},
 						}},
+						IoTime: []info.PerDiskStats{{
+							Device: "/dev/sdb",
+							Major:  8,
+							Minor:  0,
+							Stats: map[string]uint64{
+								"Count": 1500,
+							},
+						}},
+						ThrottleUtilization: []info.PerDiskUtilization{{
+							Device: "/dev/sdb",
+							Major:  8,
+							Minor:  0,
+							Utilization: map[string]float64{
+								info.ReadBpsUtilization:   0.5,
+								info.WriteIopsUtilization: 0.25,
+							},
+						}},
 					},
 					Filesystem: []info.FsStats{
 						{
@@ -577,30 +619,56 @@ func (p testSubcontainersInfoProvider) GetRequestedContainersInfo(string, v2.Req
 							WeightedIoTime:  49,
 						},
 					},
+					TmpfsFilesystems: []info.FsStats{
+						{
+							Device:     "shm",
+							Type:       "tmpfs",
+							MountType:  "tmpfs",
+							Mountpoint: "/dev/shm",
+							Limit:      67108864,
+							Usage:      1048576,
+							HasInodes:  true,
+							Inodes:     1024,
+							InodesFree: 1020,
+						},
+					},
 					Accelerators: []info.AcceleratorStats{
 						{
-							Make:        "nvidia",
-							Model:       "tesla-p100",
-							ID:          "GPU-deadbeef-1234-5678-90ab-feedfacecafe",
-							MemoryTotal: 20304050607,
-							MemoryUsed:  2030405060,
-							DutyCycle:   12,
+							Make:               "nvidia",
+							Model:              "tesla-p100",
+							ID:                 "GPU-deadbeef-1234-5678-90ab-feedfacecafe",
+							MemoryTotal:        20304050607,
+							MemoryUsed:         2030405060,
+							ProcessMemoryUsed:  1015202530,
+							DutyCycle:          12,
+							EncoderUtilization: 30,
+							DecoderUtilization: 45,
 						},
 						{
-							Make:        "nvidia",
-							Model:       "tesla-k80",
-							ID:          "GPU-deadbeef-0123-4567-89ab-feedfacecafe",
-							MemoryTotal: 10203040506,
-							MemoryUsed:  1020304050,
-							DutyCycle:   6,
+							Make:               "nvidia",
+							Model:              "tesla-k80",
+							ID:                 "GPU-deadbeef-0123-4567-89ab-feedfacecafe",
+							MemoryTotal:        10203040506,
+							MemoryUsed:         1020304050,
+							ProcessMemoryUsed:  510152025,
+							DutyCycle:          6,
+							EncoderUtilization: 15,
+							DecoderUtilization: 20,
 						},
 					},
 					Processes: info.ProcessStats{
-						ProcessCount:   1,
-						FdCount:        5,
-						SocketCount:    3,
-						ThreadsCurrent: 5,
-						ThreadsMax:     100,
+						ProcessCount:               1,
+						FdCount:                    5,
+						SocketCount:                3,
+						ThreadsCurrent:             5,
+						ThreadsMax:                 100,
+						PidsLimitHits:              3,
+						VoluntaryContextSwitches:   150,
+						InvoluntaryContextSwitches: 40,
+						CpuMigrations:              12,
+						States: map[string]uint64{
+							"R": 1,
+						},
 						Ulimits: []info.UlimitSpec{
 							{
 								Name:      "max_open_files",
@@ -616,6 +684,11 @@ func (p testSubcontainersInfoProvider) GetRequestedContainersInfo(string, v2.Req
 						NrUninterruptible: 53,
 						NrIoWait:          54,
 					},
+					Delay: &info.DelayStats{
+						BlkioDelay:     1500000000,
+						SwapinDelay:    250000000,
+						FreepagesDelay: 3000000,
+					},
 					CustomMetrics: map[string][]info.MetricVal{
 						"container_custom_app_metric_1": {
 							{
@@ -703,6 +776,7 @@ func (p testSubcontainersInfoProvider) GetRequestedContainersInfo(string, v2.Req
 						},
 					},
 					ReferencedMemory: 1234,
+					ProcMetrics:      map[string]float64{"oom_score": 666, "timerslack_ns": 50000},
 					Resctrl: info.ResctrlStats{
 						MemoryBandwidth: []info.MemoryBandwidthStats{
 							{
@@ -730,6 +804,10 @@ func (p testSubcontainersInfoProvider) GetRequestedContainersInfo(string, v2.Req
 	}, nil
 }
 
+func uint64Ptr(v uint64) *uint64 {
+	return &v
+}
+
 type erroringSubcontainersInfoProvider struct {
 	successfulProvider testSubcontainersInfoProvider
 	shouldFail         bool
@@ -0,0 +1,320 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/cadvisor/container"
+	info "github.com/google/cadvisor/info/v1"
+	v2 "github.com/google/cadvisor/info/v2"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+)
+
+// UnknownGroup is the group of the containers missing the grouping label.
+const UnknownGroup = "unknown"
+
+// PrometheusGroupedCollector implements prometheus.Collector. It exposes the
+// container metrics summed over the containers sharing the same value of a
+// container label, e.g. the team owning them, to reduce the number of series.
+type PrometheusGroupedCollector struct {
+	infoProvider     infoProvider
+	errors           prometheus.Gauge
+	containerMetrics []containerMetric
+	groupLabel       string
+	groupLabelName   string
+	opts             v2.RequestOptions
+	metricNamePrefix string
+
+	// Guards lastCounters and exitedCounters.
+	lock sync.Mutex
+	// Last values of the counters of each member of the groups, by metric,
+	// member and label values.
+	lastCounters []map[string]map[string]*groupedValue
+	// Totals of the counters of the members which exited, by metric and label
+	// values, kept so that the group counters never go down.
+	exitedCounters []map[string]*groupedValue
+}
+
+// NewPrometheusGroupedCollector returns a new PrometheusGroupedCollector
+// grouping containers by the value of their groupLabel container label. Only
+// the containers managed by a container runtime, i.e. having an image, are
+// grouped, so that nested cgroups are not accounted for twice.
+func NewPrometheusGroupedCollector(i infoProvider, groupLabel string, includedMetrics container.MetricSet, now clock.Clock, opts v2.RequestOptions) *PrometheusGroupedCollector {
+	c := &PrometheusGroupedCollector{
+		infoProvider:     i,
+		groupLabel:       groupLabel,
+		groupLabelName:   sanitizeLabelName(ContainerLabelPrefix + groupLabel),
+		errors:           newScrapeErrorGauge(groupedMetricName(DefaultMetricNamePrefix, "scrape_error"), groupedScrapeErrorHelp),
+		opts:             opts,
+		metricNamePrefix: DefaultMetricNamePrefix,
+	}
+	for _, cm := range NewPrometheusCollector(i, nil, includedMetrics, now, opts).containerMetrics {
+		if !additiveMetrics[strings.TrimPrefix(cm.name, DefaultMetricNamePrefix)] {
+			continue
+		}
+		cm.name = groupedMetricName(DefaultMetricNamePrefix, strings.TrimPrefix(cm.name, DefaultMetricNamePrefix))
+		c.containerMetrics = append(c.containerMetrics, cm)
+		c.lastCounters = append(c.lastCounters, map[string]map[string]*groupedValue{})
+		c.exitedCounters = append(c.exitedCounters, map[string]*groupedValue{})
+	}
+	return c
+}
+
+// additiveMetrics are the container metrics, without prefix, whose sum over
+// containers is meaningful. The others, e.g. limits, ratios, timestamps, and
+// the values of devices or filesystems shared by containers, are not grouped.
+var additiveMetrics = map[string]bool{
+	"accelerator_process_memory_used_bytes":  true,
+	"blkio_delay_seconds_total":              true,
+	"blkio_device_time_seconds_total":        true,
+	"blkio_device_usage_total":               true,
+	"context_switches_total":                 true,
+	"cpu_cfs_burst_periods_total":            true,
+	"cpu_cfs_burst_seconds_total":            true,
+	"cpu_cfs_periods_total":                  true,
+	"cpu_cfs_throttled_periods_total":        true,
+	"cpu_cfs_throttled_seconds_total":        true,
+	"cpu_load_average_10s":                   true,
+	"cpu_migrations_total":                   true,
+	"cpu_schedstat_run_periods_total":        true,
+	"cpu_schedstat_run_seconds_total":        true,
+	"cpu_schedstat_runqueue_seconds_total":   true,
+	"cpu_system_seconds_total":               true,
+	"cpu_usage_seconds_total":                true,
+	"cpu_user_seconds_total":                 true,
+	"file_descriptors":                       true,
+	"fs_tmpfs_usage_bytes":                   true,
+	"fs_usage_bytes":                         true,
+	"hugetlb_failcnt":                        true,
+	"hugetlb_usage_bytes":                    true,
+	"llc_occupancy_bytes":                    true,
+	"memory_bandwidth_bytes":                 true,
+	"memory_bandwidth_local_bytes":           true,
+	"memory_cache":                           true,
+	"memory_compaction_stalls_total":         true,
+	"memory_failcnt":                         true,
+	"memory_failures_total":                  true,
+	"memory_high_events_total":               true,
+	"memory_kernel_stack_bytes":              true,
+	"memory_kernel_usage_bytes":              true,
+	"memory_mapped_file":                     true,
+	"memory_numa_pages":                      true,
+	"memory_reclaim_delay_seconds_total":     true,
+	"memory_reclaim_scanned_pages_total":     true,
+	"memory_reclaimed_pages_total":           true,
+	"memory_rss":                             true,
+	"memory_slab_bytes":                      true,
+	"memory_swap":                            true,
+	"memory_swapped_in_pages_total":          true,
+	"memory_swapped_out_pages_total":         true,
+	"memory_usage_bytes":                     true,
+	"memory_working_set_bytes":               true,
+	"network_advance_tcp_stats_total":        true,
+	"network_receive_bytes_total":            true,
+	"network_receive_errors_total":           true,
+	"network_receive_packets_dropped_total":  true,
+	"network_receive_packets_total":          true,
+	"network_tcp6_usage_total":               true,
+	"network_tcp_usage_total":                true,
+	"network_transmit_bytes_total":           true,
+	"network_transmit_errors_total":          true,
+	"network_transmit_packets_dropped_total": true,
+	"network_transmit_packets_total":         true,
+	"network_udp6_usage_total":               true,
+	"network_udp_usage_total":                true,
+	"oom_events_total":                       true,
+	"perf_events_total":                      true,
+	"pids_limit_hits_total":                  true,
+	"processes":                              true,
+	"processes_by_state":                     true,
+	"referenced_bytes":                       true,
+	"sockets":                                true,
+	"swapin_delay_seconds_total":             true,
+	"tasks_state":                            true,
+	"threads":                                true,
+}
+
+const groupedScrapeErrorHelp = "1 if there was an error while getting grouped container metrics, 0 otherwise"
+
+// WithMetricNamePrefix replaces the container_ prefix of the names of the
+// metrics exported by the collector with the given one, e.g. the grouped
+// metrics are named <prefix>group_cpu_usage_seconds_total.
+func (c *PrometheusGroupedCollector) WithMetricNamePrefix(prefix string) *PrometheusGroupedCollector {
+	for i := range c.containerMetrics {
+		name := strings.TrimPrefix(c.containerMetrics[i].name, groupedMetricName(c.metricNamePrefix, ""))
+		c.containerMetrics[i].name = groupedMetricName(prefix, name)
+	}
+	c.metricNamePrefix = prefix
+	c.errors = newScrapeErrorGauge(groupedMetricName(prefix, "scrape_error"), groupedScrapeErrorHelp)
+	return c
+}
+
+// groupedMetricName returns the name of the grouped counterpart of a container
+// metric given without prefix, e.g. container_group_cpu_usage_seconds_total.
+func groupedMetricName(prefix, name string) string {
+	return prefix + "group_" + name
+}
+
+// Describe describes all the grouped metrics ever exported by cadvisor. It
+// implements prometheus.PrometheusCollector.
+func (c *PrometheusGroupedCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.errors.Describe(ch)
+	for _, cm := range c.containerMetrics {
+		ch <- cm.desc([]string{c.groupLabelName})
+	}
+}
+
+// Collect fetches the stats from all containers and delivers their sums by
+// group as Prometheus metrics. It implements prometheus.PrometheusCollector.
+func (c *PrometheusGroupedCollector) Collect(ch chan<- prometheus.Metric) {
+	c.errors.Set(0)
+	c.collectGroups(ch)
+	c.errors.Collect(ch)
+}
+
+// groupedValue is the sum of the values of a metric with the same labels over
+// the containers of a group.
+type groupedValue struct {
+	value  float64
+	labels []string
+}
+
+// groupMember returns the member of a group whose values of the metric are
+// accounted for, and whether the container is that member. The network
+// metrics are those of the network namespace of the container, shared e.g. by
+// the containers of a pod, and are only accounted for once, for the first
+// container of the namespace.
+func groupMember(metricName, containerName string, spec info.ContainerSpec, netnsMembers map[uint64]string) (string, bool) {
+	netns, ok := spec.Namespaces["net"]
+	if !ok || !strings.Contains(metricName, "group_network_") {
+		return containerName, true
+	}
+	if first, ok := netnsMembers[netns]; ok && first != containerName {
+		return "", false
+	}
+	netnsMembers[netns] = containerName
+	return "netns:" + strconv.FormatUint(netns, 10), true
+}
+
+func (c *PrometheusGroupedCollector) collectGroups(ch chan<- prometheus.Metric) {
+	containers, err := c.infoProvider.GetRequestedContainersInfo("/", c.opts)
+	if err != nil {
+		c.errors.Set(1)
+		klog.Warningf("Couldn't get containers: %s", err)
+		return
+	}
+	names := make([]string, 0, len(containers))
+	for name := range containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// Values by metric, then by group and extra label values, and by member
+	// for the counters.
+	sums := make([]map[string]*groupedValue, len(c.containerMetrics))
+	counters := make([]map[string]map[string]*groupedValue, len(c.containerMetrics))
+	for i := range sums {
+		sums[i] = map[string]*groupedValue{}
+		counters[i] = map[string]map[string]*groupedValue{}
+	}
+	netnsMembers := map[uint64]string{}
+	for _, name := range names {
+		cont := containers[name]
+		if cont.Spec.Image == "" {
+			continue
+		}
+		group, ok := cont.Spec.Labels[c.groupLabel]
+		if !ok || group == "" {
+			group = UnknownGroup
+		}
+		for i, cm := range c.containerMetrics {
+			if cm.condition != nil && !cm.condition(cont.Spec) {
+				continue
+			}
+			member, ok := groupMember(cm.name, name, cont.Spec, netnsMembers)
+			if !ok {
+				continue
+			}
+			if len(cont.Stats) == 0 {
+				// A member without stats is accounted for with its last counters.
+				if last, ok := c.lastCounters[i][member]; ok {
+					counters[i][member] = last
+					for key, value := range last {
+						addGroupedValue(sums[i], key, value.labels, value.value)
+					}
+				}
+				continue
+			}
+			for _, metricValue := range cm.getValues(cont.Stats[0]) {
+				labels := append([]string{group}, metricValue.labels...)
+				key := strings.Join(labels, "\xff")
+				addGroupedValue(sums[i], key, labels, metricValue.value)
+				if cm.valueType == prometheus.CounterValue {
+					if counters[i][member] == nil {
+						counters[i][member] = map[string]*groupedValue{}
+					}
+					addGroupedValue(counters[i][member], key, labels, metricValue.value)
+				}
+			}
+		}
+	}
+
+	for i, cm := range c.containerMetrics {
+		if cm.valueType == prometheus.CounterValue {
+			for member, values := range c.lastCounters[i] {
+				if _, ok := counters[i][member]; ok {
+					continue
+				}
+				for key, value := range values {
+					addGroupedValue(c.exitedCounters[i], key, value.labels, value.value)
+				}
+			}
+			c.lastCounters[i] = counters[i]
+			for key, value := range c.exitedCounters[i] {
+				addGroupedValue(sums[i], key, value.labels, value.value)
+			}
+		}
+
+		desc := cm.desc([]string{c.groupLabelName})
+		keys := make([]string, 0, len(sums[i]))
+		for key := range sums[i] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			sum := sums[i][key]
+			ch <- prometheus.MustNewConstMetric(desc, cm.valueType, sum.value, sum.labels...)
+		}
+	}
+}
+
+// addGroupedValue adds value to the sum of the values with the given key.
+func addGroupedValue(sums map[string]*groupedValue, key string, labels []string, value float64) {
+	sum, ok := sums[key]
+	if !ok {
+		sum = &groupedValue{labels: labels}
+		sums[key] = sum
+	}
+	sum.value += value
+}
@@ -0,0 +1,182 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/container"
+	info "github.com/google/cadvisor/info/v1"
+	v2 "github.com/google/cadvisor/info/v2"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type testGroupedInfoProvider struct {
+	testSubcontainersInfoProvider
+	containers map[string]*info.ContainerInfo
+}
+
+func (p testGroupedInfoProvider) GetRequestedContainersInfo(string, v2.RequestOptions) (map[string]*info.ContainerInfo, error) {
+	return p.containers, nil
+}
+
+func groupedTestContainer(name, image string, labels map[string]string, memoryUsage uint64) *info.ContainerInfo {
+	return &info.ContainerInfo{
+		ContainerReference: info.ContainerReference{Name: name},
+		Spec: info.ContainerSpec{
+			Image:     image,
+			Labels:    labels,
+			HasMemory: true,
+		},
+		Stats: []*info.ContainerStats{{
+			Memory: info.MemoryStats{Usage: memoryUsage},
+		}},
+	}
+}
+
+func TestPrometheusGroupedCollector(t *testing.T) {
+	provider := testGroupedInfoProvider{containers: map[string]*info.ContainerInfo{
+		"/":             groupedTestContainer("/", "", nil, 10000),
+		"/docker/a":     groupedTestContainer("/docker/a", "app:1", map[string]string{"team": "storage"}, 100),
+		"/docker/b":     groupedTestContainer("/docker/b", "db:2", map[string]string{"team": "storage"}, 200),
+		"/docker/c":     groupedTestContainer("/docker/c", "web:3", map[string]string{"team": "frontend"}, 400),
+		"/docker/d":     groupedTestContainer("/docker/d", "batch:4", nil, 800),
+		"/docker/empty": groupedTestContainer("/docker/empty", "batch:4", map[string]string{"team": ""}, 1600),
+	}}
+	collector := NewPrometheusGroupedCollector(provider, "team", container.MetricSet{container.MemoryUsageMetrics: struct{}{}}, now, v2.RequestOptions{})
+
+	expected := `
+# HELP container_group_memory_usage_bytes Current memory usage in bytes, including all memory regardless of when it was accessed
+# TYPE container_group_memory_usage_bytes gauge
+container_group_memory_usage_bytes{container_label_team="frontend"} 400
+container_group_memory_usage_bytes{container_label_team="storage"} 300
+container_group_memory_usage_bytes{container_label_team="unknown"} 2400
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "container_group_memory_usage_bytes")
+	assert.NoError(t, err)
+}
+
+func groupedCounterTestContainer(name string, netns uint64, cpuUsage, rxBytes uint64) *info.ContainerInfo {
+	return &info.ContainerInfo{
+		ContainerReference: info.ContainerReference{Name: name},
+		Spec: info.ContainerSpec{
+			Image:      "app:1",
+			Labels:     map[string]string{"team": "storage"},
+			HasCpu:     true,
+			HasNetwork: true,
+			Namespaces: map[string]uint64{"net": netns},
+		},
+		Stats: []*info.ContainerStats{{
+			Cpu: info.CpuStats{Usage: info.CpuUsage{Total: cpuUsage * uint64(time.Second)}},
+			Network: info.NetworkStats{
+				Interfaces: []info.InterfaceStats{{Name: "eth0", RxBytes: rxBytes}},
+			},
+		}},
+	}
+}
+
+func TestPrometheusGroupedCollectorCounters(t *testing.T) {
+	provider := testGroupedInfoProvider{containers: map[string]*info.ContainerInfo{
+		// a and b share their network namespace, e.g. in a pod.
+		"/docker/a": groupedCounterTestContainer("/docker/a", 1, 10, 1000),
+		"/docker/b": groupedCounterTestContainer("/docker/b", 1, 20, 1000),
+		"/docker/c": groupedCounterTestContainer("/docker/c", 2, 40, 4000),
+	}}
+	collector := NewPrometheusGroupedCollector(provider, "team", container.MetricSet{
+		container.CpuUsageMetrics:     struct{}{},
+		container.NetworkUsageMetrics: struct{}{},
+	}, now, v2.RequestOptions{})
+	metrics := []string{"container_group_cpu_usage_seconds_total", "container_group_network_receive_bytes_total"}
+
+	// The network namespace shared by a and b is counted once.
+	expected := `
+# HELP container_group_cpu_usage_seconds_total Cumulative cpu time consumed in seconds.
+# TYPE container_group_cpu_usage_seconds_total counter
+container_group_cpu_usage_seconds_total{container_label_team="storage",cpu="total"} 70
+# HELP container_group_network_receive_bytes_total Cumulative count of bytes received
+# TYPE container_group_network_receive_bytes_total counter
+container_group_network_receive_bytes_total{container_label_team="storage",interface="eth0"} 5000
+`
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected), metrics...))
+
+	// The counters of the containers which exited are kept, and a network
+	// namespace still in use isn't counted as exited.
+	provider.containers["/docker/b"] = groupedCounterTestContainer("/docker/b", 1, 25, 1500)
+	delete(provider.containers, "/docker/a")
+	delete(provider.containers, "/docker/c")
+	expected = `
+# HELP container_group_cpu_usage_seconds_total Cumulative cpu time consumed in seconds.
+# TYPE container_group_cpu_usage_seconds_total counter
+container_group_cpu_usage_seconds_total{container_label_team="storage",cpu="total"} 75
+# HELP container_group_network_receive_bytes_total Cumulative count of bytes received
+# TYPE container_group_network_receive_bytes_total counter
+container_group_network_receive_bytes_total{container_label_team="storage",interface="eth0"} 5500
+`
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected), metrics...))
+}
+
+func TestPrometheusGroupedCollectorWithMetricNamePrefix(t *testing.T) {
+	provider := testGroupedInfoProvider{containers: map[string]*info.ContainerInfo{
+		"/docker/a": groupedTestContainer("/docker/a", "app:1", map[string]string{"team": "storage"}, 100),
+	}}
+	collector := NewPrometheusGroupedCollector(provider, "team", container.MetricSet{container.MemoryUsageMetrics: struct{}{}}, now, v2.RequestOptions{}).WithMetricNamePrefix("node_container_")
+
+	expected := `
+# HELP node_container_group_memory_usage_bytes Current memory usage in bytes, including all memory regardless of when it was accessed
+# TYPE node_container_group_memory_usage_bytes gauge
+node_container_group_memory_usage_bytes{container_label_team="storage"} 100
+# HELP node_container_group_scrape_error 1 if there was an error while getting grouped container metrics, 0 otherwise
+# TYPE node_container_group_scrape_error gauge
+node_container_group_scrape_error 0
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "node_container_group_memory_usage_bytes", "node_container_group_scrape_error")
+	assert.NoError(t, err)
+}
+
+func TestPrometheusGroupedCollectorSkipsNonAdditiveMetrics(t *testing.T) {
+	collector := NewPrometheusGroupedCollector(testGroupedInfoProvider{}, "team", container.AllMetrics, now, v2.RequestOptions{})
+	names := map[string]bool{}
+	for _, cm := range collector.containerMetrics {
+		names[cm.name] = true
+	}
+	assert.True(t, names["container_group_cpu_usage_seconds_total"])
+	assert.True(t, names["container_group_memory_working_set_bytes"])
+	for _, name := range []string{
+		"container_group_last_seen",
+		"container_group_cpu_limit_utilization",
+		"container_group_cpu_cfs_throttled_fraction",
+		"container_group_blkio_throttle_utilization",
+		"container_group_fs_limit_bytes",
+		"container_group_threads_max",
+		"container_group_ulimits_soft",
+		"container_group_perf_events_scaling_ratio",
+	} {
+		assert.False(t, names[name], name)
+	}
+}
+
+func TestAdditiveMetricsExist(t *testing.T) {
+	names := map[string]bool{}
+	for _, cm := range NewPrometheusCollector(testGroupedInfoProvider{}, nil, container.AllMetrics, now, v2.RequestOptions{}).containerMetrics {
+		names[cm.name] = true
+	}
+	for name := range additiveMetrics {
+		assert.True(t, names[DefaultMetricNamePrefix+name], name)
+	}
+}
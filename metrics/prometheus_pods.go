@@ -0,0 +1,176 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"time"
+
+	v2 "github.com/google/cadvisor/info/v2"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s.io/klog/v2"
+)
+
+// podStatsProvider will usually be manager.Manager, but can be swapped out for testing.
+type podStatsProvider interface {
+	// GetPodStats provides the aggregated stats of Kubernetes pods.
+	GetPodStats() ([]v2.PodStats, error)
+}
+
+var podLabelsNames = []string{"pod_uid", "id"}
+
+// podMetric describes a metric used for exposing a certain type of
+// aggregated pod statistic.
+type podMetric struct {
+	name      string
+	help      string
+	valueType prometheus.ValueType
+	getValue  func(pod *v2.PodStats) float64
+}
+
+func (metric *podMetric) desc() *prometheus.Desc {
+	return prometheus.NewDesc(metric.name, metric.help, podLabelsNames, nil)
+}
+
+// PrometheusPodCollector implements prometheus.Collector.
+type PrometheusPodCollector struct {
+	provider   podStatsProvider
+	errors     prometheus.Gauge
+	podMetrics []podMetric
+}
+
+// NewPrometheusPodCollector returns a new PrometheusPodCollector exposing the
+// stats of the containers of each Kubernetes pod summed into one series per pod.
+func NewPrometheusPodCollector(p podStatsProvider) *PrometheusPodCollector {
+	return &PrometheusPodCollector{
+		provider: p,
+		errors: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "pod",
+			Name:      "scrape_error",
+			Help:      "1 if there was an error while getting pod metrics, 0 otherwise.",
+		}),
+		podMetrics: []podMetric{
+			{
+				name:      "pod_cpu_usage_seconds_total",
+				help:      "Cumulative cpu time consumed by the containers of the pod in seconds.",
+				valueType: prometheus.CounterValue,
+				getValue: func(pod *v2.PodStats) float64 {
+					return float64(pod.CpuUsageTotal) / float64(time.Second)
+				},
+			}, {
+				name:      "pod_cpu_user_seconds_total",
+				help:      "Cumulative user cpu time consumed by the containers of the pod in seconds.",
+				valueType: prometheus.CounterValue,
+				getValue: func(pod *v2.PodStats) float64 {
+					return float64(pod.CpuUsageUser) / float64(time.Second)
+				},
+			}, {
+				name:      "pod_cpu_system_seconds_total",
+				help:      "Cumulative system cpu time consumed by the containers of the pod in seconds.",
+				valueType: prometheus.CounterValue,
+				getValue: func(pod *v2.PodStats) float64 {
+					return float64(pod.CpuUsageSystem) / float64(time.Second)
+				},
+			}, {
+				name:      "pod_cpu_request_estimate_cores",
+				help:      "CPU request of the pod in cores, estimated from the cpu shares of its cgroup. 0 without request.",
+				valueType: prometheus.GaugeValue,
+				getValue: func(pod *v2.PodStats) float64 {
+					return float64(pod.CpuRequestMillicores) / 1000
+				},
+			}, {
+				name:      "pod_cpu_limit_cores",
+				help:      "CPU limit of the pod in cores, from the CFS quota of its cgroup. 0 without limit.",
+				valueType: prometheus.GaugeValue,
+				getValue: func(pod *v2.PodStats) float64 {
+					return float64(pod.CpuLimitMillicores) / 1000
+				},
+			}, {
+				name:      "pod_memory_usage_bytes",
+				help:      "Current memory usage of the containers of the pod in bytes, including all memory regardless of when it was accessed.",
+				valueType: prometheus.GaugeValue,
+				getValue: func(pod *v2.PodStats) float64 {
+					return float64(pod.MemoryUsage)
+				},
+			}, {
+				name:      "pod_memory_working_set_bytes",
+				help:      "Current working set of the containers of the pod in bytes.",
+				valueType: prometheus.GaugeValue,
+				getValue: func(pod *v2.PodStats) float64 {
+					return float64(pod.MemoryWorkingSet)
+				},
+			}, {
+				name:      "pod_memory_rss",
+				help:      "Size of RSS of the containers of the pod in bytes.",
+				valueType: prometheus.GaugeValue,
+				getValue: func(pod *v2.PodStats) float64 {
+					return float64(pod.MemoryRSS)
+				},
+			}, {
+				name:      "pod_memory_cache",
+				help:      "Number of bytes of page cache memory of the containers of the pod.",
+				valueType: prometheus.GaugeValue,
+				getValue: func(pod *v2.PodStats) float64 {
+					return float64(pod.MemoryCache)
+				},
+			}, {
+				name:      "pod_processes",
+				help:      "Number of processes running inside the containers of the pod.",
+				valueType: prometheus.GaugeValue,
+				getValue: func(pod *v2.PodStats) float64 {
+					return float64(pod.ProcessCount)
+				},
+			},
+		},
+	}
+}
+
+// Describe describes all the pod metrics ever exported by cadvisor. It
+// implements prometheus.PrometheusCollector.
+func (collector *PrometheusPodCollector) Describe(ch chan<- *prometheus.Desc) {
+	collector.errors.Describe(ch)
+	for _, metric := range collector.podMetrics {
+		ch <- metric.desc()
+	}
+}
+
+// Collect fetches the aggregated stats of pods and delivers them as
+// Prometheus metrics. It implements prometheus.PrometheusCollector.
+func (collector *PrometheusPodCollector) Collect(ch chan<- prometheus.Metric) {
+	collector.errors.Set(0)
+	collector.collectPodStats(ch)
+	collector.errors.Collect(ch)
+}
+
+func (collector *PrometheusPodCollector) collectPodStats(ch chan<- prometheus.Metric) {
+	pods, err := collector.provider.GetPodStats()
+	if err != nil {
+		collector.errors.Set(1)
+		klog.Warningf("Couldn't get pod stats: %s", err)
+		return
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		for _, metric := range collector.podMetrics {
+			prometheusMetric := prometheus.MustNewConstMetric(metric.desc(), metric.valueType, metric.getValue(pod), pod.PodUID, pod.Name)
+			if pod.Timestamp.IsZero() {
+				ch <- prometheusMetric
+			} else {
+				ch <- prometheus.NewMetricWithTimestamp(pod.Timestamp, prometheusMetric)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	v2 "github.com/google/cadvisor/info/v2"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPodStatsProvider struct {
+	pods []v2.PodStats
+	err  error
+}
+
+func (p testPodStatsProvider) GetPodStats() ([]v2.PodStats, error) {
+	return p.pods, p.err
+}
+
+func TestPrometheusPodCollector(t *testing.T) {
+	provider := testPodStatsProvider{pods: []v2.PodStats{{
+		PodUID:               "6a3c1e2f-4d5b-4c8e-9f0a-1b2c3d4e5f60",
+		Name:                 "/kubepods/burstable/pod6a3c1e2f-4d5b-4c8e-9f0a-1b2c3d4e5f60",
+		Containers:           []string{"app", "pause"},
+		CpuUsageTotal:        uint64(3 * time.Second),
+		CpuUsageUser:         uint64(2 * time.Second),
+		CpuUsageSystem:       uint64(time.Second),
+		MemoryUsage:          4096,
+		MemoryWorkingSet:     2048,
+		MemoryRSS:            1024,
+		MemoryCache:          512,
+		ProcessCount:         3,
+		QOSClass:             "Burstable",
+		CpuRequestMillicores: 250,
+		CpuLimitMillicores:   500,
+	}}}
+	collector := NewPrometheusPodCollector(provider)
+
+	expected := `
+# HELP pod_cpu_limit_cores CPU limit of the pod in cores, from the CFS quota of its cgroup. 0 without limit.
+# TYPE pod_cpu_limit_cores gauge
+pod_cpu_limit_cores{id="/kubepods/burstable/pod6a3c1e2f-4d5b-4c8e-9f0a-1b2c3d4e5f60",pod_uid="6a3c1e2f-4d5b-4c8e-9f0a-1b2c3d4e5f60"} 0.5
+# HELP pod_cpu_request_estimate_cores CPU request of the pod in cores, estimated from the cpu shares of its cgroup. 0 without request.
+# TYPE pod_cpu_request_estimate_cores gauge
+pod_cpu_request_estimate_cores{id="/kubepods/burstable/pod6a3c1e2f-4d5b-4c8e-9f0a-1b2c3d4e5f60",pod_uid="6a3c1e2f-4d5b-4c8e-9f0a-1b2c3d4e5f60"} 0.25
+# HELP pod_cpu_usage_seconds_total Cumulative cpu time consumed by the containers of the pod in seconds.
+# TYPE pod_cpu_usage_seconds_total counter
+pod_cpu_usage_seconds_total{id="/kubepods/burstable/pod6a3c1e2f-4d5b-4c8e-9f0a-1b2c3d4e5f60",pod_uid="6a3c1e2f-4d5b-4c8e-9f0a-1b2c3d4e5f60"} 3
+# HELP pod_memory_working_set_bytes Current working set of the containers of the pod in bytes.
+# TYPE pod_memory_working_set_bytes gauge
+pod_memory_working_set_bytes{id="/kubepods/burstable/pod6a3c1e2f-4d5b-4c8e-9f0a-1b2c3d4e5f60",pod_uid="6a3c1e2f-4d5b-4c8e-9f0a-1b2c3d4e5f60"} 2048
+# HELP pod_processes Number of processes running inside the containers of the pod.
+# TYPE pod_processes gauge
+pod_processes{id="/kubepods/burstable/pod6a3c1e2f-4d5b-4c8e-9f0a-1b2c3d4e5f60",pod_uid="6a3c1e2f-4d5b-4c8e-9f0a-1b2c3d4e5f60"} 3
+# HELP pod_scrape_error 1 if there was an error while getting pod metrics, 0 otherwise.
+# TYPE pod_scrape_error gauge
+pod_scrape_error 0
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "pod_cpu_limit_cores", "pod_cpu_request_estimate_cores", "pod_cpu_usage_seconds_total", "pod_memory_working_set_bytes", "pod_processes", "pod_scrape_error")
+	assert.Nil(t, err)
+}
+
+func TestPrometheusPodCollectorWithFailure(t *testing.T) {
+	collector := NewPrometheusPodCollector(testPodStatsProvider{err: fmt.Errorf("failure")})
+
+	expected := `
+# HELP pod_scrape_error 1 if there was an error while getting pod metrics, 0 otherwise.
+# TYPE pod_scrape_error gauge
+pod_scrape_error 1
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected))
+	assert.Nil(t, err)
+}
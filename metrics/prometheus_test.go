@@ -17,6 +17,7 @@ package metrics
 import (
 	"errors"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -44,6 +45,42 @@ func TestPrometheusCollector(t *testing.T) {
 	testPrometheusCollector(t, reg, "testdata/prometheus_metrics")
 }
 
+func TestPrometheusCollectorWithMetricNamePrefix(t *testing.T) {
+	// Custom application metrics are named by their configuration.
+	includedMetrics := container.MetricSet{}
+	for kind := range container.AllMetrics {
+		if kind != container.AppMetrics {
+			includedMetrics[kind] = struct{}{}
+		}
+	}
+	c := NewPrometheusCollector(testSubcontainersInfoProvider{}, nil, includedMetrics, now, v2.RequestOptions{}).WithMetricNamePrefix("node_container_")
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+
+	metricFamilies, err := reg.Gather()
+	assert.NoError(t, err)
+	names := map[string]bool{}
+	for _, metricFamily := range metricFamilies {
+		name := metricFamily.GetName()
+		names[name] = true
+		if name != "cadvisor_version_info" {
+			assert.True(t, strings.HasPrefix(name, "node_container_"), "metric %q lacks the prefix", name)
+		}
+	}
+	for _, name := range []string{"node_container_cpu_usage_seconds_total", "node_container_start_time_seconds", "node_container_spec_cpu_quota", "node_container_scrape_error"} {
+		assert.True(t, names[name], "metric %q is missing", name)
+	}
+}
+
+func TestValidateMetricNamePrefix(t *testing.T) {
+	for _, prefix := range []string{"container_", "node_container_", "cadvisor:"} {
+		assert.NoError(t, ValidateMetricNamePrefix(prefix), prefix)
+	}
+	for _, prefix := range []string{"", "0container_", "node-container_", "container."} {
+		assert.Error(t, ValidateMetricNamePrefix(prefix), prefix)
+	}
+}
+
 func TestPrometheusCollectorWithWhiteList(t *testing.T) {
 	c := NewPrometheusCollector(testSubcontainersInfoProvider{}, func(container *info.ContainerInfo) map[string]string {
 		whitelistedLabels := []string{
@@ -125,3 +125,87 @@ func (g *Group) UnmarshalJSON(b []byte) error {
 	}
 	return fmt.Errorf("unsupported type")
 }
+
+// Perf event types, see perf_event_attr documentation at man perf_event_open.
+const (
+	perfTypeHardware = 0
+	perfTypeSoftware = 1
+	perfTypeHWCache  = 3
+)
+
+// genericEvents are events that the kernel maps to the PMU of every architecture.
+// ref-cycles is left out as only x86 PMUs count it.
+var genericEvents = map[Event]bool{
+	"cycles":                  true,
+	"cpu-cycles":              true,
+	"instructions":            true,
+	"cache-references":        true,
+	"cache-misses":            true,
+	"branches":                true,
+	"branch-instructions":     true,
+	"branch-misses":           true,
+	"bus-cycles":              true,
+	"stalled-cycles-frontend": true,
+	"stalled-cycles-backend":  true,
+	"cpu-clock":               true,
+	"task-clock":              true,
+	"page-faults":             true,
+	"minor-faults":            true,
+	"major-faults":            true,
+	"context-switches":        true,
+	"cpu-migrations":          true,
+	"alignment-faults":        true,
+	"emulation-faults":        true,
+}
+
+// isX86 returns true if model specific events and uncore PMUs known to the
+// perf collector are available on arch.
+func isX86(arch string) bool {
+	return arch == "amd64" || arch == "386"
+}
+
+// eventsForArch returns the subset of events that can be measured on arch. On x86
+// all events are kept. Elsewhere only generic events and custom events of
+// generic types are kept, uncore events are dropped and every dropped event is
+// logged once.
+func eventsForArch(events PerfEvents, arch string) PerfEvents {
+	if isX86(arch) {
+		return events
+	}
+
+	supported := map[Event]bool{}
+	customEvents := []CustomEvent{}
+	for _, event := range events.Core.CustomEvents {
+		switch event.Type {
+		case perfTypeHardware, perfTypeSoftware, perfTypeHWCache:
+			supported[event.Name] = true
+			customEvents = append(customEvents, event)
+		}
+	}
+
+	groups := []Group{}
+	for _, group := range events.Core.Events {
+		unsupported := []Event{}
+		for _, event := range group.events {
+			if !genericEvents[event] && !supported[event] {
+				unsupported = append(unsupported, event)
+			}
+		}
+		if len(unsupported) > 0 {
+			klog.Warningf("Perf events %v are not available on %s, skipping event group %v", unsupported, arch, group.events)
+			continue
+		}
+		groups = append(groups, group)
+	}
+
+	if len(events.Uncore.Events) > 0 {
+		klog.Warningf("Uncore perf events are not available on %s, skipping %d uncore event group(s)", arch, len(events.Uncore.Events))
+	}
+
+	return PerfEvents{
+		Core: Events{
+			Events:       groups,
+			CustomEvents: customEvents,
+		},
+	}
+}
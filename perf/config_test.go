@@ -49,3 +49,37 @@ func TestConfigParsing(t *testing.T) {
 	assert.Equal(t, Event("cas_count_write"), events.Uncore.CustomEvents[0].Name)
 
 }
+
+func TestEventsForArch(t *testing.T) {
+	file, err := os.Open("testing/perf.json")
+	assert.Nil(t, err)
+	defer file.Close()
+
+	events, err := parseConfig(file)
+	assert.Nil(t, err)
+
+	// All events are kept on x86.
+	assert.Equal(t, events, eventsForArch(events, "amd64"))
+
+	// Only generic events are kept elsewhere. The first group uses a raw
+	// custom event and uncore events are x86 specific.
+	arm64 := eventsForArch(events, "arm64")
+	assert.Len(t, arm64.Core.Events, 1)
+	assert.Equal(t, []Event{"cycles"}, arm64.Core.Events[0].events)
+	assert.Empty(t, arm64.Core.CustomEvents)
+	assert.Empty(t, arm64.Uncore.Events)
+	assert.Empty(t, arm64.Uncore.CustomEvents)
+
+	// Custom events of generic types are kept.
+	events.Core.CustomEvents = append(events.Core.CustomEvents, CustomEvent{Type: perfTypeSoftware, Config: Config{0x2}, Name: "page_faults"})
+	events.Core.Events = append(events.Core.Events, Group{events: []Event{"instructions", "page_faults"}, array: true})
+	arm64 = eventsForArch(events, "arm64")
+	assert.Len(t, arm64.Core.Events, 2)
+	assert.Equal(t, []Event{"instructions", "page_faults"}, arm64.Core.Events[1].events)
+	assert.Len(t, arm64.Core.CustomEvents, 1)
+
+	// ref-cycles is only counted by x86 PMUs.
+	events.Core.Events = append(events.Core.Events, Group{events: []Event{"ref-cycles"}, array: true})
+	assert.Len(t, eventsForArch(events, "arm64").Core.Events, 2)
+	assert.Len(t, eventsForArch(events, "amd64").Core.Events, len(events.Core.Events))
+}
@@ -21,6 +21,9 @@ package perf
 import (
 	"fmt"
 	"os"
+	"runtime"
+
+	"k8s.io/klog/v2"
 
 	info "github.com/google/cadvisor/info/v1"
 	"github.com/google/cadvisor/stats"
@@ -53,6 +56,12 @@ func NewManager(configFile string, topology []info.Node) (stats.Manager, error)
 		return nil, fmt.Errorf("there is no events in config file %q", configFile)
 	}
 
+	config = eventsForArch(config, runtime.GOARCH)
+	if len(config.Core.Events) == 0 && len(config.Uncore.Events) == 0 {
+		klog.Warningf("None of the perf events in config file %q are available on %s. Perf event counters are not available.", configFile, runtime.GOARCH)
+		return &stats.NoopManager{}, nil
+	}
+
 	onlineCPUs := sysinfo.GetOnlineCPUs(topology)
 
 	cpuToSocket := make(map[int]int)
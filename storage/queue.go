@@ -0,0 +1,163 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"sync"
+
+	info "github.com/google/cadvisor/info/v1"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+// QueuePolicy tells what to do with the stats added to a full queue.
+type QueuePolicy string
+
+const (
+	// QueueBlock waits for the storage driver to make room in the queue,
+	// delaying the housekeeping of the container.
+	QueueBlock QueuePolicy = "block"
+	// QueueDropOldest drops the oldest stats of the queue.
+	QueueDropOldest QueuePolicy = "drop-oldest"
+	// QueueDropNewest drops the stats being added.
+	QueueDropNewest QueuePolicy = "drop-newest"
+)
+
+// ParseQueuePolicy parses the name of a queue policy.
+func ParseQueuePolicy(name string) (QueuePolicy, error) {
+	switch policy := QueuePolicy(name); policy {
+	case QueueBlock, QueueDropOldest, QueueDropNewest:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown queue policy %q, options are %s, %s and %s", name, QueueBlock, QueueDropOldest, QueueDropNewest)
+}
+
+// QueueLength tracks the number of stats waiting in the queue of each storage
+// driver.
+var QueueLength = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "cadvisor_storage_queue_length",
+	Help: "Number of container stats waiting in the queue of the storage driver.",
+}, []string{"driver"})
+
+// QueueDrops counts the stats dropped because the queue of a storage driver
+// was full.
+var QueueDrops = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cadvisor_storage_queue_dropped_total",
+	Help: "Number of container stats dropped because the queue of the storage driver was full.",
+}, []string{"driver"})
+
+type queuedStats struct {
+	cInfo *info.ContainerInfo
+	stats *info.ContainerStats
+}
+
+type queueingDriver struct {
+	name   string
+	driver StorageDriver
+	policy QueuePolicy
+	queue  chan queuedStats
+	done   chan struct{}
+
+	// Held for writing when closing the queue, so that no stats are added
+	// to it afterwards.
+	lock   sync.RWMutex
+	closed bool
+}
+
+// NewQueueingDriver returns a storage driver adding the stats to driver from
+// a goroutine, through a queue of at most size stats. When the queue is full,
+// the stats are handled according to policy. name identifies the driver in
+// the queue metrics. With a size of zero, it returns driver as is.
+func NewQueueingDriver(name string, driver StorageDriver, size int, policy QueuePolicy) StorageDriver {
+	if size <= 0 {
+		return driver
+	}
+	d := &queueingDriver{
+		name:   name,
+		driver: driver,
+		policy: policy,
+		queue:  make(chan queuedStats, size),
+		done:   make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+func (d *queueingDriver) run() {
+	defer close(d.done)
+	for item := range d.queue {
+		QueueLength.WithLabelValues(d.name).Set(float64(len(d.queue)))
+		if err := d.driver.AddStats(item.cInfo, item.stats); err != nil {
+			klog.Error(err)
+		}
+	}
+}
+
+func (d *queueingDriver) AddStats(cInfo *info.ContainerInfo, stats *info.ContainerStats) error {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if d.closed {
+		return fmt.Errorf("storage driver %q is closed", d.name)
+	}
+
+	item := queuedStats{cInfo: cInfo, stats: stats}
+	switch d.policy {
+	case QueueDropNewest:
+		select {
+		case d.queue <- item:
+		default:
+			d.dropped()
+		}
+	case QueueDropOldest:
+		for sent := false; !sent; {
+			select {
+			case d.queue <- item:
+				sent = true
+			default:
+				// The driver may take the oldest stats meanwhile, in
+				// which case there is room for these ones already.
+				select {
+				case <-d.queue:
+					d.dropped()
+				default:
+				}
+			}
+		}
+	default:
+		d.queue <- item
+	}
+	QueueLength.WithLabelValues(d.name).Set(float64(len(d.queue)))
+	return nil
+}
+
+func (d *queueingDriver) dropped() {
+	QueueDrops.WithLabelValues(d.name).Inc()
+	klog.V(4).Infof("Queue of storage driver %q is full, dropping stats", d.name)
+}
+
+// Close waits for the queued stats to be added to the driver before closing
+// it.
+func (d *queueingDriver) Close() error {
+	d.lock.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.lock.Unlock()
+	<-d.done
+	return d.driver.Close()
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stalledDriver records the stats added to it, once released.
+type stalledDriver struct {
+	recordingDriver
+	received chan struct{}
+	release  chan struct{}
+}
+
+func (d *stalledDriver) AddStats(cInfo *info.ContainerInfo, stats *info.ContainerStats) error {
+	d.received <- struct{}{}
+	<-d.release
+	return d.recordingDriver.AddStats(cInfo, stats)
+}
+
+func statsAt(second int64) *info.ContainerStats {
+	return &info.ContainerStats{Timestamp: time.Unix(second, 0)}
+}
+
+func TestQueueingDriverDropsOldest(t *testing.T) {
+	stalled := &stalledDriver{
+		received: make(chan struct{}, 10),
+		release:  make(chan struct{}),
+	}
+	drops := QueueDrops.WithLabelValues("drop-oldest-test")
+	initialDrops := testutil.ToFloat64(drops)
+	driver := NewQueueingDriver("drop-oldest-test", stalled, 3, QueueDropOldest)
+
+	// The driver stalls on the first stats, leaving the queue to fill.
+	require.NoError(t, driver.AddStats(&info.ContainerInfo{}, statsAt(1)))
+	<-stalled.received
+	for second := int64(2); second <= 6; second++ {
+		require.NoError(t, driver.AddStats(&info.ContainerInfo{}, statsAt(second)))
+	}
+	assert.Equal(t, 3.0, testutil.ToFloat64(QueueLength.WithLabelValues("drop-oldest-test")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(drops)-initialDrops)
+
+	close(stalled.release)
+	require.NoError(t, driver.Close())
+	var seconds []int64
+	for _, stats := range stalled.stats {
+		seconds = append(seconds, stats.Timestamp.Unix())
+	}
+	assert.Equal(t, []int64{1, 4, 5, 6}, seconds)
+	assert.Equal(t, 0.0, testutil.ToFloat64(QueueLength.WithLabelValues("drop-oldest-test")))
+	assert.Error(t, driver.AddStats(&info.ContainerInfo{}, statsAt(7)))
+}
+
+func TestQueueingDriverDropsNewest(t *testing.T) {
+	stalled := &stalledDriver{
+		received: make(chan struct{}, 10),
+		release:  make(chan struct{}),
+	}
+	drops := QueueDrops.WithLabelValues("drop-newest-test")
+	initialDrops := testutil.ToFloat64(drops)
+	driver := NewQueueingDriver("drop-newest-test", stalled, 2, QueueDropNewest)
+
+	require.NoError(t, driver.AddStats(&info.ContainerInfo{}, statsAt(1)))
+	<-stalled.received
+	for second := int64(2); second <= 5; second++ {
+		require.NoError(t, driver.AddStats(&info.ContainerInfo{}, statsAt(second)))
+	}
+	assert.Equal(t, 2.0, testutil.ToFloat64(drops)-initialDrops)
+
+	close(stalled.release)
+	require.NoError(t, driver.Close())
+	var seconds []int64
+	for _, stats := range stalled.stats {
+		seconds = append(seconds, stats.Timestamp.Unix())
+	}
+	assert.Equal(t, []int64{1, 2, 3}, seconds)
+}
+
+func TestQueueingDriverWithoutQueue(t *testing.T) {
+	recorder := &recordingDriver{}
+	assert.Equal(t, recorder, NewQueueingDriver("test", recorder, 0, QueueBlock))
+}
+
+func TestParseQueuePolicy(t *testing.T) {
+	for _, name := range []string{"block", "drop-oldest", "drop-newest"} {
+		policy, err := ParseQueuePolicy(name)
+		assert.NoError(t, err)
+		assert.Equal(t, QueuePolicy(name), policy)
+	}
+	_, err := ParseQueuePolicy("drop-random")
+	assert.Error(t, err)
+}
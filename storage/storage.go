@@ -38,6 +38,16 @@ func RegisterStorageDriver(name string, f StorageDriverFunc) {
 	registeredPlugins[name] = f
 }
 
+// Storage drivers whose backends expect the stats in their original units.
+var fixedUnitsDrivers = map[string]bool{}
+
+// RegisterFixedUnitsDriver marks the storage driver as pushing the stats to a
+// backend expecting them in their original units, e.g. the cpu times in
+// nanoseconds, so that the transforms changing units are rejected for it.
+func RegisterFixedUnitsDriver(name string) {
+	fixedUnitsDrivers[name] = true
+}
+
 func New(name string) (StorageDriver, error) {
 	if name == "" {
 		return nil, nil
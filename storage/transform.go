@@ -0,0 +1,303 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// Transform modifies the stats of a container before they are handed to a
+// storage driver, e.g. to convert their units or drop the ones a backend does
+// not need.
+type Transform interface {
+	// Transform returns the transformed stats, or nil to drop them. It must
+	// not modify stats, nor the maps and slices it references, as they are
+	// shared with the cache and the other storage drivers.
+	Transform(cInfo *info.ContainerInfo, stats *info.ContainerStats) (*info.ContainerStats, error)
+}
+
+// TransformFunc is a function implementing Transform.
+type TransformFunc func(cInfo *info.ContainerInfo, stats *info.ContainerStats) (*info.ContainerStats, error)
+
+func (f TransformFunc) Transform(cInfo *info.ContainerInfo, stats *info.ContainerStats) (*info.ContainerStats, error) {
+	return f(cInfo, stats)
+}
+
+// TransformFactory creates a transform given its argument.
+type TransformFactory func(arg string) (Transform, error)
+
+var registeredTransforms = map[string]TransformFactory{
+	"select":        newSelectTransform,
+	"cpu_unit":      newCpuUnitTransform,
+	"memory_unit":   newMemoryUnitTransform,
+	"rename_metric": newRenameMetricTransform,
+}
+
+func RegisterTransform(name string, f TransformFactory) {
+	registeredTransforms[name] = f
+}
+
+func ListTransforms() []string {
+	transforms := make([]string, 0, len(registeredTransforms))
+	for name := range registeredTransforms {
+		transforms = append(transforms, name)
+	}
+	sort.Strings(transforms)
+	return transforms
+}
+
+// NewTransforms creates the transforms listed in spec, separated by
+// semicolons, each one given as name or name:arg, e.g.
+// "select:cpu,memory;memory_unit:KiB".
+func NewTransforms(spec string) ([]Transform, error) {
+	var transforms []Transform
+	for _, item := range strings.Split(spec, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, arg := item, ""
+		if i := strings.Index(item, ":"); i >= 0 {
+			name, arg = item[:i], item[i+1:]
+		}
+		f, ok := registeredTransforms[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown stats transform: %s", name)
+		}
+		transform, err := f(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stats transform %q: %v", item, err)
+		}
+		transforms = append(transforms, transform)
+	}
+	return transforms, nil
+}
+
+// unitTransform is a transform converting the units of the stats.
+type unitTransform struct {
+	TransformFunc
+	name string
+}
+
+// CheckTransforms returns an error if one of the transforms converts the
+// units of the stats pushed to driver while its backend expects them in their
+// original units.
+func CheckTransforms(driver string, transforms []Transform) error {
+	if !fixedUnitsDrivers[driver] {
+		return nil
+	}
+	for _, transform := range transforms {
+		if unit, ok := transform.(unitTransform); ok {
+			return fmt.Errorf("stats transform %s can't be applied to the storage driver %s, which expects the stats in their original units", unit.name, driver)
+		}
+	}
+	return nil
+}
+
+type transformingDriver struct {
+	driver     StorageDriver
+	transforms []Transform
+}
+
+// NewTransformingDriver returns a storage driver applying the transforms, in
+// order, to the stats before adding them to driver. Without transforms, it
+// returns driver as is.
+func NewTransformingDriver(driver StorageDriver, transforms []Transform) StorageDriver {
+	if len(transforms) == 0 {
+		return driver
+	}
+	return &transformingDriver{driver: driver, transforms: transforms}
+}
+
+func (d *transformingDriver) AddStats(cInfo *info.ContainerInfo, stats *info.ContainerStats) error {
+	var err error
+	for _, transform := range d.transforms {
+		stats, err = transform.Transform(cInfo, stats)
+		if err != nil {
+			return fmt.Errorf("failed to transform stats of container %q: %v", cInfo.Name, err)
+		}
+		if stats == nil {
+			// The stats were dropped.
+			return nil
+		}
+	}
+	return d.driver.AddStats(cInfo, stats)
+}
+
+func (d *transformingDriver) Close() error {
+	return d.driver.Close()
+}
+
+// statsSections holds the index of each section of the stats, i.e. of each
+// field of info.ContainerStats but the timestamp, by JSON name.
+var statsSections = func() map[string]int {
+	sections := map[string]int{}
+	statsType := reflect.TypeOf(info.ContainerStats{})
+	for i := 0; i < statsType.NumField(); i++ {
+		name := strings.Split(statsType.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || name == "timestamp" {
+			continue
+		}
+		sections[name] = i
+	}
+	return sections
+}()
+
+// newSelectTransform returns a transform keeping only the comma-separated
+// sections of the stats, named after their JSON field, e.g. "cpu,memory".
+func newSelectTransform(arg string) (Transform, error) {
+	var fields []int
+	for _, section := range strings.Split(arg, ",") {
+		field, ok := statsSections[strings.TrimSpace(section)]
+		if !ok {
+			return nil, fmt.Errorf("unknown stats section %q", section)
+		}
+		fields = append(fields, field)
+	}
+	return TransformFunc(func(_ *info.ContainerInfo, stats *info.ContainerStats) (*info.ContainerStats, error) {
+		selected := &info.ContainerStats{Timestamp: stats.Timestamp}
+		dst, src := reflect.ValueOf(selected).Elem(), reflect.ValueOf(stats).Elem()
+		for _, field := range fields {
+			dst.Field(field).Set(src.Field(field))
+		}
+		return selected, nil
+	}), nil
+}
+
+var cpuUnits = map[string]uint64{"ns": 1, "us": 1000, "ms": 1000000, "s": 1000000000}
+
+// cpuTimeFields returns the fields of cpu in nanoseconds, copying the slices
+// they are in so that they can be modified.
+func cpuTimeFields(cpu *info.CpuStats) []*uint64 {
+	fields := []*uint64{
+		&cpu.Usage.Total,
+		&cpu.Usage.User,
+		&cpu.Usage.System,
+		&cpu.CFS.ThrottledTime,
+		&cpu.CFS.BurstTime,
+		&cpu.Schedstat.RunTime,
+		&cpu.Schedstat.RunqueueTime,
+	}
+	if cpu.Usage.PerCpu != nil {
+		cpu.Usage.PerCpu = append([]uint64(nil), cpu.Usage.PerCpu...)
+		for i := range cpu.Usage.PerCpu {
+			fields = append(fields, &cpu.Usage.PerCpu[i])
+		}
+	}
+	return fields
+}
+
+// newCpuUnitTransform returns a transform converting the cpu times, in
+// nanoseconds, to the unit given as ns, us, ms or s.
+func newCpuUnitTransform(arg string) (Transform, error) {
+	divisor, ok := cpuUnits[arg]
+	if !ok {
+		return nil, fmt.Errorf("unknown cpu unit %q", arg)
+	}
+	return unitTransform{name: "cpu_unit", TransformFunc: TransformFunc(func(_ *info.ContainerInfo, stats *info.ContainerStats) (*info.ContainerStats, error) {
+		scaled := *stats
+		for _, field := range cpuTimeFields(&scaled.Cpu) {
+			*field /= divisor
+		}
+		return &scaled, nil
+	})}, nil
+}
+
+var memoryUnits = map[string]uint64{"B": 1, "KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30}
+
+// memoryByteFields returns the usages of memory in bytes, copying the
+// structures they are in so that they can be modified. The limits are left
+// out, as they may be unlimited.
+func memoryByteFields(memory *info.MemoryStats) []*uint64 {
+	fields := []*uint64{
+		&memory.Usage,
+		&memory.MaxUsage,
+		&memory.Cache,
+		&memory.RSS,
+		&memory.Swap,
+		&memory.MappedFile,
+		&memory.WorkingSet,
+	}
+	if memory.CgroupV2 != nil {
+		v2 := *memory.CgroupV2
+		memory.CgroupV2 = &v2
+		fields = append(fields, &v2.Anon, &v2.File, &v2.Kernel, &v2.KernelStack, &v2.PageTables, &v2.Slab,
+			&v2.SlabReclaimable, &v2.SlabUnreclaimable, &v2.Sock, &v2.Shmem, &v2.FileDirty, &v2.FileWriteback)
+		if v2.Zswap != nil {
+			zswap := *v2.Zswap
+			v2.Zswap = &zswap
+			fields = append(fields, &zswap.Usage)
+		}
+	}
+	if memory.TCP != nil {
+		tcp := *memory.TCP
+		memory.TCP = &tcp
+		fields = append(fields, &tcp.Usage, &tcp.MaxUsage)
+	}
+	if memory.Kernel != nil {
+		kernel := *memory.Kernel
+		memory.Kernel = &kernel
+		fields = append(fields, &kernel.Usage, &kernel.MaxUsage, &kernel.Slab, &kernel.KernelStack)
+	}
+	return fields
+}
+
+// newMemoryUnitTransform returns a transform converting the memory usages, in
+// bytes, to the unit given as B, KiB, MiB or GiB.
+func newMemoryUnitTransform(arg string) (Transform, error) {
+	divisor, ok := memoryUnits[arg]
+	if !ok {
+		return nil, fmt.Errorf("unknown memory unit %q", arg)
+	}
+	return unitTransform{name: "memory_unit", TransformFunc: TransformFunc(func(_ *info.ContainerInfo, stats *info.ContainerStats) (*info.ContainerStats, error) {
+		scaled := *stats
+		for _, field := range memoryByteFields(&scaled.Memory) {
+			*field /= divisor
+		}
+		return &scaled, nil
+	})}, nil
+}
+
+// newRenameMetricTransform returns a transform renaming custom metrics, given
+// as comma-separated old=new pairs.
+func newRenameMetricTransform(arg string) (Transform, error) {
+	names := map[string]string{}
+	for _, pair := range strings.Split(arg, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid metric renaming %q: must be old=new", pair)
+		}
+		names[parts[0]] = parts[1]
+	}
+	return TransformFunc(func(_ *info.ContainerInfo, stats *info.ContainerStats) (*info.ContainerStats, error) {
+		if len(stats.CustomMetrics) == 0 {
+			return stats, nil
+		}
+		renamed := *stats
+		renamed.CustomMetrics = make(map[string][]info.MetricVal, len(stats.CustomMetrics))
+		for name, values := range stats.CustomMetrics {
+			if newName, ok := names[name]; ok {
+				name = newName
+			}
+			renamed.CustomMetrics[name] = values
+		}
+		return &renamed, nil
+	}), nil
+}
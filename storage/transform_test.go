@@ -0,0 +1,154 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingDriver records the stats added to it.
+type recordingDriver struct {
+	stats []*info.ContainerStats
+}
+
+func (d *recordingDriver) AddStats(cInfo *info.ContainerInfo, stats *info.ContainerStats) error {
+	d.stats = append(d.stats, stats)
+	return nil
+}
+
+func (d *recordingDriver) Close() error {
+	return nil
+}
+
+func testStats() *info.ContainerStats {
+	stats := &info.ContainerStats{Timestamp: time.Unix(1618309500, 0)}
+	stats.Cpu.Usage.Total = 3000000
+	stats.Cpu.Usage.PerCpu = []uint64{1000000, 2000000}
+	stats.Memory.Usage = 4 << 20
+	stats.Memory.WorkingSet = 2 << 20
+	stats.Network.RxBytes = 1024
+	stats.CustomMetrics = map[string][]info.MetricVal{"requests": {{FloatValue: 10}}}
+	return stats
+}
+
+func TestTransformingDriverChainsTransforms(t *testing.T) {
+	transforms, err := NewTransforms("select:cpu,memory,custom_metrics; memory_unit:KiB;cpu_unit:ms")
+	require.NoError(t, err)
+	require.Len(t, transforms, 3)
+	recorder := &recordingDriver{}
+	driver := NewTransformingDriver(recorder, transforms)
+
+	stats := testStats()
+	require.NoError(t, driver.AddStats(&info.ContainerInfo{}, stats))
+
+	expected := &info.ContainerStats{Timestamp: stats.Timestamp}
+	expected.Cpu.Usage.Total = 3
+	expected.Cpu.Usage.PerCpu = []uint64{1, 2}
+	expected.Memory.Usage = 4096
+	expected.Memory.WorkingSet = 2048
+	expected.CustomMetrics = map[string][]info.MetricVal{"requests": {{FloatValue: 10}}}
+	assert.Equal(t, []*info.ContainerStats{expected}, recorder.stats)
+
+	// The original stats are preserved.
+	assert.Equal(t, testStats(), stats)
+}
+
+func TestSelectTransformSections(t *testing.T) {
+	// Every field of the stats but the timestamp is a section.
+	assert.Equal(t, reflect.TypeOf(info.ContainerStats{}).NumField()-1, len(statsSections))
+
+	transforms, err := NewTransforms("select:network,perf_uncore_stats")
+	require.NoError(t, err)
+	stats := testStats()
+	stats.PerfUncoreStats = []info.PerfUncoreStat{{Socket: 1}}
+	selected, err := transforms[0].Transform(&info.ContainerInfo{}, stats)
+	require.NoError(t, err)
+
+	expected := &info.ContainerStats{Timestamp: stats.Timestamp}
+	expected.Network = stats.Network
+	expected.PerfUncoreStats = stats.PerfUncoreStats
+	assert.Equal(t, expected, selected)
+}
+
+func TestUnitTransformsNestedFields(t *testing.T) {
+	transforms, err := NewTransforms("memory_unit:KiB;cpu_unit:us")
+	require.NoError(t, err)
+	stats := testStats()
+	stats.Cpu.CFS.BurstTime = 5000
+	stats.Memory.CgroupV2 = &info.MemoryStatsCgroupV2{Anon: 8192, Zswap: &info.ZswapStats{Usage: 4096, Limit: 1 << 62}}
+	stats.Memory.Kernel = &info.KernelMemoryStats{Usage: 2048}
+
+	scaled := stats
+	for _, transform := range transforms {
+		scaled, err = transform.Transform(&info.ContainerInfo{}, scaled)
+		require.NoError(t, err)
+	}
+	assert.EqualValues(t, 5, scaled.Cpu.CFS.BurstTime)
+	assert.EqualValues(t, 8, scaled.Memory.CgroupV2.Anon)
+	assert.EqualValues(t, 4, scaled.Memory.CgroupV2.Zswap.Usage)
+	assert.EqualValues(t, uint64(1<<62), scaled.Memory.CgroupV2.Zswap.Limit)
+	assert.EqualValues(t, 2, scaled.Memory.Kernel.Usage)
+
+	// The structures referenced by the original stats are preserved.
+	assert.EqualValues(t, 8192, stats.Memory.CgroupV2.Anon)
+	assert.EqualValues(t, 4096, stats.Memory.CgroupV2.Zswap.Usage)
+	assert.EqualValues(t, 2048, stats.Memory.Kernel.Usage)
+}
+
+func TestRenameMetricTransform(t *testing.T) {
+	transforms, err := NewTransforms("rename_metric:requests=http_requests,errors=http_errors")
+	require.NoError(t, err)
+	stats := testStats()
+	renamed, err := transforms[0].Transform(&info.ContainerInfo{}, stats)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]info.MetricVal{"http_requests": {{FloatValue: 10}}}, renamed.CustomMetrics)
+	assert.Equal(t, testStats(), stats)
+}
+
+func TestTransformingDriverWithoutTransforms(t *testing.T) {
+	transforms, err := NewTransforms("")
+	require.NoError(t, err)
+	recorder := &recordingDriver{}
+	assert.Equal(t, recorder, NewTransformingDriver(recorder, transforms))
+}
+
+func TestNewTransformsErrors(t *testing.T) {
+	for _, spec := range []string{"unknown", "select:cpu,unknown", "cpu_unit:minutes", "memory_unit:", "rename_metric:requests", "select:timestamp"} {
+		_, err := NewTransforms(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestCheckTransforms(t *testing.T) {
+	defer delete(fixedUnitsDrivers, "fixed")
+	RegisterFixedUnitsDriver("fixed")
+
+	units, err := NewTransforms("select:cpu,memory;memory_unit:KiB")
+	require.NoError(t, err)
+	others, err := NewTransforms("select:cpu,memory;rename_metric:requests=http_requests")
+	require.NoError(t, err)
+
+	// The unit conversions are rejected for the drivers with fixed units only.
+	assert.Error(t, CheckTransforms("fixed", units))
+	assert.NoError(t, CheckTransforms("fixed", others))
+	assert.NoError(t, CheckTransforms("stdout", units))
+}
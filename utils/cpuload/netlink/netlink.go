@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"os"
 	"syscall"
+	"unsafe"
 
 	info "github.com/google/cadvisor/info/v1"
 	"golang.org/x/sys/unix"
@@ -130,6 +131,13 @@ func prepareCmdMessage(id uint16, cfd uintptr) (msg netlinkMessage) {
 	return prepareMessage(id, unix.CGROUPSTATS_CMD_GET, buf.Bytes())
 }
 
+// Prepares message to query task stats for a thread group.
+func prepareTaskStatsMessage(id uint16, tgid uint32) (msg netlinkMessage) {
+	buf := bytes.NewBuffer([]byte{})
+	addAttribute(buf, unix.TASKSTATS_CMD_ATTR_TGID, tgid, 4)
+	return prepareMessage(id, unix.TASKSTATS_CMD_GET, buf.Bytes())
+}
+
 // Extracts returned family id from the response.
 func parseFamilyResp(msg syscall.NetlinkMessage) (uint16, error) {
 	m := new(netlinkMessage)
@@ -199,6 +207,48 @@ func parseLoadStatsResp(msg syscall.NetlinkMessage) (*loadStatsResp, error) {
 	return m, err
 }
 
+// Extract the task stats of a thread group from response returned by kernel.
+func parseTaskStatsResp(msg syscall.NetlinkMessage) (*unix.Taskstats, error) {
+	err := verifyHeader(msg)
+	if err != nil {
+		return nil, err
+	}
+	sizeofGenMsghdr := int(unsafe.Sizeof(genMsghdr{}))
+	if len(msg.Data) < sizeofGenMsghdr {
+		return nil, fmt.Errorf("task stats response too short: %d bytes", len(msg.Data))
+	}
+	return findTaskStats(msg.Data[sizeofGenMsghdr:])
+}
+
+// Scan the attributes for the task stats. The kernel nests them with the pid
+// or tgid in an aggregate attribute.
+func findTaskStats(data []byte) (*unix.Taskstats, error) {
+	for len(data) >= syscall.SizeofRtAttr {
+		attrLen := int(Endian.Uint16(data))
+		attrType := Endian.Uint16(data[2:])
+		if attrLen < syscall.SizeofRtAttr || attrLen > len(data) {
+			return nil, fmt.Errorf("invalid attribute length %d", attrLen)
+		}
+		payload := data[syscall.SizeofRtAttr:attrLen]
+		switch attrType {
+		case unix.TASKSTATS_TYPE_AGGR_PID, unix.TASKSTATS_TYPE_AGGR_TGID:
+			return findTaskStats(payload)
+		case unix.TASKSTATS_TYPE_STATS:
+			// Older kernels report a shorter structure, the fields they
+			// lack stay zero.
+			stats := new(unix.Taskstats)
+			copy((*[unsafe.Sizeof(unix.Taskstats{})]byte)(unsafe.Pointer(stats))[:], payload)
+			return stats, nil
+		}
+		next := attrLen + padding(attrLen, syscall.NLMSG_ALIGNTO)
+		if next >= len(data) {
+			break
+		}
+		data = data[next:]
+	}
+	return nil, fmt.Errorf("task stats not found in the response")
+}
+
 // Verify and return any error reported by kernel.
 func verifyHeader(msg syscall.NetlinkMessage) error {
 	switch msg.Header.Type {
@@ -207,11 +257,11 @@ func verifyHeader(msg syscall.NetlinkMessage) error {
 	case syscall.NLMSG_ERROR:
 		buf := bytes.NewBuffer(msg.Data)
 		var errno int32
-		err := binary.Read(buf, Endian, errno)
+		err := binary.Read(buf, Endian, &errno)
 		if err != nil {
 			return err
 		}
-		return fmt.Errorf("netlink request failed with error %s", syscall.Errno(-errno))
+		return fmt.Errorf("netlink request failed with error %w", syscall.Errno(-errno))
 	}
 	return nil
 }
@@ -238,3 +288,21 @@ func getLoadStats(id uint16, cfd *os.File, conn *Connection) (info.LoadStats, er
 	}
 	return parsedmsg.Stats, nil
 }
+
+// Get task stats for a thread group.
+// id: family id for taskstats.
+// tgid: id of the thread group, i.e. pid of the process.
+// conn: open netlink connection used to communicate with kernel.
+func getTaskStats(id uint16, tgid int, conn *Connection) (*unix.Taskstats, error) {
+	msg := prepareTaskStatsMessage(id, uint32(tgid))
+	err := conn.WriteMessage(msg.toRawMsg())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	return parseTaskStatsResp(resp)
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netlink
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// Response of a kernel 6.18 to a TASKSTATS_CMD_GET of a thread group, without
+// the netlink header.
+var taskStatsResp = strings.Join([]string{
+	"020100004002050008000200813700003402030010000000000000000000000000000000130000000000000077821e00",
+	"00000000000000000000000000000000000000000000000000000000000000000000000000093d0000000000365a2c00",
+	"000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+	"0000000000000000000000000000000000000000dd190000000000000000000000000000a00f00000000000000000000",
+	"000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+	"000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+	"000000000a0000000000000008000000000000000000000000000000000000000000000000093d000000000000000000",
+	"000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+	"000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+	"0000000000000000000000000000000000000000398c0a0000000000398c0a0000000000000000000000000000000000",
+	"000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+	"000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+	"00000000",
+}, "")
+
+func TestParseTaskStatsResp(t *testing.T) {
+	data, err := hex.DecodeString(taskStatsResp)
+	require.NoError(t, err)
+	msg := syscall.NetlinkMessage{
+		Header: syscall.NlMsghdr{Len: uint32(syscall.NLMSG_HDRLEN + len(data)), Type: 31},
+		Data:   data,
+	}
+
+	stats, err := parseTaskStatsResp(msg)
+	require.NoError(t, err)
+	assert.EqualValues(t, 16, stats.Version)
+	assert.EqualValues(t, 19, stats.Cpu_count)
+	assert.EqualValues(t, 1999479, stats.Cpu_delay_total)
+	assert.EqualValues(t, 0, stats.Blkio_delay_total)
+	assert.EqualValues(t, 4000000, stats.Cpu_run_real_total)
+	assert.EqualValues(t, 10, stats.Nvcsw)
+	assert.EqualValues(t, 8, stats.Nivcsw)
+
+	// Truncated attributes.
+	msg.Data = data[:40]
+	_, err = parseTaskStatsResp(msg)
+	assert.Error(t, err)
+}
+
+func TestParseTaskStatsRespError(t *testing.T) {
+	errno := -int32(unix.ESRCH)
+	data := make([]byte, 4)
+	Endian.PutUint32(data, uint32(errno))
+	msg := syscall.NetlinkMessage{
+		Header: syscall.NlMsghdr{Type: syscall.NLMSG_ERROR},
+		Data:   data,
+	}
+
+	_, err := parseTaskStatsResp(msg)
+	assert.True(t, errors.Is(err, syscall.ESRCH), "%v", err)
+}
@@ -15,8 +15,11 @@
 package netlink
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"sync"
+	"syscall"
 
 	info "github.com/google/cadvisor/info/v1"
 
@@ -25,7 +28,9 @@ import (
 
 type NetlinkReader struct {
 	familyID uint16
-	conn     *Connection
+	// lock serializes the requests on conn.
+	lock sync.Mutex
+	conn *Connection
 }
 
 func New() (*NetlinkReader, error) {
@@ -71,10 +76,39 @@ func (r *NetlinkReader) GetCpuLoad(name string, path string) (info.LoadStats, er
 	}
 	defer cfd.Close()
 
+	r.lock.Lock()
 	stats, err := getLoadStats(r.familyID, cfd, r.conn)
+	r.lock.Unlock()
 	if err != nil {
 		return info.LoadStats{}, err
 	}
 	klog.V(4).Infof("Task stats for %q: %+v", path, stats)
 	return stats, nil
 }
+
+// Returns the delays of the threads of each of the given processes, by pid,
+// from the kernel delay accounting. Each process is queried once, by tgid,
+// which includes the delays of its threads which exited. The processes
+// exiting in the meantime are skipped. Requires CAP_NET_ADMIN.
+func (r *NetlinkReader) GetDelayStats(pids []int) (map[int]info.DelayStats, error) {
+	delays := make(map[int]info.DelayStats, len(pids))
+	for _, pid := range pids {
+		// The lock is only held for each request, so that the requests of
+		// other containers are not held up by the processes of a large one.
+		r.lock.Lock()
+		stats, err := getTaskStats(r.familyID, pid, r.conn)
+		r.lock.Unlock()
+		if errors.Is(err, syscall.ESRCH) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get task stats of process %d: %w", pid, err)
+		}
+		delays[pid] = info.DelayStats{
+			BlkioDelay:     stats.Blkio_delay_total,
+			SwapinDelay:    stats.Swapin_delay_total,
+			FreepagesDelay: stats.Freepages_delay_total,
+		}
+	}
+	return delays, nil
+}
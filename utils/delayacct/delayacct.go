@@ -0,0 +1,52 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package delayacct reads the delays of the tasks of containers from the
+// kernel delay accounting.
+package delayacct
+
+import (
+	"fmt"
+	"os"
+
+	info "github.com/google/cadvisor/info/v1"
+
+	"github.com/google/cadvisor/utils/cpuload/netlink"
+	"k8s.io/klog/v2"
+)
+
+type DelayReader interface {
+	// Retrieve the delays of the threads of each of the given processes, by
+	// pid. The processes which exited are missing.
+	GetDelayStats(pids []int) (map[int]info.DelayStats, error)
+
+	// Stop the reader and clean up internal state.
+	Stop()
+}
+
+// New returns a reader of the taskstats netlink interface, failing when
+// cAdvisor lacks CAP_NET_ADMIN.
+func New() (DelayReader, error) {
+	reader, err := netlink.New()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a netlink based delay reader: %v", err)
+	}
+	// Check the permission to query the task stats upfront.
+	if _, err := reader.GetDelayStats([]int{os.Getpid()}); err != nil {
+		reader.Stop()
+		return nil, fmt.Errorf("failed to read task stats, CAP_NET_ADMIN is required: %v", err)
+	}
+	klog.V(4).Info("Using a netlink-based delay reader")
+	return reader, nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package diskstats computes the utilization of the block devices of the
+// machine from successive snapshots of /proc/diskstats.
+package diskstats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v2 "github.com/google/cadvisor/info/v2"
+)
+
+// Stats are the cumulative counters of a block device in /proc/diskstats.
+type Stats struct {
+	ReadsCompleted  uint64
+	ReadTime        uint64 // Milliseconds.
+	WritesCompleted uint64
+	WriteTime       uint64 // Milliseconds.
+	IoInProgress    uint64
+	IoTime          uint64 // Milliseconds.
+	WeightedIoTime  uint64 // Milliseconds.
+}
+
+// Snapshot are the stats of the block devices at a point in time.
+type Snapshot struct {
+	Timestamp time.Time
+	Devices   map[string]Stats
+}
+
+// Parse parses the content of /proc/diskstats. Only the devices for which
+// isWholeDevice returns true are kept, so that the IO of a partition is not
+// accounted for twice along with the one of its device.
+func Parse(r io.Reader, isWholeDevice func(name string) bool) (map[string]Stats, error) {
+	devices := map[string]Stats{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// 8       0 sda 4011 1187 275316 2152 3211 2650 126034 6219 0 5068 8372
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 14 {
+			return nil, fmt.Errorf("could not parse all 11 columns of /proc/diskstats line %q", scanner.Text())
+		}
+		name := fields[2]
+		if !isWholeDevice(name) {
+			continue
+		}
+		var values [11]uint64
+		for i := range values {
+			value, err := strconv.ParseUint(fields[i+3], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse /proc/diskstats line %q: %v", scanner.Text(), err)
+			}
+			values[i] = value
+		}
+		devices[name] = Stats{
+			ReadsCompleted:  values[0],
+			ReadTime:        values[3],
+			WritesCompleted: values[4],
+			WriteTime:       values[7],
+			IoInProgress:    values[8],
+			IoTime:          values[9],
+			WeightedIoTime:  values[10],
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// Read reads a snapshot of the stats of the given whole block devices from the
+// diskstats file at path.
+func Read(path string, wholeDevices map[string]struct{}) (Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer file.Close()
+
+	timestamp := time.Now()
+	devices, err := Parse(file, func(name string) bool {
+		_, ok := wholeDevices[name]
+		return ok
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{Timestamp: timestamp, Devices: devices}, nil
+}
+
+// Utilization computes the utilization of each block device over the interval
+// between two snapshots. Devices missing from either snapshot, or whose
+// counters were reset, are skipped.
+func Utilization(prev, cur Snapshot) []v2.NodeDiskStats {
+	interval := cur.Timestamp.Sub(prev.Timestamp)
+	if interval <= 0 {
+		return nil
+	}
+	intervalMs := float64(interval) / float64(time.Millisecond)
+
+	result := make([]v2.NodeDiskStats, 0, len(cur.Devices))
+	for name, c := range cur.Devices {
+		p, ok := prev.Devices[name]
+		if !ok || c.ReadsCompleted < p.ReadsCompleted || c.WritesCompleted < p.WritesCompleted ||
+			c.ReadTime < p.ReadTime || c.WriteTime < p.WriteTime || c.IoTime < p.IoTime || c.WeightedIoTime < p.WeightedIoTime {
+			continue
+		}
+		reads := c.ReadsCompleted - p.ReadsCompleted
+		writes := c.WritesCompleted - p.WritesCompleted
+		readTime := c.ReadTime - p.ReadTime
+		writeTime := c.WriteTime - p.WriteTime
+
+		stats := v2.NodeDiskStats{
+			Device:       name,
+			Timestamp:    cur.Timestamp,
+			Interval:     interval,
+			Utilization:  100 * float64(c.IoTime-p.IoTime) / intervalMs,
+			AvgQueueSize: float64(c.WeightedIoTime-p.WeightedIoTime) / intervalMs,
+			ReadAwait:    await(readTime, reads),
+			WriteAwait:   await(writeTime, writes),
+			Await:        await(readTime+writeTime, reads+writes),
+			Reads:        reads,
+			Writes:       writes,
+			InFlight:     c.IoInProgress,
+		}
+		// The IO time can slightly exceed the interval as the counters and the
+		// timestamps are not read atomically.
+		if stats.Utilization > 100 {
+			stats.Utilization = 100
+		}
+		result = append(result, stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Device < result[j].Device
+	})
+	return result
+}
+
+// await returns the average time spent by the given number of requests, which
+// spent the given time in milliseconds.
+func await(timeMs, requests uint64) time.Duration {
+	if requests == 0 {
+		return 0
+	}
+	return time.Duration(timeMs) * time.Millisecond / time.Duration(requests)
+}
+
+// NewLatency returns an empty latency histogram of the given device with the
+// given bucket upper bounds in seconds, in increasing order.
+func NewLatency(device string, upperBounds []float64) *v2.NodeDiskLatency {
+	latency := &v2.NodeDiskLatency{
+		Device:  device,
+		Buckets: make([]v2.HistogramBucket, len(upperBounds)),
+	}
+	for i, upperBound := range upperBounds {
+		latency.Buckets[i].UpperBound = upperBound
+	}
+	return latency
+}
+
+// ObserveLatency adds the requests completed during the interval of stats to
+// the latency histogram. /proc/diskstats only reports the total time spent by
+// requests, so all of them are counted in the bucket of their average time,
+// i.e. the average is weighted by the number of requests.
+func ObserveLatency(latency *v2.NodeDiskLatency, stats v2.NodeDiskStats) {
+	requests := stats.Reads + stats.Writes
+	if requests == 0 {
+		return
+	}
+	seconds := stats.Await.Seconds()
+	latency.Count += requests
+	latency.Sum += seconds * float64(requests)
+	for i := range latency.Buckets {
+		if seconds <= latency.Buckets[i].UpperBound {
+			latency.Buckets[i].Count += requests
+		}
+	}
+}
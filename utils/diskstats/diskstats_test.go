@@ -0,0 +1,98 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskstats
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v2 "github.com/google/cadvisor/info/v2"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var wholeDevices = map[string]struct{}{"sda": {}, "nvme0n1": {}}
+
+func TestParse(t *testing.T) {
+	devices, err := Parse(strings.NewReader("   8       0 sda 1 2 3 4 5 6 7 8 9 10 11\n   8       1 sda1 1 2 3 4 5 6 7 8 9 10 11\n"), func(name string) bool {
+		return name == "sda"
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Stats{
+		"sda": {ReadsCompleted: 1, ReadTime: 4, WritesCompleted: 5, WriteTime: 8, IoInProgress: 9, IoTime: 10, WeightedIoTime: 11},
+	}, devices)
+
+	_, err = Parse(strings.NewReader("   8       0 sda 1 2 3\n"), func(string) bool { return true })
+	assert.Error(t, err)
+}
+
+func TestUtilization(t *testing.T) {
+	prev, err := Read("testdata/diskstats.1", wholeDevices)
+	assert.NoError(t, err)
+	cur, err := Read("testdata/diskstats.2", wholeDevices)
+	assert.NoError(t, err)
+	prev.Timestamp = time.Unix(1000, 0)
+	cur.Timestamp = prev.Timestamp.Add(10 * time.Second)
+
+	expected := []v2.NodeDiskStats{
+		{
+			Device:    "nvme0n1",
+			Timestamp: cur.Timestamp,
+			Interval:  10 * time.Second,
+		},
+		{
+			Device:       "sda",
+			Timestamp:    cur.Timestamp,
+			Interval:     10 * time.Second,
+			Utilization:  25,
+			AvgQueueSize: 0.4,
+			ReadAwait:    2 * time.Millisecond,
+			WriteAwait:   12 * time.Millisecond,
+			Await:        4 * time.Millisecond,
+			Reads:        400,
+			Writes:       100,
+			InFlight:     1,
+		},
+	}
+	assert.Equal(t, expected, Utilization(prev, cur))
+}
+
+func TestUtilizationSkipsResetCounters(t *testing.T) {
+	prev := Snapshot{Timestamp: time.Unix(1000, 0), Devices: map[string]Stats{"sda": {IoTime: 100}}}
+	cur := Snapshot{Timestamp: time.Unix(1010, 0), Devices: map[string]Stats{"sda": {IoTime: 10}, "sdb": {IoTime: 10}}}
+	assert.Empty(t, Utilization(prev, cur))
+}
+
+func TestObserveLatency(t *testing.T) {
+	latency := NewLatency("sda", []float64{0.001, 0.002, 0.004})
+	ObserveLatency(latency, v2.NodeDiskStats{Device: "sda", Await: 2 * time.Millisecond, Reads: 3, Writes: 1})
+	ObserveLatency(latency, v2.NodeDiskStats{Device: "sda", Await: 10 * time.Millisecond, Reads: 1})
+	ObserveLatency(latency, v2.NodeDiskStats{Device: "sda"})
+
+	expected := &v2.NodeDiskLatency{
+		Device: "sda",
+		Count:  5,
+		Sum:    0.018,
+		Buckets: []v2.HistogramBucket{
+			{UpperBound: 0.001, Count: 0},
+			{UpperBound: 0.002, Count: 4},
+			{UpperBound: 0.004, Count: 4},
+		},
+	}
+	assert.InDelta(t, expected.Sum, latency.Sum, 1e-9)
+	latency.Sum = expected.Sum
+	assert.Equal(t, expected, latency)
+}
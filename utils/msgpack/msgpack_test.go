@@ -0,0 +1,105 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package msgpack
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func populatedContainerStats() *info.ContainerStats {
+	timestamp := time.Unix(1618309500, 123456789)
+	return &info.ContainerStats{
+		Timestamp: timestamp,
+		Cpu: info.CpuStats{
+			Usage: info.CpuUsage{
+				Total:  math.MaxUint64,
+				PerCpu: []uint64{1000, 2000},
+				User:   2500,
+				System: 500,
+			},
+			CFS:         info.CpuCFS{Periods: 100, ThrottledPeriods: 25, ThrottledTime: 123456, ThrottledFraction: 0.25},
+			Schedstat:   info.CpuSchedstat{RunTime: 1000, RunqueueTime: 200, RunPeriods: 3},
+			LoadAverage: 2,
+		},
+		DiskIo: info.DiskIoStats{
+			IoServiceBytes: []info.PerDiskStats{{Device: "/dev/sda", Major: 8, Stats: map[string]uint64{"Read": 1024, "Write": 2048}}},
+		},
+		Memory: info.MemoryStats{
+			Usage:      4096,
+			WorkingSet: 2048,
+			ContainerData: info.MemoryStatsMemoryData{
+				Pgfault: 10,
+				NumaStats: info.MemoryNumaStats{
+					File: map[uint8]uint64{0: 100, 1: 200},
+				},
+			},
+		},
+		Hugetlb: map[string]info.HugetlbStats{"2MB": {Usage: 4194304, MaxUsage: 8388608, Failcnt: 1}},
+		Network: info.NetworkStats{
+			InterfaceStats: info.InterfaceStats{Name: "eth0", RxBytes: 1500, TxBytes: 3000},
+			Interfaces:     []info.InterfaceStats{{Name: "eth0", RxBytes: 1500, TxBytes: 3000}},
+			Tcp:            info.TcpStat{Established: 3, Listen: 1},
+		},
+		Filesystem: []info.FsStats{{Device: "/dev/sda1", Type: "vfs", Limit: 1 << 40, Usage: 1 << 30, HasInodes: true, Inodes: 100, InodesFree: 50}},
+		TaskStats:  info.LoadStats{NrRunning: 2, NrSleeping: 5},
+		Processes:  info.ProcessStats{ProcessCount: 2, FdCount: 10, SchedRunTime: 1000, SchedWaitTime: 200},
+		CustomMetrics: map[string][]info.MetricVal{
+			"requests": {{Label: "code", Labels: map[string]string{"code": "200"}, Timestamp: timestamp, IntValue: -42}},
+			"latency":  {{Timestamp: timestamp, FloatValue: 0.125}},
+		},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	stats := populatedContainerStats()
+	out, err := Marshal(stats)
+	require.NoError(t, err)
+
+	var decoded info.ContainerStats
+	require.NoError(t, Unmarshal(out, &decoded))
+	assert.Equal(t, stats, &decoded)
+
+	jsonOut, err := json.Marshal(stats)
+	require.NoError(t, err)
+	assert.True(t, len(out) < len(jsonOut), "msgpack encoding of %d bytes is not smaller than JSON encoding of %d bytes", len(out), len(jsonOut))
+}
+
+func TestJSONFieldNames(t *testing.T) {
+	out, err := Marshal(info.ContainerStats{Timestamp: time.Unix(1618309500, 0)})
+	require.NoError(t, err)
+
+	var decoded map[string]interface{}
+	require.NoError(t, Unmarshal(out, &decoded))
+	assert.Contains(t, decoded, "timestamp")
+	assert.IsType(t, time.Time{}, decoded["timestamp"])
+	assert.Contains(t, decoded, "cpu")
+	// Empty fields tagged omitempty are omitted.
+	assert.NotContains(t, decoded, "hugetlb")
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	var stats info.ContainerStats
+	assert.Error(t, Unmarshal([]byte{0x81, 0xa1}, &stats), "truncated")
+	assert.Error(t, Unmarshal([]byte{0xdd, 0xff, 0xff, 0xff, 0xff}, &stats), "array longer than the data")
+	assert.Error(t, Unmarshal([]byte{0x80}, stats), "not a pointer")
+}
@@ -0,0 +1,160 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimitedlog provides a logger that deduplicates identical
+// messages, so that errors repeated every housekeeping interval by the
+// collection path do not flood the logs.
+package ratelimitedlog
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+)
+
+var logRateLimitInterval = flag.Duration("log_rate_limit_interval", time.Minute, "Interval during which identical messages logged while collecting container stats are only logged once, the number of suppressed repetitions being reported when the message is logged again. Set to 0 to log every message.")
+
+type severity int
+
+const (
+	infoSeverity severity = iota
+	warningSeverity
+	errorSeverity
+)
+
+type entry struct {
+	severity severity
+	msg      string
+	// Time the message was last written to the log.
+	logged time.Time
+	// Number of times the message was suppressed since then.
+	suppressed uint64
+}
+
+// Logger writes messages to klog, logging each distinct message at most once
+// per interval.
+type Logger struct {
+	interval time.Duration
+	clock    clock.Clock
+	output   func(s severity, depth int, msg string)
+
+	lock      sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+// New returns a Logger rate limited to the interval set by
+// --log_rate_limit_interval.
+func New() *Logger {
+	return newLogger(*logRateLimitInterval, clock.RealClock{}, klogOutput)
+}
+
+func newLogger(interval time.Duration, clock clock.Clock, output func(severity, int, string)) *Logger {
+	return &Logger{
+		interval:  interval,
+		clock:     clock,
+		output:    output,
+		entries:   make(map[string]*entry),
+		lastSweep: clock.Now(),
+	}
+}
+
+func klogOutput(s severity, depth int, msg string) {
+	// Skip klogOutput itself as well as the frames of the Logger.
+	depth++
+	switch s {
+	case errorSeverity:
+		klog.ErrorDepth(depth, msg)
+	case warningSeverity:
+		klog.WarningDepth(depth, msg)
+	default:
+		klog.InfoDepth(depth, msg)
+	}
+}
+
+// Infof logs an informational message if verbosity is at least level.
+func (l *Logger) Infof(level klog.Level, format string, args ...interface{}) {
+	if !klog.V(level).Enabled() {
+		return
+	}
+	l.log(infoSeverity, format, args...)
+}
+
+// Warningf logs a warning.
+func (l *Logger) Warningf(format string, args ...interface{}) {
+	l.log(warningSeverity, format, args...)
+}
+
+// Errorf logs an error.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.log(errorSeverity, format, args...)
+}
+
+func (l *Logger) log(s severity, format string, args ...interface{}) {
+	// Frames of log and of the exported method calling it.
+	const depth = 2
+	msg := fmt.Sprintf(format, args...)
+	if l.interval <= 0 {
+		l.output(s, depth, msg)
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.clock.Now()
+	l.sweep(now)
+
+	key := fmt.Sprintf("%d:%s", s, msg)
+	e, ok := l.entries[key]
+	if ok && now.Sub(e.logged) < l.interval {
+		e.suppressed++
+		return
+	}
+	if ok && e.suppressed > 0 {
+		l.output(s, depth, e.summary(now))
+	} else {
+		l.output(s, depth, msg)
+	}
+	l.entries[key] = &entry{severity: s, msg: msg, logged: now}
+}
+
+// summary returns the message followed by the number of times it was
+// suppressed.
+func (e *entry) summary(now time.Time) string {
+	return fmt.Sprintf("%s (repeated %d more times in the last %v)", e.msg, e.suppressed, now.Sub(e.logged).Round(time.Second))
+}
+
+// sweep reports how many times the messages that were not logged again
+// since their interval elapsed were suppressed, and forgets them. It runs
+// at most once per interval.
+func (l *Logger) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.interval {
+		return
+	}
+	l.lastSweep = now
+	for key, e := range l.entries {
+		if now.Sub(e.logged) < l.interval {
+			continue
+		}
+		if e.suppressed > 0 {
+			// Frames of sweep, log and the exported method calling it.
+			l.output(e.severity, 3, e.summary(now))
+		}
+		delete(l.entries, key)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimitedlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clock "k8s.io/utils/clock/testing"
+)
+
+type recorder struct {
+	messages []string
+}
+
+func (r *recorder) output(s severity, depth int, msg string) {
+	r.messages = append(r.messages, msg)
+}
+
+func TestLoggerDeduplicatesMessages(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Unix(1000, 0))
+	r := &recorder{}
+	l := newLogger(time.Minute, fakeClock, r.output)
+
+	for i := 0; i < 5; i++ {
+		l.Warningf("Failed to update stats for container %q: %v", "/a", "no such file")
+		fakeClock.Step(time.Second)
+	}
+	l.Warningf("Failed to update stats for container %q: %v", "/b", "no such file")
+	l.Errorf("Failed to update stats for container %q: %v", "/a", "no such file")
+	assert.Equal(t, []string{
+		`Failed to update stats for container "/a": no such file`,
+		`Failed to update stats for container "/b": no such file`,
+		`Failed to update stats for container "/a": no such file`,
+	}, r.messages)
+
+	// Once the interval elapsed the message is logged again along with the
+	// number of suppressed repetitions.
+	r.messages = nil
+	fakeClock.Step(time.Minute)
+	l.Warningf("Failed to update stats for container %q: %v", "/a", "no such file")
+	assert.Equal(t, []string{
+		`Failed to update stats for container "/a": no such file (repeated 4 more times in the last 1m5s)`,
+		`Failed to update stats for container "/a": no such file`,
+	}, r.messages)
+}
+
+func TestLoggerWithoutInterval(t *testing.T) {
+	r := &recorder{}
+	l := newLogger(0, clock.NewFakeClock(time.Unix(1000, 0)), r.output)
+
+	for i := 0; i < 3; i++ {
+		l.Errorf("read failed")
+	}
+	assert.Equal(t, []string{"read failed", "read failed", "read failed"}, r.messages)
+}